@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+
+	"github.com/drakkan/sftpgo/config"
+	"github.com/drakkan/sftpgo/dataprovider"
+	"github.com/drakkan/sftpgo/fsmeta"
+	"github.com/drakkan/sftpgo/logger"
+	"github.com/drakkan/sftpgo/utils"
+	"github.com/drakkan/sftpgo/vfs"
+)
+
+var (
+	fsmetaBucket             string
+	fsmetaPrefix             string
+	fsmetaRegion             string
+	fsmetaEndpoint           string
+	fsmetaReconcileDryRun    bool
+	fsmetaBackfillWorkers    int
+	fsmetaBackfillRateLimit  float64
+	fsmetaBackfillBatchSize  int
+	fsmetaBackfillCheckpoint string
+	fsmetaCmd                = &cobra.Command{
+		Use:   "fsmeta",
+		Short: "Manage the fsmeta modification times store",
+	}
+	fsmetaReconcileCmd = &cobra.Command{
+		Use:   "reconcile",
+		Short: "Reconcile the fsmeta store with the objects in an S3 bucket",
+		Long: `This command reads the fsmeta connection details from the specified
+configuration file, walks the given S3 bucket/prefix and compares the listed
+objects with the stored rows by path, etag and size.
+
+Rows without a matching object are deleted, objects without a matching row
+are backfilled using the "Fs-Mtime" object metadata. Use the dry run mode to
+only report what would change.
+
+AWS credentials are loaded using the default credentials chain, for example
+from environment variables or the shared credentials file.
+
+$ sftpgo fsmeta reconcile --bucket mybucket --region us-east-1 --prefix users/ --dry-run
+
+Please take a look at the usage below to customize the options.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			fs := initFSMetaS3Fs("reconcile")
+			reconciler, ok := fs.(vfs.FSMetaReconciler)
+			if !ok {
+				logger.ErrorToConsole("fsmeta reconcile is not supported for %v", fs.Name())
+				os.Exit(1)
+			}
+			logger.InfoToConsole("Reconciling fsmeta for bucket %#v prefix %#v, dry run: %v", fsmetaBucket,
+				fsmetaPrefix, fsmetaReconcileDryRun)
+			report, err := reconciler.ReconcileFSMeta(context.Background(), fsmetaPrefix, fsmetaReconcileDryRun)
+			if err != nil {
+				logger.ErrorToConsole("unable to reconcile fsmeta: %v", err)
+				os.Exit(1)
+			}
+			printFSMetaReport(report, len(report.Errors))
+		},
+	}
+	fsmetaBackfillCmd = &cobra.Command{
+		Use:   "backfill",
+		Short: "Import the fsmeta store from the objects metadata in an S3 bucket",
+		Long: `This command reads the fsmeta connection details from the specified
+configuration file, walks the given S3 bucket/prefix and stores the
+"Fs-Mtime" object metadata for the objects without up to date rows, so the
+folders don't need to self-heal, one HEAD request per file, the first time
+they are listed.
+
+The objects metadata are read using concurrent HEAD requests, optionally rate
+limited, and stored using multi-row upserts. Stale rows are not removed, use
+the reconcile command for that.
+
+If a checkpoint file is specified the last listed key is saved after each
+stored page and an interrupted job resumes from there when started again with
+the same bucket and prefix. The checkpoint file is removed once the job
+completes.
+
+AWS credentials are loaded using the default credentials chain, for example
+from environment variables or the shared credentials file.
+
+$ sftpgo fsmeta backfill --bucket mybucket --region us-east-1 --prefix users/ --workers 16 --rate-limit 200 --checkpoint /tmp/backfill.json
+
+Please take a look at the usage below to customize the options.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			fs := initFSMetaS3Fs("backfill")
+			backfiller, ok := fs.(vfs.FSMetaBackfiller)
+			if !ok {
+				logger.ErrorToConsole("fsmeta backfill is not supported for %v", fs.Name())
+				os.Exit(1)
+			}
+			logger.InfoToConsole("Backfilling fsmeta for bucket %#v prefix %#v, workers: %v, rate limit: %v",
+				fsmetaBucket, fsmetaPrefix, fsmetaBackfillWorkers, fsmetaBackfillRateLimit)
+			report, err := backfiller.BackfillFSMeta(context.Background(), fsmeta.BackfillOptions{
+				Prefix:     fsmetaPrefix,
+				Workers:    fsmetaBackfillWorkers,
+				RateLimit:  fsmetaBackfillRateLimit,
+				BatchSize:  fsmetaBackfillBatchSize,
+				Checkpoint: fsmetaBackfillCheckpoint,
+			})
+			if err != nil {
+				logger.ErrorToConsole("unable to backfill fsmeta: %v, scanned: %v, backfilled: %v", err,
+					report.Scanned, report.Backfilled)
+				os.Exit(1)
+			}
+			printFSMetaReport(report, len(report.Errors))
+		},
+	}
+)
+
+// initFSMetaS3Fs loads the configuration, initializes fsmeta and returns the S3 filesystem
+// for the configured bucket, it exits on errors
+func initFSMetaS3Fs(operation string) vfs.Fs {
+	logger.DisableLogger()
+	logger.EnableConsoleLogger(zerolog.DebugLevel)
+	configDir = utils.CleanDirInput(configDir)
+	err := config.LoadConfig(configDir, configFile)
+	if err != nil {
+		logger.WarnToConsole("Unable to %v fsmeta, config load error: %v", operation, err)
+		os.Exit(1)
+	}
+	fsMetaConfig := config.GetFSMetaConfig()
+	if !fsMetaConfig.Enabled {
+		logger.WarnToConsole("fsmeta is not enabled in the configuration file")
+		os.Exit(1)
+	}
+	if fsMetaConfig.UseDataProvider {
+		err = dataprovider.Initialize(config.GetProviderConf(), configDir, false)
+		if err == nil {
+			err = dataprovider.InitializeFSMeta(fsMetaConfig)
+		}
+	} else {
+		err = fsmeta.Initialize(fsMetaConfig, configDir)
+	}
+	if err != nil {
+		logger.ErrorToConsole("unable to initialize fsmeta: %v", err)
+		os.Exit(1)
+	}
+	fs, err := vfs.NewS3Fs("", os.TempDir(), vfs.S3FsConfig{
+		Bucket:   fsmetaBucket,
+		Region:   fsmetaRegion,
+		Endpoint: fsmetaEndpoint,
+	})
+	if err != nil {
+		logger.ErrorToConsole("unable to initialize S3 client: %v", err)
+		os.Exit(1)
+	}
+	return fs
+}
+
+func printFSMetaReport(report interface{}, errors int) {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		logger.ErrorToConsole("unable to marshal the report: %v", err)
+		os.Exit(1)
+	}
+	fmt.Println(string(data))
+	if errors > 0 {
+		os.Exit(1)
+	}
+}
+
+func addFSMetaS3Flags(cmd *cobra.Command, operation string) {
+	addConfigFlags(cmd)
+	cmd.Flags().StringVar(&fsmetaBucket, "bucket", "", fmt.Sprintf(`S3 bucket to %v`, operation))
+	cmd.Flags().StringVar(&fsmetaPrefix, "prefix", "", fmt.Sprintf(`Limit the %v to the keys
+starting with this prefix`, operation))
+	cmd.Flags().StringVar(&fsmetaRegion, "region", "", `S3 region`)
+	cmd.Flags().StringVar(&fsmetaEndpoint, "endpoint", "", `S3 endpoint, required for S3
+compatible object storages only`)
+	cmd.MarkFlagRequired("bucket") //nolint:errcheck
+	cmd.MarkFlagRequired("region") //nolint:errcheck
+}
+
+func init() {
+	addFSMetaS3Flags(fsmetaReconcileCmd, "reconciliation")
+	fsmetaReconcileCmd.Flags().BoolVar(&fsmetaReconcileDryRun, "dry-run", false, `Report the changes without
+applying them`)
+
+	addFSMetaS3Flags(fsmetaBackfillCmd, "backfill")
+	fsmetaBackfillCmd.Flags().IntVar(&fsmetaBackfillWorkers, "workers", 8, `Number of concurrent HEAD requests`)
+	fsmetaBackfillCmd.Flags().Float64Var(&fsmetaBackfillRateLimit, "rate-limit", 0, `Maximum number of HEAD requests
+per second. 0 means unlimited`)
+	fsmetaBackfillCmd.Flags().IntVar(&fsmetaBackfillBatchSize, "batch-size", 500, `Maximum number of rows stored
+using a single batch`)
+	fsmetaBackfillCmd.Flags().StringVar(&fsmetaBackfillCheckpoint, "checkpoint", "", `Path of the checkpoint file
+used to resume an interrupted backfill`)
+
+	fsmetaCmd.AddCommand(fsmetaReconcileCmd)
+	fsmetaCmd.AddCommand(fsmetaBackfillCmd)
+	rootCmd.AddCommand(fsmetaCmd)
+}
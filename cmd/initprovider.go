@@ -29,6 +29,9 @@ For SQLite/bolt providers the database file will be auto-created if missing.
 For PostgreSQL and MySQL providers you need to create the configured database,
 this command will create/update the required tables as needed.
 
+If fsmeta is configured to use the data provider database, its tables are
+created/updated too.
+
 To initialize/update the data provider from the configuration directory simply use:
 
 $ sftpgo initprovider
@@ -60,6 +63,14 @@ Please take a look at the usage below to customize the options.`,
 				logger.WarnToConsole("Unable to initialize/update the data provider: %v", err)
 				os.Exit(1)
 			}
+			if config.GetFSMetaConfig().UseDataProvider {
+				err = dataprovider.InitializeFSMetaDatabase()
+				if err != nil {
+					logger.WarnToConsole("Unable to initialize/update the fsmeta tables: %v", err)
+					os.Exit(1)
+				}
+				logger.InfoToConsole("fsmeta tables successfully initialized/updated")
+			}
 		},
 	}
 )
@@ -21,6 +21,7 @@ var (
 		Long: `This command reads the data provider connection details from the specified
 configuration file and restore the provider schema and/or data to a previous version.
 This command is not supported for the memory provider.
+If fsmeta is configured to use the data provider database, its tables are removed.
 
 Please take a look at the usage below to customize the options.`,
 		Run: func(cmd *cobra.Command, args []string) {
@@ -51,6 +52,14 @@ Please take a look at the usage below to customize the options.`,
 				os.Exit(1)
 			}
 			logger.InfoToConsole("Data provider successfully reverted")
+			if config.GetFSMetaConfig().UseDataProvider {
+				err = dataprovider.RevertFSMetaDatabase()
+				if err != nil {
+					logger.WarnToConsole("Error removing the fsmeta tables: %v", err)
+					os.Exit(1)
+				}
+				logger.InfoToConsole("fsmeta tables successfully removed")
+			}
 		},
 	}
 )
@@ -65,6 +65,8 @@ Command-line flags should be specified in the Subsystem declaration.
 			commonConfig := config.GetCommonConfig()
 			// idle connection are managed externally
 			commonConfig.IdleTimeout = 0
+			// the process ends with the SSH session, the notifications cannot be queued
+			commonConfig.Actions.Queue.Enabled = false
 			config.SetCommonConfig(commonConfig)
 			if err := common.Initialize(config.GetCommonConfig()); err != nil {
 				logger.Error(logSender, connectionID, "%v", err)
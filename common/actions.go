@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
@@ -20,6 +22,12 @@ import (
 	"github.com/drakkan/sftpgo/utils"
 )
 
+const (
+	maxActionDeniedReasonLength = 512
+	// actionHookTarget identifies the hook inside the delivered targets of a queued notification
+	actionHookTarget = "hook"
+)
+
 var (
 	errUnconfiguredAction    = errors.New("no hook is configured for this action")
 	errNoHook                = errors.New("unable to execute action, no hook defined")
@@ -28,10 +36,20 @@ var (
 
 // ProtocolActions defines the action to execute on file operations and SSH commands
 type ProtocolActions struct {
-	// Valid values are download, upload, pre-delete, delete, rename, ssh_cmd. Empty slice to disable
+	// Valid values are download, upload, pre-delete, delete, rename, ssh_cmd, pre-upload, pre-download,
+	// pre-rename, pre-mkdir, infected. Empty slice to disable
 	ExecuteOn []string `json:"execute_on" mapstructure:"execute_on"`
 	// Absolute path to an external program or an HTTP URL
 	Hook string `json:"hook" mapstructure:"hook"`
+	// Queue defines the configuration for the durable delivery of the notifications
+	Queue ActionsQueueConfig `json:"queue" mapstructure:"queue"`
+	// Sinks defines the message brokers the notifications can be published to
+	Sinks []ActionSink `json:"sinks" mapstructure:"sinks"`
+	// Routes defines the rules to select the sinks for each notification
+	Routes []ActionRoute `json:"routes" mapstructure:"routes"`
+	// Checksum defines the algorithm to compute the checksum of the uploaded files
+	// while they are written, supported values: "md5", "sha256". Empty means disabled
+	Checksum string `json:"checksum" mapstructure:"checksum"`
 }
 
 var actionHandler ActionHandler = &defaultActionHandler{}
@@ -44,12 +62,29 @@ func InitializeActionHandler(handler ActionHandler) {
 }
 
 // SSHCommandActionNotification executes the defined action for the specified SSH command.
-func SSHCommandActionNotification(user *dataprovider.User, filePath, target, sshCmd string, err error) {
-	notification := newActionNotification(user, operationSSHCmd, filePath, target, sshCmd, ProtocolSSH, 0, err)
+func SSHCommandActionNotification(conn *BaseConnection, filePath, virtualPath, target, virtualTarget, sshCmd string,
+	err error,
+) {
+	notification := newActionNotification(&conn.User, operationSSHCmd, filePath, target, sshCmd, ProtocolSSH, 0, err)
+	conn.addActionNotificationDetails(notification, virtualPath, virtualTarget)
 
 	go actionHandler.Handle(notification) // nolint:errcheck
 }
 
+// ActionDeniedError is returned if a pre-upload, pre-download, pre-rename or pre-mkdir
+// hook denies the operation. Custom action handlers can return it to deny an operation
+// with a reason, any other error denies the operation without a reason
+type ActionDeniedError struct {
+	Reason string
+}
+
+func (e *ActionDeniedError) Error() string {
+	if e.Reason == "" {
+		return "operation denied by hook"
+	}
+	return fmt.Sprintf("operation denied by hook: %v", e.Reason)
+}
+
 // ActionHandler handles a notification for a Protocol Action.
 type ActionHandler interface {
 	Handle(notification *ActionNotification) error
@@ -68,6 +103,21 @@ type ActionNotification struct {
 	Endpoint   string `json:"endpoint,omitempty"`
 	Status     int    `json:"status"`
 	Protocol   string `json:"protocol"`
+	// virtual paths, as seen by the user, Path and TargetPath are the
+	// filesystem paths or the object keys for cloud backends
+	VirtualPath       string `json:"virtual_path,omitempty"`
+	VirtualTargetPath string `json:"virtual_target_path,omitempty"`
+	IP                string `json:"ip,omitempty"`
+	ConnectionID      string `json:"connection_id,omitempty"`
+	// start and end time for uploads and downloads as milliseconds since epoch,
+	// elapsed is expressed in milliseconds
+	StartTime    int64  `json:"start_time,omitempty"`
+	EndTime      int64  `json:"end_time,omitempty"`
+	Elapsed      int64  `json:"elapsed,omitempty"`
+	Checksum     string `json:"checksum,omitempty"`
+	ChecksumAlgo string `json:"checksum_algo,omitempty"`
+	// Signature is the virus detected in the uploaded file, set for infected notifications
+	Signature string `json:"signature,omitempty"`
 }
 
 func newActionNotification(
@@ -121,17 +171,58 @@ func (h *defaultActionHandler) Handle(notification *ActionNotification) error {
 		return errUnconfiguredAction
 	}
 
-	if Config.Actions.Hook == "" {
-		logger.Warn(notification.Protocol, "", "Unable to send notification, no hook is defined")
+	if Config.Actions.Hook == "" && !actionSinks.hasRoute(notification) {
+		logger.Warn(notification.Protocol, "", "Unable to send notification, no hook or sink is defined")
 
 		return errNoHook
 	}
 
-	if strings.HasPrefix(Config.Actions.Hook, "http") {
-		return h.handleHTTP(notification)
+	// pre-action notifications cannot be queued, their outcome is required to continue
+	if Config.Actions.Queue.Enabled && !isPreAction(notification.Action) {
+		err := enqueueActionNotification(notification)
+		if err == nil {
+			return nil
+		}
+		logger.Warn(notification.Protocol, "", "unable to queue notification for operation %#v, delivering it now: %v",
+			notification.Action, err)
+	}
+
+	return h.deliver(notification)
+}
+
+func (h *defaultActionHandler) deliver(notification *ActionNotification) error {
+	_, err := h.deliverTo(notification, nil)
+	return err
+}
+
+// deliverTo sends the notification to the hook and to the matching sinks, the targets
+// included in delivered are skipped. It returns the targets delivered by this call
+func (h *defaultActionHandler) deliverTo(notification *ActionNotification, delivered []string) ([]string, error) {
+	var targets []string
+	var err error
+	if Config.Actions.Hook != "" && !utils.IsStringInSlice(actionHookTarget, delivered) {
+		if strings.HasPrefix(Config.Actions.Hook, "http") {
+			err = h.handleHTTP(notification)
+		} else {
+			err = h.handleCommand(notification)
+		}
+		if err == nil {
+			targets = append(targets, actionHookTarget)
+		}
+	}
+	// the outcome of the pre-action notifications depends on the hook only,
+	// a broker outage must not deny or delay the operations
+	if isPreAction(notification.Action) {
+		return targets, err
+	}
+
+	published, errSinks := actionSinks.publish(notification, delivered)
+	targets = append(targets, published...)
+	if errSinks != nil && err == nil {
+		err = errSinks
 	}
 
-	return h.handleCommand(notification)
+	return targets, err
 }
 
 func (h *defaultActionHandler) handleHTTP(notification *ActionNotification) error {
@@ -153,11 +244,15 @@ func (h *defaultActionHandler) handleHTTP(notification *ActionNotification) erro
 	resp, err := httpClient.Post(u.String(), "application/json", &b)
 	if err == nil {
 		respCode = resp.StatusCode
-		resp.Body.Close()
 
 		if respCode != http.StatusOK {
 			err = errUnexpectedHTTResponse
+			if isVetoAction(notification.Action) {
+				body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxActionDeniedReasonLength))
+				err = &ActionDeniedError{Reason: getActionDeniedReason(body)}
+			}
 		}
+		resp.Body.Close()
 	}
 
 	logger.Debug(notification.Protocol, "", "notified operation %#v to URL: %v status code: %v, elapsed: %v err: %v", notification.Action, u.String(), respCode, time.Since(startTime), err)
@@ -179,8 +274,17 @@ func (h *defaultActionHandler) handleCommand(notification *ActionNotification) e
 	cmd := exec.CommandContext(ctx, Config.Actions.Hook, notification.Action, notification.Username, notification.Path, notification.TargetPath, notification.SSHCmd)
 	cmd.Env = append(os.Environ(), notificationAsEnvVars(notification)...)
 
+	var stdout bytes.Buffer
+	if isVetoAction(notification.Action) {
+		cmd.Stdout = &stdout
+	}
+
 	startTime := time.Now()
 	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && isVetoAction(notification.Action) {
+		err = &ActionDeniedError{Reason: getActionDeniedReason(stdout.Bytes())}
+	}
 
 	logger.Debug(notification.Protocol, "", "executed command %#v with arguments: %#v, %#v, %#v, %#v, %#v, elapsed: %v, error: %v",
 		Config.Actions.Hook, notification.Action, notification.Username, notification.Path, notification.TargetPath, notification.SSHCmd, time.Since(startTime), err)
@@ -201,5 +305,43 @@ func notificationAsEnvVars(notification *ActionNotification) []string {
 		fmt.Sprintf("SFTPGO_ACTION_ENDPOINT=%v", notification.Endpoint),
 		fmt.Sprintf("SFTPGO_ACTION_STATUS=%v", notification.Status),
 		fmt.Sprintf("SFTPGO_ACTION_PROTOCOL=%v", notification.Protocol),
+		fmt.Sprintf("SFTPGO_ACTION_VIRTUAL_PATH=%v", notification.VirtualPath),
+		fmt.Sprintf("SFTPGO_ACTION_VIRTUAL_TARGET=%v", notification.VirtualTargetPath),
+		fmt.Sprintf("SFTPGO_ACTION_IP=%v", notification.IP),
+		fmt.Sprintf("SFTPGO_ACTION_CONNECTION_ID=%v", notification.ConnectionID),
+		fmt.Sprintf("SFTPGO_ACTION_START_TIME=%v", notification.StartTime),
+		fmt.Sprintf("SFTPGO_ACTION_END_TIME=%v", notification.EndTime),
+		fmt.Sprintf("SFTPGO_ACTION_ELAPSED=%v", notification.Elapsed),
+		fmt.Sprintf("SFTPGO_ACTION_CHECKSUM=%v", notification.Checksum),
+		fmt.Sprintf("SFTPGO_ACTION_CHECKSUM_ALGO=%v", notification.ChecksumAlgo),
+		fmt.Sprintf("SFTPGO_ACTION_SIGNATURE=%v", notification.Signature),
+	}
+}
+
+// getActionDeniedReason returns the first line of the hook response
+func getActionDeniedReason(response []byte) string {
+	reason := strings.TrimSpace(string(response))
+	if idx := strings.IndexAny(reason, "\r\n"); idx >= 0 {
+		reason = strings.TrimSpace(reason[:idx])
+	}
+	if len(reason) > maxActionDeniedReasonLength {
+		reason = reason[:maxActionDeniedReasonLength]
+	}
+	return reason
+}
+
+// isPreAction returns true if the operation is notified before it is executed,
+// these notifications are delivered synchronously
+func isPreAction(operation string) bool {
+	return operation == operationPreDelete || isVetoAction(operation)
+}
+
+// isVetoAction returns true if the hook outcome can deny the operation
+func isVetoAction(operation string) bool {
+	switch operation {
+	case operationPreUpload, operationPreDownload, operationPreRename, operationPreMkdir:
+		return true
+	default:
+		return false
 	}
 }
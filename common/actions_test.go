@@ -1,6 +1,7 @@
 package common
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -10,6 +11,7 @@ import (
 	"runtime"
 	"testing"
 
+	"github.com/pkg/sftp"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/drakkan/sftpgo/dataprovider"
@@ -64,6 +66,36 @@ func TestNewActionNotification(t *testing.T) {
 	assert.Equal(t, 1, a.Status)
 }
 
+func TestActionNotificationDetails(t *testing.T) {
+	user := dataprovider.User{
+		Username: "username",
+	}
+	conn := NewBaseConnection("id", ProtocolFTP, user, nil)
+	conn.SetRemoteAddress("172.16.1.2:4567")
+	a := newActionNotification(&user, operationRename, "/home/path", "/home/target", "", ProtocolFTP, 0, nil)
+	conn.addActionNotificationDetails(a, "/path", "/target")
+	assert.Equal(t, "/path", a.VirtualPath)
+	assert.Equal(t, "/target", a.VirtualTargetPath)
+	assert.Equal(t, "172.16.1.2", a.IP)
+	assert.Equal(t, conn.GetID(), a.ConnectionID)
+
+	a.StartTime = 1000
+	a.EndTime = 3000
+	a.Elapsed = 2000
+	a.Checksum = "abcd"
+	a.ChecksumAlgo = checksumSHA256
+	envVars := notificationAsEnvVars(a)
+	assert.Contains(t, envVars, "SFTPGO_ACTION_VIRTUAL_PATH=/path")
+	assert.Contains(t, envVars, "SFTPGO_ACTION_VIRTUAL_TARGET=/target")
+	assert.Contains(t, envVars, "SFTPGO_ACTION_IP=172.16.1.2")
+	assert.Contains(t, envVars, fmt.Sprintf("SFTPGO_ACTION_CONNECTION_ID=%v", conn.GetID()))
+	assert.Contains(t, envVars, "SFTPGO_ACTION_START_TIME=1000")
+	assert.Contains(t, envVars, "SFTPGO_ACTION_END_TIME=3000")
+	assert.Contains(t, envVars, "SFTPGO_ACTION_ELAPSED=2000")
+	assert.Contains(t, envVars, "SFTPGO_ACTION_CHECKSUM=abcd")
+	assert.Contains(t, envVars, "SFTPGO_ACTION_CHECKSUM_ALGO=sha256")
+}
+
 func TestActionHTTP(t *testing.T) {
 	actionsCopy := Config.Actions
 
@@ -111,7 +143,8 @@ func TestActionCMD(t *testing.T) {
 	err = actionHandler.Handle(a)
 	assert.NoError(t, err)
 
-	SSHCommandActionNotification(user, "path", "target", "sha1sum", nil)
+	conn := NewBaseConnection("id", ProtocolSSH, *user, nil)
+	SSHCommandActionNotification(conn, "path", "/vpath", "target", "/vtarget", "sha1sum", nil)
 
 	Config.Actions = actionsCopy
 }
@@ -197,6 +230,125 @@ func TestPreDeleteAction(t *testing.T) {
 	Config.Actions = actionsCopy
 }
 
+func TestPreActions(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("this test is not available on Windows")
+	}
+	actionsCopy := Config.Actions
+
+	homeDir := filepath.Join(os.TempDir(), "test_user")
+	err := os.MkdirAll(homeDir, os.ModePerm)
+	assert.NoError(t, err)
+	hookCmd := filepath.Join(os.TempDir(), "pre_action_hook.sh")
+	hookContent := []byte("#!/bin/sh\n\ncase \"$SFTPGO_ACTION_VIRTUAL_PATH\" in\n*denied*)\n" +
+		"echo \"$SFTPGO_ACTION denied for $SFTPGO_ACTION_VIRTUAL_PATH size $SFTPGO_ACTION_FILE_SIZE\"\necho \"second line\"\n" +
+		"exit 1\n;;\n*noreason*)\nexit 1\n;;\nesac\n")
+	err = ioutil.WriteFile(hookCmd, hookContent, os.ModePerm)
+	assert.NoError(t, err)
+	Config.Actions = ProtocolActions{
+		ExecuteOn: []string{operationPreUpload, operationPreDownload, operationPreRename, operationPreMkdir},
+		Hook:      hookCmd,
+	}
+	user := dataprovider.User{
+		Username: "username",
+		HomeDir:  homeDir,
+	}
+	user.Permissions = make(map[string][]string)
+	user.Permissions["/"] = []string{dataprovider.PermAny}
+	fs := vfs.NewOsFs("id", homeDir, nil)
+	c := NewBaseConnection("id", ProtocolSFTP, user, fs)
+
+	testfile := filepath.Join(homeDir, "denied_file")
+	err = ioutil.WriteFile(testfile, []byte("test"), os.ModePerm)
+	assert.NoError(t, err)
+
+	err = c.ExecutePreTransferAction(TransferUpload, filepath.Join(homeDir, "file"), "/file", 0)
+	assert.NoError(t, err)
+	err = c.ExecutePreTransferAction(TransferUpload, testfile, "/denied_file", 4)
+	assert.ErrorIs(t, err, os.ErrPermission)
+	assert.EqualError(t, err, "operation denied by hook: pre-upload denied for /denied_file size 4: permission denied")
+	err = c.ExecutePreTransferAction(TransferDownload, testfile, "/denied_file", -1)
+	assert.ErrorIs(t, err, os.ErrPermission)
+	err = c.ExecutePreTransferAction(TransferDownload, testfile, "/noreason", -1)
+	assert.Equal(t, sftp.ErrSSHFxPermissionDenied, err)
+	err = c.ExecutePreMkdirAction(filepath.Join(homeDir, "dir"), "/dir")
+	assert.NoError(t, err)
+	err = c.CreateDir(filepath.Join(homeDir, "denied_dir"), "/denied_dir")
+	assert.ErrorIs(t, err, os.ErrPermission)
+	assert.NoDirExists(t, filepath.Join(homeDir, "denied_dir"))
+	err = c.Rename(testfile, filepath.Join(homeDir, "renamed"), "/denied_file", "/renamed")
+	assert.ErrorIs(t, err, os.ErrPermission)
+	assert.FileExists(t, testfile)
+	// the reason is returned to SFTP, FTP and SCP clients
+	c.SetProtocol(ProtocolFTP)
+	err = c.ExecutePreTransferAction(TransferDownload, testfile, "/denied_file", -1)
+	assert.ErrorIs(t, err, os.ErrPermission)
+	assert.EqualError(t, err, "permission denied: pre-download denied for /denied_file size 4")
+	err = c.ExecutePreTransferAction(TransferUpload, testfile, "/noreason", 0)
+	assert.Equal(t, os.ErrPermission, err)
+	c.SetProtocol(ProtocolSCP)
+	err = c.ExecutePreMkdirAction(filepath.Join(homeDir, "denied_dir"), "/denied_dir")
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	assert.EqualError(t, err, "permission denied: pre-mkdir denied for /denied_dir size 0")
+	c.SetProtocol(ProtocolWebDAV)
+	err = c.ExecutePreTransferAction(TransferUpload, testfile, "/denied_file", 4)
+	assert.Equal(t, os.ErrPermission, err)
+	// actions not configured are allowed
+	Config.Actions.ExecuteOn = []string{operationPreUpload}
+	err = c.Rename(testfile, filepath.Join(homeDir, "renamed"), "/denied_file", "/renamed")
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(homeDir, "renamed"))
+	// no hook defined
+	Config.Actions.Hook = ""
+	err = c.ExecutePreTransferAction(TransferUpload, testfile, "/denied_file", 4)
+	assert.NoError(t, err)
+	// HTTP hook, the reason is read from the response body
+	Config.Actions.Hook = fmt.Sprintf("http://%v/404", httpAddr)
+	c.SetProtocol(ProtocolFTP)
+	err = c.ExecutePreTransferAction(TransferUpload, testfile, "/denied_file", 4)
+	assert.EqualError(t, err, "permission denied: Not found")
+	Config.Actions.Hook = fmt.Sprintf("http://%v/", httpAddr)
+	err = c.ExecutePreTransferAction(TransferUpload, testfile, "/denied_file", 4)
+	assert.NoError(t, err)
+	// the operation is denied if the hook cannot be executed
+	Config.Actions.Hook = "http://127.0.0.1:1/"
+	err = c.ExecutePreTransferAction(TransferUpload, testfile, "/denied_file", 4)
+	assert.Equal(t, os.ErrPermission, err)
+	// custom handlers can deny with a reason
+	InitializeActionHandler(&actionHandlerDenyStub{reason: "submission window closed"})
+	err = c.ExecutePreTransferAction(TransferUpload, testfile, "/file", 4)
+	assert.EqualError(t, err, "permission denied: submission window closed")
+	InitializeActionHandler(&defaultActionHandler{})
+
+	err = os.Remove(hookCmd)
+	assert.NoError(t, err)
+	err = os.RemoveAll(homeDir)
+	assert.NoError(t, err)
+
+	Config.Actions = actionsCopy
+}
+
+func TestPreActionsNotQueuedOrRouted(t *testing.T) {
+	assert.True(t, isPreAction(operationPreDelete))
+	assert.False(t, isVetoAction(operationPreDelete))
+	for _, action := range []string{operationPreUpload, operationPreDownload, operationPreRename, operationPreMkdir} {
+		assert.True(t, isPreAction(action))
+		assert.True(t, isVetoAction(action))
+		err := validateActionSinks([]ActionSink{{Name: "sink", URL: "nats://subject"}},
+			[]ActionRoute{{Actions: []string{action}, Sinks: []string{"sink"}}})
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "cannot be routed")
+		}
+	}
+	assert.False(t, isPreAction(operationUpload))
+
+	assert.Equal(t, "first line", getActionDeniedReason([]byte("\n first line \r\nsecond line\n")))
+	assert.Len(t, getActionDeniedReason(bytes.Repeat([]byte("a"), maxActionDeniedReasonLength+10)),
+		maxActionDeniedReasonLength)
+	assert.Equal(t, "operation denied by hook", (&ActionDeniedError{}).Error())
+	assert.Equal(t, "operation denied by hook: reason", (&ActionDeniedError{Reason: "reason"}).Error())
+}
+
 type actionHandlerStub struct {
 	called bool
 }
@@ -220,3 +372,11 @@ func TestInitializeActionHandler(t *testing.T) {
 	assert.NoError(t, err)
 	assert.True(t, handler.called)
 }
+
+type actionHandlerDenyStub struct {
+	reason string
+}
+
+func (h *actionHandlerDenyStub) Handle(notification *ActionNotification) error {
+	return &ActionDeniedError{Reason: h.reason}
+}
@@ -0,0 +1,319 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"gocloud.dev/pubsub"
+
+	"github.com/drakkan/sftpgo/logger"
+	"github.com/drakkan/sftpgo/utils"
+)
+
+const (
+	actionSinkTimeout = 30 * time.Second
+	// actionSinkTargetPrefix identifies a sink inside the delivered targets of a queued notification
+	actionSinkTargetPrefix = "sink:"
+)
+
+var (
+	// the supported sink schemes are registered by the drivers, they can be
+	// disabled at build time. Test cases can replace it with a custom mux
+	actionSinksURLMux = pubsub.DefaultURLMux()
+	actionSinks       = &actionSinksManager{}
+)
+
+// ActionSink defines a message broker topic the action notifications can be published to
+type ActionSink struct {
+	// Name is the unique sink identifier, it is referenced inside the routing rules
+	Name string `json:"name" mapstructure:"name"`
+	// URL identifies the topic to publish to, the scheme selects the broker:
+	// "rabbit" for AMQP, "nats" for NATS, "kafka" for Kafka, "gcppubsub" for
+	// Google Cloud Pub/Sub, "awssns" and "awssqs" for AWS SNS and SQS.
+	// The brokers connection details are read from the environment
+	URL string `json:"url" mapstructure:"url"`
+}
+
+// ActionRoute defines a routing rule for the action notifications.
+// A notification is published to the route sinks if it matches all the route filters,
+// an empty filter matches any value
+type ActionRoute struct {
+	// Actions to route, pre-delete, pre-upload, pre-download, pre-rename and pre-mkdir
+	// notifications cannot be routed
+	Actions []string `json:"actions" mapstructure:"actions"`
+	// Usernames defines shell patterns, for example "team_*", matched against the username
+	Usernames []string `json:"usernames" mapstructure:"usernames"`
+	// Paths defines shell patterns matched against the notification path, for example "/srv/incoming/*.csv".
+	// A pattern ending with "/**" matches a directory and all its contents
+	Paths []string `json:"paths" mapstructure:"paths"`
+	// Sinks defines the names of the sinks to publish the matching notifications to
+	Sinks []string `json:"sinks" mapstructure:"sinks"`
+}
+
+func (r *ActionRoute) matches(notification *ActionNotification) bool {
+	if len(r.Actions) > 0 && !utils.IsStringInSlice(notification.Action, r.Actions) {
+		return false
+	}
+	if len(r.Usernames) > 0 && !matchAnyPattern(r.Usernames, notification.Username) {
+		return false
+	}
+	if len(r.Paths) > 0 && !matchAnyPattern(r.Paths, notification.Path) {
+		return false
+	}
+	return true
+}
+
+func matchAnyPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "/**") {
+			dir := strings.TrimSuffix(pattern, "/**")
+			if dir == "" || name == dir || strings.HasPrefix(name, dir+"/") {
+				return true
+			}
+			continue
+		}
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func validateActionSinks(sinks []ActionSink, routes []ActionRoute) error {
+	names := make(map[string]bool)
+	for _, sink := range sinks {
+		if sink.Name == "" {
+			return errors.New("invalid action sink: the name is mandatory")
+		}
+		if names[sink.Name] {
+			return fmt.Errorf("invalid action sink: duplicated name %#v", sink.Name)
+		}
+		names[sink.Name] = true
+		u, err := url.Parse(sink.URL)
+		if err != nil {
+			return fmt.Errorf("invalid URL for action sink %#v: %v", sink.Name, err)
+		}
+		if !actionSinksURLMux.ValidTopicScheme(u.Scheme) {
+			return fmt.Errorf("invalid URL for action sink %#v: unsupported scheme %#v", sink.Name, u.Scheme)
+		}
+	}
+	for idx, route := range routes {
+		if len(route.Sinks) == 0 {
+			return fmt.Errorf("invalid action route %v: no sink defined", idx)
+		}
+		for _, name := range route.Sinks {
+			if !names[name] {
+				return fmt.Errorf("invalid action route %v: undefined sink %#v", idx, name)
+			}
+		}
+		for _, action := range route.Actions {
+			if isPreAction(action) {
+				return fmt.Errorf("invalid action route %v: %#v notifications cannot be routed", idx, action)
+			}
+		}
+		if err := validateRoutePatterns(route.Usernames); err != nil {
+			return fmt.Errorf("invalid action route %v: %v", idx, err)
+		}
+		if err := validateRoutePatterns(route.Paths); err != nil {
+			return fmt.Errorf("invalid action route %v: %v", idx, err)
+		}
+	}
+	return nil
+}
+
+func validateRoutePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(strings.TrimSuffix(pattern, "/**"), "abc"); err != nil {
+			return fmt.Errorf("invalid pattern %#v: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// actionSink publishes the action notifications to a message broker
+type actionSink interface {
+	publish(ctx context.Context, notification *ActionNotification) error
+	close() error
+}
+
+// pubSubSink is an actionSink backed by a Go CDK topic. The topic is
+// opened on first use and reopened after a failed publish
+type pubSubSink struct {
+	sync.Mutex
+	config ActionSink
+	topic  *pubsub.Topic
+	closed bool
+}
+
+func newActionSink(config ActionSink) actionSink {
+	return &pubSubSink{
+		config: config,
+	}
+}
+
+func (s *pubSubSink) getTopic(ctx context.Context) (*pubsub.Topic, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.closed {
+		return nil, fmt.Errorf("action sink %#v was closed", s.config.Name)
+	}
+	if s.topic == nil {
+		topic, err := actionSinksURLMux.OpenTopic(ctx, s.config.URL)
+		if err != nil {
+			return nil, err
+		}
+		s.topic = topic
+	}
+	return s.topic, nil
+}
+
+func (s *pubSubSink) publish(ctx context.Context, notification *ActionNotification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	topic, err := s.getTopic(ctx)
+	if err != nil {
+		return err
+	}
+	err = topic.Send(ctx, &pubsub.Message{
+		Body: body,
+		Metadata: map[string]string{
+			"action":   notification.Action,
+			"username": notification.Username,
+			"protocol": notification.Protocol,
+		},
+	})
+	if err != nil {
+		s.Lock()
+		if s.topic == topic {
+			s.topic = nil
+			go topic.Shutdown(context.Background()) //nolint:errcheck
+		}
+		s.Unlock()
+	}
+	return err
+}
+
+func (s *pubSubSink) close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.closed = true
+	if s.topic == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), actionSinkTimeout)
+	defer cancel()
+
+	err := s.topic.Shutdown(ctx)
+	s.topic = nil
+	return err
+}
+
+// actionSinksManager routes the action notifications to the configured sinks
+type actionSinksManager struct {
+	sync.RWMutex
+	sinks  map[string]actionSink
+	routes []ActionRoute
+}
+
+// reload replaces the configured sinks and routes, the previous sinks are closed
+func (m *actionSinksManager) reload(sinks []ActionSink, routes []ActionRoute) {
+	m.Lock()
+	defer m.Unlock()
+
+	for name, sink := range m.sinks {
+		if err := sink.close(); err != nil {
+			logger.Warn(logSender, "", "unable to close action sink %#v: %v", name, err)
+		}
+	}
+	m.sinks = make(map[string]actionSink)
+	for _, config := range sinks {
+		m.sinks[config.Name] = newActionSink(config)
+	}
+	m.routes = routes
+}
+
+// getSinkNames returns the names of the sinks the given notification must be published to
+func (m *actionSinksManager) getSinkNames(notification *ActionNotification) []string {
+	m.RLock()
+	defer m.RUnlock()
+
+	var names []string
+	if isPreAction(notification.Action) {
+		return names
+	}
+	for idx := range m.routes {
+		if m.routes[idx].matches(notification) {
+			for _, name := range m.routes[idx].Sinks {
+				if !utils.IsStringInSlice(name, names) {
+					names = append(names, name)
+				}
+			}
+		}
+	}
+	return names
+}
+
+func (m *actionSinksManager) hasRoute(notification *ActionNotification) bool {
+	return len(m.getSinkNames(notification)) > 0
+}
+
+// getSinks returns the sinks, keyed by name, for the given sink names
+func (m *actionSinksManager) getSinks(names []string) map[string]actionSink {
+	m.RLock()
+	defer m.RUnlock()
+
+	sinks := make(map[string]actionSink)
+	for _, name := range names {
+		if sink, ok := m.sinks[name]; ok {
+			sinks[name] = sink
+		}
+	}
+	return sinks
+}
+
+// publish publishes the given notification to all the matching sinks, the sinks
+// included in delivered are skipped. The lock is not held while publishing, so a
+// slow broker cannot block a reload. It returns the sinks, as delivered targets,
+// the notification was published to and the first error, if any
+func (m *actionSinksManager) publish(notification *ActionNotification, delivered []string) ([]string, error) {
+	names := m.getSinkNames(notification)
+	if len(names) == 0 {
+		return nil, nil
+	}
+	sinks := m.getSinks(names)
+
+	var published []string
+	var result error
+	for _, name := range names {
+		sink, ok := sinks[name]
+		if !ok || utils.IsStringInSlice(actionSinkTargetPrefix+name, delivered) {
+			continue
+		}
+		startTime := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), actionSinkTimeout)
+		err := sink.publish(ctx, notification)
+		cancel()
+
+		logger.Debug(notification.Protocol, "", "published operation %#v to sink %#v, elapsed: %v err: %v",
+			notification.Action, name, time.Since(startTime), err)
+		if err != nil {
+			if result == nil {
+				result = fmt.Errorf("unable to publish to sink %#v: %w", name, err)
+			}
+			continue
+		}
+		published = append(published, actionSinkTargetPrefix+name)
+	}
+	return published, result
+}
@@ -0,0 +1,15 @@
+//go:build !noamqp
+// +build !noamqp
+
+package common
+
+import (
+	// we import rabbitpubsub here to be able to disable AMQP support using a build tag
+	_ "gocloud.dev/pubsub/rabbitpubsub"
+
+	"github.com/drakkan/sftpgo/version"
+)
+
+func init() {
+	version.AddFeature("+amqp")
+}
@@ -0,0 +1,12 @@
+//go:build noamqp
+// +build noamqp
+
+package common
+
+import (
+	"github.com/drakkan/sftpgo/version"
+)
+
+func init() {
+	version.AddFeature("-amqp")
+}
@@ -0,0 +1,15 @@
+//go:build !noawspubsub
+// +build !noawspubsub
+
+package common
+
+import (
+	// we import awssnssqs here to be able to disable AWS SNS/SQS support using a build tag
+	_ "gocloud.dev/pubsub/awssnssqs"
+
+	"github.com/drakkan/sftpgo/version"
+)
+
+func init() {
+	version.AddFeature("+awspubsub")
+}
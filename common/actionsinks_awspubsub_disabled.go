@@ -0,0 +1,12 @@
+//go:build noawspubsub
+// +build noawspubsub
+
+package common
+
+import (
+	"github.com/drakkan/sftpgo/version"
+)
+
+func init() {
+	version.AddFeature("-awspubsub")
+}
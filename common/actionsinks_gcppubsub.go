@@ -0,0 +1,15 @@
+//go:build !nogcppubsub
+// +build !nogcppubsub
+
+package common
+
+import (
+	// we import gcppubsub here to be able to disable Google Cloud Pub/Sub support using a build tag
+	_ "gocloud.dev/pubsub/gcppubsub"
+
+	"github.com/drakkan/sftpgo/version"
+)
+
+func init() {
+	version.AddFeature("+gcppubsub")
+}
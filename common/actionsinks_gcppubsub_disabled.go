@@ -0,0 +1,12 @@
+//go:build nogcppubsub
+// +build nogcppubsub
+
+package common
+
+import (
+	"github.com/drakkan/sftpgo/version"
+)
+
+func init() {
+	version.AddFeature("-gcppubsub")
+}
@@ -0,0 +1,15 @@
+//go:build !nokafka
+// +build !nokafka
+
+package common
+
+import (
+	// we import kafkapubsub here to be able to disable Kafka support using a build tag
+	_ "gocloud.dev/pubsub/kafkapubsub"
+
+	"github.com/drakkan/sftpgo/version"
+)
+
+func init() {
+	version.AddFeature("+kafka")
+}
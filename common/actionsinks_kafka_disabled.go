@@ -0,0 +1,12 @@
+//go:build nokafka
+// +build nokafka
+
+package common
+
+import (
+	"github.com/drakkan/sftpgo/version"
+)
+
+func init() {
+	version.AddFeature("-kafka")
+}
@@ -0,0 +1,15 @@
+//go:build !nonats
+// +build !nonats
+
+package common
+
+import (
+	// we import natspubsub here to be able to disable NATS support using a build tag
+	_ "gocloud.dev/pubsub/natspubsub"
+
+	"github.com/drakkan/sftpgo/version"
+)
+
+func init() {
+	version.AddFeature("+nats")
+}
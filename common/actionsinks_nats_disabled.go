@@ -0,0 +1,12 @@
+//go:build nonats
+// +build nonats
+
+package common
+
+import (
+	"github.com/drakkan/sftpgo/version"
+)
+
+func init() {
+	version.AddFeature("-nats")
+}
@@ -0,0 +1,538 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub/pstest"
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gocloud.dev/pubsub"
+	"gocloud.dev/pubsub/gcppubsub"
+	"gocloud.dev/pubsub/mempubsub"
+	pb "google.golang.org/genproto/googleapis/pubsub/v1"
+	"google.golang.org/grpc"
+
+	"github.com/drakkan/sftpgo/dataprovider"
+)
+
+// standInOpener simulates a message broker using in memory topics
+type standInOpener struct {
+	sync.Mutex
+	topics map[string]*pubsub.Topic
+	err    error
+}
+
+func (o *standInOpener) OpenTopicURL(ctx context.Context, u *url.URL) (*pubsub.Topic, error) {
+	o.Lock()
+	defer o.Unlock()
+
+	if o.err != nil {
+		return nil, o.err
+	}
+	if o.topics == nil {
+		o.topics = make(map[string]*pubsub.Topic)
+	}
+	topic, ok := o.topics[u.String()]
+	if !ok {
+		topic = mempubsub.NewTopic()
+		o.topics[u.String()] = topic
+	}
+	return topic, nil
+}
+
+func (o *standInOpener) subscribe(rawURL string) *pubsub.Subscription {
+	u, _ := url.Parse(rawURL)
+	topic, _ := o.OpenTopicURL(context.Background(), u)
+	return mempubsub.NewSubscription(topic, time.Minute)
+}
+
+func setActionSinks(t *testing.T, actions ProtocolActions) {
+	actionsCopy := Config.Actions
+	t.Cleanup(func() {
+		Config.Actions = actionsCopy
+		actionSinks.reload(nil, nil)
+	})
+
+	Config.Actions = actions
+	require.NoError(t, validateActionSinks(actions.Sinks, actions.Routes))
+	actionSinks.reload(actions.Sinks, actions.Routes)
+}
+
+func receiveNotification(t *testing.T, subscription *pubsub.Subscription) (ActionNotification, map[string]string) {
+	var notification ActionNotification
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	msg, err := subscription.Receive(ctx)
+	require.NoError(t, err)
+	msg.Ack()
+	require.NoError(t, json.Unmarshal(msg.Body, &notification))
+	return notification, msg.Metadata
+}
+
+func assertNoNotification(t *testing.T, subscription *pubsub.Subscription) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	_, err := subscription.Receive(ctx)
+	assert.Error(t, err)
+}
+
+func TestActionSinksValidation(t *testing.T) {
+	sinks := []ActionSink{
+		{
+			Name: "amqp",
+			URL:  "rabbit://sftpgo",
+		},
+		{
+			Name: "nats",
+			URL:  "nats://sftpgo.uploads",
+		},
+		{
+			Name: "kafka",
+			URL:  "kafka://sftpgo",
+		},
+		{
+			Name: "gcp",
+			URL:  "gcppubsub://projects/myproject/topics/mytopic",
+		},
+		{
+			Name: "sns",
+			URL:  "awssns:///arn:aws:sns:us-east-2:123456789012:mytopic?region=us-east-2",
+		},
+	}
+	routes := []ActionRoute{
+		{
+			Actions:   []string{operationUpload},
+			Usernames: []string{"team_*"},
+			Paths:     []string{"/incoming/**", "/*.csv"},
+			Sinks:     []string{"amqp", "nats"},
+		},
+		{
+			Sinks: []string{"kafka", "gcp", "sns"},
+		},
+	}
+	assert.NoError(t, validateActionSinks(sinks, routes))
+	assert.NoError(t, validateActionSinks(nil, nil))
+
+	err := validateActionSinks([]ActionSink{{URL: "nats://subject"}}, nil)
+	assert.Error(t, err)
+	err = validateActionSinks(append(sinks, ActionSink{Name: "nats", URL: "nats://subject"}), nil)
+	assert.Error(t, err)
+	err = validateActionSinks([]ActionSink{{Name: "unknown", URL: "unknown://subject"}}, nil)
+	assert.Error(t, err)
+	err = validateActionSinks([]ActionSink{{Name: "invalid", URL: "nats://sub\x00ject"}}, nil)
+	assert.Error(t, err)
+	err = validateActionSinks(sinks, []ActionRoute{{}})
+	assert.Error(t, err)
+	err = validateActionSinks(sinks, []ActionRoute{{Sinks: []string{"missing"}}})
+	assert.Error(t, err)
+	err = validateActionSinks(sinks, []ActionRoute{{Actions: []string{operationPreDelete}, Sinks: []string{"nats"}}})
+	assert.Error(t, err)
+	err = validateActionSinks(sinks, []ActionRoute{{Usernames: []string{"[a-"}, Sinks: []string{"nats"}}})
+	assert.Error(t, err)
+	err = validateActionSinks(sinks, []ActionRoute{{Paths: []string{"/[a-/**"}, Sinks: []string{"nats"}}})
+	assert.Error(t, err)
+
+	c := Configuration{
+		Actions: ProtocolActions{
+			Sinks:  sinks,
+			Routes: []ActionRoute{{Sinks: []string{"missing"}}},
+		},
+	}
+	assert.Error(t, Initialize(c))
+	c.Actions.Routes = routes
+	assert.NoError(t, Initialize(c))
+	assert.Len(t, actionSinks.sinks, len(sinks))
+	require.NoError(t, Initialize(Configuration{}))
+	assert.Len(t, actionSinks.sinks, 0)
+}
+
+func TestActionRoutesMatch(t *testing.T) {
+	route := ActionRoute{}
+	notification := &ActionNotification{
+		Action:   operationUpload,
+		Username: "team_a",
+		Path:     "/incoming/sub/file.csv",
+	}
+	assert.True(t, route.matches(notification))
+	route.Actions = []string{operationDownload}
+	assert.False(t, route.matches(notification))
+	route.Actions = []string{operationDownload, operationUpload}
+	assert.True(t, route.matches(notification))
+	route.Usernames = []string{"team_b", "other_*"}
+	assert.False(t, route.matches(notification))
+	route.Usernames = []string{"team_?"}
+	assert.True(t, route.matches(notification))
+	route.Paths = []string{"/incoming/*.csv"}
+	assert.False(t, route.matches(notification))
+	route.Paths = []string{"/incoming/*/*.csv"}
+	assert.True(t, route.matches(notification))
+	route.Paths = []string{"/incoming/**"}
+	assert.True(t, route.matches(notification))
+	route.Paths = []string{"/incoming/sub/file.csv/**"}
+	assert.True(t, route.matches(notification))
+	route.Paths = []string{"/incom/**"}
+	assert.False(t, route.matches(notification))
+	route.Paths = []string{"/**"}
+	assert.True(t, route.matches(notification))
+}
+
+func TestActionSinksRouting(t *testing.T) {
+	opener := &standInOpener{}
+	mux := &pubsub.URLMux{}
+	mux.RegisterTopic("rabbit", opener)
+	mux.RegisterTopic("awssqs", opener)
+	muxCopy := actionSinksURLMux
+	actionSinksURLMux = mux
+	t.Cleanup(func() {
+		actionSinksURLMux = muxCopy
+	})
+
+	err := validateActionSinks([]ActionSink{{Name: "nats", URL: "nats://subject"}}, nil)
+	assert.Error(t, err, "nats must be unsupported with the custom mux")
+
+	setActionSinks(t, ProtocolActions{
+		ExecuteOn: []string{operationUpload, operationDownload, operationPreDelete},
+		Sinks: []ActionSink{
+			{
+				Name: "uploads",
+				URL:  "rabbit://uploads",
+			},
+			{
+				Name: "all",
+				URL:  "awssqs://sqs.us-east-2.amazonaws.com/123456789012/all",
+			},
+		},
+		Routes: []ActionRoute{
+			{
+				Actions:   []string{operationUpload},
+				Usernames: []string{"team_*"},
+				Paths:     []string{"/incoming/**"},
+				Sinks:     []string{"uploads", "all"},
+			},
+			{
+				Usernames: []string{"team_*"},
+				Sinks:     []string{"all"},
+			},
+		},
+	})
+	uploads := opener.subscribe("rabbit://uploads")
+	all := opener.subscribe("awssqs://sqs.us-east-2.amazonaws.com/123456789012/all")
+
+	user := &dataprovider.User{
+		Username: "team_a",
+	}
+	a := newActionNotification(user, operationUpload, "/incoming/sub/file", "", "", ProtocolSFTP, 123, nil)
+	assert.NoError(t, actionHandler.Handle(a))
+	n, metadata := receiveNotification(t, uploads)
+	assert.Equal(t, "/incoming/sub/file", n.Path)
+	assert.Equal(t, int64(123), n.FileSize)
+	assert.Equal(t, operationUpload, metadata["action"])
+	assert.Equal(t, user.Username, metadata["username"])
+	assert.Equal(t, ProtocolSFTP, metadata["protocol"])
+	n, _ = receiveNotification(t, all)
+	assert.Equal(t, "/incoming/sub/file", n.Path)
+	// the notification is published once even if multiple routes match
+	assertNoNotification(t, all)
+
+	a = newActionNotification(user, operationDownload, "/incoming/sub/file", "", "", ProtocolFTP, 123, nil)
+	assert.NoError(t, actionHandler.Handle(a))
+	n, _ = receiveNotification(t, all)
+	assert.Equal(t, operationDownload, n.Action)
+	assertNoNotification(t, uploads)
+	// pre-delete notifications are never routed
+	a = newActionNotification(user, operationPreDelete, "/incoming/sub/file", "", "", ProtocolFTP, 123, nil)
+	assert.EqualError(t, actionHandler.Handle(a), errNoHook.Error())
+	// no route matches and no hook is defined
+	a = newActionNotification(&dataprovider.User{Username: "other"}, operationUpload, "/incoming/file", "", "",
+		ProtocolSFTP, 123, nil)
+	assert.EqualError(t, actionHandler.Handle(a), errNoHook.Error())
+	assertNoNotification(t, uploads)
+	assertNoNotification(t, all)
+
+	// the sinks are used together with the hook
+	Config.Actions.Hook = fmt.Sprintf("http://%v", httpAddr)
+	a = newActionNotification(user, operationDownload, "/file", "", "", ProtocolWebDAV, 0, nil)
+	assert.NoError(t, actionHandler.Handle(a))
+	n, _ = receiveNotification(t, all)
+	assert.Equal(t, "/file", n.Path)
+
+	opener.Lock()
+	opener.err = errors.New("broker unavailable")
+	opener.Unlock()
+	require.NoError(t, actionSinks.sinks["all"].close())
+	a = newActionNotification(user, operationDownload, "/file", "", "", ProtocolWebDAV, 0, nil)
+	assert.Error(t, actionHandler.Handle(a))
+	// a broker outage does not deny the pre-actions, only the hook outcome is considered
+	Config.Actions.ExecuteOn = append(Config.Actions.ExecuteOn, operationPreUpload)
+	a = newActionNotification(user, operationPreUpload, "/file", "", "", ProtocolWebDAV, 0, nil)
+	assert.NoError(t, (&defaultActionHandler{}).deliver(a))
+	a = newActionNotification(user, operationDownload, "/file", "", "", ProtocolWebDAV, 0, nil)
+	Config.Actions.Hook = ""
+	assert.Error(t, actionHandler.Handle(a))
+}
+
+func TestActionSinksQueue(t *testing.T) {
+	opener := &standInOpener{}
+	mux := &pubsub.URLMux{}
+	mux.RegisterTopic("rabbit", opener)
+	muxCopy := actionSinksURLMux
+	actionSinksURLMux = mux
+	t.Cleanup(func() {
+		actionSinksURLMux = muxCopy
+	})
+
+	setActionSinks(t, ProtocolActions{
+		ExecuteOn: []string{operationUpload},
+		Queue: ActionsQueueConfig{
+			Enabled:          true,
+			Workers:          1,
+			MaxAttempts:      2,
+			RetryInterval:    60,
+			MaxRetryInterval: 60,
+		},
+		Sinks: []ActionSink{
+			{
+				Name: "uploads",
+				URL:  "rabbit://queued",
+			},
+		},
+		Routes: []ActionRoute{
+			{
+				Sinks: []string{"uploads"},
+			},
+		},
+	})
+	subscription := opener.subscribe("rabbit://queued")
+
+	user := &dataprovider.User{
+		Username: "sinks_queue_user",
+	}
+	a := newActionNotification(user, operationUpload, "/file", "", "", ProtocolSFTP, 123, nil)
+	assert.NoError(t, actionHandler.Handle(a))
+	assertNoNotification(t, subscription)
+	require.Len(t, getUserActionDeliveries(t, user.Username), 1)
+
+	q := &actionsQueue{config: Config.Actions.Queue}
+	assert.True(t, q.deliverNext())
+	n, _ := receiveNotification(t, subscription)
+	assert.Equal(t, user.Username, n.Username)
+	assert.Len(t, getUserActionDeliveries(t, user.Username), 0)
+}
+
+func TestActionSinksQueueRetryFailedTargets(t *testing.T) {
+	opener := &standInOpener{}
+	failingOpener := &standInOpener{err: errors.New("broker unavailable")}
+	mux := &pubsub.URLMux{}
+	mux.RegisterTopic("rabbit", opener)
+	mux.RegisterTopic("awssqs", failingOpener)
+	muxCopy := actionSinksURLMux
+	actionSinksURLMux = mux
+	t.Cleanup(func() {
+		actionSinksURLMux = muxCopy
+	})
+
+	setActionSinks(t, ProtocolActions{
+		ExecuteOn: []string{operationUpload},
+		Hook:      fmt.Sprintf("http://%v", httpAddr),
+		Queue: ActionsQueueConfig{
+			Enabled:          true,
+			Workers:          1,
+			MaxAttempts:      3,
+			RetryInterval:    60,
+			MaxRetryInterval: 60,
+		},
+		Sinks: []ActionSink{
+			{
+				Name: "uploads",
+				URL:  "rabbit://retry",
+			},
+			{
+				Name: "failing",
+				URL:  "awssqs://sqs.us-east-2.amazonaws.com/123456789012/retry",
+			},
+		},
+		Routes: []ActionRoute{
+			{
+				Sinks: []string{"uploads", "failing"},
+			},
+		},
+	})
+	uploads := opener.subscribe("rabbit://retry")
+
+	user := &dataprovider.User{
+		Username: "sinks_retry_user",
+	}
+	a := newActionNotification(user, operationUpload, "/file", "", "", ProtocolSFTP, 123, nil)
+	assert.NoError(t, actionHandler.Handle(a))
+	q := &actionsQueue{config: Config.Actions.Queue}
+	assert.True(t, q.deliverNext())
+	receiveNotification(t, uploads)
+	deliveries := getUserActionDeliveries(t, user.Username)
+	require.Len(t, deliveries, 1)
+	delivery := deliveries[0]
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Equal(t, []string{actionHookTarget, actionSinkTargetPrefix + "uploads"}, delivery.Delivered)
+	assert.Contains(t, delivery.LastError, "failing")
+
+	// only the failed sink is retried, the hook would now fail if called again
+	failingOpener.Lock()
+	failingOpener.err = nil
+	failingOpener.Unlock()
+	failing := failingOpener.subscribe("awssqs://sqs.us-east-2.amazonaws.com/123456789012/retry")
+	Config.Actions.Hook = fmt.Sprintf("http://%v/404", httpAddr)
+	delivery.NextAttempt = delivery.UpdatedAt
+	require.NoError(t, dataprovider.UpdateActionDelivery(&delivery))
+	assert.True(t, q.deliverNext())
+	n, _ := receiveNotification(t, failing)
+	assert.Equal(t, user.Username, n.Username)
+	assertNoNotification(t, uploads)
+	assert.Len(t, getUserActionDeliveries(t, user.Username), 0)
+}
+
+func TestActionSinksReloadDuringPublish(t *testing.T) {
+	sink := newActionSink(ActionSink{Name: "closed", URL: "rabbit://closed"})
+	require.NoError(t, sink.close())
+	// a sink closed by a reload is not reopened by an in flight publish
+	err := sink.publish(context.Background(), &ActionNotification{Action: operationUpload})
+	assert.Error(t, err)
+}
+
+func TestActionSinkGCPPubSub(t *testing.T) {
+	srv := pstest.NewServer()
+	defer srv.Close()
+
+	topicName := "projects/sftpgo/topics/uploads"
+	_, err := srv.GServer.CreateTopic(context.Background(), &pb.Topic{Name: topicName})
+	require.NoError(t, err)
+	conn, err := grpc.Dial(srv.Addr, grpc.WithInsecure())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	mux := &pubsub.URLMux{}
+	mux.RegisterTopic(gcppubsub.Scheme, &gcppubsub.URLOpener{Conn: conn})
+	muxCopy := actionSinksURLMux
+	actionSinksURLMux = mux
+	t.Cleanup(func() {
+		actionSinksURLMux = muxCopy
+	})
+
+	setActionSinks(t, ProtocolActions{
+		ExecuteOn: []string{operationUpload},
+		Sinks: []ActionSink{
+			{
+				Name: "gcp",
+				URL:  "gcppubsub://" + topicName,
+			},
+		},
+		Routes: []ActionRoute{
+			{
+				Sinks: []string{"gcp"},
+			},
+		},
+	})
+
+	user := &dataprovider.User{
+		Username: "gcp_user",
+	}
+	a := newActionNotification(user, operationUpload, "/file", "", "", ProtocolSFTP, 123, nil)
+	assert.NoError(t, actionHandler.Handle(a))
+	messages := srv.Messages()
+	require.Len(t, messages, 1)
+	var n ActionNotification
+	require.NoError(t, json.Unmarshal(messages[0].Data, &n))
+	assert.Equal(t, user.Username, n.Username)
+	assert.Equal(t, operationUpload, messages[0].Attributes["action"])
+}
+
+// TestActionSinkNATS requires a NATS server, it runs only if NATS_SERVER_URL is set
+func TestActionSinkNATS(t *testing.T) {
+	if os.Getenv("NATS_SERVER_URL") == "" {
+		t.Skip("this test requires a NATS server, set NATS_SERVER_URL to run it")
+	}
+
+	setActionSinks(t, ProtocolActions{
+		ExecuteOn: []string{operationUpload},
+		Sinks: []ActionSink{
+			{
+				Name: "nats",
+				URL:  "nats://sftpgo.uploads",
+			},
+		},
+		Routes: []ActionRoute{
+			{
+				Sinks: []string{"nats"},
+			},
+		},
+	})
+	subscription, err := pubsub.OpenSubscription(context.Background(), "nats://sftpgo.uploads")
+	require.NoError(t, err)
+	defer subscription.Shutdown(context.Background()) //nolint:errcheck
+
+	user := &dataprovider.User{
+		Username: "nats_user",
+	}
+	a := newActionNotification(user, operationUpload, "/file", "", "", ProtocolSFTP, 123, nil)
+	assert.NoError(t, actionHandler.Handle(a))
+	n, metadata := receiveNotification(t, subscription)
+	assert.Equal(t, user.Username, n.Username)
+	assert.Equal(t, operationUpload, metadata["action"])
+}
+
+func TestActionSinkKafka(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+
+	topic := "sftpgo_uploads"
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader(topic, 0, broker.BrokerID()),
+		"ProduceRequest": sarama.NewMockProduceResponse(t).
+			SetVersion(3).
+			SetError(topic, 0, sarama.ErrNoError),
+	})
+
+	os.Setenv("KAFKA_BROKERS", broker.Addr())
+	t.Cleanup(func() {
+		os.Unsetenv("KAFKA_BROKERS")
+	})
+
+	setActionSinks(t, ProtocolActions{
+		ExecuteOn: []string{operationUpload},
+		Sinks: []ActionSink{
+			{
+				Name: "kafka",
+				URL:  "kafka://" + topic,
+			},
+		},
+		Routes: []ActionRoute{
+			{
+				Sinks: []string{"kafka"},
+			},
+		},
+	})
+
+	user := &dataprovider.User{
+		Username: "kafka_user",
+	}
+	a := newActionNotification(user, operationUpload, "/file", "", "", ProtocolSFTP, 123, nil)
+	assert.NoError(t, actionHandler.Handle(a))
+	produced := false
+	for _, rr := range broker.History() {
+		if _, ok := rr.Request.(*sarama.ProduceRequest); ok {
+			produced = true
+		}
+	}
+	assert.True(t, produced)
+}
@@ -0,0 +1,248 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/drakkan/sftpgo/dataprovider"
+	"github.com/drakkan/sftpgo/logger"
+	"github.com/drakkan/sftpgo/utils"
+)
+
+const (
+	// a claimed notification is delivered again if the delivery outcome is not
+	// stored within this interval, it must exceed the max delivery time
+	actionsQueueLease = 5 * time.Minute
+)
+
+var (
+	actionsQueuePollInterval = 5 * time.Second
+	actionsQueueMutex        sync.Mutex
+	deliveryQueue            *actionsQueue
+)
+
+// ActionsQueueConfig defines the configuration for the durable delivery of the
+// action notifications. If enabled, the notifications are stored inside the data
+// provider and delivered by background workers, failed deliveries are retried
+type ActionsQueueConfig struct {
+	// Enabled stores the notifications inside the data provider before delivering them.
+	// Pre-delete notifications are always delivered synchronously
+	Enabled bool `json:"enabled" mapstructure:"enabled"`
+	// Workers defines the number of concurrent deliveries
+	Workers int `json:"workers" mapstructure:"workers"`
+	// MaxAttempts defines the max number of delivery attempts, after that the
+	// notification is marked as failed and it will be retried only on request
+	MaxAttempts int `json:"max_attempts" mapstructure:"max_attempts"`
+	// RetryInterval defines the delay, in seconds, before retrying a failed delivery.
+	// The delay is doubled after each attempt
+	RetryInterval int `json:"retry_interval" mapstructure:"retry_interval"`
+	// MaxRetryInterval defines the max delay, in seconds, between two attempts
+	MaxRetryInterval int `json:"max_retry_interval" mapstructure:"max_retry_interval"`
+}
+
+func (c *ActionsQueueConfig) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Workers < 1 {
+		return fmt.Errorf("invalid actions queue workers: %v", c.Workers)
+	}
+	if c.MaxAttempts < 1 {
+		return fmt.Errorf("invalid actions queue max attempts: %v", c.MaxAttempts)
+	}
+	if c.RetryInterval < 1 {
+		return fmt.Errorf("invalid actions queue retry interval: %v", c.RetryInterval)
+	}
+	if c.MaxRetryInterval < c.RetryInterval {
+		return fmt.Errorf("invalid actions queue max retry interval: %v, it cannot be lower than the retry interval",
+			c.MaxRetryInterval)
+	}
+	return nil
+}
+
+// getRetryDelay returns the delay before the next delivery attempt
+// after the specified number of failed attempts
+func (c *ActionsQueueConfig) getRetryDelay(attempts int) time.Duration {
+	delay := time.Duration(c.RetryInterval) * time.Second
+	maxDelay := time.Duration(c.MaxRetryInterval) * time.Second
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// StartActionsQueue starts the workers that deliver the queued action notifications,
+// if the actions queue is enabled. The data provider must be already initialized
+func StartActionsQueue() {
+	actionsQueueMutex.Lock()
+	defer actionsQueueMutex.Unlock()
+
+	stopActionsQueueInternal()
+	if !Config.Actions.Queue.Enabled {
+		return
+	}
+	deliveryQueue = &actionsQueue{
+		config: Config.Actions.Queue,
+		wakeup: make(chan struct{}, Config.Actions.Queue.Workers),
+		done:   make(chan bool),
+	}
+	deliveryQueue.start()
+	logger.Info(logSender, "", "actions queue started with config %+v", Config.Actions.Queue)
+}
+
+func stopActionsQueue() {
+	actionsQueueMutex.Lock()
+	defer actionsQueueMutex.Unlock()
+
+	stopActionsQueueInternal()
+}
+
+func stopActionsQueueInternal() {
+	if deliveryQueue != nil {
+		deliveryQueue.stop()
+		deliveryQueue = nil
+	}
+}
+
+// enqueueActionNotification stores the given notification inside the data provider
+// and wakes up an idle worker, if any
+func enqueueActionNotification(notification *ActionNotification) error {
+	data, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	delivery := dataprovider.ActionDelivery{
+		Action:       notification.Action,
+		Username:     notification.Username,
+		Notification: data,
+	}
+	if err := dataprovider.AddActionDelivery(&delivery); err != nil {
+		return err
+	}
+	logger.Debug(notification.Protocol, "", "notification for operation %#v queued, id: %v", notification.Action,
+		delivery.ID)
+
+	actionsQueueMutex.Lock()
+	defer actionsQueueMutex.Unlock()
+
+	if deliveryQueue != nil {
+		select {
+		case deliveryQueue.wakeup <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+type actionsQueue struct {
+	config ActionsQueueConfig
+	wakeup chan struct{}
+	done   chan bool
+	wg     sync.WaitGroup
+}
+
+func (q *actionsQueue) start() {
+	for i := 0; i < q.config.Workers; i++ {
+		q.wg.Add(1)
+		go q.worker()
+	}
+}
+
+// stop waits for the in progress deliveries
+func (q *actionsQueue) stop() {
+	close(q.done)
+	q.wg.Wait()
+}
+
+func (q *actionsQueue) isStopped() bool {
+	select {
+	case <-q.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (q *actionsQueue) worker() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(actionsQueuePollInterval)
+	defer ticker.Stop()
+
+	for {
+		for !q.isStopped() {
+			if !q.deliverNext() {
+				break
+			}
+		}
+		select {
+		case <-q.done:
+			return
+		case <-ticker.C:
+		case <-q.wakeup:
+		}
+	}
+}
+
+// deliverNext claims and delivers a due notification.
+// It returns false if there are no due notifications
+func (q *actionsQueue) deliverNext() bool {
+	deliveries, err := dataprovider.GetDueActionDeliveries(q.config.Workers)
+	if err != nil {
+		logger.Warn(logSender, "", "unable to get the queued action notifications: %v", err)
+		return false
+	}
+	leaseUntil := utils.GetTimeAsMsSinceEpoch(time.Now().Add(actionsQueueLease))
+	for idx := range deliveries {
+		delivery := &deliveries[idx]
+		claimed, err := dataprovider.ClaimActionDelivery(delivery, leaseUntil)
+		if err != nil {
+			logger.Warn(logSender, "", "unable to claim the queued action notification %v: %v", delivery.ID, err)
+			return false
+		}
+		if claimed {
+			q.deliver(delivery)
+			return true
+		}
+	}
+	return false
+}
+
+func (q *actionsQueue) deliver(delivery *dataprovider.ActionDelivery) {
+	var notification ActionNotification
+	err := json.Unmarshal(delivery.Notification, &notification)
+	if err == nil {
+		// the targets already delivered by the previous attempts are skipped
+		handler := &defaultActionHandler{}
+		var targets []string
+		targets, err = handler.deliverTo(&notification, delivery.Delivered)
+		delivery.Delivered = append(delivery.Delivered, targets...)
+	}
+	if err == nil {
+		if err := dataprovider.DeleteActionDelivery(delivery.ID); err != nil {
+			logger.Warn(logSender, "", "unable to remove the delivered action notification %v: %v", delivery.ID, err)
+		}
+		return
+	}
+	delivery.Attempts++
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= q.config.MaxAttempts {
+		delivery.Status = dataprovider.ActionDeliveryStatusFailed
+		logger.Warn(logSender, "", "unable to deliver the action notification %v for operation %#v, user %#v, "+
+			"attempts: %v, giving up: %v", delivery.ID, delivery.Action, delivery.Username, delivery.Attempts, err)
+	} else {
+		delay := q.config.getRetryDelay(delivery.Attempts)
+		delivery.NextAttempt = utils.GetTimeAsMsSinceEpoch(time.Now().Add(delay))
+		logger.Debug(logSender, "", "unable to deliver the action notification %v for operation %#v, user %#v, "+
+			"attempts: %v, next attempt in %v: %v", delivery.ID, delivery.Action, delivery.Username, delivery.Attempts,
+			delay, err)
+	}
+	if err := dataprovider.UpdateActionDelivery(delivery); err != nil {
+		logger.Warn(logSender, "", "unable to update the queued action notification %v: %v", delivery.ID, err)
+	}
+}
@@ -0,0 +1,154 @@
+package common
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drakkan/sftpgo/dataprovider"
+)
+
+func TestActionsQueueConfig(t *testing.T) {
+	c := ActionsQueueConfig{}
+	assert.NoError(t, c.validate())
+	c.Enabled = true
+	assert.Error(t, c.validate())
+	c.Workers = 1
+	assert.Error(t, c.validate())
+	c.MaxAttempts = 3
+	assert.Error(t, c.validate())
+	c.RetryInterval = 10
+	assert.Error(t, c.validate())
+	c.MaxRetryInterval = 60
+	assert.NoError(t, c.validate())
+
+	assert.Equal(t, 10*time.Second, c.getRetryDelay(1))
+	assert.Equal(t, 20*time.Second, c.getRetryDelay(2))
+	assert.Equal(t, 40*time.Second, c.getRetryDelay(3))
+	assert.Equal(t, 60*time.Second, c.getRetryDelay(4))
+	assert.Equal(t, 60*time.Second, c.getRetryDelay(100))
+
+	err := Initialize(Configuration{Actions: ProtocolActions{Queue: ActionsQueueConfig{Enabled: true}}})
+	assert.Error(t, err)
+	require.NoError(t, Initialize(Configuration{}))
+}
+
+func TestActionsQueueDelivery(t *testing.T) {
+	actionsCopy := Config.Actions
+	t.Cleanup(func() {
+		Config.Actions = actionsCopy
+	})
+
+	Config.Actions = ProtocolActions{
+		ExecuteOn: []string{operationUpload, operationPreDelete},
+		Hook:      fmt.Sprintf("http://%v/404", httpAddr),
+		Queue: ActionsQueueConfig{
+			Enabled:          true,
+			Workers:          1,
+			MaxAttempts:      2,
+			RetryInterval:    60,
+			MaxRetryInterval: 60,
+		},
+	}
+	user := &dataprovider.User{
+		Username: "queue_user",
+	}
+	// pre-delete notifications are not queued
+	a := newActionNotification(user, operationPreDelete, "path", "", "", ProtocolSFTP, 0, nil)
+	err := actionHandler.Handle(a)
+	assert.EqualError(t, err, errUnexpectedHTTResponse.Error())
+	assert.Len(t, getUserActionDeliveries(t, user.Username), 0)
+
+	a = newActionNotification(user, operationUpload, "path", "", "", ProtocolSFTP, 123, nil)
+	err = actionHandler.Handle(a)
+	assert.NoError(t, err)
+	deliveries := getUserActionDeliveries(t, user.Username)
+	require.Len(t, deliveries, 1)
+	id := deliveries[0].ID
+
+	q := &actionsQueue{config: Config.Actions.Queue}
+	assert.True(t, q.deliverNext())
+	delivery, err := dataprovider.GetActionDeliveryByID(id)
+	require.NoError(t, err)
+	assert.Equal(t, dataprovider.ActionDeliveryStatusPending, delivery.Status)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Equal(t, errUnexpectedHTTResponse.Error(), delivery.LastError)
+	assert.Greater(t, delivery.NextAttempt, delivery.UpdatedAt)
+	// the next attempt is not due yet
+	assert.False(t, q.deliverNext())
+
+	delivery.NextAttempt = delivery.UpdatedAt
+	require.NoError(t, dataprovider.UpdateActionDelivery(&delivery))
+	assert.True(t, q.deliverNext())
+	delivery, err = dataprovider.GetActionDeliveryByID(id)
+	require.NoError(t, err)
+	assert.Equal(t, dataprovider.ActionDeliveryStatusFailed, delivery.Status)
+	assert.Equal(t, 2, delivery.Attempts)
+	assert.False(t, q.deliverNext())
+
+	Config.Actions.Hook = fmt.Sprintf("http://%v", httpAddr)
+	require.NoError(t, dataprovider.RetryActionDelivery(id))
+	assert.True(t, q.deliverNext())
+	_, err = dataprovider.GetActionDeliveryByID(id)
+	assert.IsType(t, &dataprovider.RecordNotFoundError{}, err)
+}
+
+func TestActionsQueueWorkers(t *testing.T) {
+	actionsCopy := Config.Actions
+	pollInterval := actionsQueuePollInterval
+	t.Cleanup(func() {
+		stopActionsQueue()
+		Config.Actions = actionsCopy
+		actionsQueuePollInterval = pollInterval
+	})
+
+	actionsQueuePollInterval = 100 * time.Millisecond
+	Config.Actions = ProtocolActions{
+		ExecuteOn: []string{operationUpload},
+		Hook:      fmt.Sprintf("http://%v", httpAddr),
+		Queue: ActionsQueueConfig{
+			Enabled:          true,
+			Workers:          2,
+			MaxAttempts:      2,
+			RetryInterval:    60,
+			MaxRetryInterval: 60,
+		},
+	}
+	StartActionsQueue()
+
+	user := &dataprovider.User{
+		Username: "queue_workers_user",
+	}
+	for i := 0; i < 5; i++ {
+		a := newActionNotification(user, operationUpload, fmt.Sprintf("path%v", i), "", "", ProtocolSFTP, 123, nil)
+		assert.NoError(t, actionHandler.Handle(a))
+	}
+	assert.Eventually(t, func() bool {
+		return len(getUserActionDeliveries(t, user.Username)) == 0
+	}, 5*time.Second, 100*time.Millisecond)
+
+	stopActionsQueue()
+	// notifications are queued even if the workers are not running
+	a := newActionNotification(user, operationUpload, "path", "", "", ProtocolSFTP, 123, nil)
+	assert.NoError(t, actionHandler.Handle(a))
+	assert.Len(t, getUserActionDeliveries(t, user.Username), 1)
+	StartActionsQueue()
+	assert.Eventually(t, func() bool {
+		return len(getUserActionDeliveries(t, user.Username)) == 0
+	}, 5*time.Second, 100*time.Millisecond)
+}
+
+func getUserActionDeliveries(t *testing.T, username string) []dataprovider.ActionDelivery {
+	deliveries, err := dataprovider.GetActionDeliveries(0, 500, 0, dataprovider.OrderASC)
+	require.NoError(t, err)
+	var result []dataprovider.ActionDelivery
+	for _, delivery := range deliveries {
+		if delivery.Username == username {
+			result = append(result, delivery)
+		}
+	}
+	return result
+}
@@ -10,6 +10,7 @@ import (
 	"net/url"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -31,6 +32,7 @@ const (
 	uploadLogSender          = "Upload"
 	downloadLogSender        = "Download"
 	renameLogSender          = "Rename"
+	copyLogSender            = "Copy"
 	rmdirLogSender           = "Rmdir"
 	mkdirLogSender           = "Mkdir"
 	symlinkLogSender         = "Symlink"
@@ -43,8 +45,14 @@ const (
 	operationUpload          = "upload"
 	operationDelete          = "delete"
 	operationPreDelete       = "pre-delete"
+	operationPreUpload       = "pre-upload"
+	operationPreDownload     = "pre-download"
+	operationPreRename       = "pre-rename"
+	operationPreMkdir        = "pre-mkdir"
 	operationRename          = "rename"
+	operationCopy            = "copy"
 	operationSSHCmd          = "ssh_cmd"
+	operationInfected        = "infected"
 	chtimesFormat            = "2006-01-02T15:04:05" // YYYY-MM-DDTHH:MM:SS
 	idleTimeoutCheckInterval = 3 * time.Minute
 )
@@ -90,6 +98,7 @@ var (
 	ErrConnectionDenied     = errors.New("you are not allowed to connect")
 	ErrNoBinding            = errors.New("no binding configured")
 	ErrCrtRevoked           = errors.New("your certificate has been revoked")
+	ErrNotDirectory         = errors.New("not a directory")
 	errNoTransfer           = errors.New("requested transfer not found")
 	errTransferMismatch     = errors.New("transfer mismatch")
 )
@@ -111,9 +120,26 @@ func Initialize(c Configuration) error {
 	Config = c
 	Config.idleLoginTimeout = 2 * time.Minute
 	Config.idleTimeoutAsDuration = time.Duration(Config.IdleTimeout) * time.Minute
+	if Config.FolderPrefix != "" {
+		Config.FolderPrefix = path.Clean("/" + Config.FolderPrefix)
+	}
 	if Config.IdleTimeout > 0 {
 		startIdleTimeoutTicker(idleTimeoutCheckInterval)
 	}
+	if err := c.Actions.Queue.validate(); err != nil {
+		return err
+	}
+	if err := validateChecksumAlgo(c.Actions.Checksum); err != nil {
+		return err
+	}
+	if err := validateActionSinks(c.Actions.Sinks, c.Actions.Routes); err != nil {
+		return err
+	}
+	actionSinks.reload(c.Actions.Sinks, c.Actions.Routes)
+	if err := c.UploadScan.validate(); err != nil {
+		return err
+	}
+	fileScanner = c.UploadScan.getScanner()
 	Config.defender = nil
 	if c.DefenderConfig.Enabled {
 		defender, err := newInMemoryDefender(&c.DefenderConfig)
@@ -319,7 +345,12 @@ type Configuration struct {
 	// Maximum number of concurrent client connections. 0 means unlimited
 	MaxTotalConnections int `json:"max_total_connections" mapstructure:"max_total_connections"`
 	// Defender configuration
-	DefenderConfig        DefenderConfig `json:"defender" mapstructure:"defender"`
+	DefenderConfig DefenderConfig `json:"defender" mapstructure:"defender"`
+	// Default virtual root folder prefix to include in all file operations (ex: /files),
+	// used for the users without their own folder prefix. It applies to all the protocols
+	FolderPrefix string `json:"folder_prefix" mapstructure:"folder_prefix"`
+	// UploadScan defines the configuration to scan the uploaded files for viruses
+	UploadScan            UploadScanConfig `json:"upload_scan" mapstructure:"upload_scan"`
 	idleTimeoutAsDuration time.Duration
 	idleLoginTimeout      time.Duration
 	defender              Defender
@@ -330,6 +361,18 @@ func (c *Configuration) IsAtomicUploadEnabled() bool {
 	return c.UploadMode == UploadModeAtomic || c.UploadMode == UploadModeAtomicWithResume
 }
 
+// HasUploadChecks returns true if the uploads must be completed by SFTPGo to be
+// checked: they are scanned or the pre-upload action can deny them
+func (c *Configuration) HasUploadChecks() bool {
+	return c.UploadScan.IsEnabled() || utils.IsStringInSlice(operationPreUpload, c.Actions.ExecuteOn)
+}
+
+// HasDownloadChecks returns true if the downloads must be started by SFTPGo to be
+// checked: the pre-download action can deny them
+func (c *Configuration) HasDownloadChecks() bool {
+	return utils.IsStringInSlice(operationPreDownload, c.Actions.ExecuteOn)
+}
+
 // GetProxyListener returns a wrapper for the given listener that supports the
 // HAProxy Proxy Protocol or nil if the proxy protocol is not configured
 func (c *Configuration) GetProxyListener(listener net.Listener) (*proxyproto.Listener, error) {
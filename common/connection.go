@@ -8,6 +8,7 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/pkg/sftp"
@@ -34,6 +35,12 @@ type BaseConnection struct {
 	sync.RWMutex
 	transferID      uint64
 	activeTransfers []ActiveTransfer
+	// folder mappings, empty means no mapping
+	prefixMapping PrefixMapping
+	// current directory, it can be shared with the other connections of the session
+	workingDir *WorkingDir
+	// client address, if known
+	remoteAddr string
 }
 
 // NewBaseConnection returns a new BaseConnection
@@ -43,13 +50,15 @@ func NewBaseConnection(id, protocol string, user dataprovider.User, fs vfs.Fs) *
 		connID = fmt.Sprintf("%s_%s", protocol, id)
 	}
 	return &BaseConnection{
-		ID:           connID,
-		User:         user,
-		startTime:    time.Now(),
-		protocol:     protocol,
-		Fs:           fs,
-		lastActivity: time.Now().UnixNano(),
-		transferID:   0,
+		ID:            connID,
+		User:          user,
+		startTime:     time.Now(),
+		protocol:      protocol,
+		Fs:            fs,
+		lastActivity:  time.Now().UnixNano(),
+		transferID:    0,
+		prefixMapping: NewPrefixMapping(user.GetFolderMappings(Config.FolderPrefix)),
+		workingDir:    NewWorkingDir(&user),
 	}
 }
 
@@ -58,6 +67,65 @@ func (c *BaseConnection) Log(level logger.LogLevel, format string, v ...interfac
 	logger.Log(level, c.protocol, c.ID, format, v...)
 }
 
+// SetRemoteAddress sets the client address, it is included inside the action notifications.
+// It must be set before using the connection
+func (c *BaseConnection) SetRemoteAddress(remoteAddr string) {
+	c.remoteAddr = remoteAddr
+}
+
+func (c *BaseConnection) addActionNotificationDetails(notification *ActionNotification, virtualPath, virtualTarget string) {
+	notification.VirtualPath = virtualPath
+	notification.VirtualTargetPath = virtualTarget
+	notification.ConnectionID = c.ID
+	if c.remoteAddr != "" {
+		notification.IP = utils.GetIPFromRemoteAddress(c.remoteAddr)
+	}
+}
+
+// executePreAction executes the specified pre-action synchronously and returns a permission denied error,
+// for the connection protocol, if the hook denies the operation
+func (c *BaseConnection) executePreAction(operation, fsPath, virtualPath, fsTarget, virtualTarget string,
+	fileSize int64,
+) error {
+	notification := newActionNotification(&c.User, operation, fsPath, fsTarget, "", c.protocol, fileSize, nil)
+	c.addActionNotificationDetails(notification, virtualPath, virtualTarget)
+	err := actionHandler.Handle(notification)
+	if err == nil || err == errUnconfiguredAction || err == errNoHook {
+		return nil
+	}
+	c.Log(logger.LevelInfo, "%v for path %#v denied: %v", operation, virtualPath, err)
+	var deniedErr *ActionDeniedError
+	if errors.As(err, &deniedErr) {
+		return c.getActionDeniedError(deniedErr.Reason)
+	}
+	return c.getActionDeniedError("")
+}
+
+// ExecutePreTransferAction executes the pre-upload or pre-download action, based on the transfer type,
+// before opening the file. fileSize is the size of the existing file, 0 for new files and -1 if unknown.
+// A permission denied error is returned if the hook denies the transfer
+func (c *BaseConnection) ExecutePreTransferAction(transferType int, fsPath, virtualPath string, fileSize int64) error {
+	operation := operationPreUpload
+	if transferType == TransferDownload {
+		operation = operationPreDownload
+	}
+	if fileSize < 0 {
+		fileSize = 0
+		if utils.IsStringInSlice(operation, Config.Actions.ExecuteOn) {
+			if info, err := c.Fs.Stat(fsPath); err == nil {
+				fileSize = info.Size()
+			}
+		}
+	}
+	return c.executePreAction(operation, fsPath, virtualPath, "", "", fileSize)
+}
+
+// ExecutePreMkdirAction executes the pre-mkdir action before creating the specified directory.
+// A permission denied error is returned if the hook denies the operation
+func (c *BaseConnection) ExecutePreMkdirAction(fsPath, virtualPath string) error {
+	return c.executePreAction(operationPreMkdir, fsPath, virtualPath, "", "", 0)
+}
+
 // GetTransferID returns an unique transfer ID for this connection
 func (c *BaseConnection) GetTransferID() uint64 {
 	return atomic.AddUint64(&c.transferID, 1)
@@ -166,6 +234,21 @@ func (c *BaseConnection) GetTransfers() []ConnectionTransfer {
 	return transfers
 }
 
+// GetActiveTransfer returns the most recent active transfer of the given type for
+// the given virtual path or nil if there is no matching transfer
+func (c *BaseConnection) GetActiveTransfer(virtualPath string, transferType int) ActiveTransfer {
+	c.RLock()
+	defer c.RUnlock()
+
+	for i := len(c.activeTransfers) - 1; i >= 0; i-- {
+		t := c.activeTransfers[i]
+		if t.GetType() == transferType && t.GetVirtualPath() == virtualPath {
+			return t
+		}
+	}
+	return nil
+}
+
 // SignalTransfersAbort signals to the active transfers to exit as soon as possible
 func (c *BaseConnection) SignalTransfersAbort() error {
 	c.RLock()
@@ -207,9 +290,64 @@ func (c *BaseConnection) truncateOpenHandle(fsPath string, size int64) (int64, e
 	return 0, errNoTransfer
 }
 
+// IsReservedPath returns true if the specified virtual path is reserved for the upload
+// scan: the quarantine path and the files being scanned cannot be accessed by clients
+func (c *BaseConnection) IsReservedPath(virtualPath string) bool {
+	if Config.UploadScan.IsReservedPath(virtualPath) {
+		c.Log(logger.LevelDebug, "access to %#v is not allowed, the path is reserved for the upload scan", virtualPath)
+		return true
+	}
+	return false
+}
+
+// HasReservedPathsInside returns true if the specified virtual directory contains the quarantine path
+func (c *BaseConnection) HasReservedPathsInside(virtualPath string) bool {
+	if Config.UploadScan.hasReservedPathsInside(virtualPath) {
+		c.Log(logger.LevelDebug, "directory %#v contains the upload scan quarantine path", virtualPath)
+		return true
+	}
+	return false
+}
+
+// GetUploadPath returns the filesystem path to write an upload for fsPath to: the
+// temporary path for atomic uploads or, if the uploaded files must be scanned, the
+// path with the ".scanning" suffix, this way the file is hidden until the scan completes
+func (c *BaseConnection) GetUploadPath(fsPath string) string {
+	if Config.IsAtomicUploadEnabled() && c.Fs.IsAtomicUploadSupported() {
+		return c.Fs.GetAtomicUploadPath(fsPath)
+	}
+	if c.isHiddenUpload() {
+		return getScanningPath(fsPath)
+	}
+	return fsPath
+}
+
+// IsExistingFileMovedForUpload returns true if an existing file must be moved to
+// uploadPath before overwriting it. For hidden uploads on cloud filesystems the
+// existing file is not copied, it remains visible until it is replaced by the
+// uploaded one
+func (c *BaseConnection) IsExistingFileMovedForUpload(fsPath, uploadPath string) bool {
+	if fsPath == uploadPath {
+		return false
+	}
+	if Config.IsAtomicUploadEnabled() && c.Fs.IsAtomicUploadSupported() {
+		return true
+	}
+	return vfs.IsLocalOrSFTPFs(c.Fs)
+}
+
+// IsFileAllowed returns true if the specified virtual path is allowed by the user's
+// file filters and it is not reserved for the upload scan
+func (c *BaseConnection) IsFileAllowed(virtualPath string) bool {
+	if c.IsReservedPath(virtualPath) {
+		return false
+	}
+	return c.User.IsFileAllowed(virtualPath)
+}
+
 // ListDir reads the directory named by fsPath and returns a list of directory entries
 func (c *BaseConnection) ListDir(fsPath, virtualPath string) ([]os.FileInfo, error) {
-	if !c.User.HasPerm(dataprovider.PermListItems, virtualPath) {
+	if !c.User.HasPerm(dataprovider.PermListItems, virtualPath) || c.IsReservedPath(virtualPath) {
 		return nil, c.GetPermissionDeniedError()
 	}
 	files, err := c.Fs.ReadDir(fsPath)
@@ -217,6 +355,15 @@ func (c *BaseConnection) ListDir(fsPath, virtualPath string) ([]os.FileInfo, err
 		c.Log(logger.LevelWarn, "error listing directory: %+v", err)
 		return nil, c.GetFsError(err)
 	}
+	if Config.UploadScan.IsEnabled() {
+		visibleFiles := files[:0]
+		for _, fi := range files {
+			if !Config.UploadScan.IsReservedPath(path.Join(virtualPath, fi.Name())) {
+				visibleFiles = append(visibleFiles, fi)
+			}
+		}
+		files = visibleFiles
+	}
 	return c.User.AddVirtualDirs(files, virtualPath), nil
 }
 
@@ -229,6 +376,12 @@ func (c *BaseConnection) CreateDir(fsPath, virtualPath string) error {
 		c.Log(logger.LevelWarn, "mkdir not allowed %#v is a virtual folder", virtualPath)
 		return c.GetPermissionDeniedError()
 	}
+	if c.IsReservedPath(virtualPath) {
+		return c.GetPermissionDeniedError()
+	}
+	if err := c.ExecutePreMkdirAction(fsPath, virtualPath); err != nil {
+		return err
+	}
 	if err := c.Fs.Mkdir(fsPath); err != nil {
 		c.Log(logger.LevelWarn, "error creating dir: %#v error: %+v", fsPath, err)
 		return c.GetFsError(err)
@@ -244,7 +397,7 @@ func (c *BaseConnection) IsRemoveFileAllowed(fsPath, virtualPath string) error {
 	if !c.User.HasPerm(dataprovider.PermDelete, path.Dir(virtualPath)) {
 		return c.GetPermissionDeniedError()
 	}
-	if !c.User.IsFileAllowed(virtualPath) {
+	if !c.IsFileAllowed(virtualPath) {
 		c.Log(logger.LevelDebug, "removing file %#v is not allowed", fsPath)
 		return c.GetPermissionDeniedError()
 	}
@@ -258,6 +411,7 @@ func (c *BaseConnection) RemoveFile(fsPath, virtualPath string, info os.FileInfo
 	}
 	size := info.Size()
 	action := newActionNotification(&c.User, operationPreDelete, fsPath, "", "", c.protocol, size, nil)
+	c.addActionNotificationDetails(action, virtualPath, "")
 	actionErr := actionHandler.Handle(action)
 	if actionErr == nil {
 		c.Log(logger.LevelDebug, "remove for path %#v handled by pre-delete action", fsPath)
@@ -282,6 +436,7 @@ func (c *BaseConnection) RemoveFile(fsPath, virtualPath string, info os.FileInfo
 	}
 	if actionErr != nil {
 		action := newActionNotification(&c.User, operationDelete, fsPath, "", "", c.protocol, size, nil)
+		c.addActionNotificationDetails(action, virtualPath, "")
 		go actionHandler.Handle(action) // nolint:errcheck
 	}
 	return nil
@@ -305,6 +460,9 @@ func (c *BaseConnection) IsRemoveDirAllowed(fsPath, virtualPath string) error {
 		c.Log(logger.LevelWarn, "removing a directory mapped as virtual folder is not allowed: %#v", fsPath)
 		return c.GetPermissionDeniedError()
 	}
+	if c.IsReservedPath(virtualPath) || c.HasReservedPathsInside(virtualPath) {
+		return c.GetPermissionDeniedError()
+	}
 	if !c.User.HasPerm(dataprovider.PermDelete, path.Dir(virtualPath)) {
 		return c.GetPermissionDeniedError()
 	}
@@ -386,6 +544,14 @@ func (c *BaseConnection) Rename(fsSourcePath, fsTargetPath, virtualSourcePath, v
 			return c.GetFsError(err)
 		}
 	}
+	renameSize := int64(0)
+	if srcInfo.Mode().IsRegular() {
+		renameSize = srcInfo.Size()
+	}
+	if err := c.executePreAction(operationPreRename, fsSourcePath, virtualSourcePath, fsTargetPath, virtualTargetPath,
+		renameSize); err != nil {
+		return err
+	}
 	if !c.hasSpaceForRename(virtualSourcePath, virtualTargetPath, initialSize, fsSourcePath) {
 		c.Log(logger.LevelInfo, "denying cross rename due to space limit")
 		return c.GetGenericError(ErrQuotaExceeded)
@@ -400,12 +566,118 @@ func (c *BaseConnection) Rename(fsSourcePath, fsTargetPath, virtualSourcePath, v
 	logger.CommandLog(renameLogSender, fsSourcePath, fsTargetPath, c.User.Username, "", c.ID, c.protocol, -1, -1,
 		"", "", "", -1)
 	action := newActionNotification(&c.User, operationRename, fsSourcePath, fsTargetPath, "", c.protocol, 0, nil)
+	c.addActionNotificationDetails(action, virtualSourcePath, virtualTargetPath)
 	// the returned error is used in test cases only, we already log the error inside action.execute
 	go actionHandler.Handle(action) // nolint:errcheck
 
 	return nil
 }
 
+// Copy copies the file fsSourcePath to fsTargetPath using the server side copy of
+// the storage backend, if supported. Only regular files can be copied, an existing
+// target is replaced only if overwrite is true
+func (c *BaseConnection) Copy(fsSourcePath, fsTargetPath, virtualSourcePath, virtualTargetPath string, overwrite bool) error {
+	copier, ok := c.Fs.(vfs.Copier)
+	if !ok {
+		c.Log(logger.LevelDebug, "server side copy is not supported for %v", c.Fs.Name())
+		return c.GetOpUnsupportedError()
+	}
+	if c.User.IsMappedPath(fsTargetPath) {
+		c.Log(logger.LevelWarn, "copying to a directory mapped as virtual folder is not allowed: %#v", fsTargetPath)
+		return c.GetPermissionDeniedError()
+	}
+	if c.IsReservedPath(virtualSourcePath) || c.IsReservedPath(virtualTargetPath) ||
+		c.HasReservedPathsInside(virtualSourcePath) {
+		return c.GetPermissionDeniedError()
+	}
+	if !c.User.HasPerm(dataprovider.PermListItems, path.Dir(virtualSourcePath)) ||
+		!c.User.HasPerm(dataprovider.PermUpload, path.Dir(virtualTargetPath)) {
+		return c.GetPermissionDeniedError()
+	}
+	if !c.IsFileAllowed(virtualSourcePath) || !c.IsFileAllowed(virtualTargetPath) {
+		c.Log(logger.LevelDebug, "copying %#v -> %#v is not allowed by the file filters", virtualSourcePath,
+			virtualTargetPath)
+		return c.GetPermissionDeniedError()
+	}
+	srcInfo, err := c.DoStat(fsSourcePath, 1)
+	if err != nil {
+		return c.GetFsError(err)
+	}
+	if !srcInfo.Mode().IsRegular() {
+		c.Log(logger.LevelDebug, "copying %#v is not supported, only regular files can be copied", virtualSourcePath)
+		return c.GetOpUnsupportedError()
+	}
+	initialSize := int64(-1)
+	if dstInfo, err := c.DoStat(fsTargetPath, 1); err == nil {
+		if !overwrite || !dstInfo.Mode().IsRegular() {
+			c.Log(logger.LevelDebug, "copying %#v -> %#v is not allowed, the target exists, overwrite: %v",
+				virtualSourcePath, virtualTargetPath, overwrite)
+			return c.GetGenericError(os.ErrExist)
+		}
+		if !c.User.HasPerm(dataprovider.PermOverwrite, path.Dir(virtualTargetPath)) {
+			return c.GetPermissionDeniedError()
+		}
+		initialSize = dstInfo.Size()
+	} else if !c.Fs.IsNotExist(err) {
+		return c.GetFsError(err)
+	}
+	if err := c.checkCopyQuota(virtualTargetPath, srcInfo.Size(), initialSize); err != nil {
+		return c.GetGenericError(err)
+	}
+	if err := copier.CopyFile(fsSourcePath, fsTargetPath); err != nil {
+		c.Log(logger.LevelWarn, "failed to copy %#v -> %#v: %+v", fsSourcePath, fsTargetPath, err)
+		return c.GetFsError(err)
+	}
+	numFiles := 1
+	sizeDiff := srcInfo.Size()
+	if initialSize >= 0 {
+		numFiles = 0
+		sizeDiff -= initialSize
+	}
+	c.updateQuotaAfterCopy(virtualTargetPath, numFiles, sizeDiff)
+	logger.CommandLog(copyLogSender, fsSourcePath, fsTargetPath, c.User.Username, "", c.ID, c.protocol, -1, -1,
+		"", "", "", srcInfo.Size())
+	action := newActionNotification(&c.User, operationCopy, fsSourcePath, fsTargetPath, "", c.protocol,
+		srcInfo.Size(), nil)
+	c.addActionNotificationDetails(action, virtualSourcePath, virtualTargetPath)
+	go actionHandler.Handle(action) // nolint:errcheck
+
+	return nil
+}
+
+// checkCopyQuota checks the quota for copying a file of the given size to
+// virtualTargetPath, initialSize is the size of the replaced file or -1
+func (c *BaseConnection) checkCopyQuota(virtualTargetPath string, size, initialSize int64) error {
+	quotaResult := c.HasSpace(initialSize < 0, false, virtualTargetPath)
+	if !quotaResult.HasSpace {
+		return ErrQuotaExceeded
+	}
+	if initialSize < 0 {
+		initialSize = 0
+	}
+	maxWriteSize, _ := c.GetMaxWriteSize(quotaResult, false, initialSize)
+	if maxWriteSize > 0 && size > maxWriteSize {
+		c.Log(logger.LevelDebug, "copy not allowed, size %v exceeds the max write size %v", size, maxWriteSize)
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+func (c *BaseConnection) updateQuotaAfterCopy(virtualTargetPath string, numFiles int, sizeDiff int64) {
+	if dataprovider.GetQuotaTracking() == 0 {
+		return
+	}
+	vfolder, err := c.User.GetVirtualFolderForPath(path.Dir(virtualTargetPath))
+	if err == nil {
+		dataprovider.UpdateVirtualFolderQuota(&vfolder.BaseVirtualFolder, numFiles, sizeDiff, false) //nolint:errcheck
+		if vfolder.IsIncludedInUserQuota() {
+			dataprovider.UpdateUserQuota(&c.User, numFiles, sizeDiff, false) //nolint:errcheck
+		}
+	} else {
+		dataprovider.UpdateUserQuota(&c.User, numFiles, sizeDiff, false) //nolint:errcheck
+	}
+}
+
 // CreateSymlink creates fsTargetPath as a symbolic link to fsSourcePath
 func (c *BaseConnection) CreateSymlink(fsSourcePath, fsTargetPath, virtualSourcePath, virtualTargetPath string) error {
 	if c.Fs.GetRelativePath(fsSourcePath) == "/" {
@@ -416,6 +688,10 @@ func (c *BaseConnection) CreateSymlink(fsSourcePath, fsTargetPath, virtualSource
 		c.Log(logger.LevelWarn, "symlinking a virtual folder is not allowed")
 		return c.GetPermissionDeniedError()
 	}
+	if c.IsReservedPath(virtualSourcePath) || c.IsReservedPath(virtualTargetPath) ||
+		c.HasReservedPathsInside(virtualSourcePath) {
+		return c.GetPermissionDeniedError()
+	}
 	if !c.User.HasPerm(dataprovider.PermCreateSymlinks, path.Dir(virtualTargetPath)) {
 		return c.GetPermissionDeniedError()
 	}
@@ -468,7 +744,7 @@ func (c *BaseConnection) ignoreSetStat() bool {
 	if Config.SetstatMode == 1 {
 		return true
 	}
-	if Config.SetstatMode == 2 && !vfs.IsLocalOrSFTPFs(c.Fs) {
+	if Config.SetstatMode == 2 && !vfs.IsLocalOrSFTPFs(c.Fs) && !vfs.StoresFSMetaAttributes(c.Fs) {
 		return true
 	}
 	return false
@@ -528,6 +804,9 @@ func (c *BaseConnection) handleChtimes(fsPath, pathForPerms string, attributes *
 
 // SetStat set StatAttributes for the specified fsPath
 func (c *BaseConnection) SetStat(fsPath, virtualPath string, attributes *StatAttributes) error {
+	if c.IsReservedPath(virtualPath) {
+		return c.GetPermissionDeniedError()
+	}
 	pathForPerms := c.getPathForSetStatPerms(fsPath, virtualPath)
 
 	if attributes.Flags&StatAttrPerms != 0 {
@@ -637,6 +916,10 @@ func (c *BaseConnection) isRenamePermitted(fsSourcePath, virtualSourcePath, virt
 		c.Log(logger.LevelWarn, "renaming a virtual folder is not allowed")
 		return false
 	}
+	if c.IsReservedPath(virtualSourcePath) || c.IsReservedPath(virtualTargetPath) ||
+		c.HasReservedPathsInside(virtualSourcePath) {
+		return false
+	}
 	if !c.User.IsFileAllowed(virtualSourcePath) || !c.User.IsFileAllowed(virtualTargetPath) {
 		if fi != nil && fi.Mode().IsRegular() {
 			c.Log(logger.LevelDebug, "renaming file is not allowed, source: %#v target: %#v",
@@ -955,6 +1238,26 @@ func (c *BaseConnection) GetPermissionDeniedError() error {
 	}
 }
 
+// getActionDeniedError returns an appropriate permission denied error for an operation denied by a hook.
+// The reason is sent to the client only for the protocols allowing a custom error message
+func (c *BaseConnection) getActionDeniedError(reason string) error {
+	if reason == "" {
+		return c.GetPermissionDeniedError()
+	}
+	switch c.protocol {
+	case ProtocolSFTP:
+		// pkg/sftp sends the error text as status message and maps EACCES
+		// path errors to the permission denied status code
+		return &os.PathError{Op: "operation denied by hook:", Path: reason, Err: syscall.EACCES}
+	case ProtocolFTP:
+		return fmt.Errorf("%w: %v", os.ErrPermission, reason)
+	case ProtocolSCP, ProtocolSSH:
+		return fmt.Errorf("%w: %v", ErrPermissionDenied, reason)
+	default:
+		return c.GetPermissionDeniedError()
+	}
+}
+
 // GetNotExistError returns an appropriate not exist error for the connection protocol
 func (c *BaseConnection) GetNotExistError() error {
 	switch c.protocol {
@@ -987,7 +1290,7 @@ func (c *BaseConnection) GetGenericError(err error) error {
 		return sftp.ErrSSHFxFailure
 	default:
 		if err == ErrPermissionDenied || err == ErrNotExist || err == ErrOpUnsupported ||
-			err == ErrQuotaExceeded || err == vfs.ErrStorageSizeUnavailable {
+			err == ErrQuotaExceeded || err == ErrNotDirectory || err == vfs.ErrStorageSizeUnavailable {
 			return err
 		}
 		return ErrGenericFailure
@@ -15,6 +15,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/drakkan/sftpgo/dataprovider"
+	"github.com/drakkan/sftpgo/fsmeta"
 	"github.com/drakkan/sftpgo/kms"
 	"github.com/drakkan/sftpgo/vfs"
 )
@@ -362,6 +363,61 @@ func TestRename(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestCopy(t *testing.T) {
+	homeDir := t.TempDir()
+	user := dataprovider.User{
+		Username: userTestUsername,
+		HomeDir:  homeDir,
+	}
+	user.Permissions = make(map[string][]string)
+	user.Permissions["/"] = []string{dataprovider.PermAny}
+	user.Permissions["/ro"] = []string{dataprovider.PermListItems, dataprovider.PermDownload}
+	user.Permissions["/noover"] = []string{dataprovider.PermListItems, dataprovider.PermUpload}
+	user.Filters.FilePatterns = []dataprovider.PatternsFilter{
+		{
+			Path:           "/",
+			DeniedPatterns: []string{"*.denied"},
+		},
+	}
+	for _, dir := range []string{"ro", "noover", "dir"} {
+		require.NoError(t, os.Mkdir(filepath.Join(homeDir, dir), os.ModePerm))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(homeDir, "file"), []byte("data"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(homeDir, "noover", "file"), []byte("old"), os.ModePerm))
+	fs := vfs.NewOsFs("", homeDir, nil)
+	c := NewBaseConnection("", ProtocolSFTP, user, fs)
+
+	err := c.Copy(filepath.Join(homeDir, "file"), filepath.Join(homeDir, "copy"), "/file", "/copy", false)
+	assert.NoError(t, err)
+	content, err := os.ReadFile(filepath.Join(homeDir, "copy"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("data"), content)
+	// the target exists
+	err = c.Copy(filepath.Join(homeDir, "file"), filepath.Join(homeDir, "copy"), "/file", "/copy", false)
+	assert.ErrorIs(t, err, sftp.ErrSSHFxFailure)
+	err = c.Copy(filepath.Join(homeDir, "file"), filepath.Join(homeDir, "dir"), "/file", "/dir", true)
+	assert.ErrorIs(t, err, sftp.ErrSSHFxFailure)
+	err = c.Copy(filepath.Join(homeDir, "file"), filepath.Join(homeDir, "copy"), "/file", "/copy", true)
+	assert.NoError(t, err)
+	// only regular files can be copied
+	err = c.Copy(filepath.Join(homeDir, "dir"), filepath.Join(homeDir, "dircopy"), "/dir", "/dircopy", false)
+	assert.ErrorIs(t, err, sftp.ErrSSHFxOpUnsupported)
+	err = c.Copy(filepath.Join(homeDir, "missing"), filepath.Join(homeDir, "copy1"), "/missing", "/copy1", false)
+	assert.ErrorIs(t, err, sftp.ErrSSHFxNoSuchFile)
+	// permissions and file patterns
+	err = c.Copy(filepath.Join(homeDir, "file"), filepath.Join(homeDir, "ro", "file"), "/file", "/ro/file", false)
+	assert.ErrorIs(t, err, sftp.ErrSSHFxPermissionDenied)
+	err = c.Copy(filepath.Join(homeDir, "file"), filepath.Join(homeDir, "noover", "file"), "/file", "/noover/file", true)
+	assert.ErrorIs(t, err, sftp.ErrSSHFxPermissionDenied)
+	err = c.Copy(filepath.Join(homeDir, "file"), filepath.Join(homeDir, "file.denied"), "/file", "/file.denied", false)
+	assert.ErrorIs(t, err, sftp.ErrSSHFxPermissionDenied)
+	assert.NoFileExists(t, filepath.Join(homeDir, "file.denied"))
+	// server side copy not supported
+	c = NewBaseConnection("", ProtocolSFTP, user, newMockOsFs(false, "", homeDir))
+	err = c.Copy(filepath.Join(homeDir, "file"), filepath.Join(homeDir, "copy3"), "/file", "/copy3", false)
+	assert.ErrorIs(t, err, sftp.ErrSSHFxOpUnsupported)
+}
+
 func TestCreateSymlink(t *testing.T) {
 	user := dataprovider.User{
 		Username: userTestUsername,
@@ -536,6 +592,18 @@ func TestSetStat(t *testing.T) {
 	assert.False(t, c.ignoreSetStat())
 	c1 := NewBaseConnection("", ProtocolSFTP, user, newMockOsFs(false, fs.ConnectionID(), user.GetHomeDir()))
 	assert.True(t, c1.ignoreSetStat())
+	s3Fs, err := vfs.NewS3Fs(fs.ConnectionID(), os.TempDir(), vfs.S3FsConfig{Bucket: "bucket", Region: "us-east-1"})
+	assert.NoError(t, err)
+	c2 := NewBaseConnection("", ProtocolSFTP, user, s3Fs)
+	assert.True(t, c2.ignoreSetStat())
+	// the attributes are persisted using fsmeta
+	fsmetaEnabled := fsmeta.Enabled
+	defer func() {
+		fsmeta.Enabled = fsmetaEnabled
+	}()
+	fsmeta.Enabled = true
+	assert.False(t, c2.ignoreSetStat())
+	fsmeta.Enabled = fsmetaEnabled
 
 	Config.SetstatMode = oldSetStatMode
 	// chmod
@@ -0,0 +1,246 @@
+package common
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/drakkan/sftpgo/dataprovider"
+	"github.com/drakkan/sftpgo/logger"
+	"github.com/drakkan/sftpgo/utils"
+	"github.com/drakkan/sftpgo/vfs"
+)
+
+// PrefixMatch defines how a client path relates to a virtual root folder prefix
+type PrefixMatch uint8
+
+// Supported prefix matches
+const (
+	// the path is the prefix or one of its children
+	PathContainsPrefix PrefixMatch = iota
+	// the path is one of the prefix parents, only stat and list are allowed
+	PathIsPrefixParent
+	// the path is outside the prefix hierarchy
+	PathDiverged
+)
+
+// GetPrefixHierarchy returns how the given path relates to the given prefix
+func GetPrefixHierarchy(prefix, virtualPath string) PrefixMatch {
+	prefixSplit := strings.Split(path.Clean(`/`+prefix), `/`)
+	pathSplit := strings.Split(path.Clean(`/`+virtualPath), `/`)
+
+	for {
+		// stop if either slice is empty of the current head elements do not match
+		if len(prefixSplit) == 0 || len(pathSplit) == 0 ||
+			prefixSplit[0] != pathSplit[0] {
+			break
+		}
+		prefixSplit = prefixSplit[1:]
+		pathSplit = pathSplit[1:]
+	}
+
+	// The entire Prefix is included in Test Path
+	// Example: Prefix (/files) with Test Path (/files/test.csv)
+	if len(prefixSplit) == 0 ||
+		(len(prefixSplit) == 1 && prefixSplit[0] == ``) {
+		return PathContainsPrefix
+	}
+
+	// Test Path is part of the Prefix Hierarchy
+	// Example: Prefix (/files) with Test Path (/)
+	if len(pathSplit) == 0 ||
+		(len(pathSplit) == 1 && pathSplit[0] == ``) {
+		return PathIsPrefixParent
+	}
+
+	// Test Path is not with the Prefix Hierarchy
+	// Example: Prefix (/files) with Test Path (/files2)
+	return PathDiverged
+}
+
+// RemoveFolderPrefix returns the virtualPath relative to the prefix and true if
+// virtualPath is inside the prefix hierarchy
+func RemoveFolderPrefix(prefix, virtualPath string) (string, bool) {
+	if prefix == `/` || prefix == `` {
+		return virtualPath, true
+	}
+
+	virtualPath = path.Clean(`/` + virtualPath)
+	if ContainsPrefix(prefix, virtualPath) {
+		effectivePath := virtualPath[len(prefix):]
+		if effectivePath == `` {
+			effectivePath = `/`
+		}
+		return effectivePath, true
+	}
+	return virtualPath, false
+}
+
+// ContainsPrefix returns true if virtualPath is the prefix or one of its children
+func ContainsPrefix(prefix, virtualPath string) bool {
+	if !path.IsAbs(virtualPath) {
+		virtualPath = path.Clean(`/` + virtualPath)
+	}
+
+	if prefix == `/` || prefix == `` {
+		return true
+	} else if prefix == virtualPath {
+		return true
+	}
+
+	return strings.HasPrefix(virtualPath, prefix+`/`)
+}
+
+// NextPrefixFolder returns the name of the only child visible listing the given
+// prefix parent
+func NextPrefixFolder(prefix, parentPath string) string {
+	cleanPath := path.Clean(`/` + parentPath)
+	cleanPrefix := path.Clean(`/` + prefix)
+
+	name := strings.TrimLeft(cleanPrefix[len(cleanPath):], `/`)
+	if idx := strings.Index(name, `/`); idx > 0 {
+		return name[0:idx]
+	}
+	return name
+}
+
+// PrefixMapping is a table of folder mappings sorted by prefix. Each prefix is
+// seen by the client as a mount point for the mapped directory, an empty table
+// means no mapping
+type PrefixMapping []dataprovider.FolderMapping
+
+// NewPrefixMapping returns a sorted table for the given folder mappings
+func NewPrefixMapping(mappings []dataprovider.FolderMapping) PrefixMapping {
+	if len(mappings) == 0 {
+		return nil
+	}
+	m := make(PrefixMapping, 0, len(mappings))
+	for _, mapping := range mappings {
+		m = append(m, dataprovider.FolderMapping{
+			Prefix:     path.Clean("/" + mapping.Prefix),
+			MappedPath: path.Clean("/" + mapping.MappedPath),
+		})
+	}
+	sort.Slice(m, func(i, j int) bool {
+		return m[i].Prefix < m[j].Prefix
+	})
+	return m
+}
+
+// Resolve returns the virtual path for the given client path, the index of the
+// mapping containing it and how the client path relates to the mappings.
+// The index is -1 if no mapping contains the client path
+func (m PrefixMapping) Resolve(clientPath string) (string, int, PrefixMatch) {
+	if len(m) == 0 {
+		return clientPath, 0, PathContainsPrefix
+	}
+	cleanPath := path.Clean("/" + clientPath)
+	result := PathDiverged
+	for idx, mapping := range m {
+		switch GetPrefixHierarchy(mapping.Prefix, cleanPath) {
+		case PathContainsPrefix:
+			relPath, _ := RemoveFolderPrefix(mapping.Prefix, cleanPath)
+			return path.Join(mapping.MappedPath, relPath), idx, PathContainsPrefix
+		case PathIsPrefixParent:
+			result = PathIsPrefixParent
+		}
+	}
+	return cleanPath, -1, result
+}
+
+// ListParent returns the sorted names of the directories visible inside the given
+// prefix parent, merging the next directory of each mapping below it
+func (m PrefixMapping) ListParent(parentPath string) []string {
+	var names []string
+	for _, mapping := range m {
+		if GetPrefixHierarchy(mapping.Prefix, parentPath) != PathIsPrefixParent {
+			continue
+		}
+		name := NextPrefixFolder(mapping.Prefix, parentPath)
+		if !utils.IsStringInSlice(name, names) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ClientPath returns the client path for the given virtual path using the mapping
+// with the longest mapped path containing it
+func (m PrefixMapping) ClientPath(virtualPath string) string {
+	clientPath := virtualPath
+	longest := -1
+	for _, mapping := range m {
+		if len(mapping.MappedPath) <= longest || !ContainsPrefix(mapping.MappedPath, virtualPath) {
+			continue
+		}
+		relPath, _ := RemoveFolderPrefix(mapping.MappedPath, virtualPath)
+		clientPath = path.Join(mapping.Prefix, relPath)
+		longest = len(mapping.MappedPath)
+	}
+	return clientPath
+}
+
+// GetPrefixMapping returns the folder mappings for this connection
+func (c *BaseConnection) GetPrefixMapping() PrefixMapping {
+	return c.prefixMapping
+}
+
+// ResolvePrefixPath returns the given client path mapped to the virtual path, if
+// any mapping is defined, and how the client path relates to the mappings
+func (c *BaseConnection) ResolvePrefixPath(clientPath string) (string, PrefixMatch) {
+	virtualPath, _, match := c.prefixMapping.Resolve(clientPath)
+	return virtualPath, match
+}
+
+// RemoveFolderPrefix returns the virtual path for the given client path.
+// A permission denied error is returned for the paths outside the mappings,
+// including the prefix parents
+func (c *BaseConnection) RemoveFolderPrefix(clientPath string) (string, error) {
+	virtualPath, match := c.ResolvePrefixPath(clientPath)
+	if match != PathContainsPrefix {
+		c.Log(logger.LevelInfo, "path %#v is outside the folder mappings", clientPath)
+		return virtualPath, c.GetPermissionDeniedError()
+	}
+	return virtualPath, nil
+}
+
+// RemoveFolderPrefixes returns the virtual paths for the given rename source and
+// target. Renaming between different mappings is not supported
+func (c *BaseConnection) RemoveFolderPrefixes(clientSource, clientTarget string) (string, string, error) {
+	virtualSource, sourceIdx, sourceMatch := c.prefixMapping.Resolve(clientSource)
+	virtualTarget, targetIdx, targetMatch := c.prefixMapping.Resolve(clientTarget)
+	if sourceMatch != PathContainsPrefix || targetMatch != PathContainsPrefix {
+		c.Log(logger.LevelInfo, "rename %#v -> %#v is outside the folder mappings", clientSource, clientTarget)
+		return virtualSource, virtualTarget, c.GetPermissionDeniedError()
+	}
+	if sourceIdx != targetIdx {
+		c.Log(logger.LevelInfo, "rename %#v -> %#v between different folder mappings is not supported",
+			clientSource, clientTarget)
+		return virtualSource, virtualTarget, c.GetOpUnsupportedError()
+	}
+	return virtualSource, virtualTarget, nil
+}
+
+// GetClientPath returns the path seen by the client for the given virtual path
+func (c *BaseConnection) GetClientPath(virtualPath string) string {
+	return c.prefixMapping.ClientPath(virtualPath)
+}
+
+// StatPrefixParent returns a synthetic directory for the given prefix parent
+func (c *BaseConnection) StatPrefixParent(clientPath string) os.FileInfo {
+	return vfs.NewFileInfo(clientPath, true, 0, time.Now(), false)
+}
+
+// ListPrefixParent returns the contents of the given prefix parent: the next
+// directory in the hierarchy of each mapping below it
+func (c *BaseConnection) ListPrefixParent(clientPath string) []os.FileInfo {
+	now := time.Now()
+	var result []os.FileInfo
+	for _, name := range c.prefixMapping.ListParent(clientPath) {
+		result = append(result, vfs.NewFileInfo(name, true, 0, now, false))
+	}
+	return result
+}
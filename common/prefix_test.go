@@ -0,0 +1,160 @@
+package common
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drakkan/sftpgo/dataprovider"
+)
+
+func TestGetPrefixHierarchy(t *testing.T) {
+	assert.Equal(t, PathContainsPrefix, GetPrefixHierarchy("/files", "/files"))
+	assert.Equal(t, PathContainsPrefix, GetPrefixHierarchy("/files", "files/data.csv"))
+	assert.Equal(t, PathContainsPrefix, GetPrefixHierarchy("", "/data"))
+	assert.Equal(t, PathIsPrefixParent, GetPrefixHierarchy("/files/data", "/"))
+	assert.Equal(t, PathIsPrefixParent, GetPrefixHierarchy("/files/data", "/files/"))
+	assert.Equal(t, PathDiverged, GetPrefixHierarchy("/files", "/files2"))
+	assert.Equal(t, PathDiverged, GetPrefixHierarchy("/files/data", "/files/other"))
+
+	assert.Equal(t, "files", NextPrefixFolder("/files/data", "/"))
+	assert.Equal(t, "data", NextPrefixFolder("/files/data", "files/"))
+
+	assert.True(t, ContainsPrefix("/", "/data"))
+	assert.True(t, ContainsPrefix("/files", "files"))
+	assert.False(t, ContainsPrefix("/files", "/files2"))
+
+	virtualPath, ok := RemoveFolderPrefix("/", "/files")
+	assert.Equal(t, "/files", virtualPath)
+	assert.True(t, ok)
+	virtualPath, ok = RemoveFolderPrefix("/files", "files")
+	assert.Equal(t, "/", virtualPath)
+	assert.True(t, ok)
+	virtualPath, ok = RemoveFolderPrefix("/files", "/random")
+	assert.Equal(t, "/random", virtualPath)
+	assert.False(t, ok)
+}
+
+func TestPrefixMapping(t *testing.T) {
+	assert.Nil(t, NewPrefixMapping(nil))
+	var empty PrefixMapping
+	virtualPath, idx, match := empty.Resolve("/data")
+	assert.Equal(t, "/data", virtualPath)
+	assert.Equal(t, 0, idx)
+	assert.Equal(t, PathContainsPrefix, match)
+	assert.Equal(t, "/data", empty.ClientPath("/data"))
+
+	m := NewPrefixMapping([]dataprovider.FolderMapping{
+		{Prefix: "/outbound", MappedPath: "/out"},
+		{Prefix: "/inbound/", MappedPath: "in"},
+		{Prefix: "/archive/2020", MappedPath: "/"},
+	})
+	if assert.Len(t, m, 3) {
+		assert.Equal(t, "/archive/2020", m[0].Prefix)
+		assert.Equal(t, "/inbound", m[1].Prefix)
+		assert.Equal(t, "/in", m[1].MappedPath)
+	}
+	virtualPath, idx, match = m.Resolve("inbound/a.csv")
+	assert.Equal(t, "/in/a.csv", virtualPath)
+	assert.Equal(t, 1, idx)
+	assert.Equal(t, PathContainsPrefix, match)
+	virtualPath, idx, match = m.Resolve("/archive/2020")
+	assert.Equal(t, "/", virtualPath)
+	assert.Equal(t, 0, idx)
+	assert.Equal(t, PathContainsPrefix, match)
+	virtualPath, idx, match = m.Resolve("/archive/")
+	assert.Equal(t, "/archive", virtualPath)
+	assert.Equal(t, -1, idx)
+	assert.Equal(t, PathIsPrefixParent, match)
+	_, idx, match = m.Resolve("/archive/2021")
+	assert.Equal(t, -1, idx)
+	assert.Equal(t, PathDiverged, match)
+
+	assert.Equal(t, []string{"archive", "inbound", "outbound"}, m.ListParent("/"))
+	assert.Equal(t, []string{"2020"}, m.ListParent("/archive"))
+	assert.Empty(t, m.ListParent("/inbound"))
+	// the mapping with the longest mapped path is used
+	assert.Equal(t, "/outbound/a.csv", m.ClientPath("/out/a.csv"))
+	assert.Equal(t, "/inbound", m.ClientPath("/in"))
+	assert.Equal(t, "/archive/2020/other", m.ClientPath("/other"))
+}
+
+func TestConnectionFolderPrefix(t *testing.T) {
+	user := dataprovider.User{
+		Username: userTestUsername,
+		HomeDir:  os.TempDir(),
+	}
+	c := NewBaseConnection("", ProtocolFTP, user, nil)
+	assert.Empty(t, c.GetPrefixMapping())
+	virtualPath, match := c.ResolvePrefixPath("/data")
+	assert.Equal(t, "/data", virtualPath)
+	assert.Equal(t, PathContainsPrefix, match)
+	assert.Equal(t, "/data", c.GetClientPath("/data"))
+
+	oldPrefix := Config.FolderPrefix
+	Config.FolderPrefix = "/files"
+	c = NewBaseConnection("", ProtocolWebDAV, user, nil)
+	assert.Equal(t, PrefixMapping{{Prefix: "/files", MappedPath: "/"}}, c.GetPrefixMapping())
+	user.Filters.FolderPrefix = "/inbound/acme"
+	c = NewBaseConnection("", ProtocolWebDAV, user, nil)
+	Config.FolderPrefix = oldPrefix
+	assert.Equal(t, PrefixMapping{{Prefix: "/inbound/acme", MappedPath: "/"}}, c.GetPrefixMapping())
+
+	virtualPath, match = c.ResolvePrefixPath("/inbound/acme/data")
+	assert.Equal(t, "/data", virtualPath)
+	assert.Equal(t, PathContainsPrefix, match)
+	virtualPath, err := c.RemoveFolderPrefix("inbound/acme")
+	assert.NoError(t, err)
+	assert.Equal(t, "/", virtualPath)
+	assert.Equal(t, "/inbound/acme/data", c.GetClientPath("/data"))
+
+	virtualPath, match = c.ResolvePrefixPath("inbound/")
+	assert.Equal(t, "/inbound", virtualPath)
+	assert.Equal(t, PathIsPrefixParent, match)
+	_, err = c.RemoveFolderPrefix("/inbound")
+	assert.ErrorIs(t, err, os.ErrPermission)
+	info := c.StatPrefixParent("/inbound")
+	assert.Equal(t, "inbound", info.Name())
+	assert.True(t, info.IsDir())
+	infos := c.ListPrefixParent("/inbound")
+	if assert.Len(t, infos, 1) {
+		assert.Equal(t, "acme", infos[0].Name())
+		assert.True(t, infos[0].IsDir())
+	}
+
+	_, match = c.ResolvePrefixPath("/outbound")
+	assert.Equal(t, PathDiverged, match)
+	_, err = c.RemoveFolderPrefix("/outbound")
+	assert.ErrorIs(t, err, os.ErrPermission)
+}
+
+func TestConnectionFolderMappings(t *testing.T) {
+	user := dataprovider.User{
+		Username: userTestUsername,
+		HomeDir:  os.TempDir(),
+		Filters: dataprovider.UserFilters{
+			FolderPrefix: "/ignored",
+			FolderMappings: []dataprovider.FolderMapping{
+				{Prefix: "/inbound", MappedPath: "/in"},
+				{Prefix: "/outbound", MappedPath: "/out"},
+			},
+		},
+	}
+	c := NewBaseConnection("", ProtocolFTP, user, nil)
+	assert.Len(t, c.GetPrefixMapping(), 2)
+	infos := c.ListPrefixParent("/")
+	if assert.Len(t, infos, 2) {
+		assert.Equal(t, "inbound", infos[0].Name())
+		assert.Equal(t, "outbound", infos[1].Name())
+	}
+	source, target, err := c.RemoveFolderPrefixes("/inbound/a", "/inbound/b")
+	assert.NoError(t, err)
+	assert.Equal(t, "/in/a", source)
+	assert.Equal(t, "/in/b", target)
+	_, _, err = c.RemoveFolderPrefixes("/inbound/a", "/outbound/a")
+	assert.ErrorIs(t, err, ErrOpUnsupported)
+	_, _, err = c.RemoveFolderPrefixes("/inbound/a", "/a")
+	assert.ErrorIs(t, err, os.ErrPermission)
+	assert.Equal(t, "/outbound/file", c.GetClientPath("/out/file"))
+}
@@ -1,25 +1,59 @@
 package common
 
 import (
+	"crypto/md5"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"hash"
 	"path"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	ftpserver "github.com/fclairamb/ftpserverlib"
+	"github.com/minio/sha256-simd"
 
 	"github.com/drakkan/sftpgo/dataprovider"
 	"github.com/drakkan/sftpgo/logger"
 	"github.com/drakkan/sftpgo/metrics"
+	"github.com/drakkan/sftpgo/utils"
 	"github.com/drakkan/sftpgo/vfs"
 )
 
+const (
+	checksumMD5    = "md5"
+	checksumSHA256 = "sha256"
+	// max size for the data written ahead of the checksum offset, SFTP clients can
+	// send concurrent write requests and so the data could be received out of order
+	maxChecksumPendingSize = 4 * 1024 * 1024
+)
+
 var (
 	// ErrTransferClosed defines the error returned for a closed transfer
 	ErrTransferClosed = errors.New("transfer already closed")
 )
 
+func validateChecksumAlgo(algo string) error {
+	switch algo {
+	case "", checksumMD5, checksumSHA256:
+		return nil
+	default:
+		return fmt.Errorf("invalid checksum algorithm: %#v", algo)
+	}
+}
+
+func newChecksumHasher(algo string) hash.Hash {
+	switch algo {
+	case checksumMD5:
+		return md5.New()
+	case checksumSHA256:
+		return sha256.New()
+	default:
+		return nil
+	}
+}
+
 // BaseTransfer contains protocols common transfer details for an upload or a download.
 type BaseTransfer struct { //nolint:maligned
 	ID             uint64
@@ -36,11 +70,17 @@ type BaseTransfer struct { //nolint:maligned
 	MinWriteOffset int64
 	InitialSize    int64
 	isNewFile      bool
+	hiddenUpload   bool
 	transferType   int
 	AbortTransfer  int32
 	sync.Mutex
 	ErrTransfer      error
 	ftpClientContext ftpserver.ClientContext
+	// streaming checksum for uploads, nil if disabled or discarded
+	hasher          hash.Hash
+	hashOffset      int64
+	hashPending     map[int64][]byte
+	hashPendingSize int64
 }
 
 // NewBaseTransfer returns a new BaseTransfer and adds it to the given connection
@@ -64,6 +104,13 @@ func NewBaseTransfer(file vfs.File, conn *BaseConnection, cancelFn func(), fsPat
 		AbortTransfer:  0,
 		Fs:             fs,
 	}
+	if transferType == TransferUpload {
+		t.hiddenUpload = conn.isHiddenUpload()
+	}
+	// the checksum cannot be computed for resumed uploads
+	if transferType == TransferUpload && minWriteOffset == 0 {
+		t.hasher = newChecksumHasher(Config.Actions.Checksum)
+	}
 
 	conn.AddTransfer(t)
 	return t
@@ -130,6 +177,66 @@ func (t *BaseTransfer) GetLastDataChannel() ftpserver.DataChannel {
 	return ftpserver.DataChannel(0)
 }
 
+// UpdateChecksum adds the data written at the specified offset to the upload checksum.
+// Data written ahead of the current checksum offset are kept in memory, up to a limit,
+// until the missing data are received. The checksum is discarded if the data are not
+// written sequentially and cannot be reordered
+func (t *BaseTransfer) UpdateChecksum(p []byte, off int64) {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.hasher == nil || len(p) == 0 {
+		return
+	}
+	if off > t.hashOffset {
+		_, ok := t.hashPending[off]
+		if ok || t.hashPendingSize+int64(len(p)) > maxChecksumPendingSize {
+			t.discardChecksum(off)
+			return
+		}
+		if t.hashPending == nil {
+			t.hashPending = make(map[int64][]byte)
+		}
+		t.hashPending[off] = append([]byte(nil), p...)
+		t.hashPendingSize += int64(len(p))
+		return
+	}
+	if off != t.hashOffset {
+		t.discardChecksum(off)
+		return
+	}
+	t.hasher.Write(p) //nolint:errcheck
+	t.hashOffset += int64(len(p))
+	for {
+		data, ok := t.hashPending[t.hashOffset]
+		if !ok {
+			break
+		}
+		delete(t.hashPending, t.hashOffset)
+		t.hashPendingSize -= int64(len(data))
+		t.hasher.Write(data) //nolint:errcheck
+		t.hashOffset += int64(len(data))
+	}
+}
+
+func (t *BaseTransfer) discardChecksum(off int64) {
+	t.Connection.Log(logger.LevelDebug, "non sequential write for file %#v, offset %v expected %v, checksum discarded",
+		t.fsPath, off, t.hashOffset)
+	t.hasher = nil
+	t.hashPending = nil
+	t.hashPendingSize = 0
+}
+
+func (t *BaseTransfer) getChecksum() string {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.hasher == nil || len(t.hashPending) > 0 || t.ErrTransfer != nil {
+		return ""
+	}
+	return hex.EncodeToString(t.hasher.Sum(nil))
+}
+
 // SetCancelFn sets the cancel function for the transfer
 func (t *BaseTransfer) SetCancelFn(cancelFn func()) {
 	t.cancelFn = cancelFn
@@ -149,6 +256,18 @@ func (t *BaseTransfer) Truncate(fsPath string, size int64) (int64, error) {
 			if err == nil {
 				t.Lock()
 				t.InitialSize = size
+				if t.hasher != nil {
+					if size == 0 {
+						t.hasher.Reset()
+						t.hashOffset = 0
+						t.hashPending = nil
+						t.hashPendingSize = 0
+					} else {
+						t.hasher = nil
+						t.hashPending = nil
+						t.hashPendingSize = 0
+					}
+				}
 				if t.MaxWriteSize > 0 {
 					sizeDiff := initialSize - size
 					t.MaxWriteSize += sizeDiff
@@ -188,9 +307,9 @@ func (t *BaseTransfer) TransferError(err error) {
 		atomic.LoadInt64(&t.BytesReceived), elapsed)
 }
 
-func (t *BaseTransfer) getUploadFileSize() (int64, error) {
+func (t *BaseTransfer) getUploadFileSize(fsPath string) (int64, error) {
 	var fileSize int64
-	info, err := t.Fs.Stat(t.fsPath)
+	info, err := t.Fs.Stat(fsPath)
 	if err == nil {
 		fileSize = info.Size()
 	}
@@ -207,7 +326,10 @@ func (t *BaseTransfer) getUploadFileSize() (int64, error) {
 // It logs the transfer info, updates the user quota (for uploads)
 // and executes any defined action.
 // If there is an error no action will be executed and, in atomic mode,
-// we try to delete the temporary file
+// we try to delete the temporary file.
+// If the upload scan is enabled the uploaded file is scanned before executing
+// the upload action, the file has the ".scanning" suffix until the scan completes.
+// Partial uploads that cannot be scanned are deleted as in atomic mode
 func (t *BaseTransfer) Close() error {
 	defer t.Connection.RemoveTransfer(t)
 
@@ -216,6 +338,11 @@ func (t *BaseTransfer) Close() error {
 	if t.isNewFile {
 		numFiles = 1
 	}
+	uploadPath := t.fsPath
+	scanRequired := t.isUploadScanRequired()
+	if scanRequired || t.hiddenUpload {
+		uploadPath = getScanningPath(t.fsPath)
+	}
 	metrics.TransferCompleted(atomic.LoadInt64(&t.BytesSent), atomic.LoadInt64(&t.BytesReceived), t.transferType, t.ErrTransfer)
 	if t.ErrTransfer == ErrQuotaExceeded && t.File != nil {
 		// if quota is exceeded we try to remove the partial file for uploads to local filesystem
@@ -227,11 +354,14 @@ func (t *BaseTransfer) Close() error {
 		}
 		t.Connection.Log(logger.LevelWarn, "upload denied due to space limit, delete temporary file: %#v, deletion error: %v",
 			t.File.Name(), err)
-	} else if t.transferType == TransferUpload && t.File != nil && t.File.Name() != t.fsPath {
+	} else if t.transferType == TransferUpload && t.File != nil && t.File.Name() != t.fsPath && !t.hiddenUpload {
 		if t.ErrTransfer == nil || Config.UploadMode == UploadModeAtomicWithResume {
-			err = t.Connection.Fs.Rename(t.File.Name(), t.fsPath)
+			err = t.Connection.Fs.Rename(t.File.Name(), uploadPath)
 			t.Connection.Log(logger.LevelDebug, "atomic upload completed, rename: %#v -> %#v, error: %v",
-				t.File.Name(), t.fsPath, err)
+				t.File.Name(), uploadPath, err)
+			if err != nil {
+				scanRequired = false
+			}
 		} else {
 			err = t.Connection.Fs.Remove(t.File.Name(), false)
 			t.Connection.Log(logger.LevelWarn, "atomic upload completed with error: \"%v\", delete temporary file: %#v, "+
@@ -242,17 +372,28 @@ func (t *BaseTransfer) Close() error {
 				t.MinWriteOffset = 0
 			}
 		}
+	} else if t.hiddenUpload && t.ErrTransfer != nil && t.File != nil {
+		err = t.Connection.Fs.Remove(t.File.Name(), false)
+		t.Connection.Log(logger.LevelWarn, "upload to scan completed with error: \"%v\", delete hidden file: %#v, "+
+			"deletion error: %v", t.ErrTransfer, t.File.Name(), err)
+		if err == nil {
+			numFiles--
+			atomic.StoreInt64(&t.BytesReceived, 0)
+			t.MinWriteOffset = 0
+		}
 	}
-	elapsed := time.Since(t.start).Nanoseconds() / 1000000
+	endTime := time.Now()
+	elapsed := endTime.Sub(t.start).Nanoseconds() / 1000000
 	if t.transferType == TransferDownload {
 		logger.TransferLog(downloadLogSender, t.fsPath, elapsed, atomic.LoadInt64(&t.BytesSent), t.Connection.User.Username,
 			t.Connection.ID, t.Connection.protocol, t.GetLastDataChannel())
 		action := newActionNotification(&t.Connection.User, operationDownload, t.fsPath, "", "", t.Connection.protocol,
 			atomic.LoadInt64(&t.BytesSent), t.ErrTransfer)
+		t.addActionNotificationDetails(action, endTime)
 		go actionHandler.Handle(action) //nolint:errcheck
 	} else {
 		fileSize := atomic.LoadInt64(&t.BytesReceived) + t.MinWriteOffset
-		if statSize, err := t.getUploadFileSize(); err == nil {
+		if statSize, err := t.getUploadFileSize(uploadPath); err == nil {
 			fileSize = statSize
 		}
 		t.Connection.Log(logger.LevelDebug, "uploaded file size %v", fileSize)
@@ -261,7 +402,18 @@ func (t *BaseTransfer) Close() error {
 			t.Connection.ID, t.Connection.protocol, t.GetLastDataChannel())
 		action := newActionNotification(&t.Connection.User, operationUpload, t.fsPath, "", "", t.Connection.protocol,
 			fileSize, t.ErrTransfer)
-		go actionHandler.Handle(action) //nolint:errcheck
+		t.addActionNotificationDetails(action, endTime)
+		if checksum := t.getChecksum(); checksum != "" {
+			action.Checksum = checksum
+			action.ChecksumAlgo = Config.Actions.Checksum
+		}
+		if scanRequired {
+			if errScan := t.scanUpload(uploadPath, fileSize, action); errScan != nil && err == nil {
+				err = errScan
+			}
+		} else {
+			go actionHandler.Handle(action) //nolint:errcheck
+		}
 	}
 	if t.ErrTransfer != nil {
 		t.Connection.Log(logger.LevelWarn, "transfer error: %v, path: %#v", t.ErrTransfer, t.fsPath)
@@ -272,9 +424,17 @@ func (t *BaseTransfer) Close() error {
 	return err
 }
 
+func (t *BaseTransfer) addActionNotificationDetails(notification *ActionNotification, endTime time.Time) {
+	t.Connection.addActionNotificationDetails(notification, t.requestPath, "")
+	notification.StartTime = utils.GetTimeAsMsSinceEpoch(t.start)
+	notification.EndTime = utils.GetTimeAsMsSinceEpoch(endTime)
+	notification.Elapsed = endTime.Sub(t.start).Nanoseconds() / 1000000
+}
+
 func (t *BaseTransfer) updateQuota(numFiles int, fileSize int64) bool {
-	// S3 uploads are atomic, if there is an error nothing is uploaded
-	if t.File == nil && t.ErrTransfer != nil {
+	// S3 uploads are atomic, if there is an error nothing is uploaded unless
+	// the upload can be resumed, the completed parts are accounted in this case
+	if t.File == nil && t.ErrTransfer != nil && !t.isResumableCloudUpload() {
 		return false
 	}
 	sizeDiff := fileSize - t.InitialSize
@@ -294,6 +454,13 @@ func (t *BaseTransfer) updateQuota(numFiles int, fileSize int64) bool {
 	return false
 }
 
+func (t *BaseTransfer) isResumableCloudUpload() bool {
+	if _, ok := t.Fs.(vfs.ResumableUploader); ok {
+		return t.Fs.IsUploadResumeSupported()
+	}
+	return false
+}
+
 // HandleThrottle manage bandwidth throttling
 func (t *BaseTransfer) HandleThrottle() {
 	var wantedBandwidth int64
@@ -1,6 +1,9 @@
 package common
 
 import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"io/ioutil"
 	"os"
@@ -265,12 +268,186 @@ func TestRemovePartialCryptoFile(t *testing.T) {
 	conn := NewBaseConnection(fs.ConnectionID(), ProtocolSFTP, u, fs)
 	transfer := NewBaseTransfer(nil, conn, nil, testFile, "/transfer_test_file", TransferUpload, 0, 0, 0, true, fs)
 	transfer.ErrTransfer = errors.New("test error")
-	_, err = transfer.getUploadFileSize()
+	_, err = transfer.getUploadFileSize(transfer.fsPath)
 	assert.Error(t, err)
 	err = ioutil.WriteFile(testFile, []byte("test data"), os.ModePerm)
 	assert.NoError(t, err)
-	size, err := transfer.getUploadFileSize()
+	size, err := transfer.getUploadFileSize(transfer.fsPath)
 	assert.NoError(t, err)
 	assert.Equal(t, int64(9), size)
 	assert.NoFileExists(t, testFile)
 }
+
+type notificationsCollector struct {
+	notifications chan *ActionNotification
+}
+
+func (c *notificationsCollector) Handle(notification *ActionNotification) error {
+	c.notifications <- notification
+
+	return nil
+}
+
+func (c *notificationsCollector) get(t *testing.T) *ActionNotification {
+	select {
+	case notification := <-c.notifications:
+		return notification
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "notification not received")
+	}
+	return nil
+}
+
+func TestTransferChecksum(t *testing.T) {
+	actionsCopy := Config.Actions
+	collector := &notificationsCollector{
+		notifications: make(chan *ActionNotification, 1),
+	}
+	InitializeActionHandler(collector)
+	t.Cleanup(func() {
+		Config.Actions = actionsCopy
+		InitializeActionHandler(&defaultActionHandler{})
+	})
+
+	assert.Error(t, validateChecksumAlgo("sha1"))
+	assert.NoError(t, validateChecksumAlgo(""))
+	assert.Error(t, Initialize(Configuration{Actions: ProtocolActions{Checksum: "sha1"}}))
+	require.NoError(t, Initialize(Configuration{}))
+
+	Config.Actions.Checksum = checksumSHA256
+	testFile := filepath.Join(os.TempDir(), "checksum_test_file")
+	fs := vfs.NewOsFs("id", os.TempDir(), nil)
+	u := dataprovider.User{
+		Username: "test",
+		HomeDir:  os.TempDir(),
+	}
+	conn := NewBaseConnection("id", ProtocolSFTP, u, fs)
+	conn.SetRemoteAddress("127.0.0.1:1234")
+	data := []byte("test data")
+
+	file, err := os.Create(testFile)
+	require.NoError(t, err)
+	transfer := NewBaseTransfer(file, conn, nil, testFile, "/checksum_test_file", TransferUpload, 0, 0, 0, true, fs)
+	transfer.UpdateChecksum(data[:4], 0)
+	transfer.UpdateChecksum(data[4:], 4)
+	_, err = file.Write(data)
+	assert.NoError(t, err)
+	transfer.BytesReceived = int64(len(data))
+	assert.NoError(t, file.Close())
+	assert.NoError(t, transfer.Close())
+	notification := collector.get(t)
+	sha256Sum := sha256.Sum256(data)
+	assert.Equal(t, hex.EncodeToString(sha256Sum[:]), notification.Checksum)
+	assert.Equal(t, checksumSHA256, notification.ChecksumAlgo)
+	assert.Equal(t, "/checksum_test_file", notification.VirtualPath)
+	assert.Equal(t, testFile, notification.Path)
+	assert.Equal(t, "127.0.0.1", notification.IP)
+	assert.Equal(t, conn.GetID(), notification.ConnectionID)
+	assert.Equal(t, int64(len(data)), notification.FileSize)
+	assert.Greater(t, notification.StartTime, int64(0))
+	assert.GreaterOrEqual(t, notification.EndTime, notification.StartTime)
+	assert.InDelta(t, notification.EndTime-notification.StartTime, notification.Elapsed, 1)
+	// data received out of order are reordered
+	file, err = os.Create(testFile)
+	require.NoError(t, err)
+	transfer = NewBaseTransfer(file, conn, nil, testFile, "/checksum_test_file", TransferUpload, 0, 0, 0, true, fs)
+	transfer.UpdateChecksum(data[6:], 6)
+	transfer.UpdateChecksum(data[2:6], 2)
+	transfer.UpdateChecksum(data[:2], 0)
+	assert.Len(t, transfer.hashPending, 0)
+	assert.Equal(t, int64(0), transfer.hashPendingSize)
+	assert.NoError(t, file.Close())
+	assert.NoError(t, transfer.Close())
+	notification = collector.get(t)
+	assert.Equal(t, hex.EncodeToString(sha256Sum[:]), notification.Checksum)
+	// rewrites discard the checksum
+	file, err = os.Create(testFile)
+	require.NoError(t, err)
+	transfer = NewBaseTransfer(file, conn, nil, testFile, "/checksum_test_file", TransferUpload, 0, 0, 0, true, fs)
+	transfer.UpdateChecksum(data, 0)
+	transfer.UpdateChecksum(data[:4], 0)
+	assert.Nil(t, transfer.hasher)
+	assert.NoError(t, file.Close())
+	assert.NoError(t, transfer.Close())
+	notification = collector.get(t)
+	assert.Empty(t, notification.Checksum)
+	assert.Empty(t, notification.ChecksumAlgo)
+	// missing data discard the checksum
+	file, err = os.Create(testFile)
+	require.NoError(t, err)
+	transfer = NewBaseTransfer(file, conn, nil, testFile, "/checksum_test_file", TransferUpload, 0, 0, 0, true, fs)
+	transfer.UpdateChecksum(data[4:], 4)
+	transfer.UpdateChecksum(data[4:], 4)
+	assert.Nil(t, transfer.hasher)
+	transfer.UpdateChecksum(data[:4], 0)
+	assert.NoError(t, file.Close())
+	assert.NoError(t, transfer.Close())
+	notification = collector.get(t)
+	assert.Empty(t, notification.Checksum)
+	// a hole in the written data
+	file, err = os.Create(testFile)
+	require.NoError(t, err)
+	transfer = NewBaseTransfer(file, conn, nil, testFile, "/checksum_test_file", TransferUpload, 0, 0, 0, true, fs)
+	transfer.UpdateChecksum(data[4:], 4)
+	assert.NoError(t, file.Close())
+	assert.NoError(t, transfer.Close())
+	notification = collector.get(t)
+	assert.Empty(t, notification.Checksum)
+	// too much data out of order
+	file, err = os.Create(testFile)
+	require.NoError(t, err)
+	transfer = NewBaseTransfer(file, conn, nil, testFile, "/checksum_test_file", TransferUpload, 0, 0, 0, true, fs)
+	transfer.UpdateChecksum(make([]byte, maxChecksumPendingSize+1), 1)
+	assert.Nil(t, transfer.hasher)
+	assert.NoError(t, file.Close())
+	assert.NoError(t, transfer.Close())
+	notification = collector.get(t)
+	assert.Empty(t, notification.Checksum)
+	// truncating to zero resets the checksum
+	Config.Actions.Checksum = checksumMD5
+	file, err = os.Create(testFile)
+	require.NoError(t, err)
+	transfer = NewBaseTransfer(file, conn, nil, testFile, "/checksum_test_file", TransferUpload, 0, 0, 0, true, fs)
+	transfer.UpdateChecksum([]byte("abc"), 0)
+	_, err = transfer.Truncate(testFile, 0)
+	assert.NoError(t, err)
+	transfer.UpdateChecksum(data, 0)
+	assert.NoError(t, file.Close())
+	assert.NoError(t, transfer.Close())
+	notification = collector.get(t)
+	md5Sum := md5.Sum(data)
+	assert.Equal(t, hex.EncodeToString(md5Sum[:]), notification.Checksum)
+	assert.Equal(t, checksumMD5, notification.ChecksumAlgo)
+	// the checksum is not computed for resumed uploads
+	file, err = os.OpenFile(testFile, os.O_WRONLY, os.ModePerm)
+	require.NoError(t, err)
+	transfer = NewBaseTransfer(file, conn, nil, testFile, "/checksum_test_file", TransferUpload, 4, 4, 0, false, fs)
+	transfer.UpdateChecksum(data[4:], 4)
+	assert.NoError(t, file.Close())
+	assert.NoError(t, transfer.Close())
+	notification = collector.get(t)
+	assert.Empty(t, notification.Checksum)
+	// failed uploads have no checksum
+	file, err = os.Create(testFile)
+	require.NoError(t, err)
+	transfer = NewBaseTransfer(file, conn, nil, testFile, "/checksum_test_file", TransferUpload, 0, 0, 0, true, fs)
+	transfer.UpdateChecksum(data, 0)
+	transfer.TransferError(errors.New("fake error"))
+	assert.NoError(t, file.Close())
+	assert.Error(t, transfer.Close())
+	notification = collector.get(t)
+	assert.Empty(t, notification.Checksum)
+	// downloads have timing details but no checksum
+	file, err = os.Open(testFile)
+	require.NoError(t, err)
+	transfer = NewBaseTransfer(file, conn, nil, testFile, "/checksum_test_file", TransferDownload, 0, 0, 0, false, fs)
+	assert.Nil(t, transfer.hasher)
+	assert.NoError(t, file.Close())
+	assert.NoError(t, transfer.Close())
+	notification = collector.get(t)
+	assert.Equal(t, operationDownload, notification.Action)
+	assert.Empty(t, notification.Checksum)
+	assert.Greater(t, notification.StartTime, int64(0))
+
+	assert.NoError(t, os.Remove(testFile))
+}
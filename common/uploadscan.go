@@ -0,0 +1,396 @@
+package common
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/drakkan/sftpgo/dataprovider"
+	"github.com/drakkan/sftpgo/logger"
+	"github.com/drakkan/sftpgo/vfs"
+)
+
+const (
+	// UploadScanActionQuarantine moves the infected files to the user quarantine path
+	UploadScanActionQuarantine = "quarantine"
+	// UploadScanActionDelete deletes the infected files
+	UploadScanActionDelete = "delete"
+	scanningSuffix         = ".scanning"
+	clamdChunkSize         = 64 * 1024
+	clamdDialTimeout       = 10 * time.Second
+)
+
+// ErrInfectedFile is returned to the client if the uploaded file is infected
+var ErrInfectedFile = errors.New("the uploaded file is infected")
+
+// fileScanner is used to scan the uploaded files, nil means scanning disabled.
+// Test cases can replace it with a custom implementation
+var fileScanner uploadScanner
+
+// UploadScanConfig defines the configuration to scan the uploaded files using a
+// ClamAV daemon. Until the scan completes the uploaded file is stored with a
+// ".scanning" suffix and the upload action is executed only for clean files
+type UploadScanConfig struct {
+	// Address of the ClamAV daemon, for example "tcp://127.0.0.1:3310" or
+	// "unix:///var/run/clamav/clamd.ctl". Empty means disabled
+	Address string `json:"address" mapstructure:"address"`
+	// Timeout for each scan as seconds, 0 means no timeout
+	Timeout int `json:"timeout" mapstructure:"timeout"`
+	// InfectedAction defines what to do with the infected files: "quarantine" moves them
+	// to the quarantine path, "delete" removes them
+	InfectedAction string `json:"infected_action" mapstructure:"infected_action"`
+	// QuarantinePath is the virtual path, inside the user home, where the infected files are moved to.
+	// The files that cannot be scanned are not moved: they keep the ".scanning" suffix
+	QuarantinePath string `json:"quarantine_path" mapstructure:"quarantine_path"`
+}
+
+// IsEnabled returns true if the uploaded files must be scanned
+func (c *UploadScanConfig) IsEnabled() bool {
+	return c.Address != ""
+}
+
+func (c *UploadScanConfig) validate() error {
+	if !c.IsEnabled() {
+		return nil
+	}
+	if _, _, err := c.getNetworkAndAddress(); err != nil {
+		return err
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("invalid upload scan timeout: %v", c.Timeout)
+	}
+	switch c.InfectedAction {
+	case UploadScanActionQuarantine:
+		if path.Clean("/"+c.QuarantinePath) == "/" {
+			return errors.New("invalid upload scan configuration: the quarantine path cannot be the user home")
+		}
+	case UploadScanActionDelete:
+	default:
+		return fmt.Errorf("invalid upload scan infected action: %#v", c.InfectedAction)
+	}
+	return nil
+}
+
+func (c *UploadScanConfig) getNetworkAndAddress() (string, string, error) {
+	if strings.HasPrefix(c.Address, "tcp://") {
+		return "tcp", strings.TrimPrefix(c.Address, "tcp://"), nil
+	}
+	if strings.HasPrefix(c.Address, "unix://") {
+		return "unix", strings.TrimPrefix(c.Address, "unix://"), nil
+	}
+	return "", "", fmt.Errorf("invalid upload scan address %#v, the supported schemes are tcp:// and unix://", c.Address)
+}
+
+func (c *UploadScanConfig) getScanner() uploadScanner {
+	if !c.IsEnabled() {
+		return nil
+	}
+	network, address, _ := c.getNetworkAndAddress()
+	return &clamdScanner{
+		network: network,
+		address: address,
+		timeout: time.Duration(c.Timeout) * time.Second,
+	}
+}
+
+// uploadScanner defines a scanner for the uploaded files
+type uploadScanner interface {
+	// scan returns the name of the detected signature, empty if the content is clean
+	scan(reader io.Reader) (string, error)
+}
+
+// clamdScanner streams the file contents to a ClamAV daemon using the INSTREAM command
+type clamdScanner struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+func (s *clamdScanner) scan(reader io.Reader) (string, error) {
+	conn, err := net.DialTimeout(s.network, s.address, clamdDialTimeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if s.timeout > 0 {
+		if err := conn.SetDeadline(time.Now().Add(s.timeout)); err != nil {
+			return "", err
+		}
+	}
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return "", err
+	}
+	buf := make([]byte, clamdChunkSize+4)
+	for {
+		n, errRead := reader.Read(buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, err := conn.Write(buf[:n+4]); err != nil {
+				// clamd replies and closes the connection if the stream size limit is exceeded
+				if reply, errReply := readClamdReply(conn); errReply == nil {
+					return parseClamdReply(reply)
+				}
+				return "", err
+			}
+		}
+		if errRead == io.EOF {
+			break
+		}
+		if errRead != nil {
+			return "", errRead
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return "", err
+	}
+	reply, err := readClamdReply(conn)
+	if err != nil {
+		return "", err
+	}
+	return parseClamdReply(reply)
+}
+
+func readClamdReply(conn net.Conn) (string, error) {
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && (err != io.EOF || reply == "") {
+		return "", err
+	}
+	return reply, nil
+}
+
+// parseClamdReply parses replies such as "stream: OK" and "stream: Eicar-Signature FOUND"
+func parseClamdReply(reply string) (string, error) {
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	reply = strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+	if reply == "OK" {
+		return "", nil
+	}
+	if strings.HasSuffix(reply, "FOUND") {
+		signature := strings.TrimSpace(strings.TrimSuffix(reply, "FOUND"))
+		if signature == "" {
+			signature = "unknown"
+		}
+		return signature, nil
+	}
+	return "", fmt.Errorf("unexpected clamd reply: %#v", reply)
+}
+
+func (c *UploadScanConfig) getQuarantineDir() string {
+	if c.InfectedAction != UploadScanActionQuarantine {
+		return ""
+	}
+	return path.Clean("/" + c.QuarantinePath)
+}
+
+// IsReservedPath returns true if the virtual path is the quarantine path, is inside
+// it or has the suffix used for the files being scanned. The paths are compared case
+// insensitively, some filesystems are case insensitive
+func (c *UploadScanConfig) IsReservedPath(virtualPath string) bool {
+	if !c.IsEnabled() {
+		return false
+	}
+	virtualPath = strings.ToLower(path.Clean("/" + virtualPath))
+	if strings.HasSuffix(virtualPath, scanningSuffix) {
+		return true
+	}
+	quarantineDir := strings.ToLower(c.getQuarantineDir())
+	if quarantineDir == "" {
+		return false
+	}
+	return virtualPath == quarantineDir || strings.HasPrefix(virtualPath, quarantineDir+"/")
+}
+
+// hasReservedPathsInside returns true if the quarantine path is inside the given virtual directory
+func (c *UploadScanConfig) hasReservedPathsInside(virtualPath string) bool {
+	if !c.IsEnabled() {
+		return false
+	}
+	quarantineDir := strings.ToLower(c.getQuarantineDir())
+	if quarantineDir == "" {
+		return false
+	}
+	virtualPath = strings.ToLower(path.Clean("/" + virtualPath))
+	if virtualPath == "/" {
+		return true
+	}
+	return strings.HasPrefix(quarantineDir, virtualPath+"/")
+}
+
+func getScanningPath(fsPath string) string {
+	return fsPath + scanningSuffix
+}
+
+// isHiddenUpload returns true if the uploads are written to the path with the
+// ".scanning" suffix from the start. Atomic uploads are renamed to this path
+// after the transfer completes
+func (c *BaseConnection) isHiddenUpload() bool {
+	return fileScanner != nil && !(Config.IsAtomicUploadEnabled() && c.Fs.IsAtomicUploadSupported())
+}
+
+// isExistingFileKept returns true if the upload overwrites an existing file that
+// is still stored at the final path, it is replaced only after a clean scan
+func (t *BaseTransfer) isExistingFileKept() bool {
+	return t.hiddenUpload && !t.isNewFile && !vfs.IsLocalOrSFTPFs(t.Fs)
+}
+
+func (t *BaseTransfer) isUploadScanRequired() bool {
+	return fileScanner != nil && t.transferType == TransferUpload && t.ErrTransfer == nil
+}
+
+func (t *BaseTransfer) scanFile(scanPath string) (string, error) {
+	f, r, _, err := t.Connection.Fs.Open(scanPath, 0)
+	if err != nil {
+		return "", err
+	}
+	var reader io.ReadCloser
+	if f != nil {
+		reader = f
+	} else {
+		reader = r
+	}
+	defer reader.Close()
+
+	return fileScanner.scan(reader)
+}
+
+// scanUpload scans the uploaded file, stored at scanPath, and executes the upload
+// action only if the file is clean. Infected files are moved to the quarantine
+// path or deleted, the files that cannot be scanned remain hidden
+func (t *BaseTransfer) scanUpload(scanPath string, fileSize int64, action *ActionNotification) error {
+	startTime := time.Now()
+	signature, err := t.scanFile(scanPath)
+	t.Connection.Log(logger.LevelDebug, "upload scan completed for file %#v, elapsed: %v, signature: %#v, err: %v",
+		scanPath, time.Since(startTime), signature, err)
+	if err != nil {
+		t.Connection.Log(logger.LevelError, "unable to scan uploaded file %#v, it remains hidden as %#v: %v",
+			t.fsPath, scanPath, err)
+		action.Status = 0
+		go actionHandler.Handle(action) //nolint:errcheck
+		return t.Connection.GetGenericError(err)
+	}
+	if signature != "" {
+		return t.handleInfectedUpload(scanPath, fileSize, signature)
+	}
+	if scanPath != t.fsPath {
+		if err = t.Connection.Fs.Rename(scanPath, t.fsPath); err != nil {
+			t.Connection.Log(logger.LevelWarn, "unable to rename scanned file %#v -> %#v: %v", scanPath, t.fsPath, err)
+			action.Status = 0
+			go actionHandler.Handle(action) //nolint:errcheck
+			return t.Connection.GetFsError(err)
+		}
+	}
+	go actionHandler.Handle(action) //nolint:errcheck
+	return nil
+}
+
+func (t *BaseTransfer) handleInfectedUpload(scanPath string, fileSize int64, signature string) error {
+	var fsTarget, virtualTarget string
+	var err error
+
+	t.Connection.Log(logger.LevelWarn, "uploaded file %#v is infected, signature: %#v, action: %#v", t.fsPath,
+		signature, Config.UploadScan.InfectedAction)
+	if Config.UploadScan.InfectedAction == UploadScanActionDelete {
+		err = t.removeInfectedFile(scanPath, fileSize)
+	} else {
+		fsTarget, virtualTarget, err = t.moveToQuarantine(scanPath, fileSize)
+	}
+	action := newActionNotification(&t.Connection.User, operationInfected, t.fsPath, fsTarget, "", t.Connection.protocol,
+		fileSize, err)
+	t.Connection.addActionNotificationDetails(action, t.requestPath, virtualTarget)
+	action.Signature = signature
+	go actionHandler.Handle(action) //nolint:errcheck
+	return ErrInfectedFile
+}
+
+func (t *BaseTransfer) removeInfectedFile(scanPath string, fileSize int64) error {
+	if err := t.Connection.Fs.Remove(scanPath, false); err != nil {
+		t.Connection.Log(logger.LevelWarn, "unable to remove infected file %#v: %v", scanPath, err)
+		return err
+	}
+	if t.isExistingFileKept() {
+		// only the size difference was added to the quota for the overwritten file
+		if sizeDiff := fileSize - t.InitialSize; sizeDiff > 0 {
+			t.updateRequestPathQuota(0, -sizeDiff)
+		}
+	} else {
+		t.updateRequestPathQuota(-1, -fileSize)
+	}
+	return nil
+}
+
+// updateRequestPathQuota updates the quota for the user, and for the virtual folder
+// if any, where the uploaded file is stored
+func (t *BaseTransfer) updateRequestPathQuota(numFiles int, sizeDiff int64) {
+	vfolder, err := t.Connection.User.GetVirtualFolderForPath(path.Dir(t.requestPath))
+	if err == nil {
+		dataprovider.UpdateVirtualFolderQuota(&vfolder.BaseVirtualFolder, numFiles, sizeDiff, false) //nolint:errcheck
+		if vfolder.IsIncludedInUserQuota() {
+			dataprovider.UpdateUserQuota(&t.Connection.User, numFiles, sizeDiff, false) //nolint:errcheck
+		}
+	} else {
+		dataprovider.UpdateUserQuota(&t.Connection.User, numFiles, sizeDiff, false) //nolint:errcheck
+	}
+}
+
+// moveToQuarantine moves the infected file to the user quarantine path and
+// returns the filesystem and virtual target paths
+func (t *BaseTransfer) moveToQuarantine(scanPath string, fileSize int64) (string, string, error) {
+	quarantineDir := Config.UploadScan.getQuarantineDir()
+	if err := t.createQuarantineDir(quarantineDir); err != nil {
+		t.Connection.Log(logger.LevelWarn, "unable to create quarantine dir %#v: %v", quarantineDir, err)
+		return "", "", err
+	}
+	virtualTarget := path.Join(quarantineDir, fmt.Sprintf("%v.%v", path.Base(t.requestPath), time.Now().UnixNano()))
+	fsTarget, err := t.Connection.Fs.ResolvePath(virtualTarget)
+	if err != nil {
+		return "", "", err
+	}
+	if err = t.Connection.Fs.Rename(scanPath, fsTarget); err != nil {
+		t.Connection.Log(logger.LevelWarn, "unable to move infected file %#v to quarantine %#v: %v", scanPath, fsTarget, err)
+		return "", "", err
+	}
+	t.Connection.Log(logger.LevelInfo, "infected file %#v moved to quarantine %#v", scanPath, fsTarget)
+	t.Connection.updateQuotaAfterRename(t.requestPath, virtualTarget, fsTarget, -1) //nolint:errcheck
+	if t.isExistingFileKept() {
+		// the overwritten file is still stored at the final path, only the size
+		// difference was added to the quota for the upload
+		keptSize := t.InitialSize
+		if fileSize < keptSize {
+			keptSize = fileSize
+		}
+		t.updateRequestPathQuota(1, keptSize)
+	}
+	return fsTarget, virtualTarget, nil
+}
+
+func (t *BaseTransfer) createQuarantineDir(quarantineDir string) error {
+	dirPath := "/"
+	for _, name := range strings.Split(strings.TrimPrefix(quarantineDir, "/"), "/") {
+		dirPath = path.Join(dirPath, name)
+		fsPath, err := t.Connection.Fs.ResolvePath(dirPath)
+		if err != nil {
+			return err
+		}
+		info, err := t.Connection.Fs.Stat(fsPath)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%#v is not a directory", dirPath)
+			}
+			continue
+		}
+		if !t.Connection.Fs.IsNotExist(err) {
+			return err
+		}
+		if err = t.Connection.Fs.Mkdir(fsPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,431 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drakkan/sftpgo/dataprovider"
+	"github.com/drakkan/sftpgo/vfs"
+)
+
+const (
+	testVirusSignature = "Eicar-Test-Signature"
+)
+
+var testVirusContent = []byte("X5O!P%@AP[4\\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*")
+
+type uploadScannerStub struct {
+	signature string
+	err       error
+	onScan    func()
+	scanned   []byte
+}
+
+func (s *uploadScannerStub) scan(reader io.Reader) (string, error) {
+	if s.onScan != nil {
+		s.onScan()
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+	s.scanned = data
+	return s.signature, s.err
+}
+
+// startClamdStandIn starts a server implementing the clamd INSTREAM command,
+// the data containing the EICAR test string are reported as infected
+func startClamdStandIn(t *testing.T, network, address string) net.Listener {
+	listener, err := net.Listen(network, address)
+	require.NoError(t, err)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handleClamdStandInConn(conn)
+		}
+	}()
+	return listener
+}
+
+func handleClamdStandInConn(conn net.Conn) {
+	defer conn.Close()
+
+	command := make([]byte, len("zINSTREAM\x00"))
+	if _, err := io.ReadFull(conn, command); err != nil {
+		return
+	}
+	if string(command) != "zINSTREAM\x00" {
+		conn.Write([]byte("UNKNOWN COMMAND\x00")) //nolint:errcheck
+		return
+	}
+	var data bytes.Buffer
+	for {
+		var size uint32
+		if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+			return
+		}
+		if size == 0 {
+			break
+		}
+		if _, err := io.CopyN(&data, conn, int64(size)); err != nil {
+			return
+		}
+	}
+	if bytes.Contains(data.Bytes(), []byte("EICAR-STANDARD-ANTIVIRUS-TEST-FILE")) {
+		conn.Write([]byte("stream: " + testVirusSignature + " FOUND\x00")) //nolint:errcheck
+		return
+	}
+	conn.Write([]byte("stream: OK\x00")) //nolint:errcheck
+}
+
+func TestUploadScanConfig(t *testing.T) {
+	c := UploadScanConfig{}
+	assert.False(t, c.IsEnabled())
+	assert.NoError(t, c.validate())
+	assert.Nil(t, c.getScanner())
+
+	c.Address = "127.0.0.1:3310"
+	assert.Error(t, c.validate())
+	c.Address = "tcp://127.0.0.1:3310"
+	assert.Error(t, c.validate())
+	c.InfectedAction = UploadScanActionQuarantine
+	assert.Error(t, c.validate())
+	c.QuarantinePath = "/"
+	assert.Error(t, c.validate())
+	c.QuarantinePath = ".quarantine"
+	assert.NoError(t, c.validate())
+	c.Timeout = -1
+	assert.Error(t, c.validate())
+	c.Timeout = 10
+	c.InfectedAction = UploadScanActionDelete
+	c.QuarantinePath = ""
+	assert.NoError(t, c.validate())
+	c.Address = "unix:///var/run/clamav/clamd.ctl"
+	assert.NoError(t, c.validate())
+	scanner, ok := c.getScanner().(*clamdScanner)
+	if assert.True(t, ok) {
+		assert.Equal(t, "unix", scanner.network)
+		assert.Equal(t, "/var/run/clamav/clamd.ctl", scanner.address)
+	}
+
+	configCopy := Config
+	t.Cleanup(func() {
+		Config = configCopy
+		fileScanner = nil
+	})
+	c.InfectedAction = "rename"
+	assert.Error(t, Initialize(Configuration{UploadScan: c}))
+	c.InfectedAction = UploadScanActionDelete
+	require.NoError(t, Initialize(Configuration{UploadScan: c}))
+	assert.NotNil(t, fileScanner)
+	require.NoError(t, Initialize(Configuration{}))
+	assert.Nil(t, fileScanner)
+}
+
+func TestParseClamdReply(t *testing.T) {
+	signature, err := parseClamdReply("stream: OK\x00")
+	assert.NoError(t, err)
+	assert.Empty(t, signature)
+	signature, err = parseClamdReply("stream: Win.Test.EICAR_HDB-1 FOUND\x00")
+	assert.NoError(t, err)
+	assert.Equal(t, "Win.Test.EICAR_HDB-1", signature)
+	signature, err = parseClamdReply("stream: FOUND")
+	assert.NoError(t, err)
+	assert.Equal(t, "unknown", signature)
+	_, err = parseClamdReply("INSTREAM size limit exceeded. ERROR\x00")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "size limit exceeded")
+	}
+}
+
+func TestClamdScanner(t *testing.T) {
+	listener := startClamdStandIn(t, "tcp", "127.0.0.1:0")
+	defer listener.Close()
+
+	c := UploadScanConfig{
+		Address:        "tcp://" + listener.Addr().String(),
+		Timeout:        10,
+		InfectedAction: UploadScanActionDelete,
+	}
+	require.NoError(t, c.validate())
+	scanner := c.getScanner()
+	signature, err := scanner.scan(bytes.NewReader(bytes.Repeat([]byte("clean data"), 20000)))
+	assert.NoError(t, err)
+	assert.Empty(t, signature)
+	signature, err = scanner.scan(bytes.NewReader(testVirusContent))
+	assert.NoError(t, err)
+	assert.Equal(t, testVirusSignature, signature)
+	signature, err = scanner.scan(bytes.NewReader(nil))
+	assert.NoError(t, err)
+	assert.Empty(t, signature)
+
+	if runtime.GOOS != osWindows {
+		socketPath := filepath.Join(os.TempDir(), "clamd_test.sock")
+		unixListener := startClamdStandIn(t, "unix", socketPath)
+		c.Address = "unix://" + socketPath
+		signature, err = c.getScanner().scan(bytes.NewReader(testVirusContent))
+		assert.NoError(t, err)
+		assert.Equal(t, testVirusSignature, signature)
+		unixListener.Close()
+	}
+
+	listener.Close()
+	_, err = scanner.scan(bytes.NewReader(testVirusContent))
+	assert.Error(t, err)
+}
+
+func TestUploadScan(t *testing.T) {
+	configCopy := Config
+	collector := &notificationsCollector{
+		notifications: make(chan *ActionNotification, 1),
+	}
+	InitializeActionHandler(collector)
+	t.Cleanup(func() {
+		Config = configCopy
+		fileScanner = nil
+		InitializeActionHandler(&defaultActionHandler{})
+	})
+
+	homeDir := filepath.Join(os.TempDir(), "upload_scan_home")
+	require.NoError(t, os.MkdirAll(homeDir, os.ModePerm))
+	defer os.RemoveAll(homeDir)
+
+	Config.UploadScan = UploadScanConfig{
+		Address:        "tcp://127.0.0.1:3310",
+		InfectedAction: UploadScanActionQuarantine,
+		QuarantinePath: "/quarantine/infected",
+	}
+	scanner := &uploadScannerStub{}
+	fileScanner = scanner
+
+	fs := vfs.NewOsFs("id", homeDir, nil)
+	u := dataprovider.User{
+		Username: "scan_user",
+		HomeDir:  homeDir,
+	}
+	conn := NewBaseConnection("id", ProtocolSFTP, u, fs)
+	testFile := filepath.Join(homeDir, "file.bin")
+	scanningFile := testFile + scanningSuffix
+	data := []byte("clean data")
+
+	uploadFile := func(name string) *BaseTransfer {
+		err := ioutil.WriteFile(name, data, os.ModePerm)
+		require.NoError(t, err)
+		file, err := os.Open(name)
+		require.NoError(t, err)
+		transfer := NewBaseTransfer(file, conn, nil, testFile, "/file.bin", TransferUpload, 0, 0, 0, true, fs)
+		transfer.BytesReceived = int64(len(data))
+		require.NoError(t, file.Close())
+		return transfer
+	}
+	// the upload is hidden from the start
+	assert.Equal(t, scanningFile, conn.GetUploadPath(testFile))
+	// clean file, it is hidden while scanning
+	scanner.onScan = func() {
+		assert.NoFileExists(t, testFile)
+		assert.FileExists(t, scanningFile)
+	}
+	assert.NoError(t, uploadFile(scanningFile).Close())
+	assert.Equal(t, data, scanner.scanned)
+	assert.FileExists(t, testFile)
+	assert.NoFileExists(t, scanningFile)
+	notification := collector.get(t)
+	assert.Equal(t, operationUpload, notification.Action)
+	assert.Equal(t, 1, notification.Status)
+	assert.Equal(t, testFile, notification.Path)
+	// atomic upload, the temporary file is directly renamed with the scanning suffix
+	assert.NoError(t, os.Remove(testFile))
+	Config.UploadMode = UploadModeAtomic
+	tempFile := conn.GetUploadPath(testFile)
+	assert.NotEqual(t, scanningFile, tempFile)
+	assert.NoError(t, uploadFile(tempFile).Close())
+	Config.UploadMode = UploadModeStandard
+	assert.FileExists(t, testFile)
+	assert.NoFileExists(t, tempFile)
+	notification = collector.get(t)
+	assert.Equal(t, operationUpload, notification.Action)
+	assert.Equal(t, 1, notification.Status)
+	assert.NoError(t, os.Remove(testFile))
+	// scan error, the file remains hidden
+	scanner.onScan = nil
+	scanner.err = errors.New("clamd not reachable")
+	err := uploadFile(scanningFile).Close()
+	assert.Equal(t, conn.GetGenericError(scanner.err), err)
+	assert.NoFileExists(t, testFile)
+	assert.FileExists(t, scanningFile)
+	notification = collector.get(t)
+	assert.Equal(t, operationUpload, notification.Action)
+	assert.Equal(t, 0, notification.Status)
+	assert.NoError(t, os.Remove(scanningFile))
+	// infected file moved to quarantine
+	scanner.err = nil
+	scanner.signature = testVirusSignature
+	err = uploadFile(scanningFile).Close()
+	assert.ErrorIs(t, err, ErrInfectedFile)
+	assert.NoFileExists(t, testFile)
+	assert.NoFileExists(t, scanningFile)
+	notification = collector.get(t)
+	assert.Equal(t, operationInfected, notification.Action)
+	assert.Equal(t, 1, notification.Status)
+	assert.Equal(t, testVirusSignature, notification.Signature)
+	assert.Equal(t, testFile, notification.Path)
+	assert.Equal(t, "/file.bin", notification.VirtualPath)
+	assert.True(t, strings.HasPrefix(notification.VirtualTargetPath, "/quarantine/infected/file.bin."))
+	assert.Equal(t, filepath.Join(homeDir, filepath.FromSlash(notification.VirtualTargetPath)), notification.TargetPath)
+	assert.FileExists(t, notification.TargetPath)
+	// the quarantine path cannot be created
+	assert.NoError(t, os.RemoveAll(filepath.Join(homeDir, "quarantine")))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(homeDir, "quarantine"), data, os.ModePerm))
+	err = uploadFile(scanningFile).Close()
+	assert.ErrorIs(t, err, ErrInfectedFile)
+	assert.FileExists(t, scanningFile)
+	notification = collector.get(t)
+	assert.Equal(t, operationInfected, notification.Action)
+	assert.Equal(t, 0, notification.Status)
+	assert.Empty(t, notification.TargetPath)
+	assert.NoError(t, os.Remove(scanningFile))
+	// infected file deleted
+	Config.UploadScan.InfectedAction = UploadScanActionDelete
+	err = uploadFile(scanningFile).Close()
+	assert.ErrorIs(t, err, ErrInfectedFile)
+	assert.NoFileExists(t, testFile)
+	assert.NoFileExists(t, scanningFile)
+	notification = collector.get(t)
+	assert.Equal(t, operationInfected, notification.Action)
+	assert.Equal(t, 1, notification.Status)
+	assert.Equal(t, testVirusSignature, notification.Signature)
+	assert.Empty(t, notification.TargetPath)
+	// failed uploads are not scanned
+	scanner.scanned = nil
+	// and the hidden partial file is removed
+	transfer := uploadFile(scanningFile)
+	transfer.TransferError(errors.New("fake error"))
+	assert.Error(t, transfer.Close())
+	assert.Nil(t, scanner.scanned)
+	assert.NoFileExists(t, testFile)
+	assert.NoFileExists(t, scanningFile)
+	notification = collector.get(t)
+	assert.Equal(t, operationUpload, notification.Action)
+	assert.Equal(t, 0, notification.Status)
+}
+
+func TestUploadScanReservedPaths(t *testing.T) {
+	configCopy := Config
+	t.Cleanup(func() {
+		Config = configCopy
+	})
+
+	Config.UploadScan = UploadScanConfig{}
+	assert.False(t, Config.UploadScan.IsReservedPath("/file.scanning"))
+	assert.False(t, Config.UploadScan.hasReservedPathsInside("/"))
+
+	Config.UploadScan = UploadScanConfig{
+		Address:        "tcp://127.0.0.1:3310",
+		InfectedAction: UploadScanActionQuarantine,
+		QuarantinePath: "/quarantine/infected",
+	}
+	assert.True(t, Config.UploadScan.IsReservedPath("/file.scanning"))
+	assert.True(t, Config.UploadScan.IsReservedPath("dir/FILE.SCANNING"))
+	assert.True(t, Config.UploadScan.IsReservedPath("/quarantine/infected"))
+	assert.True(t, Config.UploadScan.IsReservedPath("/Quarantine/Infected/file.1"))
+	assert.True(t, Config.UploadScan.IsReservedPath("/quarantine/../quarantine/infected/"))
+	assert.False(t, Config.UploadScan.IsReservedPath("/quarantine"))
+	assert.False(t, Config.UploadScan.IsReservedPath("/quarantine/infected1"))
+	assert.False(t, Config.UploadScan.IsReservedPath("/file.scanning.txt"))
+	assert.True(t, Config.UploadScan.hasReservedPathsInside("/"))
+	assert.True(t, Config.UploadScan.hasReservedPathsInside("/quarantine"))
+	assert.False(t, Config.UploadScan.hasReservedPathsInside("/quarantine/infected"))
+	assert.False(t, Config.UploadScan.hasReservedPathsInside("/quarantine1"))
+
+	Config.UploadScan.InfectedAction = UploadScanActionDelete
+	assert.True(t, Config.UploadScan.IsReservedPath("/file.scanning"))
+	assert.False(t, Config.UploadScan.IsReservedPath("/quarantine/infected/file"))
+	assert.False(t, Config.UploadScan.hasReservedPathsInside("/"))
+	Config.UploadScan.InfectedAction = UploadScanActionQuarantine
+
+	homeDir := filepath.Join(os.TempDir(), "upload_scan_reserved_home")
+	quarantineDir := filepath.Join(homeDir, "quarantine", "infected")
+	require.NoError(t, os.MkdirAll(quarantineDir, os.ModePerm))
+	defer os.RemoveAll(homeDir)
+	data := []byte("data")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(quarantineDir, "file.1"), data, os.ModePerm))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(homeDir, "file.scanning"), data, os.ModePerm))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(homeDir, "file"), data, os.ModePerm))
+
+	fs := vfs.NewOsFs("id", homeDir, nil)
+	u := dataprovider.User{
+		Username: "scan_user",
+		HomeDir:  homeDir,
+	}
+	u.Permissions = make(map[string][]string)
+	u.Permissions["/"] = []string{dataprovider.PermAny}
+	conn := NewBaseConnection("id", ProtocolSFTP, u, fs)
+
+	assert.True(t, conn.IsFileAllowed("/file"))
+	assert.False(t, conn.IsFileAllowed("/file.scanning"))
+	assert.False(t, conn.IsFileAllowed("/quarantine/infected/file.1"))
+	// list
+	files, err := conn.ListDir(homeDir, "/")
+	if assert.NoError(t, err) {
+		assert.Len(t, files, 2)
+		for _, fi := range files {
+			assert.NotEqual(t, "file.scanning", fi.Name())
+		}
+	}
+	files, err = conn.ListDir(filepath.Join(homeDir, "quarantine"), "/quarantine")
+	if assert.NoError(t, err) {
+		assert.Len(t, files, 0)
+	}
+	_, err = conn.ListDir(quarantineDir, "/quarantine/infected")
+	assert.ErrorIs(t, err, sftp.ErrSSHFxPermissionDenied)
+	// stat
+	assert.ErrorIs(t, conn.ChangeWorkingDir("/quarantine/infected"), sftp.ErrSSHFxNoSuchFile)
+	assert.NoError(t, conn.ChangeWorkingDir("/quarantine"))
+	// rename
+	err = conn.Rename(filepath.Join(homeDir, "file.scanning"), filepath.Join(homeDir, "restored"),
+		"/file.scanning", "/restored")
+	assert.ErrorIs(t, err, sftp.ErrSSHFxPermissionDenied)
+	err = conn.Rename(filepath.Join(quarantineDir, "file.1"), filepath.Join(homeDir, "restored"),
+		"/quarantine/infected/file.1", "/restored")
+	assert.ErrorIs(t, err, sftp.ErrSSHFxPermissionDenied)
+	err = conn.Rename(filepath.Join(homeDir, "file"), filepath.Join(homeDir, "file.scanning"),
+		"/file", "/file.scanning")
+	assert.ErrorIs(t, err, sftp.ErrSSHFxPermissionDenied)
+	err = conn.Rename(filepath.Join(homeDir, "quarantine"), filepath.Join(homeDir, "restored"),
+		"/quarantine", "/restored")
+	assert.ErrorIs(t, err, sftp.ErrSSHFxPermissionDenied)
+	assert.FileExists(t, filepath.Join(homeDir, "file.scanning"))
+	assert.FileExists(t, filepath.Join(quarantineDir, "file.1"))
+	// other operations
+	err = conn.CreateDir(filepath.Join(quarantineDir, "dir"), "/quarantine/infected/dir")
+	assert.ErrorIs(t, err, sftp.ErrSSHFxPermissionDenied)
+	err = conn.RemoveDir(filepath.Join(homeDir, "quarantine"), "/quarantine")
+	assert.ErrorIs(t, err, sftp.ErrSSHFxPermissionDenied)
+	err = conn.RemoveFile(filepath.Join(homeDir, "file.scanning"), "/file.scanning", vfs.NewFileInfo("file.scanning",
+		false, int64(len(data)), time.Now(), false))
+	assert.ErrorIs(t, err, sftp.ErrSSHFxPermissionDenied)
+	err = conn.SetStat(filepath.Join(homeDir, "file.scanning"), "/file.scanning", &StatAttributes{
+		Flags: StatAttrSize,
+	})
+	assert.ErrorIs(t, err, sftp.ErrSSHFxPermissionDenied)
+	err = conn.CreateSymlink(quarantineDir, filepath.Join(homeDir, "link"), "/quarantine/infected", "/link")
+	assert.ErrorIs(t, err, sftp.ErrSSHFxPermissionDenied)
+	assert.FileExists(t, filepath.Join(homeDir, "file.scanning"))
+}
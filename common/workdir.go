@@ -0,0 +1,125 @@
+package common
+
+import (
+	"path"
+	"sync"
+
+	"github.com/drakkan/sftpgo/dataprovider"
+	"github.com/drakkan/sftpgo/logger"
+)
+
+// WorkingDir is the current directory of a client session. It is a client path,
+// so it includes the folder mappings, if any, and it can be shared by all the
+// connections opened inside the same session, for example the SFTP subsystem and
+// the SSH commands executed on the channels of the same SSH connection
+type WorkingDir struct {
+	sync.RWMutex
+	clientPath string
+}
+
+// NewWorkingDir returns a working directory set to the login directory of the
+// given user
+func NewWorkingDir(user *dataprovider.User) *WorkingDir {
+	m := NewPrefixMapping(user.GetFolderMappings(Config.FolderPrefix))
+	return &WorkingDir{
+		clientPath: getLoginClientPath(m, user.GetLoginDir()),
+	}
+}
+
+// getLoginClientPath returns the client path for the given login directory, "/"
+// is returned if the login directory is not visible using the folder mappings
+func getLoginClientPath(m PrefixMapping, loginDir string) string {
+	clientPath := m.ClientPath(loginDir)
+	virtualPath, _, match := m.Resolve(clientPath)
+	if match != PathContainsPrefix || virtualPath != loginDir {
+		return "/"
+	}
+	return clientPath
+}
+
+// Get returns the current directory
+func (w *WorkingDir) Get() string {
+	w.RLock()
+	defer w.RUnlock()
+
+	return w.clientPath
+}
+
+// Set changes the current directory to the given client path
+func (w *WorkingDir) Set(clientPath string) {
+	w.Lock()
+	defer w.Unlock()
+
+	w.clientPath = path.Clean("/" + clientPath)
+}
+
+// Resolve returns the given client path as an absolute path, relative paths are
+// joined to the current directory
+func (w *WorkingDir) Resolve(name string) string {
+	if path.IsAbs(name) {
+		return path.Clean(name)
+	}
+	return path.Join(w.Get(), name)
+}
+
+// SetSessionWorkingDir replaces the working directory of this connection with the
+// given one, usually shared with the other connections of the same session
+func (c *BaseConnection) SetSessionWorkingDir(w *WorkingDir) {
+	c.workingDir = w
+}
+
+// GetSessionWorkingDir returns the working directory of this connection, it can
+// be shared with the other connections of the same session
+func (c *BaseConnection) GetSessionWorkingDir() *WorkingDir {
+	return c.workingDir
+}
+
+// GetLoginDir returns the login directory for this connection as client path
+func (c *BaseConnection) GetLoginDir() string {
+	return getLoginClientPath(c.prefixMapping, c.User.GetLoginDir())
+}
+
+// GetWorkingDir returns the current directory for this connection as client path
+func (c *BaseConnection) GetWorkingDir() string {
+	return c.workingDir.Get()
+}
+
+// ResolveClientPath returns the given client path as an absolute path, relative
+// paths are resolved against the current directory
+func (c *BaseConnection) ResolveClientPath(name string) string {
+	return c.workingDir.Resolve(name)
+}
+
+// ChangeWorkingDir changes the current directory. The target must be a directory
+// inside the folder mappings or one of the prefix parents
+func (c *BaseConnection) ChangeWorkingDir(name string) error {
+	clientPath := c.ResolveClientPath(name)
+	virtualPath, match := c.ResolvePrefixPath(clientPath)
+	switch match {
+	case PathDiverged:
+		c.Log(logger.LevelInfo, "cannot change directory to %#v, it is outside the folder mappings", clientPath)
+		return c.GetPermissionDeniedError()
+	case PathContainsPrefix:
+		if !c.User.HasPerm(dataprovider.PermListItems, path.Dir(virtualPath)) {
+			return c.GetPermissionDeniedError()
+		}
+		if c.IsReservedPath(virtualPath) {
+			return c.GetNotExistError()
+		}
+		fsPath, err := c.Fs.ResolvePath(virtualPath)
+		if err != nil {
+			return c.GetFsError(err)
+		}
+		info, err := c.DoStat(fsPath, 0)
+		if err != nil {
+			c.Log(logger.LevelDebug, "cannot change directory to %#v, stat error: %v", clientPath, err)
+			return c.GetFsError(err)
+		}
+		if !info.IsDir() {
+			c.Log(logger.LevelDebug, "cannot change directory to %#v, it is not a directory", clientPath)
+			return ErrNotDirectory
+		}
+	}
+	c.workingDir.Set(clientPath)
+	return nil
+}
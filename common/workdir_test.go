@@ -0,0 +1,81 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drakkan/sftpgo/dataprovider"
+	"github.com/drakkan/sftpgo/vfs"
+)
+
+func TestWorkingDir(t *testing.T) {
+	user := dataprovider.User{}
+	w := NewWorkingDir(&user)
+	assert.Equal(t, "/", w.Get())
+	assert.Equal(t, "/a/b", w.Resolve("a/b/"))
+	assert.Equal(t, "/b", w.Resolve("/a/../b"))
+	w.Set("in/")
+	assert.Equal(t, "/in", w.Get())
+	assert.Equal(t, "/in/a", w.Resolve("a"))
+	assert.Equal(t, "/", w.Resolve(".."))
+
+	user.Filters.LoginDir = "/in/acme"
+	assert.Equal(t, "/in/acme", NewWorkingDir(&user).Get())
+	user.Filters.FolderPrefix = "/files"
+	assert.Equal(t, "/files/in/acme", NewWorkingDir(&user).Get())
+	user.Filters.FolderMappings = []dataprovider.FolderMapping{
+		{Prefix: "/inbound", MappedPath: "/in"},
+		{Prefix: "/outbound", MappedPath: "/out"},
+	}
+	assert.Equal(t, "/inbound/acme", NewWorkingDir(&user).Get())
+	// the login dir is not visible using the mappings
+	user.Filters.LoginDir = "/other"
+	assert.Equal(t, "/", NewWorkingDir(&user).Get())
+}
+
+func TestConnectionWorkingDir(t *testing.T) {
+	homeDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(homeDir, "in", "acme"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(homeDir, "in", "file"), []byte("data"), os.ModePerm))
+	user := dataprovider.User{
+		Username: userTestUsername,
+		HomeDir:  homeDir,
+		Filters: dataprovider.UserFilters{
+			LoginDir: "/in",
+			FolderMappings: []dataprovider.FolderMapping{
+				{Prefix: "/data/inbound", MappedPath: "/in"},
+			},
+		},
+	}
+	user.Permissions = map[string][]string{
+		"/": {dataprovider.PermAny},
+	}
+	c := NewBaseConnection("", ProtocolSSH, user, vfs.NewOsFs("", homeDir, nil))
+	assert.Equal(t, "/data/inbound", c.GetWorkingDir())
+	assert.Equal(t, "/data/inbound/file", c.ResolveClientPath("file"))
+
+	assert.NoError(t, c.ChangeWorkingDir("acme"))
+	assert.Equal(t, "/data/inbound/acme", c.GetWorkingDir())
+	// prefix parents are allowed
+	assert.NoError(t, c.ChangeWorkingDir("../.."))
+	assert.Equal(t, "/data", c.GetWorkingDir())
+	assert.ErrorIs(t, c.ChangeWorkingDir("/other"), ErrPermissionDenied)
+	assert.ErrorIs(t, c.ChangeWorkingDir("inbound/file"), ErrNotDirectory)
+	assert.ErrorIs(t, c.ChangeWorkingDir("inbound/missing"), ErrNotExist)
+	assert.Equal(t, "/data", c.GetWorkingDir())
+
+	// the working dir is shared with the other connections of the session
+	other := NewBaseConnection("", ProtocolSFTP, user, nil)
+	other.SetSessionWorkingDir(c.workingDir)
+	assert.Equal(t, "/data", other.GetWorkingDir())
+	assert.NoError(t, c.ChangeWorkingDir("inbound"))
+	assert.Equal(t, "/data/inbound", other.GetWorkingDir())
+
+	user.Permissions["/in"] = []string{dataprovider.PermUpload}
+	c = NewBaseConnection("", ProtocolSSH, user, vfs.NewOsFs("", homeDir, nil))
+	assert.ErrorIs(t, c.ChangeWorkingDir("acme"), ErrPermissionDenied)
+}
@@ -100,12 +100,23 @@ func Init() {
 			Actions: common.ProtocolActions{
 				ExecuteOn: []string{},
 				Hook:      "",
+				Queue: common.ActionsQueueConfig{
+					Enabled:          false,
+					Workers:          4,
+					MaxAttempts:      10,
+					RetryInterval:    30,
+					MaxRetryInterval: 3600,
+				},
+				Sinks:    []common.ActionSink{},
+				Routes:   []common.ActionRoute{},
+				Checksum: "",
 			},
 			SetstatMode:         0,
 			ProxyProtocol:       0,
 			ProxyAllowed:        []string{},
 			PostConnectHook:     "",
 			MaxTotalConnections: 0,
+			FolderPrefix:        "",
 			DefenderConfig: common.DefenderConfig{
 				Enabled:          false,
 				BanTime:          30,
@@ -119,6 +130,12 @@ func Init() {
 				SafeListFile:     "",
 				BlockListFile:    "",
 			},
+			UploadScan: common.UploadScanConfig{
+				Address:        "",
+				Timeout:        300,
+				InfectedAction: common.UploadScanActionQuarantine,
+				QuarantinePath: "/.quarantine",
+			},
 		},
 		SFTPD: sftpd.Configuration{
 			Banner:                  defaultSFTPDBanner,
@@ -213,6 +230,11 @@ func Init() {
 			UpdateMode:                0,
 			PreferDatabaseCredentials: false,
 			SkipNaturalKeysValidation: false,
+			ResumableUploads: dataprovider.ResumableUploadsConfig{
+				Enabled:       false,
+				MaxAge:        72,
+				CheckInterval: 60,
+			},
 		},
 		HTTPDConfig: httpd.Conf{
 			Bindings:           []httpd.Binding{defaultHTTPDBinding},
@@ -495,6 +517,11 @@ func checkCommonParamsCompatibility() {
 		globalConf.Common.ProxyProtocol = globalConf.SFTPD.ProxyProtocol //nolint:staticcheck
 		globalConf.Common.ProxyAllowed = globalConf.SFTPD.ProxyAllowed   //nolint:staticcheck
 	}
+	if globalConf.SFTPD.FolderPrefix != "" && globalConf.Common.FolderPrefix == "" { //nolint:staticcheck
+		logger.Warn(logSender, "", "sftpd.folder_prefix is deprecated, please use common.folder_prefix")
+		logger.WarnToConsole("sftpd.folder_prefix is deprecated, please use common.folder_prefix")
+		globalConf.Common.FolderPrefix = globalConf.SFTPD.FolderPrefix //nolint:staticcheck
+	}
 }
 
 func checkSFTPDBindingsCompatibility() {
@@ -593,6 +620,8 @@ func loadBindingsFromEnv() {
 		getWebDAVDBindingFromEnv(idx)
 		getHTTPDBindingFromEnv(idx)
 		getHTTPClientCertificatesFromEnv(idx)
+		getActionSinkFromEnv(idx)
+		getActionRouteFromEnv(idx)
 	}
 }
 
@@ -812,16 +841,93 @@ func getHTTPClientCertificatesFromEnv(idx int) {
 	}
 }
 
+func getActionSinkFromEnv(idx int) {
+	sink := common.ActionSink{}
+	if len(globalConf.Common.Actions.Sinks) > idx {
+		sink = globalConf.Common.Actions.Sinks[idx]
+	}
+
+	isSet := false
+
+	name, ok := os.LookupEnv(fmt.Sprintf("SFTPGO_COMMON__ACTIONS__SINKS__%v__NAME", idx))
+	if ok {
+		sink.Name = name
+		isSet = true
+	}
+
+	url, ok := os.LookupEnv(fmt.Sprintf("SFTPGO_COMMON__ACTIONS__SINKS__%v__URL", idx))
+	if ok {
+		sink.URL = url
+		isSet = true
+	}
+
+	if isSet {
+		if len(globalConf.Common.Actions.Sinks) > idx {
+			globalConf.Common.Actions.Sinks[idx] = sink
+		} else {
+			globalConf.Common.Actions.Sinks = append(globalConf.Common.Actions.Sinks, sink)
+		}
+	}
+}
+
+func getActionRouteFromEnv(idx int) {
+	route := common.ActionRoute{}
+	if len(globalConf.Common.Actions.Routes) > idx {
+		route = globalConf.Common.Actions.Routes[idx]
+	}
+
+	isSet := false
+
+	actions, ok := lookupStringListFromEnv(fmt.Sprintf("SFTPGO_COMMON__ACTIONS__ROUTES__%v__ACTIONS", idx))
+	if ok {
+		route.Actions = actions
+		isSet = true
+	}
+
+	usernames, ok := lookupStringListFromEnv(fmt.Sprintf("SFTPGO_COMMON__ACTIONS__ROUTES__%v__USERNAMES", idx))
+	if ok {
+		route.Usernames = usernames
+		isSet = true
+	}
+
+	paths, ok := lookupStringListFromEnv(fmt.Sprintf("SFTPGO_COMMON__ACTIONS__ROUTES__%v__PATHS", idx))
+	if ok {
+		route.Paths = paths
+		isSet = true
+	}
+
+	sinks, ok := lookupStringListFromEnv(fmt.Sprintf("SFTPGO_COMMON__ACTIONS__ROUTES__%v__SINKS", idx))
+	if ok {
+		route.Sinks = sinks
+		isSet = true
+	}
+
+	if isSet {
+		if len(globalConf.Common.Actions.Routes) > idx {
+			globalConf.Common.Actions.Routes[idx] = route
+		} else {
+			globalConf.Common.Actions.Routes = append(globalConf.Common.Actions.Routes, route)
+		}
+	}
+}
+
 func setViperDefaults() {
 	viper.SetDefault("common.idle_timeout", globalConf.Common.IdleTimeout)
 	viper.SetDefault("common.upload_mode", globalConf.Common.UploadMode)
 	viper.SetDefault("common.actions.execute_on", globalConf.Common.Actions.ExecuteOn)
 	viper.SetDefault("common.actions.hook", globalConf.Common.Actions.Hook)
+	viper.SetDefault("common.actions.queue.enabled", globalConf.Common.Actions.Queue.Enabled)
+	viper.SetDefault("common.actions.queue.workers", globalConf.Common.Actions.Queue.Workers)
+	viper.SetDefault("common.actions.queue.max_attempts", globalConf.Common.Actions.Queue.MaxAttempts)
+	viper.SetDefault("common.actions.queue.retry_interval", globalConf.Common.Actions.Queue.RetryInterval)
+	viper.SetDefault("common.actions.queue.max_retry_interval", globalConf.Common.Actions.Queue.MaxRetryInterval)
+	viper.SetDefault("common.actions.checksum", globalConf.Common.Actions.Checksum)
 	viper.SetDefault("common.setstat_mode", globalConf.Common.SetstatMode)
 	viper.SetDefault("common.proxy_protocol", globalConf.Common.ProxyProtocol)
 	viper.SetDefault("common.proxy_allowed", globalConf.Common.ProxyAllowed)
 	viper.SetDefault("common.post_connect_hook", globalConf.Common.PostConnectHook)
 	viper.SetDefault("common.max_total_connections", globalConf.Common.MaxTotalConnections)
+	viper.SetDefault("common.folder_prefix", globalConf.Common.FolderPrefix)
 	viper.SetDefault("common.defender.enabled", globalConf.Common.DefenderConfig.Enabled)
 	viper.SetDefault("common.defender.ban_time", globalConf.Common.DefenderConfig.BanTime)
 	viper.SetDefault("common.defender.ban_time_increment", globalConf.Common.DefenderConfig.BanTimeIncrement)
@@ -833,6 +939,10 @@ func setViperDefaults() {
 	viper.SetDefault("common.defender.entries_hard_limit", globalConf.Common.DefenderConfig.EntriesHardLimit)
 	viper.SetDefault("common.defender.safelist_file", globalConf.Common.DefenderConfig.SafeListFile)
 	viper.SetDefault("common.defender.blocklist_file", globalConf.Common.DefenderConfig.BlockListFile)
+	viper.SetDefault("common.upload_scan.address", globalConf.Common.UploadScan.Address)
+	viper.SetDefault("common.upload_scan.timeout", globalConf.Common.UploadScan.Timeout)
+	viper.SetDefault("common.upload_scan.infected_action", globalConf.Common.UploadScan.InfectedAction)
+	viper.SetDefault("common.upload_scan.quarantine_path", globalConf.Common.UploadScan.QuarantinePath)
 	viper.SetDefault("sftpd.max_auth_tries", globalConf.SFTPD.MaxAuthTries)
 	viper.SetDefault("sftpd.banner", globalConf.SFTPD.Banner)
 	viper.SetDefault("sftpd.host_keys", globalConf.SFTPD.HostKeys)
@@ -844,7 +954,6 @@ func setViperDefaults() {
 	viper.SetDefault("sftpd.enabled_ssh_commands", globalConf.SFTPD.EnabledSSHCommands)
 	viper.SetDefault("sftpd.keyboard_interactive_auth_hook", globalConf.SFTPD.KeyboardInteractiveHook)
 	viper.SetDefault("sftpd.password_authentication", globalConf.SFTPD.PasswordAuthentication)
-	viper.SetDefault("sftpd.folder_prefix", globalConf.SFTPD.FolderPrefix)
 	viper.SetDefault("sftpd.sftp_only", globalConf.SFTPD.SFTPOnly)
 	viper.SetDefault("ftpd.banner", globalConf.FTPD.Banner)
 	viper.SetDefault("ftpd.banner_file", globalConf.FTPD.BannerFile)
@@ -902,6 +1011,9 @@ func setViperDefaults() {
 	viper.SetDefault("data_provider.password_hashing.argon2_options.parallelism", globalConf.ProviderConf.PasswordHashing.Argon2Options.Parallelism)
 	viper.SetDefault("data_provider.update_mode", globalConf.ProviderConf.UpdateMode)
 	viper.SetDefault("data_provider.skip_natural_keys_validation", globalConf.ProviderConf.SkipNaturalKeysValidation)
+	viper.SetDefault("data_provider.resumable_uploads.enabled", globalConf.ProviderConf.ResumableUploads.Enabled)
+	viper.SetDefault("data_provider.resumable_uploads.max_age", globalConf.ProviderConf.ResumableUploads.MaxAge)
+	viper.SetDefault("data_provider.resumable_uploads.check_interval", globalConf.ProviderConf.ResumableUploads.CheckInterval)
 	viper.SetDefault("httpd.templates_path", globalConf.HTTPDConfig.TemplatesPath)
 	viper.SetDefault("httpd.static_files_path", globalConf.HTTPDConfig.StaticFilesPath)
 	viper.SetDefault("httpd.backups_path", globalConf.HTTPDConfig.BackupsPath)
@@ -926,6 +1038,7 @@ func setViperDefaults() {
 	viper.SetDefault("telemetry.tls_cipher_suites", globalConf.TelemetryConfig.TLSCipherSuites)
 	viper.SetDefault("fsmeta.enabled", globalConf.FSMetaConfig.Enabled)
 	viper.SetDefault("fsmeta.driver", globalConf.FSMetaConfig.Driver)
+	viper.SetDefault("fsmeta.use_data_provider", globalConf.FSMetaConfig.UseDataProvider)
 	viper.SetDefault("fsmeta.database", globalConf.FSMetaConfig.Database)
 	viper.SetDefault("fsmeta.schema", globalConf.FSMetaConfig.Schema)
 	viper.SetDefault("fsmeta.host", globalConf.FSMetaConfig.Host)
@@ -935,6 +1048,9 @@ func setViperDefaults() {
 	viper.SetDefault("fsmeta.sslmode", globalConf.FSMetaConfig.SSLMode)
 	viper.SetDefault("fsmeta.pool_size", globalConf.FSMetaConfig.PoolSize)
 	viper.SetDefault("fsmeta.buckets", globalConf.FSMetaConfig.Buckets)
+	viper.SetDefault("fsmeta.cache_size", globalConf.FSMetaConfig.CacheSize)
+	viper.SetDefault("fsmeta.cache_ttl", globalConf.FSMetaConfig.CacheTTL)
+	viper.SetDefault("fsmeta.chtimes_copy_in_place", globalConf.FSMetaConfig.ChtimesCopyInPlace)
 }
 
 func lookupBoolFromEnv(envName string) (bool, bool) {
@@ -235,6 +235,7 @@ func TestCommonParamsCompatibility(t *testing.T) {
 	sftpdConf.UploadMode = common.UploadModeAtomicWithResume //nolint:staticcheck
 	sftpdConf.ProxyProtocol = 1                              //nolint:staticcheck
 	sftpdConf.ProxyAllowed = []string{"192.168.1.1"}         //nolint:staticcheck
+	sftpdConf.FolderPrefix = "/files"                        //nolint:staticcheck
 	c := make(map[string]sftpd.Configuration)
 	c["sftpd"] = sftpdConf
 	jsonConf, err := json.Marshal(c)
@@ -252,6 +253,7 @@ func TestCommonParamsCompatibility(t *testing.T) {
 	assert.Equal(t, 1, commonConf.ProxyProtocol)
 	assert.Len(t, commonConf.ProxyAllowed, 1)
 	assert.True(t, utils.IsStringInSlice("192.168.1.1", commonConf.ProxyAllowed))
+	assert.Equal(t, "/files", commonConf.FolderPrefix)
 	err = os.Remove(configFilePath)
 	assert.NoError(t, err)
 }
@@ -751,6 +753,47 @@ func TestHTTPClientCertificatesFromEnv(t *testing.T) {
 	require.Equal(t, "key9", config.GetHTTPConfig().Certificates[1].Key)
 }
 
+func TestActionSinksFromEnv(t *testing.T) {
+	reset()
+
+	os.Setenv("SFTPGO_COMMON__ACTIONS__SINKS__0__NAME", "uploads")
+	os.Setenv("SFTPGO_COMMON__ACTIONS__SINKS__0__URL", "nats://sftpgo.uploads")
+	os.Setenv("SFTPGO_COMMON__ACTIONS__SINKS__1__NAME", "all")
+	os.Setenv("SFTPGO_COMMON__ACTIONS__SINKS__1__URL", "kafka://sftpgo")
+	os.Setenv("SFTPGO_COMMON__ACTIONS__ROUTES__0__ACTIONS", "upload")
+	os.Setenv("SFTPGO_COMMON__ACTIONS__ROUTES__0__USERNAMES", "team_*, admin")
+	os.Setenv("SFTPGO_COMMON__ACTIONS__ROUTES__0__PATHS", "/incoming/**")
+	os.Setenv("SFTPGO_COMMON__ACTIONS__ROUTES__0__SINKS", "uploads,all")
+	os.Setenv("SFTPGO_COMMON__ACTIONS__ROUTES__1__SINKS", "all")
+	t.Cleanup(func() {
+		os.Unsetenv("SFTPGO_COMMON__ACTIONS__SINKS__0__NAME")
+		os.Unsetenv("SFTPGO_COMMON__ACTIONS__SINKS__0__URL")
+		os.Unsetenv("SFTPGO_COMMON__ACTIONS__SINKS__1__NAME")
+		os.Unsetenv("SFTPGO_COMMON__ACTIONS__SINKS__1__URL")
+		os.Unsetenv("SFTPGO_COMMON__ACTIONS__ROUTES__0__ACTIONS")
+		os.Unsetenv("SFTPGO_COMMON__ACTIONS__ROUTES__0__USERNAMES")
+		os.Unsetenv("SFTPGO_COMMON__ACTIONS__ROUTES__0__PATHS")
+		os.Unsetenv("SFTPGO_COMMON__ACTIONS__ROUTES__0__SINKS")
+		os.Unsetenv("SFTPGO_COMMON__ACTIONS__ROUTES__1__SINKS")
+	})
+
+	err := config.LoadConfig(".", "invalid config")
+	assert.NoError(t, err)
+	actions := config.GetCommonConfig().Actions
+	require.Len(t, actions.Sinks, 2)
+	assert.Equal(t, "uploads", actions.Sinks[0].Name)
+	assert.Equal(t, "nats://sftpgo.uploads", actions.Sinks[0].URL)
+	assert.Equal(t, "all", actions.Sinks[1].Name)
+	assert.Equal(t, "kafka://sftpgo", actions.Sinks[1].URL)
+	require.Len(t, actions.Routes, 2)
+	assert.Equal(t, []string{"upload"}, actions.Routes[0].Actions)
+	assert.Equal(t, []string{"team_*", "admin"}, actions.Routes[0].Usernames)
+	assert.Equal(t, []string{"/incoming/**"}, actions.Routes[0].Paths)
+	assert.Equal(t, []string{"uploads", "all"}, actions.Routes[0].Sinks)
+	assert.Len(t, actions.Routes[1].Actions, 0)
+	assert.Equal(t, []string{"all"}, actions.Routes[1].Sinks)
+}
+
 func TestConfigFromEnv(t *testing.T) {
 	reset()
 
@@ -805,6 +848,10 @@ func TestFSMetaFromEnv(t *testing.T) {
 	os.Setenv("SFTPGO_FSMETA__SSLMODE", "1")
 	os.Setenv("SFTPGO_FSMETA__POOL_SIZE", "3")
 	os.Setenv(`SFTPGO_FSMETA__BUCKETS`, `bucket1,bucket2`)
+	os.Setenv("SFTPGO_FSMETA__USE_DATA_PROVIDER", "true")
+	os.Setenv("SFTPGO_FSMETA__CACHE_SIZE", "500")
+	os.Setenv("SFTPGO_FSMETA__CACHE_TTL", "30")
+	os.Setenv("SFTPGO_FSMETA__CHTIMES_COPY_IN_PLACE", "true")
 
 	t.Cleanup(func() {
 		os.Unsetenv("SFTPGO_FSMETA__ENABLED")
@@ -817,6 +864,10 @@ func TestFSMetaFromEnv(t *testing.T) {
 		os.Unsetenv("SFTPGO_FSMETA__SSLMODE")
 		os.Unsetenv("SFTPGO_FSMETA__POOL_SIZE")
 		os.Unsetenv("SFTPGO_FSMETA__BUCKETS")
+		os.Unsetenv("SFTPGO_FSMETA__USE_DATA_PROVIDER")
+		os.Unsetenv("SFTPGO_FSMETA__CACHE_SIZE")
+		os.Unsetenv("SFTPGO_FSMETA__CACHE_TTL")
+		os.Unsetenv("SFTPGO_FSMETA__CHTIMES_COPY_IN_PLACE")
 	})
 
 	err := config.LoadConfig(".", "invalid config")
@@ -832,6 +883,10 @@ func TestFSMetaFromEnv(t *testing.T) {
 	assert.Equal(t, 1, fsMetaConfig.SSLMode)
 	assert.Equal(t, 3, fsMetaConfig.PoolSize)
 	assert.Equal(t, []string{`bucket1`, `bucket2`}, fsMetaConfig.Buckets)
+	assert.True(t, fsMetaConfig.UseDataProvider)
+	assert.Equal(t, 500, fsMetaConfig.CacheSize)
+	assert.Equal(t, 30, fsMetaConfig.CacheTTL)
+	assert.True(t, fsMetaConfig.ChtimesCopyInPlace)
 
 	extraValues := url.Values{}
 	extraValues.Set(`x-migrations-table`, `fsmeta_schema_migrations`)
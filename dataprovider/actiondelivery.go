@@ -0,0 +1,145 @@
+package dataprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/drakkan/sftpgo/utils"
+)
+
+// Supported statuses for the queued action notifications
+const (
+	// ActionDeliveryStatusPending defines a notification waiting to be delivered
+	ActionDeliveryStatusPending = iota + 1
+	// ActionDeliveryStatusFailed defines a notification not delivered within the
+	// max allowed attempts. Failed deliveries are only retried on request
+	ActionDeliveryStatusFailed
+)
+
+// ActionDelivery defines an action notification stored in the delivery queue.
+// The notification is stored as JSON, delivered notifications are removed
+type ActionDelivery struct {
+	ID           int64           `json:"id"`
+	Action       string          `json:"action"`
+	Username     string          `json:"username"`
+	Notification json.RawMessage `json:"notification"`
+	Status       int             `json:"status"`
+	Attempts     int             `json:"attempts"`
+	// next delivery attempt as unix timestamp in milliseconds
+	NextAttempt int64  `json:"next_attempt"`
+	LastError   string `json:"last_error,omitempty"`
+	// targets, the hook and the sinks, the notification was already delivered to,
+	// they are skipped by the next attempts
+	Delivered []string `json:"delivered,omitempty"`
+	CreatedAt int64    `json:"created_at"`
+	UpdatedAt int64    `json:"updated_at"`
+}
+
+func (d *ActionDelivery) getACopy() ActionDelivery {
+	notification := make([]byte, len(d.Notification))
+	copy(notification, d.Notification)
+	delivered := make([]string, len(d.Delivered))
+	copy(delivered, d.Delivered)
+	delivery := *d
+	delivery.Notification = notification
+	delivery.Delivered = delivered
+	return delivery
+}
+
+func (d *ActionDelivery) validate() error {
+	if d.Action == "" {
+		return &ValidationError{err: "action is mandatory"}
+	}
+	if !json.Valid(d.Notification) {
+		return &ValidationError{err: fmt.Sprintf("invalid notification for action %#v", d.Action)}
+	}
+	if d.Status != ActionDeliveryStatusPending && d.Status != ActionDeliveryStatusFailed {
+		return &ValidationError{err: fmt.Sprintf("invalid delivery status: %v", d.Status)}
+	}
+	return nil
+}
+
+// AddActionDelivery adds the given notification to the delivery queue
+func AddActionDelivery(delivery *ActionDelivery) error {
+	now := utils.GetTimeAsMsSinceEpoch(time.Now())
+	delivery.Status = ActionDeliveryStatusPending
+	delivery.Attempts = 0
+	delivery.CreatedAt = now
+	delivery.UpdatedAt = now
+	if delivery.NextAttempt == 0 {
+		delivery.NextAttempt = now
+	}
+	if err := delivery.validate(); err != nil {
+		return err
+	}
+	return provider.addActionDelivery(delivery)
+}
+
+// GetActionDeliveryByID returns the queued notification with the given id
+func GetActionDeliveryByID(id int64) (ActionDelivery, error) {
+	return provider.getActionDelivery(id)
+}
+
+// GetActionDeliveries returns the queued notifications respecting limit and offset.
+// A zero status returns the notifications with any status
+func GetActionDeliveries(status, limit, offset int, order string) ([]ActionDelivery, error) {
+	return provider.getActionDeliveries(status, limit, offset, order)
+}
+
+// GetDueActionDeliveries returns up to limit pending notifications ready to be delivered
+func GetDueActionDeliveries(limit int) ([]ActionDelivery, error) {
+	return provider.getDueActionDeliveries(utils.GetTimeAsMsSinceEpoch(time.Now()), limit)
+}
+
+// ClaimActionDelivery moves the next attempt for the given pending notification
+// to leaseUntil. It returns false if the notification was claimed by someone else
+// or is no longer pending, this way multiple instances can share the same queue.
+// If the claimer does not update the notification before leaseUntil it will be
+// delivered again
+func ClaimActionDelivery(delivery *ActionDelivery, leaseUntil int64) (bool, error) {
+	claimed, err := provider.claimActionDelivery(delivery.ID, delivery.NextAttempt, leaseUntil)
+	if err == nil && claimed {
+		delivery.NextAttempt = leaseUntil
+	}
+	return claimed, err
+}
+
+// UpdateActionDelivery updates the status, the attempts, the last error and the
+// delivered targets for the given queued notification
+func UpdateActionDelivery(delivery *ActionDelivery) error {
+	if err := delivery.validate(); err != nil {
+		return err
+	}
+	delivery.UpdatedAt = utils.GetTimeAsMsSinceEpoch(time.Now())
+	return provider.updateActionDelivery(delivery)
+}
+
+// DeleteActionDelivery removes the queued notification with the given id
+func DeleteActionDelivery(id int64) error {
+	return provider.deleteActionDelivery(id)
+}
+
+// RetryActionDelivery schedules the queued notification with the given id
+// for an immediate delivery and resets its attempts
+func RetryActionDelivery(id int64) error {
+	delivery, err := provider.getActionDelivery(id)
+	if err != nil {
+		return err
+	}
+	delivery.Status = ActionDeliveryStatusPending
+	delivery.Attempts = 0
+	delivery.NextAttempt = utils.GetTimeAsMsSinceEpoch(time.Now())
+	return UpdateActionDelivery(&delivery)
+}
+
+// RetryFailedActionDeliveries schedules all the failed notifications for an
+// immediate delivery and resets their attempts
+func RetryFailedActionDeliveries() error {
+	return provider.retryFailedActionDeliveries(utils.GetTimeAsMsSinceEpoch(time.Now()))
+}
+
+// PurgeFailedActionDeliveries removes all the failed notifications
+func PurgeFailedActionDeliveries() error {
+	return provider.purgeActionDeliveries(ActionDeliveryStatusFailed)
+}
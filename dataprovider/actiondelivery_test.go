@@ -0,0 +1,146 @@
+package dataprovider
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drakkan/sftpgo/utils"
+)
+
+func TestActionDeliveriesMemoryProvider(t *testing.T) {
+	providerRestore := provider
+	configRestore := config
+	t.Cleanup(func() {
+		provider = providerRestore
+		config = configRestore
+	})
+	config = Config{}
+	initializeMemoryProvider(t.TempDir())
+
+	checkActionDeliveries(t)
+}
+
+func TestActionDeliveriesBoltProvider(t *testing.T) {
+	providerRestore := provider
+	configRestore := config
+	t.Cleanup(func() {
+		provider = providerRestore
+		config = configRestore
+	})
+	config = Config{
+		Driver: BoltDataProviderName,
+		Name:   "sftpgo.db",
+	}
+	err := initializeBoltProvider(t.TempDir())
+	if err != nil {
+		t.Skipf("bolt provider not available: %v", err)
+	}
+	t.Cleanup(func() {
+		assert.NoError(t, provider.close())
+	})
+
+	checkActionDeliveries(t)
+}
+
+func checkActionDeliveries(t *testing.T) {
+	err := AddActionDelivery(&ActionDelivery{Action: "upload", Notification: json.RawMessage("{")})
+	assert.IsType(t, &ValidationError{}, err)
+	err = AddActionDelivery(&ActionDelivery{Notification: json.RawMessage("{}")})
+	assert.IsType(t, &ValidationError{}, err)
+
+	var ids []int64
+	for i := 0; i < 3; i++ {
+		delivery := ActionDelivery{
+			Action:       "upload",
+			Username:     "user",
+			Notification: json.RawMessage(`{"action":"upload"}`),
+		}
+		require.NoError(t, AddActionDelivery(&delivery))
+		assert.Greater(t, delivery.ID, int64(0))
+		assert.Equal(t, ActionDeliveryStatusPending, delivery.Status)
+		ids = append(ids, delivery.ID)
+	}
+	assert.Less(t, ids[0], ids[1])
+	assert.Less(t, ids[1], ids[2])
+
+	delivery, err := GetActionDeliveryByID(ids[0])
+	require.NoError(t, err)
+	assert.Equal(t, "user", delivery.Username)
+	assert.JSONEq(t, `{"action":"upload"}`, string(delivery.Notification))
+	_, err = GetActionDeliveryByID(ids[2] + 100)
+	assert.IsType(t, &RecordNotFoundError{}, err)
+
+	due, err := GetDueActionDeliveries(10)
+	require.NoError(t, err)
+	assert.Len(t, due, 3)
+
+	// a claimed delivery is not due until the lease expires and cannot be claimed again
+	leaseUntil := utils.GetTimeAsMsSinceEpoch(time.Now().Add(time.Hour))
+	claimed, err := ClaimActionDelivery(&due[0], leaseUntil)
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	assert.Equal(t, leaseUntil, due[0].NextAttempt)
+	stale := delivery
+	claimed, err = ClaimActionDelivery(&stale, leaseUntil+1)
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	due, err = GetDueActionDeliveries(10)
+	require.NoError(t, err)
+	assert.Len(t, due, 2)
+
+	delivery.Status = ActionDeliveryStatusFailed
+	delivery.Attempts = 5
+	delivery.LastError = "unexpected HTTP response code"
+	delivery.Delivered = []string{"sink:amqp"}
+	require.NoError(t, UpdateActionDelivery(&delivery))
+	delivery, err = GetActionDeliveryByID(ids[0])
+	require.NoError(t, err)
+	assert.Equal(t, ActionDeliveryStatusFailed, delivery.Status)
+	assert.Equal(t, 5, delivery.Attempts)
+	assert.Equal(t, "unexpected HTTP response code", delivery.LastError)
+	assert.Equal(t, []string{"sink:amqp"}, delivery.Delivered)
+
+	deliveries, err := GetActionDeliveries(ActionDeliveryStatusFailed, 10, 0, OrderASC)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, ids[0], deliveries[0].ID)
+	deliveries, err = GetActionDeliveries(0, 10, 0, OrderDESC)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 3)
+	assert.Equal(t, ids[2], deliveries[0].ID)
+	deliveries, err = GetActionDeliveries(ActionDeliveryStatusPending, 1, 1, OrderASC)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, ids[2], deliveries[0].ID)
+
+	require.NoError(t, RetryFailedActionDeliveries())
+	delivery, err = GetActionDeliveryByID(ids[0])
+	require.NoError(t, err)
+	assert.Equal(t, ActionDeliveryStatusPending, delivery.Status)
+	assert.Equal(t, 0, delivery.Attempts)
+
+	delivery.Status = ActionDeliveryStatusFailed
+	require.NoError(t, UpdateActionDelivery(&delivery))
+	require.NoError(t, RetryActionDelivery(ids[0]))
+	delivery, err = GetActionDeliveryByID(ids[0])
+	require.NoError(t, err)
+	assert.Equal(t, ActionDeliveryStatusPending, delivery.Status)
+	assert.IsType(t, &RecordNotFoundError{}, RetryActionDelivery(ids[2]+100))
+
+	delivery.Status = ActionDeliveryStatusFailed
+	require.NoError(t, UpdateActionDelivery(&delivery))
+	require.NoError(t, PurgeFailedActionDeliveries())
+	_, err = GetActionDeliveryByID(ids[0])
+	assert.IsType(t, &RecordNotFoundError{}, err)
+
+	require.NoError(t, DeleteActionDelivery(ids[1]))
+	assert.IsType(t, &RecordNotFoundError{}, DeleteActionDelivery(ids[1]))
+	deliveries, err = GetActionDeliveries(0, 10, 0, OrderASC)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, ids[2], deliveries[0].ID)
+}
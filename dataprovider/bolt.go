@@ -4,6 +4,8 @@
 package dataprovider
 
 import (
+	"bytes"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -23,11 +25,13 @@ const (
 )
 
 var (
-	usersBucket     = []byte("users")
-	foldersBucket   = []byte("folders")
-	adminsBucket    = []byte("admins")
-	dbVersionBucket = []byte("db_version")
-	dbVersionKey    = []byte("version")
+	usersBucket            = []byte("users")
+	foldersBucket          = []byte("folders")
+	adminsBucket           = []byte("admins")
+	multipartUploadsBucket = []byte("multipart_uploads")
+	actionDeliveriesBucket = []byte("action_deliveries")
+	dbVersionBucket        = []byte("db_version")
+	dbVersionKey           = []byte("version")
 )
 
 // BoltProvider auth provider for bolt key/value store
@@ -83,6 +87,22 @@ func initializeBoltProvider(basePath string) error {
 			providerLog(logger.LevelWarn, "error creating admins bucket: %v", err)
 			return err
 		}
+		err = dbHandle.Update(func(tx *bolt.Tx) error {
+			_, e := tx.CreateBucketIfNotExists(multipartUploadsBucket)
+			return e
+		})
+		if err != nil {
+			providerLog(logger.LevelWarn, "error creating multipart uploads bucket: %v", err)
+			return err
+		}
+		err = dbHandle.Update(func(tx *bolt.Tx) error {
+			_, e := tx.CreateBucketIfNotExists(actionDeliveriesBucket)
+			return e
+		})
+		if err != nil {
+			providerLog(logger.LevelWarn, "error creating action deliveries bucket: %v", err)
+			return err
+		}
 		err = dbHandle.Update(func(tx *bolt.Tx) error {
 			_, e := tx.CreateBucketIfNotExists(dbVersionBucket)
 			return e
@@ -301,6 +321,324 @@ func (p *BoltProvider) deleteAdmin(admin *Admin) error {
 	})
 }
 
+func (p *BoltProvider) getMultipartUpload(username, name string) (vfs.MultipartUpload, error) {
+	var upload MultipartUpload
+
+	err := p.dbHandle.View(func(tx *bolt.Tx) error {
+		bucket, err := getMultipartUploadsBucket(tx)
+		if err != nil {
+			return err
+		}
+		u := bucket.Get(getMultipartUploadKey(username, name))
+		if u == nil {
+			return &RecordNotFoundError{err: fmt.Sprintf("multipart upload %#v for user %v does not exist", name, username)}
+		}
+		return json.Unmarshal(u, &upload)
+	})
+
+	return upload.MultipartUpload, err
+}
+
+func (p *BoltProvider) saveMultipartUpload(username string, upload *vfs.MultipartUpload) error {
+	return p.dbHandle.Update(func(tx *bolt.Tx) error {
+		bucket, err := getMultipartUploadsBucket(tx)
+		if err != nil {
+			return err
+		}
+		buf, err := json.Marshal(MultipartUpload{
+			Username:        username,
+			MultipartUpload: *upload,
+		})
+		if err != nil {
+			return err
+		}
+		return bucket.Put(getMultipartUploadKey(username, upload.Name), buf)
+	})
+}
+
+func (p *BoltProvider) deleteMultipartUpload(username, name string) error {
+	return p.dbHandle.Update(func(tx *bolt.Tx) error {
+		bucket, err := getMultipartUploadsBucket(tx)
+		if err != nil {
+			return err
+		}
+		return bucket.Delete(getMultipartUploadKey(username, name))
+	})
+}
+
+func (p *BoltProvider) getExpiredMultipartUploads(updatedBefore int64, limit int) ([]MultipartUpload, error) {
+	uploads := make([]MultipartUpload, 0, limit)
+
+	err := p.dbHandle.View(func(tx *bolt.Tx) error {
+		bucket, err := getMultipartUploadsBucket(tx)
+		if err != nil {
+			return err
+		}
+		cursor := bucket.Cursor()
+		for k, v := cursor.First(); k != nil && len(uploads) < limit; k, v = cursor.Next() {
+			var upload MultipartUpload
+			if err := json.Unmarshal(v, &upload); err != nil {
+				return err
+			}
+			if upload.UpdatedAt < updatedBefore {
+				uploads = append(uploads, upload)
+			}
+		}
+		return nil
+	})
+
+	return uploads, err
+}
+
+func (p *BoltProvider) getUserMultipartUploads(username string) ([]MultipartUpload, error) {
+	var uploads []MultipartUpload
+
+	err := p.dbHandle.View(func(tx *bolt.Tx) error {
+		bucket, err := getMultipartUploadsBucket(tx)
+		if err != nil {
+			return err
+		}
+		prefix := getMultipartUploadKey(username, "")
+		cursor := bucket.Cursor()
+		for k, v := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = cursor.Next() {
+			var upload MultipartUpload
+			if err := json.Unmarshal(v, &upload); err != nil {
+				return err
+			}
+			uploads = append(uploads, upload)
+		}
+		return nil
+	})
+
+	return uploads, err
+}
+
+func (p *BoltProvider) addActionDelivery(delivery *ActionDelivery) error {
+	return p.dbHandle.Update(func(tx *bolt.Tx) error {
+		bucket, err := getActionDeliveriesBucket(tx)
+		if err != nil {
+			return err
+		}
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		delivery.ID = int64(id)
+		buf, err := json.Marshal(delivery)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(getActionDeliveryKey(delivery.ID), buf)
+	})
+}
+
+func (p *BoltProvider) getActionDelivery(id int64) (ActionDelivery, error) {
+	var delivery ActionDelivery
+
+	err := p.dbHandle.View(func(tx *bolt.Tx) error {
+		bucket, err := getActionDeliveriesBucket(tx)
+		if err != nil {
+			return err
+		}
+		d := bucket.Get(getActionDeliveryKey(id))
+		if d == nil {
+			return &RecordNotFoundError{err: fmt.Sprintf("action delivery %v does not exist", id)}
+		}
+		return json.Unmarshal(d, &delivery)
+	})
+
+	return delivery, err
+}
+
+func (p *BoltProvider) getActionDeliveries(status, limit, offset int, order string) ([]ActionDelivery, error) {
+	deliveries := make([]ActionDelivery, 0, limit)
+
+	err := p.dbHandle.View(func(tx *bolt.Tx) error {
+		bucket, err := getActionDeliveriesBucket(tx)
+		if err != nil {
+			return err
+		}
+		cursor := bucket.Cursor()
+		first, next := cursor.First, cursor.Next
+		if order != OrderASC {
+			first, next = cursor.Last, cursor.Prev
+		}
+		itNum := 0
+		for k, v := first(); k != nil && len(deliveries) < limit; k, v = next() {
+			var delivery ActionDelivery
+			if err := json.Unmarshal(v, &delivery); err != nil {
+				return err
+			}
+			if status != 0 && delivery.Status != status {
+				continue
+			}
+			itNum++
+			if itNum <= offset {
+				continue
+			}
+			deliveries = append(deliveries, delivery)
+		}
+		return nil
+	})
+
+	return deliveries, err
+}
+
+func (p *BoltProvider) getDueActionDeliveries(nextAttemptBefore int64, limit int) ([]ActionDelivery, error) {
+	deliveries := make([]ActionDelivery, 0, limit)
+
+	err := p.dbHandle.View(func(tx *bolt.Tx) error {
+		bucket, err := getActionDeliveriesBucket(tx)
+		if err != nil {
+			return err
+		}
+		cursor := bucket.Cursor()
+		for k, v := cursor.First(); k != nil && len(deliveries) < limit; k, v = cursor.Next() {
+			var delivery ActionDelivery
+			if err := json.Unmarshal(v, &delivery); err != nil {
+				return err
+			}
+			if delivery.Status == ActionDeliveryStatusPending && delivery.NextAttempt <= nextAttemptBefore {
+				deliveries = append(deliveries, delivery)
+			}
+		}
+		return nil
+	})
+
+	return deliveries, err
+}
+
+func (p *BoltProvider) claimActionDelivery(id, nextAttempt, leaseUntil int64) (bool, error) {
+	claimed := false
+
+	err := p.dbHandle.Update(func(tx *bolt.Tx) error {
+		bucket, err := getActionDeliveriesBucket(tx)
+		if err != nil {
+			return err
+		}
+		d := bucket.Get(getActionDeliveryKey(id))
+		if d == nil {
+			return nil
+		}
+		var delivery ActionDelivery
+		if err := json.Unmarshal(d, &delivery); err != nil {
+			return err
+		}
+		if delivery.Status != ActionDeliveryStatusPending || delivery.NextAttempt != nextAttempt {
+			return nil
+		}
+		delivery.NextAttempt = leaseUntil
+		buf, err := json.Marshal(delivery)
+		if err != nil {
+			return err
+		}
+		claimed = true
+		return bucket.Put(getActionDeliveryKey(id), buf)
+	})
+
+	return claimed && err == nil, err
+}
+
+func (p *BoltProvider) updateActionDelivery(delivery *ActionDelivery) error {
+	return p.dbHandle.Update(func(tx *bolt.Tx) error {
+		bucket, err := getActionDeliveriesBucket(tx)
+		if err != nil {
+			return err
+		}
+		d := bucket.Get(getActionDeliveryKey(delivery.ID))
+		if d == nil {
+			return &RecordNotFoundError{err: fmt.Sprintf("action delivery %v does not exist", delivery.ID)}
+		}
+		var stored ActionDelivery
+		if err := json.Unmarshal(d, &stored); err != nil {
+			return err
+		}
+		stored.Status = delivery.Status
+		stored.Attempts = delivery.Attempts
+		stored.NextAttempt = delivery.NextAttempt
+		stored.LastError = delivery.LastError
+		stored.Delivered = append([]string(nil), delivery.Delivered...)
+		stored.UpdatedAt = delivery.UpdatedAt
+		buf, err := json.Marshal(stored)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(getActionDeliveryKey(delivery.ID), buf)
+	})
+}
+
+func (p *BoltProvider) deleteActionDelivery(id int64) error {
+	return p.dbHandle.Update(func(tx *bolt.Tx) error {
+		bucket, err := getActionDeliveriesBucket(tx)
+		if err != nil {
+			return err
+		}
+		if bucket.Get(getActionDeliveryKey(id)) == nil {
+			return &RecordNotFoundError{err: fmt.Sprintf("action delivery %v does not exist", id)}
+		}
+		return bucket.Delete(getActionDeliveryKey(id))
+	})
+}
+
+func (p *BoltProvider) retryFailedActionDeliveries(nextAttempt int64) error {
+	return p.dbHandle.Update(func(tx *bolt.Tx) error {
+		bucket, err := getActionDeliveriesBucket(tx)
+		if err != nil {
+			return err
+		}
+		updatedAt := utils.GetTimeAsMsSinceEpoch(time.Now())
+		cursor := bucket.Cursor()
+		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+			var delivery ActionDelivery
+			if err := json.Unmarshal(v, &delivery); err != nil {
+				return err
+			}
+			if delivery.Status != ActionDeliveryStatusFailed {
+				continue
+			}
+			delivery.Status = ActionDeliveryStatusPending
+			delivery.Attempts = 0
+			delivery.NextAttempt = nextAttempt
+			delivery.UpdatedAt = updatedAt
+			buf, err := json.Marshal(delivery)
+			if err != nil {
+				return err
+			}
+			// replacing the value for the current key is safe while iterating
+			if err := bucket.Put(k, buf); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (p *BoltProvider) purgeActionDeliveries(status int) error {
+	return p.dbHandle.Update(func(tx *bolt.Tx) error {
+		bucket, err := getActionDeliveriesBucket(tx)
+		if err != nil {
+			return err
+		}
+		var keys [][]byte
+		cursor := bucket.Cursor()
+		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+			var delivery ActionDelivery
+			if err := json.Unmarshal(v, &delivery); err != nil {
+				return err
+			}
+			if delivery.Status == status {
+				keys = append(keys, k)
+			}
+		}
+		for _, k := range keys {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func (p *BoltProvider) getAdmins(limit int, offset int, order string) ([]Admin, error) {
 	admins := make([]Admin, 0, limit)
 
@@ -1068,6 +1406,34 @@ func updateV4BoltUser(dbHandle *bolt.DB, user User) error {
 	})
 }
 
+func getMultipartUploadsBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	var err error
+
+	bucket := tx.Bucket(multipartUploadsBucket)
+	if bucket == nil {
+		err = errors.New("unable to find multipart uploads bucket, bolt database structure not correcly defined")
+	}
+	return bucket, err
+}
+
+func getActionDeliveriesBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
+	var err error
+
+	bucket := tx.Bucket(actionDeliveriesBucket)
+	if bucket == nil {
+		err = errors.New("unable to find action deliveries bucket, bolt database structure not correcly defined")
+	}
+	return bucket, err
+}
+
+// getActionDeliveryKey returns the key for the given id, big endian
+// encoding keeps the keys sorted by id
+func getActionDeliveryKey(id int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(id))
+	return key
+}
+
 func getAdminBucket(tx *bolt.Tx) (*bolt.Bucket, error) {
 	var err error
 
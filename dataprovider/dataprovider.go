@@ -113,21 +113,23 @@ var (
 	sqlPlaceholders       []string
 	hashPwdPrefixes       = []string{argonPwdPrefix, bcryptPwdPrefix, pbkdf2SHA1Prefix, pbkdf2SHA256Prefix,
 		pbkdf2SHA512Prefix, pbkdf2SHA256B64SaltPrefix, md5cryptPwdPrefix, md5cryptApr1PwdPrefix, sha512cryptPwdPrefix}
-	pbkdfPwdPrefixes        = []string{pbkdf2SHA1Prefix, pbkdf2SHA256Prefix, pbkdf2SHA512Prefix, pbkdf2SHA256B64SaltPrefix}
-	pbkdfPwdB64SaltPrefixes = []string{pbkdf2SHA256B64SaltPrefix}
-	unixPwdPrefixes         = []string{md5cryptPwdPrefix, md5cryptApr1PwdPrefix, sha512cryptPwdPrefix}
-	logSender               = "dataProvider"
-	availabilityTicker      *time.Ticker
-	availabilityTickerDone  chan bool
-	credentialsDirPath      string
-	sqlTableUsers           = "users"
-	sqlTableFolders         = "folders"
-	sqlTableFoldersMapping  = "folders_mapping"
-	sqlTableAdmins          = "admins"
-	sqlTableSchemaVersion   = "schema_version"
-	argon2Params            *argon2id.Params
-	lastLoginMinDelay       = 10 * time.Minute
-	usernameRegex           = regexp.MustCompile("^[a-zA-Z0-9-_.~]+$")
+	pbkdfPwdPrefixes         = []string{pbkdf2SHA1Prefix, pbkdf2SHA256Prefix, pbkdf2SHA512Prefix, pbkdf2SHA256B64SaltPrefix}
+	pbkdfPwdB64SaltPrefixes  = []string{pbkdf2SHA256B64SaltPrefix}
+	unixPwdPrefixes          = []string{md5cryptPwdPrefix, md5cryptApr1PwdPrefix, sha512cryptPwdPrefix}
+	logSender                = "dataProvider"
+	availabilityTicker       *time.Ticker
+	availabilityTickerDone   chan bool
+	credentialsDirPath       string
+	sqlTableUsers            = "users"
+	sqlTableFolders          = "folders"
+	sqlTableFoldersMapping   = "folders_mapping"
+	sqlTableAdmins           = "admins"
+	sqlTableSchemaVersion    = "schema_version"
+	sqlTableMultipartUploads = "multipart_uploads"
+	sqlTableActionDeliveries = "action_deliveries"
+	argon2Params             *argon2id.Params
+	lastLoginMinDelay        = 10 * time.Minute
+	usernameRegex            = regexp.MustCompile("^[a-zA-Z0-9-_.~]+$")
 )
 
 type schemaVersion struct {
@@ -275,6 +277,9 @@ type Config struct {
 	// folder name. These keys are used in URIs for REST API and Web admin. By default only unreserved URI
 	// characters are allowed: ALPHA / DIGIT / "-" / "." / "_" / "~".
 	SkipNaturalKeysValidation bool `json:"skip_natural_keys_validation" mapstructure:"skip_natural_keys_validation"`
+	// ResumableUploads defines the configuration for resuming interrupted uploads to
+	// S3, Google Cloud Storage and Azure Blob storage
+	ResumableUploads ResumableUploadsConfig `json:"resumable_uploads" mapstructure:"resumable_uploads"`
 }
 
 // BackupData defines the structure for the backup/restore files
@@ -450,6 +455,20 @@ type Provider interface {
 	getAdmins(limit int, offset int, order string) ([]Admin, error)
 	dumpAdmins() ([]Admin, error)
 	validateAdminAndPass(username, password, ip string) (Admin, error)
+	getMultipartUpload(username, name string) (vfs.MultipartUpload, error)
+	saveMultipartUpload(username string, upload *vfs.MultipartUpload) error
+	deleteMultipartUpload(username, name string) error
+	getExpiredMultipartUploads(updatedBefore int64, limit int) ([]MultipartUpload, error)
+	getUserMultipartUploads(username string) ([]MultipartUpload, error)
+	addActionDelivery(delivery *ActionDelivery) error
+	getActionDelivery(id int64) (ActionDelivery, error)
+	getActionDeliveries(status, limit, offset int, order string) ([]ActionDelivery, error)
+	getDueActionDeliveries(nextAttemptBefore int64, limit int) ([]ActionDelivery, error)
+	claimActionDelivery(id, nextAttempt, leaseUntil int64) (bool, error)
+	updateActionDelivery(delivery *ActionDelivery) error
+	deleteActionDelivery(id int64) error
+	retryFailedActionDeliveries(nextAttempt int64) error
+	purgeActionDeliveries(status int) error
 	checkAvailability() error
 	close() error
 	reloadConfig() error
@@ -510,6 +529,7 @@ func Initialize(cnf Config, basePath string, checkAdmins bool) error {
 		providerLog(logger.LevelInfo, "database initialization/migration skipped, manual mode is configured")
 	}
 	startAvailabilityTimer()
+	startMultipartUploadsJanitor()
 	return nil
 }
 
@@ -554,6 +574,8 @@ func validateSQLTablesPrefix() error {
 		sqlTableFoldersMapping = config.SQLTablesPrefix + sqlTableFoldersMapping
 		sqlTableAdmins = config.SQLTablesPrefix + sqlTableAdmins
 		sqlTableSchemaVersion = config.SQLTablesPrefix + sqlTableSchemaVersion
+		sqlTableMultipartUploads = config.SQLTablesPrefix + sqlTableMultipartUploads
+		sqlTableActionDeliveries = config.SQLTablesPrefix + sqlTableActionDeliveries
 		providerLog(logger.LevelDebug, "sql table for users %#v, folders %#v folders mapping %#v admins %#v schema version %#v",
 			sqlTableUsers, sqlTableFolders, sqlTableFoldersMapping, sqlTableAdmins, sqlTableSchemaVersion)
 	}
@@ -774,8 +796,16 @@ func AddUser(user *User) error {
 
 // UpdateUser updates an existing SFTPGo user.
 func UpdateUser(user *User) error {
+	var oldUser User
+	var errOldUser error
+	if config.ResumableUploads.Enabled {
+		oldUser, errOldUser = provider.userExists(user.Username)
+	}
 	err := provider.updateUser(user)
 	if err == nil {
+		if config.ResumableUploads.Enabled && errOldUser == nil && !oldUser.hasSameCloudStorage(user) {
+			abortUserMultipartUploads(&oldUser)
+		}
 		RemoveCachedWebDAVUser(user.Username)
 		executeAction(operationUpdate, user)
 	}
@@ -788,6 +818,9 @@ func DeleteUser(username string) error {
 	if err != nil {
 		return err
 	}
+	if config.ResumableUploads.Enabled {
+		abortUserMultipartUploads(&user)
+	}
 	err = provider.deleteUser(&user)
 	if err == nil {
 		RemoveCachedWebDAVUser(user.Username)
@@ -917,6 +950,7 @@ func Close() error {
 		availabilityTickerDone <- true
 		availabilityTicker = nil
 	}
+	stopMultipartUploadsJanitor()
 	return provider.close()
 }
 
@@ -1209,6 +1243,70 @@ func validateFileFilters(user *User) error {
 	return validateFiltersPatternExtensions(user)
 }
 
+func validateFolderPrefix(user *User) error {
+	if user.Filters.FolderPrefix == "" {
+		return nil
+	}
+	cleanedPrefix := filepath.ToSlash(path.Clean(user.Filters.FolderPrefix))
+	if !path.IsAbs(cleanedPrefix) {
+		return &ValidationError{err: fmt.Sprintf("invalid folder prefix %#v, it must be an absolute path",
+			user.Filters.FolderPrefix)}
+	}
+	user.Filters.FolderPrefix = cleanedPrefix
+	return nil
+}
+
+func validateFolderMappings(user *User) error {
+	if len(user.Filters.FolderMappings) == 0 {
+		user.Filters.FolderMappings = nil
+		return nil
+	}
+	var mappings []FolderMapping
+	for _, m := range user.Filters.FolderMappings {
+		cleanedPrefix := filepath.ToSlash(path.Clean(m.Prefix))
+		if !path.IsAbs(cleanedPrefix) {
+			return &ValidationError{err: fmt.Sprintf("invalid folder mapping prefix %#v, it must be an absolute path",
+				m.Prefix)}
+		}
+		cleanedPath := filepath.ToSlash(path.Clean(m.MappedPath))
+		if !path.IsAbs(cleanedPath) {
+			return &ValidationError{err: fmt.Sprintf("invalid mapped path %#v for folder mapping %#v, it must be an absolute path",
+				m.MappedPath, m.Prefix)}
+		}
+		for _, existing := range mappings {
+			if existing.Prefix == "/" || cleanedPrefix == "/" || isVirtualDirOverlapped(existing.Prefix, cleanedPrefix) {
+				return &ValidationError{err: fmt.Sprintf("folder mapping prefix %#v overlaps with %#v",
+					m.Prefix, existing.Prefix)}
+			}
+		}
+		mappings = append(mappings, FolderMapping{
+			Prefix:     cleanedPrefix,
+			MappedPath: cleanedPath,
+		})
+	}
+	if user.Filters.FolderPrefix != "" {
+		return &ValidationError{err: "folder prefix and folder mappings cannot be used together"}
+	}
+	user.Filters.FolderMappings = mappings
+	return nil
+}
+
+func validateLoginDir(user *User) error {
+	if user.Filters.LoginDir == "" {
+		return nil
+	}
+	cleanedDir := filepath.ToSlash(path.Clean(user.Filters.LoginDir))
+	if !path.IsAbs(cleanedDir) {
+		return &ValidationError{err: fmt.Sprintf("invalid login dir %#v, it must be an absolute path",
+			user.Filters.LoginDir)}
+	}
+	if cleanedDir == "/" {
+		cleanedDir = ""
+	}
+	user.Filters.LoginDir = cleanedDir
+	return nil
+}
+
 func validateFilters(user *User) error {
 	if len(user.Filters.AllowedIP) == 0 {
 		user.Filters.AllowedIP = []string{}
@@ -1250,6 +1348,15 @@ func validateFilters(user *User) error {
 			return &ValidationError{err: fmt.Sprintf("invalid protocol: %#v", p)}
 		}
 	}
+	if err := validateFolderPrefix(user); err != nil {
+		return err
+	}
+	if err := validateFolderMappings(user); err != nil {
+		return err
+	}
+	if err := validateLoginDir(user); err != nil {
+		return err
+	}
 	return validateFileFilters(user)
 }
 
@@ -0,0 +1,65 @@
+package dataprovider
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/drakkan/sftpgo/fsmeta"
+)
+
+// sqlHandleProvider is implemented by the SQL based providers, it allows
+// to store the fsmeta tables inside the data provider database
+type sqlHandleProvider interface {
+	getSQLHandle() (*sql.DB, string)
+}
+
+func getFSMetaSharedDatabase() (fsmeta.SharedDatabase, error) {
+	if provider == nil {
+		return fsmeta.SharedDatabase{}, errors.New("data provider not initialized")
+	}
+	p, ok := provider.(sqlHandleProvider)
+	if !ok {
+		return fsmeta.SharedDatabase{}, fmt.Errorf("fsmeta tables cannot be stored inside the %#v data provider",
+			config.Driver)
+	}
+	dbHandle, connectionString := p.getSQLHandle()
+	return fsmeta.SharedDatabase{
+		Driver:           config.Driver,
+		TablesPrefix:     config.SQLTablesPrefix,
+		DB:               dbHandle,
+		ConnectionString: connectionString,
+	}, nil
+}
+
+// InitializeFSMeta initializes fsmeta to store its tables inside the data provider
+// database, sharing the connection pool and the SQL tables prefix.
+// The fsmeta tables are created/updated if the update mode is 0
+func InitializeFSMeta(cnf fsmeta.Config) error {
+	if !cnf.Enabled {
+		return fsmeta.InitializeShared(cnf, fsmeta.SharedDatabase{}, false)
+	}
+	shared, err := getFSMetaSharedDatabase()
+	if err != nil {
+		return err
+	}
+	return fsmeta.InitializeShared(cnf, shared, config.UpdateMode == 0)
+}
+
+// InitializeFSMetaDatabase creates and/or updates the fsmeta tables inside the data provider database
+func InitializeFSMetaDatabase() error {
+	shared, err := getFSMetaSharedDatabase()
+	if err != nil {
+		return err
+	}
+	return fsmeta.MigrateShared(shared)
+}
+
+// RevertFSMetaDatabase removes the fsmeta tables from the data provider database
+func RevertFSMetaDatabase() error {
+	shared, err := getFSMetaSharedDatabase()
+	if err != nil {
+		return err
+	}
+	return fsmeta.RevertShared(shared)
+}
@@ -0,0 +1,89 @@
+//go:build !nomysql
+// +build !nomysql
+
+package dataprovider
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drakkan/sftpgo/fsmeta"
+)
+
+type fsMetaTestStore struct{}
+
+func (fsMetaTestStore) Location() string {
+	return "s3://sftpgo-shared"
+}
+
+func (fsMetaTestStore) Get(_ context.Context, key fsmeta.Key) (fsmeta.Meta, error) {
+	return fsmeta.Meta{Key: key}, errors.New("not found")
+}
+
+// TestFSMetaSharedMySQL stores the fsmeta tables inside the MySQL data provider
+// database, it runs only if the test cases are executed against a MySQL provider
+func TestFSMetaSharedMySQL(t *testing.T) {
+	if os.Getenv("SFTPGO_DATA_PROVIDER__DRIVER") != MySQLDataProviderName {
+		t.Skip("this test requires a MySQL data provider")
+	}
+	providerRestore := provider
+	configRestore := config
+	t.Cleanup(func() {
+		provider = providerRestore
+		config = configRestore
+	})
+	port, err := strconv.Atoi(os.Getenv("SFTPGO_DATA_PROVIDER__PORT"))
+	require.NoError(t, err)
+	config = Config{
+		Driver:          MySQLDataProviderName,
+		Name:            os.Getenv("SFTPGO_DATA_PROVIDER__NAME"),
+		Host:            os.Getenv("SFTPGO_DATA_PROVIDER__HOST"),
+		Port:            port,
+		Username:        os.Getenv("SFTPGO_DATA_PROVIDER__USERNAME"),
+		Password:        os.Getenv("SFTPGO_DATA_PROVIDER__PASSWORD"),
+		SQLTablesPrefix: "shared_",
+	}
+	require.NoError(t, initializeMySQLProvider())
+	t.Cleanup(func() {
+		assert.NoError(t, provider.close())
+	})
+	require.NoError(t, InitializeFSMeta(fsmeta.Config{Enabled: true, UseDataProvider: true}))
+	t.Cleanup(func() {
+		assert.NoError(t, RevertFSMetaDatabase())
+		assert.NoError(t, InitializeFSMeta(fsmeta.Config{}))
+	})
+
+	ctx := context.Background()
+	metaProvider := fsmeta.DefaultFactory.New(fsMetaTestStore{})
+	key := fsmeta.Key{
+		Path:      "users/test1/a.csv",
+		ETag:      "etag-a",
+		StoreTime: time.Date(2021, time.March, 2, 10, 0, 0, 123456000, time.UTC),
+		Size:      10,
+	}
+	modified := time.Date(2021, time.March, 1, 8, 30, 0, 654321000, time.UTC)
+	require.NoError(t, metaProvider.Put(ctx, fsmeta.Meta{Key: key, LastModified: modified}))
+	// the datetime columns are scanned by the preload, the get and the scan queries
+	require.NoError(t, metaProvider.Preload(ctx, "users/test1/"))
+	meta, err := metaProvider.Get(ctx, key)
+	require.NoError(t, err)
+	assert.True(t, meta.LastModified.Equal(modified), "unexpected modification time %v", meta.LastModified)
+	var scanned []fsmeta.Meta
+	err = metaProvider.Scan(ctx, "users/test1/", func(m fsmeta.Meta) error {
+		scanned = append(scanned, m)
+		return nil
+	})
+	require.NoError(t, err)
+	if assert.Len(t, scanned, 1) {
+		assert.True(t, scanned[0].Key.StoreTime.Equal(key.StoreTime))
+		assert.True(t, scanned[0].LastModified.Equal(modified))
+	}
+	require.NoError(t, metaProvider.Delete(ctx, "users/test1/"))
+}
@@ -36,6 +36,14 @@ type memoryProviderHandle struct {
 	admins map[string]Admin
 	// slice with ordered admins
 	adminsUsernames []string
+	// map for the in-progress multipart uploads, username and path are the key
+	multipartUploads map[string]MultipartUpload
+	// map for the queued action notifications, the id is the key
+	actionDeliveries map[int64]ActionDelivery
+	// slice with ordered action notifications ids
+	actionDeliveriesIDs []int64
+	// last assigned action notification id
+	lastActionDeliveryID int64
 }
 
 // MemoryProvider auth provider for a memory store
@@ -54,14 +62,16 @@ func initializeMemoryProvider(basePath string) {
 	}
 	provider = &MemoryProvider{
 		dbHandle: &memoryProviderHandle{
-			isClosed:        false,
-			usernames:       []string{},
-			users:           make(map[string]User),
-			vfolders:        make(map[string]vfs.BaseVirtualFolder),
-			vfoldersNames:   []string{},
-			admins:          make(map[string]Admin),
-			adminsUsernames: []string{},
-			configFile:      configFile,
+			isClosed:         false,
+			usernames:        []string{},
+			users:            make(map[string]User),
+			vfolders:         make(map[string]vfs.BaseVirtualFolder),
+			vfoldersNames:    []string{},
+			admins:           make(map[string]Admin),
+			adminsUsernames:  []string{},
+			multipartUploads: make(map[string]MultipartUpload),
+			actionDeliveries: make(map[int64]ActionDelivery),
+			configFile:       configFile,
 		},
 	}
 	if err := provider.reloadConfig(); err != nil {
@@ -419,6 +429,243 @@ func (p *MemoryProvider) deleteAdmin(admin *Admin) error {
 	return nil
 }
 
+func (p *MemoryProvider) getMultipartUpload(username, name string) (vfs.MultipartUpload, error) {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return vfs.MultipartUpload{}, errMemoryProviderClosed
+	}
+	if val, ok := p.dbHandle.multipartUploads[string(getMultipartUploadKey(username, name))]; ok {
+		return val.getACopy().MultipartUpload, nil
+	}
+	return vfs.MultipartUpload{}, &RecordNotFoundError{err: fmt.Sprintf("multipart upload %#v for user %#v does not exist",
+		name, username)}
+}
+
+func (p *MemoryProvider) saveMultipartUpload(username string, upload *vfs.MultipartUpload) error {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return errMemoryProviderClosed
+	}
+	u := MultipartUpload{
+		Username:        username,
+		MultipartUpload: *upload,
+	}
+	p.dbHandle.multipartUploads[string(getMultipartUploadKey(username, upload.Name))] = u.getACopy()
+	return nil
+}
+
+func (p *MemoryProvider) deleteMultipartUpload(username, name string) error {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return errMemoryProviderClosed
+	}
+	delete(p.dbHandle.multipartUploads, string(getMultipartUploadKey(username, name)))
+	return nil
+}
+
+func (p *MemoryProvider) getExpiredMultipartUploads(updatedBefore int64, limit int) ([]MultipartUpload, error) {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+
+	uploads := make([]MultipartUpload, 0, limit)
+	if p.dbHandle.isClosed {
+		return uploads, errMemoryProviderClosed
+	}
+	for _, upload := range p.dbHandle.multipartUploads {
+		if len(uploads) >= limit {
+			break
+		}
+		if upload.UpdatedAt < updatedBefore {
+			uploads = append(uploads, upload.getACopy())
+		}
+	}
+	return uploads, nil
+}
+
+func (p *MemoryProvider) getUserMultipartUploads(username string) ([]MultipartUpload, error) {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+
+	var uploads []MultipartUpload
+	if p.dbHandle.isClosed {
+		return uploads, errMemoryProviderClosed
+	}
+	for _, upload := range p.dbHandle.multipartUploads {
+		if upload.Username == username {
+			uploads = append(uploads, upload.getACopy())
+		}
+	}
+	return uploads, nil
+}
+
+func (p *MemoryProvider) addActionDelivery(delivery *ActionDelivery) error {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return errMemoryProviderClosed
+	}
+	p.dbHandle.lastActionDeliveryID++
+	delivery.ID = p.dbHandle.lastActionDeliveryID
+	p.dbHandle.actionDeliveries[delivery.ID] = delivery.getACopy()
+	p.dbHandle.actionDeliveriesIDs = append(p.dbHandle.actionDeliveriesIDs, delivery.ID)
+	return nil
+}
+
+func (p *MemoryProvider) getActionDelivery(id int64) (ActionDelivery, error) {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return ActionDelivery{}, errMemoryProviderClosed
+	}
+	if val, ok := p.dbHandle.actionDeliveries[id]; ok {
+		return val.getACopy(), nil
+	}
+	return ActionDelivery{}, &RecordNotFoundError{err: fmt.Sprintf("action delivery %v does not exist", id)}
+}
+
+func (p *MemoryProvider) getActionDeliveries(status, limit, offset int, order string) ([]ActionDelivery, error) {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+
+	deliveries := make([]ActionDelivery, 0, limit)
+	if p.dbHandle.isClosed {
+		return deliveries, errMemoryProviderClosed
+	}
+	itNum := 0
+	numIDs := len(p.dbHandle.actionDeliveriesIDs)
+	for i := 0; i < numIDs && len(deliveries) < limit; i++ {
+		idx := i
+		if order != OrderASC {
+			idx = numIDs - 1 - i
+		}
+		delivery := p.dbHandle.actionDeliveries[p.dbHandle.actionDeliveriesIDs[idx]]
+		if status != 0 && delivery.Status != status {
+			continue
+		}
+		itNum++
+		if itNum <= offset {
+			continue
+		}
+		deliveries = append(deliveries, delivery.getACopy())
+	}
+	return deliveries, nil
+}
+
+func (p *MemoryProvider) getDueActionDeliveries(nextAttemptBefore int64, limit int) ([]ActionDelivery, error) {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+
+	deliveries := make([]ActionDelivery, 0, limit)
+	if p.dbHandle.isClosed {
+		return deliveries, errMemoryProviderClosed
+	}
+	for _, id := range p.dbHandle.actionDeliveriesIDs {
+		if len(deliveries) >= limit {
+			break
+		}
+		delivery := p.dbHandle.actionDeliveries[id]
+		if delivery.Status == ActionDeliveryStatusPending && delivery.NextAttempt <= nextAttemptBefore {
+			deliveries = append(deliveries, delivery.getACopy())
+		}
+	}
+	return deliveries, nil
+}
+
+func (p *MemoryProvider) claimActionDelivery(id, nextAttempt, leaseUntil int64) (bool, error) {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return false, errMemoryProviderClosed
+	}
+	delivery, ok := p.dbHandle.actionDeliveries[id]
+	if !ok || delivery.Status != ActionDeliveryStatusPending || delivery.NextAttempt != nextAttempt {
+		return false, nil
+	}
+	delivery.NextAttempt = leaseUntil
+	p.dbHandle.actionDeliveries[id] = delivery
+	return true, nil
+}
+
+func (p *MemoryProvider) updateActionDelivery(delivery *ActionDelivery) error {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return errMemoryProviderClosed
+	}
+	stored, ok := p.dbHandle.actionDeliveries[delivery.ID]
+	if !ok {
+		return &RecordNotFoundError{err: fmt.Sprintf("action delivery %v does not exist", delivery.ID)}
+	}
+	stored.Status = delivery.Status
+	stored.Attempts = delivery.Attempts
+	stored.NextAttempt = delivery.NextAttempt
+	stored.LastError = delivery.LastError
+	stored.Delivered = append([]string(nil), delivery.Delivered...)
+	stored.UpdatedAt = delivery.UpdatedAt
+	p.dbHandle.actionDeliveries[delivery.ID] = stored
+	return nil
+}
+
+func (p *MemoryProvider) deleteActionDelivery(id int64) error {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return errMemoryProviderClosed
+	}
+	if _, ok := p.dbHandle.actionDeliveries[id]; !ok {
+		return &RecordNotFoundError{err: fmt.Sprintf("action delivery %v does not exist", id)}
+	}
+	p.deleteActionDeliveryInternal(id)
+	return nil
+}
+
+func (p *MemoryProvider) deleteActionDeliveryInternal(id int64) {
+	delete(p.dbHandle.actionDeliveries, id)
+	// the ids are sorted, they are assigned in increasing order
+	ids := p.dbHandle.actionDeliveriesIDs
+	idx := sort.Search(len(ids), func(i int) bool { return ids[i] >= id })
+	if idx < len(ids) && ids[idx] == id {
+		p.dbHandle.actionDeliveriesIDs = append(ids[:idx], ids[idx+1:]...)
+	}
+}
+
+func (p *MemoryProvider) retryFailedActionDeliveries(nextAttempt int64) error {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return errMemoryProviderClosed
+	}
+	updatedAt := utils.GetTimeAsMsSinceEpoch(time.Now())
+	for id, delivery := range p.dbHandle.actionDeliveries {
+		if delivery.Status != ActionDeliveryStatusFailed {
+			continue
+		}
+		delivery.Status = ActionDeliveryStatusPending
+		delivery.Attempts = 0
+		delivery.NextAttempt = nextAttempt
+		delivery.UpdatedAt = updatedAt
+		p.dbHandle.actionDeliveries[id] = delivery
+	}
+	return nil
+}
+
+func (p *MemoryProvider) purgeActionDeliveries(status int) error {
+	p.dbHandle.Lock()
+	defer p.dbHandle.Unlock()
+	if p.dbHandle.isClosed {
+		return errMemoryProviderClosed
+	}
+	for id, delivery := range p.dbHandle.actionDeliveries {
+		if delivery.Status == status {
+			p.deleteActionDeliveryInternal(id)
+		}
+	}
+	return nil
+}
+
 func (p *MemoryProvider) adminExists(username string) (Admin, error) {
 	p.dbHandle.Lock()
 	defer p.dbHandle.Unlock()
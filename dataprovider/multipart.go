@@ -0,0 +1,221 @@
+package dataprovider
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/drakkan/sftpgo/logger"
+	"github.com/drakkan/sftpgo/utils"
+	"github.com/drakkan/sftpgo/vfs"
+)
+
+const (
+	// max number of expired multipart uploads to abort for each janitor run
+	multipartUploadsJanitorLimit = 500
+	multipartUploadsJanitorID    = "multipart_janitor"
+)
+
+var (
+	multipartJanitorTicker *time.Ticker
+	multipartJanitorDone   chan bool
+	multipartJanitorMutex  sync.Mutex
+)
+
+// ResumableUploadsConfig defines the configuration for resuming interrupted uploads
+// to cloud storage backends. The state of the in-progress multipart uploads is
+// stored inside the data provider
+type ResumableUploadsConfig struct {
+	// Enabled allows to resume interrupted uploads to S3, Google Cloud Storage and
+	// Azure Blob storage
+	Enabled bool `json:"enabled" mapstructure:"enabled"`
+	// MaxAge defines the age, in hours, after which an interrupted multipart upload
+	// that was not resumed is aborted. 0 means never
+	MaxAge int `json:"max_age" mapstructure:"max_age"`
+	// CheckInterval defines the interval, in minutes, between two checks for expired
+	// multipart uploads
+	CheckInterval int `json:"check_interval" mapstructure:"check_interval"`
+}
+
+// MultipartUpload defines an in-progress multipart upload for a user
+type MultipartUpload struct {
+	Username string `json:"username"`
+	vfs.MultipartUpload
+}
+
+func (u *MultipartUpload) getACopy() MultipartUpload {
+	parts := make([]vfs.MultipartUploadPart, len(u.Parts))
+	copy(parts, u.Parts)
+	upload := *u
+	upload.Parts = parts
+	return upload
+}
+
+// multipartUploadStore implements vfs.MultipartUploadStore for a user
+type multipartUploadStore struct {
+	username string
+}
+
+func (s *multipartUploadStore) GetMultipartUpload(name string) (vfs.MultipartUpload, error) {
+	upload, err := provider.getMultipartUpload(s.username, name)
+	if err != nil {
+		if _, ok := err.(*RecordNotFoundError); ok {
+			return upload, vfs.ErrMultipartUploadNotFound
+		}
+		providerLog(logger.LevelWarn, "unable to get multipart upload %#v for user %#v: %v", name, s.username, err)
+	}
+	return upload, err
+}
+
+func (s *multipartUploadStore) SaveMultipartUpload(upload *vfs.MultipartUpload) error {
+	err := provider.saveMultipartUpload(s.username, upload)
+	if err != nil {
+		providerLog(logger.LevelWarn, "unable to save multipart upload %#v for user %#v: %v", upload.Name, s.username, err)
+	}
+	return err
+}
+
+func (s *multipartUploadStore) DeleteMultipartUpload(name string) error {
+	err := provider.deleteMultipartUpload(s.username, name)
+	if err != nil {
+		providerLog(logger.LevelWarn, "unable to delete multipart upload %#v for user %#v: %v", name, s.username, err)
+	}
+	return err
+}
+
+// withMultipartUploadStore enables upload resume for the given filesystem, if supported
+func (u *User) withMultipartUploadStore(fs vfs.Fs, err error) (vfs.Fs, error) {
+	if err != nil || !config.ResumableUploads.Enabled {
+		return fs, err
+	}
+	if uploader, ok := fs.(vfs.ResumableUploader); ok {
+		uploader.SetMultipartUploadStore(&multipartUploadStore{username: u.Username})
+	}
+	return fs, err
+}
+
+func getMultipartUploadKey(username, name string) []byte {
+	return []byte(username + "\x00" + name)
+}
+
+func startMultipartUploadsJanitor() {
+	cnf := config.ResumableUploads
+	if !cnf.Enabled || cnf.MaxAge <= 0 {
+		return
+	}
+	checkInterval := cnf.CheckInterval
+	if checkInterval <= 0 {
+		checkInterval = 60
+	}
+	multipartJanitorMutex.Lock()
+	defer multipartJanitorMutex.Unlock()
+
+	multipartJanitorTicker = time.NewTicker(time.Duration(checkInterval) * time.Minute)
+	multipartJanitorDone = make(chan bool)
+	providerLog(logger.LevelDebug, "multipart uploads janitor started, max age: %v hours, check interval: %v minutes",
+		cnf.MaxAge, checkInterval)
+
+	go func(ticker *time.Ticker, done chan bool) {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				abortExpiredMultipartUploads()
+			}
+		}
+	}(multipartJanitorTicker, multipartJanitorDone)
+}
+
+func stopMultipartUploadsJanitor() {
+	multipartJanitorMutex.Lock()
+	defer multipartJanitorMutex.Unlock()
+
+	if multipartJanitorTicker != nil {
+		multipartJanitorTicker.Stop()
+		multipartJanitorDone <- true
+		multipartJanitorTicker = nil
+	}
+}
+
+// abortExpiredMultipartUploads aborts the multipart uploads not updated
+// within the configured max age and removes their state
+func abortExpiredMultipartUploads() {
+	maxAge := time.Duration(config.ResumableUploads.MaxAge) * time.Hour
+	updatedBefore := utils.GetTimeAsMsSinceEpoch(time.Now().Add(-maxAge))
+	uploads, err := provider.getExpiredMultipartUploads(updatedBefore, multipartUploadsJanitorLimit)
+	if err != nil {
+		providerLog(logger.LevelWarn, "unable to get expired multipart uploads: %v", err)
+		return
+	}
+	for _, upload := range uploads {
+		if err := abortMultipartUpload(upload); err != nil {
+			providerLog(logger.LevelWarn, "unable to abort multipart upload %#v for user %#v: %v",
+				upload.Name, upload.Username, err)
+			continue
+		}
+		providerLog(logger.LevelDebug, "expired multipart upload %#v for user %#v aborted, last update: %v",
+			upload.Name, upload.Username, utils.GetTimeFromMsecSinceEpoch(upload.UpdatedAt))
+	}
+}
+
+func abortMultipartUpload(upload MultipartUpload) error {
+	user, err := provider.userExists(upload.Username)
+	if err != nil {
+		var errNotFound *RecordNotFoundError
+		if !errors.As(err, &errNotFound) {
+			return err
+		}
+		// the pending uploads are aborted before removing the user, this upload
+		// cannot be aborted since the storage configuration is no longer available
+		providerLog(logger.LevelWarn, "user %#v for multipart upload %#v does not exist, removing the upload state",
+			upload.Username, upload.Name)
+		return provider.deleteMultipartUpload(upload.Username, upload.Name)
+	}
+	fs, err := user.GetFilesystem(multipartUploadsJanitorID)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+
+	return abortMultipartUploadWithFs(fs, upload)
+}
+
+func abortMultipartUploadWithFs(fs vfs.Fs, upload MultipartUpload) error {
+	if uploader, ok := fs.(vfs.ResumableUploader); ok {
+		if err := uploader.AbortMultipartUpload(upload.MultipartUpload); err != nil {
+			return err
+		}
+	}
+	return provider.deleteMultipartUpload(upload.Username, upload.Name)
+}
+
+// abortUserMultipartUploads aborts the pending multipart uploads for the given user
+// and removes their state. The uploads are aborted using the storage configuration
+// of the given user, so this must be done before removing the user or after changing
+// its storage, the uploaded parts could not be found anymore otherwise
+func abortUserMultipartUploads(user *User) {
+	uploads, err := provider.getUserMultipartUploads(user.Username)
+	if err != nil {
+		providerLog(logger.LevelWarn, "unable to get multipart uploads for user %#v: %v", user.Username, err)
+		return
+	}
+	if len(uploads) == 0 {
+		return
+	}
+	fs, err := user.GetFilesystem(multipartUploadsJanitorID)
+	if err != nil {
+		providerLog(logger.LevelWarn, "unable to abort multipart uploads for user %#v: %v", user.Username, err)
+		return
+	}
+	defer fs.Close()
+
+	for _, upload := range uploads {
+		if err := abortMultipartUploadWithFs(fs, upload); err != nil {
+			providerLog(logger.LevelWarn, "unable to abort multipart upload %#v for user %#v: %v",
+				upload.Name, upload.Username, err)
+			continue
+		}
+		providerLog(logger.LevelDebug, "multipart upload %#v for user %#v aborted", upload.Name, upload.Username)
+	}
+}
@@ -0,0 +1,203 @@
+package dataprovider
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drakkan/sftpgo/kms"
+	"github.com/drakkan/sftpgo/utils"
+	"github.com/drakkan/sftpgo/vfs"
+)
+
+func TestMultipartUploadStore(t *testing.T) {
+	providerRestore := provider
+	configRestore := config
+	t.Cleanup(func() {
+		provider = providerRestore
+		config = configRestore
+	})
+	config = Config{}
+	initializeMemoryProvider(t.TempDir())
+
+	store := &multipartUploadStore{username: "user1"}
+	_, err := store.GetMultipartUpload("/path/file.dat")
+	assert.ErrorIs(t, err, vfs.ErrMultipartUploadNotFound)
+
+	upload := vfs.MultipartUpload{
+		Name:      "/path/file.dat",
+		UploadID:  "upload1",
+		Parts:     []vfs.MultipartUploadPart{{Number: 1, ETag: "etag1", Size: 10}},
+		CreatedAt: utils.GetTimeAsMsSinceEpoch(time.Now()),
+		UpdatedAt: utils.GetTimeAsMsSinceEpoch(time.Now()),
+	}
+	require.NoError(t, store.SaveMultipartUpload(&upload))
+	saved, err := store.GetMultipartUpload(upload.Name)
+	require.NoError(t, err)
+	assert.Equal(t, upload, saved)
+	// the same path for another user
+	_, err = (&multipartUploadStore{username: "user2"}).GetMultipartUpload(upload.Name)
+	assert.ErrorIs(t, err, vfs.ErrMultipartUploadNotFound)
+
+	upload.Parts = append(upload.Parts, vfs.MultipartUploadPart{Number: 2, ETag: "etag2", Size: 10})
+	require.NoError(t, store.SaveMultipartUpload(&upload))
+	saved, err = store.GetMultipartUpload(upload.Name)
+	require.NoError(t, err)
+	assert.Equal(t, int64(20), saved.GetSize())
+
+	require.NoError(t, store.DeleteMultipartUpload(upload.Name))
+	_, err = store.GetMultipartUpload(upload.Name)
+	assert.ErrorIs(t, err, vfs.ErrMultipartUploadNotFound)
+}
+
+func TestAbortExpiredMultipartUploads(t *testing.T) {
+	providerRestore := provider
+	configRestore := config
+	t.Cleanup(func() {
+		provider = providerRestore
+		config = configRestore
+	})
+	config = Config{
+		ResumableUploads: ResumableUploadsConfig{
+			Enabled: true,
+			MaxAge:  24,
+		},
+	}
+	initializeMemoryProvider(t.TempDir())
+
+	expired := vfs.MultipartUpload{
+		Name:      "/expired.dat",
+		UploadID:  "upload1",
+		UpdatedAt: utils.GetTimeAsMsSinceEpoch(time.Now().Add(-48 * time.Hour)),
+	}
+	recent := vfs.MultipartUpload{
+		Name:      "/recent.dat",
+		UploadID:  "upload2",
+		UpdatedAt: utils.GetTimeAsMsSinceEpoch(time.Now()),
+	}
+	require.NoError(t, provider.saveMultipartUpload("missing_user", &expired))
+	require.NoError(t, provider.saveMultipartUpload("missing_user", &recent))
+
+	uploads, err := provider.getExpiredMultipartUploads(utils.GetTimeAsMsSinceEpoch(time.Now().Add(-time.Hour)), 10)
+	require.NoError(t, err)
+	require.Len(t, uploads, 1)
+	assert.Equal(t, "missing_user", uploads[0].Username)
+	assert.Equal(t, expired.Name, uploads[0].Name)
+
+	// the user does not exist, only the upload state is removed
+	abortExpiredMultipartUploads()
+	_, err = provider.getMultipartUpload("missing_user", expired.Name)
+	assert.Error(t, err)
+	_, err = provider.getMultipartUpload("missing_user", recent.Name)
+	assert.NoError(t, err)
+}
+
+func TestAbortUserMultipartUploads(t *testing.T) {
+	providerRestore := provider
+	configRestore := config
+	t.Cleanup(func() {
+		provider = providerRestore
+		config = configRestore
+	})
+	config = Config{
+		ResumableUploads: ResumableUploadsConfig{
+			Enabled: true,
+		},
+	}
+	initializeMemoryProvider(t.TempDir())
+
+	var abortedMutex sync.Mutex
+	var aborted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			abortedMutex.Lock()
+			aborted = append(aborted, r.URL.Path+"?"+r.URL.RawQuery)
+			abortedMutex.Unlock()
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	getAborted := func() []string {
+		abortedMutex.Lock()
+		defer abortedMutex.Unlock()
+
+		return append([]string(nil), aborted...)
+	}
+	user := User{
+		Username:    "multipart_user",
+		Password:    "$2a$14$ajq8Q7fbtFRQvXpdCq7Jcuy.Rx1h/L4J60Otx.gyNLbAYctGMJ9tK",
+		HomeDir:     filepath.Join(t.TempDir(), "multipart_user"),
+		Permissions: map[string][]string{"/": {PermAny}},
+	}
+	user.FsConfig.Provider = S3FilesystemProvider
+	user.FsConfig.S3Config = vfs.S3FsConfig{
+		Bucket:       "bucket1",
+		Region:       "us-east-1",
+		AccessKey:    "key",
+		AccessSecret: kms.NewPlainSecret("secret"),
+		Endpoint:     server.URL,
+	}
+	require.NoError(t, AddUser(&user))
+	upload := vfs.MultipartUpload{
+		Name:      "file.dat",
+		UploadID:  "upload1",
+		UpdatedAt: utils.GetTimeAsMsSinceEpoch(time.Now()),
+	}
+	require.NoError(t, provider.saveMultipartUpload(user.Username, &upload))
+	uploads, err := provider.getUserMultipartUploads(user.Username)
+	require.NoError(t, err)
+	assert.Len(t, uploads, 1)
+	// the pending uploads are preserved if the storage does not change
+	user, err = UserExists(user.Username)
+	require.NoError(t, err)
+	user.AdditionalInfo = "info"
+	require.NoError(t, UpdateUser(&user))
+	_, err = provider.getMultipartUpload(user.Username, upload.Name)
+	assert.NoError(t, err)
+	assert.Empty(t, getAborted())
+	// the pending uploads are aborted in the old bucket if the bucket changes
+	user, err = UserExists(user.Username)
+	require.NoError(t, err)
+	user.FsConfig.S3Config.Bucket = "bucket2"
+	require.NoError(t, UpdateUser(&user))
+	_, err = provider.getMultipartUpload(user.Username, upload.Name)
+	assert.IsType(t, &RecordNotFoundError{}, err)
+	assert.Equal(t, []string{"/bucket1/file.dat?uploadId=upload1"}, getAborted())
+	// and before removing the user
+	upload.UploadID = "upload2"
+	require.NoError(t, provider.saveMultipartUpload(user.Username, &upload))
+	require.NoError(t, DeleteUser(user.Username))
+	_, err = provider.getMultipartUpload(user.Username, upload.Name)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"/bucket1/file.dat?uploadId=upload1", "/bucket2/file.dat?uploadId=upload2"}, getAborted())
+}
+
+func TestUserFilesystemMultipartUploadStore(t *testing.T) {
+	configRestore := config
+	t.Cleanup(func() {
+		config = configRestore
+	})
+
+	config.ResumableUploads.Enabled = false
+	user := User{Username: "user1"}
+	user.FsConfig.Provider = S3FilesystemProvider
+	user.FsConfig.S3Config = vfs.S3FsConfig{
+		Bucket: "bucket",
+		Region: "us-east-1",
+	}
+	fs, err := user.GetFilesystem("id")
+	require.NoError(t, err)
+	assert.False(t, fs.IsUploadResumeSupported())
+
+	config.ResumableUploads.Enabled = true
+	fs, err = user.GetFilesystem("id")
+	require.NoError(t, err)
+	assert.True(t, fs.IsUploadResumeSupported())
+}
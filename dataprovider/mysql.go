@@ -54,6 +54,18 @@ const (
 	mysqlV8DownSQL = "ALTER TABLE `{{folders}}` DROP COLUMN `name`;" +
 		"ALTER TABLE `{{folders}}` MODIFY `path` varchar(512) NOT NULL;" +
 		"ALTER TABLE `{{folders}}` ADD CONSTRAINT `path` UNIQUE (`path`);"
+	mysqlV9SQL = "CREATE TABLE `{{multipart_uploads}}` (`id` integer AUTO_INCREMENT NOT NULL PRIMARY KEY, " +
+		"`username` varchar(255) NOT NULL, `path` varchar(512) NOT NULL, `upload_id` longtext NOT NULL, " +
+		"`parts` longtext NULL, `created_at` bigint NOT NULL, `updated_at` bigint NOT NULL);" +
+		"ALTER TABLE `{{multipart_uploads}}` ADD CONSTRAINT `multipart_uploads_unique` UNIQUE (`username`, `path`);" +
+		"CREATE INDEX `multipart_uploads_updated_at_idx` ON `{{multipart_uploads}}` (`updated_at`);"
+	mysqlV9DownSQL = "DROP TABLE `{{multipart_uploads}}` CASCADE;"
+	mysqlV10SQL    = "CREATE TABLE `{{action_deliveries}}` (`id` bigint AUTO_INCREMENT NOT NULL PRIMARY KEY, " +
+		"`action` varchar(50) NOT NULL, `username` varchar(255) NOT NULL, `notification` longtext NOT NULL, " +
+		"`status` integer NOT NULL, `attempts` integer NOT NULL, `next_attempt` bigint NOT NULL, `last_error` longtext NULL, " +
+		"`delivered` longtext NULL, `created_at` bigint NOT NULL, `updated_at` bigint NOT NULL);" +
+		"CREATE INDEX `action_deliveries_status_next_attempt_idx` ON `{{action_deliveries}}` (`status`, `next_attempt`);"
+	mysqlV10DownSQL = "DROP TABLE `{{action_deliveries}}` CASCADE;"
 )
 
 // MySQLProvider auth provider for MySQL/MariaDB database
@@ -101,6 +113,10 @@ func getMySQLConnectionString(redactedPwd bool) string {
 	return connectionString
 }
 
+func (p *MySQLProvider) getSQLHandle() (*sql.DB, string) {
+	return p.dbHandle, getMySQLConnectionString(false)
+}
+
 func (p *MySQLProvider) checkAvailability() error {
 	return sqlCommonCheckAvailability(p.dbHandle)
 }
@@ -211,6 +227,62 @@ func (p *MySQLProvider) validateAdminAndPass(username, password, ip string) (Adm
 	return sqlCommonValidateAdminAndPass(username, password, ip, p.dbHandle)
 }
 
+func (p *MySQLProvider) getMultipartUpload(username, name string) (vfs.MultipartUpload, error) {
+	return sqlCommonGetMultipartUpload(username, name, p.dbHandle)
+}
+
+func (p *MySQLProvider) saveMultipartUpload(username string, upload *vfs.MultipartUpload) error {
+	return sqlCommonSaveMultipartUpload(username, upload, p.dbHandle)
+}
+
+func (p *MySQLProvider) deleteMultipartUpload(username, name string) error {
+	return sqlCommonDeleteMultipartUpload(username, name, p.dbHandle)
+}
+
+func (p *MySQLProvider) getExpiredMultipartUploads(updatedBefore int64, limit int) ([]MultipartUpload, error) {
+	return sqlCommonGetExpiredMultipartUploads(updatedBefore, limit, p.dbHandle)
+}
+
+func (p *MySQLProvider) getUserMultipartUploads(username string) ([]MultipartUpload, error) {
+	return sqlCommonGetUserMultipartUploads(username, p.dbHandle)
+}
+
+func (p *MySQLProvider) addActionDelivery(delivery *ActionDelivery) error {
+	return sqlCommonAddActionDelivery(delivery, p.dbHandle)
+}
+
+func (p *MySQLProvider) getActionDelivery(id int64) (ActionDelivery, error) {
+	return sqlCommonGetActionDelivery(id, p.dbHandle)
+}
+
+func (p *MySQLProvider) getActionDeliveries(status, limit, offset int, order string) ([]ActionDelivery, error) {
+	return sqlCommonGetActionDeliveries(status, limit, offset, order, p.dbHandle)
+}
+
+func (p *MySQLProvider) getDueActionDeliveries(nextAttemptBefore int64, limit int) ([]ActionDelivery, error) {
+	return sqlCommonGetDueActionDeliveries(nextAttemptBefore, limit, p.dbHandle)
+}
+
+func (p *MySQLProvider) claimActionDelivery(id, nextAttempt, leaseUntil int64) (bool, error) {
+	return sqlCommonClaimActionDelivery(id, nextAttempt, leaseUntil, p.dbHandle)
+}
+
+func (p *MySQLProvider) updateActionDelivery(delivery *ActionDelivery) error {
+	return sqlCommonUpdateActionDelivery(delivery, p.dbHandle)
+}
+
+func (p *MySQLProvider) deleteActionDelivery(id int64) error {
+	return sqlCommonDeleteActionDelivery(id, p.dbHandle)
+}
+
+func (p *MySQLProvider) retryFailedActionDeliveries(nextAttempt int64) error {
+	return sqlCommonRetryFailedActionDeliveries(nextAttempt, p.dbHandle)
+}
+
+func (p *MySQLProvider) purgeActionDeliveries(status int) error {
+	return sqlCommonPurgeActionDeliveries(status, p.dbHandle)
+}
+
 func (p *MySQLProvider) close() error {
 	return p.dbHandle.Close()
 }
@@ -272,6 +344,10 @@ func (p *MySQLProvider) migrateDatabase() error {
 		return updateMySQLDatabaseFromV6(p.dbHandle)
 	case 7:
 		return updateMySQLDatabaseFromV7(p.dbHandle)
+	case 8:
+		return updateMySQLDatabaseFromV8(p.dbHandle)
+	case 9:
+		return updateMySQLDatabaseFromV9(p.dbHandle)
 	default:
 		if dbVersion.Version > sqlDatabaseVersion {
 			providerLog(logger.LevelWarn, "database version %v is newer than the supported: %v", dbVersion.Version,
@@ -294,6 +370,46 @@ func (p *MySQLProvider) revertDatabase(targetVersion int) error {
 		return fmt.Errorf("current version match target version, nothing to do")
 	}
 	switch dbVersion.Version {
+	case 10:
+		err = downgradeMySQLDatabaseFrom10To9(p.dbHandle)
+		if err != nil {
+			return err
+		}
+		err = downgradeMySQLDatabaseFrom9To8(p.dbHandle)
+		if err != nil {
+			return err
+		}
+		err = downgradeMySQLDatabaseFrom8To7(p.dbHandle)
+		if err != nil {
+			return err
+		}
+		err = downgradeMySQLDatabaseFrom7To6(p.dbHandle)
+		if err != nil {
+			return err
+		}
+		err = downgradeMySQLDatabaseFrom6To5(p.dbHandle)
+		if err != nil {
+			return err
+		}
+		return downgradeMySQLDatabaseFrom5To4(p.dbHandle)
+	case 9:
+		err = downgradeMySQLDatabaseFrom9To8(p.dbHandle)
+		if err != nil {
+			return err
+		}
+		err = downgradeMySQLDatabaseFrom8To7(p.dbHandle)
+		if err != nil {
+			return err
+		}
+		err = downgradeMySQLDatabaseFrom7To6(p.dbHandle)
+		if err != nil {
+			return err
+		}
+		err = downgradeMySQLDatabaseFrom6To5(p.dbHandle)
+		if err != nil {
+			return err
+		}
+		return downgradeMySQLDatabaseFrom5To4(p.dbHandle)
 	case 8:
 		err = downgradeMySQLDatabaseFrom8To7(p.dbHandle)
 		if err != nil {
@@ -380,7 +496,23 @@ func updateMySQLDatabaseFromV6(dbHandle *sql.DB) error {
 }
 
 func updateMySQLDatabaseFromV7(dbHandle *sql.DB) error {
-	return updateMySQLDatabaseFrom7To8(dbHandle)
+	err := updateMySQLDatabaseFrom7To8(dbHandle)
+	if err != nil {
+		return err
+	}
+	return updateMySQLDatabaseFromV8(dbHandle)
+}
+
+func updateMySQLDatabaseFromV8(dbHandle *sql.DB) error {
+	err := updateMySQLDatabaseFrom8To9(dbHandle)
+	if err != nil {
+		return err
+	}
+	return updateMySQLDatabaseFromV9(dbHandle)
+}
+
+func updateMySQLDatabaseFromV9(dbHandle *sql.DB) error {
+	return updateMySQLDatabaseFrom9To10(dbHandle)
 }
 
 func updateMySQLDatabaseFrom1To2(dbHandle *sql.DB) error {
@@ -426,6 +558,34 @@ func updateMySQLDatabaseFrom7To8(dbHandle *sql.DB) error {
 	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, strings.Split(sql, ";"), 8)
 }
 
+func updateMySQLDatabaseFrom8To9(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database version: 8 -> 9")
+	providerLog(logger.LevelInfo, "updating database version: 8 -> 9")
+	sql := strings.ReplaceAll(mysqlV9SQL, "{{multipart_uploads}}", sqlTableMultipartUploads)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, strings.Split(sql, ";"), 9)
+}
+
+func updateMySQLDatabaseFrom9To10(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database version: 9 -> 10")
+	providerLog(logger.LevelInfo, "updating database version: 9 -> 10")
+	sql := strings.ReplaceAll(mysqlV10SQL, "{{action_deliveries}}", sqlTableActionDeliveries)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, strings.Split(sql, ";"), 10)
+}
+
+func downgradeMySQLDatabaseFrom10To9(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database version: 10 -> 9")
+	providerLog(logger.LevelInfo, "downgrading database version: 10 -> 9")
+	sql := strings.Replace(mysqlV10DownSQL, "{{action_deliveries}}", sqlTableActionDeliveries, 1)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 9)
+}
+
+func downgradeMySQLDatabaseFrom9To8(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database version: 9 -> 8")
+	providerLog(logger.LevelInfo, "downgrading database version: 9 -> 8")
+	sql := strings.Replace(mysqlV9DownSQL, "{{multipart_uploads}}", sqlTableMultipartUploads, 1)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 8)
+}
+
 func downgradeMySQLDatabaseFrom8To7(dbHandle *sql.DB) error {
 	logger.InfoToConsole("downgrading database version: 8 -> 7")
 	providerLog(logger.LevelInfo, "downgrading database version: 8 -> 7")
@@ -57,6 +57,19 @@ ALTER TABLE "{{folders}}" ADD CONSTRAINT "folders_name_uniq" UNIQUE ("name");
 ALTER TABLE "{{folders}}" ALTER COLUMN "path" SET NOT NULL;
 ALTER TABLE "{{folders}}" ADD CONSTRAINT folders_path_key UNIQUE (path);
 `
+	pgsqlV9SQL = `CREATE TABLE "{{multipart_uploads}}" ("id" serial NOT NULL PRIMARY KEY, "username" varchar(255) NOT NULL,
+"path" varchar(512) NOT NULL, "upload_id" text NOT NULL, "parts" text NULL, "created_at" bigint NOT NULL,
+"updated_at" bigint NOT NULL);
+ALTER TABLE "{{multipart_uploads}}" ADD CONSTRAINT "multipart_uploads_unique" UNIQUE ("username", "path");
+CREATE INDEX "multipart_uploads_updated_at_idx" ON "{{multipart_uploads}}" ("updated_at");
+`
+	pgsqlV9DownSQL = `DROP TABLE "{{multipart_uploads}}" CASCADE;`
+	pgsqlV10SQL    = `CREATE TABLE "{{action_deliveries}}" ("id" bigserial NOT NULL PRIMARY KEY, "action" varchar(50) NOT NULL,
+"username" varchar(255) NOT NULL, "notification" text NOT NULL, "status" integer NOT NULL, "attempts" integer NOT NULL,
+"next_attempt" bigint NOT NULL, "last_error" text NULL, "delivered" text NULL, "created_at" bigint NOT NULL, "updated_at" bigint NOT NULL);
+CREATE INDEX "action_deliveries_status_next_attempt_idx" ON "{{action_deliveries}}" ("status", "next_attempt");
+`
+	pgsqlV10DownSQL = `DROP TABLE "{{action_deliveries}}" CASCADE;`
 )
 
 // PGSQLProvider auth provider for PostgreSQL database
@@ -105,6 +118,10 @@ func getPGSQLConnectionString(redactedPwd bool) string {
 	return connectionString
 }
 
+func (p *PGSQLProvider) getSQLHandle() (*sql.DB, string) {
+	return p.dbHandle, getPGSQLConnectionString(false)
+}
+
 func (p *PGSQLProvider) checkAvailability() error {
 	return sqlCommonCheckAvailability(p.dbHandle)
 }
@@ -215,6 +232,62 @@ func (p *PGSQLProvider) validateAdminAndPass(username, password, ip string) (Adm
 	return sqlCommonValidateAdminAndPass(username, password, ip, p.dbHandle)
 }
 
+func (p *PGSQLProvider) getMultipartUpload(username, name string) (vfs.MultipartUpload, error) {
+	return sqlCommonGetMultipartUpload(username, name, p.dbHandle)
+}
+
+func (p *PGSQLProvider) saveMultipartUpload(username string, upload *vfs.MultipartUpload) error {
+	return sqlCommonSaveMultipartUpload(username, upload, p.dbHandle)
+}
+
+func (p *PGSQLProvider) deleteMultipartUpload(username, name string) error {
+	return sqlCommonDeleteMultipartUpload(username, name, p.dbHandle)
+}
+
+func (p *PGSQLProvider) getExpiredMultipartUploads(updatedBefore int64, limit int) ([]MultipartUpload, error) {
+	return sqlCommonGetExpiredMultipartUploads(updatedBefore, limit, p.dbHandle)
+}
+
+func (p *PGSQLProvider) getUserMultipartUploads(username string) ([]MultipartUpload, error) {
+	return sqlCommonGetUserMultipartUploads(username, p.dbHandle)
+}
+
+func (p *PGSQLProvider) addActionDelivery(delivery *ActionDelivery) error {
+	return sqlCommonAddActionDelivery(delivery, p.dbHandle)
+}
+
+func (p *PGSQLProvider) getActionDelivery(id int64) (ActionDelivery, error) {
+	return sqlCommonGetActionDelivery(id, p.dbHandle)
+}
+
+func (p *PGSQLProvider) getActionDeliveries(status, limit, offset int, order string) ([]ActionDelivery, error) {
+	return sqlCommonGetActionDeliveries(status, limit, offset, order, p.dbHandle)
+}
+
+func (p *PGSQLProvider) getDueActionDeliveries(nextAttemptBefore int64, limit int) ([]ActionDelivery, error) {
+	return sqlCommonGetDueActionDeliveries(nextAttemptBefore, limit, p.dbHandle)
+}
+
+func (p *PGSQLProvider) claimActionDelivery(id, nextAttempt, leaseUntil int64) (bool, error) {
+	return sqlCommonClaimActionDelivery(id, nextAttempt, leaseUntil, p.dbHandle)
+}
+
+func (p *PGSQLProvider) updateActionDelivery(delivery *ActionDelivery) error {
+	return sqlCommonUpdateActionDelivery(delivery, p.dbHandle)
+}
+
+func (p *PGSQLProvider) deleteActionDelivery(id int64) error {
+	return sqlCommonDeleteActionDelivery(id, p.dbHandle)
+}
+
+func (p *PGSQLProvider) retryFailedActionDeliveries(nextAttempt int64) error {
+	return sqlCommonRetryFailedActionDeliveries(nextAttempt, p.dbHandle)
+}
+
+func (p *PGSQLProvider) purgeActionDeliveries(status int) error {
+	return sqlCommonPurgeActionDeliveries(status, p.dbHandle)
+}
+
 func (p *PGSQLProvider) close() error {
 	return p.dbHandle.Close()
 }
@@ -276,6 +349,10 @@ func (p *PGSQLProvider) migrateDatabase() error {
 		return updatePGSQLDatabaseFromV6(p.dbHandle)
 	case 7:
 		return updatePGSQLDatabaseFromV7(p.dbHandle)
+	case 8:
+		return updatePGSQLDatabaseFromV8(p.dbHandle)
+	case 9:
+		return updatePGSQLDatabaseFromV9(p.dbHandle)
 	default:
 		if dbVersion.Version > sqlDatabaseVersion {
 			providerLog(logger.LevelWarn, "database version %v is newer than the supported: %v", dbVersion.Version,
@@ -298,6 +375,46 @@ func (p *PGSQLProvider) revertDatabase(targetVersion int) error {
 		return fmt.Errorf("current version match target version, nothing to do")
 	}
 	switch dbVersion.Version {
+	case 10:
+		err = downgradePGSQLDatabaseFrom10To9(p.dbHandle)
+		if err != nil {
+			return err
+		}
+		err = downgradePGSQLDatabaseFrom9To8(p.dbHandle)
+		if err != nil {
+			return err
+		}
+		err = downgradePGSQLDatabaseFrom8To7(p.dbHandle)
+		if err != nil {
+			return err
+		}
+		err = downgradePGSQLDatabaseFrom7To6(p.dbHandle)
+		if err != nil {
+			return err
+		}
+		err = downgradePGSQLDatabaseFrom6To5(p.dbHandle)
+		if err != nil {
+			return err
+		}
+		return downgradePGSQLDatabaseFrom5To4(p.dbHandle)
+	case 9:
+		err = downgradePGSQLDatabaseFrom9To8(p.dbHandle)
+		if err != nil {
+			return err
+		}
+		err = downgradePGSQLDatabaseFrom8To7(p.dbHandle)
+		if err != nil {
+			return err
+		}
+		err = downgradePGSQLDatabaseFrom7To6(p.dbHandle)
+		if err != nil {
+			return err
+		}
+		err = downgradePGSQLDatabaseFrom6To5(p.dbHandle)
+		if err != nil {
+			return err
+		}
+		return downgradePGSQLDatabaseFrom5To4(p.dbHandle)
 	case 8:
 		err = downgradePGSQLDatabaseFrom8To7(p.dbHandle)
 		if err != nil {
@@ -384,7 +501,23 @@ func updatePGSQLDatabaseFromV6(dbHandle *sql.DB) error {
 }
 
 func updatePGSQLDatabaseFromV7(dbHandle *sql.DB) error {
-	return updatePGSQLDatabaseFrom7To8(dbHandle)
+	err := updatePGSQLDatabaseFrom7To8(dbHandle)
+	if err != nil {
+		return err
+	}
+	return updatePGSQLDatabaseFromV8(dbHandle)
+}
+
+func updatePGSQLDatabaseFromV8(dbHandle *sql.DB) error {
+	err := updatePGSQLDatabaseFrom8To9(dbHandle)
+	if err != nil {
+		return err
+	}
+	return updatePGSQLDatabaseFromV9(dbHandle)
+}
+
+func updatePGSQLDatabaseFromV9(dbHandle *sql.DB) error {
+	return updatePGSQLDatabaseFrom9To10(dbHandle)
 }
 
 func updatePGSQLDatabaseFrom1To2(dbHandle *sql.DB) error {
@@ -430,6 +563,34 @@ func updatePGSQLDatabaseFrom7To8(dbHandle *sql.DB) error {
 	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 8)
 }
 
+func updatePGSQLDatabaseFrom8To9(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database version: 8 -> 9")
+	providerLog(logger.LevelInfo, "updating database version: 8 -> 9")
+	sql := strings.ReplaceAll(pgsqlV9SQL, "{{multipart_uploads}}", sqlTableMultipartUploads)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 9)
+}
+
+func updatePGSQLDatabaseFrom9To10(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database version: 9 -> 10")
+	providerLog(logger.LevelInfo, "updating database version: 9 -> 10")
+	sql := strings.ReplaceAll(pgsqlV10SQL, "{{action_deliveries}}", sqlTableActionDeliveries)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 10)
+}
+
+func downgradePGSQLDatabaseFrom10To9(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database version: 10 -> 9")
+	providerLog(logger.LevelInfo, "downgrading database version: 10 -> 9")
+	sql := strings.Replace(pgsqlV10DownSQL, "{{action_deliveries}}", sqlTableActionDeliveries, 1)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 9)
+}
+
+func downgradePGSQLDatabaseFrom9To8(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database version: 9 -> 8")
+	providerLog(logger.LevelInfo, "downgrading database version: 9 -> 8")
+	sql := strings.Replace(pgsqlV9DownSQL, "{{multipart_uploads}}", sqlTableMultipartUploads, 1)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 8)
+}
+
 func downgradePGSQLDatabaseFrom8To7(dbHandle *sql.DB) error {
 	logger.InfoToConsole("downgrading database version: 8 -> 7")
 	providerLog(logger.LevelInfo, "downgrading database version: 8 -> 7")
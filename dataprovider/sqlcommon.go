@@ -15,7 +15,7 @@ import (
 )
 
 const (
-	sqlDatabaseVersion     = 8
+	sqlDatabaseVersion     = 10
 	initialDBVersionSQL    = "INSERT INTO {{schema_version}} (version) VALUES (1);"
 	defaultSQLQueryTimeout = 10 * time.Second
 	longSQLQueryTimeout    = 60 * time.Second
@@ -1293,3 +1293,347 @@ func sqlCommonDowngradeDatabaseFrom5To4(dbHandle *sql.DB) error {
 
 	return sqlCommonUpdateDatabaseVersion(ctxVersion, dbHandle, 4)
 }
+
+func getMultipartUploadFromDbRow(row sqlScanner) (MultipartUpload, error) {
+	var upload MultipartUpload
+	var parts sql.NullString
+	err := row.Scan(&upload.Username, &upload.Name, &upload.UploadID, &parts, &upload.CreatedAt, &upload.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return upload, &RecordNotFoundError{err: err.Error()}
+		}
+		return upload, err
+	}
+	if parts.Valid && parts.String != "" {
+		err = json.Unmarshal([]byte(parts.String), &upload.Parts)
+	}
+	return upload, err
+}
+
+func sqlCommonGetMultipartUpload(username, name string, dbHandle sqlQuerier) (vfs.MultipartUpload, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+	q := getMultipartUploadQuery()
+	stmt, err := dbHandle.PrepareContext(ctx, q)
+	if err != nil {
+		providerLog(logger.LevelWarn, "error preparing database query %#v: %v", q, err)
+		return vfs.MultipartUpload{}, err
+	}
+	defer stmt.Close()
+
+	row := stmt.QueryRowContext(ctx, username, name)
+	upload, err := getMultipartUploadFromDbRow(row)
+	return upload.MultipartUpload, err
+}
+
+func sqlCommonSaveMultipartUpload(username string, upload *vfs.MultipartUpload, dbHandle *sql.DB) error {
+	parts, err := json.Marshal(upload.Parts)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+	tx, err := dbHandle.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	err = sqlCommonDeleteMultipartUploadWithQuerier(ctx, username, upload.Name, tx)
+	if err != nil {
+		return err
+	}
+	q := getAddMultipartUploadQuery()
+	stmt, err := tx.PrepareContext(ctx, q)
+	if err != nil {
+		providerLog(logger.LevelWarn, "error preparing database query %#v: %v", q, err)
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.ExecContext(ctx, username, upload.Name, upload.UploadID, string(parts), upload.CreatedAt, upload.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func sqlCommonDeleteMultipartUpload(username, name string, dbHandle *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+	return sqlCommonDeleteMultipartUploadWithQuerier(ctx, username, name, dbHandle)
+}
+
+func sqlCommonDeleteMultipartUploadWithQuerier(ctx context.Context, username, name string, dbHandle sqlQuerier) error {
+	q := getDeleteMultipartUploadQuery()
+	stmt, err := dbHandle.PrepareContext(ctx, q)
+	if err != nil {
+		providerLog(logger.LevelWarn, "error preparing database query %#v: %v", q, err)
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.ExecContext(ctx, username, name)
+	return err
+}
+
+func sqlCommonGetExpiredMultipartUploads(updatedBefore int64, limit int, dbHandle sqlQuerier) ([]MultipartUpload, error) {
+	uploads := make([]MultipartUpload, 0, limit)
+	ctx, cancel := context.WithTimeout(context.Background(), longSQLQueryTimeout)
+	defer cancel()
+	q := getExpiredMultipartUploadsQuery()
+	stmt, err := dbHandle.PrepareContext(ctx, q)
+	if err != nil {
+		providerLog(logger.LevelWarn, "error preparing database query %#v: %v", q, err)
+		return uploads, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, updatedBefore, limit)
+	if err != nil {
+		return uploads, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		upload, err := getMultipartUploadFromDbRow(rows)
+		if err != nil {
+			return uploads, err
+		}
+		uploads = append(uploads, upload)
+	}
+	return uploads, rows.Err()
+}
+
+func sqlCommonGetUserMultipartUploads(username string, dbHandle sqlQuerier) ([]MultipartUpload, error) {
+	var uploads []MultipartUpload
+	ctx, cancel := context.WithTimeout(context.Background(), longSQLQueryTimeout)
+	defer cancel()
+	q := getUserMultipartUploadsQuery()
+	stmt, err := dbHandle.PrepareContext(ctx, q)
+	if err != nil {
+		providerLog(logger.LevelWarn, "error preparing database query %#v: %v", q, err)
+		return uploads, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, username)
+	if err != nil {
+		return uploads, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		upload, err := getMultipartUploadFromDbRow(rows)
+		if err != nil {
+			return uploads, err
+		}
+		uploads = append(uploads, upload)
+	}
+	return uploads, rows.Err()
+}
+
+func getActionDeliveryFromDbRow(row sqlScanner) (ActionDelivery, error) {
+	var delivery ActionDelivery
+	var notification string
+	var lastError, delivered sql.NullString
+	err := row.Scan(&delivery.ID, &delivery.Action, &delivery.Username, &notification, &delivery.Status,
+		&delivery.Attempts, &delivery.NextAttempt, &lastError, &delivered, &delivery.CreatedAt, &delivery.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return delivery, &RecordNotFoundError{err: err.Error()}
+		}
+		return delivery, err
+	}
+	delivery.Notification = json.RawMessage(notification)
+	if lastError.Valid {
+		delivery.LastError = lastError.String
+	}
+	if delivered.Valid && delivered.String != "" {
+		err = json.Unmarshal([]byte(delivered.String), &delivery.Delivered)
+	}
+	return delivery, err
+}
+
+func sqlCommonAddActionDelivery(delivery *ActionDelivery, dbHandle *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+	q := getAddActionDeliveryQuery()
+	stmt, err := dbHandle.PrepareContext(ctx, q)
+	if err != nil {
+		providerLog(logger.LevelWarn, "error preparing database query %#v: %v", q, err)
+		return err
+	}
+	defer stmt.Close()
+
+	delivered, err := json.Marshal(delivery.Delivered)
+	if err != nil {
+		return err
+	}
+	args := []interface{}{delivery.Action, delivery.Username, string(delivery.Notification), delivery.Status,
+		delivery.Attempts, delivery.NextAttempt, delivery.LastError, string(delivered), delivery.CreatedAt,
+		delivery.UpdatedAt}
+	if config.Driver == PGSQLDataProviderName {
+		return stmt.QueryRowContext(ctx, args...).Scan(&delivery.ID)
+	}
+	res, err := stmt.ExecContext(ctx, args...)
+	if err != nil {
+		return err
+	}
+	delivery.ID, err = res.LastInsertId()
+	return err
+}
+
+func sqlCommonGetActionDelivery(id int64, dbHandle sqlQuerier) (ActionDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+	q := getActionDeliveryQuery()
+	stmt, err := dbHandle.PrepareContext(ctx, q)
+	if err != nil {
+		providerLog(logger.LevelWarn, "error preparing database query %#v: %v", q, err)
+		return ActionDelivery{}, err
+	}
+	defer stmt.Close()
+
+	row := stmt.QueryRowContext(ctx, id)
+	return getActionDeliveryFromDbRow(row)
+}
+
+func sqlCommonGetActionDeliveries(status, limit, offset int, order string, dbHandle sqlQuerier) ([]ActionDelivery, error) {
+	var q string
+	var args []interface{}
+	if status == 0 {
+		q = getActionDeliveriesQuery(order)
+		args = []interface{}{limit, offset}
+	} else {
+		q = getActionDeliveriesWithStatusQuery(order)
+		args = []interface{}{status, limit, offset}
+	}
+	return sqlCommonQueryActionDeliveries(q, limit, dbHandle, args...)
+}
+
+func sqlCommonGetDueActionDeliveries(nextAttemptBefore int64, limit int, dbHandle sqlQuerier) ([]ActionDelivery, error) {
+	return sqlCommonQueryActionDeliveries(getDueActionDeliveriesQuery(), limit, dbHandle, ActionDeliveryStatusPending,
+		nextAttemptBefore, limit)
+}
+
+func sqlCommonQueryActionDeliveries(q string, limit int, dbHandle sqlQuerier, args ...interface{}) ([]ActionDelivery, error) {
+	deliveries := make([]ActionDelivery, 0, limit)
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+	stmt, err := dbHandle.PrepareContext(ctx, q)
+	if err != nil {
+		providerLog(logger.LevelWarn, "error preparing database query %#v: %v", q, err)
+		return deliveries, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return deliveries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		delivery, err := getActionDeliveryFromDbRow(rows)
+		if err != nil {
+			return deliveries, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func sqlCommonClaimActionDelivery(id, nextAttempt, leaseUntil int64, dbHandle *sql.DB) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+	q := getClaimActionDeliveryQuery()
+	stmt, err := dbHandle.PrepareContext(ctx, q)
+	if err != nil {
+		providerLog(logger.LevelWarn, "error preparing database query %#v: %v", q, err)
+		return false, err
+	}
+	defer stmt.Close()
+
+	res, err := stmt.ExecContext(ctx, leaseUntil, id, ActionDeliveryStatusPending, nextAttempt)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func sqlCommonUpdateActionDelivery(delivery *ActionDelivery, dbHandle *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+	q := getUpdateActionDeliveryQuery()
+	stmt, err := dbHandle.PrepareContext(ctx, q)
+	if err != nil {
+		providerLog(logger.LevelWarn, "error preparing database query %#v: %v", q, err)
+		return err
+	}
+	defer stmt.Close()
+
+	delivered, err := json.Marshal(delivery.Delivered)
+	if err != nil {
+		return err
+	}
+	_, err = stmt.ExecContext(ctx, delivery.Status, delivery.Attempts, delivery.NextAttempt, delivery.LastError,
+		string(delivered), delivery.UpdatedAt, delivery.ID)
+	return err
+}
+
+func sqlCommonDeleteActionDelivery(id int64, dbHandle *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSQLQueryTimeout)
+	defer cancel()
+	q := getDeleteActionDeliveryQuery()
+	stmt, err := dbHandle.PrepareContext(ctx, q)
+	if err != nil {
+		providerLog(logger.LevelWarn, "error preparing database query %#v: %v", q, err)
+		return err
+	}
+	defer stmt.Close()
+
+	res, err := stmt.ExecContext(ctx, id)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return &RecordNotFoundError{err: fmt.Sprintf("action delivery %v does not exist", id)}
+	}
+	return nil
+}
+
+func sqlCommonRetryFailedActionDeliveries(nextAttempt int64, dbHandle *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), longSQLQueryTimeout)
+	defer cancel()
+	q := getRetryActionDeliveriesQuery()
+	stmt, err := dbHandle.PrepareContext(ctx, q)
+	if err != nil {
+		providerLog(logger.LevelWarn, "error preparing database query %#v: %v", q, err)
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, ActionDeliveryStatusPending, nextAttempt, utils.GetTimeAsMsSinceEpoch(time.Now()),
+		ActionDeliveryStatusFailed)
+	return err
+}
+
+func sqlCommonPurgeActionDeliveries(status int, dbHandle *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), longSQLQueryTimeout)
+	defer cancel()
+	q := getPurgeActionDeliveriesQuery()
+	stmt, err := dbHandle.PrepareContext(ctx, q)
+	if err != nil {
+		providerLog(logger.LevelWarn, "error preparing database query %#v: %v", q, err)
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.ExecContext(ctx, status)
+	return err
+}
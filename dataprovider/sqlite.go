@@ -99,11 +99,26 @@ SELECT "id", "path", "used_quota_size", "used_quota_files", "last_quota_update"
 DROP TABLE "{{folders}}";
 ALTER TABLE "new__folders" RENAME TO "{{folders}}";
 `
+	sqliteV9SQL = `CREATE TABLE "{{multipart_uploads}}" ("id" integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+"username" varchar(255) NOT NULL, "path" varchar(512) NOT NULL, "upload_id" text NOT NULL, "parts" text NULL,
+"created_at" bigint NOT NULL, "updated_at" bigint NOT NULL,
+CONSTRAINT "multipart_uploads_unique" UNIQUE ("username", "path"));
+CREATE INDEX "multipart_uploads_updated_at_idx" ON "{{multipart_uploads}}" ("updated_at");
+`
+	sqliteV9DownSQL = `DROP TABLE "{{multipart_uploads}}";`
+	sqliteV10SQL    = `CREATE TABLE "{{action_deliveries}}" ("id" integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+"action" varchar(50) NOT NULL, "username" varchar(255) NOT NULL, "notification" text NOT NULL,
+"status" integer NOT NULL, "attempts" integer NOT NULL, "next_attempt" bigint NOT NULL, "last_error" text NULL,
+"delivered" text NULL, "created_at" bigint NOT NULL, "updated_at" bigint NOT NULL);
+CREATE INDEX "action_deliveries_status_next_attempt_idx" ON "{{action_deliveries}}" ("status", "next_attempt");
+`
+	sqliteV10DownSQL = `DROP TABLE "{{action_deliveries}}";`
 )
 
 // SQLiteProvider auth provider for SQLite database
 type SQLiteProvider struct {
-	dbHandle *sql.DB
+	dbHandle         *sql.DB
+	connectionString string
 }
 
 func init() {
@@ -130,7 +145,7 @@ func initializeSQLiteProvider(basePath string) error {
 	if err == nil {
 		providerLog(logger.LevelDebug, "sqlite database handle created, connection string: %#v", connectionString)
 		dbHandle.SetMaxOpenConns(1)
-		provider = &SQLiteProvider{dbHandle: dbHandle}
+		provider = &SQLiteProvider{dbHandle: dbHandle, connectionString: connectionString}
 	} else {
 		providerLog(logger.LevelWarn, "error creating sqlite database handler, connection string: %#v, error: %v",
 			connectionString, err)
@@ -138,6 +153,10 @@ func initializeSQLiteProvider(basePath string) error {
 	return err
 }
 
+func (p *SQLiteProvider) getSQLHandle() (*sql.DB, string) {
+	return p.dbHandle, p.connectionString
+}
+
 func (p *SQLiteProvider) checkAvailability() error {
 	return sqlCommonCheckAvailability(p.dbHandle)
 }
@@ -248,6 +267,62 @@ func (p *SQLiteProvider) validateAdminAndPass(username, password, ip string) (Ad
 	return sqlCommonValidateAdminAndPass(username, password, ip, p.dbHandle)
 }
 
+func (p *SQLiteProvider) getMultipartUpload(username, name string) (vfs.MultipartUpload, error) {
+	return sqlCommonGetMultipartUpload(username, name, p.dbHandle)
+}
+
+func (p *SQLiteProvider) saveMultipartUpload(username string, upload *vfs.MultipartUpload) error {
+	return sqlCommonSaveMultipartUpload(username, upload, p.dbHandle)
+}
+
+func (p *SQLiteProvider) deleteMultipartUpload(username, name string) error {
+	return sqlCommonDeleteMultipartUpload(username, name, p.dbHandle)
+}
+
+func (p *SQLiteProvider) getExpiredMultipartUploads(updatedBefore int64, limit int) ([]MultipartUpload, error) {
+	return sqlCommonGetExpiredMultipartUploads(updatedBefore, limit, p.dbHandle)
+}
+
+func (p *SQLiteProvider) getUserMultipartUploads(username string) ([]MultipartUpload, error) {
+	return sqlCommonGetUserMultipartUploads(username, p.dbHandle)
+}
+
+func (p *SQLiteProvider) addActionDelivery(delivery *ActionDelivery) error {
+	return sqlCommonAddActionDelivery(delivery, p.dbHandle)
+}
+
+func (p *SQLiteProvider) getActionDelivery(id int64) (ActionDelivery, error) {
+	return sqlCommonGetActionDelivery(id, p.dbHandle)
+}
+
+func (p *SQLiteProvider) getActionDeliveries(status, limit, offset int, order string) ([]ActionDelivery, error) {
+	return sqlCommonGetActionDeliveries(status, limit, offset, order, p.dbHandle)
+}
+
+func (p *SQLiteProvider) getDueActionDeliveries(nextAttemptBefore int64, limit int) ([]ActionDelivery, error) {
+	return sqlCommonGetDueActionDeliveries(nextAttemptBefore, limit, p.dbHandle)
+}
+
+func (p *SQLiteProvider) claimActionDelivery(id, nextAttempt, leaseUntil int64) (bool, error) {
+	return sqlCommonClaimActionDelivery(id, nextAttempt, leaseUntil, p.dbHandle)
+}
+
+func (p *SQLiteProvider) updateActionDelivery(delivery *ActionDelivery) error {
+	return sqlCommonUpdateActionDelivery(delivery, p.dbHandle)
+}
+
+func (p *SQLiteProvider) deleteActionDelivery(id int64) error {
+	return sqlCommonDeleteActionDelivery(id, p.dbHandle)
+}
+
+func (p *SQLiteProvider) retryFailedActionDeliveries(nextAttempt int64) error {
+	return sqlCommonRetryFailedActionDeliveries(nextAttempt, p.dbHandle)
+}
+
+func (p *SQLiteProvider) purgeActionDeliveries(status int) error {
+	return sqlCommonPurgeActionDeliveries(status, p.dbHandle)
+}
+
 func (p *SQLiteProvider) close() error {
 	return p.dbHandle.Close()
 }
@@ -309,6 +384,10 @@ func (p *SQLiteProvider) migrateDatabase() error {
 		return updateSQLiteDatabaseFromV6(p.dbHandle)
 	case 7:
 		return updateSQLiteDatabaseFromV7(p.dbHandle)
+	case 8:
+		return updateSQLiteDatabaseFromV8(p.dbHandle)
+	case 9:
+		return updateSQLiteDatabaseFromV9(p.dbHandle)
 	default:
 		if dbVersion.Version > sqlDatabaseVersion {
 			providerLog(logger.LevelWarn, "database version %v is newer than the supported: %v", dbVersion.Version,
@@ -331,6 +410,46 @@ func (p *SQLiteProvider) revertDatabase(targetVersion int) error {
 		return fmt.Errorf("current version match target version, nothing to do")
 	}
 	switch dbVersion.Version {
+	case 10:
+		err = downgradeSQLiteDatabaseFrom10To9(p.dbHandle)
+		if err != nil {
+			return err
+		}
+		err = downgradeSQLiteDatabaseFrom9To8(p.dbHandle)
+		if err != nil {
+			return err
+		}
+		err = downgradeSQLiteDatabaseFrom8To7(p.dbHandle)
+		if err != nil {
+			return err
+		}
+		err = downgradeSQLiteDatabaseFrom7To6(p.dbHandle)
+		if err != nil {
+			return err
+		}
+		err = downgradeSQLiteDatabaseFrom6To5(p.dbHandle)
+		if err != nil {
+			return err
+		}
+		return downgradeSQLiteDatabaseFrom5To4(p.dbHandle)
+	case 9:
+		err = downgradeSQLiteDatabaseFrom9To8(p.dbHandle)
+		if err != nil {
+			return err
+		}
+		err = downgradeSQLiteDatabaseFrom8To7(p.dbHandle)
+		if err != nil {
+			return err
+		}
+		err = downgradeSQLiteDatabaseFrom7To6(p.dbHandle)
+		if err != nil {
+			return err
+		}
+		err = downgradeSQLiteDatabaseFrom6To5(p.dbHandle)
+		if err != nil {
+			return err
+		}
+		return downgradeSQLiteDatabaseFrom5To4(p.dbHandle)
 	case 8:
 		err = downgradeSQLiteDatabaseFrom8To7(p.dbHandle)
 		if err != nil {
@@ -417,7 +536,23 @@ func updateSQLiteDatabaseFromV6(dbHandle *sql.DB) error {
 }
 
 func updateSQLiteDatabaseFromV7(dbHandle *sql.DB) error {
-	return updateSQLiteDatabaseFrom7To8(dbHandle)
+	err := updateSQLiteDatabaseFrom7To8(dbHandle)
+	if err != nil {
+		return err
+	}
+	return updateSQLiteDatabaseFromV8(dbHandle)
+}
+
+func updateSQLiteDatabaseFromV8(dbHandle *sql.DB) error {
+	err := updateSQLiteDatabaseFrom8To9(dbHandle)
+	if err != nil {
+		return err
+	}
+	return updateSQLiteDatabaseFromV9(dbHandle)
+}
+
+func updateSQLiteDatabaseFromV9(dbHandle *sql.DB) error {
+	return updateSQLiteDatabaseFrom9To10(dbHandle)
 }
 
 func updateSQLiteDatabaseFrom1To2(dbHandle *sql.DB) error {
@@ -469,6 +604,20 @@ func updateSQLiteDatabaseFrom7To8(dbHandle *sql.DB) error {
 	return setPragmaFK(dbHandle, "ON")
 }
 
+func updateSQLiteDatabaseFrom8To9(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database version: 8 -> 9")
+	providerLog(logger.LevelInfo, "updating database version: 8 -> 9")
+	sql := strings.ReplaceAll(sqliteV9SQL, "{{multipart_uploads}}", sqlTableMultipartUploads)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 9)
+}
+
+func updateSQLiteDatabaseFrom9To10(dbHandle *sql.DB) error {
+	logger.InfoToConsole("updating database version: 9 -> 10")
+	providerLog(logger.LevelInfo, "updating database version: 9 -> 10")
+	sql := strings.ReplaceAll(sqliteV10SQL, "{{action_deliveries}}", sqlTableActionDeliveries)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 10)
+}
+
 func setPragmaFK(dbHandle *sql.DB, value string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), longSQLQueryTimeout)
 	defer cancel()
@@ -479,6 +628,20 @@ func setPragmaFK(dbHandle *sql.DB, value string) error {
 	return err
 }
 
+func downgradeSQLiteDatabaseFrom10To9(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database version: 10 -> 9")
+	providerLog(logger.LevelInfo, "downgrading database version: 10 -> 9")
+	sql := strings.Replace(sqliteV10DownSQL, "{{action_deliveries}}", sqlTableActionDeliveries, 1)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 9)
+}
+
+func downgradeSQLiteDatabaseFrom9To8(dbHandle *sql.DB) error {
+	logger.InfoToConsole("downgrading database version: 9 -> 8")
+	providerLog(logger.LevelInfo, "downgrading database version: 9 -> 8")
+	sql := strings.Replace(sqliteV9DownSQL, "{{multipart_uploads}}", sqlTableMultipartUploads, 1)
+	return sqlCommonExecSQLAndUpdateDBVersion(dbHandle, []string{sql}, 8)
+}
+
 func downgradeSQLiteDatabaseFrom8To7(dbHandle *sql.DB) error {
 	logger.InfoToConsole("downgrading database version: 8 -> 7")
 	providerLog(logger.LevelInfo, "downgrading database version: 8 -> 7")
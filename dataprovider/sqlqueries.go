@@ -11,8 +11,10 @@ import (
 const (
 	selectUserFields = "id,username,password,public_keys,home_dir,uid,gid,max_sessions,quota_size,quota_files,permissions,used_quota_size," +
 		"used_quota_files,last_quota_update,upload_bandwidth,download_bandwidth,expiration_date,last_login,status,filters,filesystem,additional_info"
-	selectFolderFields = "id,path,used_quota_size,used_quota_files,last_quota_update,name"
-	selectAdminFields  = "id,username,password,status,email,permissions,filters,additional_info"
+	selectFolderFields          = "id,path,used_quota_size,used_quota_files,last_quota_update,name"
+	selectAdminFields           = "id,username,password,status,email,permissions,filters,additional_info"
+	selectMultipartUploadFields = "username,path,upload_id,parts,created_at,updated_at"
+	selectActionDeliveryFields  = "id,action,username,notification,status,attempts,next_attempt,last_error,delivered,created_at,updated_at"
 )
 
 func getSQLPlaceholders() []string {
@@ -215,3 +217,85 @@ func getCompatV4FsConfigQuery() string {
 func updateCompatV4FsConfigQuery() string {
 	return fmt.Sprintf(`UPDATE %v SET filesystem=%v WHERE id=%v`, sqlTableUsers, sqlPlaceholders[0], sqlPlaceholders[1])
 }
+
+func getMultipartUploadQuery() string {
+	return fmt.Sprintf(`SELECT %v FROM %v WHERE username = %v AND path = %v`, selectMultipartUploadFields,
+		sqlTableMultipartUploads, sqlPlaceholders[0], sqlPlaceholders[1])
+}
+
+func getAddMultipartUploadQuery() string {
+	return fmt.Sprintf(`INSERT INTO %v (username,path,upload_id,parts,created_at,updated_at) VALUES (%v,%v,%v,%v,%v,%v)`,
+		sqlTableMultipartUploads, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2], sqlPlaceholders[3],
+		sqlPlaceholders[4], sqlPlaceholders[5])
+}
+
+func getDeleteMultipartUploadQuery() string {
+	return fmt.Sprintf(`DELETE FROM %v WHERE username = %v AND path = %v`, sqlTableMultipartUploads,
+		sqlPlaceholders[0], sqlPlaceholders[1])
+}
+
+func getExpiredMultipartUploadsQuery() string {
+	return fmt.Sprintf(`SELECT %v FROM %v WHERE updated_at < %v ORDER BY updated_at LIMIT %v`, selectMultipartUploadFields,
+		sqlTableMultipartUploads, sqlPlaceholders[0], sqlPlaceholders[1])
+}
+
+func getUserMultipartUploadsQuery() string {
+	return fmt.Sprintf(`SELECT %v FROM %v WHERE username = %v`, selectMultipartUploadFields, sqlTableMultipartUploads,
+		sqlPlaceholders[0])
+}
+
+func getAddActionDeliveryQuery() string {
+	q := fmt.Sprintf(`INSERT INTO %v (action,username,notification,status,attempts,next_attempt,last_error,delivered,
+		created_at,updated_at) VALUES (%v,%v,%v,%v,%v,%v,%v,%v,%v,%v)`, sqlTableActionDeliveries, sqlPlaceholders[0],
+		sqlPlaceholders[1], sqlPlaceholders[2], sqlPlaceholders[3], sqlPlaceholders[4], sqlPlaceholders[5],
+		sqlPlaceholders[6], sqlPlaceholders[7], sqlPlaceholders[8], sqlPlaceholders[9])
+	if config.Driver == PGSQLDataProviderName {
+		// PostgreSQL does not support LastInsertId
+		q += " RETURNING id"
+	}
+	return q
+}
+
+func getActionDeliveryQuery() string {
+	return fmt.Sprintf(`SELECT %v FROM %v WHERE id = %v`, selectActionDeliveryFields, sqlTableActionDeliveries,
+		sqlPlaceholders[0])
+}
+
+func getActionDeliveriesQuery(order string) string {
+	return fmt.Sprintf(`SELECT %v FROM %v ORDER BY id %v LIMIT %v OFFSET %v`, selectActionDeliveryFields,
+		sqlTableActionDeliveries, order, sqlPlaceholders[0], sqlPlaceholders[1])
+}
+
+func getActionDeliveriesWithStatusQuery(order string) string {
+	return fmt.Sprintf(`SELECT %v FROM %v WHERE status = %v ORDER BY id %v LIMIT %v OFFSET %v`, selectActionDeliveryFields,
+		sqlTableActionDeliveries, sqlPlaceholders[0], order, sqlPlaceholders[1], sqlPlaceholders[2])
+}
+
+func getDueActionDeliveriesQuery() string {
+	return fmt.Sprintf(`SELECT %v FROM %v WHERE status = %v AND next_attempt <= %v ORDER BY next_attempt LIMIT %v`,
+		selectActionDeliveryFields, sqlTableActionDeliveries, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2])
+}
+
+func getClaimActionDeliveryQuery() string {
+	return fmt.Sprintf(`UPDATE %v SET next_attempt = %v WHERE id = %v AND status = %v AND next_attempt = %v`,
+		sqlTableActionDeliveries, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2], sqlPlaceholders[3])
+}
+
+func getUpdateActionDeliveryQuery() string {
+	return fmt.Sprintf(`UPDATE %v SET status = %v, attempts = %v, next_attempt = %v, last_error = %v, delivered = %v,
+		updated_at = %v WHERE id = %v`, sqlTableActionDeliveries, sqlPlaceholders[0], sqlPlaceholders[1],
+		sqlPlaceholders[2], sqlPlaceholders[3], sqlPlaceholders[4], sqlPlaceholders[5], sqlPlaceholders[6])
+}
+
+func getDeleteActionDeliveryQuery() string {
+	return fmt.Sprintf(`DELETE FROM %v WHERE id = %v`, sqlTableActionDeliveries, sqlPlaceholders[0])
+}
+
+func getRetryActionDeliveriesQuery() string {
+	return fmt.Sprintf(`UPDATE %v SET status = %v, attempts = 0, next_attempt = %v, updated_at = %v WHERE status = %v`,
+		sqlTableActionDeliveries, sqlPlaceholders[0], sqlPlaceholders[1], sqlPlaceholders[2], sqlPlaceholders[3])
+}
+
+func getPurgeActionDeliveriesQuery() string {
+	return fmt.Sprintf(`DELETE FROM %v WHERE status = %v`, sqlTableActionDeliveries, sqlPlaceholders[0])
+}
@@ -123,6 +123,15 @@ type PatternsFilter struct {
 	DeniedPatterns []string `json:"denied_patterns,omitempty"`
 }
 
+// FolderMapping maps a client visible folder to a directory inside the user storage
+type FolderMapping struct {
+	// Prefix is the absolute path seen by the client, for example /inbound
+	Prefix string `json:"prefix"`
+	// MappedPath is the absolute virtual path, inside the user home, the prefix
+	// contents are mapped to
+	MappedPath string `json:"mapped_path"`
+}
+
 // UserFilters defines additional restrictions for a user
 type UserFilters struct {
 	// only clients connecting from these IP/Mask are allowed.
@@ -145,6 +154,14 @@ type UserFilters struct {
 	FilePatterns []PatternsFilter `json:"file_patterns,omitempty"`
 	// max size allowed for a single upload, 0 means unlimited
 	MaxUploadFileSize int64 `json:"max_upload_file_size,omitempty"`
+	// virtual root folder prefix to include in all file operations, for example /files.
+	// Empty means the globally configured default is used, "/" disables the prefix
+	FolderPrefix string `json:"folder_prefix,omitempty"`
+	// mount style entry points, each one mapped to a different directory of the user
+	// storage. If set the folder prefix is ignored
+	FolderMappings []FolderMapping `json:"folder_mappings,omitempty"`
+	// initial working directory, as a path inside the user home. Empty means "/"
+	LoginDir string `json:"login_dir,omitempty"`
 }
 
 // FilesystemProvider defines the supported storages
@@ -224,17 +241,41 @@ type User struct {
 	AdditionalInfo string `json:"additional_info,omitempty"`
 }
 
+// hasSameCloudStorage returns true if the cloud storage bucket or container for
+// this user is the same as for the other one, the multipart uploads started by
+// this user can be found using the other storage configuration in this case
+func (u *User) hasSameCloudStorage(other *User) bool {
+	if u.FsConfig.Provider != other.FsConfig.Provider {
+		return false
+	}
+	switch u.FsConfig.Provider {
+	case S3FilesystemProvider:
+		return u.FsConfig.S3Config.Bucket == other.FsConfig.S3Config.Bucket &&
+			u.FsConfig.S3Config.Region == other.FsConfig.S3Config.Region &&
+			u.FsConfig.S3Config.Endpoint == other.FsConfig.S3Config.Endpoint
+	case GCSFilesystemProvider:
+		return u.FsConfig.GCSConfig.Bucket == other.FsConfig.GCSConfig.Bucket
+	case AzureBlobFilesystemProvider:
+		return u.FsConfig.AzBlobConfig.Container == other.FsConfig.AzBlobConfig.Container &&
+			u.FsConfig.AzBlobConfig.AccountName == other.FsConfig.AzBlobConfig.AccountName &&
+			u.FsConfig.AzBlobConfig.Endpoint == other.FsConfig.AzBlobConfig.Endpoint &&
+			u.FsConfig.AzBlobConfig.SASURL == other.FsConfig.AzBlobConfig.SASURL
+	default:
+		return true
+	}
+}
+
 // GetFilesystem returns the filesystem for this user
 func (u *User) GetFilesystem(connectionID string) (vfs.Fs, error) {
 	switch u.FsConfig.Provider {
 	case S3FilesystemProvider:
-		return vfs.NewS3Fs(connectionID, u.GetHomeDir(), u.FsConfig.S3Config)
+		return u.withMultipartUploadStore(vfs.NewS3Fs(connectionID, u.GetHomeDir(), u.FsConfig.S3Config))
 	case GCSFilesystemProvider:
 		config := u.FsConfig.GCSConfig
 		config.CredentialFile = u.getGCSCredentialsFilePath()
 		return vfs.NewGCSFs(connectionID, u.GetHomeDir(), config)
 	case AzureBlobFilesystemProvider:
-		return vfs.NewAzBlobFs(connectionID, u.GetHomeDir(), u.FsConfig.AzBlobConfig)
+		return u.withMultipartUploadStore(vfs.NewAzBlobFs(connectionID, u.GetHomeDir(), u.FsConfig.AzBlobConfig))
 	case CryptedFilesystemProvider:
 		return vfs.NewCryptFs(connectionID, u.GetHomeDir(), u.FsConfig.CryptConfig)
 	case SFTPFilesystemProvider:
@@ -668,6 +709,43 @@ func (u *User) GetPublicKeysAsJSON() ([]byte, error) {
 	return json.Marshal(u.PublicKeys)
 }
 
+// GetFolderPrefix returns the virtual root folder prefix for this user, defaultPrefix
+// is used if the user has no prefix. An empty string means no prefix
+func (u *User) GetFolderPrefix(defaultPrefix string) string {
+	prefix := u.Filters.FolderPrefix
+	if prefix == "" {
+		prefix = defaultPrefix
+	}
+	if prefix == "/" {
+		return ""
+	}
+	return prefix
+}
+
+// GetFolderMappings returns the folder mappings for this user. If the user has no
+// mappings, the folder prefix, if any, is mapped to the home directory
+func (u *User) GetFolderMappings(defaultPrefix string) []FolderMapping {
+	if len(u.Filters.FolderMappings) > 0 {
+		mappings := make([]FolderMapping, len(u.Filters.FolderMappings))
+		copy(mappings, u.Filters.FolderMappings)
+		return mappings
+	}
+	prefix := u.GetFolderPrefix(defaultPrefix)
+	if prefix == "" {
+		return nil
+	}
+	return []FolderMapping{{Prefix: prefix, MappedPath: "/"}}
+}
+
+// GetLoginDir returns the initial working directory for this user as a path
+// inside the home directory
+func (u *User) GetLoginDir() string {
+	if u.Filters.LoginDir == "" {
+		return "/"
+	}
+	return u.Filters.LoginDir
+}
+
 // GetFiltersAsJSON returns the filters as json byte array
 func (u *User) GetFiltersAsJSON() ([]byte, error) {
 	return json.Marshal(u.Filters)
@@ -856,6 +934,10 @@ func (u *User) getACopy() User {
 	}
 	filters := UserFilters{}
 	filters.MaxUploadFileSize = u.Filters.MaxUploadFileSize
+	filters.FolderPrefix = u.Filters.FolderPrefix
+	filters.FolderMappings = make([]FolderMapping, len(u.Filters.FolderMappings))
+	copy(filters.FolderMappings, u.Filters.FolderMappings)
+	filters.LoginDir = u.Filters.LoginDir
 	filters.AllowedIP = make([]string, len(u.Filters.AllowedIP))
 	copy(filters.AllowedIP, u.Filters.AllowedIP)
 	filters.DeniedIP = make([]string, len(u.Filters.DeniedIP))
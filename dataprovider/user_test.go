@@ -0,0 +1,77 @@
+package dataprovider
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserFolderPrefix(t *testing.T) {
+	user := User{}
+	assert.Equal(t, "", user.GetFolderPrefix(""))
+	assert.Equal(t, "/files", user.GetFolderPrefix("/files"))
+	user.Filters.FolderPrefix = "/inbound/acme"
+	assert.Equal(t, "/inbound/acme", user.GetFolderPrefix("/files"))
+	// "/" disables the default prefix
+	user.Filters.FolderPrefix = "/"
+	assert.Equal(t, "", user.GetFolderPrefix("/files"))
+
+	user.Filters.FolderPrefix = "/inbound/acme/../acme/"
+	assert.NoError(t, validateFolderPrefix(&user))
+	assert.Equal(t, "/inbound/acme", user.Filters.FolderPrefix)
+	user.Filters.FolderPrefix = "inbound"
+	assert.Error(t, validateFolderPrefix(&user))
+	assert.Equal(t, "inbound", user.getACopy().Filters.FolderPrefix)
+}
+
+func TestUserFolderMappings(t *testing.T) {
+	user := User{}
+	assert.Nil(t, user.GetFolderMappings(""))
+	assert.Equal(t, []FolderMapping{{Prefix: "/files", MappedPath: "/"}}, user.GetFolderMappings("/files"))
+	user.Filters.FolderMappings = []FolderMapping{
+		{Prefix: "/outbound/", MappedPath: "/out/../out"},
+		{Prefix: "/inbound", MappedPath: "/in"},
+	}
+	assert.NoError(t, validateFolderMappings(&user))
+	assert.Equal(t, []FolderMapping{
+		{Prefix: "/outbound", MappedPath: "/out"},
+		{Prefix: "/inbound", MappedPath: "/in"},
+	}, user.GetFolderMappings("/files"))
+	assert.Len(t, user.getACopy().Filters.FolderMappings, 2)
+
+	user.Filters.FolderPrefix = "/files"
+	assert.Error(t, validateFolderMappings(&user))
+	user.Filters.FolderPrefix = ""
+	user.Filters.FolderMappings = append(user.Filters.FolderMappings, FolderMapping{
+		Prefix:     "/inbound/acme",
+		MappedPath: "/acme",
+	})
+	assert.Error(t, validateFolderMappings(&user))
+	user.Filters.FolderMappings = []FolderMapping{
+		{Prefix: "/", MappedPath: "/"},
+		{Prefix: "/inbound", MappedPath: "/in"},
+	}
+	assert.Error(t, validateFolderMappings(&user))
+	user.Filters.FolderMappings = []FolderMapping{{Prefix: "inbound", MappedPath: "/in"}}
+	assert.Error(t, validateFolderMappings(&user))
+	user.Filters.FolderMappings = []FolderMapping{{Prefix: "/inbound", MappedPath: "in"}}
+	assert.Error(t, validateFolderMappings(&user))
+	user.Filters.FolderMappings = []FolderMapping{}
+	assert.NoError(t, validateFolderMappings(&user))
+	assert.Nil(t, user.Filters.FolderMappings)
+}
+
+func TestUserLoginDir(t *testing.T) {
+	user := User{}
+	assert.NoError(t, validateLoginDir(&user))
+	assert.Equal(t, "/", user.GetLoginDir())
+	user.Filters.LoginDir = "/inbound/acme/../acme/"
+	assert.NoError(t, validateLoginDir(&user))
+	assert.Equal(t, "/inbound/acme", user.GetLoginDir())
+	assert.Equal(t, "/inbound/acme", user.getACopy().Filters.LoginDir)
+	user.Filters.LoginDir = "/"
+	assert.NoError(t, validateLoginDir(&user))
+	assert.Empty(t, user.Filters.LoginDir)
+	user.Filters.LoginDir = "inbound"
+	assert.Error(t, validateLoginDir(&user))
+}
@@ -0,0 +1,75 @@
+//go:build !noazblob
+// +build !noazblob
+
+package fsmeta
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+
+	"github.com/drakkan/sftpgo/metrics"
+)
+
+const (
+	// AzureBlobMetaKey is the blob metadata name, Azure metadata names
+	// must be valid C# identifiers so we cannot use S3MetaKey here
+	AzureBlobMetaKey = `Fs_Mtime`
+)
+
+type azureBlobProvider struct {
+	container azblob.ContainerURL
+	name      string
+}
+
+// NewAzureBlobProvider returns a Store reading the fsmeta modification time
+// from the Azure blob metadata
+func NewAzureBlobProvider(Container azblob.ContainerURL, Name string) Store {
+	return &azureBlobProvider{
+		container: Container,
+		name:      Name,
+	}
+}
+
+func (a *azureBlobProvider) Location() string {
+	return Location(SchemeAzureBlob, a.name)
+}
+
+func (a *azureBlobProvider) Get(ctx context.Context, Key Key) (Meta, error) {
+	Props, err := a.container.NewBlobURL(Key.Path).GetProperties(ctx, azblob.BlobAccessConditions{},
+		azblob.ClientProvidedKeyOptions{})
+	metrics.AZHeadObjectCompleted(err)
+	if err != nil {
+		if storageErr, ok := err.(azblob.StorageError); ok {
+			if storageErr.ServiceCode() == azblob.ServiceCodeBlobNotFound ||
+				storageErr.Response().StatusCode == http.StatusNotFound { //nolint:bodyclose
+				return Meta{
+					Key:          Key,
+					LastModified: Key.StoreTime,
+				}, nil
+			}
+		}
+		return Meta{}, err
+	}
+
+	FSTime, err := StringMetaHelper(Props.NewMetadata()).GetTime(AzureBlobMetaKey)
+	if err != nil || FSTime.IsZero() {
+		FSTime = Key.StoreTime
+	}
+	return Meta{
+		Key:          Key,
+		LastModified: FSTime,
+	}, nil
+}
+
+// NewAzureBlobMetadata returns the blob metadata storing the given modification time
+func NewAzureBlobMetadata(T time.Time) azblob.Metadata {
+	if !Enabled || T.IsZero() {
+		return azblob.Metadata{}
+	}
+	return azblob.Metadata{
+		AzureBlobMetaKey: T.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,73 @@
+package fsmeta
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAzureBlobProvider(t *testing.T) {
+	StoreTime := time.Date(2020, time.February, 23, 13, 45, 21, 0, time.UTC)
+	LastModified := StoreTime.Add(-time.Hour)
+
+	Server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case `/container1/users/test1/test.csv`:
+			w.Header().Set(`x-ms-meta-fs_mtime`, LastModified.Format(time.RFC3339))
+			w.WriteHeader(http.StatusOK)
+		case `/container1/users/test1/nometa.csv`:
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.Header().Set(`x-ms-error-code`, string(azblob.ServiceCodeBlobNotFound))
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer Server.Close()
+
+	u, err := url.Parse(Server.URL + `/container1`)
+	require.NoError(t, err)
+	Container := azblob.NewContainerURL(*u, azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{
+		Retry: azblob.RetryOptions{
+			MaxTries: 1,
+		},
+	}))
+	Store := NewAzureBlobProvider(Container, `container1`)
+	assert.Equal(t, `azblob://container1`, Store.Location())
+
+	Ctx := context.Background()
+	Key1 := Key{Path: `users/test1/test.csv`, StoreTime: StoreTime, Size: 100}
+	Actual, err := Store.Get(Ctx, Key1)
+	assert.NoError(t, err)
+	assert.True(t, LastModified.Equal(Actual.LastModified))
+
+	Key2 := Key{Path: `users/test1/nometa.csv`, StoreTime: StoreTime, Size: 100}
+	Actual, err = Store.Get(Ctx, Key2)
+	assert.NoError(t, err)
+	assert.Equal(t, Meta{Key: Key2, LastModified: StoreTime}, Actual)
+
+	Key3 := Key{Path: `users/test1/missing.csv`, StoreTime: StoreTime, Size: 100}
+	Actual, err = Store.Get(Ctx, Key3)
+	assert.NoError(t, err)
+	assert.Equal(t, Meta{Key: Key3, LastModified: StoreTime}, Actual)
+}
+
+func TestNewAzureBlobMetadata(t *testing.T) {
+	EnabledRestore := Enabled
+	t.Cleanup(func() {
+		Enabled = EnabledRestore
+	})
+
+	T := time.Date(2020, time.February, 23, 13, 45, 21, 0, time.UTC)
+	Enabled = false
+	assert.Empty(t, NewAzureBlobMetadata(T))
+	Enabled = true
+	assert.Equal(t, azblob.Metadata{AzureBlobMetaKey: `2020-02-23T13:45:21Z`}, NewAzureBlobMetadata(T))
+	assert.Empty(t, NewAzureBlobMetadata(time.Time{}))
+}
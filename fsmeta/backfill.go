@@ -0,0 +1,326 @@
+package fsmeta
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"golang.org/x/time/rate"
+
+	"github.com/drakkan/sftpgo/logger"
+	"github.com/drakkan/sftpgo/metrics"
+)
+
+const (
+	defaultBackfillWorkers   = 8
+	defaultBackfillBatchSize = 500
+)
+
+// BackfillOptions configures a backfill job
+type BackfillOptions struct {
+	Prefix string
+	// Workers is the number of concurrent HEAD requests, default 8
+	Workers int
+	// RateLimit is the maximum number of HEAD requests per second, 0 means unlimited
+	RateLimit float64
+	// BatchSize is the maximum number of rows stored by a single batch, default 500
+	BatchSize int
+	// Checkpoint is the path of the file used to resume an interrupted job. The last
+	// listed key is saved after every stored page, but never past the first key whose
+	// metadata cannot be read, so a new run retries the failed keys. The file is removed
+	// once the job completes without errors. Empty means the job is not resumable
+	Checkpoint string
+}
+
+// BackfillReport describes a completed, or interrupted, backfill job
+type BackfillReport struct {
+	Location string `json:"location"`
+	Prefix   string `json:"prefix"`
+	// StartAfter is the key the job was resumed after, if any
+	StartAfter string `json:"start_after,omitempty"`
+	// Scanned is the number of objects listed
+	Scanned int `json:"scanned"`
+	// Skipped is the number of objects with up to date metadata
+	Skipped int `json:"skipped"`
+	// Backfilled is the number of objects whose metadata were stored
+	Backfilled int      `json:"backfilled"`
+	Errors     []string `json:"errors,omitempty"`
+}
+
+// folderLoader is implemented by the providers able to read the files stored
+// inside a single folder without scanning its sub folders
+type folderLoader interface {
+	loadFolder(ctx context.Context, Folder string) (fileMap, error)
+}
+
+// loadStoredFolder returns the metadata stored for the files inside Folder
+func loadStoredFolder(ctx context.Context, Provider Provider, Folder string) (fileMap, error) {
+	if Loader, ok := Provider.(folderLoader); ok {
+		return Loader.loadFolder(ctx, Folder)
+	}
+	return scanFolder(ctx, Provider, Folder)
+}
+
+// scanFolder returns the metadata stored for the files inside Folder, filtering
+// out the sub folders from the scanned ones
+func scanFolder(ctx context.Context, Provider Scanner, Folder string) (fileMap, error) {
+	Files := make(fileMap)
+	err := Provider.Scan(ctx, Folder, func(M Meta) error {
+		if !strings.Contains(strings.TrimPrefix(M.Key.Path, Folder), `/`) {
+			Files[M.Key.Path] = M
+		}
+		return nil
+	})
+	return Files, err
+}
+
+type backfillCheckpoint struct {
+	Location string `json:"location"`
+	Prefix   string `json:"prefix"`
+	LastKey  string `json:"last_key"`
+}
+
+// BackfillS3 walks the given bucket prefix and stores the metadata of the objects
+// without up to date stored ones, reading Fs-Mtime with concurrent HEAD requests.
+// The listing pages are processed in order and each page is stored in batches
+// before saving the checkpoint, so an interrupted job can be resumed
+func BackfillS3(ctx context.Context, S3 S3API, Bucket string, Options BackfillOptions) (BackfillReport, error) {
+	Report := BackfillReport{
+		Location: Location(SchemeS3, Bucket),
+		Prefix:   Options.Prefix,
+	}
+	if !EnabledForBucket(Bucket) || DefaultFactory == nil {
+		return Report, ErrNotEnabled
+	}
+	if Options.Workers <= 0 {
+		Options.Workers = defaultBackfillWorkers
+	}
+	if Options.BatchSize <= 0 {
+		Options.BatchSize = defaultBackfillBatchSize
+	}
+	Limiter := rate.NewLimiter(rate.Inf, 1)
+	if Options.RateLimit > 0 {
+		Limiter = rate.NewLimiter(rate.Limit(Options.RateLimit), 1)
+	}
+	Store := NewS3Provider(S3, Bucket)
+	Provider := DefaultFactory.New(Store)
+
+	StartAfter, err := readBackfillCheckpoint(Options.Checkpoint, Report.Location, Options.Prefix)
+	if err != nil {
+		return Report, err
+	}
+	Report.StartAfter = StartAfter
+	// LastKey is the key to resume after, it does not advance once a key fails
+	LastKey := StartAfter
+	Failed := false
+
+	Input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(Bucket),
+		Prefix: aws.String(Options.Prefix),
+	}
+	if StartAfter != `` {
+		Input.StartAfter = aws.String(StartAfter)
+	}
+	var PageErr error
+	err = S3.ListObjectsV2PagesWithContext(ctx, Input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		var Keys []Key
+		// the stored metadata are loaded one folder at a time for the listed page only
+		Stored := make(map[string]fileMap)
+		for _, Object := range page.Contents {
+			Path := aws.StringValue(Object.Key)
+			if strings.HasSuffix(Path, `/`) {
+				continue
+			}
+			Report.Scanned++
+			ObjectKey := Key{
+				Path:      Path,
+				ETag:      aws.StringValue(Object.ETag),
+				StoreTime: aws.TimeValue(Object.LastModified),
+				Size:      aws.Int64Value(Object.Size),
+			}
+			Folder, _, ok := splitPath(Path)
+			if _, loaded := Stored[Folder]; ok && !loaded {
+				if Stored[Folder], PageErr = loadStoredFolder(ctx, Provider, Folder); PageErr != nil {
+					return false
+				}
+			}
+			if M, ok := Stored[Folder][Path]; ok && sameObject(M.Key, ObjectKey) {
+				Report.Skipped++
+				continue
+			}
+			Keys = append(Keys, ObjectKey)
+		}
+		Metas, Errors := fetchBackfill(ctx, Store, Limiter, Options.Workers, Keys, &Report)
+		if PageErr = ctx.Err(); PageErr != nil {
+			return false
+		}
+		for i, M := range Metas {
+			// the extended attributes set using SFTP are preserved for outdated objects
+			Folder, _, _ := splitPath(M.Key.Path)
+			if S, ok := Stored[Folder][M.Key.Path]; ok {
+				S.Key = M.Key
+				S.LastModified = M.LastModified
+				Metas[i] = S
+			}
+		}
+		for _, Batch := range splitMetas(Metas, Options.BatchSize) {
+			if PageErr = PutBatch(ctx, Provider, Batch); PageErr != nil {
+				return false
+			}
+			Report.Backfilled += len(Batch)
+		}
+		if Failed {
+			return true
+		}
+		for _, Object := range page.Contents {
+			Path := aws.StringValue(Object.Key)
+			if _, ok := Errors[Path]; ok {
+				Failed = true
+				break
+			}
+			LastKey = Path
+		}
+		if len(page.Contents) > 0 {
+			if PageErr = writeBackfillCheckpoint(Options.Checkpoint, backfillCheckpoint{
+				Location: Report.Location,
+				Prefix:   Options.Prefix,
+				LastKey:  LastKey,
+			}); PageErr != nil {
+				return false
+			}
+		}
+		return true
+	})
+	metrics.S3ListObjectsCompleted(err)
+	if err == nil {
+		err = PageErr
+	}
+	if err != nil {
+		metaLog(logger.LevelWarn, "backfill interrupted for %s/%s, scanned: %v, backfilled: %v, error: %v",
+			Report.Location, Options.Prefix, Report.Scanned, Report.Backfilled, err)
+		return Report, err
+	}
+	if Failed {
+		metaLog(logger.LevelWarn, "backfill for %s/%s completed with errors, the failed keys will be retried "+
+			"resuming after %#v", Report.Location, Options.Prefix, LastKey)
+	} else if Options.Checkpoint != `` {
+		if err := os.Remove(Options.Checkpoint); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return Report, err
+		}
+	}
+
+	metaLog(logger.LevelInfo, "backfill completed for %s/%s, start after: %#v, scanned: %v, skipped: %v, "+
+		"backfilled: %v, errors: %v", Report.Location, Options.Prefix, StartAfter, Report.Scanned, Report.Skipped,
+		Report.Backfilled, len(Report.Errors))
+	return Report, nil
+}
+
+// fetchBackfill reads the metadata for the given keys using Workers concurrent
+// requests, the failed keys are returned and added to the report errors
+func fetchBackfill(ctx context.Context, Store Getter, Limiter *rate.Limiter, Workers int, Keys []Key,
+	Report *BackfillReport) ([]Meta, map[string]error) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var Metas []Meta
+	Errors := make(map[string]error)
+	Queue := make(chan Key)
+
+	for i := 0; i < Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ObjectKey := range Queue {
+				if err := Limiter.Wait(ctx); err != nil {
+					mu.Lock()
+					Errors[ObjectKey.Path] = err
+					mu.Unlock()
+					continue
+				}
+				M, err := Store.Get(ctx, ObjectKey)
+				mu.Lock()
+				if err != nil {
+					Errors[ObjectKey.Path] = err
+					Report.Errors = append(Report.Errors, fmt.Sprintf(`%s: %v`, ObjectKey.Path, err))
+				} else {
+					Metas = append(Metas, M)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, ObjectKey := range Keys {
+		if ctx.Err() != nil {
+			break
+		}
+		Queue <- ObjectKey
+	}
+	close(Queue)
+	wg.Wait()
+	return Metas, Errors
+}
+
+func splitMetas(Metas []Meta, Size int) [][]Meta {
+	var Batches [][]Meta
+	for len(Metas) > 0 {
+		End := Size
+		if End > len(Metas) {
+			End = len(Metas)
+		}
+		Batches = append(Batches, Metas[:End])
+		Metas = Metas[End:]
+	}
+	return Batches
+}
+
+// readBackfillCheckpoint returns the key to resume after, the checkpoint is
+// ignored if missing or saved for a different location or prefix
+func readBackfillCheckpoint(Path, Location, Prefix string) (string, error) {
+	if Path == `` {
+		return ``, nil
+	}
+	Data, err := os.ReadFile(Path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ``, nil
+		}
+		return ``, err
+	}
+	var Checkpoint backfillCheckpoint
+	if err := json.Unmarshal(Data, &Checkpoint); err != nil {
+		return ``, fmt.Errorf(`fsmeta: invalid backfill checkpoint %#v: %w`, Path, err)
+	}
+	if Checkpoint.Location != Location || Checkpoint.Prefix != Prefix {
+		metaLog(logger.LevelWarn, "ignoring backfill checkpoint %#v saved for %s/%s", Path, Checkpoint.Location,
+			Checkpoint.Prefix)
+		return ``, nil
+	}
+	return Checkpoint.LastKey, nil
+}
+
+// writeBackfillCheckpoint atomically replaces the checkpoint file
+func writeBackfillCheckpoint(Path string, Checkpoint backfillCheckpoint) error {
+	if Path == `` {
+		return nil
+	}
+	Data, err := json.Marshal(Checkpoint)
+	if err != nil {
+		return err
+	}
+	Temp := filepath.Join(filepath.Dir(Path), fmt.Sprintf(`.%s.%d`, filepath.Base(Path), time.Now().UnixNano()))
+	if err := os.WriteFile(Temp, Data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(Temp, Path); err != nil {
+		os.Remove(Temp)
+		return err
+	}
+	return nil
+}
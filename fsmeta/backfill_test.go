@@ -0,0 +1,213 @@
+package fsmeta
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drakkan/sftpgo/vfs/mocks"
+)
+
+func TestBackfillS3(t *testing.T) {
+	setupInspect(t)
+	ctx := context.Background()
+	S3Mock := mocks.NewMockS3API(gomock.NewController(t))
+	Provider := DefaultFactory.New(NewS3Provider(S3Mock, `sftpgo`))
+	Checkpoint := filepath.Join(t.TempDir(), `backfill.json`)
+
+	UploadTime := time.Date(2020, time.March, 2, 10, 0, 0, 0, time.UTC)
+	ModifiedTime := time.Date(2020, time.March, 1, 8, 30, 0, 0, time.UTC)
+	Object := func(Path, ETag string, Size int64) *s3.Object {
+		return &s3.Object{Key: aws.String(Path), ETag: aws.String(`"` + ETag + `"`), Size: aws.Int64(Size),
+			LastModified: aws.Time(UploadTime)}
+	}
+	// a.csv is up to date, b.csv is outdated and its mode must be preserved
+	require.NoError(t, Provider.Put(ctx, Meta{
+		Key:          Key{Path: `users/test1/a.csv`, ETag: `etag-a`, StoreTime: UploadTime, Size: 10},
+		LastModified: ModifiedTime,
+	}))
+	require.NoError(t, Provider.Put(ctx, Meta{
+		Key:          Key{Path: `users/test1/b.csv`, ETag: `etag-b1`, StoreTime: UploadTime, Size: 20},
+		LastModified: ModifiedTime,
+		Mode:         0600,
+	}))
+	S3Mock.EXPECT().HeadObjectWithContext(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, Input *s3.HeadObjectInput, _ ...interface{}) (*s3.HeadObjectOutput, error) {
+			return &s3.HeadObjectOutput{Metadata: NewS3Metadata(ModifiedTime)}, nil
+		}).Times(3)
+
+	// the listing fails after the first page
+	S3Mock.EXPECT().ListObjectsV2PagesWithContext(gomock.Any(), &s3.ListObjectsV2Input{
+		Bucket: aws.String(`sftpgo`),
+		Prefix: aws.String(`users/test1/`),
+	}, gomock.Any()).DoAndReturn(func(_ context.Context, _ *s3.ListObjectsV2Input,
+		fn func(*s3.ListObjectsV2Output, bool) bool, _ ...interface{}) error {
+		fn(&s3.ListObjectsV2Output{
+			Contents: []*s3.Object{
+				Object(`users/test1/a.csv`, `etag-a`, 10),
+				Object(`users/test1/b.csv`, `etag-b2`, 21),
+				Object(`users/test1/dir/`, ``, 0),
+			},
+		}, false)
+		return errors.New(`listing error`)
+	})
+	Options := BackfillOptions{
+		Prefix:     `users/test1/`,
+		Workers:    2,
+		RateLimit:  100,
+		BatchSize:  1,
+		Checkpoint: Checkpoint,
+	}
+	Report, err := BackfillS3(ctx, S3Mock, `sftpgo`, Options)
+	assert.EqualError(t, err, `listing error`)
+	assert.Equal(t, 2, Report.Scanned)
+	assert.Equal(t, 1, Report.Skipped)
+	assert.Equal(t, 1, Report.Backfilled)
+	assert.FileExists(t, Checkpoint)
+
+	// the job is resumed after the last key of the stored page
+	S3Mock.EXPECT().ListObjectsV2PagesWithContext(gomock.Any(), &s3.ListObjectsV2Input{
+		Bucket:     aws.String(`sftpgo`),
+		Prefix:     aws.String(`users/test1/`),
+		StartAfter: aws.String(`users/test1/dir/`),
+	}, gomock.Any()).DoAndReturn(func(_ context.Context, _ *s3.ListObjectsV2Input,
+		fn func(*s3.ListObjectsV2Output, bool) bool, _ ...interface{}) error {
+		fn(&s3.ListObjectsV2Output{
+			Contents: []*s3.Object{
+				Object(`users/test1/dir/c.csv`, `etag-c`, 30),
+				Object(`users/test1/dir/d.csv`, `etag-d`, 40),
+			},
+		}, true)
+		return nil
+	})
+	Report, err = BackfillS3(ctx, S3Mock, `sftpgo`, Options)
+	require.NoError(t, err)
+	assert.Equal(t, `users/test1/dir/`, Report.StartAfter)
+	assert.Equal(t, 2, Report.Scanned)
+	assert.Equal(t, 2, Report.Backfilled)
+	assert.Empty(t, Report.Errors)
+	assert.NoFileExists(t, Checkpoint)
+
+	Stored := scanAll(t, Provider, `users/test1/`)
+	require.Len(t, Stored, 4)
+	assert.Equal(t, `etag-b2`, Stored[1].Key.ETag)
+	assert.Equal(t, ModifiedTime, Stored[1].LastModified)
+	assert.Equal(t, 0600, int(Stored[1].Mode))
+	assert.Equal(t, `users/test1/dir/d.csv`, Stored[3].Key.Path)
+	assert.Equal(t, ModifiedTime, Stored[3].LastModified)
+
+	_, err = BackfillS3(ctx, S3Mock, `other`, Options)
+	assert.ErrorIs(t, err, ErrNotEnabled)
+}
+
+func TestBackfillS3HeadErrors(t *testing.T) {
+	setupInspect(t)
+	ctx := context.Background()
+	S3Mock := mocks.NewMockS3API(gomock.NewController(t))
+	Provider := DefaultFactory.New(NewS3Provider(S3Mock, `sftpgo`))
+	Checkpoint := filepath.Join(t.TempDir(), `backfill.json`)
+
+	UploadTime := time.Date(2020, time.March, 2, 10, 0, 0, 0, time.UTC)
+	ModifiedTime := time.Date(2020, time.March, 1, 8, 30, 0, 0, time.UTC)
+	Object := func(Path string) *s3.Object {
+		return &s3.Object{Key: aws.String(Path), ETag: aws.String(`"etag"`), Size: aws.Int64(10),
+			LastModified: aws.Time(UploadTime)}
+	}
+	ExpectList := func(StartAfter *string, Pages ...[]*s3.Object) {
+		S3Mock.EXPECT().ListObjectsV2PagesWithContext(gomock.Any(), &s3.ListObjectsV2Input{
+			Bucket:     aws.String(`sftpgo`),
+			Prefix:     aws.String(`users/`),
+			StartAfter: StartAfter,
+		}, gomock.Any()).DoAndReturn(func(_ context.Context, _ *s3.ListObjectsV2Input,
+			fn func(*s3.ListObjectsV2Output, bool) bool, _ ...interface{}) error {
+			for i, Page := range Pages {
+				if !fn(&s3.ListObjectsV2Output{Contents: Page}, i == len(Pages)-1) {
+					break
+				}
+			}
+			return nil
+		})
+	}
+	HeadErrors := map[string]bool{`users/b.csv`: true}
+	S3Mock.EXPECT().HeadObjectWithContext(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, Input *s3.HeadObjectInput, _ ...interface{}) (*s3.HeadObjectOutput, error) {
+			if HeadErrors[aws.StringValue(Input.Key)] {
+				return nil, errors.New(`head error`)
+			}
+			return &s3.HeadObjectOutput{Metadata: NewS3Metadata(ModifiedTime)}, nil
+		}).AnyTimes()
+
+	// the checkpoint does not advance past b.csv, not even for the following pages
+	ExpectList(nil, []*s3.Object{Object(`users/a.csv`), Object(`users/b.csv`), Object(`users/c.csv`)},
+		[]*s3.Object{Object(`users/d.csv`)})
+	Options := BackfillOptions{
+		Prefix:     `users/`,
+		Workers:    2,
+		Checkpoint: Checkpoint,
+	}
+	Report, err := BackfillS3(ctx, S3Mock, `sftpgo`, Options)
+	require.NoError(t, err)
+	assert.Equal(t, 4, Report.Scanned)
+	assert.Equal(t, 3, Report.Backfilled)
+	assert.Len(t, Report.Errors, 1)
+	StartAfter, err := readBackfillCheckpoint(Checkpoint, Report.Location, Options.Prefix)
+	require.NoError(t, err)
+	assert.Equal(t, `users/a.csv`, StartAfter)
+
+	// the failed key is retried, the already stored ones are skipped
+	delete(HeadErrors, `users/b.csv`)
+	ExpectList(aws.String(`users/a.csv`), []*s3.Object{Object(`users/b.csv`), Object(`users/c.csv`)},
+		[]*s3.Object{Object(`users/d.csv`)})
+	Report, err = BackfillS3(ctx, S3Mock, `sftpgo`, Options)
+	require.NoError(t, err)
+	assert.Equal(t, 3, Report.Scanned)
+	assert.Equal(t, 2, Report.Skipped)
+	assert.Equal(t, 1, Report.Backfilled)
+	assert.Empty(t, Report.Errors)
+	assert.NoFileExists(t, Checkpoint)
+	assert.Len(t, scanAll(t, Provider, `users/`), 4)
+}
+
+func TestBackfillCheckpoint(t *testing.T) {
+	Checkpoint := filepath.Join(t.TempDir(), `backfill.json`)
+	StartAfter, err := readBackfillCheckpoint(Checkpoint, `s3://sftpgo`, `users/`)
+	assert.NoError(t, err)
+	assert.Empty(t, StartAfter)
+
+	require.NoError(t, writeBackfillCheckpoint(Checkpoint, backfillCheckpoint{
+		Location: `s3://sftpgo`,
+		Prefix:   `users/`,
+		LastKey:  `users/a.csv`,
+	}))
+	StartAfter, err = readBackfillCheckpoint(Checkpoint, `s3://sftpgo`, `users/`)
+	assert.NoError(t, err)
+	assert.Equal(t, `users/a.csv`, StartAfter)
+	// checkpoints saved for other jobs are ignored
+	StartAfter, err = readBackfillCheckpoint(Checkpoint, `s3://sftpgo`, `other/`)
+	assert.NoError(t, err)
+	assert.Empty(t, StartAfter)
+}
+
+func TestUpsertFilesQuery(t *testing.T) {
+	Queries := newSQLQueries(PGSQLDriverName, ``)
+	assert.Equal(t, `INSERT INTO fsmeta_files `+
+		`(folder_id, filename, uploaded, filesize, etag, last_modified, mode, atime, uid, gid, attributes) VALUES `+
+		`($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11), ($12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22)`+
+		Queries.UpsertFilesSuffix, Queries.upsertFiles(2))
+
+	Queries = newSQLQueries(MySQLDriverName, `prefix_`)
+	assert.Equal(t, `INSERT INTO prefix_fsmeta_files `+
+		`(folder_id, filename, uploaded, filesize, etag, last_modified, mode, atime, uid, gid, attributes) VALUES `+
+		`(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE `+
+		`uploaded=VALUES(uploaded), filesize=VALUES(filesize), etag=VALUES(etag), last_modified=VALUES(last_modified), `+
+		`mode=VALUES(mode), atime=VALUES(atime), uid=VALUES(uid), gid=VALUES(gid), attributes=VALUES(attributes)`,
+		Queries.upsertFiles(1))
+}
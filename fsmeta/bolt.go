@@ -0,0 +1,101 @@
+//go:build !nobolt
+// +build !nobolt
+
+package fsmeta
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/drakkan/sftpgo/logger"
+)
+
+var (
+	boltFilesBucket = []byte(`fsmeta_files`)
+)
+
+type boltKV struct {
+	DB *bolt.DB
+}
+
+// NewBoltFactory returns a Factory storing the metadata in the given bolt database
+func NewBoltFactory(DB *bolt.DB) (Factory, error) {
+	if err := DB.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltFilesBucket)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return &kvFactory{
+		KV: &boltKV{DB: DB},
+	}, nil
+}
+
+func (config *Config) initializeBoltProvider(basePath string) error {
+	logSender = fmt.Sprintf("fsmeta_%v", BoltDriverName)
+	DBPath, err := config.getDatabasePath(basePath)
+	if err != nil {
+		return err
+	}
+	dbHandle, err := bolt.Open(DBPath, 0600, &bolt.Options{
+		NoGrowSync:   false,
+		FreelistType: bolt.FreelistArrayType,
+		Timeout:      5 * time.Second})
+	if err != nil {
+		metaLog(logger.LevelWarn, "error creating bolt key store handle, path: %#v, error: %v", DBPath, err)
+		return err
+	}
+	metaLog(logger.LevelDebug, "bolt key store handle created, path: %#v", DBPath)
+	Factory, err := NewBoltFactory(dbHandle)
+	if err != nil {
+		metaLog(logger.LevelWarn, "error creating fsmeta bucket: %v", err)
+		return err
+	}
+	DefaultFactory = Factory
+	return nil
+}
+
+func (b *boltKV) Get(Path string) ([]byte, error) {
+	var Value []byte
+	err := b.DB.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(boltFilesBucket).Get([]byte(Path)); v != nil {
+			// values are only valid while the transaction is open
+			Value = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	return Value, err
+}
+
+func (b *boltKV) Scan(Prefix string, fn func(Path string, Value []byte) error) error {
+	return b.DB.View(func(tx *bolt.Tx) error {
+		Cursor := tx.Bucket(boltFilesBucket).Cursor()
+		PrefixBytes := []byte(Prefix)
+		for k, v := Cursor.Seek(PrefixBytes); k != nil && bytes.HasPrefix(k, PrefixBytes); k, v = Cursor.Next() {
+			if err := fn(string(k), append([]byte(nil), v...)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *boltKV) Update(Puts map[string][]byte, Deletes []string) error {
+	return b.DB.Update(func(tx *bolt.Tx) error {
+		Bucket := tx.Bucket(boltFilesBucket)
+		for _, Path := range Deletes {
+			if err := Bucket.Delete([]byte(Path)); err != nil {
+				return err
+			}
+		}
+		for Path, Value := range Puts {
+			if err := Bucket.Put([]byte(Path), Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,10 @@
+//go:build nobolt
+// +build nobolt
+
+package fsmeta
+
+import "errors"
+
+func (config *Config) initializeBoltProvider(basePath string) error {
+	return errors.New("bolt disabled at build time")
+}
@@ -0,0 +1,30 @@
+//go:build !nobolt
+// +build !nobolt
+
+package fsmeta
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoltFactory(t *testing.T) {
+	EnabledRestore := Enabled
+	CurrentFactory := DefaultFactory
+	t.Cleanup(func() {
+		Enabled = EnabledRestore
+		DefaultFactory = CurrentFactory
+	})
+
+	BasePath := t.TempDir()
+	require.NoError(t, Initialize(Config{
+		Enabled:  true,
+		Driver:   BoltDriverName,
+		Database: `fsmeta.db`,
+	}, BasePath))
+	assert.FileExists(t, filepath.Join(BasePath, `fsmeta.db`))
+	testFactory(t, DefaultFactory)
+}
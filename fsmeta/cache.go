@@ -0,0 +1,268 @@
+package fsmeta
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drakkan/sftpgo/metrics"
+)
+
+// folderCache is the process wide cache shared by all the SQL providers,
+// it is nil, and so disabled, unless a positive cache size is configured
+var folderCache *sharedFolderCache
+
+// maxTrackedInvalidations bounds the invalidation versions tracked per path and prefix
+const maxTrackedInvalidations = 10000
+
+// sharedFolderCache caches the folder IDs and the preloaded folder files,
+// keyed by the formatted folder path. Each map is bounded to Size entries,
+// the least recently used entries are evicted first. The cached files are
+// copied on read and write, so they are never shared with the providers
+type sharedFolderCache struct {
+	sync.Mutex
+	IDs   *lruCache
+	Files *lruCache
+	// version is incremented by every invalidation. The version of the last
+	// invalidation is tracked for each folder path and prefix: values read from
+	// the database before an invalidation of their folder could be stale and are
+	// not cached, the invalidations of other folders are not relevant
+	version             uint64
+	filesInvalidations  map[string]uint64
+	prefixInvalidations map[string]uint64
+	// minVersion is the version the tracked invalidations were last reset at,
+	// values read before it are never cached
+	minVersion uint64
+}
+
+func newSharedFolderCache(Size int, TTL time.Duration) *sharedFolderCache {
+	if Size <= 0 {
+		return nil
+	}
+	return &sharedFolderCache{
+		IDs:                 newLRUCache(Size, TTL),
+		Files:               newLRUCache(Size, TTL),
+		filesInvalidations:  make(map[string]uint64),
+		prefixInvalidations: make(map[string]uint64),
+	}
+}
+
+func (c *sharedFolderCache) getFolderID(Path string) (uint64, bool) {
+	if c == nil {
+		return 0, false
+	}
+	if Value, ok := c.IDs.Get(Path); ok {
+		return Value.(uint64), true
+	}
+	return 0, false
+}
+
+// getVersion returns the current invalidation version, it must be read before
+// querying the database for the values to cache
+func (c *sharedFolderCache) getVersion() uint64 {
+	if c == nil {
+		return 0
+	}
+	c.Lock()
+	defer c.Unlock()
+
+	return c.version
+}
+
+// setFolderID caches the folder ID read at the given version, it is discarded
+// if the folder ID was invalidated in the meantime
+func (c *sharedFolderCache) setFolderID(Path string, ID uint64, Version uint64) {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+
+	if !c.isPrefixInvalidatedSince(Path, Version) {
+		c.IDs.Add(Path, ID)
+	}
+}
+
+// getFiles returns a copy of the cached files for the folder
+func (c *sharedFolderCache) getFiles(Path string) (fileMap, bool) {
+	if c == nil {
+		return nil, false
+	}
+	if Value, ok := c.Files.Get(Path); ok {
+		return Value.(fileMap).clone(), true
+	}
+	return nil, false
+}
+
+// setFiles caches a copy of the files read at the given version, they are
+// discarded if the folder files were invalidated in the meantime
+func (c *sharedFolderCache) setFiles(Path string, Files fileMap, Version uint64) {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+
+	if c.filesInvalidations[Path] > Version || c.isPrefixInvalidatedSince(Path, Version) {
+		return
+	}
+	c.Files.Add(Path, Files.clone())
+}
+
+// isPrefixInvalidatedSince returns true if Path was invalidated, as part of a
+// prefix, after the given version. The caller must hold the lock
+func (c *sharedFolderCache) isPrefixInvalidatedSince(Path string, Version uint64) bool {
+	if Version < c.minVersion {
+		return true
+	}
+	for Prefix, InvalidationVersion := range c.prefixInvalidations {
+		if InvalidationVersion > Version && strings.HasPrefix(Path, Prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextVersion increments and returns the invalidation version, the tracked
+// invalidations are reset if they exceed maxTrackedInvalidations.
+// The caller must hold the lock
+func (c *sharedFolderCache) nextVersion() uint64 {
+	c.version++
+	if len(c.filesInvalidations)+len(c.prefixInvalidations) >= maxTrackedInvalidations {
+		c.filesInvalidations = make(map[string]uint64)
+		c.prefixInvalidations = make(map[string]uint64)
+		c.minVersion = c.version
+	}
+	return c.version
+}
+
+// invalidateFiles removes the cached files for the given folders, the folder IDs are preserved
+func (c *sharedFolderCache) invalidateFiles(Paths ...string) {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+
+	Version := c.nextVersion()
+	for _, Path := range Paths {
+		c.filesInvalidations[Path] = Version
+		c.Files.Remove(Path)
+	}
+}
+
+// invalidatePrefix removes the folder IDs and files for all the folders starting with Prefix
+func (c *sharedFolderCache) invalidatePrefix(Prefix string) {
+	if c == nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+
+	c.prefixInvalidations[Prefix] = c.nextVersion()
+	c.IDs.RemovePrefix(Prefix)
+	c.Files.RemovePrefix(Prefix)
+}
+
+type lruEntry struct {
+	Key     string
+	Value   interface{}
+	Expires time.Time
+}
+
+// lruCache is a size bounded least recently used cache, entries older than TTL
+// are treated as missing. A zero TTL means entries never expire
+type lruCache struct {
+	sync.Mutex
+	Size    int
+	TTL     time.Duration
+	entries map[string]*list.Element
+	order   *list.List
+	now     func() time.Time
+}
+
+func newLRUCache(Size int, TTL time.Duration) *lruCache {
+	return &lruCache{
+		Size:    Size,
+		TTL:     TTL,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+func (c *lruCache) Get(Key string) (interface{}, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	Element, ok := c.entries[Key]
+	if !ok {
+		metrics.FSMetaFolderCache(false)
+		return nil, false
+	}
+	Entry := Element.Value.(*lruEntry)
+	if c.TTL > 0 && c.now().After(Entry.Expires) {
+		c.removeElement(Element)
+		metrics.FSMetaFolderCache(false)
+		return nil, false
+	}
+	c.order.MoveToFront(Element)
+	metrics.FSMetaFolderCache(true)
+	return Entry.Value, true
+}
+
+func (c *lruCache) Add(Key string, Value interface{}) {
+	c.Lock()
+	defer c.Unlock()
+
+	Expires := c.now().Add(c.TTL)
+	if Element, ok := c.entries[Key]; ok {
+		Entry := Element.Value.(*lruEntry)
+		Entry.Value = Value
+		Entry.Expires = Expires
+		c.order.MoveToFront(Element)
+		return
+	}
+	c.entries[Key] = c.order.PushFront(&lruEntry{
+		Key:     Key,
+		Value:   Value,
+		Expires: Expires,
+	})
+	for c.order.Len() > c.Size {
+		c.removeElement(c.order.Back())
+		metrics.FSMetaFolderCacheEviction()
+	}
+}
+
+func (c *lruCache) Remove(Key string) {
+	c.Lock()
+	defer c.Unlock()
+
+	if Element, ok := c.entries[Key]; ok {
+		c.removeElement(Element)
+	}
+}
+
+func (c *lruCache) RemovePrefix(Prefix string) {
+	c.Lock()
+	defer c.Unlock()
+
+	for Key, Element := range c.entries {
+		if strings.HasPrefix(Key, Prefix) {
+			c.removeElement(Element)
+		}
+	}
+}
+
+func (c *lruCache) Len() int {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *lruCache) removeElement(Element *list.Element) {
+	c.order.Remove(Element)
+	delete(c.entries, Element.Value.(*lruEntry).Key)
+}
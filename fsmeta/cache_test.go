@@ -0,0 +1,166 @@
+package fsmeta
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRUCacheEviction(t *testing.T) {
+	Cache := newLRUCache(2, 0)
+	Cache.Add(`a`, 1)
+	Cache.Add(`b`, 2)
+	_, ok := Cache.Get(`a`)
+	assert.True(t, ok)
+	// b is the least recently used entry
+	Cache.Add(`c`, 3)
+	assert.Equal(t, 2, Cache.Len())
+	_, ok = Cache.Get(`b`)
+	assert.False(t, ok)
+	Value, ok := Cache.Get(`a`)
+	assert.True(t, ok)
+	assert.Equal(t, 1, Value)
+	// updating an entry does not evict anything
+	Cache.Add(`c`, 4)
+	Value, ok = Cache.Get(`c`)
+	assert.True(t, ok)
+	assert.Equal(t, 4, Value)
+	assert.Equal(t, 2, Cache.Len())
+}
+
+func TestLRUCacheTTL(t *testing.T) {
+	Now := time.Date(2020, time.March, 2, 10, 0, 0, 0, time.UTC)
+	Cache := newLRUCache(10, time.Minute)
+	Cache.now = func() time.Time { return Now }
+	Cache.Add(`a`, 1)
+	Now = Now.Add(30 * time.Second)
+	Cache.Add(`b`, 2)
+	Now = Now.Add(31 * time.Second)
+	_, ok := Cache.Get(`a`)
+	assert.False(t, ok)
+	_, ok = Cache.Get(`b`)
+	assert.True(t, ok)
+	assert.Equal(t, 1, Cache.Len())
+}
+
+func TestLRUCacheRemovePrefix(t *testing.T) {
+	Cache := newLRUCache(10, 0)
+	for _, Key := range []string{`s3://b/users/test1/`, `s3://b/users/test1/dir/`, `s3://b/users/test10/`} {
+		Cache.Add(Key, Key)
+	}
+	Cache.RemovePrefix(`s3://b/users/test1/`)
+	assert.Equal(t, 1, Cache.Len())
+	_, ok := Cache.Get(`s3://b/users/test10/`)
+	assert.True(t, ok)
+	Cache.Remove(`s3://b/users/test10/`)
+	assert.Equal(t, 0, Cache.Len())
+}
+
+func TestSharedFolderCacheDisabled(t *testing.T) {
+	Cache := newSharedFolderCache(0, time.Minute)
+	assert.Nil(t, Cache)
+	Cache.setFolderID(`s3://b/users/`, 1, Cache.getVersion())
+	Cache.setFiles(`s3://b/users/`, make(fileMap), Cache.getVersion())
+	_, ok := Cache.getFolderID(`s3://b/users/`)
+	assert.False(t, ok)
+	_, ok = Cache.getFiles(`s3://b/users/`)
+	assert.False(t, ok)
+	Cache.invalidateFiles(`s3://b/users/`)
+	Cache.invalidatePrefix(`s3://b/`)
+}
+
+func TestSharedFolderCacheCopies(t *testing.T) {
+	Cache := newSharedFolderCache(10, time.Minute)
+	UID := 1000
+	Files := fileMap{`users/a.csv`: {Key: Key{Path: `users/a.csv`}, UID: &UID}}
+	Cache.setFiles(`s3://b/users/`, Files, Cache.getVersion())
+	// neither the stored nor the returned files are shared with the cache
+	*Files[`users/a.csv`].UID = 0
+	delete(Files, `users/a.csv`)
+	Cached, ok := Cache.getFiles(`s3://b/users/`)
+	if assert.True(t, ok) && assert.Contains(t, Cached, `users/a.csv`) {
+		assert.Equal(t, 1000, *Cached[`users/a.csv`].UID)
+		*Cached[`users/a.csv`].UID = 0
+		Cached[`users/b.csv`] = Meta{}
+	}
+	Cached, ok = Cache.getFiles(`s3://b/users/`)
+	if assert.True(t, ok) && assert.Len(t, Cached, 1) {
+		assert.Equal(t, 1000, *Cached[`users/a.csv`].UID)
+	}
+	// the loaded metadata are returned as copies too
+	M, err := Cached.Get(context.Background(), Key{Path: `users/a.csv`})
+	if assert.NoError(t, err) {
+		*M.UID = 0
+		assert.Equal(t, 1000, *Cached[`users/a.csv`].UID)
+	}
+}
+
+func TestSharedFolderCacheVersion(t *testing.T) {
+	Cache := newSharedFolderCache(10, time.Minute)
+	// the values read before an invalidation are not cached
+	Version := Cache.getVersion()
+	Cache.invalidateFiles(`s3://b/users/`)
+	Cache.setFiles(`s3://b/users/`, make(fileMap), Version)
+	Cache.setFolderID(`s3://b/users/`, 1, Version)
+	_, ok := Cache.getFiles(`s3://b/users/`)
+	assert.False(t, ok)
+	// the files invalidation does not affect the folder ID
+	_, ok = Cache.getFolderID(`s3://b/users/`)
+	assert.True(t, ok)
+
+	Version = Cache.getVersion()
+	Cache.setFiles(`s3://b/users/`, make(fileMap), Version)
+	Cache.setFolderID(`s3://b/users/`, 1, Version)
+	_, ok = Cache.getFiles(`s3://b/users/`)
+	assert.True(t, ok)
+	Cache.invalidatePrefix(`s3://b/`)
+	Cache.setFiles(`s3://b/users/`, make(fileMap), Version)
+	_, ok = Cache.getFiles(`s3://b/users/`)
+	assert.False(t, ok)
+	_, ok = Cache.getFolderID(`s3://b/users/`)
+	assert.False(t, ok)
+}
+
+func TestSharedFolderCacheUnrelatedInvalidation(t *testing.T) {
+	Cache := newSharedFolderCache(10, time.Minute)
+	// a write to an unrelated folder during a load does not prevent caching
+	Version := Cache.getVersion()
+	Cache.invalidateFiles(`s3://b/other/`)
+	Cache.invalidatePrefix(`s3://b/other/`)
+	Cache.setFiles(`s3://b/users/`, make(fileMap), Version)
+	Cache.setFolderID(`s3://b/users/`, 1, Version)
+	_, ok := Cache.getFiles(`s3://b/users/`)
+	assert.True(t, ok)
+	_, ok = Cache.getFolderID(`s3://b/users/`)
+	assert.True(t, ok)
+	// the values read before the tracked invalidations are reset are not cached
+	Version = Cache.getVersion()
+	for i := 0; i < maxTrackedInvalidations; i++ {
+		Cache.invalidateFiles(fmt.Sprintf("s3://b/other%v/", i))
+	}
+	assert.Less(t, len(Cache.filesInvalidations), maxTrackedInvalidations)
+	Cache.setFiles(`s3://b/data/`, make(fileMap), Version)
+	_, ok = Cache.getFiles(`s3://b/data/`)
+	assert.False(t, ok)
+	Cache.setFiles(`s3://b/data/`, make(fileMap), Cache.getVersion())
+	_, ok = Cache.getFiles(`s3://b/data/`)
+	assert.True(t, ok)
+}
+
+func TestInitializeCache(t *testing.T) {
+	t.Cleanup(func() {
+		folderCache = nil
+	})
+	Config := Config{Enabled: true, CacheSize: 100, CacheTTL: 60}
+	Config.initializeCache()
+	if assert.NotNil(t, folderCache) {
+		assert.Equal(t, 100, folderCache.IDs.Size)
+		assert.Equal(t, time.Minute, folderCache.Files.TTL)
+	}
+	Config.Enabled = false
+	Config.initializeCache()
+	assert.Nil(t, folderCache)
+}
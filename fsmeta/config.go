@@ -1,37 +1,54 @@
 package fsmeta
 
 import (
-	"database/sql"
 	"fmt"
-	"net/url"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	bindata "github.com/golang-migrate/migrate/v4/source/go_bindata"
 
-	// import migrate postgres driver to register the postgres driver
-	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-
-	sqlbindata "github.com/drakkan/sftpgo/fsmeta/sql"
 	"github.com/drakkan/sftpgo/logger"
+	"github.com/drakkan/sftpgo/utils"
 )
 
 const (
 	S3MetaKey = `Fs-Mtime`
+	// PGSQLDriverName name for the PostgreSQL driver, it is used if no driver is configured
+	PGSQLDriverName = `postgresql`
+	// SQLiteDriverName name for the SQLite driver
+	SQLiteDriverName = `sqlite`
+	// MySQLDriverName name for the MySQL driver
+	MySQLDriverName = `mysql`
+	// BoltDriverName name for the bbolt key/value store driver
+	BoltDriverName = `bolt`
+	// MemoryDriverName name for the in memory driver, metadata are lost on restart
+	MemoryDriverName = `memory`
+
+	migrationsTable = `fsmeta_schema_migrations`
 )
 
 var (
 	logSender = "fsMeta"
+	// SupportedDrivers defines the supported fsmeta drivers
+	SupportedDrivers = []string{PGSQLDriverName, SQLiteDriverName, MySQLDriverName, BoltDriverName, MemoryDriverName}
 )
 
 // Config provider configuration
 type Config struct {
 	// Enables FS Meta Data features.
 	Enabled bool `json:"enabled" mapstructure:"enabled"`
-	// Driver name, must be one of the SupportedProviders
+	// Driver name, must be one of the SupportedDrivers, defaults to postgresql
 	Driver string `json:"driver" mapstructure:"driver"`
-	// Database name.
+	// UseDataProvider stores the fsmeta tables in the data provider database, sharing its
+	// connection pool and SQL tables prefix. MySQL uses a dedicated pool, sized by PoolSize,
+	// since the fsmeta queries require parseTime. Driver and connection settings are ignored and
+	// the migrations are applied by initprovider/revertprovider or at startup if the data
+	// provider update mode is 0. Only SQL based data providers are supported
+	UseDataProvider bool `json:"use_data_provider" mapstructure:"use_data_provider"`
+	// Database name. For driver sqlite and bolt this is the database file path,
+	// relative paths are resolved against the configuration directory
 	Database string `json:"database" mapstructure:"database"`
 	// Database schema.
 	Schema string `json:"schema" mapstructure:"schema"`
@@ -43,7 +60,8 @@ type Config struct {
 	Username string `json:"username" mapstructure:"username"`
 	// Database password
 	Password string `json:"password" mapstructure:"password"`
-	// Buckets to enable functionality for
+	// Buckets to enable functionality for, plain names match S3, GCS and Azure Blob
+	// buckets/containers, use s3://name, gs://name or azblob://name to match a single backend
 	Buckets []string `json:"buckets" mapstructure:"buckets"`
 	// Used for drivers mysql and postgresql.
 	// 0 disable SSL/TLS connections.
@@ -54,85 +72,73 @@ type Config struct {
 	// Sets the maximum number of open connections for mysql and postgresql driver.
 	// Default 0 (unlimited)
 	PoolSize int `json:"pool_size" mapstructure:"pool_size"`
-}
-
-func (config *Config) GetDSN(redactedPwd bool, additionalFields url.Values) string {
-	UserInfo := url.UserPassword(config.Username, config.Password)
-	if redactedPwd {
-		UserInfo = url.User(config.Username)
-	}
-	u := url.URL{
-		Scheme: "postgres",
-		User:   UserInfo,
-		Host:   fmt.Sprintf(`%s:%d`, config.Host, config.Port),
-		Path:   config.Database,
-	}
-	q := u.Query()
-	q.Set("sslmode", getSSLMode(config.SSLMode))
-	q.Set("connect_timeout", "10")
-	if config.Schema != `` {
-		q.Set("search_path", config.Schema)
-	}
-	for k, v := range additionalFields {
-		q[k] = v
-	}
-	u.RawQuery = q.Encode()
-	return u.String()
+	// Maximum number of folders whose IDs and files are kept in the process wide cache
+	// shared by the SQL drivers. 0 disables the cache. The cache is invalidated by the
+	// changes made by this instance only, enable it with care if several instances
+	// share the same database
+	CacheSize int `json:"cache_size" mapstructure:"cache_size"`
+	// Time to live, in seconds, of the cached folders. 0 means no expiration
+	CacheTTL int `json:"cache_ttl" mapstructure:"cache_ttl"`
+	// ChtimesCopyInPlace also updates the Fs-Mtime metadata of S3 objects on chtimes, copying
+	// each object onto itself. The copy changes the object ETag and store time and it is
+	// skipped for objects bigger than 5GB, the fsmeta row is always updated
+	ChtimesCopyInPlace bool `json:"chtimes_copy_in_place" mapstructure:"chtimes_copy_in_place"`
 }
 
 func metaLog(level logger.LogLevel, format string, v ...interface{}) {
 	logger.Log(level, logSender, "", format, v...)
 }
 
-func (config *Config) initializePGSQLProvider() error {
-	var err error
-	logSender = fmt.Sprintf("fsmeta_%v", config.Driver)
-	dbHandle, err := sql.Open("postgres", config.GetDSN(false, nil))
-	if err == nil {
-		metaLog(logger.LevelDebug, "postgres database handle created, connection string: %#v, pool size: %v",
-			config.GetDSN(true, nil), config.PoolSize)
-		dbHandle.SetMaxOpenConns(config.PoolSize)
-		if config.PoolSize > 0 {
-			dbHandle.SetMaxIdleConns(config.PoolSize)
-		} else {
-			dbHandle.SetMaxIdleConns(2)
+// Initialize runs the database migrations, if any, and sets the DefaultFactory
+// for the configured driver. basePath is used to resolve relative database paths
+func Initialize(cnf Config, basePath string) error {
+	if cnf.Enabled {
+		if err := cnf.initializeProvider(basePath); err != nil {
+			return err
 		}
-		dbHandle.SetConnMaxLifetime(240 * time.Second)
-		DefaultFactory = NewPostgresS3Factory(dbHandle)
-	} else {
-		metaLog(logger.LevelWarn, "error creating postgres database handler, connection string: %#v, error: %v",
-			config.GetDSN(true, nil), err)
 	}
-	return err
+	cnf.initializeCache()
+	Enabled = cnf.Enabled
+	Buckets = cnf.Buckets
+	ChtimesCopyInPlace = cnf.ChtimesCopyInPlace
+	return nil
 }
 
-func getSSLMode(SSLMode int) string {
-	if SSLMode == 0 {
-		return "disable"
-	} else if SSLMode == 1 {
-		return "require"
-	} else if SSLMode == 2 {
-		return "verify-ca"
-	} else if SSLMode == 3 {
-		return "verify-full"
+func (config *Config) initializeProvider(basePath string) error {
+	switch config.Driver {
+	case ``, `postgres`, PGSQLDriverName:
+		return config.initializePGSQLProvider()
+	case SQLiteDriverName:
+		return config.initializeSQLiteProvider(basePath)
+	case MySQLDriverName:
+		return config.initializeMySQLProvider()
+	case BoltDriverName:
+		return config.initializeBoltProvider(basePath)
+	case MemoryDriverName:
+		logSender = fmt.Sprintf("fsmeta_%v", MemoryDriverName)
+		DefaultFactory = NewMemoryFactory()
+		return nil
+	default:
+		return fmt.Errorf("unsupported fsmeta driver %#v, supported drivers: %v", config.Driver, SupportedDrivers)
 	}
-	return ``
 }
 
-func Initialize(cnf Config) error {
-	if cnf.Enabled {
-		if err := cnf.migrateDatabase(); err != nil && err != migrate.ErrNoChange {
-			logger.ErrorToConsole("error running fsmeta migrations: %s", err)
-			return err
-		}
+func (config *Config) initializeCache() {
+	folderCache = nil
+	if config.Enabled {
+		folderCache = newSharedFolderCache(config.CacheSize, time.Duration(config.CacheTTL)*time.Second)
+	}
+}
 
-		if err := cnf.initializePGSQLProvider(); err != nil {
-			return err
-		}
+func (config *Config) getDatabasePath(basePath string) (string, error) {
+	DBPath := config.Database
+	if !utils.IsFileInputValid(DBPath) {
+		return ``, fmt.Errorf("invalid fsmeta database path: %#v", DBPath)
 	}
-	Enabled = cnf.Enabled
-	Buckets = cnf.Buckets
-	return nil
+	if !filepath.IsAbs(DBPath) {
+		DBPath = filepath.Join(basePath, DBPath)
+	}
+	return DBPath, nil
 }
 
 type migrateLogger struct{}
@@ -145,23 +151,23 @@ func (m migrateLogger) Verbose() bool {
 	return true
 }
 
-func (config *Config) migrateDatabase() error {
-	s := bindata.Resource(sqlbindata.AssetNames(),
-		func(name string) ([]byte, error) {
-			return sqlbindata.Asset(name)
-		})
+// migrateDatabase applies the go-bindata embedded migrations to the database
+// identified by the golang-migrate DSN
+func migrateDatabase(AssetNames func() []string, Asset func(name string) ([]byte, error), DSN string) error {
+	s := bindata.Resource(AssetNames(), Asset)
 
 	d, err := bindata.WithInstance(s)
 	if err != nil {
 		return err
 	}
-	values := url.Values{}
-	values.Set(`x-migrations-table`, `fsmeta_schema_migrations`)
-	dsn := config.GetDSN(false, values)
-	m, err := migrate.NewWithSourceInstance(`go-bindata`, d, dsn)
+	m, err := migrate.NewWithSourceInstance(`go-bindata`, d, DSN)
 	if err != nil {
 		return err
 	}
 	m.Log = &migrateLogger{}
-	return m.Up()
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		logger.ErrorToConsole("error running fsmeta migrations: %s", err)
+		return err
+	}
+	return nil
 }
@@ -13,3 +13,11 @@ func TestGetSSLMode(t *testing.T) {
 	assert.Equal(t, `verify-full`, getSSLMode(3))
 	assert.Equal(t, ``, getSSLMode(4))
 }
+
+func TestUnsupportedDriver(t *testing.T) {
+	err := Initialize(Config{
+		Enabled: true,
+		Driver:  `unknown`,
+	}, t.TempDir())
+	assert.Error(t, err)
+}
@@ -0,0 +1,105 @@
+package fsmeta
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	SchemeS3        = `s3`
+	SchemeGCS       = `gs`
+	SchemeAzureBlob = `azblob`
+)
+
+var (
+	Enabled        bool
+	Buckets        []string
+	DefaultFactory Factory
+	// ChtimesCopyInPlace enables the S3 object metadata update on chtimes
+	ChtimesCopyInPlace bool
+)
+
+// Store is an object storage backend able to return the metadata stored
+// alongside a single object, for example S3 object metadata, GCS object
+// attributes or Azure blob metadata.
+type Store interface {
+	Getter
+	// Location returns the URL identifying the bucket or container, for example s3://bucket
+	Location() string
+}
+
+// Factory creates a Provider backed by the given object Store
+type Factory interface {
+	New(Store Store) Provider
+}
+
+type Key struct {
+	Path      string    `json:"path"`
+	ETag      string    `json:"etag"`
+	StoreTime time.Time `json:"store_time"`
+	Size      int64     `json:"size"`
+}
+
+// Meta is the metadata stored for an object. The extended attributes are set
+// using SFTP setstat: a zero Mode or AccessTime and nil UID or GID are not set.
+// Attributes is a free-form map for any other attribute to persist
+type Meta struct {
+	Key          Key               `json:"key"`
+	LastModified time.Time         `json:"mtime"`
+	Mode         os.FileMode       `json:"mode,omitempty"`
+	AccessTime   time.Time         `json:"atime"`
+	UID          *int              `json:"uid,omitempty"`
+	GID          *int              `json:"gid,omitempty"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+}
+
+// clone returns a copy of the metadata not sharing the UID and GID pointers
+// and the attributes map
+func (M Meta) clone() Meta {
+	if M.UID != nil {
+		UID := *M.UID
+		M.UID = &UID
+	}
+	if M.GID != nil {
+		GID := *M.GID
+		M.GID = &GID
+	}
+	if M.Attributes != nil {
+		Attributes := make(map[string]string, len(M.Attributes))
+		for k, v := range M.Attributes {
+			Attributes[k] = v
+		}
+		M.Attributes = Attributes
+	}
+	return M
+}
+
+// Location returns the URL identifying a bucket for the given scheme
+func Location(Scheme, Bucket string) string {
+	return fmt.Sprintf(`%s://%s`, Scheme, Bucket)
+}
+
+// EnabledForBucket returns true if fsmeta is enabled for the given S3 bucket
+func EnabledForBucket(v string) bool {
+	return EnabledFor(SchemeS3, v)
+}
+
+// EnabledFor returns true if fsmeta is enabled for the given bucket of the
+// given storage scheme. Configured buckets can be plain names, matching
+// any backend, or locations such as gs://bucket matching a single backend
+func EnabledFor(Scheme, Bucket string) bool {
+	if !Enabled {
+		return false
+	}
+	if len(Buckets) == 0 {
+		return true
+	}
+	BucketLocation := Location(Scheme, Bucket)
+	for _, v := range Buckets {
+		if v == Bucket || v == BucketLocation {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package fsmeta
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnabledForBucket(t *testing.T) {
+	EnabledRestore := Enabled
+	CurrentBuckets := Buckets
+	t.Cleanup(func() {
+		Enabled = EnabledRestore
+		Buckets = CurrentBuckets
+	})
+
+	Enabled = false
+	Buckets = []string{`bucket1`}
+	assert.False(t, EnabledForBucket(`bucket1`))
+	assert.False(t, EnabledForBucket(`bucket2`))
+
+	Enabled = true
+	assert.True(t, EnabledForBucket(`bucket1`))
+	assert.False(t, EnabledForBucket(`bucket2`))
+
+	Buckets = nil
+	assert.True(t, EnabledForBucket(`bucket1`))
+	assert.True(t, EnabledForBucket(`bucket2`))
+}
+
+func TestEnabledFor(t *testing.T) {
+	EnabledRestore := Enabled
+	CurrentBuckets := Buckets
+	t.Cleanup(func() {
+		Enabled = EnabledRestore
+		Buckets = CurrentBuckets
+	})
+
+	Enabled = true
+	Buckets = []string{`bucket1`, `gs://bucket2`, `azblob://container1`}
+	assert.True(t, EnabledFor(SchemeS3, `bucket1`))
+	assert.True(t, EnabledFor(SchemeGCS, `bucket1`))
+	assert.True(t, EnabledFor(SchemeAzureBlob, `bucket1`))
+	assert.False(t, EnabledFor(SchemeS3, `bucket2`))
+	assert.True(t, EnabledFor(SchemeGCS, `bucket2`))
+	assert.False(t, EnabledForBucket(`container1`))
+	assert.True(t, EnabledFor(SchemeAzureBlob, `container1`))
+
+	assert.Equal(t, `gs://bucket2`, Location(SchemeGCS, `bucket2`))
+}
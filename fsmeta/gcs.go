@@ -0,0 +1,71 @@
+//go:build !nogcs
+// +build !nogcs
+
+package fsmeta
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/storage"
+
+	"github.com/drakkan/sftpgo/metrics"
+)
+
+const (
+	GCSMetaKey = S3MetaKey
+)
+
+type gcsProvider struct {
+	bucket *storage.BucketHandle
+	name   string
+}
+
+// NewGCSProvider returns a Store reading the fsmeta modification time from
+// the GCS object metadata, falling back to the object custom time
+func NewGCSProvider(Client *storage.Client, Bucket string) Store {
+	return &gcsProvider{
+		bucket: Client.Bucket(Bucket),
+		name:   Bucket,
+	}
+}
+
+func (g *gcsProvider) Location() string {
+	return Location(SchemeGCS, g.name)
+}
+
+func (g *gcsProvider) Get(ctx context.Context, Key Key) (Meta, error) {
+	Attrs, err := g.bucket.Object(Key.Path).Attrs(ctx)
+	metrics.GCSHeadObjectCompleted(err)
+	if err != nil {
+		if err == storage.ErrObjectNotExist {
+			return Meta{
+				Key:          Key,
+				LastModified: Key.StoreTime,
+			}, nil
+		}
+		return Meta{}, err
+	}
+
+	FSTime, err := StringMetaHelper(Attrs.Metadata).GetTime(GCSMetaKey)
+	if err != nil || FSTime.IsZero() {
+		FSTime = Attrs.CustomTime
+	}
+	if FSTime.IsZero() {
+		FSTime = Key.StoreTime
+	}
+	return Meta{
+		Key:          Key,
+		LastModified: FSTime,
+	}, nil
+}
+
+// NewGCSMetadata returns the GCS object metadata storing the given modification time
+func NewGCSMetadata(T time.Time) map[string]string {
+	if !Enabled || T.IsZero() {
+		return nil
+	}
+	return map[string]string{
+		GCSMetaKey: T.Format(time.RFC3339),
+	}
+}
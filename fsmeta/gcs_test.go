@@ -0,0 +1,123 @@
+package fsmeta
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/h2non/gock"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/api/option"
+)
+
+const (
+	gcsTestBaseURL = `http://localhost/fsmeta-gcs-test`
+)
+
+type GCSSuite struct {
+	suite.Suite
+	Client *storage.Client
+}
+
+func (Suite *GCSSuite) SetupSuite() {
+	Client, err := storage.NewClient(
+		context.Background(),
+		option.WithHTTPClient(&http.Client{}),
+		option.WithEndpoint(gcsTestBaseURL),
+	)
+	if err != nil {
+		Suite.FailNowf(`storage.NewClient`, `failed to setup storage client: %s`, err)
+	}
+	Suite.Client = Client
+}
+
+func (Suite *GCSSuite) AfterTest(_, _ string) {
+	Suite.True(gock.IsDone())
+	gock.Off()
+}
+
+func (Suite *GCSSuite) TestMetadata() {
+	StoreTime := time.Date(2020, time.February, 23, 13, 45, 21, 0, time.UTC)
+	LastModified := StoreTime.Add(-time.Hour)
+	CustomTime := StoreTime.Add(-2 * time.Hour)
+	gock.New(gcsTestBaseURL).
+		Get(`/b/sftpgo/o/users/test1/test.csv`).
+		Reply(200).
+		JSON(map[string]any{
+			"bucket":     "sftpgo",
+			"name":       "users/test1/test.csv",
+			"size":       "100",
+			"updated":    StoreTime.Format(time.RFC3339),
+			"customTime": CustomTime.Format(time.RFC3339),
+			"metadata": map[string]string{
+				GCSMetaKey: LastModified.Format(time.RFC3339),
+			},
+		})
+
+	Store := NewGCSProvider(Suite.Client, `sftpgo`)
+	Suite.Equal(`gs://sftpgo`, Store.Location())
+
+	Key := Key{
+		Path:      `users/test1/test.csv`,
+		ETag:      "9b99c17f7943a02a250fc6ca7d10efcd",
+		StoreTime: StoreTime,
+		Size:      100,
+	}
+	Actual, err := Store.Get(context.Background(), Key)
+	Suite.Nil(err)
+	Suite.Equal(Meta{
+		Key:          Key,
+		LastModified: LastModified,
+	}, Actual)
+}
+
+func (Suite *GCSSuite) TestCustomTimeFallback() {
+	StoreTime := time.Date(2020, time.February, 23, 13, 45, 21, 0, time.UTC)
+	CustomTime := StoreTime.Add(-2 * time.Hour)
+	gock.New(gcsTestBaseURL).
+		Get(`/b/sftpgo/o/users/test1/test.csv`).
+		Reply(200).
+		JSON(map[string]any{
+			"bucket":     "sftpgo",
+			"name":       "users/test1/test.csv",
+			"size":       "100",
+			"updated":    StoreTime.Format(time.RFC3339),
+			"customTime": CustomTime.Format(time.RFC3339),
+		})
+
+	Key := Key{
+		Path:      `users/test1/test.csv`,
+		StoreTime: StoreTime,
+		Size:      100,
+	}
+	Actual, err := NewGCSProvider(Suite.Client, `sftpgo`).Get(context.Background(), Key)
+	Suite.Nil(err)
+	Suite.Equal(Meta{
+		Key:          Key,
+		LastModified: CustomTime,
+	}, Actual)
+}
+
+func (Suite *GCSSuite) TestKeyNotFound() {
+	gock.New(gcsTestBaseURL).
+		Get(`/b/sftpgo/o/users/test1/test.csv`).
+		Reply(404)
+
+	Key := Key{
+		Path:      `users/test1/test.csv`,
+		StoreTime: time.Date(2020, time.February, 23, 13, 45, 21, 0, time.UTC),
+		Size:      100,
+	}
+	Actual, err := NewGCSProvider(Suite.Client, `sftpgo`).Get(context.Background(), Key)
+	Suite.Nil(err)
+	Suite.Equal(Meta{
+		Key:          Key,
+		LastModified: Key.StoreTime,
+	}, Actual)
+}
+
+func TestGCSSuite(t *testing.T) {
+	suite.Run(t, new(GCSSuite))
+}
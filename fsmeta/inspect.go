@@ -0,0 +1,132 @@
+package fsmeta
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/drakkan/sftpgo/logger"
+	"github.com/drakkan/sftpgo/metrics"
+)
+
+// Inspection compares the metadata stored for an object with the live object store ones
+type Inspection struct {
+	Location string `json:"location"`
+	Path     string `json:"path"`
+	// Stored is nil if there are no stored metadata for the object
+	Stored *Meta `json:"stored"`
+	// Live is nil if the object does not exist
+	Live *Meta `json:"live"`
+	// Matches is true if the stored key matches the live object, so the stored metadata are used
+	Matches bool `json:"matches"`
+}
+
+// InspectS3 returns the stored metadata for the given object next to the HEAD result
+func InspectS3(ctx context.Context, S3 S3API, Bucket, Path string) (Inspection, error) {
+	Result := Inspection{
+		Location: Location(SchemeS3, Bucket),
+		Path:     Path,
+	}
+	if !EnabledForBucket(Bucket) || DefaultFactory == nil {
+		return Result, ErrNotEnabled
+	}
+	Stored, err := getStored(ctx, DefaultFactory.New(NewS3Provider(S3, Bucket)), Path)
+	if err != nil {
+		return Result, err
+	}
+	Live, err := headS3(ctx, S3, Bucket, Path)
+	if err != nil {
+		return Result, err
+	}
+	Result.Stored = Stored
+	Result.Live = Live
+	Result.Matches = Stored != nil && Live != nil && Stored.Key.Equals(Live.Key)
+	return Result, nil
+}
+
+// RefreshS3 replaces the stored key and modification time for the given object with
+// the live ones, the extended attributes are preserved. The stored metadata are
+// removed if the object does not exist
+func RefreshS3(ctx context.Context, S3 S3API, Bucket, Path string) (Inspection, error) {
+	if !EnabledForBucket(Bucket) || DefaultFactory == nil {
+		return Inspection{}, ErrNotEnabled
+	}
+	Provider := DefaultFactory.New(NewS3Provider(S3, Bucket))
+	Stored, err := getStored(ctx, Provider, Path)
+	if err != nil {
+		return Inspection{}, err
+	}
+	Live, err := headS3(ctx, S3, Bucket, Path)
+	if err != nil {
+		return Inspection{}, err
+	}
+	if Live == nil {
+		err = Provider.Delete(ctx, Path)
+	} else {
+		M := *Live
+		if Stored != nil {
+			M = *Stored
+			M.Key = Live.Key
+			M.LastModified = Live.LastModified
+		}
+		err = Provider.Put(ctx, M)
+	}
+	if err != nil {
+		return Inspection{}, err
+	}
+	metaLog(logger.LevelInfo, "metadata refreshed for %s/%s, object exists: %v", Location(SchemeS3, Bucket), Path,
+		Live != nil)
+	return InspectS3(ctx, S3, Bucket, Path)
+}
+
+// DeleteS3 removes the stored metadata for the given object, the object is not changed
+func DeleteS3(ctx context.Context, S3 S3API, Bucket, Path string) error {
+	if !EnabledForBucket(Bucket) || DefaultFactory == nil {
+		return ErrNotEnabled
+	}
+	return DefaultFactory.New(NewS3Provider(S3, Bucket)).Delete(ctx, Path)
+}
+
+// getStored returns nil if there are no stored metadata for Path, only the
+// entry for Path is read
+func getStored(ctx context.Context, Provider Provider, Path string) (*Meta, error) {
+	if Files, ok := Provider.(fileGetter); ok {
+		return Files.getFile(ctx, Path)
+	}
+	return nil, nil
+}
+
+// headS3 returns nil if the object does not exist
+func headS3(ctx context.Context, S3 S3API, Bucket, Path string) (*Meta, error) {
+	Head, err := S3.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(Bucket),
+		Key:    aws.String(Path),
+	})
+	metrics.S3HeadObjectCompleted(err)
+	if err != nil {
+		if awsErr, ok := err.(awserr.RequestFailure); ok && awsErr.StatusCode() == http.StatusNotFound {
+			return nil, nil
+		}
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, nil
+		}
+		return nil, err
+	}
+	Live := &Meta{
+		Key: Key{
+			Path:      Path,
+			ETag:      strings.Trim(aws.StringValue(Head.ETag), `"`),
+			StoreTime: aws.TimeValue(Head.LastModified),
+			Size:      aws.Int64Value(Head.ContentLength),
+		},
+	}
+	Live.LastModified = Live.Key.StoreTime
+	if FSTime, err := MetaHelper(Head.Metadata).GetTime(S3MetaKey); err == nil {
+		Live.LastModified = FSTime
+	}
+	return Live, nil
+}
@@ -0,0 +1,113 @@
+package fsmeta
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drakkan/sftpgo/vfs/mocks"
+)
+
+func setupInspect(t *testing.T) {
+	EnabledRestore := Enabled
+	CurrentBuckets := Buckets
+	CurrentFactory := DefaultFactory
+	t.Cleanup(func() {
+		Enabled = EnabledRestore
+		Buckets = CurrentBuckets
+		DefaultFactory = CurrentFactory
+	})
+	Enabled = true
+	Buckets = []string{`sftpgo`}
+	DefaultFactory = NewMemoryFactory()
+}
+
+func expectInspectHead(S3Mock *mocks.MockS3API, Output *s3.HeadObjectOutput, err error) {
+	S3Mock.EXPECT().HeadObjectWithContext(gomock.Any(), &s3.HeadObjectInput{
+		Bucket: aws.String(`sftpgo`),
+		Key:    aws.String(`users/test1/a.csv`),
+	}).Return(Output, err)
+}
+
+func TestInspectS3(t *testing.T) {
+	setupInspect(t)
+	ctx := context.Background()
+	S3Mock := mocks.NewMockS3API(gomock.NewController(t))
+	Provider := DefaultFactory.New(NewS3Provider(S3Mock, `sftpgo`))
+
+	UploadTime := time.Date(2020, time.March, 2, 10, 0, 0, 0, time.UTC)
+	ModifiedTime := time.Date(2020, time.March, 1, 8, 30, 0, 0, time.UTC)
+	Live := &s3.HeadObjectOutput{
+		ETag:          aws.String(`"etag-2"`),
+		ContentLength: aws.Int64(20),
+		LastModified:  aws.Time(UploadTime),
+	}
+	require.NoError(t, Provider.Put(ctx, Meta{
+		Key: Key{
+			Path:      `users/test1/a.csv`,
+			ETag:      `etag-1`,
+			StoreTime: UploadTime,
+			Size:      10,
+		},
+		LastModified: ModifiedTime,
+		Mode:         0600,
+	}))
+
+	expectInspectHead(S3Mock, Live, nil)
+	Result, err := InspectS3(ctx, S3Mock, `sftpgo`, `users/test1/a.csv`)
+	require.NoError(t, err)
+	assert.Equal(t, `s3://sftpgo`, Result.Location)
+	require.NotNil(t, Result.Stored)
+	require.NotNil(t, Result.Live)
+	assert.Equal(t, `etag-1`, Result.Stored.Key.ETag)
+	assert.Equal(t, `etag-2`, Result.Live.Key.ETag)
+	assert.Equal(t, UploadTime, Result.Live.LastModified)
+	assert.False(t, Result.Matches)
+
+	// the refresh keeps the stored attributes and takes the live key
+	expectInspectHead(S3Mock, Live, nil)
+	expectInspectHead(S3Mock, Live, nil)
+	Result, err = RefreshS3(ctx, S3Mock, `sftpgo`, `users/test1/a.csv`)
+	require.NoError(t, err)
+	require.NotNil(t, Result.Stored)
+	assert.True(t, Result.Matches)
+	assert.Equal(t, int64(20), Result.Stored.Key.Size)
+	assert.Equal(t, UploadTime, Result.Stored.LastModified)
+	assert.Equal(t, 0600, int(Result.Stored.Mode))
+
+	// the object no longer exists, so the refresh removes the stored metadata
+	NotFound := awserr.NewRequestFailure(awserr.New(`NotFound`, `not found`, nil), http.StatusNotFound, ``)
+	expectInspectHead(S3Mock, nil, NotFound)
+	expectInspectHead(S3Mock, nil, NotFound)
+	Result, err = RefreshS3(ctx, S3Mock, `sftpgo`, `users/test1/a.csv`)
+	require.NoError(t, err)
+	assert.Nil(t, Result.Stored)
+	assert.Nil(t, Result.Live)
+	assert.False(t, Result.Matches)
+
+	require.NoError(t, Provider.Put(ctx, Meta{Key: Key{Path: `users/test1/a.csv`, ETag: `etag-2`}}))
+	require.NoError(t, DeleteS3(ctx, S3Mock, `sftpgo`, `users/test1/a.csv`))
+	Stored, err := getStored(ctx, Provider, `users/test1/a.csv`)
+	require.NoError(t, err)
+	assert.Nil(t, Stored)
+}
+
+func TestInspectS3NotEnabled(t *testing.T) {
+	setupInspect(t)
+	ctx := context.Background()
+	S3Mock := mocks.NewMockS3API(gomock.NewController(t))
+
+	_, err := InspectS3(ctx, S3Mock, `other`, `users/test1/a.csv`)
+	assert.ErrorIs(t, err, ErrNotEnabled)
+	_, err = RefreshS3(ctx, S3Mock, `other`, `users/test1/a.csv`)
+	assert.ErrorIs(t, err, ErrNotEnabled)
+	assert.ErrorIs(t, DeleteS3(ctx, S3Mock, `other`, `users/test1/a.csv`), ErrNotEnabled)
+}
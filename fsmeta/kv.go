@@ -0,0 +1,236 @@
+package fsmeta
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// kvStore is the ordered key/value storage used by the bolt and memory drivers
+type kvStore interface {
+	// Get returns nil if the path does not exist
+	Get(Path string) ([]byte, error)
+	// Scan calls fn, in path order, for every path starting with Prefix
+	Scan(Prefix string, fn func(Path string, Value []byte) error) error
+	// Update atomically removes the Deletes paths and then stores the Puts ones
+	Update(Puts map[string][]byte, Deletes []string) error
+}
+
+type kvRecord struct {
+	Uploaded     time.Time         `json:"uploaded"`
+	Size         int64             `json:"size"`
+	ETag         string            `json:"etag"`
+	LastModified time.Time         `json:"last_modified"`
+	Mode         os.FileMode       `json:"mode,omitempty"`
+	AccessTime   *time.Time        `json:"atime,omitempty"`
+	UID          *int              `json:"uid,omitempty"`
+	GID          *int              `json:"gid,omitempty"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+}
+
+type fsMetaKV struct {
+	KV       kvStore
+	Store    Getter
+	loaded   Getter
+	Location string
+}
+
+type kvFactory struct {
+	KV kvStore
+}
+
+func (f kvFactory) New(Store Store) Provider {
+	return &fsMetaKV{
+		KV:       f.KV,
+		Store:    Store,
+		loaded:   emptyCache,
+		Location: Store.Location(),
+	}
+}
+
+func (Provider *fsMetaKV) Preload(ctx context.Context, Folder string) error {
+	Provider.loaded = emptyCache
+	fileMap, err := scanFolder(ctx, Provider, Folder)
+	if err != nil {
+		return err
+	}
+	Provider.loaded = fileMap
+	return nil
+}
+
+func (Provider *fsMetaKV) Get(ctx context.Context, Key Key) (Meta, error) {
+	return selfHealingGet(ctx, Provider.loaded, Provider.Store, Provider, Key)
+}
+
+func (Provider *fsMetaKV) Lookup(ctx context.Context, Key Key) (Meta, error) {
+	return lookupFile(ctx, Provider, Provider.Store, Provider, Key)
+}
+
+func (Provider *fsMetaKV) getFile(_ context.Context, Path string) (*Meta, error) {
+	if _, _, ok := splitPath(Path); !ok {
+		return nil, nil
+	}
+	Value, err := Provider.KV.Get(Provider.formatPath(Path))
+	if err != nil || Value == nil {
+		return nil, err
+	}
+	var Record kvRecord
+	if err := json.Unmarshal(Value, &Record); err != nil {
+		return nil, err
+	}
+	M := Record.meta(Path)
+	return &M, nil
+}
+
+func (Provider *fsMetaKV) Put(ctx context.Context, M Meta) error {
+	return Provider.PutBatch(ctx, []Meta{M})
+}
+
+// PutBatch stores all the metadata using a single update
+func (Provider *fsMetaKV) PutBatch(_ context.Context, Metas []Meta) error {
+	Puts := make(map[string][]byte)
+	for _, Meta := range Metas {
+		if _, _, ok := splitPath(Meta.Key.Path); !ok {
+			continue
+		}
+		Record := kvRecord{
+			Uploaded:     Meta.Key.StoreTime,
+			Size:         Meta.Key.Size,
+			ETag:         strings.Trim(Meta.Key.ETag, `"`),
+			LastModified: Meta.LastModified,
+			Mode:         Meta.Mode,
+			UID:          Meta.UID,
+			GID:          Meta.GID,
+			Attributes:   Meta.Attributes,
+		}
+		if !Meta.AccessTime.IsZero() {
+			Record.AccessTime = &Meta.AccessTime
+		}
+		Value, err := json.Marshal(Record)
+		if err != nil {
+			return err
+		}
+		Puts[Provider.formatPath(Meta.Key.Path)] = Value
+	}
+	if len(Puts) == 0 {
+		return nil
+	}
+	return Provider.KV.Update(Puts, nil)
+}
+
+func (Provider *fsMetaKV) Rename(ctx context.Context, Source string, Target Key) error {
+	if strings.HasSuffix(Source, `/`) {
+		return Provider.renameFolder(ctx, Source, Target.Path)
+	}
+	if _, _, ok := splitPath(Source); !ok {
+		return nil
+	}
+	if _, _, ok := splitPath(Target.Path); !ok {
+		return Provider.Delete(ctx, Source)
+	}
+	Value, err := Provider.KV.Get(Provider.formatPath(Source))
+	if err != nil || Value == nil {
+		return err
+	}
+	if !Target.StoreTime.IsZero() {
+		var Record kvRecord
+		if err := json.Unmarshal(Value, &Record); err != nil {
+			return err
+		}
+		Record.Uploaded = Target.StoreTime
+		Record.Size = Target.Size
+		Record.ETag = strings.Trim(Target.ETag, `"`)
+		if Value, err = json.Marshal(Record); err != nil {
+			return err
+		}
+	}
+	return Provider.KV.Update(map[string][]byte{Provider.formatPath(Target.Path): Value},
+		[]string{Provider.formatPath(Source)})
+}
+
+func (Provider *fsMetaKV) renameFolder(_ context.Context, Source, Target string) error {
+	if !strings.HasSuffix(Target, `/`) {
+		Target += `/`
+	}
+	if Source == Target {
+		return nil
+	}
+	SourcePath := Provider.formatPath(Source)
+	TargetPath := Provider.formatPath(Target)
+
+	Puts := make(map[string][]byte)
+	var Deletes []string
+	if err := Provider.KV.Scan(SourcePath, func(StoredPath string, Value []byte) error {
+		Puts[TargetPath+strings.TrimPrefix(StoredPath, SourcePath)] = Value
+		Deletes = append(Deletes, StoredPath)
+		return nil
+	}); err != nil {
+		return err
+	}
+	if len(Deletes) == 0 {
+		return nil
+	}
+	return Provider.KV.Update(Puts, Deletes)
+}
+
+func (Provider *fsMetaKV) Delete(_ context.Context, Path string) error {
+	if !strings.HasSuffix(Path, `/`) {
+		if _, _, ok := splitPath(Path); !ok {
+			return nil
+		}
+		return Provider.KV.Update(nil, []string{Provider.formatPath(Path)})
+	}
+	var Deletes []string
+	if err := Provider.KV.Scan(Provider.formatPath(Path), func(StoredPath string, _ []byte) error {
+		Deletes = append(Deletes, StoredPath)
+		return nil
+	}); err != nil {
+		return err
+	}
+	if len(Deletes) == 0 {
+		return nil
+	}
+	return Provider.KV.Update(nil, Deletes)
+}
+
+func (Provider *fsMetaKV) Scan(ctx context.Context, Prefix string, fn func(Meta) error) error {
+	Location := Provider.formatPath(``)
+	return Provider.KV.Scan(Provider.formatPath(Prefix), func(StoredPath string, Value []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var Record kvRecord
+		if err := json.Unmarshal(Value, &Record); err != nil {
+			return err
+		}
+		return fn(Record.meta(strings.TrimPrefix(StoredPath, Location)))
+	})
+}
+
+// meta returns the metadata stored in the record for the given object path
+func (Record kvRecord) meta(Path string) Meta {
+	M := Meta{
+		Key: Key{
+			Path:      Path,
+			ETag:      Record.ETag,
+			StoreTime: Record.Uploaded,
+			Size:      Record.Size,
+		},
+		LastModified: Record.LastModified,
+		Mode:         Record.Mode,
+		UID:          Record.UID,
+		GID:          Record.GID,
+		Attributes:   Record.Attributes,
+	}
+	if Record.AccessTime != nil {
+		M.AccessTime = *Record.AccessTime
+	}
+	return M
+}
+
+func (Provider *fsMetaKV) formatPath(v string) string {
+	return fmt.Sprintf(`%s/%s`, Provider.Location, v)
+}
@@ -14,6 +14,10 @@ type emptyGetterS struct{}
 type fileMap map[string]Meta
 type MetaHelper map[string]*string
 
+// StringMetaHelper is the MetaHelper counterpart for backends exposing
+// metadata as plain strings, such as GCS objects and Azure blobs
+type StringMetaHelper map[string]string
+
 var (
 	ErrMetaKeyNotFound = errors.New(`meta key not found`)
 )
@@ -39,7 +43,7 @@ func (f emptyGetterS) Get(_ context.Context, Key Key) (Meta, error) {
 func (f fileMap) Get(_ context.Context, Key Key) (Meta, error) {
 	if Record, ok := f[Key.Path]; ok {
 		if Record.Key.Equals(Key) {
-			return Record, nil
+			return Record.clone(), nil
 		}
 		return Meta{
 			Key: Key,
@@ -50,6 +54,15 @@ func (f fileMap) Get(_ context.Context, Key Key) (Meta, error) {
 	}, ErrCacheMiss
 }
 
+// clone returns a copy of the map, the metadata are cloned too
+func (f fileMap) clone() fileMap {
+	Clone := make(fileMap, len(f))
+	for Path, M := range f {
+		Clone[Path] = M.clone()
+	}
+	return Clone
+}
+
 func (Helper MetaHelper) GetTime(Key string) (time.Time, error) {
 	if Value, ok := Helper[Key]; ok && Value != nil {
 		return parseTime(*Value)
@@ -60,6 +73,26 @@ func (Helper MetaHelper) GetTime(Key string) (time.Time, error) {
 	return time.Time{}, ErrMetaKeyNotFound
 }
 
+func (Helper StringMetaHelper) GetTime(Key string) (time.Time, error) {
+	if Value, ok := Helper[Key]; ok {
+		return parseTime(Value)
+	} else if Value, ok := Helper[strings.ToLower(Key)]; ok {
+		return parseTime(Value)
+	}
+
+	return time.Time{}, ErrMetaKeyNotFound
+}
+
+// splitPath splits an object key into its folder, including the trailing
+// slash, and file name. Keys without a folder are not tracked
+func splitPath(v string) (string, string, bool) {
+	lastIndex := strings.LastIndex(v, `/`)
+	if lastIndex <= 0 {
+		return ``, ``, false
+	}
+	return v[0 : lastIndex+1], v[lastIndex+1:], true
+}
+
 // parseTime parse a time in either RFC3339 format, an Int(seconds), or an Int(Nanoseconds)
 func parseTime(v string) (time.Time, error) {
 	if Time, err := time.Parse(time.RFC3339, v); err == nil {
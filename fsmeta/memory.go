@@ -0,0 +1,63 @@
+package fsmeta
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+type memoryKV struct {
+	sync.RWMutex
+	values map[string][]byte
+}
+
+// NewMemoryFactory returns a Factory storing the metadata in memory,
+// they are lost on restart so this driver is mainly useful for tests
+func NewMemoryFactory() Factory {
+	return &kvFactory{
+		KV: &memoryKV{
+			values: make(map[string][]byte),
+		},
+	}
+}
+
+func (m *memoryKV) Get(Path string) ([]byte, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	return m.values[Path], nil
+}
+
+func (m *memoryKV) Scan(Prefix string, fn func(Path string, Value []byte) error) error {
+	m.RLock()
+	var Paths []string
+	Values := make(map[string][]byte)
+	for Path, Value := range m.values {
+		if strings.HasPrefix(Path, Prefix) {
+			Paths = append(Paths, Path)
+			Values[Path] = Value
+		}
+	}
+	m.RUnlock()
+
+	sort.Strings(Paths)
+	for _, Path := range Paths {
+		if err := fn(Path, Values[Path]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memoryKV) Update(Puts map[string][]byte, Deletes []string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	for _, Path := range Deletes {
+		delete(m.values, Path)
+	}
+	for Path, Value := range Puts {
+		m.values[Path] = Value
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+package fsmeta
+
+import (
+	"testing"
+)
+
+func TestMemoryFactory(t *testing.T) {
+	testFactory(t, NewMemoryFactory())
+}
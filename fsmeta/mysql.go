@@ -0,0 +1,93 @@
+//go:build !nomysql
+// +build !nomysql
+
+package fsmeta
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	// import migrate mysql driver, it registers go-sql-driver/mysql too
+	mysqlmigrate "github.com/golang-migrate/migrate/v4/database/mysql"
+
+	mysqlbindata "github.com/drakkan/sftpgo/fsmeta/sql/mysql"
+	"github.com/drakkan/sftpgo/logger"
+)
+
+var mysqlQueries = newSQLQueries(MySQLDriverName, ``)
+
+func init() {
+	sharedMigrations[MySQLDriverName] = sqlMigrations{
+		AssetNames:       mysqlbindata.AssetNames,
+		Asset:            mysqlbindata.Asset,
+		SQLDriver:        `mysql`,
+		ConnectionParams: `multiStatements=true`,
+		// the data provider connection doesn't parse the datetime columns
+		QueryParams: `parseTime=true&loc=UTC&charset=utf8mb4`,
+		WithInstance: func(DB *sql.DB, MigrationsTable string) (database.Driver, error) {
+			return mysqlmigrate.WithInstance(DB, &mysqlmigrate.Config{MigrationsTable: MigrationsTable})
+		},
+	}
+}
+
+// NewMySQLFactory returns a Factory storing the metadata in the given MySQL database.
+// The connection must be opened with parseTime enabled
+func NewMySQLFactory(DB *sql.DB) Factory {
+	return &sqlFactory{
+		DB:      DB,
+		Queries: mysqlQueries,
+	}
+}
+
+func (config *Config) getMySQLConnectionString(redactedPwd bool, additionalParams string) string {
+	password := config.Password
+	if redactedPwd {
+		password = "[redacted]"
+	}
+	return fmt.Sprintf("%v:%v@tcp([%v]:%v)/%v?charset=utf8mb4&interpolateParams=true&timeout=10s&tls=%v"+
+		"&writeTimeout=10s&readTimeout=10s&parseTime=true&loc=UTC%v", config.Username, password, config.Host,
+		config.Port, config.Database, getMySQLSSLMode(config.SSLMode), additionalParams)
+}
+
+func (config *Config) initializeMySQLProvider() error {
+	if err := migrateDatabase(mysqlbindata.AssetNames, mysqlbindata.Asset,
+		`mysql://`+config.getMySQLConnectionString(false,
+			fmt.Sprintf(`&multiStatements=true&x-migrations-table=%v`, migrationsTable))); err != nil {
+		return err
+	}
+
+	var err error
+	logSender = fmt.Sprintf("fsmeta_%v", MySQLDriverName)
+	dbHandle, err := sql.Open("mysql", config.getMySQLConnectionString(false, ``))
+	if err == nil {
+		metaLog(logger.LevelDebug, "mysql database handle created, connection string: %#v, pool size: %v",
+			config.getMySQLConnectionString(true, ``), config.PoolSize)
+		dbHandle.SetMaxOpenConns(config.PoolSize)
+		if config.PoolSize > 0 {
+			dbHandle.SetMaxIdleConns(config.PoolSize)
+		} else {
+			dbHandle.SetMaxIdleConns(2)
+		}
+		dbHandle.SetConnMaxLifetime(240 * time.Second)
+		DefaultFactory = NewMySQLFactory(dbHandle)
+	} else {
+		metaLog(logger.LevelWarn, "error creating mysql database handler, connection string: %#v, error: %v",
+			config.getMySQLConnectionString(true, ``), err)
+	}
+	return err
+}
+
+func getMySQLSSLMode(SSLMode int) string {
+	if SSLMode == 0 {
+		return "false"
+	} else if SSLMode == 1 {
+		return "true"
+	} else if SSLMode == 2 {
+		return "skip-verify"
+	} else if SSLMode == 3 {
+		return "preferred"
+	}
+	return ``
+}
@@ -0,0 +1,10 @@
+//go:build nomysql
+// +build nomysql
+
+package fsmeta
+
+import "errors"
+
+func (config *Config) initializeMySQLProvider() error {
+	return errors.New("MySQL disabled at build time")
+}
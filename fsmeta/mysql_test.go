@@ -0,0 +1,78 @@
+//go:build !nomysql
+// +build !nomysql
+
+package fsmeta
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetMySQLConnectionString(t *testing.T) {
+	Config := Config{
+		Driver:   MySQLDriverName,
+		Host:     `127.0.0.1`,
+		Port:     3306,
+		Database: `sftpgo`,
+		Username: `user1`,
+		Password: `pass1`,
+		SSLMode:  2,
+	}
+	assert.Equal(t, `user1:[redacted]@tcp([127.0.0.1]:3306)/sftpgo?charset=utf8mb4&interpolateParams=true&timeout=10s`+
+		`&tls=skip-verify&writeTimeout=10s&readTimeout=10s&parseTime=true&loc=UTC`, Config.getMySQLConnectionString(true, ``))
+}
+
+func TestSharedMySQLConnection(t *testing.T) {
+	EnabledRestore := Enabled
+	CurrentFactory := DefaultFactory
+	t.Cleanup(func() {
+		Enabled = EnabledRestore
+		DefaultFactory = CurrentFactory
+		require.NoError(t, InitializeShared(Config{}, SharedDatabase{}, false))
+	})
+
+	// the data provider connection string doesn't parse the datetime columns
+	ConnectionString := `user1:pass1@tcp([127.0.0.1]:3306)/sftpgo?charset=utf8&interpolateParams=true&timeout=10s`
+	DB, err := sql.Open(`mysql`, ConnectionString)
+	require.NoError(t, err)
+	defer DB.Close()
+	Shared := SharedDatabase{
+		Driver:           MySQLDriverName,
+		DB:               DB,
+		ConnectionString: ConnectionString,
+	}
+	require.NoError(t, InitializeShared(Config{Enabled: true, PoolSize: 5}, Shared, false))
+	Factory, ok := DefaultFactory.(*sqlFactory)
+	require.True(t, ok)
+	// the fsmeta queries use a dedicated pool
+	assert.NotEqual(t, DB, Factory.DB)
+	assert.Equal(t, sharedDBHandle, Factory.DB)
+	assert.Equal(t, 5, Factory.DB.Stats().MaxOpenConnections)
+
+	Cfg, err := mysql.ParseDSN(appendConnectionParams(ConnectionString, sharedMigrations[MySQLDriverName].QueryParams))
+	require.NoError(t, err)
+	assert.True(t, Cfg.ParseTime)
+	assert.Equal(t, time.UTC, Cfg.Loc)
+	assert.Equal(t, `utf8mb4`, Cfg.Params[`charset`])
+	assert.Equal(t, `/path?a=b`, appendConnectionParams(`/path?a=b`, ``))
+	assert.Equal(t, `/path?c=d`, appendConnectionParams(`/path`, `c=d`))
+
+	// the dedicated pool is closed if fsmeta is initialized again
+	Dedicated := Factory.DB
+	require.NoError(t, InitializeShared(Config{}, SharedDatabase{}, false))
+	assert.Nil(t, sharedDBHandle)
+	err = Dedicated.Ping()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `database is closed`)
+	}
+	// the data provider pool is not closed, no server is listening
+	err = DB.Ping()
+	if assert.Error(t, err) {
+		assert.NotContains(t, err.Error(), `database is closed`)
+	}
+}
@@ -1,165 +1,101 @@
 package fsmeta
 
 import (
-	"context"
 	"database/sql"
 	"fmt"
-	"path"
-	"strings"
+	"net/url"
+	"time"
 
-	"github.com/drakkan/sftpgo/metrics"
-)
+	"github.com/golang-migrate/migrate/v4/database"
+	// import migrate postgres driver to register the postgres driver
+	pgmigrate "github.com/golang-migrate/migrate/v4/database/postgres"
 
-type fsMetaPostgres struct {
-	DB            *sql.DB
-	S3            Getter
-	loaded        Getter
-	Bucket        string
-	folderIDCache map[string]uint64
-}
+	sqlbindata "github.com/drakkan/sftpgo/fsmeta/sql"
+	"github.com/drakkan/sftpgo/logger"
+)
 
-type postgresS3Factory struct {
-	DB *sql.DB
-}
+var pgsqlQueries = newSQLQueries(PGSQLDriverName, ``)
 
-func (p postgresS3Factory) New(S3 S3API, Bucket string) Provider {
-	return &fsMetaPostgres{
-		DB:            p.DB,
-		S3:            NewS3Provider(S3, Bucket),
-		loaded:        emptyCache,
-		Bucket:        Bucket,
-		folderIDCache: make(map[string]uint64),
+func init() {
+	sharedMigrations[PGSQLDriverName] = sqlMigrations{
+		AssetNames: sqlbindata.AssetNames,
+		Asset:      sqlbindata.Asset,
+		SQLDriver:  `postgres`,
+		WithInstance: func(DB *sql.DB, MigrationsTable string) (database.Driver, error) {
+			return pgmigrate.WithInstance(DB, &pgmigrate.Config{MigrationsTable: MigrationsTable})
+		},
 	}
 }
 
-func NewPostgresS3Factory(DB *sql.DB) S3Factory {
-	return &postgresS3Factory{
-		DB: DB,
+// NewPostgresFactory returns a Factory storing the metadata in the given PostgreSQL database
+func NewPostgresFactory(DB *sql.DB) Factory {
+	return &sqlFactory{
+		DB:      DB,
+		Queries: pgsqlQueries,
 	}
 }
 
-func (Provider *fsMetaPostgres) Preload(ctx context.Context, Folder string) error {
-	FolderID, err := Provider.getFolderID(ctx, Folder)
-	if err != nil && err == sql.ErrNoRows {
-		Provider.loaded = emptyCache
-		return nil
-	} else if err != nil {
-		Provider.loaded = emptyCache
-		return err
+func (config *Config) GetDSN(redactedPwd bool, additionalFields url.Values) string {
+	UserInfo := url.UserPassword(config.Username, config.Password)
+	if redactedPwd {
+		UserInfo = url.User(config.Username)
 	}
-
-	Rows, err := Provider.DB.QueryContext(ctx, `SELECT filename, filesize, uploaded, etag, last_modified `+
-		`FROM fsmeta_files WHERE folder_id = $1`, FolderID)
-	if err != nil {
-		return err
+	u := url.URL{
+		Scheme: "postgres",
+		User:   UserInfo,
+		Host:   fmt.Sprintf(`%s:%d`, config.Host, config.Port),
+		Path:   config.Database,
 	}
-	//goland:noinspection GoUnhandledErrorResult
-	defer Rows.Close()
-
-	fileMap := make(fileMap)
-
-	for Rows.Next() {
-		var Filename string
-		var Meta Meta
-
-		if err := Rows.Scan(&Filename, &Meta.Key.Size, &Meta.Key.StoreTime, &Meta.Key.ETag, &Meta.LastModified); err != nil {
-			return err
-		}
-		Meta.Key.Path = path.Clean(Folder + `/` + Filename)
-		fileMap[Meta.Key.Path] = Meta
+	q := u.Query()
+	q.Set("sslmode", getSSLMode(config.SSLMode))
+	q.Set("connect_timeout", "10")
+	if config.Schema != `` {
+		q.Set("search_path", config.Schema)
 	}
-	if err := Rows.Err(); err != nil {
-		return err
+	for k, v := range additionalFields {
+		q[k] = v
 	}
-
-	Provider.loaded = fileMap
-	return nil
+	u.RawQuery = q.Encode()
+	return u.String()
 }
 
-func (Provider *fsMetaPostgres) Put(ctx context.Context, Meta Meta) error {
-	lastIndex := strings.LastIndex(Meta.Key.Path, `/`)
-	if lastIndex > 0 {
-		Folder := Meta.Key.Path[0 : lastIndex+1]
-		Filename := Meta.Key.Path[lastIndex+1:]
-
-		FolderID, err := Provider.getFolderID(ctx, Folder)
-		if err == sql.ErrNoRows {
-			FolderID, err = Provider.createFolder(ctx, Folder)
-			if err != nil {
-				return err
-			}
-		} else if err != nil {
-			return err
-		}
-
-		Meta.Key.ETag = strings.Trim(Meta.Key.ETag, `"`)
-		if _, err := Provider.DB.ExecContext(ctx, `INSERT INTO fsmeta_files `+
-			`(folder_id, filename, uploaded, filesize, etag, last_modified) VALUES ($1, $2, $3, $4, $5, $6) `+
-			`ON CONFLICT (folder_id, filename) DO UPDATE `+
-			`SET uploaded=$3, filesize=$4, etag=$5, last_modified=$6`,
-			FolderID, Filename, Meta.Key.StoreTime, Meta.Key.Size, Meta.Key.ETag, Meta.LastModified); err != nil {
-			return err
-		}
+func (config *Config) initializePGSQLProvider() error {
+	values := url.Values{}
+	values.Set(`x-migrations-table`, migrationsTable)
+	if err := migrateDatabase(sqlbindata.AssetNames, sqlbindata.Asset, config.GetDSN(false, values)); err != nil {
+		return err
 	}
 
-	return nil
-}
-
-func (Provider *fsMetaPostgres) getFolderID(ctx context.Context, v string) (uint64, error) {
-	if ID, ok := Provider.folderIDCache[v]; ok {
-		return ID, nil
-	}
-	var FolderKey uint64
-	Row := Provider.DB.QueryRowContext(ctx, `SELECT id FROM fsmeta_folders WHERE path=$1`, Provider.formatPath(v))
-	err := Row.Scan(&FolderKey)
+	var err error
+	logSender = fmt.Sprintf("fsmeta_%v", PGSQLDriverName)
+	dbHandle, err := sql.Open("postgres", config.GetDSN(false, nil))
 	if err == nil {
-		Provider.folderIDCache[v] = FolderKey
-	}
-	return FolderKey, err
-}
-
-func (Provider *fsMetaPostgres) createFolder(ctx context.Context, v string) (uint64, error) {
-	var folderID uint64
-	Row := Provider.DB.QueryRowContext(ctx, `INSERT INTO fsmeta_folders (path) VALUES ($1) ON CONFLICT (path) DO NOTHING RETURNING id`, Provider.formatPath(v))
-	err := Row.Scan(&folderID)
-	if err == sql.ErrNoRows {
-		// ON CONFLICT DO NOTHING: Causes empty result set.
-		return Provider.getFolderID(ctx, v)
-	} else if err == nil {
-		Provider.folderIDCache[v] = folderID
+		metaLog(logger.LevelDebug, "postgres database handle created, connection string: %#v, pool size: %v",
+			config.GetDSN(true, nil), config.PoolSize)
+		dbHandle.SetMaxOpenConns(config.PoolSize)
+		if config.PoolSize > 0 {
+			dbHandle.SetMaxIdleConns(config.PoolSize)
+		} else {
+			dbHandle.SetMaxIdleConns(2)
+		}
+		dbHandle.SetConnMaxLifetime(240 * time.Second)
+		DefaultFactory = NewPostgresFactory(dbHandle)
+	} else {
+		metaLog(logger.LevelWarn, "error creating postgres database handler, connection string: %#v, error: %v",
+			config.GetDSN(true, nil), err)
 	}
-	return folderID, err
-}
-
-func (Provider *fsMetaPostgres) formatPath(v string) string {
-	return fmt.Sprintf(`s3://%s/%s`, Provider.Bucket, v)
+	return err
 }
 
-func (Provider *fsMetaPostgres) Get(ctx context.Context, Key Key) (Meta, error) {
-	if M, err := Provider.loaded.Get(ctx, Key); err == nil {
-		metrics.FSMetaPostgresCache(nil)
-		return M, nil
-	} else if err == ErrCacheMiss || err == ErrCacheInvalid {
-		metrics.FSMetaPostgresCache(err)
-		S3Meta, err := Provider.S3.Get(ctx, Key)
-		if err != nil {
-			metrics.FSMetaPostgresSelfHeal(err)
-			return Meta{
-				Key:          Key,
-				LastModified: Key.StoreTime,
-			}, err
-		}
-		if err := Provider.Put(ctx, S3Meta); err != nil {
-			metrics.FSMetaPostgresSelfHeal(err)
-			return S3Meta, err
-		}
-
-		metrics.FSMetaPostgresSelfHeal(nil)
-		return S3Meta, nil
-	} else {
-		return Meta{
-			Key:          Key,
-			LastModified: Key.StoreTime,
-		}, err
+func getSSLMode(SSLMode int) string {
+	if SSLMode == 0 {
+		return "disable"
+	} else if SSLMode == 1 {
+		return "require"
+	} else if SSLMode == 2 {
+		return "verify-ca"
+	} else if SSLMode == 3 {
+		return "verify-full"
 	}
+	return ``
 }
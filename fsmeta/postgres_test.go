@@ -3,6 +3,7 @@ package fsmeta
 import (
 	"context"
 	"database/sql"
+	"os"
 	"regexp"
 	"strings"
 	"testing"
@@ -43,9 +44,10 @@ func (Suite *PostgresSuite) AfterTest(_, _ string) {
 }
 
 func (Suite *PostgresSuite) TestGetFolderID() {
-	Provider := &fsMetaPostgres{
+	Provider := &fsMetaSQL{
 		DB:            Suite.DB,
-		Bucket:        "sftpgo",
+		Queries:       pgsqlQueries,
+		Location:      "s3://sftpgo",
 		folderIDCache: make(map[string]uint64),
 	}
 
@@ -57,9 +59,10 @@ func (Suite *PostgresSuite) TestGetFolderID() {
 }
 
 func (Suite *PostgresSuite) TestCreateFolderNoConflict() {
-	Provider := &fsMetaPostgres{
+	Provider := &fsMetaSQL{
 		DB:            Suite.DB,
-		Bucket:        "sftpgo",
+		Queries:       pgsqlQueries,
+		Location:      "s3://sftpgo",
 		folderIDCache: make(map[string]uint64),
 	}
 
@@ -71,9 +74,10 @@ func (Suite *PostgresSuite) TestCreateFolderNoConflict() {
 }
 
 func (Suite *PostgresSuite) TestCreateFolderConflict() {
-	Provider := &fsMetaPostgres{
+	Provider := &fsMetaSQL{
 		DB:            Suite.DB,
-		Bucket:        "sftpgo",
+		Queries:       pgsqlQueries,
+		Location:      "s3://sftpgo",
 		folderIDCache: make(map[string]uint64),
 	}
 
@@ -88,8 +92,8 @@ func (Suite *PostgresSuite) TestCreateFolderConflict() {
 func (Suite *PostgresSuite) TestPreload() {
 	// Setup Mock Providers
 	S3 := mocks.NewMockS3API(Suite.MockCtl)
-	Factory := NewPostgresS3Factory(Suite.DB)
-	Provider := Factory.New(S3, `sftpgo`)
+	Factory := NewPostgresFactory(Suite.DB)
+	Provider := Factory.New(NewS3Provider(S3, `sftpgo`))
 
 	// Generate Sample Data
 	UploadTime1 := time.Date(2020, time.February, 15, 12, 34, 56, 0, time.UTC)
@@ -116,11 +120,13 @@ func (Suite *PostgresSuite) TestPreload() {
 	// First row is proper cached match
 	// Second row is invalid / expired cache match - cause S3 lookup
 	// Third test3.csv not returned (cache miss) - cause S3 lookup
-	Rows := sqlmock.NewRows([]string{`filename`, `filesize`, `uploaded`, `etag`, `last_modified`}).
-		AddRow(`test1.csv`, 12345, UploadTime1, `etag1`, LastModified1).
-		AddRow(`test2.csv`, 12345, UploadTime2, `not_etag2`, LastModified2)
+	Rows := sqlmock.NewRows([]string{`filename`, `filesize`, `uploaded`, `etag`, `last_modified`,
+		`mode`, `atime`, `uid`, `gid`, `attributes`}).
+		AddRow(`test1.csv`, 12345, UploadTime1, `etag1`, LastModified1, 0, nil, nil, nil, nil).
+		AddRow(`test2.csv`, 12345, UploadTime2, `not_etag2`, LastModified2, 0, nil, nil, nil, nil)
 	Suite.mockFolderIDQuery(`s3://sftpgo/users/test2/`, 15)
-	Suite.SQLMock.ExpectQuery(regexp.QuoteMeta(`SELECT filename, filesize, uploaded, etag, last_modified ` +
+	Suite.SQLMock.ExpectQuery(regexp.QuoteMeta(`SELECT filename, filesize, uploaded, etag, last_modified, ` +
+		`mode, atime, uid, gid, attributes ` +
 		`FROM fsmeta_files WHERE folder_id = $1`)).
 		WithArgs(15).
 		//Suite.SQLMock.ExpectQuery(regexp.QuoteMeta(`SELECT filename, filesize, uploaded, etag, last_modified `+
@@ -130,18 +136,20 @@ func (Suite *PostgresSuite) TestPreload() {
 
 	// Database Mocks for test2.csv
 	Suite.SQLMock.ExpectExec(regexp.QuoteMeta(`INSERT INTO fsmeta_files `+
-		`(folder_id, filename, uploaded, filesize, etag, last_modified) VALUES ($1, $2, $3, $4, $5, $6) `+
+		`(folder_id, filename, uploaded, filesize, etag, last_modified, mode, atime, uid, gid, attributes) `+
+		`VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) `+
 		`ON CONFLICT (folder_id, filename) DO UPDATE `+
-		`SET uploaded=$3, filesize=$4, etag=$5, last_modified=$6`)).
-		WithArgs(15, `test2.csv`, UploadTime2, Key2.Size, `etag2`, LastModified2).
+		`SET uploaded=$3, filesize=$4, etag=$5, last_modified=$6, mode=$7, atime=$8, uid=$9, gid=$10, attributes=$11`)).
+		WithArgs(15, `test2.csv`, UploadTime2, Key2.Size, `etag2`, LastModified2, 0, nil, nil, nil, nil).
 		WillReturnResult(sqlmock.NewResult(0, 1))
 
 	// Database Mocks for test3.csv
 	Suite.SQLMock.ExpectExec(regexp.QuoteMeta(`INSERT INTO fsmeta_files `+
-		`(folder_id, filename, uploaded, filesize, etag, last_modified) VALUES ($1, $2, $3, $4, $5, $6) `+
+		`(folder_id, filename, uploaded, filesize, etag, last_modified, mode, atime, uid, gid, attributes) `+
+		`VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) `+
 		`ON CONFLICT (folder_id, filename) DO UPDATE `+
-		`SET uploaded=$3, filesize=$4, etag=$5, last_modified=$6`)).
-		WithArgs(15, `test3.csv`, UploadTime3, Key3.Size, `etag3`, LastModified3).
+		`SET uploaded=$3, filesize=$4, etag=$5, last_modified=$6, mode=$7, atime=$8, uid=$9, gid=$10, attributes=$11`)).
+		WithArgs(15, `test3.csv`, UploadTime3, Key3.Size, `etag3`, LastModified3, 0, nil, nil, nil, nil).
 		WillReturnResult(sqlmock.NewResult(0, 1))
 
 	S3.EXPECT().HeadObjectWithContext(Ctx, &s3.HeadObjectInput{
@@ -174,6 +182,221 @@ func (Suite *PostgresSuite) TestPreload() {
 	Suite.Nil(err3)
 }
 
+func (Suite *PostgresSuite) TestRenameFile() {
+	Provider := &fsMetaSQL{
+		DB:            Suite.DB,
+		Queries:       pgsqlQueries,
+		Location:      "s3://sftpgo",
+		folderIDCache: make(map[string]uint64),
+	}
+	UploadTime := time.Date(2020, time.February, 15, 12, 34, 56, 0, time.UTC)
+
+	Suite.mockFolderIDQuery(`s3://sftpgo/users/test1/`, 15)
+	Suite.mockFolderIDQuery(`s3://sftpgo/users/test1/archive/`)
+	Suite.mockCreateFolderQuery(`s3://sftpgo/users/test1/archive/`, 16)
+	Suite.SQLMock.ExpectBegin()
+	Suite.SQLMock.ExpectExec(regexp.QuoteMeta(`DELETE FROM fsmeta_files WHERE folder_id=$1 AND filename=$2`)).
+		WithArgs(16, `new.csv`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	Suite.SQLMock.ExpectExec(regexp.QuoteMeta(`UPDATE fsmeta_files SET folder_id=$1, filename=$2, uploaded=$3, filesize=$4, etag=$5 `+
+		`WHERE folder_id=$6 AND filename=$7`)).
+		WithArgs(16, `new.csv`, UploadTime, 123, `etag1`, 15, `old.csv`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	Suite.SQLMock.ExpectCommit()
+
+	Suite.Nil(Provider.Rename(context.Background(), `users/test1/old.csv`, Key{
+		Path:      `users/test1/archive/new.csv`,
+		ETag:      `"etag1"`,
+		StoreTime: UploadTime,
+		Size:      123,
+	}))
+}
+
+func (Suite *PostgresSuite) TestRenameFileNotTracked() {
+	Provider := &fsMetaSQL{
+		DB:            Suite.DB,
+		Queries:       pgsqlQueries,
+		Location:      "s3://sftpgo",
+		folderIDCache: make(map[string]uint64),
+	}
+
+	Suite.mockFolderIDQuery(`s3://sftpgo/users/test1/`)
+
+	Suite.Nil(Provider.Rename(context.Background(), `users/test1/old.csv`, Key{Path: `users/test1/new.csv`}))
+}
+
+func (Suite *PostgresSuite) TestRenameFolder() {
+	Provider := &fsMetaSQL{
+		DB:            Suite.DB,
+		Queries:       pgsqlQueries,
+		Location:      "s3://sftpgo",
+		folderIDCache: map[string]uint64{`users/test1/dir/`: 20, `users/test1/`: 15},
+	}
+
+	Suite.SQLMock.ExpectBegin()
+	Suite.SQLMock.ExpectQuery(regexp.QuoteMeta(`SELECT id, path FROM fsmeta_folders WHERE substr(path, 1, length($1)) = $2`)).
+		WithArgs(`s3://sftpgo/users/test1/dir/`, `s3://sftpgo/users/test1/dir/`).
+		WillReturnRows(sqlmock.NewRows([]string{`id`, `path`}).
+			AddRow(20, `s3://sftpgo/users/test1/dir/`))
+	Suite.mockFolderIDQuery(`s3://sftpgo/users/test1/newdir/`)
+	Suite.SQLMock.ExpectExec(regexp.QuoteMeta(`UPDATE fsmeta_folders SET path=$1 WHERE id=$2`)).
+		WithArgs(`s3://sftpgo/users/test1/newdir/`, 20).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	Suite.SQLMock.ExpectCommit()
+
+	Suite.Nil(Provider.Rename(context.Background(), `users/test1/dir/`, Key{Path: `users/test1/newdir`}))
+	Suite.Equal(map[string]uint64{`users/test1/`: 15}, Provider.folderIDCache)
+}
+
+func (Suite *PostgresSuite) TestRenameFolderMerge() {
+	Provider := &fsMetaSQL{
+		DB:            Suite.DB,
+		Queries:       pgsqlQueries,
+		Location:      "s3://sftpgo",
+		folderIDCache: make(map[string]uint64),
+	}
+
+	Suite.SQLMock.ExpectBegin()
+	Suite.SQLMock.ExpectQuery(regexp.QuoteMeta(`SELECT id, path FROM fsmeta_folders WHERE substr(path, 1, length($1)) = $2`)).
+		WithArgs(`s3://sftpgo/users/test1/dir/`, `s3://sftpgo/users/test1/dir/`).
+		WillReturnRows(sqlmock.NewRows([]string{`id`, `path`}).
+			AddRow(20, `s3://sftpgo/users/test1/dir/`))
+	Suite.mockFolderIDQuery(`s3://sftpgo/users/test1/newdir/`, 21)
+	Suite.SQLMock.ExpectExec(regexp.QuoteMeta(`DELETE FROM fsmeta_files WHERE folder_id=$1 AND filename IN `+
+		`(SELECT filename FROM fsmeta_files WHERE folder_id=$2)`)).
+		WithArgs(21, 20).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	Suite.SQLMock.ExpectExec(regexp.QuoteMeta(`UPDATE fsmeta_files SET folder_id=$1 WHERE folder_id=$2`)).
+		WithArgs(21, 20).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	Suite.SQLMock.ExpectExec(regexp.QuoteMeta(`DELETE FROM fsmeta_folders WHERE id=$1`)).
+		WithArgs(20).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	Suite.SQLMock.ExpectCommit()
+
+	Suite.Nil(Provider.Rename(context.Background(), `users/test1/dir/`, Key{Path: `users/test1/newdir/`}))
+}
+
+func (Suite *PostgresSuite) TestDeleteFile() {
+	Provider := &fsMetaSQL{
+		DB:            Suite.DB,
+		Queries:       pgsqlQueries,
+		Location:      "s3://sftpgo",
+		folderIDCache: make(map[string]uint64),
+	}
+
+	Suite.mockFolderIDQuery(`s3://sftpgo/users/test1/`, 15)
+	Suite.SQLMock.ExpectExec(regexp.QuoteMeta(`DELETE FROM fsmeta_files WHERE folder_id=$1 AND filename=$2`)).
+		WithArgs(15, `test.csv`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	Suite.Nil(Provider.Delete(context.Background(), `users/test1/test.csv`))
+	// keys without a folder are not tracked
+	Suite.Nil(Provider.Delete(context.Background(), `test.csv`))
+}
+
+func (Suite *PostgresSuite) TestDeleteFolder() {
+	Provider := &fsMetaSQL{
+		DB:            Suite.DB,
+		Queries:       pgsqlQueries,
+		Location:      "s3://sftpgo",
+		folderIDCache: map[string]uint64{`users/test1/dir/sub/`: 21},
+	}
+
+	Suite.SQLMock.ExpectBegin()
+	Suite.SQLMock.ExpectExec(regexp.QuoteMeta(`DELETE FROM fsmeta_files WHERE folder_id IN `+
+		`(SELECT id FROM fsmeta_folders WHERE substr(path, 1, length($1)) = $2)`)).
+		WithArgs(`s3://sftpgo/users/test1/dir/`, `s3://sftpgo/users/test1/dir/`).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+	Suite.SQLMock.ExpectExec(regexp.QuoteMeta(`DELETE FROM fsmeta_folders WHERE substr(path, 1, length($1)) = $2`)).
+		WithArgs(`s3://sftpgo/users/test1/dir/`, `s3://sftpgo/users/test1/dir/`).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	Suite.SQLMock.ExpectCommit()
+
+	Suite.Nil(Provider.Delete(context.Background(), `users/test1/dir/`))
+	Suite.Empty(Provider.folderIDCache)
+}
+
+func (Suite *PostgresSuite) TestScanPrefix() {
+	Provider := &fsMetaSQL{
+		DB:            Suite.DB,
+		Queries:       pgsqlQueries,
+		Location:      "s3://sftpgo",
+		folderIDCache: make(map[string]uint64),
+	}
+	UploadTime := time.Date(2020, time.February, 15, 12, 34, 56, 0, time.UTC)
+
+	Suite.SQLMock.ExpectQuery(regexp.QuoteMeta(`SELECT f.path, fi.filename, fi.filesize, fi.uploaded, fi.etag, fi.last_modified, `+
+		`fi.mode, fi.atime, fi.uid, fi.gid, fi.attributes `+
+		`FROM fsmeta_files fi INNER JOIN fsmeta_folders f ON fi.folder_id = f.id WHERE substr(f.path, 1, length($1)) = $2`)).
+		WithArgs(`s3://sftpgo/users/`, `s3://sftpgo/users/`).
+		WillReturnRows(sqlmock.NewRows([]string{`path`, `filename`, `filesize`, `uploaded`, `etag`, `last_modified`,
+			`mode`, `atime`, `uid`, `gid`, `attributes`}).
+			AddRow(`s3://sftpgo/users/`, `readme.txt`, 5, UploadTime, `etag0`, UploadTime, 0, nil, nil, nil, nil).
+			AddRow(`s3://sftpgo/users/test1/`, `test.csv`, 10, UploadTime, `etag1`, UploadTime, 0, nil, nil, nil, nil).
+			AddRow(`s3://sftpgo/users/test10/dir/`, `test.csv`, 20, UploadTime, `etag2`, UploadTime, 0, nil, nil, nil, nil))
+
+	var Paths []string
+	Suite.Nil(Provider.Scan(context.Background(), `users/test1`, func(M Meta) error {
+		Paths = append(Paths, M.Key.Path)
+		return nil
+	}))
+	Suite.Equal([]string{`users/test1/test.csv`, `users/test10/dir/test.csv`}, Paths)
+}
+
+func (Suite *PostgresSuite) TestSharedFolderCache() {
+	folderCache = newSharedFolderCache(10, time.Minute)
+	defer func() {
+		folderCache = nil
+	}()
+	Factory := NewPostgresFactory(Suite.DB)
+	Ctx := context.Background()
+	UploadTime := time.Date(2020, time.February, 15, 12, 34, 56, 0, time.UTC)
+	Key1 := Key{Path: `users/test1/test1.csv`, ETag: `etag1`, StoreTime: UploadTime, Size: 123}
+	SelectFolderFiles := regexp.QuoteMeta(`SELECT filename, filesize, uploaded, etag, last_modified, ` +
+		`mode, atime, uid, gid, attributes ` +
+		`FROM fsmeta_files WHERE folder_id = $1`)
+	FilesColumns := []string{`filename`, `filesize`, `uploaded`, `etag`, `last_modified`, `mode`, `atime`, `uid`, `gid`, `attributes`}
+
+	// the folder is read only once for all the providers
+	Suite.mockFolderIDQuery(`s3://sftpgo/users/test1/`, 15)
+	Suite.SQLMock.ExpectQuery(SelectFolderFiles).
+		WithArgs(15).
+		WillReturnRows(sqlmock.NewRows(FilesColumns).AddRow(`test1.csv`, 123, UploadTime, `etag1`, UploadTime, 0, nil, nil, nil, nil))
+	for i := 0; i < 2; i++ {
+		Provider := Factory.New(testStore{location: `s3://sftpgo`})
+		Suite.Nil(Provider.Preload(Ctx, `users/test1/`))
+		Actual, err := Provider.Get(Ctx, Key1)
+		Suite.Nil(err)
+		Suite.Equal(UploadTime, Actual.LastModified)
+	}
+
+	// Put keeps the cached folder ID and invalidates the cached files
+	Suite.SQLMock.ExpectExec(regexp.QuoteMeta(`INSERT INTO fsmeta_files `)).
+		WithArgs(15, `test2.csv`, UploadTime, 456, `etag2`, UploadTime, 0, nil, nil, nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	Suite.SQLMock.ExpectQuery(SelectFolderFiles).
+		WithArgs(15).
+		WillReturnRows(sqlmock.NewRows(FilesColumns))
+	Provider := Factory.New(testStore{location: `s3://sftpgo`})
+	Suite.Nil(Provider.Put(Ctx, Meta{
+		Key:          Key{Path: `users/test1/test2.csv`, ETag: `etag2`, StoreTime: UploadTime, Size: 456},
+		LastModified: UploadTime,
+	}))
+	Suite.Nil(Factory.New(testStore{location: `s3://sftpgo`}).Preload(Ctx, `users/test1/`))
+
+	// deleting the folder removes both
+	Suite.SQLMock.ExpectBegin()
+	Suite.SQLMock.ExpectExec(regexp.QuoteMeta(`DELETE FROM fsmeta_files WHERE folder_id IN `)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	Suite.SQLMock.ExpectExec(regexp.QuoteMeta(`DELETE FROM fsmeta_folders WHERE `)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	Suite.SQLMock.ExpectCommit()
+	Suite.mockFolderIDQuery(`s3://sftpgo/users/test1/`)
+	Suite.Nil(Provider.Delete(Ctx, `users/test1/`))
+	Suite.Nil(Factory.New(testStore{location: `s3://sftpgo`}).Preload(Ctx, `users/test1/`))
+}
+
 func (Suite *PostgresSuite) mockFolderIDQuery(FolderArg string, IDs ...int) {
 	Rows := sqlmock.NewRows([]string{`id`})
 	for _, ID := range IDs {
@@ -197,3 +420,42 @@ func (Suite *PostgresSuite) mockCreateFolderQuery(FolderArg string, IDs ...int)
 func TestPostgresSuite(t *testing.T) {
 	suite.Run(t, new(PostgresSuite))
 }
+
+func (Suite *PostgresSuite) TestGetStored() {
+	Provider := &fsMetaSQL{
+		DB:            Suite.DB,
+		Queries:       pgsqlQueries,
+		Location:      "s3://sftpgo",
+		folderIDCache: make(map[string]uint64),
+	}
+	UploadTime := time.Date(2020, time.February, 15, 12, 34, 56, 0, time.UTC)
+	SelectFile := regexp.QuoteMeta(`SELECT filesize, uploaded, etag, last_modified, mode, atime, uid, gid, attributes ` +
+		`FROM fsmeta_files WHERE folder_id = $1 AND filename = $2`)
+
+	// only the row for the inspected file is read
+	Suite.mockFolderIDQuery(`s3://sftpgo/users/test1/`, 15)
+	Suite.SQLMock.ExpectQuery(SelectFile).
+		WithArgs(15, `test.csv`).
+		WillReturnRows(sqlmock.NewRows([]string{`filesize`, `uploaded`, `etag`, `last_modified`, `mode`, `atime`, `uid`, `gid`, `attributes`}).
+			AddRow(10, UploadTime, `etag1`, UploadTime, 0600, nil, 1000, nil, `{"user.owner":"partner1"}`))
+	Stored, err := getStored(context.Background(), Provider, `users/test1/test.csv`)
+	Suite.Nil(err)
+	if Suite.NotNil(Stored) {
+		Suite.Equal(Key{Path: `users/test1/test.csv`, ETag: `etag1`, StoreTime: UploadTime, Size: 10}, Stored.Key)
+		Suite.Equal(os.FileMode(0600), Stored.Mode)
+		Suite.Nil(Stored.GID)
+		Suite.Equal(map[string]string{`user.owner`: `partner1`}, Stored.Attributes)
+	}
+
+	Suite.SQLMock.ExpectQuery(SelectFile).
+		WithArgs(15, `missing.csv`).
+		WillReturnError(sql.ErrNoRows)
+	Stored, err = getStored(context.Background(), Provider, `users/test1/missing.csv`)
+	Suite.Nil(err)
+	Suite.Nil(Stored)
+
+	// objects outside a folder are never stored
+	Stored, err = getStored(context.Background(), Provider, `test.csv`)
+	Suite.Nil(err)
+	Suite.Nil(Stored)
+}
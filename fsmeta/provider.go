@@ -3,11 +3,14 @@ package fsmeta
 import (
 	"context"
 	"errors"
+
+	"github.com/drakkan/sftpgo/metrics"
 )
 
 var (
 	ErrCacheInvalid          = errors.New(`fsmeta: Get(cached key invalid)`)
 	ErrCacheMiss             = errors.New(`fsmeta: Get(cache miss)`)
+	ErrNotTracked            = errors.New(`fsmeta: objects outside a folder are not tracked`)
 	emptyCache      Getter   = &emptyGetterS{}
 	EmptyProvider   Provider = &emptyProvider{}
 )
@@ -22,12 +25,49 @@ type Putter interface {
 	Put(ctx context.Context, Meta Meta) error
 }
 
+// Renamer moves the stored metadata to a new key. The preserved modification
+// time follows the object, while the Target key replaces the stored one unless
+// its StoreTime is zero. A Source ending with a slash is a folder and it is
+// renamed recursively together with all its files and sub folders
+type Renamer interface {
+	Rename(ctx context.Context, Source string, Target Key) error
+}
+
+// Deleter removes the stored metadata. A Path ending with a slash is a folder
+// and it is removed recursively together with all its files and sub folders
+type Deleter interface {
+	Delete(ctx context.Context, Path string) error
+}
+
+// Scanner iterates over all the stored metadata whose path starts with Prefix
+type Scanner interface {
+	Scan(ctx context.Context, Prefix string, fn func(Meta) error) error
+}
+
+// Lookuper returns the metadata for a single object, as Get does, reading only
+// the stored entry for Key instead of relying on the preloaded folder. It suits
+// the single object requests, such as stat, while Preload and Get suit listings
+type Lookuper interface {
+	Lookup(ctx context.Context, Key Key) (Meta, error)
+}
+
 type Provider interface {
 	Getter
 	Putter
+	Renamer
+	Deleter
+	Scanner
+	Lookuper
 	Preload(ctx context.Context, Folder string) error
 }
 
+// fileGetter is implemented by the providers able to read the stored metadata
+// of a single file without loading its whole folder
+type fileGetter interface {
+	// getFile returns nil if there are no stored metadata for Path
+	getFile(ctx context.Context, Path string) (*Meta, error)
+}
+
 func (emptyProvider) Get(_ context.Context, Key Key) (Meta, error) {
 	return Meta{
 		Key:          Key,
@@ -39,6 +79,109 @@ func (emptyProvider) Put(_ context.Context, _ Meta) error {
 	return nil
 }
 
+func (emptyProvider) Rename(_ context.Context, _ string, _ Key) error {
+	return nil
+}
+
+func (emptyProvider) Delete(_ context.Context, _ string) error {
+	return nil
+}
+
+func (emptyProvider) Scan(_ context.Context, _ string, _ func(Meta) error) error {
+	return nil
+}
+
+func (p emptyProvider) Lookup(ctx context.Context, Key Key) (Meta, error) {
+	return p.Get(ctx, Key)
+}
+
 func (emptyProvider) Preload(_ context.Context, _ string) error {
 	return nil
 }
+
+// selfHealingGet looks up the Key in the preloaded metadata, on cache miss or
+// stale entries the metadata is read from the Store and persisted again
+func selfHealingGet(ctx context.Context, Loaded, Store Getter, Putter Putter, Key Key) (Meta, error) {
+	if M, err := Loaded.Get(ctx, Key); err == nil {
+		metrics.FSMetaPostgresCache(nil)
+		return M, nil
+	} else if err == ErrCacheMiss || err == ErrCacheInvalid {
+		metrics.FSMetaPostgresCache(err)
+		StoreMeta, err := Store.Get(ctx, Key)
+		if err != nil {
+			metrics.FSMetaPostgresSelfHeal(err)
+			return Meta{
+				Key:          Key,
+				LastModified: Key.StoreTime,
+			}, err
+		}
+		if err := Putter.Put(ctx, StoreMeta); err != nil {
+			metrics.FSMetaPostgresSelfHeal(err)
+			return StoreMeta, err
+		}
+
+		metrics.FSMetaPostgresSelfHeal(nil)
+		return StoreMeta, nil
+	} else {
+		return Meta{
+			Key:          Key,
+			LastModified: Key.StoreTime,
+		}, err
+	}
+}
+
+// lookupFile reads the stored metadata for Key using Files and then behaves as
+// selfHealingGet, missing or stale entries are read from the Store and persisted
+func lookupFile(ctx context.Context, Files fileGetter, Store Getter, Putter Putter, Key Key) (Meta, error) {
+	Stored, err := Files.getFile(ctx, Key.Path)
+	if err != nil {
+		return Meta{
+			Key:          Key,
+			LastModified: Key.StoreTime,
+		}, err
+	}
+	Loaded := emptyCache
+	if Stored != nil {
+		Loaded = fileMap{Key.Path: *Stored}
+	}
+	return selfHealingGet(ctx, Loaded, Store, Putter, Key)
+}
+
+// Update changes the stored metadata for the object identified by Key, fn is
+// called with the stored metadata, or the Store ones if missing or stale, and
+// the result is persisted. Objects without a folder are not tracked
+func Update(ctx context.Context, Provider Provider, Key Key, fn func(*Meta)) (Meta, error) {
+	Folder, _, ok := splitPath(Key.Path)
+	if !ok {
+		return Meta{}, ErrNotTracked
+	}
+	if err := Provider.Preload(ctx, Folder); err != nil {
+		return Meta{}, err
+	}
+	M, err := Provider.Get(ctx, Key)
+	if err != nil {
+		return M, err
+	}
+	fn(&M)
+	return M, Provider.Put(ctx, M)
+}
+
+// BatchPutter is implemented by the providers able to store several metadata
+// at once, for example using multi-row upserts
+type BatchPutter interface {
+	PutBatch(ctx context.Context, Metas []Meta) error
+}
+
+// PutBatch stores the given metadata using a single batch if the Provider
+// supports it, one by one otherwise
+func PutBatch(ctx context.Context, Provider Putter, Metas []Meta) error {
+	if Batch, ok := Provider.(BatchPutter); ok {
+		return Batch.PutBatch(ctx, Metas)
+	}
+	for _, M := range Metas {
+		if err := Provider.Put(ctx, M); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package fsmeta
 
 import (
 	"context"
+	"sort"
 	"testing"
 	"time"
 
@@ -22,6 +23,8 @@ func TestEmptyProvider(t *testing.T) {
 		LastModified: time.Now(),
 	}))
 	assert.Nil(t, EmptyProvider.Preload(Ctx, ``))
+	assert.Nil(t, EmptyProvider.Rename(Ctx, Key.Path, Key))
+	assert.Nil(t, EmptyProvider.Delete(Ctx, Key.Path))
 
 	Actual, err := EmptyProvider.Get(Ctx, Key)
 
@@ -30,4 +33,143 @@ func TestEmptyProvider(t *testing.T) {
 		LastModified: Key.StoreTime,
 	}, Actual)
 	assert.Equal(t, ErrCacheMiss, err)
+
+	Actual, err = EmptyProvider.Lookup(Ctx, Key)
+	assert.Equal(t, Meta{
+		Key:          Key,
+		LastModified: Key.StoreTime,
+	}, Actual)
+	assert.Equal(t, ErrCacheMiss, err)
+}
+
+type testStore struct {
+	location string
+}
+
+func (s testStore) Get(_ context.Context, Key Key) (Meta, error) {
+	return Meta{
+		Key:          Key,
+		LastModified: Key.StoreTime,
+	}, nil
+}
+
+func (s testStore) Location() string {
+	return s.location
+}
+
+// testFactory runs the same scenario against every driver
+func testFactory(t *testing.T, Factory Factory) {
+	Ctx := context.Background()
+	Provider := Factory.New(testStore{location: `s3://sftpgo`})
+	Uploaded := time.Date(2020, time.March, 2, 10, 0, 0, 0, time.UTC)
+	Modified := time.Date(2020, time.March, 1, 8, 30, 0, 0, time.UTC)
+
+	KeyA := Key{Path: `users/test1/a.csv`, ETag: `"etag-a"`, StoreTime: Uploaded, Size: 10}
+	KeyB := Key{Path: `users/test1/dir/b.csv`, ETag: `etag-b`, StoreTime: Uploaded, Size: 20}
+	KeyC := Key{Path: `users/test2/c.csv`, ETag: `etag-c`, StoreTime: Uploaded, Size: 30}
+	for _, K := range []Key{KeyA, KeyB, KeyC, {Path: `root.csv`, StoreTime: Uploaded}} {
+		assert.NoError(t, Provider.Put(Ctx, Meta{Key: K, LastModified: Modified}))
+	}
+	KeyA.ETag = `etag-a`
+
+	assert.NoError(t, Provider.Preload(Ctx, `users/test1/`))
+	Actual, err := Provider.Get(Ctx, KeyA)
+	assert.NoError(t, err)
+	assert.Equal(t, Meta{Key: KeyA, LastModified: Modified}, normalizeMeta(Actual))
+	// files in sub folders are not preloaded, the store value is returned and persisted
+	Actual, err = Provider.Get(Ctx, KeyB)
+	assert.NoError(t, err)
+	assert.Equal(t, Meta{Key: KeyB, LastModified: Uploaded}, normalizeMeta(Actual))
+
+	assert.Equal(t, []Meta{
+		{Key: KeyA, LastModified: Modified},
+		{Key: KeyB, LastModified: Uploaded},
+	}, scanAll(t, Provider, `users/test1/`))
+	assert.Len(t, scanAll(t, Factory.New(testStore{location: `gs://sftpgo`}), ``), 0)
+
+	// a renamed file keeps its modification time
+	Renamed := Key{Path: `users/test1/archive/a.csv`, ETag: `etag-a2`, StoreTime: Uploaded.Add(time.Hour), Size: 11}
+	assert.NoError(t, Provider.Rename(Ctx, KeyA.Path, Renamed))
+	assert.NoError(t, Provider.Rename(Ctx, `users/test1/missing.csv`, Key{Path: `users/test1/new.csv`}))
+	assert.Equal(t, []Meta{
+		{Key: Renamed, LastModified: Modified},
+		{Key: KeyB, LastModified: Uploaded},
+	}, scanAll(t, Provider, `users/test1/`))
+
+	assert.NoError(t, Provider.Rename(Ctx, `users/test1/`, Key{Path: `users/test3`}))
+	assert.Len(t, scanAll(t, Provider, `users/test1/`), 0)
+	assert.Len(t, scanAll(t, Provider, `users/test3/`), 2)
+
+	assert.NoError(t, Provider.Delete(Ctx, `users/test3/archive/a.csv`))
+	assert.Len(t, scanAll(t, Provider, `users/test3/`), 1)
+	assert.NoError(t, Provider.Delete(Ctx, `users/test3/`))
+	assert.Equal(t, []Meta{{Key: KeyC, LastModified: Modified}}, scanAll(t, Provider, ``))
+
+	// extended attributes are stored and follow the renamed files
+	UID, GID := 1000, 0
+	Accessed := Modified.Add(time.Hour)
+	Updated, err := Update(Ctx, Provider, KeyC, func(M *Meta) {
+		M.Mode = 0600
+		M.AccessTime = Accessed
+		M.UID = &UID
+		M.GID = &GID
+		M.Attributes = map[string]string{`user.owner`: `partner1`}
+	})
+	assert.NoError(t, err)
+	Expected := Meta{
+		Key:          KeyC,
+		LastModified: Modified,
+		Mode:         0600,
+		AccessTime:   Accessed,
+		UID:          &UID,
+		GID:          &GID,
+		Attributes:   map[string]string{`user.owner`: `partner1`},
+	}
+	assert.Equal(t, Expected, normalizeMeta(Updated))
+	// lookups read the single stored entry without any preload
+	Actual, err = Factory.New(testStore{location: `s3://sftpgo`}).Lookup(Ctx, KeyC)
+	assert.NoError(t, err)
+	assert.Equal(t, Expected, normalizeMeta(Actual))
+	Actual, err = Provider.Lookup(Ctx, Key{Path: `users/test2/missing.csv`, StoreTime: Uploaded})
+	assert.NoError(t, err)
+	assert.Equal(t, Meta{Key: Key{Path: `users/test2/missing.csv`, StoreTime: Uploaded}, LastModified: Uploaded},
+		normalizeMeta(Actual))
+	assert.NoError(t, Provider.Delete(Ctx, `users/test2/missing.csv`))
+	assert.NoError(t, Provider.Rename(Ctx, KeyC.Path, Key{Path: `users/test2/renamed.csv`}))
+	Expected.Key.Path = `users/test2/renamed.csv`
+	assert.Equal(t, []Meta{Expected}, scanAll(t, Provider, ``))
+	_, err = Update(Ctx, Provider, Key{Path: `root.csv`}, func(*Meta) {})
+	assert.Equal(t, ErrNotTracked, err)
+
+	// batches insert new files and replace the existing ones, untracked objects are ignored
+	KeyD := Key{Path: `users/test4/d.csv`, ETag: `etag-d`, StoreTime: Uploaded, Size: 40}
+	KeyE := Key{Path: `users/test2/renamed.csv`, ETag: `etag-e`, StoreTime: Uploaded, Size: 50}
+	assert.NoError(t, PutBatch(Ctx, Provider, []Meta{
+		{Key: KeyD, LastModified: Modified, Attributes: map[string]string{`user.batch`: `1`}},
+		{Key: KeyE, LastModified: Uploaded},
+		{Key: Key{Path: `other.csv`, StoreTime: Uploaded}, LastModified: Uploaded},
+	}))
+	assert.Equal(t, []Meta{
+		{Key: KeyE, LastModified: Uploaded},
+		{Key: KeyD, LastModified: Modified, Attributes: map[string]string{`user.batch`: `1`}},
+	}, scanAll(t, Provider, ``))
+}
+
+func scanAll(t *testing.T, Provider Provider, Prefix string) []Meta {
+	var Result []Meta
+	assert.NoError(t, Provider.Scan(context.Background(), Prefix, func(M Meta) error {
+		Result = append(Result, normalizeMeta(M))
+		return nil
+	}))
+	sort.Slice(Result, func(i, j int) bool {
+		return Result[i].Key.Path < Result[j].Key.Path
+	})
+	return Result
+}
+
+func normalizeMeta(M Meta) Meta {
+	M.Key.StoreTime = M.Key.StoreTime.UTC()
+	M.LastModified = M.LastModified.UTC()
+	M.AccessTime = M.AccessTime.UTC()
+	return M
 }
@@ -0,0 +1,136 @@
+package fsmeta
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/drakkan/sftpgo/logger"
+	"github.com/drakkan/sftpgo/metrics"
+)
+
+var (
+	ErrNotEnabled = errors.New(`fsmeta: not enabled for this bucket`)
+)
+
+// ReconcileReport describes the changes applied, or to apply in dry-run mode,
+// while reconciling the stored metadata with the object store listing
+type ReconcileReport struct {
+	Location string `json:"location"`
+	Prefix   string `json:"prefix"`
+	DryRun   bool   `json:"dry_run"`
+	// Scanned is the number of objects listed
+	Scanned int `json:"scanned"`
+	// Matched is the number of objects with up to date metadata
+	Matched int `json:"matched"`
+	// Backfilled are the objects without stored metadata
+	Backfilled []string `json:"backfilled,omitempty"`
+	// Refreshed are the objects whose etag or size does not match the stored metadata
+	Refreshed []string `json:"refreshed,omitempty"`
+	// Deleted are the stored metadata without a matching object
+	Deleted []string `json:"deleted,omitempty"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+// ReconcileS3 walks the given bucket prefix and compares the listed objects with
+// the stored metadata by path, etag and size. Stale rows are deleted while
+// missing or outdated ones are backfilled from the object metadata.
+// Nothing is changed in dry-run mode
+func ReconcileS3(ctx context.Context, S3 S3API, Bucket, Prefix string, DryRun bool) (ReconcileReport, error) {
+	Report := ReconcileReport{
+		Location: Location(SchemeS3, Bucket),
+		Prefix:   Prefix,
+		DryRun:   DryRun,
+	}
+	if !EnabledForBucket(Bucket) || DefaultFactory == nil {
+		return Report, ErrNotEnabled
+	}
+	Store := NewS3Provider(S3, Bucket)
+	Provider := DefaultFactory.New(Store)
+
+	Stored := make(map[string]Meta)
+	if err := Provider.Scan(ctx, Prefix, func(M Meta) error {
+		Stored[M.Key.Path] = M
+		return nil
+	}); err != nil {
+		return Report, err
+	}
+
+	err := S3.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(Bucket),
+		Prefix: aws.String(Prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, Object := range page.Contents {
+			Path := aws.StringValue(Object.Key)
+			if strings.HasSuffix(Path, `/`) {
+				continue
+			}
+			Report.Scanned++
+			ObjectKey := Key{
+				Path:      Path,
+				ETag:      aws.StringValue(Object.ETag),
+				StoreTime: aws.TimeValue(Object.LastModified),
+				Size:      aws.Int64Value(Object.Size),
+			}
+			M, ok := Stored[Path]
+			delete(Stored, Path)
+			if ok && sameObject(M.Key, ObjectKey) {
+				Report.Matched++
+				continue
+			}
+			if ok {
+				Report.Refreshed = append(Report.Refreshed, Path)
+			} else {
+				Report.Backfilled = append(Report.Backfilled, Path)
+			}
+			if DryRun {
+				continue
+			}
+			if err := backfill(ctx, Store, Provider, ObjectKey); err != nil {
+				Report.Errors = append(Report.Errors, fmt.Sprintf(`%s: %v`, Path, err))
+			}
+		}
+		return ctx.Err() == nil
+	})
+	metrics.S3ListObjectsCompleted(err)
+	if err != nil {
+		return Report, err
+	}
+	if err := ctx.Err(); err != nil {
+		return Report, err
+	}
+
+	for Path := range Stored {
+		Report.Deleted = append(Report.Deleted, Path)
+	}
+	sort.Strings(Report.Deleted)
+	if !DryRun {
+		for _, Path := range Report.Deleted {
+			if err := Provider.Delete(ctx, Path); err != nil {
+				Report.Errors = append(Report.Errors, fmt.Sprintf(`%s: %v`, Path, err))
+			}
+		}
+	}
+
+	metaLog(logger.LevelInfo, "reconcile completed for %s/%s, dry run: %v, scanned: %v, matched: %v, backfilled: %v, "+
+		"refreshed: %v, deleted: %v, errors: %v", Report.Location, Prefix, DryRun, Report.Scanned, Report.Matched,
+		len(Report.Backfilled), len(Report.Refreshed), len(Report.Deleted), len(Report.Errors))
+	return Report, nil
+}
+
+func backfill(ctx context.Context, Store Store, Provider Provider, ObjectKey Key) error {
+	M, err := Store.Get(ctx, ObjectKey)
+	if err != nil {
+		return err
+	}
+	return Provider.Put(ctx, M)
+}
+
+func sameObject(Stored, Listed Key) bool {
+	return Stored.Size == Listed.Size && strings.Trim(Stored.ETag, `"`) == strings.Trim(Listed.ETag, `"`)
+}
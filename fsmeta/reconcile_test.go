@@ -0,0 +1,135 @@
+package fsmeta
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/golang/mock/gomock"
+
+	"github.com/drakkan/sftpgo/vfs/mocks"
+)
+
+var (
+	reconcileUploadTime   = time.Date(2020, time.March, 2, 10, 0, 0, 0, time.UTC)
+	reconcileModifiedTime = time.Date(2020, time.March, 1, 8, 30, 0, 0, time.UTC)
+)
+
+func (Suite *PostgresSuite) setupReconcile() {
+	EnabledRestore := Enabled
+	CurrentBuckets := Buckets
+	CurrentFactory := DefaultFactory
+	Suite.T().Cleanup(func() {
+		Enabled = EnabledRestore
+		Buckets = CurrentBuckets
+		DefaultFactory = CurrentFactory
+	})
+	Enabled = true
+	Buckets = []string{`sftpgo`}
+	DefaultFactory = NewPostgresFactory(Suite.DB)
+}
+
+func (Suite *PostgresSuite) mockReconcileListing(S3Mock *mocks.MockS3API) {
+	S3Mock.EXPECT().ListObjectsV2PagesWithContext(gomock.Any(), &s3.ListObjectsV2Input{
+		Bucket: aws.String(`sftpgo`),
+		Prefix: aws.String(`users/test1/`),
+	}, gomock.Any()).DoAndReturn(func(_ context.Context, _ *s3.ListObjectsV2Input,
+		fn func(*s3.ListObjectsV2Output, bool) bool, _ ...interface{}) error {
+		fn(&s3.ListObjectsV2Output{
+			Contents: []*s3.Object{
+				{Key: aws.String(`users/test1/a.csv`), ETag: aws.String(`"etag-a"`), Size: aws.Int64(10), LastModified: aws.Time(reconcileUploadTime)},
+				{Key: aws.String(`users/test1/c.csv`), ETag: aws.String(`"etag-c2"`), Size: aws.Int64(30), LastModified: aws.Time(reconcileUploadTime)},
+				{Key: aws.String(`users/test1/dir/`), Size: aws.Int64(0), LastModified: aws.Time(reconcileUploadTime)},
+			},
+		}, false)
+		fn(&s3.ListObjectsV2Output{
+			Contents: []*s3.Object{
+				{Key: aws.String(`users/test1/dir/d.csv`), ETag: aws.String(`"etag-d"`), Size: aws.Int64(40), LastModified: aws.Time(reconcileUploadTime)},
+			},
+		}, true)
+		return nil
+	})
+}
+
+func (Suite *PostgresSuite) mockReconcileScan() {
+	Suite.SQLMock.ExpectQuery(regexp.QuoteMeta(`SELECT f.path, fi.filename, fi.filesize, fi.uploaded, fi.etag, fi.last_modified, `+
+		`fi.mode, fi.atime, fi.uid, fi.gid, fi.attributes `+
+		`FROM fsmeta_files fi INNER JOIN fsmeta_folders f ON fi.folder_id = f.id WHERE substr(f.path, 1, length($1)) = $2`)).
+		WithArgs(`s3://sftpgo/users/test1/`, `s3://sftpgo/users/test1/`).
+		WillReturnRows(sqlmock.NewRows([]string{`path`, `filename`, `filesize`, `uploaded`, `etag`, `last_modified`,
+			`mode`, `atime`, `uid`, `gid`, `attributes`}).
+			AddRow(`s3://sftpgo/users/test1/`, `a.csv`, 10, reconcileUploadTime, `etag-a`, reconcileModifiedTime, 0, nil, nil, nil, nil).
+			AddRow(`s3://sftpgo/users/test1/`, `b.csv`, 20, reconcileUploadTime, `etag-b`, reconcileModifiedTime, 0, nil, nil, nil, nil).
+			AddRow(`s3://sftpgo/users/test1/`, `c.csv`, 30, reconcileUploadTime, `etag-c1`, reconcileModifiedTime, 0, nil, nil, nil, nil))
+}
+
+func (Suite *PostgresSuite) TestReconcileDryRun() {
+	Suite.setupReconcile()
+	S3Mock := mocks.NewMockS3API(Suite.MockCtl)
+	Suite.mockReconcileScan()
+	Suite.mockReconcileListing(S3Mock)
+
+	Report, err := ReconcileS3(context.Background(), S3Mock, `sftpgo`, `users/test1/`, true)
+	Suite.Nil(err)
+	Suite.Equal(ReconcileReport{
+		Location:   `s3://sftpgo`,
+		Prefix:     `users/test1/`,
+		DryRun:     true,
+		Scanned:    3,
+		Matched:    1,
+		Backfilled: []string{`users/test1/dir/d.csv`},
+		Refreshed:  []string{`users/test1/c.csv`},
+		Deleted:    []string{`users/test1/b.csv`},
+	}, Report)
+}
+
+func (Suite *PostgresSuite) TestReconcile() {
+	Suite.setupReconcile()
+	S3Mock := mocks.NewMockS3API(Suite.MockCtl)
+	Suite.mockReconcileScan()
+	Suite.mockReconcileListing(S3Mock)
+
+	S3Mock.EXPECT().HeadObjectWithContext(gomock.Any(), &s3.HeadObjectInput{
+		Bucket: aws.String(`sftpgo`),
+		Key:    aws.String(`users/test1/c.csv`),
+	}).Return(&s3.HeadObjectOutput{Metadata: NewS3Metadata(reconcileModifiedTime)}, nil)
+	Suite.mockFolderIDQuery(`s3://sftpgo/users/test1/`, 15)
+	Suite.SQLMock.ExpectExec(regexp.QuoteMeta(`INSERT INTO fsmeta_files`)).
+		WithArgs(15, `c.csv`, reconcileUploadTime, 30, `etag-c2`, reconcileModifiedTime, 0, nil, nil, nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	S3Mock.EXPECT().HeadObjectWithContext(gomock.Any(), &s3.HeadObjectInput{
+		Bucket: aws.String(`sftpgo`),
+		Key:    aws.String(`users/test1/dir/d.csv`),
+	}).Return(&s3.HeadObjectOutput{}, nil)
+	Suite.mockFolderIDQuery(`s3://sftpgo/users/test1/dir/`)
+	Suite.mockCreateFolderQuery(`s3://sftpgo/users/test1/dir/`, 16)
+	Suite.SQLMock.ExpectExec(regexp.QuoteMeta(`INSERT INTO fsmeta_files`)).
+		WithArgs(16, `d.csv`, reconcileUploadTime, 40, `etag-d`, reconcileUploadTime, 0, nil, nil, nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	Suite.SQLMock.ExpectExec(regexp.QuoteMeta(`DELETE FROM fsmeta_files WHERE folder_id=$1 AND filename=$2`)).
+		WithArgs(15, `b.csv`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	Report, err := ReconcileS3(context.Background(), S3Mock, `sftpgo`, `users/test1/`, false)
+	Suite.Nil(err)
+	Suite.Equal(3, Report.Scanned)
+	Suite.Equal(1, Report.Matched)
+	Suite.Equal([]string{`users/test1/dir/d.csv`}, Report.Backfilled)
+	Suite.Equal([]string{`users/test1/c.csv`}, Report.Refreshed)
+	Suite.Equal([]string{`users/test1/b.csv`}, Report.Deleted)
+	Suite.Empty(Report.Errors)
+}
+
+func (Suite *PostgresSuite) TestReconcileNotEnabled() {
+	Suite.setupReconcile()
+	Buckets = []string{`other`}
+	S3Mock := mocks.NewMockS3API(Suite.MockCtl)
+
+	_, err := ReconcileS3(context.Background(), S3Mock, `sftpgo`, `users/test1/`, true)
+	Suite.Equal(ErrNotEnabled, err)
+}
@@ -13,6 +13,8 @@ import (
 
 type S3API interface {
 	HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput, opts ...request.Option) (*s3.HeadObjectOutput, error)
+	ListObjectsV2PagesWithContext(ctx aws.Context, input *s3.ListObjectsV2Input,
+		fn func(*s3.ListObjectsV2Output, bool) bool, opts ...request.Option) error
 }
 
 type s3Provider struct {
@@ -20,13 +22,17 @@ type s3Provider struct {
 	bucket string
 }
 
-func NewS3Provider(s3 S3API, Bucket string) Getter {
+func NewS3Provider(s3 S3API, Bucket string) Store {
 	return &s3Provider{
 		s3:     s3,
 		bucket: Bucket,
 	}
 }
 
+func (s *s3Provider) Location() string {
+	return Location(SchemeS3, s.bucket)
+}
+
 func (s *s3Provider) Get(ctx context.Context, Key Key) (Meta, error) {
 	Head, err := s.s3.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(s.bucket),
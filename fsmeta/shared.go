@@ -0,0 +1,180 @@
+package fsmeta
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	bindata "github.com/golang-migrate/migrate/v4/source/go_bindata"
+
+	"github.com/drakkan/sftpgo/logger"
+)
+
+// sqlMigrations describes how to run the embedded migrations on an existing database
+type sqlMigrations struct {
+	AssetNames func() []string
+	Asset      func(name string) ([]byte, error)
+	// SQLDriver is the database/sql driver name
+	SQLDriver string
+	// ConnectionParams are appended to the connection string used to run the migrations
+	ConnectionParams string
+	// QueryParams are the connection settings required by the fsmeta queries. If set,
+	// they are appended to the data provider connection string to open a dedicated
+	// connection pool, the data provider one could use different settings
+	QueryParams  string
+	WithInstance func(DB *sql.DB, MigrationsTable string) (database.Driver, error)
+}
+
+var (
+	// sharedMigrations are registered by the SQL drivers enabled at build time
+	sharedMigrations = make(map[string]sqlMigrations)
+	// sharedDBHandle is the dedicated connection pool opened by InitializeShared, if any
+	sharedDBHandle *sql.DB
+)
+
+// SharedDatabase is the data provider database used to store the fsmeta
+// tables if Config.UseDataProvider is set
+type SharedDatabase struct {
+	// Driver is the data provider driver name
+	Driver string
+	// TablesPrefix is the data provider SQL tables prefix, it is prepended
+	// to the fsmeta tables too
+	TablesPrefix string
+	// DB is the data provider connection pool, fsmeta never closes it
+	DB *sql.DB
+	// ConnectionString is used to open a dedicated connection to run the migrations
+	// and a dedicated pool for the queries if the driver requires specific settings
+	ConnectionString string
+}
+
+// InitializeShared is the Initialize counterpart for the UseDataProvider mode, the
+// fsmeta tables are stored in the data provider database. If migrate is false the
+// migrations are expected to be applied using MigrateShared
+func InitializeShared(cnf Config, Shared SharedDatabase, Migrate bool) error {
+	if sharedDBHandle != nil {
+		sharedDBHandle.Close()
+		sharedDBHandle = nil
+	}
+	if cnf.Enabled {
+		if _, ok := sharedMigrations[Shared.Driver]; !ok {
+			return fmt.Errorf("fsmeta is not supported for the %#v data provider", Shared.Driver)
+		}
+		if Migrate {
+			if err := MigrateShared(Shared); err != nil {
+				return err
+			}
+		}
+		DB, err := Shared.getQueriesDB(cnf.PoolSize)
+		if err != nil {
+			return err
+		}
+		logSender = fmt.Sprintf("fsmeta_%v", Shared.Driver)
+		DefaultFactory = &sqlFactory{
+			DB:      DB,
+			Queries: newSQLQueries(Shared.Driver, Shared.TablesPrefix),
+		}
+	}
+	cnf.initializeCache()
+	Enabled = cnf.Enabled
+	Buckets = cnf.Buckets
+	ChtimesCopyInPlace = cnf.ChtimesCopyInPlace
+	return nil
+}
+
+// getQueriesDB returns the connection pool to use for the fsmeta queries, the data
+// provider one or a dedicated one if the driver requires specific connection settings
+func (Shared SharedDatabase) getQueriesDB(PoolSize int) (*sql.DB, error) {
+	Migrations := sharedMigrations[Shared.Driver]
+	if Migrations.QueryParams == `` {
+		return Shared.DB, nil
+	}
+	DB, err := sql.Open(Migrations.SQLDriver, appendConnectionParams(Shared.ConnectionString, Migrations.QueryParams))
+	if err != nil {
+		metaLog(logger.LevelWarn, "error creating the %v database handle for the shared mode: %v", Shared.Driver, err)
+		return nil, err
+	}
+	metaLog(logger.LevelDebug, "%v database handle created for the shared mode, pool size: %v", Shared.Driver, PoolSize)
+	DB.SetMaxOpenConns(PoolSize)
+	if PoolSize > 0 {
+		DB.SetMaxIdleConns(PoolSize)
+	} else {
+		DB.SetMaxIdleConns(2)
+	}
+	DB.SetConnMaxLifetime(240 * time.Second)
+	sharedDBHandle = DB
+	return DB, nil
+}
+
+// appendConnectionParams appends the given params to the connection string, the
+// drivers use the last value if a param is repeated
+func appendConnectionParams(ConnectionString, Params string) string {
+	if Params == `` {
+		return ConnectionString
+	}
+	if strings.Contains(ConnectionString, `?`) {
+		return ConnectionString + `&` + Params
+	}
+	return ConnectionString + `?` + Params
+}
+
+// MigrateShared creates or updates the fsmeta tables inside the data provider database
+func MigrateShared(Shared SharedDatabase) error {
+	return Shared.migrate(func(m *migrate.Migrate) error {
+		return m.Up()
+	})
+}
+
+// RevertShared removes the fsmeta tables from the data provider database
+func RevertShared(Shared SharedDatabase) error {
+	return Shared.migrate(func(m *migrate.Migrate) error {
+		return m.Down()
+	})
+}
+
+func (Shared SharedDatabase) migrate(fn func(m *migrate.Migrate) error) error {
+	Migrations, ok := sharedMigrations[Shared.Driver]
+	if !ok {
+		return fmt.Errorf("fsmeta is not supported for the %#v data provider", Shared.Driver)
+	}
+	ConnectionString := appendConnectionParams(Shared.ConnectionString, Migrations.ConnectionParams)
+	// the migrate drivers close the database when done, so the shared pool is not used
+	DB, err := sql.Open(Migrations.SQLDriver, ConnectionString)
+	if err != nil {
+		return err
+	}
+	Driver, err := Migrations.WithInstance(DB, Shared.TablesPrefix+migrationsTable)
+	if err != nil {
+		DB.Close()
+		return err
+	}
+	// every fsmeta identifier, tables, indexes and constraints, starts with fsmeta_
+	Replacer := strings.NewReplacer(`fsmeta_`, Shared.TablesPrefix+`fsmeta_`)
+	s := bindata.Resource(Migrations.AssetNames(), func(name string) ([]byte, error) {
+		Data, err := Migrations.Asset(name)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(Replacer.Replace(string(Data))), nil
+	})
+	d, err := bindata.WithInstance(s)
+	if err != nil {
+		Driver.Close()
+		return err
+	}
+	m, err := migrate.NewWithInstance(`go-bindata`, d, Shared.Driver, Driver)
+	if err != nil {
+		Driver.Close()
+		return err
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer m.Close()
+	m.Log = &migrateLogger{}
+
+	if err := fn(m); err != nil && err != migrate.ErrNoChange {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+//go:build !nosqlite
+// +build !nosqlite
+
+package fsmeta
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSharedDatabase(t *testing.T) {
+	EnabledRestore := Enabled
+	CurrentFactory := DefaultFactory
+	t.Cleanup(func() {
+		Enabled = EnabledRestore
+		DefaultFactory = CurrentFactory
+	})
+
+	ConnectionString := fmt.Sprintf("file:%v?cache=shared&_foreign_keys=1", filepath.Join(t.TempDir(), `sftpgo.db`))
+	DB, err := sql.Open(`sqlite3`, ConnectionString)
+	require.NoError(t, err)
+	defer DB.Close()
+	Shared := SharedDatabase{
+		Driver:           SQLiteDriverName,
+		TablesPrefix:     `prefix_`,
+		DB:               DB,
+		ConnectionString: ConnectionString,
+	}
+
+	err = InitializeShared(Config{Enabled: true}, SharedDatabase{Driver: BoltDriverName}, true)
+	assert.Error(t, err)
+
+	require.NoError(t, InitializeShared(Config{Enabled: true}, Shared, true))
+	assert.True(t, Enabled)
+	// the shared pool must be still usable after the migrations
+	var Count int
+	assert.NoError(t, DB.QueryRow(`SELECT count(*) FROM prefix_fsmeta_schema_migrations`).Scan(&Count))
+	assert.Equal(t, 1, Count)
+	assert.NoError(t, MigrateShared(Shared))
+	testFactory(t, DefaultFactory)
+
+	assert.NoError(t, RevertShared(Shared))
+	assert.Error(t, DB.QueryRow(`SELECT count(*) FROM prefix_fsmeta_files`).Scan(&Count))
+	assert.NoError(t, RevertShared(Shared))
+}
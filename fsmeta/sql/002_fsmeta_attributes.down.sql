@@ -0,0 +1,10 @@
+BEGIN;
+
+ALTER TABLE fsmeta_files
+    DROP COLUMN mode,
+    DROP COLUMN atime,
+    DROP COLUMN uid,
+    DROP COLUMN gid,
+    DROP COLUMN attributes;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,10 @@
+BEGIN;
+
+ALTER TABLE fsmeta_files
+    ADD COLUMN mode       integer default 0 not null,
+    ADD COLUMN atime      timestamp with time zone null,
+    ADD COLUMN uid        integer           null,
+    ADD COLUMN gid        integer           null,
+    ADD COLUMN attributes text              null;
+
+COMMIT;
\ No newline at end of file
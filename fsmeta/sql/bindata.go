@@ -2,7 +2,8 @@
 // sources:
 // 001_initial_fsmeta.down.sql
 // 001_initial_fsmeta.up.sql
-// bindata.go
+// 002_fsmeta_attributes.down.sql
+// 002_fsmeta_attributes.up.sql
 // gen.go
 // DO NOT EDIT!
 
@@ -71,7 +72,7 @@ func (fi bindataFileInfo) Sys() interface{} {
 	return nil
 }
 
-var __001_initial_fsmetaDownSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x72\x72\x75\xf7\xf4\xb3\xe6\xe2\x72\x09\xf2\x0f\x50\x08\x71\x74\xf2\x71\x55\xf0\x74\x53\x70\x8d\xf0\x0c\x0e\x09\x56\x48\x2b\xce\x4d\x2d\x49\x8c\x4f\xcb\xcc\x49\x2d\xb6\xc6\xaf\x24\x3f\x27\x25\xb5\xa8\xd8\x9a\x8b\xcb\xd9\xdf\xd7\xd7\x33\xc4\x1a\x10\x00\x00\xff\xff\x99\x7b\x05\xfa\x58\x00\x00\x00")
+var __001_initial_fsmetaDownSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\x73\x72\x75\xf7\xf4\xb3\xe6\xe2\x72\x09\xf2\x0f\x50\x08\x71\x74\xf2\x71\x55\xf0\x74\x53\x70\x8d\xf0\x0c\x0e\x09\x56\x48\x2b\xce\x4d\x2d\x49\x8c\x4f\xcb\xcc\x49\x2d\xb6\xc6\xaf\x24\x3f\x27\x25\xb5\x08\xa8\x88\xcb\xd9\xdf\xd7\xd7\x33\xc4\x1a\x00\x99\x7b\x05\xfa\x58\x00\x00\x00")
 
 func _001_initial_fsmetaDownSqlBytes() ([]byte, error) {
 	return bindataRead(
@@ -86,12 +87,12 @@ func _001_initial_fsmetaDownSql() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "001_initial_fsmeta.down.sql", size: 88, mode: os.FileMode(420), modTime: time.Unix(1611257883, 0)}
+	info := bindataFileInfo{name: "001_initial_fsmeta.down.sql", size: 88, mode: os.FileMode(436), modTime: time.Unix(1747926875, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
 
-var __001_initial_fsmetaUpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xa4\x52\x4f\xab\xe2\x30\x10\xbf\xf7\x53\xcc\x4d\x05\x0f\x7b\xd6\x93\xee\x66\x97\xc2\x5a\x79\xcf\x0a\xde\x42\x30\x53\x1d\x4c\xd2\x92\x4c\x79\xea\xa7\x7f\xf4\x9f\x62\x55\x14\xde\x1c\xdb\xf9\xfd\x9d\xcc\xc5\xbf\x38\x99\x46\xd1\xef\x4f\x31\x4b\x05\xa4\xb3\xf9\x7f\x01\xf1\x5f\x48\x96\x29\x88\x4d\xbc\x4a\x57\x90\x05\x8b\xac\x64\x96\x1b\x8d\x3e\x44\xc3\x08\x00\x80\x34\x00\x04\xf4\xa4\x0c\xb8\x9c\xc1\x95\xc6\xd4\x3f\xaa\xd9\xe6\x2e\xb0\x57\xe4\xb8\x07\x96\xc5\x01\x0a\x4f\x56\xf9\x13\x1c\xf0\x34\xae\x11\x85\xe2\x3d\x30\x1e\x19\xe0\x4a\x35\xba\x7a\x5a\x27\xf1\xc7\x5a\x40\x9c\xfc\x11\x9b\x3b\x3e\xc5\x7b\x59\x92\xd3\x78\xac\xb9\x96\x49\x6f\x03\x86\xd5\xca\xe8\xbd\x84\x64\xf0\x26\xdf\x65\xda\xa0\xf7\xf3\x4e\xf4\x8a\xf5\x61\xf0\xc6\xa2\x6c\xa5\xc8\x31\xee\xd0\xff\x40\xa3\xd7\x0d\x69\x99\x1d\xc0\x63\x86\x1e\xdd\x16\x43\xaf\x99\xd6\x03\x19\x74\xca\x62\xc3\xdc\x5e\xe1\xb9\x87\x06\x54\x16\x26\x57\x1a\xdb\x8a\x98\x2c\x06\x56\xb6\x80\x2f\xaa\x2e\x49\x16\xe1\x9c\x3b\xec\x81\x6a\x8f\x74\x6e\x95\xba\xb4\x1a\x33\x55\x1a\x86\x5f\x8f\x95\x90\xd5\xee\xea\xa2\xb3\xd7\x81\x06\x83\xc9\xa4\xfe\x76\x0b\x32\x2a\xb0\xb4\xb9\xa6\x8c\x50\xbf\xb6\xf7\xf2\xad\x35\xe5\x76\xc7\x92\x5d\x65\x4f\xde\x5d\xb5\x0d\xc3\xcb\xfa\xf8\x52\x71\x2d\xb3\x5c\x2c\xe2\x74\xfa\x1d\x00\x00\xff\xff\x9e\xc2\xf1\xf4\x76\x03\x00\x00")
+var __001_initial_fsmetaUpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\xa5\x52\xcb\x6e\xc2\x30\x10\xbc\xe7\x2b\xf6\x46\x90\x38\xf4\x0c\x27\x68\xd3\x2a\x52\x09\x6a\x09\x12\x37\xcb\xc2\x1b\x6a\xc5\xb1\x23\xdb\x51\x81\xaf\xaf\xe3\x3c\x10\x01\x04\x52\xf7\x10\xc5\xc9\xce\xec\xcc\xac\x17\xd1\x47\x9c\xcc\x82\xe0\xf5\x3b\x9a\xa7\x11\xa4\xf3\xc5\x67\x04\xf1\x3b\x24\xab\x14\xa2\x6d\xbc\x4e\xd7\x90\x99\x02\x2d\x25\x99\x12\x0c\xb5\x09\xc2\x00\x5c\x71\xe6\x1e\x06\x35\xa7\x02\xa4\xb2\x20\x2b\x21\xfc\x8f\xba\x76\x4a\x1a\xab\x29\x97\x76\x00\x26\x65\x0e\xa5\xe6\x05\xd5\x47\xc8\xf1\x38\xf1\x88\x92\xda\x1f\xb0\x78\xb0\xee\xbd\xa7\x1a\x9f\x35\x6d\x92\xf8\x6b\xe3\x44\x25\x6f\xd1\xf6\x8a\xcf\x61\x49\xc5\x25\xc3\x83\xe7\x5a\x25\x83\x0e\x08\xeb\x96\xf1\x73\x0e\xb9\xc0\x0b\x7f\x7d\xb5\x46\xaf\xeb\x19\xeb\x35\xeb\x4d\xe3\x8d\x44\xd2\x8e\x72\x10\xdc\xa3\xfe\xc7\x8c\x41\x36\x9c\x91\x2c\x07\x8d\x19\x6a\x94\x3b\x34\x83\x64\x5a\x0d\x0e\x29\x69\x81\x0d\x73\xbb\x85\xfb\x1a\x1a\x50\x55\x0a\x45\x19\xb6\x11\x59\x5e\xa0\xb1\xb4\x28\xe1\x97\xd7\x9b\x74\x47\x38\x29\x89\x03\x90\xd7\xc8\x4f\xed\xa4\xce\x2d\xc3\x8c\x56\xc2\xc2\xcb\xed\x49\x4e\xef\xfe\xac\xa2\x93\xd7\x81\x46\xa3\xe9\xd4\x7f\xbb\x04\x09\x6a\x2c\x29\x14\xe3\x19\x77\x1a\x1f\xca\x7b\x78\xd7\x9a\x70\xbb\x65\x91\x2e\xb2\x3b\xf7\xae\xee\x86\xb0\x6f\x9f\xf4\x11\xfb\x31\xab\xe5\x32\x4e\x67\x7f\x9e\xc2\xf1\xf4\x76\x03\x00\x00")
 
 func _001_initial_fsmetaUpSqlBytes() ([]byte, error) {
 	return bindataRead(
@@ -106,32 +107,52 @@ func _001_initial_fsmetaUpSql() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "001_initial_fsmeta.up.sql", size: 886, mode: os.FileMode(420), modTime: time.Unix(1611260677, 0)}
+	info := bindataFileInfo{name: "001_initial_fsmeta.up.sql", size: 886, mode: os.FileMode(436), modTime: time.Unix(1747926875, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
 
-var _bindataGo = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x01\x00\x00\xff\xff\x00\x00\x00\x00\x00\x00\x00\x00")
+var __002_fsmeta_attributesDownSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\x73\x72\x75\xf7\xf4\xb3\xe6\xe2\x72\xf4\x09\x71\x0d\x52\x08\x71\x74\xf2\x71\x55\x48\x2b\xce\x4d\x2d\x49\x8c\x4f\xcb\xcc\x49\x2d\xe6\x52\x00\x02\x97\x20\xff\x00\x05\x67\x7f\x9f\x50\x5f\x3f\x85\xdc\xfc\x94\x54\x1d\x0c\xd1\xc4\x92\xcc\x5c\x2c\xc2\xa5\x99\x29\x98\x82\xe9\xd8\x04\x13\x4b\x4a\x8a\x32\x93\x4a\x4b\x52\x8b\x81\x8e\x71\xf6\xf7\xf5\xf5\x0c\xb1\x06\x00\x7a\xfa\x2b\xae\x9c\x00\x00\x00")
 
-func bindataGoBytes() ([]byte, error) {
+func _002_fsmeta_attributesDownSqlBytes() ([]byte, error) {
 	return bindataRead(
-		_bindataGo,
-		"bindata.go",
+		__002_fsmeta_attributesDownSql,
+		"002_fsmeta_attributes.down.sql",
 	)
 }
 
-func bindataGo() (*asset, error) {
-	bytes, err := bindataGoBytes()
+func _002_fsmeta_attributesDownSql() (*asset, error) {
+	bytes, err := _002_fsmeta_attributesDownSqlBytes()
 	if err != nil {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "bindata.go", size: 4096, mode: os.FileMode(420), modTime: time.Unix(1611260681, 0)}
+	info := bindataFileInfo{name: "002_fsmeta_attributes.down.sql", size: 156, mode: os.FileMode(420), modTime: time.Unix(1792322604, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
 
-var _genGo = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x2a\x48\x4c\xce\x4e\x4c\x4f\x55\x28\x2e\xcc\xe1\xe2\xd2\xd7\x4f\xcf\xb7\x4a\x4f\xcd\x4b\x2d\x4a\x2c\x49\x55\x48\xcf\xd7\x4d\xca\xcc\x4b\x49\x2c\x49\x54\xd0\x2d\xc8\x4e\x07\x29\x51\xd0\xe3\x02\x04\x00\x00\xff\xff\x94\x1c\xa4\x24\x31\x00\x00\x00")
+var __002_fsmeta_attributesUpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\x95\xd0\xcf\x0a\x82\x40\x10\xc7\xf1\xbb\x4f\xf1\x7b\x80\x0e\xdd\x3d\xad\xba\x84\xe0\x1f\x08\x3b\xc7\x86\xa3\x2d\xec\xae\xe2\xce\x52\xf4\xf4\x69\x05\x91\x78\xe9\x7b\x9a\x39\x7c\x18\x98\x44\x1e\xf2\x2a\x8e\x22\x51\x34\xf2\x88\x46\x24\x85\x44\xe7\x2d\xb1\x3a\x77\xda\x90\x8f\x30\x27\xb2\x0c\x69\x5d\x9c\xca\x0a\x76\x68\x09\xef\xb4\x63\xea\x69\x42\x4b\x9d\x0a\x86\xb1\x87\x1b\x18\x2e\x18\xb3\x5b\x2b\xc5\xda\x7e\xd8\x32\x79\x56\x76\xc4\x4d\xf3\xf5\xb5\xe2\x31\x38\xda\x86\x41\xb7\x58\x9d\xfb\xb6\x29\xfa\xbf\x85\x62\x9e\xf4\x25\x30\x79\x30\xdd\x19\x3f\x2d\x62\x7e\x4f\x5a\x97\x65\xde\xc4\x4f\xd8\x49\xdd\x52\x2e\x01\x00\x00")
+
+func _002_fsmeta_attributesUpSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__002_fsmeta_attributesUpSql,
+		"002_fsmeta_attributes.up.sql",
+	)
+}
+
+func _002_fsmeta_attributesUpSql() (*asset, error) {
+	bytes, err := _002_fsmeta_attributesUpSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "002_fsmeta_attributes.up.sql", size: 302, mode: os.FileMode(420), modTime: time.Unix(1792322604, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _genGo = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\x2b\x48\x4c\xce\x4e\x4c\x4f\x55\x28\x2e\xcc\xe1\xe2\xd2\xd7\x4f\xcf\xb7\x4a\x4f\xcd\x4b\x2d\x4a\x2c\x49\x55\x48\xcf\xd7\x4d\xca\xcc\x4b\x49\x2c\x49\x54\xd0\x2d\xc8\x4e\x07\x29\x51\xd0\xe3\x02\x00\x94\x1c\xa4\x24\x31\x00\x00\x00")
 
 func genGoBytes() ([]byte, error) {
 	return bindataRead(
@@ -146,7 +167,7 @@ func genGo() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "gen.go", size: 49, mode: os.FileMode(420), modTime: time.Unix(1611257883, 0)}
+	info := bindataFileInfo{name: "gen.go", size: 49, mode: os.FileMode(436), modTime: time.Unix(1747926875, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
@@ -203,10 +224,11 @@ func AssetNames() []string {
 
 // _bindata is a table, holding each asset generator, mapped to its name.
 var _bindata = map[string]func() (*asset, error){
-	"001_initial_fsmeta.down.sql": _001_initial_fsmetaDownSql,
-	"001_initial_fsmeta.up.sql":   _001_initial_fsmetaUpSql,
-	"bindata.go":                  bindataGo,
-	"gen.go":                      genGo,
+	"001_initial_fsmeta.down.sql":    _001_initial_fsmetaDownSql,
+	"001_initial_fsmeta.up.sql":      _001_initial_fsmetaUpSql,
+	"002_fsmeta_attributes.down.sql": _002_fsmeta_attributesDownSql,
+	"002_fsmeta_attributes.up.sql":   _002_fsmeta_attributesUpSql,
+	"gen.go":                         genGo,
 }
 
 // AssetDir returns the file names below a certain
@@ -250,10 +272,11 @@ type bintree struct {
 }
 
 var _bintree = &bintree{nil, map[string]*bintree{
-	"001_initial_fsmeta.down.sql": &bintree{_001_initial_fsmetaDownSql, map[string]*bintree{}},
-	"001_initial_fsmeta.up.sql":   &bintree{_001_initial_fsmetaUpSql, map[string]*bintree{}},
-	"bindata.go":                  &bintree{bindataGo, map[string]*bintree{}},
-	"gen.go":                      &bintree{genGo, map[string]*bintree{}},
+	"001_initial_fsmeta.down.sql":    &bintree{_001_initial_fsmetaDownSql, map[string]*bintree{}},
+	"001_initial_fsmeta.up.sql":      &bintree{_001_initial_fsmetaUpSql, map[string]*bintree{}},
+	"002_fsmeta_attributes.down.sql": &bintree{_002_fsmeta_attributesDownSql, map[string]*bintree{}},
+	"002_fsmeta_attributes.up.sql":   &bintree{_002_fsmeta_attributesUpSql, map[string]*bintree{}},
+	"gen.go":                         &bintree{genGo, map[string]*bintree{}},
 }}
 
 // RestoreAsset restores an asset under the given directory
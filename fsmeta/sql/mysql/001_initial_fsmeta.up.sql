@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS fsmeta_folders
+(
+    id   bigint auto_increment not null
+        primary key,
+    path varchar(768) character set utf8mb4 collate utf8mb4_bin not null,
+    constraint fsmeta_folders_path_uindex unique (path)
+);
+
+CREATE TABLE IF NOT EXISTS fsmeta_files
+(
+    id            bigint auto_increment not null
+        primary key,
+    folder_id     bigint                not null,
+    filename      varchar(255) character set utf8mb4 collate utf8mb4_bin not null,
+    uploaded      datetime(6)           not null,
+    filesize      bigint default 0      not null,
+    etag          varchar(255) default '' not null,
+    last_modified datetime(6)           not null,
+    constraint fsmeta_files_folder_id_filename_uindex unique (folder_id, filename),
+    constraint fsmeta_files_fsmeta_folders_id_fk foreign key (folder_id) references fsmeta_folders (id)
+);
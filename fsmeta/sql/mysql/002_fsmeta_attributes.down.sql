@@ -0,0 +1,6 @@
+ALTER TABLE fsmeta_files
+    DROP COLUMN mode,
+    DROP COLUMN atime,
+    DROP COLUMN uid,
+    DROP COLUMN gid,
+    DROP COLUMN attributes;
@@ -0,0 +1,6 @@
+ALTER TABLE fsmeta_files
+    ADD COLUMN mode       integer default 0 not null,
+    ADD COLUMN atime      datetime(6)       null,
+    ADD COLUMN uid        integer           null,
+    ADD COLUMN gid        integer           null,
+    ADD COLUMN attributes text              null;
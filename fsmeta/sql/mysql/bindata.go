@@ -0,0 +1,327 @@
+// Code generated by go-bindata.
+// sources:
+// 001_initial_fsmeta.down.sql
+// 001_initial_fsmeta.up.sql
+// 002_fsmeta_attributes.down.sql
+// 002_fsmeta_attributes.up.sql
+// gen.go
+// DO NOT EDIT!
+
+package mysql
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func bindataRead(data []byte, name string) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewBuffer(data))
+	if err != nil {
+		return nil, fmt.Errorf("Read %q: %v", name, err)
+	}
+
+	var buf bytes.Buffer
+	_, err = io.Copy(&buf, gz)
+	clErr := gz.Close()
+
+	if err != nil {
+		return nil, fmt.Errorf("Read %q: %v", name, err)
+	}
+	if clErr != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+type asset struct {
+	bytes []byte
+	info  os.FileInfo
+}
+
+type bindataFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fi bindataFileInfo) Name() string {
+	return fi.name
+}
+func (fi bindataFileInfo) Size() int64 {
+	return fi.size
+}
+func (fi bindataFileInfo) Mode() os.FileMode {
+	return fi.mode
+}
+func (fi bindataFileInfo) ModTime() time.Time {
+	return fi.modTime
+}
+func (fi bindataFileInfo) IsDir() bool {
+	return false
+}
+func (fi bindataFileInfo) Sys() interface{} {
+	return nil
+}
+
+var __001_initial_fsmetaDownSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\x73\x09\xf2\x0f\x50\x08\x71\x74\xf2\x71\x55\xf0\x74\x53\x70\x8d\xf0\x0c\x0e\x09\x56\x48\x2b\xce\x4d\x2d\x49\x8c\x4f\xcb\xcc\x49\x2d\xb6\xe6\x72\xc1\xa7\x24\x3f\x27\x25\xb5\x08\xa8\x08\x00\x67\xf6\xa8\x69\x48\x00\x00\x00")
+
+func _001_initial_fsmetaDownSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__001_initial_fsmetaDownSql,
+		"001_initial_fsmeta.down.sql",
+	)
+}
+
+func _001_initial_fsmetaDownSql() (*asset, error) {
+	bytes, err := _001_initial_fsmetaDownSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "001_initial_fsmeta.down.sql", size: 72, mode: os.FileMode(420), modTime: time.Unix(1792321422, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var __001_initial_fsmetaUpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\x9d\x52\xdf\x6b\xc2\x30\x10\x7e\xef\x5f\x71\x6f\xb6\xe0\xc3\x18\xd3\x09\x7b\x72\xd2\x81\x30\x36\x98\x7d\xd8\x5b\x88\xcd\x55\x0f\xf3\xc3\xa5\xc9\x98\xfb\xeb\x97\xa8\xed\xd6\x22\x3a\x3c\x48\x68\x92\xbb\xaf\xdf\xf7\xdd\xcd\xde\xf2\x69\x91\x43\x31\x7d\x7c\xce\x61\xfe\x04\x2f\xaf\x05\xe4\xef\xf3\x45\xb1\x80\xaa\x56\xe8\x38\xab\x8c\x14\x68\xeb\x24\x4d\x20\x04\x89\xb0\x2d\x69\x45\xda\x01\xf7\xce\x30\xd2\xa5\x45\x85\xe1\xa8\x4d\x58\x5e\xca\x7d\x5e\x8c\xad\x25\xc5\xed\x0e\x36\xb8\x1b\xee\x2f\xb7\xdc\xad\xe1\x93\xdb\x72\xcd\x6d\x7a\x3f\x9e\x64\x10\xbf\x78\xe9\xd0\x42\x8d\x0e\xbc\xab\x26\x6a\x79\x07\xa5\x91\x92\x3b\x6c\xce\x6c\x49\xba\x45\x3f\x20\x95\x46\xd7\xce\xf2\xc8\xa2\x4b\x93\xc5\x7f\x30\x4f\x5a\xe0\x17\x78\x4d\x1f\x1e\x21\x8d\x77\x59\x92\x3d\x24\xc9\xec\xb2\x5c\x92\xd8\x11\xdb\xc6\xb5\xaa\x0f\xcc\xd8\x11\xec\x88\xd2\x8b\xae\xba\xc8\x41\x73\x85\x87\xb7\xc6\xb0\xdb\xd1\xe8\x7a\xc3\xfc\x56\x1a\x2e\xf0\x28\x48\x84\x64\x47\x0a\xd3\x71\x76\x96\x44\x4d\xdf\xd8\x11\x2f\xb0\xe2\x5e\x3a\xb8\x39\x55\x11\xec\x5b\xfd\xa2\x75\x68\x37\x75\x83\x41\xaf\x46\xf2\xda\x31\x65\x04\x55\x14\xc8\xfd\x87\xd7\x89\xd6\x47\xa6\xac\xb5\x99\x35\xf6\xf5\xc7\xa0\xcd\x18\xb6\x0e\x67\x17\x30\xbb\xb3\x15\xb1\x37\xa1\x9f\x16\x69\xa5\x63\x83\xff\x60\x66\x60\xb1\x42\x8b\xba\xc4\xba\x37\x93\x90\x86\xe7\x38\x7e\x3f\x7a\xf6\xd5\x60\x6d\x03\x00\x00")
+
+func _001_initial_fsmetaUpSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__001_initial_fsmetaUpSql,
+		"001_initial_fsmeta.up.sql",
+	)
+}
+
+func _001_initial_fsmetaUpSql() (*asset, error) {
+	bytes, err := _001_initial_fsmetaUpSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "001_initial_fsmeta.up.sql", size: 877, mode: os.FileMode(420), modTime: time.Unix(1792321422, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var __002_fsmeta_attributesDownSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\x73\xf4\x09\x71\x0d\x52\x08\x71\x74\xf2\x71\x55\x48\x2b\xce\x4d\x2d\x49\x8c\x4f\xcb\xcc\x49\x2d\xe6\x52\x00\x02\x97\x20\xff\x00\x05\x67\x7f\x9f\x50\x5f\x3f\x85\xdc\xfc\x94\x54\x1d\x0c\xd1\xc4\x92\xcc\x5c\x2c\xc2\xa5\x99\x29\x98\x82\xe9\xd8\x04\x13\x4b\x4a\x8a\x32\x93\x4a\x4b\x52\x8b\xad\xb9\x00\x73\x41\x1c\x18\x8c\x00\x00\x00")
+
+func _002_fsmeta_attributesDownSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__002_fsmeta_attributesDownSql,
+		"002_fsmeta_attributes.down.sql",
+	)
+}
+
+func _002_fsmeta_attributesDownSql() (*asset, error) {
+	bytes, err := _002_fsmeta_attributesDownSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "002_fsmeta_attributes.down.sql", size: 140, mode: os.FileMode(420), modTime: time.Unix(1792322604, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var __002_fsmeta_attributesUpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\x95\xcd\xb1\x0a\xc2\x30\x14\x85\xe1\xbd\x4f\x71\x46\x05\x07\x27\x17\xa7\x68\xbb\x45\x05\xa9\xb3\x44\x72\x53\x02\x49\x0a\xcd\x09\xf8\xf8\x5a\x2c\x88\xa5\x8b\xff\x76\x87\xef\x5c\xa5\xdb\xe6\x8a\x56\x1d\x74\x03\x97\xa3\xd0\xdc\x9d\x0f\x92\x2b\xbc\x53\x75\x8d\xe3\x45\xdf\x4e\x67\xc4\xde\x0a\x3e\xf9\x44\xe9\x64\x80\x15\x67\x4a\x20\xb6\x48\x3d\x91\x4a\x08\x9b\xb9\x32\xf4\x71\x62\xd6\x50\xc6\x6b\xb5\x5b\x4f\x3b\x8b\xa2\x78\x8b\xd9\x9f\x6f\x8b\xa2\xfb\x5b\x18\x72\xf0\x8f\x42\xc9\xa0\x3c\x89\x9f\x46\xb1\xaf\x5e\xdc\xbd\x78\xda\x17\x01\x00\x00")
+
+func _002_fsmeta_attributesUpSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__002_fsmeta_attributesUpSql,
+		"002_fsmeta_attributes.up.sql",
+	)
+}
+
+func _002_fsmeta_attributesUpSql() (*asset, error) {
+	bytes, err := _002_fsmeta_attributesUpSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "002_fsmeta_attributes.up.sql", size: 279, mode: os.FileMode(420), modTime: time.Unix(1792322604, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _genGo = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\x2b\x48\x4c\xce\x4e\x4c\x4f\x55\xc8\xad\x2c\x2e\xcc\xe1\xe2\xd2\xd7\x4f\xcf\xb7\x4a\x4f\xcd\x4b\x2d\x4a\x2c\x49\x55\x48\xcf\xd7\x4d\xca\xcc\x4b\x49\x2c\x49\x54\xd0\x2d\xc8\x4e\x87\x28\x52\xd0\xe3\x02\x00\xe1\xe0\x1d\x27\x35\x00\x00\x00")
+
+func genGoBytes() ([]byte, error) {
+	return bindataRead(
+		_genGo,
+		"gen.go",
+	)
+}
+
+func genGo() (*asset, error) {
+	bytes, err := genGoBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "gen.go", size: 53, mode: os.FileMode(420), modTime: time.Unix(1792321422, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+// Asset loads and returns the asset for the given name.
+// It returns an error if the asset could not be found or
+// could not be loaded.
+func Asset(name string) ([]byte, error) {
+	cannonicalName := strings.Replace(name, "\\", "/", -1)
+	if f, ok := _bindata[cannonicalName]; ok {
+		a, err := f()
+		if err != nil {
+			return nil, fmt.Errorf("Asset %s can't read by error: %v", name, err)
+		}
+		return a.bytes, nil
+	}
+	return nil, fmt.Errorf("Asset %s not found", name)
+}
+
+// MustAsset is like Asset but panics when Asset would return an error.
+// It simplifies safe initialization of global variables.
+func MustAsset(name string) []byte {
+	a, err := Asset(name)
+	if err != nil {
+		panic("asset: Asset(" + name + "): " + err.Error())
+	}
+
+	return a
+}
+
+// AssetInfo loads and returns the asset info for the given name.
+// It returns an error if the asset could not be found or
+// could not be loaded.
+func AssetInfo(name string) (os.FileInfo, error) {
+	cannonicalName := strings.Replace(name, "\\", "/", -1)
+	if f, ok := _bindata[cannonicalName]; ok {
+		a, err := f()
+		if err != nil {
+			return nil, fmt.Errorf("AssetInfo %s can't read by error: %v", name, err)
+		}
+		return a.info, nil
+	}
+	return nil, fmt.Errorf("AssetInfo %s not found", name)
+}
+
+// AssetNames returns the names of the assets.
+func AssetNames() []string {
+	names := make([]string, 0, len(_bindata))
+	for name := range _bindata {
+		names = append(names, name)
+	}
+	return names
+}
+
+// _bindata is a table, holding each asset generator, mapped to its name.
+var _bindata = map[string]func() (*asset, error){
+	"001_initial_fsmeta.down.sql":    _001_initial_fsmetaDownSql,
+	"001_initial_fsmeta.up.sql":      _001_initial_fsmetaUpSql,
+	"002_fsmeta_attributes.down.sql": _002_fsmeta_attributesDownSql,
+	"002_fsmeta_attributes.up.sql":   _002_fsmeta_attributesUpSql,
+	"gen.go":                         genGo,
+}
+
+// AssetDir returns the file names below a certain
+// directory embedded in the file by go-bindata.
+// For example if you run go-bindata on data/... and data contains the
+// following hierarchy:
+//     data/
+//       foo.txt
+//       img/
+//         a.png
+//         b.png
+// then AssetDir("data") would return []string{"foo.txt", "img"}
+// AssetDir("data/img") would return []string{"a.png", "b.png"}
+// AssetDir("foo.txt") and AssetDir("notexist") would return an error
+// AssetDir("") will return []string{"data"}.
+func AssetDir(name string) ([]string, error) {
+	node := _bintree
+	if len(name) != 0 {
+		cannonicalName := strings.Replace(name, "\\", "/", -1)
+		pathList := strings.Split(cannonicalName, "/")
+		for _, p := range pathList {
+			node = node.Children[p]
+			if node == nil {
+				return nil, fmt.Errorf("Asset %s not found", name)
+			}
+		}
+	}
+	if node.Func != nil {
+		return nil, fmt.Errorf("Asset %s not found", name)
+	}
+	rv := make([]string, 0, len(node.Children))
+	for childName := range node.Children {
+		rv = append(rv, childName)
+	}
+	return rv, nil
+}
+
+type bintree struct {
+	Func     func() (*asset, error)
+	Children map[string]*bintree
+}
+
+var _bintree = &bintree{nil, map[string]*bintree{
+	"001_initial_fsmeta.down.sql":    &bintree{_001_initial_fsmetaDownSql, map[string]*bintree{}},
+	"001_initial_fsmeta.up.sql":      &bintree{_001_initial_fsmetaUpSql, map[string]*bintree{}},
+	"002_fsmeta_attributes.down.sql": &bintree{_002_fsmeta_attributesDownSql, map[string]*bintree{}},
+	"002_fsmeta_attributes.up.sql":   &bintree{_002_fsmeta_attributesUpSql, map[string]*bintree{}},
+	"gen.go":                         &bintree{genGo, map[string]*bintree{}},
+}}
+
+// RestoreAsset restores an asset under the given directory
+func RestoreAsset(dir, name string) error {
+	data, err := Asset(name)
+	if err != nil {
+		return err
+	}
+	info, err := AssetInfo(name)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(_filePath(dir, filepath.Dir(name)), os.FileMode(0755))
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(_filePath(dir, name), data, info.Mode())
+	if err != nil {
+		return err
+	}
+	err = os.Chtimes(_filePath(dir, name), info.ModTime(), info.ModTime())
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// RestoreAssets restores an asset under the given directory recursively
+func RestoreAssets(dir, name string) error {
+	children, err := AssetDir(name)
+	// File
+	if err != nil {
+		return RestoreAsset(dir, name)
+	}
+	// Dir
+	for _, child := range children {
+		err = RestoreAssets(dir, filepath.Join(name, child))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func _filePath(dir, name string) string {
+	cannonicalName := strings.Replace(name, "\\", "/", -1)
+	return filepath.Join(append([]string{dir}, strings.Split(cannonicalName, "/")...)...)
+}
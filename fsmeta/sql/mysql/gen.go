@@ -0,0 +1,3 @@
+package mysql
+
+//go:generate go-bindata -pkg mysql .
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS fsmeta_files;
+DROP TABLE IF EXISTS fsmeta_folders;
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS fsmeta_folders
+(
+    id   integer not null
+        constraint fsmeta_folders_pk primary key autoincrement,
+    path text    not null
+);
+
+CREATE UNIQUE INDEX fsmeta_folders_path_uindex
+    ON fsmeta_folders (path);
+
+CREATE TABLE IF NOT EXISTS fsmeta_files
+(
+    id            integer           not null
+        constraint fsmeta_files_pk primary key autoincrement,
+    folder_id     integer           not null
+        constraint fsmeta_files_fsmeta_folders_id_fk references fsmeta_folders (id),
+    filename      text              not null,
+    uploaded      timestamp         not null,
+    filesize      bigint  default 0 not null,
+    etag          text    default '' not null,
+    last_modified timestamp         not null
+);
+
+CREATE UNIQUE INDEX fsmeta_files_folder_id_filename_uindex
+    ON fsmeta_files (folder_id, filename);
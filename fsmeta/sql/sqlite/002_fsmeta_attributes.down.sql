@@ -0,0 +1,24 @@
+-- DROP COLUMN requires SQLite 3.35, the table is rebuilt instead
+CREATE TABLE fsmeta_files_backup
+(
+    id            integer           not null
+        constraint fsmeta_files_pk primary key autoincrement,
+    folder_id     integer           not null
+        constraint fsmeta_files_fsmeta_folders_id_fk references fsmeta_folders (id),
+    filename      text              not null,
+    uploaded      timestamp         not null,
+    filesize      bigint  default 0 not null,
+    etag          text    default '' not null,
+    last_modified timestamp         not null
+);
+
+INSERT INTO fsmeta_files_backup (id, folder_id, filename, uploaded, filesize, etag, last_modified)
+SELECT id, folder_id, filename, uploaded, filesize, etag, last_modified
+FROM fsmeta_files;
+
+DROP TABLE fsmeta_files;
+
+ALTER TABLE fsmeta_files_backup RENAME TO fsmeta_files;
+
+CREATE UNIQUE INDEX fsmeta_files_folder_id_filename_uindex
+    ON fsmeta_files (folder_id, filename);
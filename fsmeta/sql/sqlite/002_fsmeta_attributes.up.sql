@@ -0,0 +1,5 @@
+ALTER TABLE fsmeta_files ADD COLUMN mode integer default 0 not null;
+ALTER TABLE fsmeta_files ADD COLUMN atime timestamp null;
+ALTER TABLE fsmeta_files ADD COLUMN uid integer null;
+ALTER TABLE fsmeta_files ADD COLUMN gid integer null;
+ALTER TABLE fsmeta_files ADD COLUMN attributes text null;
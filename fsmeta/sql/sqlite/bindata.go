@@ -0,0 +1,327 @@
+// Code generated by go-bindata.
+// sources:
+// 001_initial_fsmeta.down.sql
+// 001_initial_fsmeta.up.sql
+// 002_fsmeta_attributes.down.sql
+// 002_fsmeta_attributes.up.sql
+// gen.go
+// DO NOT EDIT!
+
+package sqlite
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func bindataRead(data []byte, name string) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewBuffer(data))
+	if err != nil {
+		return nil, fmt.Errorf("Read %q: %v", name, err)
+	}
+
+	var buf bytes.Buffer
+	_, err = io.Copy(&buf, gz)
+	clErr := gz.Close()
+
+	if err != nil {
+		return nil, fmt.Errorf("Read %q: %v", name, err)
+	}
+	if clErr != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+type asset struct {
+	bytes []byte
+	info  os.FileInfo
+}
+
+type bindataFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fi bindataFileInfo) Name() string {
+	return fi.name
+}
+func (fi bindataFileInfo) Size() int64 {
+	return fi.size
+}
+func (fi bindataFileInfo) Mode() os.FileMode {
+	return fi.mode
+}
+func (fi bindataFileInfo) ModTime() time.Time {
+	return fi.modTime
+}
+func (fi bindataFileInfo) IsDir() bool {
+	return false
+}
+func (fi bindataFileInfo) Sys() interface{} {
+	return nil
+}
+
+var __001_initial_fsmetaDownSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\x73\x09\xf2\x0f\x50\x08\x71\x74\xf2\x71\x55\xf0\x74\x53\x70\x8d\xf0\x0c\x0e\x09\x56\x48\x2b\xce\x4d\x2d\x49\x8c\x4f\xcb\xcc\x49\x2d\xb6\xe6\x72\xc1\xa7\x24\x3f\x27\x25\xb5\x08\xa8\x08\x00\x67\xf6\xa8\x69\x48\x00\x00\x00")
+
+func _001_initial_fsmetaDownSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__001_initial_fsmetaDownSql,
+		"001_initial_fsmeta.down.sql",
+	)
+}
+
+func _001_initial_fsmetaDownSql() (*asset, error) {
+	bytes, err := _001_initial_fsmetaDownSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "001_initial_fsmeta.down.sql", size: 72, mode: os.FileMode(420), modTime: time.Unix(1792321422, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var __001_initial_fsmetaUpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\xa5\x92\xcd\x6a\xc3\x30\x10\x84\xef\x7e\x8a\xbd\x25\x81\x1c\x7a\xef\x29\x4d\x5d\x30\x14\x87\x36\x0e\xe4\x26\xd4\x68\x95\x8a\x48\xb2\x91\xd7\x90\xf4\xe9\x2b\xf9\x2f\xad\x8d\xdb\x40\xf6\x60\x30\x9a\x9d\xfd\x76\xa4\xf5\x7b\xbc\xca\x62\xc8\x56\x4f\xaf\x31\x24\x2f\x90\x6e\x32\x88\xf7\xc9\x36\xdb\x82\x2c\x0d\x12\x67\x32\xd7\x02\x5d\x19\xcd\x23\xf0\xa5\x44\xf8\x58\xc2\x23\x3a\xb0\x39\x81\xad\xb4\xae\x4f\x42\x1d\x72\x5b\x92\xe3\xfe\x7c\xd0\xcd\x8a\x13\x14\x4e\x19\xee\x2e\x70\xc2\x0b\xf0\x8a\x72\x65\x0f\x0e\x0d\x5a\x5a\xd6\xfd\x05\xa7\x4f\x20\x3c\x53\xf8\xe9\x9d\x17\x8f\x51\xb4\x6e\x18\x77\x69\xf2\xb6\xf3\x90\xe9\x73\xbc\x1f\xd9\xfb\x66\x56\x29\x2b\xf0\x5c\x9b\x6d\xd2\x81\x02\xe6\x41\xf2\xc3\xed\xaf\x8d\x95\xc6\x5f\xfb\xf6\xd5\x2d\x7e\xad\x5b\x22\x08\x76\x37\x04\xd0\x90\xb2\x76\xe2\x1d\xa3\x06\xd9\x28\xc1\xe4\x09\x1c\x4a\x74\x68\x0f\x58\x8e\x92\x51\x62\xd1\x12\xf8\x76\xcb\x0d\x36\xf6\xdd\x5d\x8c\x09\x1a\x75\x55\xe8\x9c\x0b\x6c\x03\x22\x65\xb0\x24\x6e\x8a\x09\x75\x8d\xa6\xbe\x5a\xef\x0f\x75\x0c\xd8\x20\x50\xf2\x4a\x13\x3c\x0c\xd4\x9e\xef\x78\x9d\xdb\x91\x74\xea\xd9\x6c\x20\xd7\xbc\x24\x66\x72\xa1\xa4\xf2\x3c\xd3\x28\xff\x3e\xa7\x26\xbf\xee\x22\x58\x17\xc8\xc4\xd3\x0a\x6a\x98\xf7\xf2\x65\x1f\xa0\x1f\xf3\x0d\x9b\xd7\x42\x67\x59\x03\x00\x00")
+
+func _001_initial_fsmetaUpSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__001_initial_fsmetaUpSql,
+		"001_initial_fsmeta.up.sql",
+	)
+}
+
+func _001_initial_fsmetaUpSql() (*asset, error) {
+	bytes, err := _001_initial_fsmetaUpSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "001_initial_fsmeta.up.sql", size: 857, mode: os.FileMode(420), modTime: time.Unix(1792321422, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var __002_fsmeta_attributesDownSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\xa5\x53\xc1\x6e\x82\x40\x10\xbd\xef\x57\xcc\x4d\x4d\x68\xd3\xc4\xf4\xd4\x13\xd5\x6d\x62\x82\x50\x11\x93\xde\xc8\x22\x83\x9d\x00\x0b\x5d\x96\x44\xfb\xf5\x5d\x11\x54\xa8\x9e\x9c\x1b\xbb\x6f\xde\xbc\xf7\x76\x78\x7a\x82\xb9\xef\x7d\xc2\xcc\x73\x36\x4b\x17\x14\xfe\xd4\xa4\xb0\x82\xf5\xca\x21\x8d\x30\x7d\x9e\xbe\x5a\xa0\xbf\x11\xb4\x88\x32\x04\xaa\x0c\x24\xaa\x29\xd3\x40\xb2\xd2\x28\x62\x36\xf3\xb9\x1d\x70\x08\xec\x77\x87\x43\x52\xe5\xa8\x45\x98\x50\x86\x55\x18\x89\x6d\x5a\x97\x6c\xcc\xc0\x14\xc5\x70\x55\x24\x35\xee\x50\x5d\x9d\xc8\x42\x83\xac\xb3\x8c\x75\x07\xdb\xc2\x0c\x50\xc2\x20\xfb\xac\x65\x0a\xa5\xa2\x5c\xa8\x03\xa4\x78\x00\x51\xeb\x82\xe4\x56\x61\x8e\x52\x5b\x4d\x77\x52\x64\x31\xaa\xb0\x9d\xf8\xc0\xa8\xee\xa3\xe1\xab\x0c\x61\x98\xa4\xc6\x7f\x82\x0a\xe5\xd6\x84\xd4\xbf\x87\x31\xc5\x93\x56\x81\x69\x97\x22\xc7\x13\xbd\xc6\xbd\x86\x5e\x75\x0a\x4e\xe8\xba\xcc\x0a\x11\x63\x1b\x90\xa6\x1c\x2b\x2d\xf2\xf2\x0e\xba\x91\x46\xbf\x2d\x77\x44\xbb\xa3\x6c\x88\x31\x11\xb5\x79\x95\x97\x01\xda\xe8\xdb\x5d\xe6\x76\x4a\x3a\xf4\x68\x34\x80\x67\xa2\xd2\x61\x5e\xc4\x94\x90\xd1\x73\x5f\x0a\x9b\xbc\x31\xb6\x70\xd7\xdc\x0f\x60\xe1\x06\xde\xad\x87\x3f\xe6\x61\x5d\x1e\xc3\x3a\xa7\x62\x9d\x1d\x5b\x67\x37\x56\xa3\xd4\xea\x0b\x98\xb0\x35\x77\xf8\x2c\x80\x47\x89\xd8\x87\xef\x2d\x7b\x1a\x8d\xfc\x66\xef\xff\xaf\xad\xb9\xb1\x9d\x80\xfb\xf7\x37\x1a\x7c\xee\xda\x4b\xb3\xf2\xde\xb0\xb1\xfd\x17\x36\xee\x62\xb5\xe1\x26\x98\x39\xff\x1a\x6c\x54\x67\x22\xec\x3c\x84\x35\xc9\x18\xf7\x4d\xfa\x9e\xdb\x43\xc3\xf8\x86\x67\x13\xfc\x1f\xd9\x7c\xf1\x37\xb4\x03\x00\x00")
+
+func _002_fsmeta_attributesDownSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__002_fsmeta_attributesDownSql,
+		"002_fsmeta_attributes.down.sql",
+	)
+}
+
+func _002_fsmeta_attributesDownSql() (*asset, error) {
+	bytes, err := _002_fsmeta_attributesDownSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "002_fsmeta_attributes.down.sql", size: 948, mode: os.FileMode(420), modTime: time.Unix(1792322604, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var __002_fsmeta_attributesUpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\x9d\x8f\x31\x0e\xc2\x30\x14\x43\x77\x4e\xe1\x23\xb0\x33\x05\xda\x2d\x80\x84\xda\x19\x7d\x94\x9f\xea\x4b\x49\x8a\x1a\x47\xe2\xf8\xc0\x00\x73\x61\xf1\x60\xe9\x3d\xcb\xce\x0f\xfd\x05\x83\xdb\xfb\x1e\xb1\x66\xa5\x5c\xa3\x25\xad\x70\x5d\x87\xc3\xd9\x8f\xc7\x13\xf2\x1c\x14\x56\xa8\x93\x2e\x08\x1a\xa5\x25\x62\x8b\x32\x13\xa5\xa5\xb4\xdb\xb8\x15\x12\xa1\x65\xc5\x3b\x2a\x25\xdf\x7f\x20\x9b\x85\xef\xfa\x7a\x6a\xfa\x8b\x12\x72\xb1\x5b\xe3\xab\xa5\x3e\x3e\xff\x9e\xbc\x20\x1f\xa6\x25\x01\x00\x00")
+
+func _002_fsmeta_attributesUpSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__002_fsmeta_attributesUpSql,
+		"002_fsmeta_attributes.up.sql",
+	)
+}
+
+func _002_fsmeta_attributesUpSql() (*asset, error) {
+	bytes, err := _002_fsmeta_attributesUpSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "002_fsmeta_attributes.up.sql", size: 293, mode: os.FileMode(420), modTime: time.Unix(1792322604, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _genGo = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\x2b\x48\x4c\xce\x4e\x4c\x4f\x55\x28\x2e\xcc\xc9\x2c\x49\xe5\xe2\xd2\xd7\x4f\xcf\xb7\x4a\x4f\xcd\x4b\x2d\x4a\x2c\x49\x55\x48\xcf\xd7\x4d\xca\xcc\x4b\x49\x2c\x49\x54\xd0\x2d\xc8\x4e\x87\xaa\x52\xd0\xe3\x02\x00\x29\x9f\x92\xed\x37\x00\x00\x00")
+
+func genGoBytes() ([]byte, error) {
+	return bindataRead(
+		_genGo,
+		"gen.go",
+	)
+}
+
+func genGo() (*asset, error) {
+	bytes, err := genGoBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "gen.go", size: 55, mode: os.FileMode(420), modTime: time.Unix(1792321422, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+// Asset loads and returns the asset for the given name.
+// It returns an error if the asset could not be found or
+// could not be loaded.
+func Asset(name string) ([]byte, error) {
+	cannonicalName := strings.Replace(name, "\\", "/", -1)
+	if f, ok := _bindata[cannonicalName]; ok {
+		a, err := f()
+		if err != nil {
+			return nil, fmt.Errorf("Asset %s can't read by error: %v", name, err)
+		}
+		return a.bytes, nil
+	}
+	return nil, fmt.Errorf("Asset %s not found", name)
+}
+
+// MustAsset is like Asset but panics when Asset would return an error.
+// It simplifies safe initialization of global variables.
+func MustAsset(name string) []byte {
+	a, err := Asset(name)
+	if err != nil {
+		panic("asset: Asset(" + name + "): " + err.Error())
+	}
+
+	return a
+}
+
+// AssetInfo loads and returns the asset info for the given name.
+// It returns an error if the asset could not be found or
+// could not be loaded.
+func AssetInfo(name string) (os.FileInfo, error) {
+	cannonicalName := strings.Replace(name, "\\", "/", -1)
+	if f, ok := _bindata[cannonicalName]; ok {
+		a, err := f()
+		if err != nil {
+			return nil, fmt.Errorf("AssetInfo %s can't read by error: %v", name, err)
+		}
+		return a.info, nil
+	}
+	return nil, fmt.Errorf("AssetInfo %s not found", name)
+}
+
+// AssetNames returns the names of the assets.
+func AssetNames() []string {
+	names := make([]string, 0, len(_bindata))
+	for name := range _bindata {
+		names = append(names, name)
+	}
+	return names
+}
+
+// _bindata is a table, holding each asset generator, mapped to its name.
+var _bindata = map[string]func() (*asset, error){
+	"001_initial_fsmeta.down.sql":    _001_initial_fsmetaDownSql,
+	"001_initial_fsmeta.up.sql":      _001_initial_fsmetaUpSql,
+	"002_fsmeta_attributes.down.sql": _002_fsmeta_attributesDownSql,
+	"002_fsmeta_attributes.up.sql":   _002_fsmeta_attributesUpSql,
+	"gen.go":                         genGo,
+}
+
+// AssetDir returns the file names below a certain
+// directory embedded in the file by go-bindata.
+// For example if you run go-bindata on data/... and data contains the
+// following hierarchy:
+//     data/
+//       foo.txt
+//       img/
+//         a.png
+//         b.png
+// then AssetDir("data") would return []string{"foo.txt", "img"}
+// AssetDir("data/img") would return []string{"a.png", "b.png"}
+// AssetDir("foo.txt") and AssetDir("notexist") would return an error
+// AssetDir("") will return []string{"data"}.
+func AssetDir(name string) ([]string, error) {
+	node := _bintree
+	if len(name) != 0 {
+		cannonicalName := strings.Replace(name, "\\", "/", -1)
+		pathList := strings.Split(cannonicalName, "/")
+		for _, p := range pathList {
+			node = node.Children[p]
+			if node == nil {
+				return nil, fmt.Errorf("Asset %s not found", name)
+			}
+		}
+	}
+	if node.Func != nil {
+		return nil, fmt.Errorf("Asset %s not found", name)
+	}
+	rv := make([]string, 0, len(node.Children))
+	for childName := range node.Children {
+		rv = append(rv, childName)
+	}
+	return rv, nil
+}
+
+type bintree struct {
+	Func     func() (*asset, error)
+	Children map[string]*bintree
+}
+
+var _bintree = &bintree{nil, map[string]*bintree{
+	"001_initial_fsmeta.down.sql":    &bintree{_001_initial_fsmetaDownSql, map[string]*bintree{}},
+	"001_initial_fsmeta.up.sql":      &bintree{_001_initial_fsmetaUpSql, map[string]*bintree{}},
+	"002_fsmeta_attributes.down.sql": &bintree{_002_fsmeta_attributesDownSql, map[string]*bintree{}},
+	"002_fsmeta_attributes.up.sql":   &bintree{_002_fsmeta_attributesUpSql, map[string]*bintree{}},
+	"gen.go":                         &bintree{genGo, map[string]*bintree{}},
+}}
+
+// RestoreAsset restores an asset under the given directory
+func RestoreAsset(dir, name string) error {
+	data, err := Asset(name)
+	if err != nil {
+		return err
+	}
+	info, err := AssetInfo(name)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(_filePath(dir, filepath.Dir(name)), os.FileMode(0755))
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(_filePath(dir, name), data, info.Mode())
+	if err != nil {
+		return err
+	}
+	err = os.Chtimes(_filePath(dir, name), info.ModTime(), info.ModTime())
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// RestoreAssets restores an asset under the given directory recursively
+func RestoreAssets(dir, name string) error {
+	children, err := AssetDir(name)
+	// File
+	if err != nil {
+		return RestoreAsset(dir, name)
+	}
+	// Dir
+	for _, child := range children {
+		err = RestoreAssets(dir, filepath.Join(name, child))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func _filePath(dir, name string) string {
+	cannonicalName := strings.Replace(name, "\\", "/", -1)
+	return filepath.Join(append([]string{dir}, strings.Split(cannonicalName, "/")...)...)
+}
@@ -0,0 +1,516 @@
+package fsmeta
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// sqlMaxBatchRows is the maximum number of rows upserted by a single statement,
+// it keeps the number of arguments below the limits of all the supported drivers
+const sqlMaxBatchRows = 500
+
+type fsMetaSQL struct {
+	DB            *sql.DB
+	Queries       *sqlQueries
+	Store         Getter
+	loaded        Getter
+	Location      string
+	folderIDCache map[string]uint64
+}
+
+type sqlFactory struct {
+	DB      *sql.DB
+	Queries *sqlQueries
+}
+
+func (p sqlFactory) New(Store Store) Provider {
+	return &fsMetaSQL{
+		DB:            p.DB,
+		Queries:       p.Queries,
+		Store:         Store,
+		loaded:        emptyCache,
+		Location:      Store.Location(),
+		folderIDCache: make(map[string]uint64),
+	}
+}
+
+func (Provider *fsMetaSQL) Preload(ctx context.Context, Folder string) error {
+	FolderPath := Provider.formatPath(Folder)
+	if Files, ok := folderCache.getFiles(FolderPath); ok {
+		Provider.loaded = Files
+		return nil
+	}
+	Version := folderCache.getVersion()
+	Files, err := Provider.loadFolder(ctx, Folder)
+	if err != nil {
+		Provider.loaded = emptyCache
+		return err
+	}
+	Provider.loaded = Files
+	folderCache.setFiles(FolderPath, Files, Version)
+	return nil
+}
+
+// loadFolder reads the files stored inside Folder, the sub folders and the cache are not considered
+func (Provider *fsMetaSQL) loadFolder(ctx context.Context, Folder string) (fileMap, error) {
+	FolderID, err := Provider.getFolderID(ctx, Folder)
+	if err != nil && err == sql.ErrNoRows {
+		return make(fileMap), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	Rows, err := Provider.DB.QueryContext(ctx, Provider.Queries.SelectFolderFiles, FolderID)
+	if err != nil {
+		return nil, err
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer Rows.Close()
+
+	fileMap := make(fileMap)
+
+	for Rows.Next() {
+		var Filename string
+		var Meta Meta
+
+		var Attributes sqlAttributes
+
+		if err := Rows.Scan(append([]interface{}{&Filename, &Meta.Key.Size, &Meta.Key.StoreTime, &Meta.Key.ETag,
+			&Meta.LastModified}, Attributes.dest()...)...); err != nil {
+			return nil, err
+		}
+		if err := Attributes.apply(&Meta); err != nil {
+			return nil, err
+		}
+		Meta.Key.Path = path.Clean(Folder + `/` + Filename)
+		fileMap[Meta.Key.Path] = Meta
+	}
+	return fileMap, Rows.Err()
+}
+
+func (Provider *fsMetaSQL) Put(ctx context.Context, Meta Meta) error {
+	Folder, Filename, ok := splitPath(Meta.Key.Path)
+	if !ok {
+		return nil
+	}
+	FolderID, err := Provider.getOrCreateFolder(ctx, Folder)
+	if err != nil {
+		return err
+	}
+
+	Meta.Key.ETag = strings.Trim(Meta.Key.ETag, `"`)
+	Attributes, err := newSQLAttributesArgs(Meta)
+	if err != nil {
+		return err
+	}
+	if _, err := Provider.DB.ExecContext(ctx, Provider.Queries.UpsertFile, append([]interface{}{FolderID, Filename,
+		Meta.Key.StoreTime, Meta.Key.Size, Meta.Key.ETag, Meta.LastModified}, Attributes...)...); err != nil {
+		return err
+	}
+	folderCache.invalidateFiles(Provider.formatPath(Folder))
+
+	return nil
+}
+
+// PutBatch upserts the files grouped by folder, sqlMaxBatchRows at a time
+func (Provider *fsMetaSQL) PutBatch(ctx context.Context, Metas []Meta) error {
+	var Folders []string
+	Files := make(map[string]map[string]Meta)
+	for _, M := range Metas {
+		Folder, Filename, ok := splitPath(M.Key.Path)
+		if !ok {
+			continue
+		}
+		if _, ok := Files[Folder]; !ok {
+			Folders = append(Folders, Folder)
+			Files[Folder] = make(map[string]Meta)
+		}
+		Files[Folder][Filename] = M
+	}
+
+	var Args []interface{}
+	Rows := 0
+	flush := func() error {
+		if Rows == 0 {
+			return nil
+		}
+		_, err := Provider.DB.ExecContext(ctx, Provider.Queries.upsertFiles(Rows), Args...)
+		Args = Args[:0]
+		Rows = 0
+		return err
+	}
+	for _, Folder := range Folders {
+		FolderID, err := Provider.getOrCreateFolder(ctx, Folder)
+		if err != nil {
+			return err
+		}
+		for Filename, M := range Files[Folder] {
+			M.Key.ETag = strings.Trim(M.Key.ETag, `"`)
+			Attributes, err := newSQLAttributesArgs(M)
+			if err != nil {
+				return err
+			}
+			Args = append(Args, FolderID, Filename, M.Key.StoreTime, M.Key.Size, M.Key.ETag, M.LastModified)
+			Args = append(Args, Attributes...)
+			Rows++
+			if Rows == sqlMaxBatchRows {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+		folderCache.invalidateFiles(Provider.formatPath(Folder))
+	}
+	return flush()
+}
+
+func (Provider *fsMetaSQL) Rename(ctx context.Context, Source string, Target Key) error {
+	if strings.HasSuffix(Source, `/`) {
+		return Provider.renameFolder(ctx, Source, Target.Path)
+	}
+	SourceFolder, SourceFilename, ok := splitPath(Source)
+	if !ok {
+		return nil
+	}
+	TargetFolder, TargetFilename, ok := splitPath(Target.Path)
+	if !ok {
+		return Provider.Delete(ctx, Source)
+	}
+	SourceFolderID, err := Provider.getFolderID(ctx, SourceFolder)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	TargetFolderID, err := Provider.getOrCreateFolder(ctx, TargetFolder)
+	if err != nil {
+		return err
+	}
+
+	Tx, err := Provider.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer Tx.Rollback() //nolint:errcheck
+
+	if _, err := Tx.ExecContext(ctx, Provider.Queries.DeleteFile, TargetFolderID, TargetFilename); err != nil {
+		return err
+	}
+	if Target.StoreTime.IsZero() {
+		_, err = Tx.ExecContext(ctx, Provider.Queries.MoveFile,
+			TargetFolderID, TargetFilename, SourceFolderID, SourceFilename)
+	} else {
+		_, err = Tx.ExecContext(ctx, Provider.Queries.MoveAndUpdateFile,
+			TargetFolderID, TargetFilename, Target.StoreTime, Target.Size, strings.Trim(Target.ETag, `"`),
+			SourceFolderID, SourceFilename)
+	}
+	if err != nil {
+		return err
+	}
+	if err := Tx.Commit(); err != nil {
+		return err
+	}
+	folderCache.invalidateFiles(Provider.formatPath(SourceFolder), Provider.formatPath(TargetFolder))
+	return nil
+}
+
+func (Provider *fsMetaSQL) renameFolder(ctx context.Context, Source, Target string) error {
+	if !strings.HasSuffix(Target, `/`) {
+		Target += `/`
+	}
+	if Source == Target {
+		return nil
+	}
+	SourcePath := Provider.formatPath(Source)
+	TargetPath := Provider.formatPath(Target)
+
+	Tx, err := Provider.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer Tx.Rollback() //nolint:errcheck
+
+	Rows, err := Tx.QueryContext(ctx, Provider.Queries.SelectFoldersByPrefix, SourcePath, SourcePath)
+	if err != nil {
+		return err
+	}
+	Folders := make(map[uint64]string)
+	for Rows.Next() {
+		var FolderID uint64
+		var FolderPath string
+		if err := Rows.Scan(&FolderID, &FolderPath); err != nil {
+			Rows.Close()
+			return err
+		}
+		Folders[FolderID] = TargetPath + strings.TrimPrefix(FolderPath, SourcePath)
+	}
+	Rows.Close()
+	if err := Rows.Err(); err != nil {
+		return err
+	}
+
+	for FolderID, NewPath := range Folders {
+		var ExistingID uint64
+		err := Tx.QueryRowContext(ctx, Provider.Queries.GetFolderID, NewPath).Scan(&ExistingID)
+		if err == sql.ErrNoRows {
+			if _, err := Tx.ExecContext(ctx, Provider.Queries.UpdateFolderPath, NewPath, FolderID); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+		// the target folder already exists, merge the files into it, renamed files win
+		if _, err := Tx.ExecContext(ctx, Provider.Queries.DeleteMergedFiles, ExistingID, FolderID); err != nil {
+			return err
+		}
+		if _, err := Tx.ExecContext(ctx, Provider.Queries.MergeFolderFiles, ExistingID, FolderID); err != nil {
+			return err
+		}
+		if _, err := Tx.ExecContext(ctx, Provider.Queries.DeleteFolderByID, FolderID); err != nil {
+			return err
+		}
+	}
+	if err := Tx.Commit(); err != nil {
+		return err
+	}
+	Provider.invalidateFolders(Source)
+	// folders merged into existing ones change their content
+	folderCache.invalidatePrefix(TargetPath)
+	return nil
+}
+
+func (Provider *fsMetaSQL) Delete(ctx context.Context, Path string) error {
+	if strings.HasSuffix(Path, `/`) {
+		return Provider.deleteFolder(ctx, Path)
+	}
+	Folder, Filename, ok := splitPath(Path)
+	if !ok {
+		return nil
+	}
+	FolderID, err := Provider.getFolderID(ctx, Folder)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if _, err := Provider.DB.ExecContext(ctx, Provider.Queries.DeleteFile, FolderID, Filename); err != nil {
+		return err
+	}
+	folderCache.invalidateFiles(Provider.formatPath(Folder))
+	return nil
+}
+
+func (Provider *fsMetaSQL) deleteFolder(ctx context.Context, Folder string) error {
+	FolderPath := Provider.formatPath(Folder)
+
+	Tx, err := Provider.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer Tx.Rollback() //nolint:errcheck
+
+	if _, err := Tx.ExecContext(ctx, Provider.Queries.DeleteFilesByPrefix, FolderPath, FolderPath); err != nil {
+		return err
+	}
+	if _, err := Tx.ExecContext(ctx, Provider.Queries.DeleteFoldersByPrefix, FolderPath, FolderPath); err != nil {
+		return err
+	}
+	if err := Tx.Commit(); err != nil {
+		return err
+	}
+	Provider.invalidateFolders(Folder)
+	return nil
+}
+
+func (Provider *fsMetaSQL) Scan(ctx context.Context, Prefix string, fn func(Meta) error) error {
+	// folders are matched by the directory part of the prefix, files are then filtered by the full prefix
+	FolderPrefix := Prefix[0 : strings.LastIndex(Prefix, `/`)+1]
+	Location := Provider.formatPath(``)
+	FolderPrefixPath := Provider.formatPath(FolderPrefix)
+	Rows, err := Provider.DB.QueryContext(ctx, Provider.Queries.ScanByPrefix, FolderPrefixPath, FolderPrefixPath)
+	if err != nil {
+		return err
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer Rows.Close()
+
+	for Rows.Next() {
+		var Folder, Filename string
+		var Meta Meta
+
+		var Attributes sqlAttributes
+
+		if err := Rows.Scan(append([]interface{}{&Folder, &Filename, &Meta.Key.Size, &Meta.Key.StoreTime, &Meta.Key.ETag,
+			&Meta.LastModified}, Attributes.dest()...)...); err != nil {
+			return err
+		}
+		if err := Attributes.apply(&Meta); err != nil {
+			return err
+		}
+		Meta.Key.Path = strings.TrimPrefix(Folder, Location) + Filename
+		if !strings.HasPrefix(Meta.Key.Path, Prefix) {
+			continue
+		}
+		if err := fn(Meta); err != nil {
+			return err
+		}
+	}
+	return Rows.Err()
+}
+
+func (Provider *fsMetaSQL) invalidateFolders(Prefix string) {
+	for Folder := range Provider.folderIDCache {
+		if strings.HasPrefix(Folder, Prefix) {
+			delete(Provider.folderIDCache, Folder)
+		}
+	}
+	folderCache.invalidatePrefix(Provider.formatPath(Prefix))
+}
+
+func (Provider *fsMetaSQL) getOrCreateFolder(ctx context.Context, Folder string) (uint64, error) {
+	FolderID, err := Provider.getFolderID(ctx, Folder)
+	if err == sql.ErrNoRows {
+		return Provider.createFolder(ctx, Folder)
+	}
+	return FolderID, err
+}
+
+func (Provider *fsMetaSQL) getFolderID(ctx context.Context, v string) (uint64, error) {
+	if ID, ok := Provider.folderIDCache[v]; ok {
+		return ID, nil
+	}
+	FolderPath := Provider.formatPath(v)
+	if ID, ok := folderCache.getFolderID(FolderPath); ok {
+		Provider.folderIDCache[v] = ID
+		return ID, nil
+	}
+	var FolderKey uint64
+	Version := folderCache.getVersion()
+	Row := Provider.DB.QueryRowContext(ctx, Provider.Queries.GetFolderID, FolderPath)
+	err := Row.Scan(&FolderKey)
+	if err == nil {
+		Provider.folderIDCache[v] = FolderKey
+		folderCache.setFolderID(FolderPath, FolderKey, Version)
+	}
+	return FolderKey, err
+}
+
+func (Provider *fsMetaSQL) createFolder(ctx context.Context, v string) (uint64, error) {
+	if !Provider.Queries.CreateFolderReturning {
+		if _, err := Provider.DB.ExecContext(ctx, Provider.Queries.CreateFolder, Provider.formatPath(v)); err != nil {
+			return 0, err
+		}
+		return Provider.getFolderID(ctx, v)
+	}
+	var folderID uint64
+	Version := folderCache.getVersion()
+	Row := Provider.DB.QueryRowContext(ctx, Provider.Queries.CreateFolder, Provider.formatPath(v))
+	err := Row.Scan(&folderID)
+	if err == sql.ErrNoRows {
+		// ON CONFLICT DO NOTHING: Causes empty result set.
+		return Provider.getFolderID(ctx, v)
+	} else if err == nil {
+		Provider.folderIDCache[v] = folderID
+		folderCache.setFolderID(Provider.formatPath(v), folderID, Version)
+	}
+	return folderID, err
+}
+
+func (Provider *fsMetaSQL) formatPath(v string) string {
+	return fmt.Sprintf(`%s/%s`, Provider.Location, v)
+}
+
+func (Provider *fsMetaSQL) Get(ctx context.Context, Key Key) (Meta, error) {
+	return selfHealingGet(ctx, Provider.loaded, Provider.Store, Provider, Key)
+}
+
+func (Provider *fsMetaSQL) Lookup(ctx context.Context, Key Key) (Meta, error) {
+	return lookupFile(ctx, Provider, Provider.Store, Provider, Key)
+}
+
+func (Provider *fsMetaSQL) getFile(ctx context.Context, Path string) (*Meta, error) {
+	Folder, Filename, ok := splitPath(Path)
+	if !ok {
+		return nil, nil
+	}
+	FolderID, err := Provider.getFolderID(ctx, Folder)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	M := Meta{Key: Key{Path: Path}}
+	var Attributes sqlAttributes
+	err = Provider.DB.QueryRowContext(ctx, Provider.Queries.SelectFile, FolderID, Filename).Scan(
+		append([]interface{}{&M.Key.Size, &M.Key.StoreTime, &M.Key.ETag, &M.LastModified}, Attributes.dest()...)...)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := Attributes.apply(&M); err != nil {
+		return nil, err
+	}
+	return &M, nil
+}
+
+// sqlAttributes holds the nullable extended attributes columns
+type sqlAttributes struct {
+	Mode       int64
+	AccessTime sql.NullTime
+	UID        sql.NullInt64
+	GID        sql.NullInt64
+	Attributes sql.NullString
+}
+
+// dest returns the scan destinations for the mode, atime, uid, gid and attributes columns
+func (a *sqlAttributes) dest() []interface{} {
+	return []interface{}{&a.Mode, &a.AccessTime, &a.UID, &a.GID, &a.Attributes}
+}
+
+func (a *sqlAttributes) apply(Meta *Meta) error {
+	Meta.Mode = os.FileMode(a.Mode)
+	if a.AccessTime.Valid {
+		Meta.AccessTime = a.AccessTime.Time
+	}
+	if a.UID.Valid {
+		UID := int(a.UID.Int64)
+		Meta.UID = &UID
+	}
+	if a.GID.Valid {
+		GID := int(a.GID.Int64)
+		Meta.GID = &GID
+	}
+	if a.Attributes.Valid && a.Attributes.String != `` {
+		return json.Unmarshal([]byte(a.Attributes.String), &Meta.Attributes)
+	}
+	return nil
+}
+
+// newSQLAttributesArgs returns the mode, atime, uid, gid and attributes arguments
+func newSQLAttributesArgs(Meta Meta) ([]interface{}, error) {
+	Args := []interface{}{int64(Meta.Mode), nil, nil, nil, nil}
+	if !Meta.AccessTime.IsZero() {
+		Args[1] = Meta.AccessTime
+	}
+	if Meta.UID != nil {
+		Args[2] = int64(*Meta.UID)
+	}
+	if Meta.GID != nil {
+		Args[3] = int64(*Meta.GID)
+	}
+	if len(Meta.Attributes) > 0 {
+		Attributes, err := json.Marshal(Meta.Attributes)
+		if err != nil {
+			return nil, err
+		}
+		Args[4] = string(Attributes)
+	}
+	return Args, nil
+}
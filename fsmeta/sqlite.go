@@ -0,0 +1,61 @@
+//go:build !nosqlite
+// +build !nosqlite
+
+package fsmeta
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/golang-migrate/migrate/v4/database"
+	// import migrate sqlite3 driver, it registers go-sqlite3 too
+	sqlitemigrate "github.com/golang-migrate/migrate/v4/database/sqlite3"
+
+	sqlitebindata "github.com/drakkan/sftpgo/fsmeta/sql/sqlite"
+	"github.com/drakkan/sftpgo/logger"
+)
+
+var sqliteQueries = newSQLQueries(SQLiteDriverName, ``)
+
+func init() {
+	sharedMigrations[SQLiteDriverName] = sqlMigrations{
+		AssetNames: sqlitebindata.AssetNames,
+		Asset:      sqlitebindata.Asset,
+		SQLDriver:  `sqlite3`,
+		WithInstance: func(DB *sql.DB, MigrationsTable string) (database.Driver, error) {
+			return sqlitemigrate.WithInstance(DB, &sqlitemigrate.Config{MigrationsTable: MigrationsTable})
+		},
+	}
+}
+
+// NewSQLiteFactory returns a Factory storing the metadata in the given SQLite database
+func NewSQLiteFactory(DB *sql.DB) Factory {
+	return &sqlFactory{
+		DB:      DB,
+		Queries: sqliteQueries,
+	}
+}
+
+func (config *Config) initializeSQLiteProvider(basePath string) error {
+	DBPath, err := config.getDatabasePath(basePath)
+	if err != nil {
+		return err
+	}
+	if err := migrateDatabase(sqlitebindata.AssetNames, sqlitebindata.Asset,
+		fmt.Sprintf(`sqlite3://%v?x-migrations-table=%v`, DBPath, migrationsTable)); err != nil {
+		return err
+	}
+
+	logSender = fmt.Sprintf("fsmeta_%v", SQLiteDriverName)
+	connectionString := fmt.Sprintf("file:%v?cache=shared&_foreign_keys=1", DBPath)
+	dbHandle, err := sql.Open("sqlite3", connectionString)
+	if err == nil {
+		metaLog(logger.LevelDebug, "sqlite database handle created, connection string: %#v", connectionString)
+		dbHandle.SetMaxOpenConns(1)
+		DefaultFactory = NewSQLiteFactory(dbHandle)
+	} else {
+		metaLog(logger.LevelWarn, "error creating sqlite database handler, connection string: %#v, error: %v",
+			connectionString, err)
+	}
+	return err
+}
@@ -0,0 +1,10 @@
+//go:build nosqlite
+// +build nosqlite
+
+package fsmeta
+
+import "errors"
+
+func (config *Config) initializeSQLiteProvider(basePath string) error {
+	return errors.New("SQLite disabled at build time")
+}
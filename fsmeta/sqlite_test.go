@@ -0,0 +1,55 @@
+//go:build !nosqlite
+// +build !nosqlite
+
+package fsmeta
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteFactory(t *testing.T) {
+	EnabledRestore := Enabled
+	CurrentFactory := DefaultFactory
+	t.Cleanup(func() {
+		Enabled = EnabledRestore
+		DefaultFactory = CurrentFactory
+	})
+
+	BasePath := t.TempDir()
+	Config := Config{
+		Enabled:  true,
+		Driver:   SQLiteDriverName,
+		Database: `fsmeta.sqlite`,
+	}
+	require.NoError(t, Initialize(Config, BasePath))
+	assert.FileExists(t, filepath.Join(BasePath, `fsmeta.sqlite`))
+	// migrations are already applied
+	require.NoError(t, Initialize(Config, BasePath))
+	testFactory(t, DefaultFactory)
+}
+
+func TestSQLiteFactoryWithCache(t *testing.T) {
+	EnabledRestore := Enabled
+	CurrentFactory := DefaultFactory
+	t.Cleanup(func() {
+		Enabled = EnabledRestore
+		DefaultFactory = CurrentFactory
+		folderCache = nil
+	})
+
+	Config := Config{
+		Enabled:   true,
+		Driver:    SQLiteDriverName,
+		Database:  `fsmeta.sqlite`,
+		CacheSize: 10,
+		CacheTTL:  60,
+	}
+	require.NoError(t, Initialize(Config, t.TempDir()))
+	require.NotNil(t, folderCache)
+	// the cached folders must be invalidated by every change
+	testFactory(t, DefaultFactory)
+}
@@ -0,0 +1,168 @@
+package fsmeta
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	sqlTableFolders = `fsmeta_folders`
+	sqlTableFiles   = `fsmeta_files`
+	// sqlFilesColumnsCount is the number of columns set by the file upserts
+	sqlFilesColumnsCount = 11
+)
+
+// sqlQueries holds the driver specific statements used by fsMetaSQL.
+// Placeholders are always numbered in argument order so the same
+// arguments can be used for every driver
+type sqlQueries struct {
+	GetFolderID string
+	// CreateFolder returns the id of the inserted folder if CreateFolderReturning is true,
+	// otherwise it silently ignores duplicated folders and the id must be queried
+	CreateFolder          string
+	CreateFolderReturning bool
+	SelectFolderFiles     string
+	SelectFile            string
+	UpsertFile            string
+	DeleteFile            string
+	MoveFile              string
+	MoveAndUpdateFile     string
+	SelectFoldersByPrefix string
+	UpdateFolderPath      string
+	DeleteMergedFiles     string
+	MergeFolderFiles      string
+	DeleteFolderByID      string
+	DeleteFilesByPrefix   string
+	DeleteFoldersByPrefix string
+	ScanByPrefix          string
+	// UpsertFilesPrefix and UpsertFilesSuffix surround the rows of a multi-row
+	// upsert, use upsertFiles to build the statement
+	UpsertFilesPrefix string
+	UpsertFilesSuffix string
+	Driver            string
+}
+
+// upsertFiles returns a statement upserting the given number of rows,
+// each row has the same eleven arguments as UpsertFile
+func (q *sqlQueries) upsertFiles(Rows int) string {
+	var b strings.Builder
+	b.WriteString(q.UpsertFilesPrefix)
+	for Row := 0; Row < Rows; Row++ {
+		if Row > 0 {
+			b.WriteString(`, `)
+		}
+		b.WriteString(`(`)
+		for Column := 0; Column < sqlFilesColumnsCount; Column++ {
+			if Column > 0 {
+				b.WriteString(`, `)
+			}
+			if q.Driver == MySQLDriverName || q.Driver == SQLiteDriverName {
+				b.WriteString(`?`)
+			} else {
+				fmt.Fprintf(&b, `$%d`, Row*sqlFilesColumnsCount+Column+1)
+			}
+		}
+		b.WriteString(`)`)
+	}
+	b.WriteString(q.UpsertFilesSuffix)
+	return b.String()
+}
+
+func getSQLPlaceholders(Driver string) []string {
+	var placeholders []string
+	for i := 1; i <= 12; i++ {
+		if Driver == MySQLDriverName || Driver == SQLiteDriverName {
+			placeholders = append(placeholders, `?`)
+		} else {
+			placeholders = append(placeholders, fmt.Sprintf(`$%d`, i))
+		}
+	}
+	return placeholders
+}
+
+func newSQLQueries(Driver, TablesPrefix string) *sqlQueries {
+	p := getSQLPlaceholders(Driver)
+	// hasPrefix matches the column values starting with the given prefix,
+	// the prefix must be passed twice as argument
+	hasPrefix := func(Column string) string {
+		if Driver == MySQLDriverName {
+			return fmt.Sprintf(`LEFT(%s, CHAR_LENGTH(%s)) = %s`, Column, p[0], p[1])
+		}
+		return fmt.Sprintf(`substr(%s, 1, length(%s)) = %s`, Column, p[0], p[1])
+	}
+
+	Queries := &sqlQueries{
+		Driver:      Driver,
+		GetFolderID: fmt.Sprintf(`SELECT id FROM {{folders}} WHERE path=%s`, p[0]),
+		SelectFolderFiles: fmt.Sprintf(`SELECT filename, filesize, uploaded, etag, last_modified, `+
+			`mode, atime, uid, gid, attributes FROM {{files}} WHERE folder_id = %s`, p[0]),
+		SelectFile: fmt.Sprintf(`SELECT filesize, uploaded, etag, last_modified, `+
+			`mode, atime, uid, gid, attributes FROM {{files}} WHERE folder_id = %s AND filename = %s`, p[0], p[1]),
+		DeleteFile: fmt.Sprintf(`DELETE FROM {{files}} WHERE folder_id=%s AND filename=%s`, p[0], p[1]),
+		MoveFile: fmt.Sprintf(`UPDATE {{files}} SET folder_id=%s, filename=%s `+
+			`WHERE folder_id=%s AND filename=%s`, p[0], p[1], p[2], p[3]),
+		MoveAndUpdateFile: fmt.Sprintf(`UPDATE {{files}} SET folder_id=%s, filename=%s, uploaded=%s, filesize=%s, etag=%s `+
+			`WHERE folder_id=%s AND filename=%s`, p[0], p[1], p[2], p[3], p[4], p[5], p[6]),
+		SelectFoldersByPrefix: fmt.Sprintf(`SELECT id, path FROM {{folders}} WHERE %s`, hasPrefix(`path`)),
+		UpdateFolderPath:      fmt.Sprintf(`UPDATE {{folders}} SET path=%s WHERE id=%s`, p[0], p[1]),
+		DeleteMergedFiles: fmt.Sprintf(`DELETE FROM {{files}} WHERE folder_id=%s AND filename IN `+
+			`(SELECT filename FROM {{files}} WHERE folder_id=%s)`, p[0], p[1]),
+		MergeFolderFiles: fmt.Sprintf(`UPDATE {{files}} SET folder_id=%s WHERE folder_id=%s`, p[0], p[1]),
+		DeleteFolderByID: fmt.Sprintf(`DELETE FROM {{folders}} WHERE id=%s`, p[0]),
+		DeleteFilesByPrefix: fmt.Sprintf(`DELETE FROM {{files}} WHERE folder_id IN `+
+			`(SELECT id FROM {{folders}} WHERE %s)`, hasPrefix(`path`)),
+		DeleteFoldersByPrefix: fmt.Sprintf(`DELETE FROM {{folders}} WHERE %s`, hasPrefix(`path`)),
+		ScanByPrefix: fmt.Sprintf(`SELECT f.path, fi.filename, fi.filesize, fi.uploaded, fi.etag, fi.last_modified, `+
+			`fi.mode, fi.atime, fi.uid, fi.gid, fi.attributes `+
+			`FROM {{files}} fi INNER JOIN {{folders}} f ON fi.folder_id = f.id `+
+			`WHERE %s`, hasPrefix(`f.path`)),
+	}
+
+	switch Driver {
+	case MySQLDriverName:
+		Queries.CreateFolder = `INSERT IGNORE INTO {{folders}} (path) VALUES (?)`
+		Queries.UpsertFile = `INSERT INTO {{files}} ` +
+			`(folder_id, filename, uploaded, filesize, etag, last_modified, mode, atime, uid, gid, attributes) ` +
+			`VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ` +
+			`ON DUPLICATE KEY UPDATE ` +
+			`uploaded=VALUES(uploaded), filesize=VALUES(filesize), etag=VALUES(etag), last_modified=VALUES(last_modified), ` +
+			`mode=VALUES(mode), atime=VALUES(atime), uid=VALUES(uid), gid=VALUES(gid), attributes=VALUES(attributes)`
+		Queries.UpsertFilesSuffix = Queries.UpsertFile[strings.Index(Queries.UpsertFile, ` ON DUPLICATE`):]
+		// MySQL cannot select from the table being modified in a subquery
+		Queries.DeleteMergedFiles = `DELETE t FROM {{files}} t INNER JOIN {{files}} s ` +
+			`ON t.filename = s.filename WHERE t.folder_id=? AND s.folder_id=?`
+	case SQLiteDriverName:
+		// RETURNING requires SQLite 3.35
+		Queries.CreateFolder = `INSERT INTO {{folders}} (path) VALUES (?) ON CONFLICT (path) DO NOTHING`
+		Queries.UpsertFile = `INSERT INTO {{files}} ` +
+			`(folder_id, filename, uploaded, filesize, etag, last_modified, mode, atime, uid, gid, attributes) ` +
+			`VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ` +
+			`ON CONFLICT (folder_id, filename) DO UPDATE ` +
+			`SET uploaded=excluded.uploaded, filesize=excluded.filesize, etag=excluded.etag, last_modified=excluded.last_modified, ` +
+			`mode=excluded.mode, atime=excluded.atime, uid=excluded.uid, gid=excluded.gid, attributes=excluded.attributes`
+		Queries.UpsertFilesSuffix = Queries.UpsertFile[strings.Index(Queries.UpsertFile, ` ON CONFLICT`):]
+	default:
+		Queries.CreateFolder = `INSERT INTO {{folders}} (path) VALUES ($1) ON CONFLICT (path) DO NOTHING RETURNING id`
+		Queries.CreateFolderReturning = true
+		Queries.UpsertFile = `INSERT INTO {{files}} ` +
+			`(folder_id, filename, uploaded, filesize, etag, last_modified, mode, atime, uid, gid, attributes) ` +
+			`VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) ` +
+			`ON CONFLICT (folder_id, filename) DO UPDATE ` +
+			`SET uploaded=$3, filesize=$4, etag=$5, last_modified=$6, mode=$7, atime=$8, uid=$9, gid=$10, attributes=$11`
+		Queries.UpsertFilesSuffix = ` ON CONFLICT (folder_id, filename) DO UPDATE ` +
+			`SET uploaded=excluded.uploaded, filesize=excluded.filesize, etag=excluded.etag, last_modified=excluded.last_modified, ` +
+			`mode=excluded.mode, atime=excluded.atime, uid=excluded.uid, gid=excluded.gid, attributes=excluded.attributes`
+	}
+	Queries.UpsertFilesPrefix = `INSERT INTO {{files}} ` +
+		`(folder_id, filename, uploaded, filesize, etag, last_modified, mode, atime, uid, gid, attributes) VALUES `
+
+	Replacer := strings.NewReplacer(`{{folders}}`, TablesPrefix+sqlTableFolders, `{{files}}`, TablesPrefix+sqlTableFiles)
+	for _, Query := range []*string{&Queries.GetFolderID, &Queries.CreateFolder, &Queries.SelectFolderFiles,
+		&Queries.SelectFile, &Queries.UpsertFile, &Queries.DeleteFile, &Queries.MoveFile, &Queries.MoveAndUpdateFile,
+		&Queries.SelectFoldersByPrefix, &Queries.UpdateFolderPath, &Queries.DeleteMergedFiles,
+		&Queries.MergeFolderFiles, &Queries.DeleteFolderByID, &Queries.DeleteFilesByPrefix,
+		&Queries.DeleteFoldersByPrefix, &Queries.ScanByPrefix, &Queries.UpsertFilesPrefix} {
+		*Query = Replacer.Replace(*Query)
+	}
+	return Queries
+}
@@ -395,6 +395,71 @@ func TestBasicFTPHandling(t *testing.T) {
 	assert.Eventually(t, func() bool { return len(common.Connections.GetStats()) == 0 }, 1*time.Second, 50*time.Millisecond)
 }
 
+func TestPreActionsHook(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("this test is not available on Windows")
+	}
+	user, _, err := httpdtest.AddUser(getTestUser(), http.StatusCreated)
+	assert.NoError(t, err)
+	hookPath := filepath.Join(homeBasePath, "pre_action_hook.sh")
+	hookContent := "#!/bin/sh\n\ncase \"$SFTPGO_ACTION_VIRTUAL_PATH $SFTPGO_ACTION_VIRTUAL_TARGET\" in\n" +
+		"*denied*)\necho \"$SFTPGO_ACTION is not allowed\"\nexit 1\n;;\nesac\n"
+	err = ioutil.WriteFile(hookPath, []byte(hookContent), os.ModePerm)
+	assert.NoError(t, err)
+	oldExecuteOn := common.Config.Actions.ExecuteOn
+	oldHook := common.Config.Actions.Hook
+	common.Config.Actions.ExecuteOn = []string{"pre-upload", "pre-download", "pre-rename", "pre-mkdir"}
+	common.Config.Actions.Hook = hookPath
+	defer func() {
+		common.Config.Actions.ExecuteOn = oldExecuteOn
+		common.Config.Actions.Hook = oldHook
+	}()
+
+	client, err := getFTPClient(user, true)
+	if assert.NoError(t, err) {
+		testFilePath := filepath.Join(homeBasePath, testFileName)
+		testFileSize := int64(65535)
+		err = createTestFile(testFilePath, testFileSize)
+		assert.NoError(t, err)
+		err = ftpUploadFile(testFilePath, testFileName, testFileSize, client, 0)
+		assert.NoError(t, err)
+		err = ftpUploadFile(testFilePath, "denied.dat", testFileSize, client, 0)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "pre-upload is not allowed")
+		}
+		err = client.Rename(testFileName, "denied.dat")
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "pre-rename is not allowed")
+		}
+		err = client.MakeDir("denied_dir")
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "pre-mkdir is not allowed")
+		}
+		err = ioutil.WriteFile(filepath.Join(user.GetHomeDir(), "denied_dl.dat"), []byte("data"), os.ModePerm)
+		assert.NoError(t, err)
+		localDownloadPath := filepath.Join(homeBasePath, testDLFileName)
+		err = ftpDownloadFile("denied_dl.dat", localDownloadPath, 4, client, 0)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "pre-download is not allowed")
+		}
+		err = ftpDownloadFile(testFileName, localDownloadPath, testFileSize, client, 0)
+		assert.NoError(t, err)
+		err = client.Quit()
+		assert.NoError(t, err)
+		err = os.Remove(testFilePath)
+		assert.NoError(t, err)
+		err = os.Remove(localDownloadPath)
+		assert.NoError(t, err)
+	}
+
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.RemoveAll(user.GetHomeDir())
+	assert.NoError(t, err)
+	err = os.Remove(hookPath)
+	assert.NoError(t, err)
+}
+
 func TestLoginInvalidPwd(t *testing.T) {
 	u := getTestUser()
 	user, _, err := httpdtest.AddUser(u, http.StatusCreated)
@@ -1395,6 +1460,74 @@ func TestStat(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestFolderPrefix(t *testing.T) {
+	u := getTestUser()
+	u.Filters.FolderPrefix = "/inbound/acme"
+	user, _, err := httpdtest.AddUser(u, http.StatusCreated)
+	assert.NoError(t, err)
+	client, err := getFTPClient(user, false)
+	if assert.NoError(t, err) {
+		err = checkBasicFTP(client)
+		assert.NoError(t, err)
+		// the prefix parents only contain the next prefix directory
+		entries, err := client.List("/")
+		if assert.NoError(t, err) && assert.Len(t, entries, 1) {
+			assert.Equal(t, "inbound", entries[0].Name)
+			assert.Equal(t, ftp.EntryTypeFolder, entries[0].Type)
+		}
+		entries, err = client.List("/inbound")
+		if assert.NoError(t, err) && assert.Len(t, entries, 1) {
+			assert.Equal(t, "acme", entries[0].Name)
+		}
+		_, err = client.List("/other")
+		assert.Error(t, err)
+		err = client.ChangeDir("/inbound")
+		assert.NoError(t, err)
+		err = client.ChangeDir("acme")
+		assert.NoError(t, err)
+
+		testFilePath := filepath.Join(homeBasePath, testFileName)
+		testFileSize := int64(65535)
+		err = createTestFile(testFilePath, testFileSize)
+		assert.NoError(t, err)
+		err = ftpUploadFile(testFilePath, testFileName, testFileSize, client, 0)
+		assert.NoError(t, err)
+		assert.FileExists(t, filepath.Join(user.GetHomeDir(), testFileName))
+		err = ftpUploadFile(testFilePath, path.Join("/inbound", testFileName), testFileSize, client, 0)
+		assert.Error(t, err)
+		err = client.MakeDir("/inbound/dir")
+		assert.Error(t, err)
+		err = client.MakeDir("/inbound/acme/dir")
+		assert.NoError(t, err)
+		assert.DirExists(t, filepath.Join(user.GetHomeDir(), "dir"))
+		size, err := client.FileSize(path.Join("/inbound/acme", testFileName))
+		assert.NoError(t, err)
+		assert.Equal(t, testFileSize, size)
+		localDownloadPath := filepath.Join(homeBasePath, testDLFileName)
+		err = ftpDownloadFile(path.Join("/inbound/acme", testFileName), localDownloadPath, testFileSize, client, 0)
+		assert.NoError(t, err)
+		err = client.Rename(testFileName, path.Join("/inbound", testFileName))
+		assert.Error(t, err)
+		err = client.Rename(testFileName, path.Join("/inbound/acme/dir", testFileName))
+		assert.NoError(t, err)
+		err = client.Delete(path.Join("/inbound/acme/dir", testFileName))
+		assert.NoError(t, err)
+		err = client.RemoveDir("/inbound")
+		assert.Error(t, err)
+		err = client.Quit()
+		assert.NoError(t, err)
+
+		err = os.Remove(testFilePath)
+		assert.NoError(t, err)
+		err = os.Remove(localDownloadPath)
+		assert.NoError(t, err)
+	}
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.RemoveAll(user.GetHomeDir())
+	assert.NoError(t, err)
+}
+
 func TestUploadOverwriteVfolder(t *testing.T) {
 	u := getTestUser()
 	vdir := "/vdir"
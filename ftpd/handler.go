@@ -63,6 +63,10 @@ func (c *Connection) Create(name string) (afero.File, error) {
 func (c *Connection) Mkdir(name string, perm os.FileMode) error {
 	c.UpdateLastActivity()
 
+	name, err := c.RemoveFolderPrefix(name)
+	if err != nil {
+		return err
+	}
 	p, err := c.Fs.ResolvePath(name)
 	if err != nil {
 		return c.GetFsError(err)
@@ -90,6 +94,10 @@ func (c *Connection) OpenFile(name string, flag int, perm os.FileMode) (afero.Fi
 func (c *Connection) Remove(name string) error {
 	c.UpdateLastActivity()
 
+	name, err := c.RemoveFolderPrefix(name)
+	if err != nil {
+		return err
+	}
 	p, err := c.Fs.ResolvePath(name)
 	if err != nil {
 		return c.GetFsError(err)
@@ -117,6 +125,10 @@ func (c *Connection) RemoveAll(path string) error {
 func (c *Connection) Rename(oldname, newname string) error {
 	c.UpdateLastActivity()
 
+	oldname, newname, err := c.RemoveFolderPrefixes(oldname, newname)
+	if err != nil {
+		return err
+	}
 	p, err := c.Fs.ResolvePath(oldname)
 	if err != nil {
 		return c.GetFsError(err)
@@ -139,9 +151,19 @@ func (c *Connection) Rename(oldname, newname string) error {
 func (c *Connection) Stat(name string) (os.FileInfo, error) {
 	c.UpdateLastActivity()
 
+	name, match := c.ResolvePrefixPath(name)
+	switch match {
+	case common.PathIsPrefixParent:
+		return c.StatPrefixParent(name), nil
+	case common.PathDiverged:
+		return nil, c.GetPermissionDeniedError()
+	}
 	if !c.User.HasPerm(dataprovider.PermListItems, path.Dir(name)) {
 		return nil, c.GetPermissionDeniedError()
 	}
+	if c.IsReservedPath(name) {
+		return nil, c.GetNotExistError()
+	}
 
 	p, err := c.Fs.ResolvePath(name)
 	if err != nil {
@@ -182,6 +204,10 @@ func (c *Connection) Chown(name string, uid, gid int) error {
 func (c *Connection) Chmod(name string, mode os.FileMode) error {
 	c.UpdateLastActivity()
 
+	name, err := c.RemoveFolderPrefix(name)
+	if err != nil {
+		return err
+	}
 	p, err := c.Fs.ResolvePath(name)
 	if err != nil {
 		return c.GetFsError(err)
@@ -197,6 +223,10 @@ func (c *Connection) Chmod(name string, mode os.FileMode) error {
 func (c *Connection) Chtimes(name string, atime time.Time, mtime time.Time) error {
 	c.UpdateLastActivity()
 
+	name, err := c.RemoveFolderPrefix(name)
+	if err != nil {
+		return err
+	}
 	p, err := c.Fs.ResolvePath(name)
 	if err != nil {
 		return c.GetFsError(err)
@@ -213,6 +243,10 @@ func (c *Connection) Chtimes(name string, atime time.Time, mtime time.Time) erro
 func (c *Connection) GetAvailableSpace(dirName string) (int64, error) {
 	c.UpdateLastActivity()
 
+	dirName, err := c.RemoveFolderPrefix(dirName)
+	if err != nil {
+		return 0, err
+	}
 	quotaResult := c.HasSpace(false, false, path.Join(dirName, "fakefile.txt"))
 	if !quotaResult.HasSpace {
 		return 0, nil
@@ -281,6 +315,10 @@ func (c *Connection) AllocateSpace(size int) error {
 func (c *Connection) RemoveDir(name string) error {
 	c.UpdateLastActivity()
 
+	name, err := c.RemoveFolderPrefix(name)
+	if err != nil {
+		return err
+	}
 	p, err := c.Fs.ResolvePath(name)
 	if err != nil {
 		return c.GetFsError(err)
@@ -293,6 +331,10 @@ func (c *Connection) RemoveDir(name string) error {
 func (c *Connection) Symlink(oldname, newname string) error {
 	c.UpdateLastActivity()
 
+	oldname, newname, err := c.RemoveFolderPrefixes(oldname, newname)
+	if err != nil {
+		return err
+	}
 	p, err := c.Fs.ResolvePath(oldname)
 	if err != nil {
 		return c.GetFsError(err)
@@ -309,6 +351,13 @@ func (c *Connection) Symlink(oldname, newname string) error {
 func (c *Connection) ReadDir(name string) ([]os.FileInfo, error) {
 	c.UpdateLastActivity()
 
+	name, match := c.ResolvePrefixPath(name)
+	switch match {
+	case common.PathIsPrefixParent:
+		return c.ListPrefixParent(name), nil
+	case common.PathDiverged:
+		return nil, c.GetPermissionDeniedError()
+	}
 	p, err := c.Fs.ResolvePath(name)
 	if err != nil {
 		return nil, c.GetFsError(err)
@@ -320,6 +369,10 @@ func (c *Connection) ReadDir(name string) ([]os.FileInfo, error) {
 func (c *Connection) GetHandle(name string, flags int, offset int64) (ftpserver.FileTransfer, error) {
 	c.UpdateLastActivity()
 
+	name, err := c.RemoveFolderPrefix(name)
+	if err != nil {
+		return nil, err
+	}
 	p, err := c.Fs.ResolvePath(name)
 	if err != nil {
 		return nil, c.GetFsError(err)
@@ -340,11 +393,15 @@ func (c *Connection) downloadFile(fsPath, ftpPath string, offset int64) (ftpserv
 		return nil, c.GetPermissionDeniedError()
 	}
 
-	if !c.User.IsFileAllowed(ftpPath) {
+	if !c.IsFileAllowed(ftpPath) {
 		c.Log(logger.LevelWarn, "reading file %#v is not allowed", ftpPath)
 		return nil, c.GetPermissionDeniedError()
 	}
 
+	if err := c.ExecutePreTransferAction(common.TransferDownload, fsPath, ftpPath, -1); err != nil {
+		return nil, err
+	}
+
 	file, r, cancelFn, err := c.Fs.Open(fsPath, offset)
 	if err != nil {
 		c.Log(logger.LevelWarn, "could not open file %#v for reading: %+v", fsPath, err)
@@ -360,21 +417,21 @@ func (c *Connection) downloadFile(fsPath, ftpPath string, offset int64) (ftpserv
 }
 
 func (c *Connection) uploadFile(fsPath, ftpPath string, flags int) (ftpserver.FileTransfer, error) {
-	if !c.User.IsFileAllowed(ftpPath) {
+	if !c.IsFileAllowed(ftpPath) {
 		c.Log(logger.LevelWarn, "writing file %#v is not allowed", ftpPath)
 		return nil, c.GetPermissionDeniedError()
 	}
 
-	filePath := fsPath
-	if common.Config.IsAtomicUploadEnabled() && c.Fs.IsAtomicUploadSupported() {
-		filePath = c.Fs.GetAtomicUploadPath(fsPath)
-	}
+	filePath := c.GetUploadPath(fsPath)
 
 	stat, statErr := c.Fs.Lstat(fsPath)
 	if (statErr == nil && stat.Mode()&os.ModeSymlink != 0) || c.Fs.IsNotExist(statErr) {
 		if !c.User.HasPerm(dataprovider.PermUpload, path.Dir(ftpPath)) {
 			return nil, c.GetPermissionDeniedError()
 		}
+		if err := c.ExecutePreTransferAction(common.TransferUpload, fsPath, ftpPath, 0); err != nil {
+			return nil, err
+		}
 		return c.handleFTPUploadToNewFile(fsPath, filePath, ftpPath)
 	}
 
@@ -392,6 +449,9 @@ func (c *Connection) uploadFile(fsPath, ftpPath string, flags int) (ftpserver.Fi
 	if !c.User.HasPerm(dataprovider.PermOverwrite, path.Dir(ftpPath)) {
 		return nil, c.GetPermissionDeniedError()
 	}
+	if err := c.ExecutePreTransferAction(common.TransferUpload, fsPath, ftpPath, stat.Size()); err != nil {
+		return nil, err
+	}
 
 	return c.handleFTPUploadToExistingFile(flags, fsPath, filePath, stat.Size(), ftpPath)
 }
@@ -444,16 +504,23 @@ func (c *Connection) handleFTPUploadToExistingFile(flags int, resolvedPath, file
 		return nil, err
 	}
 
-	if common.Config.IsAtomicUploadEnabled() && c.Fs.IsAtomicUploadSupported() {
+	if c.IsExistingFileMovedForUpload(resolvedPath, filePath) {
 		err = c.Fs.Rename(resolvedPath, filePath)
 		if err != nil {
-			c.Log(logger.LevelWarn, "error renaming existing file for atomic upload, source: %#v, dest: %#v, err: %+v",
+			c.Log(logger.LevelWarn, "error renaming existing file for upload, source: %#v, dest: %#v, err: %+v",
 				resolvedPath, filePath, err)
 			return nil, c.GetFsError(err)
 		}
 	}
 
-	file, w, cancelFn, err := c.Fs.Create(filePath, flags)
+	var file vfs.File
+	var w *vfs.PipeWriter
+	var cancelFn func()
+	if isResume {
+		file, w, cancelFn, err = vfs.CreateForResume(c.Fs, filePath, flags, fileSize)
+	} else {
+		file, w, cancelFn, err = c.Fs.Create(filePath, flags)
+	}
 	if err != nil {
 		c.Log(logger.LevelWarn, "error opening existing file, flags: %v, source: %#v, err: %+v", flags, filePath, err)
 		return nil, c.GetFsError(err)
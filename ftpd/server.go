@@ -242,6 +242,7 @@ func (s *Server) validateUser(user dataprovider.User, cc ftpserver.ClientContext
 		BaseConnection: common.NewBaseConnection(fmt.Sprintf("%v_%v", s.ID, cc.ID()), common.ProtocolFTP, user, fs),
 		clientContext:  cc,
 	}
+	connection.SetRemoteAddress(cc.RemoteAddr().String())
 	err = common.Connections.Swap(connection)
 	if err != nil {
 		return nil, errors.New("Internal authentication error")
@@ -62,7 +62,8 @@ func (t *transfer) Write(p []byte) (n int, err error) {
 	t.Connection.UpdateLastActivity()
 
 	n, err = t.writer.Write(p)
-	atomic.AddInt64(&t.BytesReceived, int64(n))
+	received := atomic.AddInt64(&t.BytesReceived, int64(n))
+	t.UpdateChecksum(p[:n], received-int64(n))
 
 	if t.MaxWriteSize > 0 && err == nil && atomic.LoadInt64(&t.BytesReceived) > t.MaxWriteSize {
 		err = common.ErrQuotaExceeded
@@ -88,6 +89,10 @@ func (t *transfer) Seek(offset int64, whence int) (int64, error) {
 	if t.reader != nil && t.expectedOffset == offset && whence == io.SeekStart {
 		return offset, nil
 	}
+	if t.writer != nil && t.MinWriteOffset > 0 && t.MinWriteOffset == offset && whence == io.SeekStart {
+		// resumable upload to a cloud backend, data will be appended to the existing contents
+		return offset, nil
+	}
 	t.TransferError(errors.New("seek is unsupported for this transfer"))
 	return 0, common.ErrOpUnsupported
 }
@@ -0,0 +1,101 @@
+package httpd
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/render"
+
+	"github.com/drakkan/sftpgo/dataprovider"
+)
+
+func getActionDeliveries(w http.ResponseWriter, r *http.Request) {
+	limit, offset, order, err := getSearchFilters(w, r)
+	if err != nil {
+		return
+	}
+	status := 0
+	if _, ok := r.URL.Query()["status"]; ok {
+		status, err = strconv.Atoi(r.URL.Query().Get("status"))
+		if err != nil || (status != dataprovider.ActionDeliveryStatusPending && status != dataprovider.ActionDeliveryStatusFailed) {
+			sendAPIResponse(w, r, errors.New("Invalid status"), "", http.StatusBadRequest)
+			return
+		}
+	}
+
+	deliveries, err := dataprovider.GetActionDeliveries(status, limit, offset, order)
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	render.JSON(w, r, deliveries)
+}
+
+func getActionDeliveryByID(w http.ResponseWriter, r *http.Request) {
+	id, err := getActionDeliveryID(r)
+	if err != nil {
+		sendAPIResponse(w, r, err, "", http.StatusBadRequest)
+		return
+	}
+	delivery, err := dataprovider.GetActionDeliveryByID(id)
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	render.JSON(w, r, delivery)
+}
+
+func retryActionDelivery(w http.ResponseWriter, r *http.Request) {
+	id, err := getActionDeliveryID(r)
+	if err != nil {
+		sendAPIResponse(w, r, err, "", http.StatusBadRequest)
+		return
+	}
+	err = dataprovider.RetryActionDelivery(id)
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	sendAPIResponse(w, r, err, "Delivery scheduled", http.StatusOK)
+}
+
+func deleteActionDelivery(w http.ResponseWriter, r *http.Request) {
+	id, err := getActionDeliveryID(r)
+	if err != nil {
+		sendAPIResponse(w, r, err, "", http.StatusBadRequest)
+		return
+	}
+	err = dataprovider.DeleteActionDelivery(id)
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	sendAPIResponse(w, r, err, "Delivery deleted", http.StatusOK)
+}
+
+func retryFailedActionDeliveries(w http.ResponseWriter, r *http.Request) {
+	err := dataprovider.RetryFailedActionDeliveries()
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	sendAPIResponse(w, r, err, "Failed deliveries scheduled", http.StatusOK)
+}
+
+func purgeFailedActionDeliveries(w http.ResponseWriter, r *http.Request) {
+	err := dataprovider.PurgeFailedActionDeliveries()
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	sendAPIResponse(w, r, err, "Failed deliveries purged", http.StatusOK)
+}
+
+func getActionDeliveryID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(getURLParam(r, "id"), 10, 64)
+	if err != nil {
+		return 0, errors.New("Invalid delivery id")
+	}
+	return id, nil
+}
@@ -0,0 +1,93 @@
+package httpd_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/drakkan/sftpgo/dataprovider"
+	"github.com/drakkan/sftpgo/httpdtest"
+)
+
+func TestActionDeliveries(t *testing.T) {
+	delivery := dataprovider.ActionDelivery{
+		Action:       "upload",
+		Username:     "action_user",
+		Notification: json.RawMessage(`{"action":"upload","username":"action_user"}`),
+	}
+	err := dataprovider.AddActionDelivery(&delivery)
+	require.NoError(t, err)
+
+	_, _, err = httpdtest.GetActionDeliveries(3, 0, 0, http.StatusBadRequest)
+	assert.NoError(t, err)
+	deliveries, _, err := httpdtest.GetActionDeliveries(dataprovider.ActionDeliveryStatusPending, 0, 0, http.StatusOK)
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 1)
+	deliveries, _, err = httpdtest.GetActionDeliveries(dataprovider.ActionDeliveryStatusFailed, 0, 0, http.StatusOK)
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 0)
+
+	delivery.Status = dataprovider.ActionDeliveryStatusFailed
+	delivery.Attempts = 10
+	delivery.LastError = "unexpected HTTP response code"
+	err = dataprovider.UpdateActionDelivery(&delivery)
+	require.NoError(t, err)
+
+	deliveries, _, err = httpdtest.GetActionDeliveries(dataprovider.ActionDeliveryStatusFailed, 0, 0, http.StatusOK)
+	assert.NoError(t, err)
+	if assert.Len(t, deliveries, 1) {
+		assert.Equal(t, delivery.ID, deliveries[0].ID)
+		assert.Equal(t, "unexpected HTTP response code", deliveries[0].LastError)
+		assert.JSONEq(t, string(delivery.Notification), string(deliveries[0].Notification))
+	}
+
+	_, err = httpdtest.RetryActionDelivery(delivery.ID, http.StatusOK)
+	assert.NoError(t, err)
+	d, _, err := httpdtest.GetActionDeliveryByID(delivery.ID, http.StatusOK)
+	assert.NoError(t, err)
+	assert.Equal(t, dataprovider.ActionDeliveryStatusPending, d.Status)
+	assert.Equal(t, 0, d.Attempts)
+
+	err = dataprovider.UpdateActionDelivery(&delivery)
+	require.NoError(t, err)
+	_, err = httpdtest.RetryFailedActionDeliveries(http.StatusOK)
+	assert.NoError(t, err)
+	d, _, err = httpdtest.GetActionDeliveryByID(delivery.ID, http.StatusOK)
+	assert.NoError(t, err)
+	assert.Equal(t, dataprovider.ActionDeliveryStatusPending, d.Status)
+
+	// pending deliveries are not purged
+	_, err = httpdtest.PurgeFailedActionDeliveries(http.StatusOK)
+	assert.NoError(t, err)
+	_, _, err = httpdtest.GetActionDeliveryByID(delivery.ID, http.StatusOK)
+	assert.NoError(t, err)
+	err = dataprovider.UpdateActionDelivery(&delivery)
+	require.NoError(t, err)
+	_, err = httpdtest.PurgeFailedActionDeliveries(http.StatusOK)
+	assert.NoError(t, err)
+	_, _, err = httpdtest.GetActionDeliveryByID(delivery.ID, http.StatusNotFound)
+	assert.NoError(t, err)
+
+	err = dataprovider.AddActionDelivery(&delivery)
+	require.NoError(t, err)
+	_, err = httpdtest.RemoveActionDelivery(delivery.ID, http.StatusOK)
+	assert.NoError(t, err)
+	_, err = httpdtest.RemoveActionDelivery(delivery.ID, http.StatusNotFound)
+	assert.NoError(t, err)
+	_, err = httpdtest.RetryActionDelivery(delivery.ID, http.StatusNotFound)
+	assert.NoError(t, err)
+}
+
+func TestActionDeliveryInvalidID(t *testing.T) {
+	token, err := getJWTAPITokenFromTestServer(defaultTokenAuthUser, defaultTokenAuthPass)
+	assert.NoError(t, err)
+	req, err := http.NewRequest(http.MethodGet, "/api/v2/action-deliveries/invalid", nil)
+	assert.NoError(t, err)
+	setBearerForReq(req, token)
+	rr := executeRequest(req)
+	checkResponseCode(t, http.StatusBadRequest, rr)
+	assert.Contains(t, rr.Body.String(), "Invalid delivery id")
+}
@@ -0,0 +1,182 @@
+package httpd
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/render"
+
+	"github.com/drakkan/sftpgo/dataprovider"
+	"github.com/drakkan/sftpgo/fsmeta"
+	"github.com/drakkan/sftpgo/httpd/translate"
+	"github.com/drakkan/sftpgo/vfs"
+)
+
+type fsmetaReconcileRequest struct {
+	Username string `json:"username"`
+	Path     string `json:"path"`
+	DryRun   bool   `json:"dry_run"`
+}
+
+func reconcileFSMeta(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
+	var req fsmetaReconcileRequest
+	if err := render.DecodeJSON(r.Body, &req); err != nil {
+		sendAPIResponse(w, r, err, "", http.StatusBadRequest)
+		return
+	}
+	user, err := dataprovider.UserExists(req.Username)
+	if err != nil {
+		sendAPIResponse(w, r, err, "", getRespStatus(err))
+		return
+	}
+	fs, err := user.GetFilesystem("")
+	if err != nil {
+		sendAPIResponse(w, r, err, "Unable to create the user filesystem", http.StatusInternalServerError)
+		return
+	}
+	defer fs.Close()
+
+	reconciler, ok := fs.(vfs.FSMetaReconciler)
+	if !ok {
+		sendAPIResponse(w, r, errors.New("fsmeta reconcile is not supported for this filesystem"), "",
+			http.StatusBadRequest)
+		return
+	}
+	if req.Path == "" {
+		req.Path = "/"
+	}
+	prefix, err := fs.ResolvePath(req.Path)
+	if err != nil {
+		sendAPIResponse(w, r, err, "", http.StatusBadRequest)
+		return
+	}
+	prefix = strings.TrimPrefix(prefix, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	report, err := reconciler.ReconcileFSMeta(r.Context(), prefix, req.DryRun)
+	if err != nil {
+		if errors.Is(err, fsmeta.ErrNotEnabled) {
+			sendAPIResponse(w, r, err, "", http.StatusBadRequest)
+			return
+		}
+		sendAPIResponse(w, r, err, "", http.StatusInternalServerError)
+		return
+	}
+	render.JSON(w, r, report)
+}
+
+type fsmetaObjectRequest struct {
+	Username string `json:"username"`
+	Path     string `json:"path"`
+}
+
+func getFSMeta(w http.ResponseWriter, r *http.Request) {
+	req := fsmetaObjectRequest{
+		Username: r.URL.Query().Get("username"),
+		Path:     r.URL.Query().Get("path"),
+	}
+	inspector, key, closeFs, err := getFSMetaInspector(req)
+	if err != nil {
+		sendFSMetaError(w, r, err)
+		return
+	}
+	defer closeFs()
+
+	inspection, err := inspector.InspectFSMeta(r.Context(), key)
+	if err != nil {
+		sendFSMetaError(w, r, err)
+		return
+	}
+	render.JSON(w, r, inspection)
+}
+
+func refreshFSMeta(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
+	var req fsmetaObjectRequest
+	if err := render.DecodeJSON(r.Body, &req); err != nil {
+		sendAPIResponse(w, r, err, "", http.StatusBadRequest)
+		return
+	}
+	inspector, key, closeFs, err := getFSMetaInspector(req)
+	if err != nil {
+		sendFSMetaError(w, r, err)
+		return
+	}
+	defer closeFs()
+
+	inspection, err := inspector.RefreshFSMeta(r.Context(), key)
+	if err != nil {
+		sendFSMetaError(w, r, err)
+		return
+	}
+	render.JSON(w, r, inspection)
+}
+
+func deleteFSMeta(w http.ResponseWriter, r *http.Request) {
+	req := fsmetaObjectRequest{
+		Username: r.URL.Query().Get("username"),
+		Path:     r.URL.Query().Get("path"),
+	}
+	inspector, key, closeFs, err := getFSMetaInspector(req)
+	if err != nil {
+		sendFSMetaError(w, r, err)
+		return
+	}
+	defer closeFs()
+
+	if err := inspector.DeleteFSMeta(r.Context(), key); err != nil {
+		sendFSMetaError(w, r, err)
+		return
+	}
+	sendAPIResponse(w, r, nil, "Metadata deleted", http.StatusOK)
+}
+
+// getFSMetaInspector resolves the virtual path for the given user to the object key
+// the same way the translate API does. The returned function closes the filesystem
+func getFSMetaInspector(req fsmetaObjectRequest) (vfs.FSMetaInspector, string, func(), error) {
+	if req.Path == "" {
+		return nil, "", nil, wrapAPIError(translate.ErrFilePathRequired, "", http.StatusBadRequest)
+	}
+	user, err := dataprovider.UserExists(req.Username)
+	if err != nil {
+		return nil, "", nil, wrapAPIError(err, "", getRespStatus(err))
+	}
+	translateReq := translate.Request{
+		Username: user.Username,
+		FilePath: req.Path,
+	}
+	resp, err := translateReq.ResolvePath(&user)
+	if err != nil {
+		return nil, "", nil, wrapAPIError(err, "", http.StatusBadRequest)
+	}
+	// fsmeta is only available for the object storages translated to bucket keys
+	if resp.Key == "" {
+		return nil, "", nil, wrapAPIError(translate.ErrFileSystemNotSupported, "", http.StatusBadRequest)
+	}
+	fs, err := user.GetFilesystem("")
+	if err != nil {
+		return nil, "", nil, wrapAPIError(err, "Unable to create the user filesystem", http.StatusInternalServerError)
+	}
+	inspector, ok := fs.(vfs.FSMetaInspector)
+	if !ok {
+		fs.Close()
+		return nil, "", nil, wrapAPIError(errors.New("fsmeta inspection is not supported for this filesystem"), "",
+			http.StatusBadRequest)
+	}
+	return inspector, strings.TrimPrefix(resp.Key, "/"), func() { fs.Close() }, nil
+}
+
+func sendFSMetaError(w http.ResponseWriter, r *http.Request, err error) {
+	var apiErr apiError
+	switch {
+	case errors.As(err, &apiErr):
+		sendAPIResponse(w, r, apiErr.err, apiErr.msg, apiErr.status)
+	case errors.Is(err, fsmeta.ErrNotEnabled):
+		sendAPIResponse(w, r, err, "", http.StatusBadRequest)
+	default:
+		sendAPIResponse(w, r, err, "", http.StatusInternalServerError)
+	}
+}
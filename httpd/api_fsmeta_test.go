@@ -0,0 +1,45 @@
+package httpd_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/drakkan/sftpgo/httpdtest"
+)
+
+func TestReconcileFSMeta(t *testing.T) {
+	user, _, err := httpdtest.AddUser(getTestUser(), http.StatusCreated)
+	assert.NoError(t, err)
+
+	_, err = httpdtest.ReconcileFSMeta(user.Username, "/", true, http.StatusBadRequest)
+	assert.Equal(t, httpdtest.APIError{Err: `fsmeta reconcile is not supported for this filesystem`}, err)
+
+	_, err = httpdtest.ReconcileFSMeta(user.Username+"1", "/", true, http.StatusNotFound)
+	assert.Error(t, err)
+
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+}
+
+func TestInspectFSMeta(t *testing.T) {
+	user, _, err := httpdtest.AddUser(getTestUser(), http.StatusCreated)
+	assert.NoError(t, err)
+
+	_, err = httpdtest.GetFSMeta(user.Username, "/file.csv", http.StatusBadRequest)
+	assert.Equal(t, httpdtest.APIError{Err: `filesystem is not supported`}, err)
+	_, err = httpdtest.RefreshFSMeta(user.Username, "/file.csv", http.StatusBadRequest)
+	assert.Equal(t, httpdtest.APIError{Err: `filesystem is not supported`}, err)
+	err = httpdtest.DeleteFSMeta(user.Username, "/file.csv", http.StatusBadRequest)
+	assert.Equal(t, httpdtest.APIError{Err: `filesystem is not supported`}, err)
+
+	_, err = httpdtest.GetFSMeta(user.Username, "", http.StatusBadRequest)
+	assert.Equal(t, httpdtest.APIError{Err: `filepath is required`}, err)
+
+	_, err = httpdtest.GetFSMeta(user.Username+"1", "/file.csv", http.StatusNotFound)
+	assert.Error(t, err)
+
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+}
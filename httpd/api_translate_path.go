@@ -9,17 +9,31 @@ import (
 	"github.com/drakkan/sftpgo/common"
 	"github.com/drakkan/sftpgo/dataprovider"
 	"github.com/drakkan/sftpgo/httpd/translate"
+	"github.com/drakkan/sftpgo/logger"
+	"github.com/drakkan/sftpgo/utils"
+	"github.com/drakkan/sftpgo/vfs"
 )
 
 func postTranslatePath(w http.ResponseWriter, r *http.Request) {
-	resp, err := handleTranslateRequest(r)
+	req, user, err := getTranslateRequest(r)
 	if err != nil {
-		var apiErr apiError
-		if errors.As(err, &apiErr) {
-			sendAPIResponse(w, r, apiErr.err, apiErr.msg, apiErr.status)
-		} else {
-			sendAPIResponse(w, r, err, "", http.StatusBadRequest)
+		sendTranslateError(w, r, err)
+		return
+	}
+
+	if req.IsBatch() {
+		resp, err := resolveTranslateBatch(&req, user)
+		if err != nil {
+			sendTranslateError(w, r, err)
+			return
 		}
+		render.JSON(w, r, resp)
+		return
+	}
+
+	resp, err := resolveTranslatePath(&req, user)
+	if err != nil {
+		sendTranslateError(w, r, err)
 		return
 	}
 
@@ -27,27 +41,124 @@ func postTranslatePath(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleTranslateRequest(r *http.Request) (translate.Response, error) {
+	req, user, err := getTranslateRequest(r)
+	if err != nil {
+		return translate.Response{}, err
+	}
+	if req.IsBatch() {
+		return translate.Response{}, wrapAPIError(errors.New("filepaths are not supported"), "", http.StatusBadRequest)
+	}
+
+	return resolveTranslatePath(&req, user)
+}
+
+func getTranslateRequest(r *http.Request) (translate.Request, dataprovider.User, error) {
 	var req translate.Request
 	if err := render.DecodeJSON(r.Body, &req); err != nil {
-		return translate.Response{}, wrapAPIError(err, "", http.StatusBadRequest)
+		return req, dataprovider.User{}, wrapAPIError(err, "", http.StatusBadRequest)
 	}
 
 	if err := req.Validate(); err != nil {
-		return translate.Response{}, wrapAPIError(err, "", http.StatusBadRequest)
+		return req, dataprovider.User{}, wrapAPIError(err, "", http.StatusBadRequest)
+	}
+	// the presigned transfers go directly to the storage backend
+	if req.Presign == translate.PresignPut && common.Config.HasUploadChecks() {
+		return req, dataprovider.User{}, wrapAPIError(translate.ErrPresignPutNotAllowed, "", http.StatusForbidden)
+	}
+	if req.Presign == translate.PresignGet && common.Config.HasDownloadChecks() {
+		return req, dataprovider.User{}, wrapAPIError(translate.ErrPresignGetNotAllowed, "", http.StatusForbidden)
+	}
+	req.IsPathReserved = common.Config.UploadScan.IsReservedPath
+
+	claims, err := getTokenClaims(r)
+	if err != nil || claims.Username == "" {
+		return req, dataprovider.User{}, wrapAPIError(err, "Invalid token claims", http.StatusBadRequest)
 	}
 
-	user, err := dataprovider.CheckUserAndPass(req.Username, req.Password, ``, common.ProtocolSSH)
+	var user dataprovider.User
+	if req.Password == "" {
+		// admins allowed to translate any path don't need the user password
+		if !claims.hasPerm(dataprovider.PermAdminTranslatePaths) {
+			return req, user, wrapAPIError(translate.ErrPasswordRequired, "", http.StatusBadRequest)
+		}
+		user, err = dataprovider.UserExists(req.Username)
+	} else {
+		user, err = dataprovider.CheckUserAndPass(req.Username, req.Password, ``, common.ProtocolSSH)
+	}
 	if err != nil {
 		if errors.Is(err, dataprovider.ErrInvalidCredentials) {
-			return translate.Response{}, wrapAPIError(err, "Access Denied", 403)
+			return req, user, wrapAPIError(err, "Access Denied", 403)
 		}
-		return translate.Response{}, wrapAPIError(err, "", getRespStatus(err))
+		return req, user, wrapAPIError(err, "", getRespStatus(err))
+	}
+
+	filePaths := req.FilePaths
+	if !req.IsBatch() {
+		filePaths = []string{req.FilePath}
 	}
+	logger.AuditLog("translate_path", claims.Username, user.Username, utils.GetIPFromRemoteAddress(r.RemoteAddr),
+		filePaths)
+
+	return req, user, nil
+}
 
-	resp, err := req.ResolvePath(user.FsConfig)
+func resolveTranslatePath(req *translate.Request, user dataprovider.User) (translate.Response, error) {
+	resp, err := req.ResolvePath(&user)
 	if err != nil {
 		return translate.Response{}, wrapAPIError(err, "", http.StatusBadRequest)
 	}
+	if !req.NeedsFilesystem() {
+		return resp, nil
+	}
+
+	fs, err := getTranslateFilesystem(user)
+	if err != nil {
+		return translate.Response{}, err
+	}
+	defer fs.Close()
+
+	if err := req.PresignURL(&user, fs, &resp); err != nil {
+		if errors.Is(err, translate.ErrPresignDenied) || errors.Is(err, translate.ErrPresignPutNotAllowed) {
+			return translate.Response{}, wrapAPIError(err, "", http.StatusForbidden)
+		}
+		return translate.Response{}, wrapAPIError(err, "", http.StatusBadRequest)
+	}
+
+	return resp, nil
+}
+
+func resolveTranslateBatch(req *translate.Request, user dataprovider.User) (translate.BatchResponse, error) {
+	var fs vfs.Fs
+	if req.NeedsFilesystem() {
+		var err error
+		fs, err = getTranslateFilesystem(user)
+		if err != nil {
+			return translate.BatchResponse{}, err
+		}
+		defer fs.Close()
+	}
+
+	resp, err := req.ResolveBatch(&user, fs)
+	if err != nil {
+		return translate.BatchResponse{}, wrapAPIError(err, "", http.StatusBadRequest)
+	}
 
 	return resp, nil
 }
+
+func getTranslateFilesystem(user dataprovider.User) (vfs.Fs, error) {
+	fs, err := user.GetFilesystem("")
+	if err != nil {
+		return nil, wrapAPIError(err, "Unable to create the user filesystem", http.StatusInternalServerError)
+	}
+	return fs, nil
+}
+
+func sendTranslateError(w http.ResponseWriter, r *http.Request, err error) {
+	var apiErr apiError
+	if errors.As(err, &apiErr) {
+		sendAPIResponse(w, r, apiErr.err, apiErr.msg, apiErr.status)
+	} else {
+		sendAPIResponse(w, r, err, "", http.StatusBadRequest)
+	}
+}
@@ -2,13 +2,19 @@ package httpd_test
 
 import (
 	"net/http"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/drakkan/sftpgo/common"
 	"github.com/drakkan/sftpgo/dataprovider"
 	"github.com/drakkan/sftpgo/httpd/translate"
 	"github.com/drakkan/sftpgo/httpdtest"
+	"github.com/drakkan/sftpgo/kms"
+	"github.com/drakkan/sftpgo/utils"
 	"github.com/drakkan/sftpgo/vfs"
 )
 
@@ -81,3 +87,276 @@ func TestTranslatePath(t *testing.T) {
 	_, err = httpdtest.RemoveUser(user, http.StatusOK)
 	assert.NoError(t, err)
 }
+
+func TestTranslatePathBatch(t *testing.T) {
+	basicUser := getTestUser()
+	basicUser.FsConfig.Provider = dataprovider.S3FilesystemProvider
+	basicUser.FsConfig.S3Config = vfs.S3FsConfig{
+		Region:       `local`,
+		Bucket:       `bucket1`,
+		KeyPrefix:    `users/test1/`,
+		Endpoint:     `http://127.0.0.1:9000`,
+		AccessKey:    `access-key`,
+		AccessSecret: kms.NewPlainSecret(`access-secret`),
+	}
+
+	user, _, err := httpdtest.AddUser(basicUser, http.StatusCreated)
+	assert.NoError(t, err)
+
+	translated, err := httpdtest.TranslatePaths(translate.Request{
+		Username:  defaultUsername,
+		Password:  defaultPassword,
+		FilePaths: []string{`a.csv`, `/dir/b.csv`, `/`},
+	}, http.StatusOK)
+	assert.NoError(t, err)
+	if assert.Len(t, translated.Items, 3) {
+		assert.Equal(t, translate.BatchItem{
+			FilePath: `a.csv`,
+			Response: translate.Response{
+				Provider: `s3`,
+				Region:   `local`,
+				Bucket:   `bucket1`,
+				Key:      `/users/test1/a.csv`,
+			},
+		}, translated.Items[0])
+		assert.Equal(t, `/users/test1/dir/b.csv`, translated.Items[1].Key)
+		assert.Equal(t, `/`, translated.Items[2].FilePath)
+		assert.Equal(t, `filepath is invalid`, translated.Items[2].Error)
+	}
+
+	// presigned URLs are computed locally
+	translated, err = httpdtest.TranslatePaths(translate.Request{
+		Username:          defaultUsername,
+		Password:          defaultPassword,
+		FilePaths:         []string{`a.csv`},
+		Presign:           translate.PresignPut,
+		PresignExpiration: 120,
+	}, http.StatusOK)
+	assert.NoError(t, err)
+	if assert.Len(t, translated.Items, 1) {
+		assert.Contains(t, translated.Items[0].URL, `http://127.0.0.1:9000/bucket1/users/test1/a.csv?`)
+		assert.Contains(t, translated.Items[0].URL, `X-Amz-Expires=120`)
+		assert.Greater(t, translated.Items[0].URLExpiresAt, utils.GetTimeAsMsSinceEpoch(time.Now()))
+	}
+	single, err := httpdtest.TranslatePath(translate.Request{
+		Username: defaultUsername,
+		Password: defaultPassword,
+		FilePath: `a.csv`,
+		Presign:  translate.PresignGet,
+	}, http.StatusOK)
+	assert.NoError(t, err)
+	assert.Equal(t, `/users/test1/a.csv`, single.Key)
+	assert.Contains(t, single.URL, `X-Amz-Expires=900`)
+
+	// validation exceptions
+	_, err = httpdtest.TranslatePath(translate.Request{
+		Username: defaultUsername,
+		Password: defaultPassword,
+		FilePath: `/dir/*.csv`,
+	}, http.StatusBadRequest)
+	assert.Equal(t, httpdtest.APIError{Err: `globs and prefix mode require filepaths`}, err)
+	_, err = httpdtest.TranslatePaths(translate.Request{
+		Username:  defaultUsername,
+		Password:  defaultPassword,
+		FilePaths: []string{`a.csv`},
+		Presign:   `post`,
+	}, http.StatusBadRequest)
+	assert.Equal(t, httpdtest.APIError{Err: `presign must be "get" or "put"`}, err)
+	// the deprecated S3 API translates a single path only
+	_, err = httpdtest.UsersS3Translate(translate.Request{
+		Username:  defaultUsername,
+		Password:  defaultPassword,
+		FilePaths: []string{`a.csv`},
+	}, http.StatusBadRequest)
+	assert.Error(t, err)
+
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+}
+
+func TestTranslatePathAdminAuth(t *testing.T) {
+	basicUser := getTestUser()
+	// users with public keys only can be translated by admins
+	basicUser.Password = ``
+	basicUser.PublicKeys = []string{testPubKey}
+	basicUser.FsConfig.Provider = dataprovider.GCSFilesystemProvider
+	basicUser.FsConfig.GCSConfig = vfs.GCSFsConfig{
+		Bucket:               `bucket1`,
+		KeyPrefix:            `users/test1`,
+		AutomaticCredentials: 1,
+	}
+
+	user, _, err := httpdtest.AddUser(basicUser, http.StatusCreated)
+	assert.NoError(t, err)
+
+	translated, err := httpdtest.TranslatePath(translate.Request{
+		Username: defaultUsername,
+		FilePath: `test.txt`,
+	}, http.StatusOK)
+	assert.NoError(t, err)
+	assert.Equal(t, `/users/test1/test.txt`, translated.Key)
+
+	_, err = httpdtest.TranslatePath(translate.Request{
+		Username: defaultUsername + `1`,
+		FilePath: `test.txt`,
+	}, http.StatusNotFound)
+	assert.Error(t, err)
+
+	a := getTestAdmin()
+	a.Username = altAdminUsername
+	a.Password = altAdminPassword
+	a.Permissions = []string{dataprovider.PermAdminViewUsers}
+	admin, _, err := httpdtest.AddAdmin(a, http.StatusCreated)
+	assert.NoError(t, err)
+
+	token, _, err := httpdtest.GetToken(altAdminUsername, altAdminPassword)
+	assert.NoError(t, err)
+	httpdtest.SetJWTToken(token)
+	_, err = httpdtest.TranslatePath(translate.Request{
+		Username: defaultUsername,
+		FilePath: `test.txt`,
+	}, http.StatusBadRequest)
+	assert.Equal(t, httpdtest.APIError{Err: `password is required`}, err)
+	httpdtest.SetJWTToken(``)
+
+	admin.Password = altAdminPassword
+	admin.Permissions = []string{dataprovider.PermAdminViewUsers, dataprovider.PermAdminTranslatePaths}
+	_, _, err = httpdtest.UpdateAdmin(admin, http.StatusOK)
+	assert.NoError(t, err)
+	token, _, err = httpdtest.GetToken(altAdminUsername, altAdminPassword)
+	assert.NoError(t, err)
+	httpdtest.SetJWTToken(token)
+	batch, err := httpdtest.TranslatePaths(translate.Request{
+		Username:  defaultUsername,
+		FilePaths: []string{`a.txt`, `b.txt`},
+	}, http.StatusOK)
+	assert.NoError(t, err)
+	if assert.Len(t, batch.Items, 2) {
+		assert.Equal(t, `/users/test1/b.txt`, batch.Items[1].Key)
+	}
+	httpdtest.SetJWTToken(``)
+
+	_, err = httpdtest.RemoveAdmin(admin, http.StatusOK)
+	assert.NoError(t, err)
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+}
+
+func TestTranslatePathLocalVirtualFolder(t *testing.T) {
+	u := getTestUser()
+	mappedPath := filepath.Join(os.TempDir(), "translate_mapped_path")
+	folderName := filepath.Base(mappedPath)
+	u.VirtualFolders = append(u.VirtualFolders, vfs.VirtualFolder{
+		BaseVirtualFolder: vfs.BaseVirtualFolder{
+			Name:       folderName,
+			MappedPath: mappedPath,
+		},
+		VirtualPath: "/vdir",
+	})
+	user, _, err := httpdtest.AddUser(u, http.StatusCreated)
+	assert.NoError(t, err)
+
+	translated, err := httpdtest.TranslatePaths(translate.Request{
+		Username:  defaultUsername,
+		Password:  defaultPassword,
+		FilePaths: []string{`/dir/a.csv`, `/vdir/b.csv`},
+	}, http.StatusOK)
+	assert.NoError(t, err)
+	if assert.Len(t, translated.Items, 2) {
+		assert.Equal(t, translate.Response{
+			Provider: `local`,
+			Path:     filepath.Join(user.GetHomeDir(), `dir`, `a.csv`),
+		}, translated.Items[0].Response)
+		assert.Equal(t, translate.Response{
+			Provider:      `local`,
+			Path:          filepath.Join(mappedPath, `b.csv`),
+			VirtualFolder: folderName,
+		}, translated.Items[1].Response)
+	}
+	// only the object storages support presigned URLs
+	_, err = httpdtest.TranslatePath(translate.Request{
+		Username: defaultUsername,
+		Password: defaultPassword,
+		FilePath: `/vdir/b.csv`,
+		Presign:  translate.PresignGet,
+	}, http.StatusBadRequest)
+	assert.Equal(t, httpdtest.APIError{Err: translate.ErrPresignNotSupported.Error()}, err)
+
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+	_, err = httpdtest.RemoveFolder(vfs.BaseVirtualFolder{Name: folderName}, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.RemoveAll(user.GetHomeDir())
+	assert.NoError(t, err)
+}
+
+func TestTranslatePathPresignPermissions(t *testing.T) {
+	basicUser := getTestUser()
+	basicUser.Permissions = map[string][]string{
+		`/`: {dataprovider.PermListItems, dataprovider.PermDownload},
+	}
+	basicUser.FsConfig.Provider = dataprovider.S3FilesystemProvider
+	basicUser.FsConfig.S3Config = vfs.S3FsConfig{
+		Region:       `local`,
+		Bucket:       `bucket1`,
+		KeyPrefix:    `users/test1/`,
+		Endpoint:     `http://127.0.0.1:9000`,
+		AccessKey:    `access-key`,
+		AccessSecret: kms.NewPlainSecret(`access-secret`),
+	}
+
+	user, _, err := httpdtest.AddUser(basicUser, http.StatusCreated)
+	assert.NoError(t, err)
+
+	single, err := httpdtest.TranslatePath(translate.Request{
+		Username: defaultUsername,
+		Password: defaultPassword,
+		FilePath: `a.csv`,
+		Presign:  translate.PresignGet,
+	}, http.StatusOK)
+	assert.NoError(t, err)
+	assert.Contains(t, single.URL, `http://127.0.0.1:9000/bucket1/users/test1/a.csv?`)
+	// a download only user cannot get an upload URL
+	_, err = httpdtest.TranslatePath(translate.Request{
+		Username: defaultUsername,
+		Password: defaultPassword,
+		FilePath: `a.csv`,
+		Presign:  translate.PresignPut,
+	}, http.StatusForbidden)
+	assert.Equal(t, httpdtest.APIError{Err: translate.ErrPresignDenied.Error()}, err)
+	translated, err := httpdtest.TranslatePaths(translate.Request{
+		Username:  defaultUsername,
+		Password:  defaultPassword,
+		FilePaths: []string{`a.csv`},
+		Presign:   translate.PresignPut,
+	}, http.StatusOK)
+	assert.NoError(t, err)
+	if assert.Len(t, translated.Items, 1) {
+		assert.Empty(t, translated.Items[0].URL)
+		assert.Equal(t, translate.ErrPresignDenied.Error(), translated.Items[0].Error)
+	}
+	// the uploads checked by SFTPGo cannot be presigned
+	user.Permissions[`/`] = []string{dataprovider.PermAny}
+	_, _, err = httpdtest.UpdateUser(user, http.StatusOK, ``)
+	assert.NoError(t, err)
+	oldExecuteOn := common.Config.Actions.ExecuteOn
+	common.Config.Actions.ExecuteOn = []string{`pre-upload`}
+	_, err = httpdtest.TranslatePath(translate.Request{
+		Username: defaultUsername,
+		Password: defaultPassword,
+		FilePath: `a.csv`,
+		Presign:  translate.PresignPut,
+	}, http.StatusForbidden)
+	assert.Equal(t, httpdtest.APIError{Err: translate.ErrPresignPutNotAllowed.Error()}, err)
+	common.Config.Actions.ExecuteOn = oldExecuteOn
+	_, err = httpdtest.TranslatePath(translate.Request{
+		Username: defaultUsername,
+		Password: defaultPassword,
+		FilePath: `a.csv`,
+		Presign:  translate.PresignPut,
+	}, http.StatusOK)
+	assert.NoError(t, err)
+
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+}
@@ -1,7 +1,6 @@
 package httpd
 
 import (
-	"errors"
 	"net/http"
 
 	"github.com/go-chi/render"
@@ -15,12 +14,7 @@ import (
 func userS3Translate(w http.ResponseWriter, r *http.Request) {
 	resp, err := handleTranslateRequest(r)
 	if err != nil {
-		var apiErr apiError
-		if errors.As(err, &apiErr) {
-			sendAPIResponse(w, r, apiErr.err, apiErr.msg, apiErr.status)
-		} else {
-			sendAPIResponse(w, r, err, "", http.StatusBadRequest)
-		}
+		sendTranslateError(w, r, err)
 		return
 	}
 
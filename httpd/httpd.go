@@ -48,6 +48,11 @@ const (
 	defenderScore             = "/api/v2/defender/score"
 	adminPath                 = "/api/v2/admins"
 	adminPwdPath              = "/api/v2/changepwd/admin"
+	fsmetaPath                = "/api/v2/fsmeta"
+	fsmetaRefreshPath         = "/api/v2/fsmeta/refresh"
+	fsmetaReconcilePath       = "/api/v2/fsmeta/reconcile"
+	actionDeliveriesPath      = "/api/v2/action-deliveries"
+	actionDeliveriesRetryPath = "/api/v2/action-deliveries/retry"
 	healthzPath               = "/healthz"
 	webBasePath               = "/web"
 	webLoginPath              = "/web/login"
@@ -505,6 +505,28 @@ func TestAddUserInvalidFilters(t *testing.T) {
 	_, _, err = httpdtest.AddUser(u, http.StatusBadRequest)
 	assert.NoError(t, err)
 	u.Filters.DeniedLoginMethods = []string{}
+	u.Filters.FolderPrefix = "relative/files"
+	_, _, err = httpdtest.AddUser(u, http.StatusBadRequest)
+	assert.NoError(t, err)
+	u.Filters.FolderMappings = []dataprovider.FolderMapping{{Prefix: "/inbound", MappedPath: "/in"}}
+	u.Filters.FolderPrefix = "/files"
+	_, _, err = httpdtest.AddUser(u, http.StatusBadRequest)
+	assert.NoError(t, err)
+	u.Filters.FolderPrefix = ""
+	u.Filters.FolderMappings = append(u.Filters.FolderMappings, dataprovider.FolderMapping{
+		Prefix:     "/inbound/acme",
+		MappedPath: "/acme",
+	})
+	_, _, err = httpdtest.AddUser(u, http.StatusBadRequest)
+	assert.NoError(t, err)
+	u.Filters.FolderMappings = []dataprovider.FolderMapping{{Prefix: "/inbound", MappedPath: "in"}}
+	_, _, err = httpdtest.AddUser(u, http.StatusBadRequest)
+	assert.NoError(t, err)
+	u.Filters.FolderMappings = nil
+	u.Filters.LoginDir = "relative/dir"
+	_, _, err = httpdtest.AddUser(u, http.StatusBadRequest)
+	assert.NoError(t, err)
+	u.Filters.LoginDir = ""
 	u.Filters.FileExtensions = []dataprovider.ExtensionsFilter{
 		{
 			Path:              "relative",
@@ -4626,6 +4648,8 @@ func TestWebUserAddMock(t *testing.T) {
 	form.Set("denied_extensions", "/dir2::.webp,.webp\n/dir2::.tiff\n/dir1::.zip")
 	form.Set("allowed_patterns", "/dir2::*.jpg,*.png\n/dir1::*.png")
 	form.Set("denied_patterns", "/dir1::*.zip\n/dir3::*.rar\n/dir2::*.mkv")
+	form.Set("folder_mappings", " /outbound :: /out \n/inbound::/in\ninvalid")
+	form.Set("login_dir", " /in/acme/ ")
 	form.Set("additional_info", user.AdditionalInfo)
 	b, contentType, _ := getMultipartFormData(form, "", "")
 	// test invalid url escape
@@ -4808,6 +4832,11 @@ func TestWebUserAddMock(t *testing.T) {
 			assert.True(t, utils.IsStringInSlice(".tiff", filter.DeniedExtensions))
 		}
 	}
+	assert.Equal(t, []dataprovider.FolderMapping{
+		{Prefix: "/outbound", MappedPath: "/out"},
+		{Prefix: "/inbound", MappedPath: "/in"},
+	}, newUser.Filters.FolderMappings)
+	assert.Equal(t, "/in/acme", newUser.Filters.LoginDir)
 	assert.Len(t, newUser.Filters.FilePatterns, 3)
 	for _, filter := range newUser.Filters.FilePatterns {
 		if filter.Path == "/dir1" {
@@ -323,6 +323,16 @@ func (s *httpdServer) initializeRouter() {
 			router.With(checkPerm(dataprovider.PermAdminManageSystem)).Get(dumpDataPath, dumpData)
 			router.With(checkPerm(dataprovider.PermAdminManageSystem)).Get(loadDataPath, loadData)
 			router.With(checkPerm(dataprovider.PermAdminManageSystem)).Post(loadDataPath, loadDataFromRequest)
+			router.With(checkPerm(dataprovider.PermAdminManageSystem)).Post(fsmetaReconcilePath, reconcileFSMeta)
+			router.With(checkPerm(dataprovider.PermAdminViewUsers)).Get(fsmetaPath, getFSMeta)
+			router.With(checkPerm(dataprovider.PermAdminManageSystem)).Post(fsmetaRefreshPath, refreshFSMeta)
+			router.With(checkPerm(dataprovider.PermAdminManageSystem)).Delete(fsmetaPath, deleteFSMeta)
+			router.With(checkPerm(dataprovider.PermAdminManageSystem)).Get(actionDeliveriesPath, getActionDeliveries)
+			router.With(checkPerm(dataprovider.PermAdminManageSystem)).Delete(actionDeliveriesPath, purgeFailedActionDeliveries)
+			router.With(checkPerm(dataprovider.PermAdminManageSystem)).Post(actionDeliveriesRetryPath, retryFailedActionDeliveries)
+			router.With(checkPerm(dataprovider.PermAdminManageSystem)).Get(actionDeliveriesPath+"/{id}", getActionDeliveryByID)
+			router.With(checkPerm(dataprovider.PermAdminManageSystem)).Delete(actionDeliveriesPath+"/{id}", deleteActionDelivery)
+			router.With(checkPerm(dataprovider.PermAdminManageSystem)).Post(actionDeliveriesPath+"/{id}/retry", retryActionDelivery)
 			router.With(checkPerm(dataprovider.PermAdminChangeUsers)).Put(updateUsedQuotaPath, updateUserQuotaUsage)
 			router.With(checkPerm(dataprovider.PermAdminChangeUsers)).Put(updateFolderUsedQuotaPath, updateVFolderQuotaUsage)
 			router.With(checkPerm(dataprovider.PermAdminViewDefender)).Get(defenderBanTime, getBanTime)
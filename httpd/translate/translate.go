@@ -2,10 +2,32 @@ package translate
 
 import (
 	"errors"
+	"net/http"
+	"os"
 	"path"
+	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/drakkan/sftpgo/dataprovider"
+	"github.com/drakkan/sftpgo/utils"
+	"github.com/drakkan/sftpgo/vfs"
+)
+
+const (
+	// ModePrefix lists the objects below the requested virtual directories
+	ModePrefix = `prefix`
+	// PresignGet adds a download URL to the translated paths
+	PresignGet = `get`
+	// PresignPut adds an upload URL to the translated paths
+	PresignPut = `put`
+	// MaxFilePaths is the maximum number of paths for a single request
+	MaxFilePaths = 10000
+	// DefaultPresignExpiration is the default presigned URLs validity as seconds
+	DefaultPresignExpiration = 900
+	// MaxPresignExpiration is the maximum presigned URLs validity as seconds
+	MaxPresignExpiration = 604800
 )
 
 var (
@@ -15,21 +37,70 @@ var (
 	ErrFilePathInvalid        = errors.New(`filepath is invalid`)
 	ErrFileSystemNotS3        = errors.New(`filesystem is not s3`)
 	ErrFileSystemNotSupported = errors.New(`filesystem is not supported`)
+	ErrTooManyFilePaths       = errors.New(`too many filepaths`)
+	ErrFilePathsRequired      = errors.New(`globs and prefix mode require filepaths`)
+	ErrGlobInvalid            = errors.New(`globs are only supported in the last path element`)
+	ErrModeInvalid            = errors.New(`mode is invalid`)
+	ErrPresignInvalid         = errors.New(`presign must be "get" or "put"`)
+	ErrPresignExpiration      = errors.New(`presign_expiration is invalid`)
+	ErrPresignNotSupported    = errors.New(`presigned URLs are not supported for this filesystem`)
+	ErrPresignDenied          = errors.New(`presigned URL not allowed: permission denied`)
+	ErrPresignPutNotAllowed   = errors.New(`presigned upload URLs are not allowed: the uploads must be checked by SFTPGo`)
+	ErrPresignGetNotAllowed   = errors.New(`presigned download URLs are not allowed: the downloads must be checked by SFTPGo`)
 )
 
 type (
 	Request struct {
 		Username string `json:"username"`
+		// Password can be empty for the admins with the translate_paths permission
 		Password string `json:"password"`
 		FilePath string `json:"filepath"`
+		// FilePaths translates multiple paths at once. A path can contain shell like
+		// patterns in its last element to translate the matching files
+		FilePaths []string `json:"filepaths,omitempty"`
+		// Mode "prefix" translates the files below each requested directory
+		Mode string `json:"mode,omitempty"`
+		// Presign, "get" or "put", adds a time-limited URL to the translated paths
+		Presign string `json:"presign,omitempty"`
+		// PresignExpiration is the URLs validity as seconds
+		PresignExpiration int `json:"presign_expiration,omitempty"`
+		// IsPathReserved, if set, returns true for the virtual paths the clients
+		// cannot access, they are not listed and they cannot be presigned
+		IsPathReserved func(virtualPath string) bool `json:"-"`
 	}
 
 	Response struct {
 		RawProvider dataprovider.FilesystemProvider `json:"-"`
 		Provider    string                          `json:"provider"`
 		Region      string                          `json:"region,omitempty"`
-		Bucket      string                          `json:"bucket"`
-		Key         string                          `json:"key"`
+		Bucket      string                          `json:"bucket,omitempty"`
+		Key         string                          `json:"key,omitempty"`
+		// Container and Blob are set for Azure Blob storage
+		Container string `json:"container,omitempty"`
+		Blob      string `json:"blob,omitempty"`
+		// Endpoint is the remote server for SFTP
+		Endpoint string `json:"endpoint,omitempty"`
+		// Path is the absolute path for the local providers and the remote path for SFTP
+		Path string `json:"path,omitempty"`
+		// Encrypted is true for the local-encrypted provider
+		Encrypted bool `json:"encrypted,omitempty"`
+		// VirtualFolder is the name of the virtual folder containing the path, if any
+		VirtualFolder string `json:"virtual_folder,omitempty"`
+		URL           string `json:"url,omitempty"`
+		// URLExpiresAt is the URL expiration as milliseconds since epoch
+		URLExpiresAt int64 `json:"url_expires_at,omitempty"`
+	}
+
+	// BatchItem is the translation for a single path, globs and prefix mode
+	// directories expand to one item for each listed file
+	BatchItem struct {
+		FilePath string `json:"filepath"`
+		Response
+		Error string `json:"error,omitempty"`
+	}
+
+	BatchResponse struct {
+		Items []BatchItem `json:"items"`
 	}
 )
 
@@ -41,8 +112,11 @@ func (req *Request) Validate() error {
 	if req.Username == `` {
 		return ErrUsernameRequired
 	}
-	if req.Password == `` {
-		return ErrPasswordRequired
+	if err := req.validatePresign(); err != nil {
+		return err
+	}
+	if req.IsBatch() {
+		return req.validateBatch()
 	}
 	if req.FilePath == `` {
 		return ErrFilePathRequired
@@ -50,62 +124,360 @@ func (req *Request) Validate() error {
 	if req.FilePath == `/` || req.FilePath == `.` {
 		return ErrFilePathInvalid
 	}
+	if req.Mode != `` || hasGlob(req.FilePath) {
+		return ErrFilePathsRequired
+	}
+
+	return nil
+}
+
+func (req *Request) validatePresign() error {
+	req.Presign = strings.ToLower(strings.TrimSpace(req.Presign))
+	switch req.Presign {
+	case ``:
+		return nil
+	case PresignGet, PresignPut:
+	default:
+		return ErrPresignInvalid
+	}
+	if req.PresignExpiration == 0 {
+		req.PresignExpiration = DefaultPresignExpiration
+	}
+	if req.PresignExpiration < 0 || req.PresignExpiration > MaxPresignExpiration {
+		return ErrPresignExpiration
+	}
+	return nil
+}
+
+func (req *Request) validateBatch() error {
+	if len(req.FilePaths) > MaxFilePaths {
+		return ErrTooManyFilePaths
+	}
+	if req.Mode != `` && req.Mode != ModePrefix {
+		return ErrModeInvalid
+	}
+	for idx := range req.FilePaths {
+		req.FilePaths[idx] = strings.TrimSpace(req.FilePaths[idx])
+	}
+	return nil
+}
+
+// IsBatch returns true if the request translates multiple paths
+func (req *Request) IsBatch() bool {
+	return len(req.FilePaths) > 0
+}
+
+// NeedsFilesystem returns true if the user filesystem is required to list the
+// files or to presign the URLs
+func (req *Request) NeedsFilesystem() bool {
+	if req.Presign != `` || req.Mode == ModePrefix {
+		return true
+	}
+	for _, filePath := range req.FilePaths {
+		if hasGlob(filePath) {
+			return true
+		}
+	}
+	return false
+}
 
+// PresignURL adds the requested presigned URL to the given response. The request
+// path must be already resolved, the URL is presigned only if the user can download
+// or upload the requested file
+func (req *Request) PresignURL(user *dataprovider.User, fs vfs.Fs, resp *Response) error {
+	if req.Presign == `` {
+		return nil
+	}
+	// virtual folders are local directories, the user filesystem cannot sign them
+	if _, err := user.GetVirtualFolderForPath(req.FilePath); err == nil {
+		return ErrPresignNotSupported
+	}
+	presigner, ok := fs.(vfs.Presigner)
+	if !ok {
+		return ErrPresignNotSupported
+	}
+	fsPath, err := fs.ResolvePath(req.FilePath)
+	if err != nil {
+		return err
+	}
+	if err := req.checkPresignPermissions(user, fs, fsPath); err != nil {
+		return err
+	}
+	method := http.MethodGet
+	if req.Presign == PresignPut {
+		method = http.MethodPut
+	}
+	expiration := time.Duration(req.PresignExpiration) * time.Second
+	expiresAt := time.Now().Add(expiration)
+	url, err := presigner.PresignURL(fsPath, method, expiration)
+	if err != nil {
+		return err
+	}
+	resp.URL = url
+	resp.URLExpiresAt = utils.GetTimeAsMsSinceEpoch(expiresAt)
 	return nil
 }
 
-func (req *Request) ResolvePath(fs dataprovider.Filesystem) (Response, error) {
+// checkPresignPermissions returns an error if the user cannot download or upload the
+// request path. The presigned uploads bypass the quota and size restrictions, so
+// they are not allowed for the users having them
+func (req *Request) checkPresignPermissions(user *dataprovider.User, fs vfs.Fs, fsPath string) error {
+	if !user.IsFileAllowed(req.FilePath) || req.isPathReserved(req.FilePath) {
+		return ErrPresignDenied
+	}
+	if req.Presign == PresignGet {
+		if !user.HasPerm(dataprovider.PermDownload, path.Dir(req.FilePath)) {
+			return ErrPresignDenied
+		}
+		return nil
+	}
+	if !user.HasPerm(dataprovider.PermUpload, path.Dir(req.FilePath)) {
+		return ErrPresignDenied
+	}
+	if user.HasQuotaRestrictions() || user.Filters.MaxUploadFileSize > 0 {
+		return ErrPresignPutNotAllowed
+	}
+	if !user.HasPerm(dataprovider.PermOverwrite, path.Dir(req.FilePath)) {
+		_, err := fs.Stat(fsPath)
+		if err == nil {
+			return ErrPresignDenied
+		}
+		if !fs.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (req *Request) isPathReserved(virtualPath string) bool {
+	return req.IsPathReserved != nil && req.IsPathReserved(virtualPath)
+}
+
+// ResolveBatch translates the requested paths. The given filesystem is used to
+// expand globs and prefix mode directories and to presign the URLs, it can be
+// nil if NeedsFilesystem returns false. Errors for a single path are reported
+// within its item
+func (req *Request) ResolveBatch(user *dataprovider.User, fs vfs.Fs) (BatchResponse, error) {
+	if rawProviderToString(user.FsConfig.Provider) == `` {
+		return BatchResponse{}, ErrFileSystemNotSupported
+	}
+	resp := BatchResponse{Items: []BatchItem{}}
+	for _, filePath := range req.FilePaths {
+		var filePaths []string
+		var err error
+
+		switch {
+		case req.Mode == ModePrefix:
+			filePaths, err = listPrefix(fs, filePath, req.isPathReserved)
+		case hasGlob(filePath):
+			filePaths, err = listGlob(fs, filePath, req.isPathReserved)
+		default:
+			resp.Items = append(resp.Items, req.resolveItem(user, fs, filePath))
+			continue
+		}
+		if err != nil {
+			resp.Items = append(resp.Items, BatchItem{FilePath: filePath, Error: err.Error()})
+			continue
+		}
+		for _, p := range filePaths {
+			resp.Items = append(resp.Items, req.resolveItem(user, fs, p))
+		}
+	}
+	return resp, nil
+}
+
+func (req *Request) resolveItem(user *dataprovider.User, fs vfs.Fs, filePath string) BatchItem {
+	item := BatchItem{FilePath: filePath}
+	itemReq := Request{
+		FilePath:          filePath,
+		Presign:           req.Presign,
+		PresignExpiration: req.PresignExpiration,
+		IsPathReserved:    req.IsPathReserved,
+	}
+	var err error
+	switch filePath {
+	case ``:
+		err = ErrFilePathRequired
+	case `/`, `.`:
+		err = ErrFilePathInvalid
+	default:
+		item.Response, err = itemReq.ResolvePath(user)
+		if err == nil {
+			err = itemReq.PresignURL(user, fs, &item.Response)
+		}
+	}
+	if err != nil {
+		item.Response = Response{}
+		item.Error = err.Error()
+	}
+	return item
+}
+
+// listGlob returns the virtual paths for the files matching the given pattern
+func listGlob(fs vfs.Fs, pattern string, isReserved func(string) bool) ([]string, error) {
+	cleanPattern := path.Clean(`/` + pattern)
+	dir, name := path.Split(cleanPattern)
+	if hasGlob(dir) {
+		return nil, ErrGlobInvalid
+	}
+	if _, err := path.Match(name, ``); err != nil {
+		return nil, err
+	}
+	fsDir, err := fs.ResolvePath(dir)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := fs.ReadDir(fsDir)
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		filePath := path.Join(dir, info.Name())
+		if isReserved(filePath) {
+			continue
+		}
+		if matched, _ := path.Match(name, info.Name()); matched {
+			result = append(result, filePath)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// listPrefix returns the virtual paths for the files below the given directory
+func listPrefix(fs vfs.Fs, dir string, isReserved func(string) bool) ([]string, error) {
+	fsDir, err := fs.ResolvePath(path.Clean(`/` + dir))
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	err = fs.Walk(fsDir, func(walkedPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		virtualPath := fs.GetRelativePath(walkedPath)
+		if !info.IsDir() && !isReserved(virtualPath) {
+			result = append(result, virtualPath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func hasGlob(filePath string) bool {
+	return strings.ContainsAny(filePath, `*?[`)
+}
+
+// ResolvePath translates the request path for the given user. The paths inside
+// a virtual folder are resolved to the folder mapped path, the other ones based
+// on the user filesystem. Local paths are translated lexically, symlinks are
+// not followed
+func (req *Request) ResolvePath(user *dataprovider.User) (Response, error) {
+	virtualPath, err := req.cleanVirtualPath()
+	if err != nil {
+		return Response{}, err
+	}
+	req.FilePath = virtualPath
+	if folder, err := user.GetVirtualFolderForPath(virtualPath); err == nil {
+		return req.resolveVirtualFolderPath(folder)
+	}
+
+	fs := user.FsConfig
 	switch fs.Provider {
 	case dataprovider.S3FilesystemProvider:
 		return req.resolveS3Path(fs)
 	case dataprovider.GCSFilesystemProvider:
 		return req.resolveGCSPath(fs)
+	case dataprovider.AzureBlobFilesystemProvider:
+		return req.resolveAzurePath(fs)
+	case dataprovider.LocalFilesystemProvider, dataprovider.CryptedFilesystemProvider:
+		return req.resolveLocalPath(fs, user.GetHomeDir())
+	case dataprovider.SFTPFilesystemProvider:
+		return req.resolveSFTPPath(fs)
 	default:
 		return Response{}, ErrFileSystemNotSupported
 	}
 }
 
 func (req *Request) resolveS3Path(fs dataprovider.Filesystem) (Response, error) {
-	key, err := req.cleanKeyPath(fs.S3Config.KeyPrefix)
-	if err != nil {
-		return Response{}, err
-	}
-
 	return Response{
 		RawProvider: fs.Provider,
 		Provider:    rawProviderToString(fs.Provider),
 		Region:      fs.S3Config.Region,
 		Bucket:      fs.S3Config.Bucket,
-		Key:         key,
+		Key:         path.Join(`/`, fs.S3Config.KeyPrefix, req.FilePath),
 	}, nil
 }
 
 func (req *Request) resolveGCSPath(fs dataprovider.Filesystem) (Response, error) {
-	key, err := req.cleanKeyPath(fs.GCSConfig.KeyPrefix)
-	if err != nil {
-		return Response{}, err
-	}
-
 	return Response{
 		RawProvider: fs.Provider,
 		Provider:    rawProviderToString(fs.Provider),
 		Bucket:      fs.GCSConfig.Bucket,
-		Key:         key,
+		Key:         path.Join(`/`, fs.GCSConfig.KeyPrefix, req.FilePath),
+	}, nil
+}
+
+func (req *Request) resolveAzurePath(fs dataprovider.Filesystem) (Response, error) {
+	return Response{
+		RawProvider: fs.Provider,
+		Provider:    rawProviderToString(fs.Provider),
+		Container:   fs.AzBlobConfig.Container,
+		Blob:        strings.TrimPrefix(path.Join(`/`, fs.AzBlobConfig.KeyPrefix, req.FilePath), `/`),
+	}, nil
+}
+
+func (req *Request) resolveLocalPath(fs dataprovider.Filesystem, homeDir string) (Response, error) {
+	return Response{
+		RawProvider: fs.Provider,
+		Provider:    rawProviderToString(fs.Provider),
+		Path:        filepath.Join(homeDir, filepath.FromSlash(req.FilePath)),
+		Encrypted:   fs.Provider == dataprovider.CryptedFilesystemProvider,
 	}, nil
 }
 
-func (req *Request) cleanKeyPath(keyPrefix string) (string, error) {
-	if !path.IsAbs(req.FilePath) {
-		req.FilePath = path.Clean("/" + req.FilePath)
+func (req *Request) resolveSFTPPath(fs dataprovider.Filesystem) (Response, error) {
+	prefix := fs.SFTPConfig.Prefix
+	if prefix == `` {
+		prefix = `/`
 	}
+	return Response{
+		RawProvider: fs.Provider,
+		Provider:    rawProviderToString(fs.Provider),
+		Endpoint:    fs.SFTPConfig.Endpoint,
+		Path:        path.Join(prefix, req.FilePath),
+	}, nil
+}
 
-	// prevent path traversal outside of user's key prefix
-	key := path.Join("/", keyPrefix, req.FilePath)
-	if !strings.HasPrefix(key, path.Clean(`/`+keyPrefix)+`/`) {
-		return "", ErrFilePathInvalid
+func (req *Request) resolveVirtualFolderPath(folder vfs.VirtualFolder) (Response, error) {
+	relPath := strings.TrimPrefix(req.FilePath, folder.VirtualPath)
+	if relPath == `` {
+		return Response{}, ErrFilePathInvalid
 	}
+	return Response{
+		RawProvider:   dataprovider.LocalFilesystemProvider,
+		Provider:      rawProviderToString(dataprovider.LocalFilesystemProvider),
+		Path:          filepath.Join(folder.MappedPath, filepath.FromSlash(relPath)),
+		VirtualFolder: folder.Name,
+	}, nil
+}
 
-	return key, nil
+// cleanVirtualPath returns the cleaned request path. The paths trying to escape
+// the user root, and the root itself, are not valid
+func (req *Request) cleanVirtualPath() (string, error) {
+	relPath := path.Clean(strings.TrimLeft(req.FilePath, `/`))
+	if relPath == `.` || relPath == `..` || strings.HasPrefix(relPath, `../`) {
+		return ``, ErrFilePathInvalid
+	}
+	return `/` + relPath, nil
 }
 
 func rawProviderToString(fsProvider dataprovider.FilesystemProvider) string {
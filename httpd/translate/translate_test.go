@@ -1,9 +1,14 @@
 package translate
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/drakkan/sftpgo/dataprovider"
 	"github.com/drakkan/sftpgo/vfs"
@@ -13,7 +18,8 @@ func TestRequestValidation(t *testing.T) {
 	Req := Request{}
 	assert.Equal(t, ErrUsernameRequired, Req.Validate())
 	Req.Username = `user1`
-	assert.Equal(t, ErrPasswordRequired, Req.Validate())
+	// the password can be omitted by admins with the translate_paths permission
+	assert.Equal(t, ErrFilePathRequired, Req.Validate())
 	Req.Password = `pass1`
 	assert.Equal(t, ErrFilePathRequired, Req.Validate())
 	Req.FilePath = `/`
@@ -22,28 +28,219 @@ func TestRequestValidation(t *testing.T) {
 	assert.Nil(t, Req.Validate())
 }
 
+func TestBatchRequestValidation(t *testing.T) {
+	Req := Request{Username: `user1`, Password: `pass1`, FilePath: `/*.csv`}
+	assert.Equal(t, ErrFilePathsRequired, Req.Validate())
+	Req.FilePath = `/dir`
+	Req.Mode = ModePrefix
+	assert.Equal(t, ErrFilePathsRequired, Req.Validate())
+	Req.FilePath = ``
+	Req.FilePaths = []string{` /dir `}
+	assert.Nil(t, Req.Validate())
+	assert.Equal(t, []string{`/dir`}, Req.FilePaths)
+	assert.True(t, Req.IsBatch())
+	assert.True(t, Req.NeedsFilesystem())
+	Req.Mode = `invalid`
+	assert.Equal(t, ErrModeInvalid, Req.Validate())
+	Req.Mode = ``
+	assert.False(t, Req.NeedsFilesystem())
+	Req.FilePaths = make([]string, MaxFilePaths+1)
+	assert.Equal(t, ErrTooManyFilePaths, Req.Validate())
+
+	Req.FilePaths = []string{`/a.csv`}
+	Req.Presign = `delete`
+	assert.Equal(t, ErrPresignInvalid, Req.Validate())
+	Req.Presign = ` GET `
+	assert.Nil(t, Req.Validate())
+	assert.Equal(t, PresignGet, Req.Presign)
+	assert.Equal(t, DefaultPresignExpiration, Req.PresignExpiration)
+	assert.True(t, Req.NeedsFilesystem())
+	Req.PresignExpiration = MaxPresignExpiration + 1
+	assert.Equal(t, ErrPresignExpiration, Req.Validate())
+}
+
+func TestResolveBatch(t *testing.T) {
+	Root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(Root, `dir`, `sub`), os.ModePerm))
+	for _, Name := range []string{`a.csv`, `b.csv`, `c.txt`, filepath.Join(`sub`, `d.csv`)} {
+		require.NoError(t, os.WriteFile(filepath.Join(Root, `dir`, Name), []byte(`data`), 0600))
+	}
+	Fs := vfs.NewOsFs(``, Root, nil)
+	User := &dataprovider.User{
+		FsConfig: dataprovider.Filesystem{
+			Provider: dataprovider.S3FilesystemProvider,
+			S3Config: vfs.S3FsConfig{
+				Bucket:    `bucket1`,
+				KeyPrefix: `users/user1/`,
+			},
+		},
+	}
+
+	Req := Request{FilePaths: []string{`/dir/*.csv`, `dir/c.txt`, `/`, `/dir/[`, `/*/a.csv`}}
+	Resp, err := Req.ResolveBatch(User, Fs)
+	require.NoError(t, err)
+	require.Len(t, Resp.Items, 6)
+	assert.Equal(t, `/dir/a.csv`, Resp.Items[0].FilePath)
+	assert.Equal(t, `/users/user1/dir/a.csv`, Resp.Items[0].Key)
+	assert.Equal(t, `bucket1`, Resp.Items[0].Bucket)
+	assert.Equal(t, `/dir/b.csv`, Resp.Items[1].FilePath)
+	assert.Equal(t, `/users/user1/dir/c.txt`, Resp.Items[2].Key)
+	assert.Empty(t, Resp.Items[2].Error)
+	assert.Equal(t, ErrFilePathInvalid.Error(), Resp.Items[3].Error)
+	assert.Empty(t, Resp.Items[3].Key)
+	assert.NotEmpty(t, Resp.Items[4].Error)
+	assert.Equal(t, ErrGlobInvalid.Error(), Resp.Items[5].Error)
+
+	Req = Request{FilePaths: []string{`/dir`, `/missing`}, Mode: ModePrefix}
+	Resp, err = Req.ResolveBatch(User, Fs)
+	require.NoError(t, err)
+	require.Len(t, Resp.Items, 5)
+	assert.Equal(t, `/dir/a.csv`, Resp.Items[0].FilePath)
+	assert.Equal(t, `/dir/sub/d.csv`, Resp.Items[3].FilePath)
+	assert.Equal(t, `/users/user1/dir/sub/d.csv`, Resp.Items[3].Key)
+	assert.Equal(t, `/missing`, Resp.Items[4].FilePath)
+	assert.NotEmpty(t, Resp.Items[4].Error)
+
+	// the local filesystem cannot presign URLs
+	Req = Request{FilePaths: []string{`/dir/a.csv`}, Presign: PresignGet, PresignExpiration: 60}
+	Resp, err = Req.ResolveBatch(User, Fs)
+	require.NoError(t, err)
+	require.Len(t, Resp.Items, 1)
+	assert.Equal(t, ErrPresignNotSupported.Error(), Resp.Items[0].Error)
+
+	_, err = Req.ResolveBatch(&dataprovider.User{FsConfig: dataprovider.Filesystem{
+		Provider: dataprovider.FilesystemProvider(99),
+	}}, Fs)
+	assert.Equal(t, ErrFileSystemNotSupported, err)
+}
+
+type presignerFs struct {
+	*vfs.OsFs
+}
+
+func (fs *presignerFs) PresignURL(name, method string, expiration time.Duration) (string, error) {
+	return `https://storage.example.com` + name + `?method=` + method, nil
+}
+
+func TestPresignURLPermissions(t *testing.T) {
+	Root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(Root, `up`), os.ModePerm))
+	for _, Name := range []string{`a.csv`, `a.exe`, `b.csv.scanning`, filepath.Join(`up`, `existing.csv`)} {
+		require.NoError(t, os.WriteFile(filepath.Join(Root, Name), []byte(`data`), 0600))
+	}
+	Fs := &presignerFs{OsFs: vfs.NewOsFs(``, Root, nil).(*vfs.OsFs)}
+	User := &dataprovider.User{
+		Permissions: map[string][]string{
+			`/`:   {dataprovider.PermListItems, dataprovider.PermDownload},
+			`/up`: {dataprovider.PermListItems, dataprovider.PermUpload},
+		},
+		FsConfig: dataprovider.Filesystem{
+			Provider: dataprovider.S3FilesystemProvider,
+			S3Config: vfs.S3FsConfig{
+				Bucket: `bucket1`,
+			},
+		},
+		VirtualFolders: []vfs.VirtualFolder{
+			{
+				BaseVirtualFolder: vfs.BaseVirtualFolder{
+					Name:       `folder1`,
+					MappedPath: filepath.Join(Root, `mapped`),
+				},
+				VirtualPath: `/vdir`,
+			},
+		},
+	}
+	User.Filters.FileExtensions = []dataprovider.ExtensionsFilter{
+		{
+			Path:             `/`,
+			DeniedExtensions: []string{`.exe`},
+		},
+	}
+	IsPathReserved := func(virtualPath string) bool {
+		return strings.HasSuffix(virtualPath, `.scanning`)
+	}
+	presign := func(Method, FilePath string) error {
+		Req := Request{
+			FilePath:          FilePath,
+			Presign:           Method,
+			PresignExpiration: 60,
+			IsPathReserved:    IsPathReserved,
+		}
+		Resp, err := Req.ResolvePath(User)
+		require.NoError(t, err)
+		err = Req.PresignURL(User, Fs, &Resp)
+		if err == nil {
+			assert.NotEmpty(t, Resp.URL)
+		}
+		return err
+	}
+
+	assert.NoError(t, presign(PresignGet, `/a.csv`))
+	assert.Equal(t, ErrPresignDenied, presign(PresignPut, `/a.csv`))
+	assert.Equal(t, ErrPresignDenied, presign(PresignGet, `/a.exe`))
+	assert.Equal(t, ErrPresignDenied, presign(PresignGet, `/b.csv.scanning`))
+	assert.Equal(t, ErrPresignDenied, presign(PresignGet, `/up/existing.csv`))
+	assert.NoError(t, presign(PresignPut, `/up/new.csv`))
+	assert.Equal(t, ErrPresignDenied, presign(PresignPut, `/up/existing.csv`))
+	assert.Equal(t, ErrPresignDenied, presign(PresignPut, `/up/new.exe`))
+	// the paths inside virtual folders are not signed using the user filesystem,
+	// virtual folders are supported for local filesystems only
+	User.FsConfig.Provider = dataprovider.LocalFilesystemProvider
+	assert.Equal(t, ErrPresignNotSupported, presign(PresignGet, `/vdir/a.csv`))
+	User.FsConfig.Provider = dataprovider.S3FilesystemProvider
+	// quota and size limits cannot be enforced for presigned uploads
+	User.QuotaFiles = 10
+	assert.Equal(t, ErrPresignPutNotAllowed, presign(PresignPut, `/up/new.csv`))
+	User.QuotaFiles = 0
+	User.Filters.MaxUploadFileSize = 1024
+	assert.Equal(t, ErrPresignPutNotAllowed, presign(PresignPut, `/up/new.csv`))
+	User.Filters.MaxUploadFileSize = 0
+	User.Permissions[`/up`] = append(User.Permissions[`/up`], dataprovider.PermOverwrite)
+	assert.NoError(t, presign(PresignPut, `/up/existing.csv`))
+
+	// the reserved paths are not listed
+	Req := Request{FilePaths: []string{`/*.csv*`}, IsPathReserved: IsPathReserved}
+	Resp, err := Req.ResolveBatch(User, Fs)
+	require.NoError(t, err)
+	if assert.Len(t, Resp.Items, 1) {
+		assert.Equal(t, `/a.csv`, Resp.Items[0].FilePath)
+	}
+	Req = Request{FilePaths: []string{`/`}, Mode: ModePrefix, Presign: PresignGet, PresignExpiration: 60,
+		IsPathReserved: IsPathReserved}
+	Resp, err = Req.ResolveBatch(User, Fs)
+	require.NoError(t, err)
+	if assert.Len(t, Resp.Items, 3) {
+		assert.Equal(t, `/a.csv`, Resp.Items[0].FilePath)
+		assert.Equal(t, `https://storage.example.com`+filepath.Join(Root, `a.csv`)+`?method=GET`, Resp.Items[0].URL)
+		assert.Equal(t, `/a.exe`, Resp.Items[1].FilePath)
+		assert.Equal(t, ErrPresignDenied.Error(), Resp.Items[1].Error)
+		assert.Equal(t, `/up/existing.csv`, Resp.Items[2].FilePath)
+		assert.Equal(t, ErrPresignDenied.Error(), Resp.Items[2].Error)
+	}
+}
+
 func TestResolvePath_S3_KeyPrefixTransversal(t *testing.T) {
 	Req := Request{FilePath: `/../user/test.csv`}
-	Resp, err := Req.ResolvePath(dataprovider.Filesystem{
+	Resp, err := Req.ResolvePath(&dataprovider.User{FsConfig: dataprovider.Filesystem{
 		Provider: dataprovider.S3FilesystemProvider,
 		S3Config: vfs.S3FsConfig{
 			KeyPrefix: `users/user1/`,
 		},
-	})
+	}})
 	assert.Equal(t, Response{}, Resp)
 	assert.Equal(t, ErrFilePathInvalid, err)
 }
 
 func TestResolvePath_S3_Success(t *testing.T) {
 	Req := Request{FilePath: `test.csv`}
-	Resp, err := Req.ResolvePath(dataprovider.Filesystem{
+	Resp, err := Req.ResolvePath(&dataprovider.User{FsConfig: dataprovider.Filesystem{
 		Provider: dataprovider.S3FilesystemProvider,
 		S3Config: vfs.S3FsConfig{
 			Region:    `us-east-1`,
 			Bucket:    `bucket1`,
 			KeyPrefix: `users/user1/`,
 		},
-	})
+	}})
 	assert.Equal(t, Response{
 		RawProvider: dataprovider.S3FilesystemProvider,
 		Provider:    `s3`,
@@ -56,25 +253,25 @@ func TestResolvePath_S3_Success(t *testing.T) {
 
 func TestResolvePath_GCS_KeyPrefixTransversal(t *testing.T) {
 	Req := Request{FilePath: `/../../user/test.csv`}
-	Resp, err := Req.ResolvePath(dataprovider.Filesystem{
+	Resp, err := Req.ResolvePath(&dataprovider.User{FsConfig: dataprovider.Filesystem{
 		Provider: dataprovider.GCSFilesystemProvider,
 		GCSConfig: vfs.GCSFsConfig{
 			KeyPrefix: `users/user1/`,
 		},
-	})
+	}})
 	assert.Empty(t, Resp)
 	assert.Equal(t, ErrFilePathInvalid, err)
 }
 
 func TestResolvePath_GCS_Success(t *testing.T) {
 	Req := Request{FilePath: `test.csv`}
-	Resp, err := Req.ResolvePath(dataprovider.Filesystem{
+	Resp, err := Req.ResolvePath(&dataprovider.User{FsConfig: dataprovider.Filesystem{
 		Provider: dataprovider.GCSFilesystemProvider,
 		GCSConfig: vfs.GCSFsConfig{
 			Bucket:    `bucket1`,
 			KeyPrefix: `users/user1/`,
 		},
-	})
+	}})
 	assert.Equal(t, Response{
 		RawProvider: dataprovider.GCSFilesystemProvider,
 		Provider:    `gcs`,
@@ -86,13 +283,114 @@ func TestResolvePath_GCS_Success(t *testing.T) {
 
 func TestResolvePath_Unsupported(t *testing.T) {
 	Req := Request{FilePath: `test.csv`}
-	Resp, err := Req.ResolvePath(dataprovider.Filesystem{
-		Provider: dataprovider.LocalFilesystemProvider,
-	})
+	Resp, err := Req.ResolvePath(&dataprovider.User{FsConfig: dataprovider.Filesystem{
+		Provider: dataprovider.FilesystemProvider(99),
+	}})
 	assert.Empty(t, Resp)
 	assert.Equal(t, ErrFileSystemNotSupported, err)
 }
 
+func TestResolvePath_Local(t *testing.T) {
+	HomeDir := filepath.Join(os.TempDir(), `user1`)
+	MappedPath := filepath.Join(os.TempDir(), `vfolder`)
+	User := &dataprovider.User{
+		HomeDir: HomeDir,
+		VirtualFolders: []vfs.VirtualFolder{
+			{
+				BaseVirtualFolder: vfs.BaseVirtualFolder{
+					Name:       `folder1`,
+					MappedPath: MappedPath,
+				},
+				VirtualPath: `/vdir`,
+			},
+		},
+	}
+	Req := Request{FilePath: `dir/../test.csv`}
+	Resp, err := Req.ResolvePath(User)
+	assert.NoError(t, err)
+	assert.Equal(t, Response{
+		RawProvider: dataprovider.LocalFilesystemProvider,
+		Provider:    `local`,
+		Path:        filepath.Join(HomeDir, `test.csv`),
+	}, Resp)
+
+	Req = Request{FilePath: `/vdir/sub/test.csv`}
+	Resp, err = Req.ResolvePath(User)
+	assert.NoError(t, err)
+	assert.Equal(t, Response{
+		RawProvider:   dataprovider.LocalFilesystemProvider,
+		Provider:      `local`,
+		Path:          filepath.Join(MappedPath, `sub`, `test.csv`),
+		VirtualFolder: `folder1`,
+	}, Resp)
+	// the virtual path is not a virtual folder prefix
+	Req = Request{FilePath: `/vdir1/test.csv`}
+	Resp, err = Req.ResolvePath(User)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(HomeDir, `vdir1`, `test.csv`), Resp.Path)
+	assert.Empty(t, Resp.VirtualFolder)
+
+	for _, FilePath := range []string{`/vdir`, `/vdir/..`, `../test.csv`, `/dir/../../test.csv`} {
+		Req = Request{FilePath: FilePath}
+		_, err = Req.ResolvePath(User)
+		assert.Equal(t, ErrFilePathInvalid, err, FilePath)
+	}
+
+	User.FsConfig.Provider = dataprovider.CryptedFilesystemProvider
+	Req = Request{FilePath: `test.csv`}
+	Resp, err = Req.ResolvePath(User)
+	assert.NoError(t, err)
+	assert.Equal(t, Response{
+		RawProvider: dataprovider.CryptedFilesystemProvider,
+		Provider:    `local-encrypted`,
+		Path:        filepath.Join(HomeDir, `test.csv`),
+		Encrypted:   true,
+	}, Resp)
+}
+
+func TestResolvePath_AzureAndSFTP(t *testing.T) {
+	Req := Request{FilePath: `/dir/test.csv`}
+	Resp, err := Req.ResolvePath(&dataprovider.User{FsConfig: dataprovider.Filesystem{
+		Provider: dataprovider.AzureBlobFilesystemProvider,
+		AzBlobConfig: vfs.AzBlobFsConfig{
+			Container: `container1`,
+			KeyPrefix: `users/user1/`,
+		},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, Response{
+		RawProvider: dataprovider.AzureBlobFilesystemProvider,
+		Provider:    `azure`,
+		Container:   `container1`,
+		Blob:        `users/user1/dir/test.csv`,
+	}, Resp)
+
+	Req = Request{FilePath: `/dir/test.csv`}
+	Resp, err = Req.ResolvePath(&dataprovider.User{FsConfig: dataprovider.Filesystem{
+		Provider: dataprovider.SFTPFilesystemProvider,
+		SFTPConfig: vfs.SFTPFsConfig{
+			Endpoint: `127.0.0.1:2022`,
+			Prefix:   `/remote/user1`,
+		},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, Response{
+		RawProvider: dataprovider.SFTPFilesystemProvider,
+		Provider:    `sftp`,
+		Endpoint:    `127.0.0.1:2022`,
+		Path:        `/remote/user1/dir/test.csv`,
+	}, Resp)
+
+	// an empty key prefix exposes the whole bucket
+	Req = Request{FilePath: `test.csv`}
+	Resp, err = Req.ResolvePath(&dataprovider.User{FsConfig: dataprovider.Filesystem{
+		Provider: dataprovider.S3FilesystemProvider,
+		S3Config: vfs.S3FsConfig{Bucket: `bucket1`},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, `/test.csv`, Resp.Key)
+}
+
 func TestRawFilesystemProviderToString(t *testing.T) {
 	for fsProvider, expectedStr := range map[dataprovider.FilesystemProvider]string{
 		dataprovider.LocalFilesystemProvider:     "local",
@@ -647,6 +647,22 @@ func getFileExtensionsFromPostField(valueAllowed, valuesDenied string) []datapro
 	return result
 }
 
+func getFolderMappingsFromPostField(value string) []dataprovider.FolderMapping {
+	var result []dataprovider.FolderMapping
+	for _, cleaned := range getSliceFromDelimitedValues(value, "\n") {
+		if strings.Contains(cleaned, "::") {
+			mapping := strings.Split(cleaned, "::")
+			if len(mapping) > 1 {
+				result = append(result, dataprovider.FolderMapping{
+					Prefix:     strings.TrimSpace(mapping[0]),
+					MappedPath: strings.TrimSpace(mapping[1]),
+				})
+			}
+		}
+	}
+	return result
+}
+
 func getFiltersFromUserPostFields(r *http.Request) dataprovider.UserFilters {
 	var filters dataprovider.UserFilters
 	filters.AllowedIP = getSliceFromDelimitedValues(r.Form.Get("allowed_ip"), ",")
@@ -655,6 +671,9 @@ func getFiltersFromUserPostFields(r *http.Request) dataprovider.UserFilters {
 	filters.DeniedProtocols = r.Form["denied_protocols"]
 	filters.FileExtensions = getFileExtensionsFromPostField(r.Form.Get("allowed_extensions"), r.Form.Get("denied_extensions"))
 	filters.FilePatterns = getFilePatternsFromPostField(r.Form.Get("allowed_patterns"), r.Form.Get("denied_patterns"))
+	filters.FolderPrefix = strings.TrimSpace(r.Form.Get("folder_prefix"))
+	filters.FolderMappings = getFolderMappingsFromPostField(r.Form.Get("folder_mappings"))
+	filters.LoginDir = strings.TrimSpace(r.Form.Get("login_dir"))
 	return filters
 }
 
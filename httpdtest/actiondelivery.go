@@ -0,0 +1,98 @@
+package httpdtest
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/render"
+
+	"github.com/drakkan/sftpgo/dataprovider"
+)
+
+const (
+	actionDeliveriesPath = "/api/v2/action-deliveries"
+)
+
+// GetActionDeliveries returns the queued action notifications with the given status,
+// 0 means any status, and checks the received HTTP Status code against expectedStatusCode.
+func GetActionDeliveries(status int, limit, offset int64, expectedStatusCode int) ([]dataprovider.ActionDelivery, []byte, error) {
+	var deliveries []dataprovider.ActionDelivery
+	var body []byte
+	url, err := addLimitAndOffsetQueryParams(buildURLRelativeToBase(actionDeliveriesPath), limit, offset)
+	if err != nil {
+		return deliveries, body, err
+	}
+	if status != 0 {
+		q := url.Query()
+		q.Add("status", strconv.Itoa(status))
+		url.RawQuery = q.Encode()
+	}
+	resp, err := sendHTTPRequest(http.MethodGet, url.String(), nil, "", getDefaultToken())
+	if err != nil {
+		return deliveries, body, err
+	}
+	defer resp.Body.Close()
+	err = checkResponse(resp.StatusCode, expectedStatusCode)
+	if err == nil && expectedStatusCode == http.StatusOK {
+		err = render.DecodeJSON(resp.Body, &deliveries)
+	} else {
+		body, _ = getResponseBody(resp)
+	}
+	return deliveries, body, err
+}
+
+// GetActionDeliveryByID gets a queued action notification by id and checks the received
+// HTTP Status code against expectedStatusCode.
+func GetActionDeliveryByID(id int64, expectedStatusCode int) (dataprovider.ActionDelivery, []byte, error) {
+	var delivery dataprovider.ActionDelivery
+	var body []byte
+	resp, err := sendHTTPRequest(http.MethodGet, buildURLRelativeToBase(actionDeliveriesPath, strconv.FormatInt(id, 10)),
+		nil, "", getDefaultToken())
+	if err != nil {
+		return delivery, body, err
+	}
+	defer resp.Body.Close()
+	err = checkResponse(resp.StatusCode, expectedStatusCode)
+	if err == nil && expectedStatusCode == http.StatusOK {
+		err = render.DecodeJSON(resp.Body, &delivery)
+	} else {
+		body, _ = getResponseBody(resp)
+	}
+	return delivery, body, err
+}
+
+// RetryActionDelivery schedules the queued action notification with the given id for an
+// immediate delivery and checks the received HTTP Status code against expectedStatusCode.
+func RetryActionDelivery(id int64, expectedStatusCode int) ([]byte, error) {
+	return sendActionDeliveriesRequest(http.MethodPost, expectedStatusCode, strconv.FormatInt(id, 10), "retry")
+}
+
+// RemoveActionDelivery removes the queued action notification with the given id
+// and checks the received HTTP Status code against expectedStatusCode.
+func RemoveActionDelivery(id int64, expectedStatusCode int) ([]byte, error) {
+	return sendActionDeliveriesRequest(http.MethodDelete, expectedStatusCode, strconv.FormatInt(id, 10))
+}
+
+// RetryFailedActionDeliveries schedules all the failed action notifications for an
+// immediate delivery and checks the received HTTP Status code against expectedStatusCode.
+func RetryFailedActionDeliveries(expectedStatusCode int) ([]byte, error) {
+	return sendActionDeliveriesRequest(http.MethodPost, expectedStatusCode, "retry")
+}
+
+// PurgeFailedActionDeliveries removes all the failed action notifications
+// and checks the received HTTP Status code against expectedStatusCode.
+func PurgeFailedActionDeliveries(expectedStatusCode int) ([]byte, error) {
+	return sendActionDeliveriesRequest(http.MethodDelete, expectedStatusCode)
+}
+
+func sendActionDeliveriesRequest(method string, expectedStatusCode int, paths ...string) ([]byte, error) {
+	var body []byte
+	resp, err := sendHTTPRequest(method, buildURLRelativeToBase(append([]string{actionDeliveriesPath}, paths...)...),
+		nil, "", getDefaultToken())
+	if err != nil {
+		return body, err
+	}
+	defer resp.Body.Close()
+	body, _ = getResponseBody(resp)
+	return body, checkResponse(resp.StatusCode, expectedStatusCode)
+}
@@ -0,0 +1,92 @@
+package httpdtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/drakkan/sftpgo/fsmeta"
+)
+
+// ReconcileFSMeta reconciles the fsmeta store for the given user and virtual path
+func ReconcileFSMeta(username, path string, dryRun bool, expectedStatusCode int) (fsmeta.ReconcileReport, error) {
+	var report fsmeta.ReconcileReport
+	asJSON, _ := json.Marshal(map[string]any{
+		"username": username,
+		"path":     path,
+		"dry_run":  dryRun,
+	})
+	resp, err := sendHTTPRequest(http.MethodPost, buildURLRelativeToBase(`/api/v2/fsmeta/reconcile`),
+		bytes.NewBuffer(asJSON), "application/json", getDefaultToken())
+	if err != nil {
+		return report, err
+	}
+	defer resp.Body.Close()
+
+	return report, decodeFSMetaResponse(resp, expectedStatusCode, &report)
+}
+
+// GetFSMeta returns the fsmeta stored metadata for the given user and virtual path next to the live ones
+func GetFSMeta(username, path string, expectedStatusCode int) (fsmeta.Inspection, error) {
+	var inspection fsmeta.Inspection
+	resp, err := sendHTTPRequest(http.MethodGet, buildFSMetaURL(username, path), nil, "", getDefaultToken())
+	if err != nil {
+		return inspection, err
+	}
+	defer resp.Body.Close()
+
+	return inspection, decodeFSMetaResponse(resp, expectedStatusCode, &inspection)
+}
+
+// RefreshFSMeta replaces the fsmeta stored metadata for the given user and virtual path with the live ones
+func RefreshFSMeta(username, path string, expectedStatusCode int) (fsmeta.Inspection, error) {
+	var inspection fsmeta.Inspection
+	asJSON, _ := json.Marshal(map[string]any{
+		"username": username,
+		"path":     path,
+	})
+	resp, err := sendHTTPRequest(http.MethodPost, buildURLRelativeToBase(`/api/v2/fsmeta/refresh`),
+		bytes.NewBuffer(asJSON), "application/json", getDefaultToken())
+	if err != nil {
+		return inspection, err
+	}
+	defer resp.Body.Close()
+
+	return inspection, decodeFSMetaResponse(resp, expectedStatusCode, &inspection)
+}
+
+// DeleteFSMeta removes the fsmeta stored metadata for the given user and virtual path
+func DeleteFSMeta(username, path string, expectedStatusCode int) error {
+	resp, err := sendHTTPRequest(http.MethodDelete, buildFSMetaURL(username, path), nil, "", getDefaultToken())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var apiResp map[string]any
+	return decodeFSMetaResponse(resp, expectedStatusCode, &apiResp)
+}
+
+func buildFSMetaURL(username, path string) string {
+	q := url.Values{}
+	q.Set("username", username)
+	q.Set("path", path)
+	return buildURLRelativeToBase(`/api/v2/fsmeta`) + "?" + q.Encode()
+}
+
+// decodeFSMetaResponse decodes a successful response into v, an APIError is returned otherwise
+func decodeFSMetaResponse(resp *http.Response, expectedStatusCode int, v any) error {
+	body, _ := getResponseBody(resp)
+	if err := checkResponse(resp.StatusCode, expectedStatusCode); err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return json.Unmarshal(body, v)
+	}
+	var apiErr APIError
+	if err := json.Unmarshal(body, &apiErr); err != nil {
+		return err
+	}
+	return apiErr
+}
@@ -1164,6 +1164,21 @@ func compareUserFilters(expected *dataprovider.User, actual *dataprovider.User)
 	if expected.Filters.MaxUploadFileSize != actual.Filters.MaxUploadFileSize {
 		return errors.New("Max upload file size mismatch")
 	}
+	if expected.Filters.FolderPrefix != "" && path.Clean(expected.Filters.FolderPrefix) != actual.Filters.FolderPrefix {
+		return errors.New("Folder prefix mismatch")
+	}
+	if expected.Filters.LoginDir != "" && path.Clean(expected.Filters.LoginDir) != actual.Filters.LoginDir {
+		return errors.New("Login dir mismatch")
+	}
+	if len(expected.Filters.FolderMappings) != len(actual.Filters.FolderMappings) {
+		return errors.New("Folder mappings mismatch")
+	}
+	for idx, mapping := range expected.Filters.FolderMappings {
+		if path.Clean(mapping.Prefix) != actual.Filters.FolderMappings[idx].Prefix ||
+			path.Clean(mapping.MappedPath) != actual.Filters.FolderMappings[idx].MappedPath {
+			return errors.New("Folder mappings contents mismatch")
+		}
+	}
 	for _, IPMask := range expected.Filters.AllowedIP {
 		if !utils.IsStringInSlice(IPMask, actual.Filters.AllowedIP) {
 			return errors.New("AllowedIP contents mismatch")
@@ -28,34 +28,43 @@ func TranslatePath(request translate.Request, expectedStatusCode int) (translate
 	return baseTranslate(request, expectedStatusCode, `/api/v2/translate-path`)
 }
 
+// TranslatePaths translates the request filepaths using a single batch request
+func TranslatePaths(request translate.Request, expectedStatusCode int) (translate.BatchResponse, error) {
+	var translated translate.BatchResponse
+	err := sendTranslateRequest(request, expectedStatusCode, `/api/v2/translate-path`, &translated)
+	return translated, err
+}
+
 func baseTranslate(request translate.Request, expectedStatusCode int, path string) (translate.Response, error) {
 	var translated translate.Response
+	err := sendTranslateRequest(request, expectedStatusCode, path, &translated)
+	return translated, err
+}
+
+func sendTranslateRequest(request translate.Request, expectedStatusCode int, path string, translated interface{}) error {
 	var body []byte
 
 	folderAsJSON, _ := json.Marshal(request)
 	url := buildURLRelativeToBase(path)
 	resp, err := sendHTTPRequest(http.MethodPost, url, bytes.NewBuffer(folderAsJSON), "", getDefaultToken())
 	if err != nil {
-		return translated, err
+		return err
 	}
 	defer resp.Body.Close()
 
 	body, _ = getResponseBody(resp)
 
 	if err := checkResponse(resp.StatusCode, expectedStatusCode); err != nil {
-		return translated, err
+		return err
 	}
 
 	if resp.StatusCode == http.StatusOK {
-		if err = json.Unmarshal(body, &translated); err != nil {
-			return translated, err
-		}
-		return translated, nil
+		return json.Unmarshal(body, translated)
 	}
 
 	var apiErr APIError
 	if err := json.Unmarshal(body, &apiErr); err != nil {
-		return translated, err
+		return err
 	}
-	return translated, apiErr
+	return apiErr
 }
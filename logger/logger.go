@@ -281,6 +281,19 @@ func CommandLog(command, path, target, user, fileMode, connectionID, protocol st
 		Send()
 }
 
+// AuditLog logs an action performed by an admin on the files of the given user
+func AuditLog(action, admin, user, clientIP string, paths []string) {
+	logger.Info().
+		Timestamp().
+		Str("sender", action).
+		Str("admin", admin).
+		Str("username", user).
+		Str("client_ip", clientIP).
+		Strs("file_paths", paths).
+		Str(KeyEventID, uuid.NewString()).
+		Send()
+}
+
 // ConnectionFailedLog logs failed attempts to initialize a connection.
 // A connection can fail for an authentication error or other errors such as
 // a client abort or a time out if the login does not happen in two minutes.
@@ -26,6 +26,18 @@ var (
 		Name: "sftpgo_fsmeta_postgres_self_heal_failed",
 		Help: "The FSMeta PostgreSQL cache failed to heal property.",
 	})
+	fsmetaFolderCacheHit = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "sftpgo_fsmeta_folder_cache_hit",
+		Help: "The FSMeta process wide folder cache had a valid entry.",
+	})
+	fsmetaFolderCacheMiss = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "sftpgo_fsmeta_folder_cache_miss",
+		Help: "The FSMeta process wide folder cache had no entry or the entry was expired.",
+	})
+	fsmetaFolderCacheEviction = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "sftpgo_fsmeta_folder_cache_eviction",
+		Help: "An entry was evicted from the FSMeta process wide folder cache to respect its size.",
+	})
 )
 
 func FSMetaPostgresCache(err error) {
@@ -45,3 +57,17 @@ func FSMetaPostgresSelfHeal(err error) {
 		fsmetaPostgresSelfHealFailed.Inc()
 	}
 }
+
+// FSMetaFolderCache updates the process wide folder cache hit/miss counters
+func FSMetaFolderCache(hit bool) {
+	if hit {
+		fsmetaFolderCacheHit.Inc()
+	} else {
+		fsmetaFolderCacheMiss.Inc()
+	}
+}
+
+// FSMetaFolderCacheEviction increments the process wide folder cache evictions counter
+func FSMetaFolderCacheEviction() {
+	fsmetaFolderCacheEviction.Inc()
+}
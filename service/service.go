@@ -110,7 +110,12 @@ func (s *Service) Start() error {
 	}
 
 	fsMetaConfig := config.GetFSMetaConfig()
-	if err := fsmeta.Initialize(fsMetaConfig); err != nil {
+	if fsMetaConfig.UseDataProvider {
+		err = dataprovider.InitializeFSMeta(fsMetaConfig)
+	} else {
+		err = fsmeta.Initialize(fsMetaConfig, s.ConfigDir)
+	}
+	if err != nil {
 		logger.Error(logSender, "", "error initializing fsmeta provider: %v", err)
 		logger.ErrorToConsole("error initializing fsmeta provider: %v", err)
 		return err
@@ -139,6 +144,7 @@ func (s *Service) Start() error {
 		return err
 	}
 
+	common.StartActionsQueue()
 	s.startServices()
 
 	return nil
@@ -7,14 +7,17 @@ import (
 
 	"github.com/pkg/sftp"
 
+	"github.com/drakkan/sftpgo/common"
 	"github.com/drakkan/sftpgo/vfs"
 )
 
 type cdirMiddleware struct {
-	next Middleware
+	next       Middleware
+	workingDir *common.WorkingDir
 }
 
 var _ Middleware = &cdirMiddleware{}
+var _ sftp.RealPathFileLister = &cdirMiddleware{}
 
 func NewHandlersFromMiddleware(h Middleware) sftp.Handlers {
 	return sftp.Handlers{
@@ -25,8 +28,19 @@ func NewHandlersFromMiddleware(h Middleware) sftp.Handlers {
 	}
 }
 
-func NewCurrentDirMiddleware(next Middleware) Middleware {
-	return &cdirMiddleware{next: next}
+// NewCurrentDirMiddleware returns a middleware resolving the SFTP realpath requests
+// against the given session working directory
+func NewCurrentDirMiddleware(next Middleware, workingDir *common.WorkingDir) Middleware {
+	return &cdirMiddleware{
+		next:       next,
+		workingDir: workingDir,
+	}
+}
+
+// RealPath implements sftp.RealPathFileLister, relative paths are resolved against
+// the session working directory
+func (c *cdirMiddleware) RealPath(name string) string {
+	return c.workingDir.Resolve(name)
 }
 
 func (c *cdirMiddleware) Filewrite(request *sftp.Request) (io.WriterAt, error) {
@@ -8,6 +8,8 @@ import (
 	"github.com/pkg/sftp"
 	"github.com/stretchr/testify/suite"
 
+	"github.com/drakkan/sftpgo/common"
+	"github.com/drakkan/sftpgo/dataprovider"
 	"github.com/drakkan/sftpgo/sftpd/mocks"
 	"github.com/drakkan/sftpgo/vfs"
 )
@@ -29,7 +31,7 @@ func (Suite *CDirMiddlewareSuite) AfterTest(_, _ string) {
 func (Suite *CDirMiddlewareSuite) TestPassthru() {
 	Next := mocks.NewMockMiddleware(Suite.MockCtl)
 
-	Middleware := NewCurrentDirMiddleware(Next)
+	Middleware := NewCurrentDirMiddleware(Next, common.NewWorkingDir(&dataprovider.User{}))
 
 	Req := &sftp.Request{Filepath: "/files/data.csv"}
 	Next.EXPECT().Fileread(Req).Return(nil, nil)
@@ -71,7 +73,7 @@ func (Suite *CDirMiddlewareSuite) TestFilelist() {
 
 	// Add current directory.
 	Next.EXPECT().Filelist(Req).Return(listWithoutDot, nil)
-	Middleware := NewCurrentDirMiddleware(Next)
+	Middleware := NewCurrentDirMiddleware(Next, common.NewWorkingDir(&dataprovider.User{}))
 	ListerAt, err := Middleware.Filelist(Req)
 	Suite.Equal(listWithDot, ListerAt)
 	Suite.Nil(err)
@@ -88,6 +90,25 @@ func (Suite *CDirMiddlewareSuite) TestFilelist() {
 	Suite.Equal(sftp.ErrSSHFxPermissionDenied, err)
 }
 
+func (Suite *CDirMiddlewareSuite) TestRealPath() {
+	Next := mocks.NewMockMiddleware(Suite.MockCtl)
+
+	WorkingDir := common.NewWorkingDir(&dataprovider.User{
+		Filters: dataprovider.UserFilters{LoginDir: `/inbound`},
+	})
+	Middleware := NewCurrentDirMiddleware(Next, WorkingDir)
+	RealPather, ok := Middleware.(sftp.RealPathFileLister)
+	Suite.Require().True(ok)
+	Suite.Equal(`/inbound`, RealPather.RealPath(`.`))
+	Suite.Equal(`/inbound/data.csv`, RealPather.RealPath(`data.csv`))
+	Suite.Equal(`/files`, RealPather.RealPath(`/files/`))
+
+	// the session working directory can be changed by SSH commands
+	WorkingDir.Set(`/outbound`)
+	Suite.Equal(`/outbound`, RealPather.RealPath(``))
+	Suite.Equal(`/`, RealPather.RealPath(`..`))
+}
+
 func TestCDirMiddlewareSuite(t *testing.T) {
 	suite.Run(t, new(CDirMiddlewareSuite))
 }
@@ -0,0 +1,831 @@
+package sftpd
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/minio/sha256-simd"
+	"github.com/pkg/sftp"
+
+	"github.com/drakkan/sftpgo/common"
+	"github.com/drakkan/sftpgo/dataprovider"
+	"github.com/drakkan/sftpgo/logger"
+)
+
+// SFTP packet types and status codes used by the extensions
+const (
+	sshFxpVersion       = 2
+	sshFxpOpen          = 3
+	sshFxpClose         = 4
+	sshFxpWrite         = 6
+	sshFxpLstat         = 7
+	sshFxpSetstat       = 9
+	sshFxpOpendir       = 11
+	sshFxpRemove        = 13
+	sshFxpMkdir         = 14
+	sshFxpRmdir         = 15
+	sshFxpStat          = 17
+	sshFxpRename        = 18
+	sshFxpReadlink      = 19
+	sshFxpSymlink       = 20
+	sshFxpStatus        = 101
+	sshFxpHandle        = 102
+	sshFxpData          = 103
+	sshFxpExtended      = 200
+	sshFxpExtendedReply = 201
+
+	sshFxOk               = 0
+	sshFxNoSuchFile       = 2
+	sshFxPermissionDenied = 3
+	sshFxFailure          = 4
+	sshFxBadMessage       = 5
+	sshFxOpUnsupported    = 8
+)
+
+// supported SFTP extensions
+const (
+	extCopyData        = "copy-data"
+	extCopyFile        = "copy-file"
+	extCheckFile       = "check-file"
+	extCheckFileName   = "check-file-name"
+	extCheckFileHandle = "check-file-handle"
+	extSpaceAvailable  = "space-available"
+)
+
+const (
+	// max size for the buffered packets, the data packets are never buffered
+	maxBufferedPacketSize = 256 * 1024
+	copyDataBufferSize    = 32768
+	minCheckFileBlockSize = 256
+)
+
+var (
+	errBadMessage        = errors.New("bad message")
+	errHandleNotFound    = errors.New("handle not found")
+	errHashNotSupported  = errors.New("no supported hash algorithm")
+	checkFileAlgorithms  = []string{"md5", "sha1", "sha256", "sha384", "sha512"}
+	supportedExtensions  = []string{extCopyData, extCopyFile, extCheckFileName, extCheckFileHandle, extSpaceAvailable}
+	advertisedExtensions = [][2]string{
+		{extCopyData, "1"},
+		{extCopyFile, "1"},
+		{extCheckFile, strings.Join(checkFileAlgorithms, ",")},
+		{extSpaceAvailable, "1"},
+	}
+)
+
+var (
+	// number of leading paths, after the request ID, for the requests forwarded to
+	// the request server
+	requestPathsCount = map[byte]int{
+		sshFxpOpen:     1,
+		sshFxpLstat:    1,
+		sshFxpSetstat:  1,
+		sshFxpOpendir:  1,
+		sshFxpRemove:   1,
+		sshFxpMkdir:    1,
+		sshFxpRmdir:    1,
+		sshFxpStat:     1,
+		sshFxpRename:   2,
+		sshFxpReadlink: 1,
+		sshFxpSymlink:  2,
+	}
+	// number of leading paths, after the extension name, for the extended requests
+	// forwarded to the request server
+	extendedPathsCount = map[string]int{
+		"posix-rename@openssh.com": 2,
+		"hardlink@openssh.com":     2,
+		"statvfs@openssh.com":      1,
+	}
+)
+
+// extensionsChannel implements the SFTP extensions not supported by the request
+// server. The packets exchanged on the channel are inspected: the supported
+// extended requests are handled here and not forwarded to the request server, the
+// extensions are added to the version packet and the handles returned for the
+// open requests are tracked so that the handle based extensions can find the
+// matching transfers. The relative request paths are rewritten as absolute paths
+// resolved against the session working directory, this way they follow the
+// directory changes made on the other channels of the same session. The data
+// packets are passed through without buffering
+type extensionsChannel struct {
+	channel    io.ReadWriteCloser
+	connection *Connection
+	// read side state, accessed by the request server receiving goroutine only
+	pending  []byte
+	passthru uint32
+	// write side state, writeMu is held while a packet is passed through
+	writeMu   sync.Mutex
+	writeBuf  []byte
+	writeLeft int
+	// tracked open requests, handles and transfers
+	mu        sync.Mutex
+	opens     map[uint32]string
+	handles   map[string]string
+	transfers map[*common.BaseTransfer]*transfer
+	wg        sync.WaitGroup
+}
+
+func newExtensionsChannel(channel io.ReadWriteCloser, connection *Connection) *extensionsChannel {
+	return &extensionsChannel{
+		channel:    channel,
+		connection: connection,
+		opens:      make(map[uint32]string),
+		handles:    make(map[string]string),
+		transfers:  make(map[*common.BaseTransfer]*transfer),
+	}
+}
+
+// TrackTransfers returns a middleware recording the transfers created by next,
+// the connection only knows the base transfers
+func (e *extensionsChannel) TrackTransfers(next Middleware) Middleware {
+	return &transferTracker{
+		Middleware: next,
+		ext:        e,
+	}
+}
+
+func (e *extensionsChannel) addTransfer(t *transfer) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for base, tr := range e.transfers {
+		tr.Lock()
+		if tr.isFinished {
+			delete(e.transfers, base)
+		}
+		tr.Unlock()
+	}
+	e.transfers[t.BaseTransfer] = t
+}
+
+// Wait waits for the running extended requests
+func (e *extensionsChannel) Wait() {
+	e.wg.Wait()
+}
+
+func (e *extensionsChannel) Close() error {
+	return e.channel.Close()
+}
+
+func (e *extensionsChannel) Read(p []byte) (int, error) {
+	for {
+		if len(e.pending) > 0 {
+			n := copy(p, e.pending)
+			e.pending = e.pending[n:]
+			return n, nil
+		}
+		if e.passthru > 0 {
+			if uint32(len(p)) > e.passthru {
+				p = p[:e.passthru]
+			}
+			n, err := e.channel.Read(p)
+			e.passthru -= uint32(n)
+			return n, err
+		}
+		if err := e.readPacket(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// readPacket reads the next packet header and buffers the packets to inspect
+func (e *extensionsChannel) readPacket() error {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(e.channel, header); err != nil {
+		return err
+	}
+	length := binary.BigEndian.Uint32(header)
+	if length == 0 {
+		return errBadMessage
+	}
+	if _, ok := requestPathsCount[header[4]]; !ok && header[4] != sshFxpClose && header[4] != sshFxpExtended {
+		e.pending = header
+		e.passthru = length - 1
+		return nil
+	}
+	if length > maxBufferedPacketSize {
+		return errBadMessage
+	}
+	pkt := make([]byte, 4+length)
+	copy(pkt, header)
+	if _, err := io.ReadFull(e.channel, pkt[5:]); err != nil {
+		return err
+	}
+	pkt = e.resolveRequestPaths(pkt)
+	if !e.inspectRequest(header[4], pkt[5:]) {
+		e.pending = pkt
+	}
+	return nil
+}
+
+// inspectRequest tracks the open and close requests and starts the supported
+// extended requests. It returns true if the request is handled here
+func (e *extensionsChannel) inspectRequest(pktType byte, data []byte) bool {
+	id, data, err := unmarshalUint32(data)
+	if err != nil {
+		return false
+	}
+	switch pktType {
+	case sshFxpOpen, sshFxpOpendir:
+		if name, _, err := unmarshalString(data); err == nil {
+			e.mu.Lock()
+			e.opens[id] = e.resolvePath(name)
+			e.mu.Unlock()
+		}
+	case sshFxpClose:
+		if handle, _, err := unmarshalString(data); err == nil {
+			e.mu.Lock()
+			delete(e.handles, handle)
+			e.mu.Unlock()
+		}
+	case sshFxpExtended:
+		name, data, err := unmarshalString(data)
+		if err != nil || !isSupportedExtension(name) {
+			return false
+		}
+		e.wg.Add(1)
+		go func() {
+			defer e.wg.Done()
+
+			e.handleExtended(id, name, data)
+		}()
+		return true
+	}
+	return false
+}
+
+func (e *extensionsChannel) Write(p []byte) (int, error) {
+	written := len(p)
+	p, err := e.writeThrough(p)
+	if err != nil {
+		return 0, err
+	}
+	e.writeBuf = append(e.writeBuf, p...)
+	for len(e.writeBuf) >= 5 {
+		size := 4 + int(binary.BigEndian.Uint32(e.writeBuf))
+		switch e.writeBuf[4] {
+		case sshFxpVersion, sshFxpHandle, sshFxpStatus:
+			if len(e.writeBuf) < size {
+				return written, nil
+			}
+			pkt := e.inspectResponse(e.writeBuf[:size])
+			e.writeBuf = e.writeBuf[size:]
+			if err := e.writePacket(pkt); err != nil {
+				return 0, err
+			}
+		default:
+			e.writeMu.Lock()
+			e.writeLeft = size
+			buf := e.writeBuf
+			e.writeBuf = nil
+			rest, err := e.writeThrough(buf)
+			if err != nil {
+				return 0, err
+			}
+			e.writeBuf = rest
+		}
+	}
+	if len(e.writeBuf) == 0 {
+		e.writeBuf = nil
+	}
+	return written, nil
+}
+
+// writeThrough writes the remaining bytes of the packet being passed through and
+// returns the bytes after it, if any. writeMu is released once the packet is sent
+func (e *extensionsChannel) writeThrough(p []byte) ([]byte, error) {
+	if e.writeLeft == 0 {
+		return p, nil
+	}
+	n := len(p)
+	if n > e.writeLeft {
+		n = e.writeLeft
+	}
+	_, err := e.channel.Write(p[:n])
+	e.writeLeft -= n
+	if err != nil {
+		e.writeLeft = 0
+	}
+	if e.writeLeft == 0 {
+		e.writeMu.Unlock()
+	}
+	return p[n:], err
+}
+
+func (e *extensionsChannel) writePacket(pkt []byte) error {
+	e.writeMu.Lock()
+	defer e.writeMu.Unlock()
+
+	_, err := e.channel.Write(pkt)
+	return err
+}
+
+// inspectResponse adds the supported extensions to the version packet and tracks
+// the handles returned for the open requests
+func (e *extensionsChannel) inspectResponse(pkt []byte) []byte {
+	if pkt[4] == sshFxpVersion {
+		result := make([]byte, len(pkt))
+		copy(result, pkt)
+		for _, ext := range advertisedExtensions {
+			result = marshalString(result, ext[0])
+			result = marshalString(result, ext[1])
+		}
+		binary.BigEndian.PutUint32(result, uint32(len(result)-4))
+		return result
+	}
+	id, data, err := unmarshalUint32(pkt[5:])
+	if err != nil {
+		return pkt
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	clientPath, ok := e.opens[id]
+	if !ok {
+		return pkt
+	}
+	delete(e.opens, id)
+	if pkt[4] == sshFxpHandle {
+		if handle, _, err := unmarshalString(data); err == nil {
+			e.handles[handle] = clientPath
+		}
+	}
+	return pkt
+}
+
+// resolvePath returns the given request path as an absolute client path, the
+// relative paths are resolved against the session working directory
+func (e *extensionsChannel) resolvePath(name string) string {
+	return e.connection.ResolveClientPath(name)
+}
+
+// resolveRequestPaths returns the given request packet with its paths resolved
+// as absolute client paths. The packets that cannot be parsed are returned
+// unchanged, the request server will reply with an error
+func (e *extensionsChannel) resolveRequestPaths(pkt []byte) []byte {
+	numPaths := requestPathsCount[pkt[4]]
+	id, data, err := unmarshalUint32(pkt[5:])
+	if err != nil {
+		return pkt
+	}
+	resolved := make([]byte, 5, len(pkt))
+	copy(resolved, pkt[:5])
+	resolved = marshalUint32(resolved, id)
+	if pkt[4] == sshFxpExtended {
+		var name string
+		name, data, err = unmarshalString(data)
+		if err != nil {
+			return pkt
+		}
+		resolved = marshalString(resolved, name)
+		numPaths = extendedPathsCount[name]
+	}
+	if numPaths == 0 {
+		return pkt
+	}
+	for i := 0; i < numPaths; i++ {
+		var name string
+		name, data, err = unmarshalString(data)
+		if err != nil {
+			return pkt
+		}
+		resolved = marshalString(resolved, e.resolvePath(name))
+	}
+	resolved = append(resolved, data...)
+	binary.BigEndian.PutUint32(resolved, uint32(len(resolved)-4))
+	return resolved
+}
+
+func (e *extensionsChannel) getHandlePath(handle string) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	clientPath, ok := e.handles[handle]
+	if !ok {
+		return "", errHandleNotFound
+	}
+	return clientPath, nil
+}
+
+// getPaths returns the virtual and filesystem paths for the given client path
+func (e *extensionsChannel) getPaths(clientPath string) (string, string, error) {
+	virtualPath, err := e.connection.RemoveFolderPrefix(clientPath)
+	if err != nil {
+		return "", "", err
+	}
+	fsPath, err := e.connection.Fs.ResolvePath(virtualPath)
+	if err != nil {
+		return "", "", e.connection.GetFsError(err)
+	}
+	return virtualPath, fsPath, nil
+}
+
+func (e *extensionsChannel) handleExtended(id uint32, name string, data []byte) {
+	e.connection.UpdateLastActivity()
+	e.connection.Log(logger.LevelDebug, "received extended request %#v, id: %v", name, id)
+	var reply []byte
+	var err error
+	switch name {
+	case extCopyFile:
+		err = e.copyFile(data)
+	case extCopyData:
+		err = e.copyData(data)
+	case extCheckFileName, extCheckFileHandle:
+		reply, err = e.checkFile(name, data)
+	case extSpaceAvailable:
+		reply, err = e.spaceAvailable(data)
+	}
+	if err != nil {
+		e.connection.Log(logger.LevelDebug, "extended request %#v, id: %v, error: %v", name, id, err)
+	}
+	var pkt []byte
+	if err == nil && reply != nil {
+		pkt = newResponsePacket(sshFxpExtendedReply, id)
+		pkt = append(pkt, reply...)
+	} else {
+		pkt = newStatusPacket(id, err)
+	}
+	binary.BigEndian.PutUint32(pkt, uint32(len(pkt)-4))
+	if err := e.writePacket(pkt); err != nil {
+		e.connection.Log(logger.LevelDebug, "unable to send the response for the extended request %#v: %v", name, err)
+	}
+}
+
+// copyFile handles the copy-file extension: source, target and overwrite flag
+func (e *extensionsChannel) copyFile(data []byte) error {
+	source, data, err := unmarshalString(data)
+	if err != nil {
+		return errBadMessage
+	}
+	target, data, err := unmarshalString(data)
+	if err != nil || len(data) < 1 {
+		return errBadMessage
+	}
+	overwrite := data[0] != 0
+	virtualSourcePath, fsSourcePath, err := e.getPaths(e.resolvePath(source))
+	if err != nil {
+		return err
+	}
+	virtualTargetPath, fsTargetPath, err := e.getPaths(e.resolvePath(target))
+	if err != nil {
+		return err
+	}
+	if fsSourcePath == fsTargetPath {
+		return sftp.ErrSSHFxFailure
+	}
+	return e.connection.Copy(fsSourcePath, fsTargetPath, virtualSourcePath, virtualTargetPath, overwrite)
+}
+
+// copyData handles the copy-data extension: the data are read from the transfer
+// for the read handle and written to the one for the write handle, so the checks
+// done opening the handles, the quota and the transfer actions still apply
+func (e *extensionsChannel) copyData(data []byte) error {
+	readHandle, data, err := unmarshalString(data)
+	if err != nil {
+		return errBadMessage
+	}
+	readOffset, data, err := unmarshalUint64(data)
+	if err != nil {
+		return errBadMessage
+	}
+	readLength, data, err := unmarshalUint64(data)
+	if err != nil {
+		return errBadMessage
+	}
+	writeHandle, data, err := unmarshalString(data)
+	if err != nil {
+		return errBadMessage
+	}
+	writeOffset, _, err := unmarshalUint64(data)
+	if err != nil {
+		return errBadMessage
+	}
+	reader, err := e.getHandleTransfer(readHandle, common.TransferDownload)
+	if err != nil {
+		return err
+	}
+	writer, err := e.getHandleTransfer(writeHandle, common.TransferUpload)
+	if err != nil {
+		return err
+	}
+	// a zero length means up to the end of the file
+	buf := make([]byte, copyDataBufferSize)
+	for {
+		toRead := buf
+		if readLength > 0 && readLength < uint64(len(buf)) {
+			toRead = buf[:readLength]
+		}
+		n, err := reader.ReadAt(toRead, int64(readOffset))
+		if n > 0 {
+			if _, errWrite := writer.WriteAt(toRead[:n], int64(writeOffset)); errWrite != nil {
+				return errWrite
+			}
+			readOffset += uint64(n)
+			writeOffset += uint64(n)
+			if readLength > 0 {
+				readLength -= uint64(n)
+				if readLength == 0 {
+					return nil
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// getHandleTransfer returns the active transfer for the given handle
+func (e *extensionsChannel) getHandleTransfer(handle string, transferType int) (*transfer, error) {
+	clientPath, err := e.getHandlePath(handle)
+	if err != nil {
+		return nil, err
+	}
+	virtualPath, err := e.connection.RemoveFolderPrefix(clientPath)
+	if err != nil {
+		return nil, err
+	}
+	if base, ok := e.connection.GetActiveTransfer(virtualPath, transferType).(*common.BaseTransfer); ok {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		if t, ok := e.transfers[base]; ok {
+			return t, nil
+		}
+	}
+	return nil, errHandleNotFound
+}
+
+// transferTracker is the middleware recording the transfers for the handle based
+// extensions
+type transferTracker struct {
+	Middleware
+	ext *extensionsChannel
+}
+
+func (t *transferTracker) Fileread(request *sftp.Request) (io.ReaderAt, error) {
+	r, err := t.Middleware.Fileread(request)
+	t.track(r)
+	return r, err
+}
+
+func (t *transferTracker) Filewrite(request *sftp.Request) (io.WriterAt, error) {
+	w, err := t.Middleware.Filewrite(request)
+	t.track(w)
+	return w, err
+}
+
+func (t *transferTracker) OpenFile(request *sftp.Request) (sftp.WriterAtReaderAt, error) {
+	rw, err := t.Middleware.OpenFile(request)
+	t.track(rw)
+	return rw, err
+}
+
+func (t *transferTracker) track(v interface{}) {
+	if tr, ok := v.(*transfer); ok {
+		t.ext.addTransfer(tr)
+	}
+}
+
+// checkFile handles the check-file-name and check-file-handle extensions: the
+// reply is the used algorithm followed by the hashes of each block
+func (e *extensionsChannel) checkFile(name string, data []byte) ([]byte, error) {
+	nameOrHandle, data, err := unmarshalString(data)
+	if err != nil {
+		return nil, errBadMessage
+	}
+	algorithms, data, err := unmarshalString(data)
+	if err != nil {
+		return nil, errBadMessage
+	}
+	startOffset, data, err := unmarshalUint64(data)
+	if err != nil {
+		return nil, errBadMessage
+	}
+	length, data, err := unmarshalUint64(data)
+	if err != nil {
+		return nil, errBadMessage
+	}
+	blockSize, _, err := unmarshalUint32(data)
+	if err != nil {
+		return nil, errBadMessage
+	}
+	if blockSize > 0 && blockSize < minCheckFileBlockSize {
+		return nil, errBadMessage
+	}
+	algorithm, newHash := getCheckFileHash(algorithms)
+	if newHash == nil {
+		return nil, errHashNotSupported
+	}
+	clientPath := e.resolvePath(nameOrHandle)
+	if name == extCheckFileHandle {
+		if clientPath, err = e.getHandlePath(nameOrHandle); err != nil {
+			return nil, err
+		}
+	}
+	virtualPath, fsPath, err := e.getPaths(clientPath)
+	if err != nil {
+		return nil, err
+	}
+	if !e.connection.IsFileAllowed(virtualPath) || e.connection.IsReservedPath(virtualPath) ||
+		!e.connection.User.HasPerm(dataprovider.PermListItems, virtualPath) {
+		e.connection.Log(logger.LevelInfo, "check-file not allowed for file %#v", virtualPath)
+		return nil, e.connection.GetPermissionDeniedError()
+	}
+	info, err := e.connection.DoStat(fsPath, 0)
+	if err != nil {
+		return nil, e.connection.GetFsError(err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, e.connection.GetOpUnsupportedError()
+	}
+	reader, cancelFn, err := e.openRange(fsPath, int64(startOffset), int64(length))
+	if err != nil {
+		return nil, e.connection.GetFsError(err)
+	}
+	if cancelFn != nil {
+		defer cancelFn()
+	}
+	defer reader.Close()
+
+	reply := marshalString(nil, algorithm)
+	for {
+		h := newHash()
+		var n int64
+		if blockSize > 0 {
+			n, err = io.CopyN(h, reader, int64(blockSize))
+		} else {
+			n, err = io.Copy(h, reader)
+		}
+		if err != nil && err != io.EOF {
+			return nil, e.connection.GetFsError(err)
+		}
+		// an empty range has the hash of the empty data
+		if n > 0 || len(reply) == 4+len(algorithm) {
+			reply = append(reply, h.Sum(nil)...)
+		}
+		if blockSize == 0 || n < int64(blockSize) {
+			return reply, nil
+		}
+	}
+}
+
+// openRange returns a reader for the given range of the file, a zero length
+// means up to the end of the file
+func (e *extensionsChannel) openRange(fsPath string, offset, length int64) (io.ReadCloser, func(), error) {
+	f, r, cancelFn, err := e.connection.Fs.Open(fsPath, offset)
+	if err != nil {
+		return nil, nil, err
+	}
+	var reader io.Reader
+	var closer io.Closer
+	if f != nil {
+		if length == 0 {
+			length = 1<<63 - 1 - offset
+		}
+		reader = io.NewSectionReader(f, offset, length)
+		closer = f
+	} else {
+		reader = r
+		if length > 0 {
+			reader = io.LimitReader(r, length)
+		}
+		closer = r
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{reader, closer}, cancelFn, nil
+}
+
+// spaceAvailable handles the space-available extension using the same values
+// returned for the statvfs@openssh.com extension
+func (e *extensionsChannel) spaceAvailable(data []byte) ([]byte, error) {
+	name, _, err := unmarshalString(data)
+	if err != nil {
+		return nil, errBadMessage
+	}
+	virtualPath, _, err := e.getPaths(e.resolvePath(name))
+	if err != nil {
+		return nil, err
+	}
+	stat, err := e.connection.StatVFS(&sftp.Request{Method: "StatVFS", Filepath: virtualPath})
+	if err != nil {
+		return nil, err
+	}
+	reply := marshalUint64(nil, stat.Blocks*stat.Frsize)
+	reply = marshalUint64(reply, stat.Bfree*stat.Frsize)
+	reply = marshalUint64(reply, stat.Bavail*stat.Frsize)
+	reply = marshalUint64(reply, stat.Bavail*stat.Frsize)
+	return marshalUint32(reply, uint32(stat.Frsize)), nil
+}
+
+func isSupportedExtension(name string) bool {
+	for _, ext := range supportedExtensions {
+		if ext == name {
+			return true
+		}
+	}
+	return false
+}
+
+// getCheckFileHash returns the first supported algorithm in the given comma
+// separated list and its hash constructor
+func getCheckFileHash(algorithms string) (string, func() hash.Hash) {
+	for _, algorithm := range strings.Split(algorithms, ",") {
+		switch strings.TrimSpace(algorithm) {
+		case "md5":
+			return "md5", md5.New
+		case "sha1":
+			return "sha1", sha1.New
+		case "sha256":
+			return "sha256", sha256.New
+		case "sha384":
+			return "sha384", sha512.New384
+		case "sha512":
+			return "sha512", sha512.New
+		}
+	}
+	return "", nil
+}
+
+// newResponsePacket returns a response packet with a zero length, it must be set
+// once the packet is complete
+func newResponsePacket(pktType byte, id uint32) []byte {
+	pkt := []byte{0, 0, 0, 0, pktType}
+	return marshalUint32(pkt, id)
+}
+
+func newStatusPacket(id uint32, err error) []byte {
+	pkt := newResponsePacket(sshFxpStatus, id)
+	code, msg := getStatusCode(err)
+	pkt = marshalUint32(pkt, code)
+	pkt = marshalString(pkt, msg)
+	return marshalString(pkt, "")
+}
+
+func getStatusCode(err error) (uint32, string) {
+	if err == nil {
+		return sshFxOk, ""
+	}
+	switch {
+	case err == errBadMessage:
+		return sshFxBadMessage, err.Error()
+	case err == errHashNotSupported:
+		return sshFxOpUnsupported, err.Error()
+	case err == sftp.ErrSSHFxNoSuchFile, errors.Is(err, os.ErrNotExist):
+		return sshFxNoSuchFile, "no such file"
+	case err == sftp.ErrSSHFxPermissionDenied, errors.Is(err, os.ErrPermission):
+		return sshFxPermissionDenied, "permission denied"
+	case err == sftp.ErrSSHFxOpUnsupported:
+		return sshFxOpUnsupported, "operation unsupported"
+	default:
+		return sshFxFailure, fmt.Sprintf("failure: %v", err)
+	}
+}
+
+func marshalUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func marshalUint64(b []byte, v uint64) []byte {
+	return marshalUint32(marshalUint32(b, uint32(v>>32)), uint32(v))
+}
+
+func marshalString(b []byte, v string) []byte {
+	return append(marshalUint32(b, uint32(len(v))), v...)
+}
+
+func unmarshalUint32(b []byte) (uint32, []byte, error) {
+	if len(b) < 4 {
+		return 0, nil, errBadMessage
+	}
+	return binary.BigEndian.Uint32(b), b[4:], nil
+}
+
+func unmarshalUint64(b []byte) (uint64, []byte, error) {
+	if len(b) < 8 {
+		return 0, nil, errBadMessage
+	}
+	return binary.BigEndian.Uint64(b), b[8:], nil
+}
+
+func unmarshalString(b []byte) (string, []byte, error) {
+	n, b, err := unmarshalUint32(b)
+	if err != nil || uint32(len(b)) < n {
+		return "", nil, errBadMessage
+	}
+	return string(b[:n]), b[n:], nil
+}
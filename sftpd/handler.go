@@ -51,7 +51,7 @@ func (c *Connection) Fileread(request *sftp.Request) (io.ReaderAt, error) {
 		return nil, sftp.ErrSSHFxPermissionDenied
 	}
 
-	if !c.User.IsFileAllowed(request.Filepath) {
+	if !c.IsFileAllowed(request.Filepath) {
 		c.Log(logger.LevelWarn, "reading file %#v is not allowed", request.Filepath)
 		return nil, sftp.ErrSSHFxPermissionDenied
 	}
@@ -61,6 +61,10 @@ func (c *Connection) Fileread(request *sftp.Request) (io.ReaderAt, error) {
 		return nil, c.GetFsError(err)
 	}
 
+	if err := c.ExecutePreTransferAction(common.TransferDownload, p, request.Filepath, -1); err != nil {
+		return nil, err
+	}
+
 	file, r, cancelFn, err := c.Fs.Open(p, 0)
 	if err != nil {
 		c.Log(logger.LevelWarn, "could not open file %#v for reading: %+v", p, err)
@@ -87,7 +91,7 @@ func (c *Connection) Filewrite(request *sftp.Request) (io.WriterAt, error) {
 func (c *Connection) handleFilewrite(request *sftp.Request) (sftp.WriterAtReaderAt, error) {
 	c.UpdateLastActivity()
 
-	if !c.User.IsFileAllowed(request.Filepath) {
+	if !c.IsFileAllowed(request.Filepath) {
 		c.Log(logger.LevelWarn, "writing file %#v is not allowed", request.Filepath)
 		return nil, sftp.ErrSSHFxPermissionDenied
 	}
@@ -97,10 +101,7 @@ func (c *Connection) handleFilewrite(request *sftp.Request) (sftp.WriterAtReader
 		return nil, c.GetFsError(err)
 	}
 
-	filePath := p
-	if common.Config.IsAtomicUploadEnabled() && c.Fs.IsAtomicUploadSupported() {
-		filePath = c.Fs.GetAtomicUploadPath(p)
-	}
+	filePath := c.GetUploadPath(p)
 
 	var errForRead error
 	if !vfs.IsLocalOrSFTPFs(c.Fs) && request.Pflags().Read {
@@ -119,6 +120,9 @@ func (c *Connection) handleFilewrite(request *sftp.Request) (sftp.WriterAtReader
 		if !c.User.HasPerm(dataprovider.PermUpload, path.Dir(request.Filepath)) {
 			return nil, sftp.ErrSSHFxPermissionDenied
 		}
+		if err := c.ExecutePreTransferAction(common.TransferUpload, p, request.Filepath, 0); err != nil {
+			return nil, err
+		}
 		return c.handleSFTPUploadToNewFile(p, filePath, request.Filepath, errForRead)
 	}
 
@@ -136,6 +140,9 @@ func (c *Connection) handleFilewrite(request *sftp.Request) (sftp.WriterAtReader
 	if !c.User.HasPerm(dataprovider.PermOverwrite, path.Dir(request.Filepath)) {
 		return nil, sftp.ErrSSHFxPermissionDenied
 	}
+	if err := c.ExecutePreTransferAction(common.TransferUpload, p, request.Filepath, stat.Size()); err != nil {
+		return nil, err
+	}
 
 	return c.handleSFTPUploadToExistingFile(request.Pflags(), p, filePath, stat.Size(), request.Filepath, errForRead)
 }
@@ -203,6 +210,9 @@ func (c *Connection) Filelist(request *sftp.Request) (sftp.ListerAt, error) {
 		if !c.User.HasPerm(dataprovider.PermListItems, path.Dir(request.Filepath)) {
 			return nil, sftp.ErrSSHFxPermissionDenied
 		}
+		if c.IsReservedPath(request.Filepath) {
+			return nil, sftp.ErrSSHFxNoSuchFile
+		}
 
 		s, err := c.DoStat(p, 0)
 		if err != nil {
@@ -215,6 +225,9 @@ func (c *Connection) Filelist(request *sftp.Request) (sftp.ListerAt, error) {
 		if !c.User.HasPerm(dataprovider.PermListItems, path.Dir(request.Filepath)) {
 			return nil, sftp.ErrSSHFxPermissionDenied
 		}
+		if c.IsReservedPath(request.Filepath) {
+			return nil, sftp.ErrSSHFxNoSuchFile
+		}
 
 		s, err := c.Fs.Readlink(p)
 		if err != nil {
@@ -245,6 +258,9 @@ func (c *Connection) Lstat(request *sftp.Request) (sftp.ListerAt, error) {
 	if !c.User.HasPerm(dataprovider.PermListItems, path.Dir(request.Filepath)) {
 		return nil, sftp.ErrSSHFxPermissionDenied
 	}
+	if c.IsReservedPath(request.Filepath) {
+		return nil, sftp.ErrSSHFxNoSuchFile
+	}
 
 	s, err := c.DoStat(p, 1)
 	if err != nil {
@@ -390,16 +406,23 @@ func (c *Connection) handleSFTPUploadToExistingFile(pflags sftp.FileOpenFlags, r
 		return nil, err
 	}
 
-	if common.Config.IsAtomicUploadEnabled() && c.Fs.IsAtomicUploadSupported() {
+	if c.IsExistingFileMovedForUpload(resolvedPath, filePath) {
 		err = c.Fs.Rename(resolvedPath, filePath)
 		if err != nil {
-			c.Log(logger.LevelWarn, "error renaming existing file for atomic upload, source: %#v, dest: %#v, err: %+v",
+			c.Log(logger.LevelWarn, "error renaming existing file for upload, source: %#v, dest: %#v, err: %+v",
 				resolvedPath, filePath, err)
 			return nil, c.GetFsError(err)
 		}
 	}
 
-	file, w, cancelFn, err := c.Fs.Create(filePath, osFlags)
+	var file vfs.File
+	var w *vfs.PipeWriter
+	var cancelFn func()
+	if isResume {
+		file, w, cancelFn, err = vfs.CreateForResume(c.Fs, filePath, osFlags, fileSize)
+	} else {
+		file, w, cancelFn, err = c.Fs.Create(filePath, osFlags)
+	}
 	if err != nil {
 		c.Log(logger.LevelWarn, "error opening existing file, flags: %v, source: %#v, err: %+v", pflags, filePath, err)
 		return nil, c.GetFsError(err)
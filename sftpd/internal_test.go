@@ -2,10 +2,12 @@ package sftpd
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"net"
 	"os"
 	"path/filepath"
@@ -2011,3 +2013,168 @@ func newFakeListener(err error) net.Listener {
 		err:    err,
 	}
 }
+
+func TestExtensionsChannel(t *testing.T) {
+	mockSSHChannel := &MockChannel{
+		Buffer:       bytes.NewBuffer(nil),
+		StdErrBuffer: bytes.NewBuffer(nil),
+	}
+	connection := &Connection{
+		BaseConnection: common.NewBaseConnection("", common.ProtocolSFTP, dataprovider.User{}, nil),
+	}
+	connection.GetSessionWorkingDir().Set("/start")
+	e := newExtensionsChannel(mockSSHChannel, connection)
+	// open request, the relative path is resolved against the working directory
+	newOpenPacket := func(name string) []byte {
+		pkt := newResponsePacket(sshFxpOpen, 1)
+		pkt = marshalString(pkt, name)
+		pkt = marshalUint32(pkt, 1)
+		pkt = marshalUint32(pkt, 0)
+		binary.BigEndian.PutUint32(pkt, uint32(len(pkt)-4))
+		return pkt
+	}
+	pkt := newOpenPacket("file")
+	// data request, it is passed through
+	data := newResponsePacket(sshFxpWrite, 2)
+	data = marshalString(data, "handle")
+	data = marshalUint64(data, 0)
+	data = marshalString(data, "data")
+	binary.BigEndian.PutUint32(data, uint32(len(data)-4))
+	mockSSHChannel.Buffer.Write(pkt)
+	mockSSHChannel.Buffer.Write(data)
+	read, err := io.ReadAll(e)
+	assert.NoError(t, err)
+	assert.Equal(t, append(newOpenPacket("/start/file"), data...), read)
+	assert.Equal(t, "/start/file", e.opens[1])
+	// the responses can be split across multiple writes
+	version := []byte{0, 0, 0, 5, sshFxpVersion, 0, 0, 0, 3}
+	handle := newResponsePacket(sshFxpHandle, 1)
+	handle = marshalString(handle, "1")
+	binary.BigEndian.PutUint32(handle, uint32(len(handle)-4))
+	data = newResponsePacket(sshFxpData, 3)
+	data = marshalString(data, "some data")
+	binary.BigEndian.PutUint32(data, uint32(len(data)-4))
+	response := append(append(append([]byte{}, version...), data...), handle...)
+	for _, chunk := range [][]byte{response[:3], response[3:12], response[12:30], response[30:]} {
+		n, err := e.Write(chunk)
+		assert.NoError(t, err)
+		assert.Equal(t, len(chunk), n)
+	}
+	written := mockSSHChannel.Buffer.Bytes()
+	length := binary.BigEndian.Uint32(written)
+	require.Greater(t, length, uint32(5))
+	assert.Contains(t, string(written[:4+length]), extCopyData)
+	assert.Equal(t, append(append([]byte{}, data...), handle...), written[4+length:])
+	assert.Len(t, e.opens, 0)
+	clientPath, err := e.getHandlePath("1")
+	assert.NoError(t, err)
+	assert.Equal(t, "/start/file", clientPath)
+	// close request
+	pkt = newResponsePacket(sshFxpClose, 4)
+	pkt = marshalString(pkt, "1")
+	binary.BigEndian.PutUint32(pkt, uint32(len(pkt)-4))
+	mockSSHChannel.Buffer.Reset()
+	mockSSHChannel.Buffer.Write(pkt)
+	_, err = io.ReadAll(e)
+	assert.NoError(t, err)
+	_, err = e.getHandlePath("1")
+	assert.ErrorIs(t, err, errHandleNotFound)
+	// the supported extended requests are not forwarded
+	pkt = newResponsePacket(sshFxpExtended, 5)
+	pkt = marshalString(pkt, extCopyFile)
+	binary.BigEndian.PutUint32(pkt, uint32(len(pkt)-4))
+	mockSSHChannel.Buffer.Write(pkt)
+	read, err = io.ReadAll(e)
+	assert.NoError(t, err)
+	assert.Len(t, read, 0)
+	e.Wait()
+	code, _ := getStatusCode(unmarshalStatus(t, mockSSHChannel.Buffer.Bytes(), 5))
+	assert.Equal(t, uint32(sshFxBadMessage), code)
+	// the request paths follow the working directory changes
+	connection.GetSessionWorkingDir().Set("/changed")
+	newRenamePacket := func(pktType byte, extension, source, target string) []byte {
+		pkt := newResponsePacket(pktType, 6)
+		if extension != "" {
+			pkt = marshalString(pkt, extension)
+		}
+		pkt = marshalString(pkt, source)
+		pkt = marshalString(pkt, target)
+		binary.BigEndian.PutUint32(pkt, uint32(len(pkt)-4))
+		return pkt
+	}
+	for _, extension := range []string{"", "posix-rename@openssh.com"} {
+		pktType := byte(sshFxpRename)
+		if extension != "" {
+			pktType = sshFxpExtended
+		}
+		mockSSHChannel.Buffer.Reset()
+		mockSSHChannel.Buffer.Write(newRenamePacket(pktType, extension, "../a", "/dir/./b"))
+		read, err = io.ReadAll(e)
+		assert.NoError(t, err)
+		assert.Equal(t, newRenamePacket(pktType, extension, "/a", "/dir/b"), read)
+	}
+	// the paths of the unknown extended requests and of the malformed requests are not changed
+	for _, pkt := range [][]byte{newRenamePacket(sshFxpExtended, "unknown@example.com", "a", "b"),
+		{0, 0, 0, 3, sshFxpStat, 0, 0}} {
+		mockSSHChannel.Buffer.Reset()
+		mockSSHChannel.Buffer.Write(pkt)
+		read, err = io.ReadAll(e)
+		assert.NoError(t, err)
+		assert.Equal(t, pkt, read)
+	}
+	// invalid packet
+	mockSSHChannel.Buffer.Reset()
+	mockSSHChannel.Buffer.Write([]byte{0, 0, 0, 0, sshFxpExtended})
+	_, err = io.ReadAll(e)
+	assert.ErrorIs(t, err, errBadMessage)
+	assert.NoError(t, e.Close())
+}
+
+func TestExtensionsHelpers(t *testing.T) {
+	code, _ := getStatusCode(nil)
+	assert.Equal(t, uint32(sshFxOk), code)
+	code, _ = getStatusCode(sftp.ErrSSHFxNoSuchFile)
+	assert.Equal(t, uint32(sshFxNoSuchFile), code)
+	code, _ = getStatusCode(os.ErrNotExist)
+	assert.Equal(t, uint32(sshFxNoSuchFile), code)
+	code, _ = getStatusCode(sftp.ErrSSHFxPermissionDenied)
+	assert.Equal(t, uint32(sshFxPermissionDenied), code)
+	code, _ = getStatusCode(sftp.ErrSSHFxOpUnsupported)
+	assert.Equal(t, uint32(sshFxOpUnsupported), code)
+	code, _ = getStatusCode(errHashNotSupported)
+	assert.Equal(t, uint32(sshFxOpUnsupported), code)
+	code, msg := getStatusCode(errors.New("generic error"))
+	assert.Equal(t, uint32(sshFxFailure), code)
+	assert.Contains(t, msg, "generic error")
+
+	algorithm, newHash := getCheckFileHash("crc32, sha384,md5")
+	assert.Equal(t, "sha384", algorithm)
+	assert.NotNil(t, newHash)
+	_, newHash = getCheckFileHash("crc32")
+	assert.Nil(t, newHash)
+
+	_, _, err := unmarshalUint32([]byte{0, 1})
+	assert.ErrorIs(t, err, errBadMessage)
+	_, _, err = unmarshalUint64([]byte{0, 1, 2, 3})
+	assert.ErrorIs(t, err, errBadMessage)
+	_, _, err = unmarshalString([]byte{0, 0, 0, 5, 'a'})
+	assert.ErrorIs(t, err, errBadMessage)
+	v, rest, err := unmarshalUint64(marshalUint64(nil, math.MaxUint32+1))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(math.MaxUint32+1), v)
+	assert.Len(t, rest, 0)
+}
+
+func unmarshalStatus(t *testing.T, pkt []byte, id uint32) error {
+	require.GreaterOrEqual(t, len(pkt), 13)
+	assert.Equal(t, uint8(sshFxpStatus), pkt[4])
+	assert.Equal(t, id, binary.BigEndian.Uint32(pkt[5:]))
+	switch binary.BigEndian.Uint32(pkt[9:]) {
+	case sshFxOk:
+		return nil
+	case sshFxBadMessage:
+		return errBadMessage
+	default:
+		return errors.New("unexpected status")
+	}
+}
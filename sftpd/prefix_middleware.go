@@ -3,23 +3,15 @@ package sftpd
 import (
 	"io"
 	"os"
-	"path"
-	"path/filepath"
-	"strings"
 	"time"
 
 	"github.com/pkg/sftp"
 
+	"github.com/drakkan/sftpgo/common"
 	"github.com/drakkan/sftpgo/vfs"
 )
 
-type PrefixMatch uint8
-
 const (
-	PathContainsPrefix PrefixMatch = iota
-	PathIsPrefixParent
-	PathDiverged
-
 	methodList = `List`
 	methodStat = `Stat`
 )
@@ -38,16 +30,15 @@ var _ Middleware = &prefixMiddleware{}
 var _ Middleware = &Connection{}
 
 type prefixMiddleware struct {
-	prefix string
-	next   Middleware
+	mapping common.PrefixMapping
+	next    Middleware
 }
 
 func (p *prefixMiddleware) Lstat(request *sftp.Request) (sftp.ListerAt, error) {
-	switch GetPrefixHierarchy(p.prefix, request.Filepath) {
-	case PathContainsPrefix:
-		request.Filepath, _ = p.removeFolderPrefix(request.Filepath)
+	switch p.resolve(request) {
+	case common.PathContainsPrefix:
 		return p.next.Lstat(request)
-	case PathIsPrefixParent:
+	case common.PathIsPrefixParent:
 		return listerAt([]os.FileInfo{
 			vfs.NewFileInfo(request.Filepath, true, 0, time.Now(), false),
 		}), nil
@@ -57,9 +48,8 @@ func (p *prefixMiddleware) Lstat(request *sftp.Request) (sftp.ListerAt, error) {
 }
 
 func (p *prefixMiddleware) OpenFile(request *sftp.Request) (sftp.WriterAtReaderAt, error) {
-	switch GetPrefixHierarchy(p.prefix, request.Filepath) {
-	case PathContainsPrefix:
-		request.Filepath, _ = p.removeFolderPrefix(request.Filepath)
+	switch p.resolve(request) {
+	case common.PathContainsPrefix:
 		return p.next.OpenFile(request)
 	default:
 		return nil, sftp.ErrSSHFxPermissionDenied
@@ -67,19 +57,19 @@ func (p *prefixMiddleware) OpenFile(request *sftp.Request) (sftp.WriterAtReaderA
 }
 
 func (p *prefixMiddleware) Filelist(request *sftp.Request) (sftp.ListerAt, error) {
-	switch GetPrefixHierarchy(p.prefix, request.Filepath) {
-	case PathContainsPrefix:
-		request.Filepath, _ = p.removeFolderPrefix(request.Filepath)
+	switch p.resolve(request) {
+	case common.PathContainsPrefix:
 		return p.next.Filelist(request)
-	case PathIsPrefixParent:
+	case common.PathIsPrefixParent:
 		Now := time.Now()
 		switch request.Method {
 		case methodList:
-			FileName := p.nextListFolder(request.Filepath)
-			return listerAt([]os.FileInfo{
-				// vfs.NewFileInfo(`.`, true, 0, Now, false),
-				vfs.NewFileInfo(FileName, true, 0, Now, false),
-			}), nil
+			// the merged next folders of the mappings below this parent
+			var Files []os.FileInfo
+			for _, FileName := range p.mapping.ListParent(request.Filepath) {
+				Files = append(Files, vfs.NewFileInfo(FileName, true, 0, Now, false))
+			}
+			return listerAt(Files), nil
 		case methodStat:
 			return listerAt([]os.FileInfo{
 				vfs.NewFileInfo(request.Filepath, true, 0, Now, false),
@@ -93,10 +83,9 @@ func (p *prefixMiddleware) Filelist(request *sftp.Request) (sftp.ListerAt, error
 }
 
 func (p *prefixMiddleware) Filewrite(request *sftp.Request) (io.WriterAt, error) {
-	switch GetPrefixHierarchy(p.prefix, request.Filepath) {
-	case PathContainsPrefix:
+	switch p.resolve(request) {
+	case common.PathContainsPrefix:
 		// forward to next handler
-		request.Filepath, _ = p.removeFolderPrefix(request.Filepath)
 		return p.next.Filewrite(request)
 	default:
 		return nil, sftp.ErrSSHFxPermissionDenied
@@ -104,9 +93,8 @@ func (p *prefixMiddleware) Filewrite(request *sftp.Request) (io.WriterAt, error)
 }
 
 func (p *prefixMiddleware) Fileread(request *sftp.Request) (io.ReaderAt, error) {
-	switch GetPrefixHierarchy(p.prefix, request.Filepath) {
-	case PathContainsPrefix:
-		request.Filepath, _ = p.removeFolderPrefix(request.Filepath)
+	switch p.resolve(request) {
+	case common.PathContainsPrefix:
 		return p.next.Fileread(request)
 	default:
 		return nil, sftp.ErrSSHFxPermissionDenied
@@ -116,18 +104,22 @@ func (p *prefixMiddleware) Fileread(request *sftp.Request) (io.ReaderAt, error)
 func (p *prefixMiddleware) Filecmd(request *sftp.Request) error {
 	switch request.Method {
 	case "Rename", "Symlink":
-		if GetPrefixHierarchy(p.prefix, request.Filepath) == PathContainsPrefix &&
-			GetPrefixHierarchy(p.prefix, request.Target) == PathContainsPrefix {
-			request.Filepath, _ = p.removeFolderPrefix(request.Filepath)
-			request.Target, _ = p.removeFolderPrefix(request.Target)
-			return p.next.Filecmd(request)
+		// commands have a source and destination (file path and target path)
+		Filepath, SourceIdx, SourceMatch := p.mapping.Resolve(request.Filepath)
+		Target, TargetIdx, TargetMatch := p.mapping.Resolve(request.Target)
+		if SourceMatch != common.PathContainsPrefix || TargetMatch != common.PathContainsPrefix {
+			return sftp.ErrSSHFxPermissionDenied
 		}
-		return sftp.ErrSSHFxPermissionDenied
-	// commands have a source and destination (file path and target path)
+		if SourceIdx != TargetIdx {
+			// the mappings are like different mount points
+			return sftp.ErrSSHFxOpUnsupported
+		}
+		request.Filepath = Filepath
+		request.Target = Target
+		return p.next.Filecmd(request)
 	case "Setstat", "Rmdir", "Mkdir", "Remove":
 		// commands just the file path
-		if GetPrefixHierarchy(p.prefix, request.Filepath) == PathContainsPrefix {
-			request.Filepath, _ = p.removeFolderPrefix(request.Filepath)
+		if p.resolve(request) == common.PathContainsPrefix {
 			return p.next.Filecmd(request)
 		}
 		return sftp.ErrSSHFxPermissionDenied
@@ -137,95 +129,28 @@ func (p *prefixMiddleware) Filecmd(request *sftp.Request) error {
 }
 
 func (p *prefixMiddleware) StatVFS(request *sftp.Request) (*sftp.StatVFS, error) {
-	switch GetPrefixHierarchy(p.prefix, request.Filepath) {
-	case PathContainsPrefix:
+	switch p.resolve(request) {
+	case common.PathContainsPrefix:
 		// forward to next handler
-		request.Filepath, _ = p.removeFolderPrefix(request.Filepath)
 		return p.next.StatVFS(request)
 	default:
 		return nil, sftp.ErrSSHFxPermissionDenied
 	}
 }
 
-func (p *prefixMiddleware) nextListFolder(requestPath string) string {
-	cleanPath := filepath.Clean(`/` + requestPath)
-	cleanPrefix := filepath.Clean(`/` + p.prefix)
-
-	FileName := cleanPrefix[len(cleanPath):]
-	FileName = strings.TrimLeft(FileName, `/`)
-	SlashIndex := strings.Index(FileName, `/`)
-	if SlashIndex > 0 {
-		return FileName[0:SlashIndex]
+// resolve replaces the request file path with the mapped one if the path is
+// inside a mapping and returns how the path relates to the mappings
+func (p *prefixMiddleware) resolve(request *sftp.Request) common.PrefixMatch {
+	Filepath, _, Match := p.mapping.Resolve(request.Filepath)
+	if Match == common.PathContainsPrefix {
+		request.Filepath = Filepath
 	}
-	return FileName
+	return Match
 }
 
-func NewPrefixMiddleware(prefix string, next Middleware) Middleware {
+func NewPrefixMiddleware(mapping common.PrefixMapping, next Middleware) Middleware {
 	return &prefixMiddleware{
-		prefix: prefix,
-		next:   next,
-	}
-}
-
-func (p *prefixMiddleware) containsPrefix(virtualPath string) bool {
-	if !path.IsAbs(virtualPath) {
-		virtualPath = path.Clean(`/` + virtualPath)
-	}
-
-	if p.prefix == `/` || p.prefix == `` {
-		return true
-	} else if p.prefix == virtualPath {
-		return true
-	}
-
-	return strings.HasPrefix(virtualPath, p.prefix+`/`)
-}
-
-func (p *prefixMiddleware) removeFolderPrefix(virtualPath string) (string, bool) {
-	if p.prefix == `/` || p.prefix == `` {
-		return virtualPath, true
-	}
-
-	virtualPath = filepath.Clean(`/` + virtualPath)
-	if p.containsPrefix(virtualPath) {
-		effectivePath := virtualPath[len(p.prefix):]
-		if effectivePath == `` {
-			effectivePath = `/`
-		}
-		return effectivePath, true
+		mapping: mapping,
+		next:    next,
 	}
-	return virtualPath, false
-}
-
-func GetPrefixHierarchy(prefix, path string) PrefixMatch {
-	prefixSplit := strings.Split(filepath.Clean(`/`+prefix), `/`)
-	pathSplit := strings.Split(filepath.Clean(`/`+path), `/`)
-
-	for {
-		// stop if either slice is empty of the current head elements do not match
-		if len(prefixSplit) == 0 || len(pathSplit) == 0 ||
-			prefixSplit[0] != pathSplit[0] {
-			break
-		}
-		prefixSplit = prefixSplit[1:]
-		pathSplit = pathSplit[1:]
-	}
-
-	// The entire Prefix is included in Test Path
-	// Example: Prefix (/files) with Test Path (/files/test.csv)
-	if len(prefixSplit) == 0 ||
-		(len(prefixSplit) == 1 && prefixSplit[0] == ``) {
-		return PathContainsPrefix
-	}
-
-	// Test Path is part of the Prefix Hierarchy
-	// Example: Prefix (/files) with Test Path (/)
-	if len(pathSplit) == 0 ||
-		(len(pathSplit) == 1 && pathSplit[0] == ``) {
-		return PathIsPrefixParent
-	}
-
-	// Test Path is not with the Prefix Hierarchy
-	// Example: Prefix (/files) with Test Path (/files2)
-	return PathDiverged
 }
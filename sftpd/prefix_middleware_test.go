@@ -8,6 +8,8 @@ import (
 	"github.com/pkg/sftp"
 	"github.com/stretchr/testify/suite"
 
+	"github.com/drakkan/sftpgo/common"
+	"github.com/drakkan/sftpgo/dataprovider"
 	"github.com/drakkan/sftpgo/sftpd/mocks"
 )
 
@@ -25,7 +27,7 @@ func (Suite *PrefixMiddlewareSuite) AfterTest(_, _ string) {
 }
 
 func (Suite *PrefixMiddlewareSuite) TestFileWriter() {
-	prefix := prefixMiddleware{prefix: `/files`}
+	prefix := prefixMiddleware{mapping: newPrefixMapping(`/files`)}
 
 	// parent of prefix
 	WriterAt, err := prefix.Filewrite(&sftp.Request{Filepath: `/`})
@@ -50,7 +52,7 @@ func (Suite *PrefixMiddlewareSuite) TestFileWriter() {
 }
 
 func (Suite *PrefixMiddlewareSuite) TestFileReader() {
-	middleware := prefixMiddleware{prefix: `/files`}
+	middleware := prefixMiddleware{mapping: newPrefixMapping(`/files`)}
 
 	// parent of prefix
 	ReaderAt, err := middleware.Fileread(&sftp.Request{Filepath: `/`})
@@ -75,7 +77,7 @@ func (Suite *PrefixMiddlewareSuite) TestFileReader() {
 }
 
 func (Suite *PrefixMiddlewareSuite) TestOpenFile() {
-	middleware := prefixMiddleware{prefix: `/files`}
+	middleware := prefixMiddleware{mapping: newPrefixMapping(`/files`)}
 
 	ReadWriteAt, err := middleware.OpenFile(&sftp.Request{Filepath: `/`})
 	Suite.Nil(ReadWriteAt)
@@ -128,7 +130,7 @@ func (Suite *PrefixMiddlewareSuite) TestFileListForwarding() {
 				Filepath: test.FwdPath,
 			}).Return(nil, nil)
 
-		handlers := NewPrefixMiddleware(`/files`, FileListMock)
+		handlers := NewPrefixMiddleware(newPrefixMapping(`/files`), FileListMock)
 		ListerAt, err := handlers.Filelist(&sftp.Request{
 			Method:   test.Method,
 			Filepath: test.FilePath,
@@ -152,7 +154,7 @@ func (Suite *PrefixMiddlewareSuite) TestFileList() {
 	}
 
 	for _, test := range tests {
-		middleware := prefixMiddleware{prefix: `/files`}
+		middleware := prefixMiddleware{mapping: newPrefixMapping(`/files`)}
 		ListerAt, err := middleware.Filelist(&sftp.Request{
 			Method:   test.Method,
 			Filepath: test.FilePath,
@@ -174,7 +176,7 @@ func (Suite *PrefixMiddlewareSuite) TestFileList() {
 }
 
 func (Suite *PrefixMiddlewareSuite) TestLstat() {
-	middleware := prefixMiddleware{prefix: `/files`}
+	middleware := prefixMiddleware{mapping: newPrefixMapping(`/files`)}
 	ListerAt, err := middleware.Lstat(&sftp.Request{Filepath: `/`})
 	Suite.Nil(err)
 	Suite.IsType(listerAt{}, ListerAt)
@@ -185,7 +187,7 @@ func (Suite *PrefixMiddlewareSuite) TestLstat() {
 		Suite.True(directList[0].IsDir())
 	}
 
-	middleware = prefixMiddleware{prefix: `/files`}
+	middleware = prefixMiddleware{mapping: newPrefixMapping(`/files`)}
 	ListerAt, err = middleware.Lstat(&sftp.Request{Filepath: `/random`})
 	Suite.Nil(ListerAt)
 	Suite.Equal(sftp.ErrSSHFxPermissionDenied, err)
@@ -194,7 +196,7 @@ func (Suite *PrefixMiddlewareSuite) TestLstat() {
 	MockLstat.EXPECT().
 		Lstat(&sftp.Request{Filepath: "/data"}).
 		Return(nil, nil)
-	middleware = prefixMiddleware{prefix: `/files`}
+	middleware = prefixMiddleware{mapping: newPrefixMapping(`/files`)}
 	middleware.next = MockLstat
 
 	ListerAt, err = middleware.Lstat(&sftp.Request{Filepath: `/files/data`})
@@ -230,8 +232,8 @@ func (Suite *PrefixMiddlewareSuite) TestFileCmdForwarding() {
 			}).Return(nil)
 
 		middleware := prefixMiddleware{
-			prefix: `/files`,
-			next:   FileCmdMock,
+			mapping: newPrefixMapping(`/files`),
+			next:    FileCmdMock,
 		}
 
 		Suite.Nil(middleware.Filecmd(&sftp.Request{
@@ -243,7 +245,7 @@ func (Suite *PrefixMiddlewareSuite) TestFileCmdForwarding() {
 }
 
 func (Suite *PrefixMiddlewareSuite) TestFileCmdErrors() {
-	middleware := prefixMiddleware{prefix: `/files`}
+	middleware := prefixMiddleware{mapping: newPrefixMapping(`/files`)}
 
 	var tests = []struct {
 		Method      string
@@ -283,44 +285,68 @@ func (Suite *PrefixMiddlewareSuite) TestFileCmdErrors() {
 }
 
 func (Suite *PrefixMiddlewareSuite) TestNextFolder() {
-	prefix := prefixMiddleware{prefix: `/files/data`}
-	Suite.Equal(`files`, prefix.nextListFolder(`/`))
-	Suite.Equal(`files`, prefix.nextListFolder(``))
-	Suite.Equal(`data`, prefix.nextListFolder(`/files`))
-	Suite.Equal(`data`, prefix.nextListFolder(`files`))
-	Suite.Equal(`data`, prefix.nextListFolder(`files/`))
-
-	prefix = prefixMiddleware{prefix: `files/data`}
-	Suite.Equal(`files`, prefix.nextListFolder(`/`))
-	Suite.Equal(`files`, prefix.nextListFolder(``))
-	Suite.Equal(`data`, prefix.nextListFolder(`/files`))
-	Suite.Equal(`data`, prefix.nextListFolder(`files`))
-	Suite.Equal(`data`, prefix.nextListFolder(`files/`))
+	mapping := newPrefixMapping(`/files/data`)
+	Suite.Equal([]string{`files`}, mapping.ListParent(`/`))
+	Suite.Equal([]string{`files`}, mapping.ListParent(``))
+	Suite.Equal([]string{`data`}, mapping.ListParent(`/files`))
+	Suite.Equal([]string{`data`}, mapping.ListParent(`files`))
+	Suite.Equal([]string{`data`}, mapping.ListParent(`files/`))
+
+	mapping = newPrefixMapping(`files/data`)
+	Suite.Equal([]string{`files`}, mapping.ListParent(`/`))
+	Suite.Equal([]string{`data`}, mapping.ListParent(`files/`))
 }
 
-func (Suite *PrefixMiddlewareSuite) TestContainsPrefix() {
-	prefix := prefixMiddleware{prefix: `/`}
-	Suite.True(prefix.containsPrefix(`/data`))
-	Suite.True(prefix.containsPrefix(`/`))
+func (Suite *PrefixMiddlewareSuite) TestMultipleMappings() {
+	middleware := prefixMiddleware{mapping: common.NewPrefixMapping([]dataprovider.FolderMapping{
+		{Prefix: `/outbound`, MappedPath: `/out`},
+		{Prefix: `/inbound`, MappedPath: `/in`},
+		{Prefix: `/archive/2020`, MappedPath: `/old/2020`},
+		{Prefix: `/archive/2021`, MappedPath: `/old/2021`},
+	})}
 
-	prefix = prefixMiddleware{prefix: `/files`}
-	Suite.True(prefix.containsPrefix(`files`))
-}
+	// the parent listings are merged and sorted
+	ListerAt, err := middleware.Filelist(&sftp.Request{Method: methodList, Filepath: `/`})
+	Suite.Nil(err)
+	if directList, ok := ListerAt.(listerAt); Suite.True(ok) && Suite.Len(directList, 3) {
+		Suite.Equal(`archive`, directList[0].Name())
+		Suite.Equal(`inbound`, directList[1].Name())
+		Suite.Equal(`outbound`, directList[2].Name())
+	}
+	ListerAt, err = middleware.Filelist(&sftp.Request{Method: methodList, Filepath: `/archive`})
+	Suite.Nil(err)
+	if directList, ok := ListerAt.(listerAt); Suite.True(ok) && Suite.Len(directList, 2) {
+		Suite.Equal(`2020`, directList[0].Name())
+		Suite.Equal(`2021`, directList[1].Name())
+	}
 
-func (Suite *PrefixMiddlewareSuite) TestRemoveFolderPrefix() {
-	prefix := prefixMiddleware{prefix: `/`}
-	path, ok := prefix.removeFolderPrefix(`/files`)
-	Suite.Equal(`/files`, path)
-	Suite.True(ok)
+	MockList := mocks.NewMockMiddleware(Suite.MockCtl)
+	MockList.EXPECT().
+		Filelist(&sftp.Request{Method: methodList, Filepath: `/old/2021/sub`}).
+		Return(nil, nil)
+	middleware.next = MockList
+	_, err = middleware.Filelist(&sftp.Request{Method: methodList, Filepath: `/archive/2021/sub`})
+	Suite.Nil(err)
 
-	prefix = prefixMiddleware{prefix: `/files`}
-	path, ok = prefix.removeFolderPrefix(`files`)
-	Suite.Equal(`/`, path)
-	Suite.True(ok)
+	// renames inside a mapping are forwarded
+	MockCmd := mocks.NewMockMiddleware(Suite.MockCtl)
+	MockCmd.EXPECT().
+		Filecmd(&sftp.Request{Method: `Rename`, Filepath: `/in/a.csv`, Target: `/in/sub/a.csv`}).
+		Return(nil)
+	middleware.next = MockCmd
+	Suite.Nil(middleware.Filecmd(&sftp.Request{Method: `Rename`, Filepath: `/inbound/a.csv`,
+		Target: `/inbound/sub/a.csv`}))
+	// renames between different mappings are not supported
+	Suite.Equal(sftp.ErrSSHFxOpUnsupported, middleware.Filecmd(&sftp.Request{Method: `Rename`,
+		Filepath: `/inbound/a.csv`, Target: `/outbound/a.csv`}))
+	Suite.Equal(sftp.ErrSSHFxOpUnsupported, middleware.Filecmd(&sftp.Request{Method: `Symlink`,
+		Filepath: `/archive/2020/a.csv`, Target: `/archive/2021/a.csv`}))
+	Suite.Equal(sftp.ErrSSHFxPermissionDenied, middleware.Filecmd(&sftp.Request{Method: `Rename`,
+		Filepath: `/inbound/a.csv`, Target: `/archive/a.csv`}))
+}
 
-	path, ok = prefix.removeFolderPrefix(`/random`)
-	Suite.Equal(`/random`, path)
-	Suite.False(ok)
+func newPrefixMapping(Prefix string) common.PrefixMapping {
+	return common.NewPrefixMapping([]dataprovider.FolderMapping{{Prefix: Prefix, MappedPath: `/`}})
 }
 
 func TestFolderPrefixSuite(t *testing.T) {
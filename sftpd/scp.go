@@ -11,6 +11,7 @@ import (
 	"runtime/debug"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/drakkan/sftpgo/common"
 	"github.com/drakkan/sftpgo/dataprovider"
@@ -28,6 +29,9 @@ var (
 
 type scpCommand struct {
 	sshCommand
+	// name sent to the client for the downloaded root directory, if it differs
+	// from the mapped one
+	rootDirName string
 }
 
 func (c *scpCommand) handle() (err error) {
@@ -46,8 +50,18 @@ func (c *scpCommand) handle() (err error) {
 		return nil
 	}
 
-	destPath := c.getDestPath()
+	// relative paths are resolved against the session working directory
+	c.applyWorkingDir()
 	commandType := c.getCommandType()
+	if commandType == "-t" {
+		// uploads are only allowed inside the folder prefix
+		if err = c.applyFolderPrefix(); err != nil {
+			c.sendErrorMessage(err)
+			c.sendExitStatus(err)
+			return err
+		}
+	}
+	destPath := c.getDestPath()
 	c.connection.Log(logger.LevelDebug, "handle scp command, args: %v user: %v command type: %v, dest path: %#v",
 		c.args, c.connection.User.Username, commandType, destPath)
 	if commandType == "-t" {
@@ -66,7 +80,7 @@ func (c *scpCommand) handle() (err error) {
 		if err != nil {
 			return err
 		}
-		err = c.handleDownload(destPath)
+		err = c.handlePrefixDownload(destPath)
 		if err != nil {
 			return err
 		}
@@ -138,7 +152,7 @@ func (c *scpCommand) handleCreateDir(dirPath string) error {
 		return common.ErrPermissionDenied
 	}
 
-	err = c.createDir(p)
+	err = c.createDir(p, dirPath)
 	if err != nil {
 		return err
 	}
@@ -248,7 +262,7 @@ func (c *scpCommand) handleUpload(uploadFilePath string, sizeToRead int64) error
 
 	var err error
 
-	if !c.connection.User.IsFileAllowed(uploadFilePath) {
+	if !c.connection.IsFileAllowed(uploadFilePath) {
 		c.connection.Log(logger.LevelWarn, "writing file %#v is not allowed", uploadFilePath)
 		c.sendErrorMessage(common.ErrPermissionDenied)
 		return common.ErrPermissionDenied
@@ -260,10 +274,7 @@ func (c *scpCommand) handleUpload(uploadFilePath string, sizeToRead int64) error
 		c.sendErrorMessage(err)
 		return err
 	}
-	filePath := p
-	if common.Config.IsAtomicUploadEnabled() && c.connection.Fs.IsAtomicUploadSupported() {
-		filePath = c.connection.Fs.GetAtomicUploadPath(p)
-	}
+	filePath := c.connection.GetUploadPath(p)
 	stat, statErr := c.connection.Fs.Lstat(p)
 	if (statErr == nil && stat.Mode()&os.ModeSymlink != 0) || c.connection.Fs.IsNotExist(statErr) {
 		if !c.connection.User.HasPerm(dataprovider.PermUpload, path.Dir(uploadFilePath)) {
@@ -271,6 +282,10 @@ func (c *scpCommand) handleUpload(uploadFilePath string, sizeToRead int64) error
 			c.sendErrorMessage(common.ErrPermissionDenied)
 			return common.ErrPermissionDenied
 		}
+		if err = c.connection.ExecutePreTransferAction(common.TransferUpload, p, uploadFilePath, 0); err != nil {
+			c.sendErrorMessage(err)
+			return err
+		}
 		return c.handleUploadFile(p, filePath, sizeToRead, true, 0, uploadFilePath)
 	}
 
@@ -292,11 +307,15 @@ func (c *scpCommand) handleUpload(uploadFilePath string, sizeToRead int64) error
 		c.sendErrorMessage(common.ErrPermissionDenied)
 		return common.ErrPermissionDenied
 	}
+	if err = c.connection.ExecutePreTransferAction(common.TransferUpload, p, uploadFilePath, stat.Size()); err != nil {
+		c.sendErrorMessage(err)
+		return err
+	}
 
-	if common.Config.IsAtomicUploadEnabled() && c.connection.Fs.IsAtomicUploadSupported() {
+	if c.connection.IsExistingFileMovedForUpload(p, filePath) {
 		err = c.connection.Fs.Rename(p, filePath)
 		if err != nil {
-			c.connection.Log(logger.LevelError, "error renaming existing file for atomic upload, source: %#v, dest: %#v, err: %v",
+			c.connection.Log(logger.LevelError, "error renaming existing file for upload, source: %#v, dest: %#v, err: %v",
 				p, filePath, err)
 			c.sendErrorMessage(err)
 			return err
@@ -307,6 +326,22 @@ func (c *scpCommand) handleUpload(uploadFilePath string, sizeToRead int64) error
 }
 
 func (c *scpCommand) sendDownloadProtocolMessages(dirPath string, stat os.FileInfo) error {
+	dirName := filepath.Base(dirPath)
+	for _, v := range c.connection.User.VirtualFolders {
+		if v.MappedPath == dirPath {
+			dirName = path.Base(v.VirtualPath)
+			break
+		}
+	}
+	// the root directory is seen by the client with the requested name
+	if c.rootDirName != "" {
+		dirName = c.rootDirName
+		c.rootDirName = ""
+	}
+	return c.sendDirProtocolMessages(dirName, stat)
+}
+
+func (c *scpCommand) sendDirProtocolMessages(dirName string, stat os.FileInfo) error {
 	var err error
 	if c.sendFileTime() {
 		modTime := stat.ModTime().UnixNano() / 1000000000
@@ -321,14 +356,6 @@ func (c *scpCommand) sendDownloadProtocolMessages(dirPath string, stat os.FileIn
 		}
 	}
 
-	dirName := filepath.Base(dirPath)
-	for _, v := range c.connection.User.VirtualFolders {
-		if v.MappedPath == dirPath {
-			dirName = path.Base(v.VirtualPath)
-			break
-		}
-	}
-
 	fileMode := fmt.Sprintf("D%v 0 %v\n", getFileModeAsString(stat.Mode(), stat.IsDir()), dirName)
 	err = c.sendProtocolMessage(fileMode)
 	if err != nil {
@@ -357,6 +384,9 @@ func (c *scpCommand) handleRecursiveDownload(dirPath string, stat os.FileInfo) e
 		var dirs []string
 		for _, file := range files {
 			filePath := c.connection.Fs.GetRelativePath(c.connection.Fs.Join(dirPath, file.Name()))
+			if common.Config.UploadScan.IsEnabled() && c.connection.IsReservedPath(filePath) {
+				continue
+			}
 			if file.Mode().IsRegular() || file.Mode()&os.ModeSymlink != 0 {
 				err = c.handleDownload(filePath)
 				if err != nil {
@@ -452,6 +482,64 @@ func (c *scpCommand) sendDownloadFileData(filePath string, stat os.FileInfo, tra
 	return err
 }
 
+// handlePrefixDownload maps the requested path to the folder mappings. For the
+// prefix parents the directories up to the mappings are synthesized and the
+// mappings contents are then sent as usual
+func (c *scpCommand) handlePrefixDownload(name string) error {
+	sshPath, match := c.resolvePrefixPath(name)
+	switch match {
+	case common.PathContainsPrefix:
+		if len(c.connection.GetPrefixMapping()) > 0 {
+			c.rootDirName = path.Base(cleanCommandPath(name))
+		}
+		return c.handleDownload(sshPath)
+	case common.PathIsPrefixParent:
+		if !c.isRecursive() {
+			err := fmt.Errorf("Unable to send directory for non recursive copy")
+			c.sendErrorMessage(err)
+			return err
+		}
+		sshPath = path.Clean(sshPath)
+		dirName := path.Base(sshPath)
+		if sshPath == "/" {
+			dirName = c.connection.User.Username
+		}
+		return c.sendPrefixParent(sshPath, dirName)
+	default:
+		c.connection.Log(logger.LevelInfo, "download not allowed for path %#v outside the folder mappings", name)
+		c.sendErrorMessage(common.ErrPermissionDenied)
+		return common.ErrPermissionDenied
+	}
+}
+
+// sendPrefixParent sends the given prefix parent as a synthetic directory, its
+// contents are the next directories in the hierarchy of the mappings below it
+func (c *scpCommand) sendPrefixParent(sshPath, dirName string) error {
+	stat := vfs.NewFileInfo(sshPath, true, 0, time.Now(), false)
+	if err := c.sendDirProtocolMessages(dirName, stat); err != nil {
+		return err
+	}
+	for _, info := range c.connection.ListPrefixParent(sshPath) {
+		childPath := path.Join(sshPath, info.Name())
+		virtualPath, match := c.connection.ResolvePrefixPath(childPath)
+		var err error
+		if match == common.PathContainsPrefix {
+			c.rootDirName = info.Name()
+			err = c.handleDownload(virtualPath)
+			c.rootDirName = ""
+		} else {
+			err = c.sendPrefixParent(childPath, info.Name())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := c.sendProtocolMessage("E\n"); err != nil {
+		return err
+	}
+	return c.readConfirmationMessage()
+}
+
 func (c *scpCommand) handleDownload(filePath string) error {
 	c.connection.UpdateLastActivity()
 	var err error
@@ -472,7 +560,7 @@ func (c *scpCommand) handleDownload(filePath string) error {
 	}
 
 	if stat.IsDir() {
-		if !c.connection.User.HasPerm(dataprovider.PermDownload, filePath) {
+		if !c.connection.User.HasPerm(dataprovider.PermDownload, filePath) || c.connection.IsReservedPath(filePath) {
 			c.connection.Log(logger.LevelWarn, "error downloading dir: %#v, permission denied", filePath)
 			c.sendErrorMessage(common.ErrPermissionDenied)
 			return common.ErrPermissionDenied
@@ -487,12 +575,17 @@ func (c *scpCommand) handleDownload(filePath string) error {
 		return common.ErrPermissionDenied
 	}
 
-	if !c.connection.User.IsFileAllowed(filePath) {
+	if !c.connection.IsFileAllowed(filePath) {
 		c.connection.Log(logger.LevelWarn, "reading file %#v is not allowed", filePath)
 		c.sendErrorMessage(common.ErrPermissionDenied)
 		return common.ErrPermissionDenied
 	}
 
+	if err = c.connection.ExecutePreTransferAction(common.TransferDownload, p, filePath, stat.Size()); err != nil {
+		c.sendErrorMessage(err)
+		return err
+	}
+
 	file, r, cancelFn, err := c.connection.Fs.Open(p, 0)
 	if err != nil {
 		c.connection.Log(logger.LevelError, "could not open file %#v for reading: %v", p, err)
@@ -631,7 +724,7 @@ func (c *scpCommand) getNextUploadProtocolMessage() (string, error) {
 	return command, err
 }
 
-func (c *scpCommand) createDir(dirPath string) error {
+func (c *scpCommand) createDir(dirPath, requestPath string) error {
 	var err error
 	var isDir bool
 	isDir, err = vfs.IsDirectory(c.connection.Fs, dirPath)
@@ -641,6 +734,10 @@ func (c *scpCommand) createDir(dirPath string) error {
 		c.connection.Log(logger.LevelDebug, "directory %#v already exists", dirPath)
 		return nil
 	}
+	if err = c.connection.ExecutePreMkdirAction(dirPath, requestPath); err != nil {
+		c.sendErrorMessage(err)
+		return err
+	}
 	if err = c.connection.Fs.Mkdir(dirPath); err != nil {
 		c.connection.Log(logger.LevelError, "error creating dir %#v: %v", dirPath, err)
 		c.sendErrorMessage(err)
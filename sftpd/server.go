@@ -121,7 +121,8 @@ type Configuration struct {
 	//      work even if the matching system commands are not available, for example on Windows.
 	// - "cd", "pwd". Some mobile SFTP clients does not support the SFTP SSH_FXP_REALPATH and so
 	//      they use "cd" and "pwd" SSH commands to get the initial directory.
-	//      Currently `cd` do nothing and `pwd` always returns the "/" path.
+	//      `cd` changes and `pwd` returns the working directory shared, within the same SSH
+	//      connection, with SFTP realpath requests and SCP relative paths.
 	//
 	// The following SSH commands are enabled by default: "md5sum", "sha1sum", "cd", "pwd".
 	// "*" enables all supported SSH commands.
@@ -137,7 +138,7 @@ type Configuration struct {
 	ProxyProtocol int `json:"proxy_protocol" mapstructure:"proxy_protocol"`
 	// Deprecated: please use the same key in common configuration
 	ProxyAllowed []string `json:"proxy_allowed" mapstructure:"proxy_allowed"`
-	// Virtual root folder prefix to include in all file operations (ex: /files)
+	// Deprecated: please use the same key in common configuration
 	FolderPrefix     string `json:"folder_prefix" mapstructure:"folder_prefix"`
 	certChecker      *ssh.CertChecker
 	parsedUserCAKeys []ssh.PublicKey
@@ -227,11 +228,6 @@ func (c *Configuration) Initialize(configDir string) error {
 	c.configureLoginBanner(serverConfig, configDir)
 	c.checkSSHCommands()
 
-	if c.FolderPrefix != `` && !c.SFTPOnly {
-		logger.WarnToConsole(`SFTPD: enabling sftp only with folder prefix '%s' set`, c.FolderPrefix)
-		c.SFTPOnly = true
-	}
-
 	exitChannel := make(chan error, 1)
 	serviceStatus.Bindings = nil
 
@@ -426,6 +422,9 @@ func (c *Configuration) AcceptInboundConnection(conn net.Conn, config *ssh.Serve
 
 	go ssh.DiscardRequests(reqs)
 
+	// the working directory is shared by all the channels of this SSH connection
+	workingDir := common.NewWorkingDir(&user)
+
 	channelCounter := int64(0)
 	for newChannel := range chans {
 		// If its not a session channel we just move on because its not something we
@@ -464,6 +463,8 @@ func (c *Configuration) AcceptInboundConnection(conn net.Conn, config *ssh.Serve
 								RemoteAddr:     conn.RemoteAddr(),
 								channel:        channel,
 							}
+							connection.SetRemoteAddress(conn.RemoteAddr().String())
+							connection.SetSessionWorkingDir(workingDir)
 							go c.handleSftpConnection(channel, &connection)
 						} else {
 							logger.Debug(logSender, connID, "unable to create filesystem: %v", err)
@@ -480,6 +481,8 @@ func (c *Configuration) AcceptInboundConnection(conn net.Conn, config *ssh.Serve
 							channel:        channel,
 							SFTPOnly:       c.SFTPOnly,
 						}
+						connection.SetRemoteAddress(conn.RemoteAddr().String())
+						connection.SetSessionWorkingDir(workingDir)
 						ok = processSSHCommand(req.Payload, &connection, c.EnabledSSHCommands)
 					} else {
 						logger.Debug(sshCommandLogSender, connID, "unable to create filesystem: %v", err)
@@ -504,15 +507,22 @@ func (c *Configuration) handleSftpConnection(channel ssh.Channel, connection *Co
 
 	// Create a new handler for the currently logged in user's server.
 	// handler := c.createHandler(connection)
-	prefix := NewPrefixMiddleware(c.FolderPrefix, connection)
-	middleware := NewCurrentDirMiddleware(prefix)
+	// The extensions not supported by the request server are handled by the
+	// channel wrapper
+	extChannel := newExtensionsChannel(channel, connection)
+	prefix := NewPrefixMiddleware(connection.GetPrefixMapping(), extChannel.TrackTransfers(connection))
+	middleware := NewCurrentDirMiddleware(prefix, connection.GetSessionWorkingDir())
 	handler := NewHandlersFromMiddleware(middleware)
 
 	// Create the server instance for the channel using the handler we created above.
-	server := sftp.NewRequestServer(channel, handler, sftp.WithRSAllocator())
+	// The relative request paths are resolved against the session working directory
+	// by the extensions channel and by the middleware for the realpath requests
+	server := sftp.NewRequestServer(extChannel, handler, sftp.WithRSAllocator())
 
 	defer server.Close()
-	if err := server.Serve(); err == io.EOF {
+	err := server.Serve()
+	extChannel.Wait()
+	if err == io.EOF {
 		connection.Log(logger.LevelDebug, "connection closed, sending exit status")
 		exitStatus := sshSubsystemExitStatus{Status: uint32(0)}
 		_, err = channel.SendRequest("exit-status", false, ssh.Marshal(&exitStatus))
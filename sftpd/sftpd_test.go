@@ -10,6 +10,7 @@ import (
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"hash"
 	"io"
@@ -138,6 +139,7 @@ var (
 	postConnectPath  string
 	checkPwdPath     string
 	logFilePath      string
+	hostKeysDir      string
 	hostKeyFPs       []string
 )
 
@@ -222,6 +224,8 @@ func TestMain(m *testing.M) {
 
 	createInitialFiles(scriptArgs)
 	sftpdConf.TrustedUserCAKeys = append(sftpdConf.TrustedUserCAKeys, trustedCAUserKey)
+	hostKeysDir = filepath.Join(os.TempDir(), "sftpd_test_host_keys")
+	sftpdConf.HostKeys = getTestHostKeys()
 
 	go func() {
 		logger.Debug(logSender, "", "initializing SFTP server with config %+v", sftpdConf)
@@ -311,6 +315,7 @@ func TestMain(m *testing.M) {
 	os.Remove(postConnectPath)
 	os.Remove(keyIntAuthPath)
 	os.Remove(checkPwdPath)
+	os.RemoveAll(hostKeysDir)
 	os.Exit(exitCode)
 }
 
@@ -351,7 +356,7 @@ func TestInitialization(t *testing.T) {
 	sftpdConf.HostKeys = []string{"missing key"}
 	err = sftpdConf.Initialize(configDir)
 	assert.Error(t, err)
-	sftpdConf.HostKeys = nil
+	sftpdConf.HostKeys = getTestHostKeys()
 	sftpdConf.TrustedUserCAKeys = []string{"missing ca key"}
 	err = sftpdConf.Initialize(configDir)
 	assert.Error(t, err)
@@ -782,6 +787,280 @@ func TestSFTPOnly(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestUserFolderPrefix(t *testing.T) {
+	usePubKey := false
+	u := getTestUser(usePubKey)
+	u.Filters.FolderPrefix = "/inbound/acme/"
+	user, _, err := httpdtest.AddUser(u, http.StatusCreated)
+	assert.NoError(t, err)
+	assert.Equal(t, "/inbound/acme", user.Filters.FolderPrefix)
+	client, err := getSftpClient(user, usePubKey)
+	if assert.NoError(t, err) {
+		defer client.Close()
+		files, err := client.ReadDir("/")
+		if assert.NoError(t, err) && assert.Len(t, files, 1) {
+			assert.Equal(t, "inbound", files[0].Name())
+		}
+		files, err = client.ReadDir("/inbound")
+		if assert.NoError(t, err) && assert.Len(t, files, 1) {
+			assert.Equal(t, "acme", files[0].Name())
+		}
+		testFilePath := filepath.Join(homeBasePath, testFileName)
+		testFileSize := int64(65535)
+		err = createTestFile(testFilePath, testFileSize)
+		assert.NoError(t, err)
+		err = sftpUploadFile(testFilePath, path.Join("/inbound/acme", testFileName), testFileSize, client)
+		assert.NoError(t, err)
+		assert.FileExists(t, filepath.Join(user.GetHomeDir(), testFileName))
+		err = sftpUploadFile(testFilePath, path.Join("/inbound", testFileName), testFileSize, client)
+		assert.Error(t, err)
+		err = os.Remove(testFilePath)
+		assert.NoError(t, err)
+	}
+	// SSH commands paths are mapped to the folder prefix too
+	out, err := runSSHCommand(fmt.Sprintf("md5sum %v", path.Join("/inbound/acme", testFileName)), user, usePubKey)
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), path.Join("/inbound/acme", testFileName))
+	}
+	_, err = runSSHCommand(fmt.Sprintf("md5sum %v", path.Join("/inbound", testFileName)), user, usePubKey)
+	assert.Error(t, err)
+	_, err = runSSHCommand(fmt.Sprintf("sha256sum %v", path.Join("/", testFileName)), user, usePubKey)
+	assert.Error(t, err)
+
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.RemoveAll(user.GetHomeDir())
+	assert.NoError(t, err)
+}
+
+func TestUserLoginDir(t *testing.T) {
+	usePubKey := true
+	u := getTestUser(usePubKey)
+	u.Filters.FolderPrefix = "/files"
+	u.Filters.LoginDir = "/sub/"
+	user, _, err := httpdtest.AddUser(u, http.StatusCreated)
+	assert.NoError(t, err)
+	assert.Equal(t, "/sub", user.Filters.LoginDir)
+	err = os.MkdirAll(filepath.Join(user.GetHomeDir(), "sub"), os.ModePerm)
+	assert.NoError(t, err)
+	testFilePath := filepath.Join(homeBasePath, testFileName)
+	testFileSize := int64(65535)
+	err = createTestFile(testFilePath, testFileSize)
+	assert.NoError(t, err)
+	client, err := getSftpClient(user, usePubKey)
+	if assert.NoError(t, err) {
+		defer client.Close()
+		wd, err := client.Getwd()
+		assert.NoError(t, err)
+		assert.Equal(t, "/files/sub", wd)
+		// relative paths are resolved against the login dir
+		err = sftpUploadFile(testFilePath, testFileName, testFileSize, client)
+		assert.NoError(t, err)
+		assert.FileExists(t, filepath.Join(user.GetHomeDir(), "sub", testFileName))
+	}
+	out, err := runSSHCommand("pwd", user, usePubKey)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/files/sub\n", string(out))
+	}
+	out, err = runSSHCommand(fmt.Sprintf("md5sum %v", testFileName), user, usePubKey)
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(out), path.Join("/files/sub", testFileName))
+	}
+	_, err = runSSHCommand("cd missing", user, usePubKey)
+	assert.Error(t, err)
+	_, err = runSSHCommand(fmt.Sprintf("cd %v", testFileName), user, usePubKey)
+	assert.Error(t, err)
+	_, err = runSSHCommand("cd /other", user, usePubKey)
+	assert.Error(t, err)
+	if len(scpPath) > 0 {
+		err = scpUpload(testFilePath, fmt.Sprintf("%v@127.0.0.1:%v", user.Username, "scp_"+testFileName), false, false)
+		assert.NoError(t, err)
+		assert.FileExists(t, filepath.Join(user.GetHomeDir(), "sub", "scp_"+testFileName))
+	}
+	// the working directory is shared by all the channels of an SSH connection
+	key, err := ssh.ParsePrivateKey([]byte(testPrivateKey))
+	assert.NoError(t, err)
+	conn, err := ssh.Dial("tcp", sftpServerAddr, &ssh.ClientConfig{
+		User: user.Username,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			return nil
+		},
+		Auth: []ssh.AuthMethod{ssh.PublicKeys(key)},
+	})
+	if assert.NoError(t, err) {
+		defer conn.Close()
+		// the SFTP subsystem is started before changing the directory
+		subsystemClient, err := sftp.NewClient(conn)
+		require.NoError(t, err)
+		defer subsystemClient.Close()
+		_, err = subsystemClient.Stat(testFileName)
+		assert.NoError(t, err)
+		session, err := conn.NewSession()
+		if assert.NoError(t, err) {
+			assert.NoError(t, session.Run("cd .."))
+		}
+		// relative paths are resolved against the new directory
+		_, err = subsystemClient.Stat(testFileName)
+		assert.Error(t, err)
+		f, err := subsystemClient.Open(path.Join("sub", testFileName))
+		if assert.NoError(t, err) {
+			content, err := io.ReadAll(f)
+			assert.NoError(t, err)
+			assert.Len(t, content, int(testFileSize))
+			assert.NoError(t, f.Close())
+		}
+		session, err = conn.NewSession()
+		if assert.NoError(t, err) {
+			out, err = session.Output("pwd")
+			assert.NoError(t, err)
+			assert.Equal(t, "/files\n", string(out))
+		}
+		client, err := sftp.NewClient(conn)
+		if assert.NoError(t, err) {
+			wd, err := client.Getwd()
+			assert.NoError(t, err)
+			assert.Equal(t, "/files", wd)
+			client.Close()
+		}
+	}
+	err = os.Remove(testFilePath)
+	assert.NoError(t, err)
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.RemoveAll(user.GetHomeDir())
+	assert.NoError(t, err)
+}
+
+func TestSFTPExtensions(t *testing.T) {
+	usePubKey := true
+	u := getTestUser(usePubKey)
+	u.QuotaFiles = 100
+	user, _, err := httpdtest.AddUser(u, http.StatusCreated)
+	assert.NoError(t, err)
+	testFilePath := filepath.Join(homeBasePath, testFileName)
+	testFileSize := int64(65535)
+	err = createTestFile(testFilePath, testFileSize)
+	assert.NoError(t, err)
+	fileHash, err := computeHashForFile(sha256.New(), testFilePath)
+	assert.NoError(t, err)
+	client, err := getSftpClient(user, usePubKey)
+	if assert.NoError(t, err) {
+		defer client.Close()
+		for _, ext := range []string{"copy-data", "copy-file", "check-file", "space-available"} {
+			_, ok := client.HasExtension(ext)
+			assert.True(t, ok, "extension %v not advertised", ext)
+		}
+		err = sftpUploadFile(testFilePath, testFileName, testFileSize, client)
+		assert.NoError(t, err)
+	}
+	rawClient, err := getRawSFTPClient(user)
+	if assert.NoError(t, err) {
+		defer rawClient.Close()
+		// copy-file
+		pktType, data, err := rawClient.extended("copy-file", rawString(testFileName), rawString("copy1"), []byte{0})
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(0), getRawStatusCode(t, pktType, data))
+		copyHash, err := computeHashForFile(sha256.New(), filepath.Join(user.GetHomeDir(), "copy1"))
+		assert.NoError(t, err)
+		assert.Equal(t, fileHash, copyHash)
+		pktType, data, err = rawClient.extended("copy-file", rawString(testFileName), rawString("copy1"), []byte{0})
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(4), getRawStatusCode(t, pktType, data))
+		pktType, data, err = rawClient.extended("copy-file", rawString(testFileName), rawString("/copy1"), []byte{1})
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(0), getRawStatusCode(t, pktType, data))
+		pktType, data, err = rawClient.extended("copy-file", rawString("missing"), rawString("copy2"), []byte{0})
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(2), getRawStatusCode(t, pktType, data))
+		pktType, data, err = rawClient.extended("copy-file", rawString(testFileName))
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(5), getRawStatusCode(t, pktType, data))
+		// check-file-name, the first supported algorithm is used
+		pktType, data, err = rawClient.extended("check-file-name", rawString(testFileName), rawString("unknown,sha256,md5"),
+			rawUint64(0), rawUint64(0), rawUint32(0))
+		assert.NoError(t, err)
+		if assert.Equal(t, uint8(201), pktType) {
+			algorithm, hashes := getRawString(t, data)
+			assert.Equal(t, "sha256", algorithm)
+			assert.Equal(t, fileHash, fmt.Sprintf("%x", hashes))
+		}
+		pktType, data, err = rawClient.extended("check-file-name", rawString(testFileName), rawString("sha512"),
+			rawUint64(0), rawUint64(4096), rawUint32(1024))
+		assert.NoError(t, err)
+		if assert.Equal(t, uint8(201), pktType) {
+			_, hashes := getRawString(t, data)
+			assert.Len(t, hashes, 4*sha512.Size)
+		}
+		pktType, data, err = rawClient.extended("check-file-name", rawString(testFileName), rawString("crc32"),
+			rawUint64(0), rawUint64(0), rawUint32(0))
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(8), getRawStatusCode(t, pktType, data))
+		// copy-data between two open handles
+		readHandle, err := rawClient.open(testFileName, 0x01)
+		assert.NoError(t, err)
+		writeHandle, err := rawClient.open("copy2", 0x02|0x08|0x10)
+		assert.NoError(t, err)
+		pktType, data, err = rawClient.extended("check-file-handle", rawString(readHandle), rawString("sha256"),
+			rawUint64(0), rawUint64(0), rawUint32(0))
+		assert.NoError(t, err)
+		if assert.Equal(t, uint8(201), pktType) {
+			_, hashes := getRawString(t, data)
+			assert.Equal(t, fileHash, fmt.Sprintf("%x", hashes))
+		}
+		pktType, data, err = rawClient.extended("copy-data", rawString(readHandle), rawUint64(0), rawUint64(0),
+			rawString(writeHandle), rawUint64(0))
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(0), getRawStatusCode(t, pktType, data))
+		// the write handle cannot be used to read
+		pktType, data, err = rawClient.extended("copy-data", rawString(writeHandle), rawUint64(0), rawUint64(0),
+			rawString(readHandle), rawUint64(0))
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(4), getRawStatusCode(t, pktType, data))
+		assert.NoError(t, rawClient.close(readHandle))
+		assert.NoError(t, rawClient.close(writeHandle))
+		copyHash, err = computeHashForFile(sha256.New(), filepath.Join(user.GetHomeDir(), "copy2"))
+		assert.NoError(t, err)
+		assert.Equal(t, fileHash, copyHash)
+		// the handles are closed
+		pktType, data, err = rawClient.extended("check-file-handle", rawString(readHandle), rawString("sha256"),
+			rawUint64(0), rawUint64(0), rawUint32(0))
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(4), getRawStatusCode(t, pktType, data))
+		// space-available
+		pktType, data, err = rawClient.extended("space-available", rawString("/"))
+		assert.NoError(t, err)
+		if assert.Equal(t, uint8(201), pktType) {
+			assert.Len(t, data, 36)
+		}
+		// the unsupported extensions are handled by the request server
+		pktType, data, err = rawClient.extended("unsupported-ext@example.com")
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(8), getRawStatusCode(t, pktType, data))
+	}
+	user, _, err = httpdtest.GetUserByUsername(user.Username, http.StatusOK)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, user.UsedQuotaFiles)
+	assert.Equal(t, 3*testFileSize, user.UsedQuotaSize)
+
+	user.Permissions["/"] = []string{dataprovider.PermListItems, dataprovider.PermDownload}
+	_, _, err = httpdtest.UpdateUser(user, http.StatusOK, "")
+	assert.NoError(t, err)
+	rawClient, err = getRawSFTPClient(user)
+	if assert.NoError(t, err) {
+		defer rawClient.Close()
+		pktType, data, err := rawClient.extended("copy-file", rawString(testFileName), rawString("copy3"), []byte{0})
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(3), getRawStatusCode(t, pktType, data))
+		assert.NoFileExists(t, filepath.Join(user.GetHomeDir(), "copy3"))
+	}
+	err = os.Remove(testFilePath)
+	assert.NoError(t, err)
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.RemoveAll(user.GetHomeDir())
+	assert.NoError(t, err)
+}
+
 func TestUploadResume(t *testing.T) {
 	usePubKey := false
 	u := getTestUser(usePubKey)
@@ -835,6 +1114,258 @@ func TestUploadResume(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestUploadChecksum(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("this test is not available on Windows")
+	}
+	usePubKey := false
+	user, _, err := httpdtest.AddUser(getTestUser(usePubKey), http.StatusCreated)
+	assert.NoError(t, err)
+	hookPath := filepath.Join(homeBasePath, "upload_hook.sh")
+	hookOutputPath := filepath.Join(homeBasePath, "upload_hook.out")
+	hookContent := fmt.Sprintf("#!/bin/sh\n\nif [ \"$SFTPGO_ACTION\" = \"upload\" ]; then\n"+
+		"echo \"$SFTPGO_ACTION_CHECKSUM_ALGO $SFTPGO_ACTION_CHECKSUM $SFTPGO_ACTION_VIRTUAL_PATH $SFTPGO_ACTION_IP\" > %v\nfi\n",
+		hookOutputPath)
+	err = ioutil.WriteFile(hookPath, []byte(hookContent), os.ModePerm)
+	assert.NoError(t, err)
+	oldExecuteOn := common.Config.Actions.ExecuteOn
+	oldHook := common.Config.Actions.Hook
+	common.Config.Actions.ExecuteOn = []string{"upload"}
+	common.Config.Actions.Hook = hookPath
+	common.Config.Actions.Checksum = "sha256"
+	defer func() {
+		common.Config.Actions.ExecuteOn = oldExecuteOn
+		common.Config.Actions.Hook = oldHook
+		common.Config.Actions.Checksum = ""
+	}()
+
+	client, err := getSftpClient(user, usePubKey)
+	if assert.NoError(t, err) {
+		defer client.Close()
+		testFilePath := filepath.Join(homeBasePath, testFileName)
+		testFileSize := int64(131072)
+		err = createTestFile(testFilePath, testFileSize)
+		assert.NoError(t, err)
+		checksum, err := computeHashForFile(sha256.New(), testFilePath)
+		assert.NoError(t, err)
+		err = sftpUploadFile(testFilePath, testFileName, testFileSize, client)
+		assert.NoError(t, err)
+		expected := fmt.Sprintf("sha256 %v /%v 127.0.0.1", checksum, testFileName)
+		assert.Eventually(t, func() bool {
+			content, err := ioutil.ReadFile(hookOutputPath)
+			return err == nil && strings.TrimSpace(string(content)) == expected
+		}, 2*time.Second, 100*time.Millisecond)
+		err = os.Remove(testFilePath)
+		assert.NoError(t, err)
+	}
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.RemoveAll(user.GetHomeDir())
+	assert.NoError(t, err)
+	err = os.Remove(hookPath)
+	assert.NoError(t, err)
+	err = os.Remove(hookOutputPath)
+	assert.NoError(t, err)
+}
+
+func TestUploadScan(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go serveClamdStandIn(listener)
+
+	oldConfig := config.GetCommonConfig()
+	cfg := config.GetCommonConfig()
+	cfg.UploadScan.Address = "tcp://" + listener.Addr().String()
+	cfg.UploadScan.QuarantinePath = "/quarantine"
+	err = common.Initialize(cfg)
+	require.NoError(t, err)
+
+	usePubKey := false
+	u := getTestUser(usePubKey)
+	u.QuotaFiles = 100
+	// the raw SFTP client uses public key authentication
+	u.PublicKeys = []string{testPubKey}
+	user, _, err := httpdtest.AddUser(u, http.StatusCreated)
+	assert.NoError(t, err)
+	client, err := getSftpClient(user, usePubKey)
+	if assert.NoError(t, err) {
+		defer client.Close()
+		testFilePath := filepath.Join(homeBasePath, testFileName)
+		testFileSize := int64(131072)
+		err = createTestFile(testFilePath, testFileSize)
+		assert.NoError(t, err)
+		err = sftpUploadFile(testFilePath, testFileName, testFileSize, client)
+		assert.NoError(t, err)
+		_, err = client.Stat(testFileName + ".scanning")
+		assert.Error(t, err)
+
+		f, err := client.Create("infected.txt")
+		if assert.NoError(t, err) {
+			_, err = f.Write([]byte("X5O!P%@AP[4\\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*"))
+			assert.NoError(t, err)
+			// the file is hidden to other clients while uploading
+			otherClient, err := getSftpClient(user, usePubKey)
+			if assert.NoError(t, err) {
+				_, err = otherClient.Stat("infected.txt")
+				assert.Error(t, err)
+				otherClient.Close()
+			}
+			assert.NoFileExists(t, filepath.Join(user.GetHomeDir(), "infected.txt"))
+			assert.FileExists(t, filepath.Join(user.GetHomeDir(), "infected.txt.scanning"))
+			err = f.Close()
+			assert.Error(t, err)
+		}
+		_, err = client.Stat("infected.txt")
+		assert.Error(t, err)
+		quarantined, err := ioutil.ReadDir(filepath.Join(user.GetHomeDir(), "quarantine"))
+		require.NoError(t, err)
+		require.Len(t, quarantined, 1)
+		assert.True(t, strings.HasPrefix(quarantined[0].Name(), "infected.txt."))
+		user, _, err = httpdtest.GetUserByUsername(user.Username, http.StatusOK)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, user.UsedQuotaFiles)
+		// the quarantine path and the files being scanned are not accessible
+		scanningFile := "scanned.txt.scanning"
+		err = ioutil.WriteFile(filepath.Join(user.GetHomeDir(), scanningFile), []byte("data"), os.ModePerm)
+		assert.NoError(t, err)
+		files, err := client.ReadDir("/")
+		if assert.NoError(t, err) {
+			for _, fi := range files {
+				assert.NotEqual(t, "quarantine", fi.Name())
+				assert.NotEqual(t, scanningFile, fi.Name())
+			}
+		}
+		_, err = client.ReadDir("quarantine")
+		assert.ErrorIs(t, err, os.ErrPermission)
+		_, err = client.Stat("quarantine")
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		_, err = client.Lstat(scanningFile)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		for _, name := range []string{path.Join("quarantine", quarantined[0].Name()), scanningFile} {
+			localDownloadPath := filepath.Join(homeBasePath, testDLFileName)
+			err = sftpDownloadFile(name, localDownloadPath, 4, client)
+			assert.ErrorIs(t, err, os.ErrPermission)
+			err = client.Rename(name, "restored.txt")
+			assert.ErrorIs(t, err, os.ErrPermission)
+			err = client.Remove(name)
+			assert.ErrorIs(t, err, os.ErrPermission)
+			err = os.Remove(localDownloadPath)
+			assert.NoError(t, err)
+		}
+		err = client.Rename("quarantine", "restored")
+		assert.ErrorIs(t, err, os.ErrPermission)
+		err = client.Mkdir("QUARANTINE/sub")
+		assert.ErrorIs(t, err, os.ErrPermission)
+		err = client.Rename(testFileName, testFileName+".scanning")
+		assert.ErrorIs(t, err, os.ErrPermission)
+		err = sftpUploadFile(testFilePath, "upload.scanning", testFileSize, client)
+		assert.ErrorIs(t, err, os.ErrPermission)
+		// the SFTP extensions cannot read or write the reserved paths too
+		rawClient, err := getRawSFTPClient(user)
+		if assert.NoError(t, err) {
+			quarantinedFile := path.Join("quarantine", quarantined[0].Name())
+			pktType, data, err := rawClient.extended("copy-file", rawString(quarantinedFile), rawString("restored.txt"),
+				[]byte{0})
+			assert.NoError(t, err)
+			assert.Equal(t, uint32(3), getRawStatusCode(t, pktType, data))
+			pktType, data, err = rawClient.extended("copy-file", rawString(testFileName), rawString("copied.scanning"),
+				[]byte{0})
+			assert.NoError(t, err)
+			assert.Equal(t, uint32(3), getRawStatusCode(t, pktType, data))
+			pktType, data, err = rawClient.extended("check-file-name", rawString(quarantinedFile), rawString("sha256"),
+				rawUint64(0), rawUint64(0), rawUint32(0))
+			assert.NoError(t, err)
+			assert.Equal(t, uint32(3), getRawStatusCode(t, pktType, data))
+			rawClient.Close()
+		}
+		assert.NoFileExists(t, filepath.Join(user.GetHomeDir(), "restored.txt"))
+		assert.NoFileExists(t, filepath.Join(user.GetHomeDir(), "copied.scanning"))
+
+		err = os.Remove(testFilePath)
+		assert.NoError(t, err)
+	}
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.RemoveAll(user.GetHomeDir())
+	assert.NoError(t, err)
+
+	err = common.Initialize(oldConfig)
+	assert.NoError(t, err)
+}
+
+func TestPreActionsHook(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("this test is not available on Windows")
+	}
+	usePubKey := true
+	user, _, err := httpdtest.AddUser(getTestUser(usePubKey), http.StatusCreated)
+	assert.NoError(t, err)
+	hookPath := filepath.Join(homeBasePath, "pre_action_hook.sh")
+	hookContent := "#!/bin/sh\n\ncase \"$SFTPGO_ACTION_VIRTUAL_PATH $SFTPGO_ACTION_VIRTUAL_TARGET\" in\n" +
+		"*denied*)\necho \"$SFTPGO_ACTION is not allowed\"\nexit 1\n;;\nesac\n"
+	err = ioutil.WriteFile(hookPath, []byte(hookContent), os.ModePerm)
+	assert.NoError(t, err)
+	oldExecuteOn := common.Config.Actions.ExecuteOn
+	oldHook := common.Config.Actions.Hook
+	common.Config.Actions.ExecuteOn = []string{"pre-upload", "pre-download", "pre-rename", "pre-mkdir"}
+	common.Config.Actions.Hook = hookPath
+	defer func() {
+		common.Config.Actions.ExecuteOn = oldExecuteOn
+		common.Config.Actions.Hook = oldHook
+	}()
+
+	testFilePath := filepath.Join(homeBasePath, testFileName)
+	testFileSize := int64(65535)
+	err = createTestFile(testFilePath, testFileSize)
+	assert.NoError(t, err)
+	client, err := getSftpClient(user, usePubKey)
+	if assert.NoError(t, err) {
+		defer client.Close()
+		err = sftpUploadFile(testFilePath, testFileName, testFileSize, client)
+		assert.NoError(t, err)
+		err = sftpUploadFile(testFilePath, "denied.dat", testFileSize, client)
+		assert.ErrorIs(t, err, os.ErrPermission)
+		_, err = client.Stat("denied.dat")
+		assert.ErrorIs(t, err, os.ErrNotExist)
+		err = client.Rename(testFileName, "denied.dat")
+		assert.ErrorIs(t, err, os.ErrPermission)
+		_, err = client.Stat(testFileName)
+		assert.NoError(t, err)
+		err = client.Mkdir("denied_dir")
+		assert.ErrorIs(t, err, os.ErrPermission)
+		err = client.Mkdir("allowed_dir")
+		assert.NoError(t, err)
+		err = ioutil.WriteFile(filepath.Join(user.GetHomeDir(), "denied_dl.dat"), []byte("data"), os.ModePerm)
+		assert.NoError(t, err)
+		localDownloadPath := filepath.Join(homeBasePath, testDLFileName)
+		err = sftpDownloadFile("denied_dl.dat", localDownloadPath, 4, client)
+		assert.ErrorIs(t, err, os.ErrPermission)
+		err = sftpDownloadFile(testFileName, localDownloadPath, testFileSize, client)
+		assert.NoError(t, err)
+		err = os.Remove(localDownloadPath)
+		assert.NoError(t, err)
+	}
+	if len(scpPath) > 0 {
+		remoteUpPath := fmt.Sprintf("%v@127.0.0.1:%v", user.Username, "/denied_scp.dat")
+		err = scpUpload(testFilePath, remoteUpPath, false, false)
+		assert.Error(t, err)
+		assert.NoFileExists(t, filepath.Join(user.GetHomeDir(), "denied_scp.dat"))
+		remoteUpPath = fmt.Sprintf("%v@127.0.0.1:%v", user.Username, "/allowed_scp.dat")
+		err = scpUpload(testFilePath, remoteUpPath, false, false)
+		assert.NoError(t, err)
+	}
+
+	err = os.Remove(testFilePath)
+	assert.NoError(t, err)
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.RemoveAll(user.GetHomeDir())
+	assert.NoError(t, err)
+	err = os.Remove(hookPath)
+	assert.NoError(t, err)
+}
+
 func TestDirCommands(t *testing.T) {
 	usePubKey := false
 	user, _, err := httpdtest.AddUser(getTestUser(usePubKey), http.StatusCreated)
@@ -7383,6 +7914,59 @@ func TestGitErrors(t *testing.T) {
 }
 
 // Start SCP tests
+func TestSCPFolderPrefix(t *testing.T) {
+	if len(scpPath) == 0 {
+		t.Skip("scp command not found, unable to execute this test")
+	}
+	usePubKey := true
+	u := getTestUser(usePubKey)
+	u.Filters.FolderPrefix = "/inbound/acme"
+	user, _, err := httpdtest.AddUser(u, http.StatusCreated)
+	assert.NoError(t, err)
+	testFilePath := filepath.Join(homeBasePath, testFileName)
+	testFileSize := int64(65535)
+	err = createTestFile(testFilePath, testFileSize)
+	assert.NoError(t, err)
+
+	err = scpUpload(testFilePath, fmt.Sprintf("%v@127.0.0.1:%v", user.Username, "/inbound/acme/"), false, false)
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(user.GetHomeDir(), testFileName))
+	err = scpUpload(testFilePath, fmt.Sprintf("%v@127.0.0.1:%v", user.Username, "/inbound/"), false, false)
+	assert.Error(t, err)
+
+	localPath := filepath.Join(homeBasePath, "scp_download.dat")
+	err = scpDownload(localPath, fmt.Sprintf("%v@127.0.0.1:%v", user.Username, path.Join("/inbound/acme", testFileName)),
+		false, false)
+	assert.NoError(t, err)
+	err = os.Remove(localPath)
+	assert.NoError(t, err)
+	err = scpDownload(localPath, fmt.Sprintf("%v@127.0.0.1:%v", user.Username, path.Join("/", testFileName)),
+		false, false)
+	assert.Error(t, err)
+	// the directories up to the folder prefix are synthesized for recursive downloads
+	localDir := filepath.Join(homeBasePath, "scp_prefix_download")
+	for _, remoteDir := range []string{"/", "/inbound"} {
+		err = scpDownload(localDir, fmt.Sprintf("%v@127.0.0.1:%v", user.Username, remoteDir), true, true)
+		assert.NoError(t, err)
+		downloadedPath := filepath.Join(localDir, "acme", testFileName)
+		if remoteDir == "/" {
+			downloadedPath = filepath.Join(localDir, "inbound", "acme", testFileName)
+		}
+		assert.FileExists(t, downloadedPath)
+		err = os.RemoveAll(localDir)
+		assert.NoError(t, err)
+	}
+	err = scpDownload(localDir, fmt.Sprintf("%v@127.0.0.1:%v", user.Username, "/inbound"), false, false)
+	assert.Error(t, err)
+
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.Remove(testFilePath)
+	assert.NoError(t, err)
+	err = os.RemoveAll(user.GetHomeDir())
+	assert.NoError(t, err)
+}
+
 func TestSCPBasicHandling(t *testing.T) {
 	if len(scpPath) == 0 {
 		t.Skip("scp command not found, unable to execute this test")
@@ -8372,6 +8956,162 @@ func getCustomAuthSftpClient(user dataprovider.User, authMethods []ssh.AuthMetho
 	return sftpClient, err
 }
 
+// rawSFTPClient sends SFTP packets one at a time, it is used to test the
+// extensions not supported by the SFTP client
+type rawSFTPClient struct {
+	conn    *ssh.Client
+	session *ssh.Session
+	stdin   io.WriteCloser
+	stdout  io.Reader
+	id      uint32
+}
+
+func getRawSFTPClient(user dataprovider.User) (*rawSFTPClient, error) {
+	key, err := ssh.ParsePrivateKey([]byte(testPrivateKey))
+	if err != nil {
+		return nil, err
+	}
+	conn, err := ssh.Dial("tcp", sftpServerAddr, &ssh.ClientConfig{
+		User: user.Username,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			return nil
+		},
+		Auth: []ssh.AuthMethod{ssh.PublicKeys(key)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	c := &rawSFTPClient{conn: conn}
+	if err := c.init(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *rawSFTPClient) init() error {
+	var err error
+	if c.session, err = c.conn.NewSession(); err != nil {
+		return err
+	}
+	if c.stdin, err = c.session.StdinPipe(); err != nil {
+		return err
+	}
+	if c.stdout, err = c.session.StdoutPipe(); err != nil {
+		return err
+	}
+	if err = c.session.RequestSubsystem("sftp"); err != nil {
+		return err
+	}
+	if err = c.send(1, rawUint32(3)); err != nil {
+		return err
+	}
+	pktType, _, err := c.receive()
+	if err == nil && pktType != 2 {
+		err = fmt.Errorf("unexpected packet type: %v", pktType)
+	}
+	return err
+}
+
+func (c *rawSFTPClient) send(pktType uint8, fields ...[]byte) error {
+	pkt := []byte{0, 0, 0, 0, pktType}
+	for _, f := range fields {
+		pkt = append(pkt, f...)
+	}
+	binary.BigEndian.PutUint32(pkt, uint32(len(pkt)-4))
+	_, err := c.stdin.Write(pkt)
+	return err
+}
+
+func (c *rawSFTPClient) receive() (uint8, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(c.stdout, header); err != nil {
+		return 0, nil, err
+	}
+	data := make([]byte, binary.BigEndian.Uint32(header)-1)
+	if _, err := io.ReadFull(c.stdout, data); err != nil {
+		return 0, nil, err
+	}
+	return header[4], data, nil
+}
+
+// request sends a request with a new id and returns the response without the id
+func (c *rawSFTPClient) request(pktType uint8, fields ...[]byte) (uint8, []byte, error) {
+	c.id++
+	if err := c.send(pktType, append([][]byte{rawUint32(c.id)}, fields...)...); err != nil {
+		return 0, nil, err
+	}
+	respType, data, err := c.receive()
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(data) < 4 || binary.BigEndian.Uint32(data) != c.id {
+		return 0, nil, errors.New("unexpected response id")
+	}
+	return respType, data[4:], nil
+}
+
+func (c *rawSFTPClient) extended(name string, fields ...[]byte) (uint8, []byte, error) {
+	return c.request(200, append([][]byte{rawString(name)}, fields...)...)
+}
+
+func (c *rawSFTPClient) open(name string, pflags uint32) (string, error) {
+	pktType, data, err := c.request(3, rawString(name), rawUint32(pflags), rawUint32(0))
+	if err != nil {
+		return "", err
+	}
+	if pktType != 102 || len(data) < 4 {
+		return "", fmt.Errorf("unable to open %#v, response type: %v", name, pktType)
+	}
+	return string(data[4:]), nil
+}
+
+func (c *rawSFTPClient) close(handle string) error {
+	pktType, data, err := c.request(4, rawString(handle))
+	if err != nil {
+		return err
+	}
+	if pktType != 101 || len(data) < 4 || binary.BigEndian.Uint32(data) != 0 {
+		return fmt.Errorf("unable to close handle %#v", handle)
+	}
+	return nil
+}
+
+func (c *rawSFTPClient) Close() error {
+	c.stdin.Close()
+	c.session.Close()
+	return c.conn.Close()
+}
+
+func rawUint32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+func rawUint64(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+func rawString(v string) []byte {
+	return append(rawUint32(uint32(len(v))), v...)
+}
+
+func getRawString(t *testing.T, data []byte) (string, []byte) {
+	require.GreaterOrEqual(t, len(data), 4)
+	n := binary.BigEndian.Uint32(data)
+	require.GreaterOrEqual(t, uint32(len(data)-4), n)
+	return string(data[4 : 4+n]), data[4+n:]
+}
+
+func getRawStatusCode(t *testing.T, pktType uint8, data []byte) uint32 {
+	require.Equal(t, uint8(101), pktType)
+	require.GreaterOrEqual(t, len(data), 4)
+	return binary.BigEndian.Uint32(data)
+}
+
 func createTestFile(path string, size int64) error {
 	baseDir := filepath.Dir(path)
 	if _, err := os.Stat(baseDir); os.IsNotExist(err) {
@@ -8567,6 +9307,8 @@ func getScpDownloadCommand(localPath, remotePath string, preserveTime, recursive
 	args = append(args, "2022")
 	args = append(args, "-o")
 	args = append(args, "StrictHostKeyChecking=no")
+	args = append(args, "-o")
+	args = append(args, "UserKnownHostsFile=/dev/null")
 	args = append(args, "-i")
 	args = append(args, privateKeyPath)
 	args = append(args, remotePath)
@@ -8596,6 +9338,8 @@ func getScpUploadCommand(localPath, remotePath string, preserveTime, remoteToRem
 	args = append(args, "-o")
 	args = append(args, "StrictHostKeyChecking=no")
 	args = append(args, "-o")
+	args = append(args, "UserKnownHostsFile=/dev/null")
+	args = append(args, "-o")
 	args = append(args, "HostKeyAlgorithms=+ssh-rsa")
 	args = append(args, "-o")
 	args = append(args, "PubkeyAcceptedAlgorithms=+ssh-rsa")
@@ -8834,9 +9578,24 @@ func getHostKeyFingerprint(name string) (string, error) {
 	return ssh.FingerprintSHA256(private.PublicKey()), nil
 }
 
+// getTestHostKeys returns the host keys to use for the test cases, they are
+// generated inside a temporary directory
+func getTestHostKeys() []string {
+	err := os.MkdirAll(hostKeysDir, os.ModePerm)
+	if err != nil {
+		logger.ErrorToConsole("unable to create host keys dir %#v: %v", hostKeysDir, err)
+		os.Exit(1)
+	}
+	return []string{
+		filepath.Join(hostKeysDir, "id_rsa"),
+		filepath.Join(hostKeysDir, "id_ecdsa"),
+		filepath.Join(hostKeysDir, "id_ed25519"),
+	}
+}
+
 func getHostKeysFingerprints(hostKeys []string) {
 	for _, k := range hostKeys {
-		fp, err := getHostKeyFingerprint(filepath.Join(configDir, k))
+		fp, err := getHostKeyFingerprint(k)
 		if err != nil {
 			logger.ErrorToConsole("unable to get fingerprint for host key %#v: %v", k, err)
 			os.Exit(1)
@@ -8862,7 +9621,7 @@ func createInitialFiles(scriptArgs string) {
 	if err != nil {
 		logger.WarnToConsole("unable to save private key to file: %v", err)
 	}
-	err = ioutil.WriteFile(gitWrapPath, []byte(fmt.Sprintf("%v -i %v -oStrictHostKeyChecking=no %v\n",
+	err = ioutil.WriteFile(gitWrapPath, []byte(fmt.Sprintf("%v -i %v -oStrictHostKeyChecking=no -oUserKnownHostsFile=/dev/null %v\n",
 		sshPath, privateKeyPath, scriptArgs)), os.ModePerm)
 	if err != nil {
 		logger.WarnToConsole("unable to save gitwrap shell script: %v", err)
@@ -8872,3 +9631,40 @@ func createInitialFiles(scriptArgs string) {
 		logger.WarnToConsole("unable to save trusted CA user key: %v", err)
 	}
 }
+
+// serveClamdStandIn replies to the clamd INSTREAM commands, the streams
+// containing the EICAR test string are reported as infected
+func serveClamdStandIn(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func(conn net.Conn) {
+			defer conn.Close()
+
+			command := make([]byte, len("zINSTREAM\x00"))
+			if _, err := io.ReadFull(conn, command); err != nil {
+				return
+			}
+			var data bytes.Buffer
+			for {
+				var size uint32
+				if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+					return
+				}
+				if size == 0 {
+					break
+				}
+				if _, err := io.CopyN(&data, conn, int64(size)); err != nil {
+					return
+				}
+			}
+			if bytes.Contains(data.Bytes(), []byte("EICAR-STANDARD-ANTIVIRUS-TEST-FILE")) {
+				conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00")) //nolint:errcheck
+				return
+			}
+			conn.Write([]byte("stream: OK\x00")) //nolint:errcheck
+		}(conn)
+	}
+}
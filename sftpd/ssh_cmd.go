@@ -101,7 +101,17 @@ func (c *sshCommand) handle() (err error) {
 	if c.connection.SFTPOnly {
 		_, _ = c.connection.channel.Write([]byte("This service allows sftp connections only.\n"))
 		c.sendExitStatus(errSFTPOnlyMode)
-	} else if utils.IsStringInSlice(c.command, sshHashCommands) {
+		return
+	}
+	if c.command != "pwd" {
+		c.applyWorkingDir()
+	}
+	if c.command != "cd" && c.command != "pwd" {
+		if err := c.applyFolderPrefix(); err != nil {
+			return c.sendErrorResponse(err)
+		}
+	}
+	if utils.IsStringInSlice(c.command, sshHashCommands) {
 		return c.handleHashCommands()
 	} else if utils.IsStringInSlice(c.command, systemCommands) {
 		command, err := c.getSystemCommand()
@@ -110,10 +120,9 @@ func (c *sshCommand) handle() (err error) {
 		}
 		return c.executeSystemCommand(command)
 	} else if c.command == "cd" {
-		c.sendExitStatus(nil)
+		return c.handleCd()
 	} else if c.command == "pwd" {
-		// hard coded response to "/"
-		c.connection.channel.Write([]byte("/\n")) //nolint:errcheck
+		c.connection.channel.Write([]byte(c.connection.GetWorkingDir() + "\n")) //nolint:errcheck
 		c.sendExitStatus(nil)
 	} else if c.command == "sftpgo-copy" {
 		return c.handeSFTPGoCopy()
@@ -123,6 +132,20 @@ func (c *sshCommand) handle() (err error) {
 	return
 }
 
+// handleCd changes the session working directory, without arguments the login
+// directory is restored
+func (c *sshCommand) handleCd() error {
+	name := c.getDestPath()
+	if name == "" {
+		name = c.connection.GetLoginDir()
+	}
+	if err := c.connection.ChangeWorkingDir(name); err != nil {
+		return c.sendErrorResponse(err)
+	}
+	c.sendExitStatus(nil)
+	return nil
+}
+
 func (c *sshCommand) handeSFTPGoCopy() error {
 	if !vfs.IsLocalOsFs(c.connection.Fs) {
 		return c.sendErrorResponse(errUnsupportedConfig)
@@ -131,6 +154,10 @@ func (c *sshCommand) handeSFTPGoCopy() error {
 	if err != nil {
 		return c.sendErrorResponse(err)
 	}
+	if c.connection.IsReservedPath(sshSourcePath) || c.connection.IsReservedPath(sshDestPath) ||
+		c.connection.HasReservedPathsInside(sshSourcePath) {
+		return c.sendErrorResponse(common.ErrPermissionDenied)
+	}
 	fsSourcePath, fsDestPath, err := c.resolveCopyPaths(sshSourcePath, sshDestPath)
 	if err != nil {
 		return c.sendErrorResponse(err)
@@ -165,7 +192,7 @@ func (c *sshCommand) handeSFTPGoCopy() error {
 			return c.sendErrorResponse(err)
 		}
 	} else if fi.Mode().IsRegular() {
-		if !c.connection.User.IsFileAllowed(sshDestPath) {
+		if !c.connection.IsFileAllowed(sshDestPath) {
 			err := errors.New("unsupported copy destination: this file is not allowed")
 			return c.sendErrorResponse(err)
 		}
@@ -200,6 +227,9 @@ func (c *sshCommand) handeSFTPGoRemove() error {
 	if !c.connection.User.HasPerm(dataprovider.PermDelete, path.Dir(sshDestPath)) {
 		return c.sendErrorResponse(common.ErrPermissionDenied)
 	}
+	if c.connection.IsReservedPath(sshDestPath) || c.connection.HasReservedPathsInside(sshDestPath) {
+		return c.sendErrorResponse(common.ErrPermissionDenied)
+	}
 	fsDestPath, err := c.connection.Fs.ResolvePath(sshDestPath)
 	if err != nil {
 		return c.sendErrorResponse(err)
@@ -286,7 +316,7 @@ func (c *sshCommand) handleHashCommands() error {
 		response = fmt.Sprintf("%x  -\n", h.Sum(nil))
 	} else {
 		sshPath := c.getDestPath()
-		if !c.connection.User.IsFileAllowed(sshPath) {
+		if !c.connection.IsFileAllowed(sshPath) {
 			c.connection.Log(logger.LevelInfo, "hash not allowed for file %#v", sshPath)
 			return c.sendErrorResponse(common.ErrPermissionDenied)
 		}
@@ -301,7 +331,7 @@ func (c *sshCommand) handleHashCommands() error {
 		if err != nil {
 			return c.sendErrorResponse(err)
 		}
-		response = fmt.Sprintf("%v  %v\n", hash, sshPath)
+		response = fmt.Sprintf("%v  %v\n", hash, c.connection.GetClientPath(sshPath))
 	}
 	c.connection.channel.Write([]byte(response)) //nolint:errcheck
 	c.sendExitStatus(nil)
@@ -415,6 +445,13 @@ func (c *sshCommand) executeSystemCommand(command systemCommand) error {
 
 func (c *sshCommand) isSystemCommandAllowed() error {
 	sshDestPath := c.getDestPath()
+	if common.Config.UploadScan.IsEnabled() {
+		// system commands write directly to the filesystem, they cannot hide the
+		// reserved paths and the uploaded files would not be scanned
+		c.connection.Log(logger.LevelDebug, "command %#v is not allowed, upload scan is enabled, user %#v",
+			c.command, c.connection.User.Username)
+		return errUnsupportedConfig
+	}
 	if c.connection.User.IsVirtualFolder(sshDestPath) {
 		// overlapped virtual path are not allowed
 		return nil
@@ -513,6 +550,71 @@ func (c *sshCommand) getSystemCommand() (systemCommand, error) {
 	return command, nil
 }
 
+// applyFolderPrefix replaces the destination path and, for sftpgo-copy, the source
+// path with the mapped ones. The paths outside the folder mappings, including the
+// prefix parents, are not allowed
+func (c *sshCommand) applyFolderPrefix() error {
+	if len(c.connection.GetPrefixMapping()) == 0 {
+		return nil
+	}
+	for _, idx := range c.getPathArgIndexes() {
+		sshPath, match := c.resolvePrefixPath(c.args[idx])
+		if match != common.PathContainsPrefix {
+			c.connection.Log(logger.LevelInfo, "command %#v not allowed for path %#v outside the folder mappings",
+				c.command, c.args[idx])
+			return common.ErrPermissionDenied
+		}
+		c.args[idx] = sshPath
+	}
+	return nil
+}
+
+// applyWorkingDir replaces the relative path arguments with the absolute client
+// paths resolved against the session working directory. The trailing slash is
+// preserved
+func (c *sshCommand) applyWorkingDir() {
+	for _, idx := range c.getPathArgIndexes() {
+		name := strings.Trim(c.args[idx], "'")
+		name = strings.Trim(name, "\"")
+		if name == "" || path.IsAbs(name) {
+			continue
+		}
+		clientPath := c.connection.ResolveClientPath(name)
+		if strings.HasSuffix(name, "/") && !strings.HasSuffix(clientPath, "/") {
+			clientPath += "/"
+		}
+		c.args[idx] = clientPath
+	}
+}
+
+// getPathArgIndexes returns the indexes of the path arguments: the destination
+// path and, for sftpgo-copy, the source path
+func (c *sshCommand) getPathArgIndexes() []int {
+	if len(c.args) == 0 {
+		return nil
+	}
+	indexes := []int{len(c.args) - 1}
+	if c.command == "sftpgo-copy" && len(c.args) > 1 {
+		indexes = append(indexes, len(c.args)-2)
+	}
+	return indexes
+}
+
+// resolvePrefixPath returns the given command path mapped to the virtual path, if
+// any mapping is defined, and its position in the prefix hierarchy. The trailing
+// slash is preserved
+func (c *sshCommand) resolvePrefixPath(name string) (string, common.PrefixMatch) {
+	sshPath := cleanCommandPath(name)
+	result, match := c.connection.ResolvePrefixPath(sshPath)
+	if match != common.PathContainsPrefix {
+		return sshPath, match
+	}
+	if strings.HasSuffix(sshPath, "/") && !strings.HasSuffix(result, "/") {
+		result += "/"
+	}
+	return result, match
+}
+
 // for the supported commands, the destination path, if any, is the last argument
 func (c *sshCommand) getDestPath() string {
 	if len(c.args) == 0 {
@@ -726,6 +828,8 @@ func (c *sshCommand) sendExitStatus(err error) {
 	// for scp we notify single uploads/downloads
 	if c.command != scpCmdName {
 		metrics.SSHCommandCompleted(err)
+		virtualPath := cmdPath
+		virtualTarget := targetPath
 		if len(cmdPath) > 0 {
 			p, e := c.connection.Fs.ResolvePath(cmdPath)
 			if e == nil {
@@ -738,7 +842,8 @@ func (c *sshCommand) sendExitStatus(err error) {
 				targetPath = p
 			}
 		}
-		common.SSHCommandActionNotification(&c.connection.User, cmdPath, targetPath, c.command, err)
+		common.SSHCommandActionNotification(c.connection.BaseConnection, cmdPath, virtualPath, targetPath, virtualTarget,
+			c.command, err)
 	}
 }
 
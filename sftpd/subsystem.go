@@ -52,13 +52,13 @@ func ServeSubSystemConnection(user *dataprovider.User, connectionID string, read
 	common.Connections.Add(connection)
 	defer common.Connections.Remove(connection.GetID())
 
-	server := sftp.NewRequestServer(connection.channel, sftp.Handlers{
-		FileGet:  connection,
-		FilePut:  connection,
-		FileCmd:  connection,
-		FileList: connection,
-	}, sftp.WithRSAllocator())
+	extChannel := newExtensionsChannel(connection.channel, connection)
+	prefix := NewPrefixMiddleware(connection.GetPrefixMapping(), extChannel.TrackTransfers(connection))
+	handler := NewHandlersFromMiddleware(NewCurrentDirMiddleware(prefix, connection.GetSessionWorkingDir()))
+	server := sftp.NewRequestServer(extChannel, handler, sftp.WithRSAllocator())
 
 	defer server.Close()
-	return server.Serve()
+	err = server.Serve()
+	extChannel.Wait()
+	return err
 }
@@ -117,6 +117,7 @@ func (t *transfer) WriteAt(p []byte, off int64) (n int, err error) {
 
 	n, err = t.writerAt.WriteAt(p, off)
 	atomic.AddInt64(&t.BytesReceived, int64(n))
+	t.UpdateChecksum(p[:n], off)
 
 	if t.MaxWriteSize > 0 && err == nil && atomic.LoadInt64(&t.BytesReceived) > t.MaxWriteSize {
 		err = common.ErrQuotaExceeded
@@ -199,6 +200,7 @@ func (t *transfer) copyFromReaderToWriter(dst io.Writer, src io.Reader) (int64,
 					atomic.StoreInt64(&t.BytesSent, written)
 				} else {
 					atomic.StoreInt64(&t.BytesReceived, written)
+					t.UpdateChecksum(buf[0:nw], written-int64(nw))
 				}
 				if t.MaxWriteSize > 0 && written > t.MaxWriteSize {
 					err = common.ErrQuotaExceeded
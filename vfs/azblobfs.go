@@ -24,6 +24,7 @@ import (
 	"github.com/eikenb/pipeat"
 	"github.com/pkg/sftp"
 
+	"github.com/drakkan/sftpgo/fsmeta"
 	"github.com/drakkan/sftpgo/logger"
 	"github.com/drakkan/sftpgo/metrics"
 	"github.com/drakkan/sftpgo/version"
@@ -44,6 +45,7 @@ type AzureBlobFs struct {
 	containerURL   azblob.ContainerURL
 	ctxTimeout     time.Duration
 	ctxLongTimeout time.Duration
+	multipartStore MultipartUploadStore
 }
 
 func init() {
@@ -167,11 +169,14 @@ func (fs *AzureBlobFs) Stat(name string) (os.FileInfo, error) {
 	if err == nil {
 		isDir := (attrs.ContentType() == dirMimeType)
 		metrics.AZListObjectsCompleted(nil)
-		return NewFileInfo(name, isDir, attrs.ContentLength(), attrs.LastModified(), false), nil
+		return NewFileInfo(name, isDir, attrs.ContentLength(), fs.getModTime(attrs.NewMetadata(), attrs.LastModified()), false), nil
 	}
 	if !fs.IsNotExist(err) {
 		return nil, err
 	}
+	if info, ok := getPendingUploadInfo(fs.multipartStore, name); ok {
+		return info, nil
+	}
 	// now check if this is a prefix (virtual directory)
 	hasContents, err := fs.hasContents(name)
 	if err != nil {
@@ -223,6 +228,10 @@ func (fs *AzureBlobFs) Open(name string, offset int64) (File, *pipeat.PipeReader
 
 // Create creates or opens the named file for writing
 func (fs *AzureBlobFs) Create(name string, flag int) (File, *PipeWriter, func(), error) {
+	if fs.IsUploadResumeSupported() && flag != -1 {
+		fs.abortPendingUpload(name)
+		return fs.createResumable(name, 0, MultipartUpload{Name: name})
+	}
 	r, w, err := pipeat.PipeInDir(fs.localTempDir)
 	if err != nil {
 		return nil, nil, nil, err
@@ -241,6 +250,10 @@ func (fs *AzureBlobFs) Create(name string, flag int) (File, *PipeWriter, func(),
 	if contentType != "" {
 		headers.ContentType = contentType
 	}
+	metadata := azblob.Metadata{}
+	if fsmeta.EnabledFor(fsmeta.SchemeAzureBlob, fs.config.Container) {
+		metadata = fsmeta.NewAzureBlobMetadata(time.Now())
+	}
 
 	go func() {
 		defer cancelFn()
@@ -254,7 +267,7 @@ func (fs *AzureBlobFs) Create(name string, flag int) (File, *PipeWriter, func(),
 		// if we shutdown Azurite while uploading it hangs, so we use our own wrapper for
 		// the low level functions
 		_, err := azblob.UploadStreamToBlockBlob(ctx, r, blobBlockURL, uploadOptions)*/
-		err := fs.handleMultipartUpload(ctx, r, &blobBlockURL, &headers)
+		err := fs.handleMultipartUpload(ctx, r, &blobBlockURL, &headers, metadata)
 		r.CloseWithError(err) //nolint:errcheck
 		p.Done(err)
 		fsLog(fs, logger.LevelDebug, "upload completed, path: %#v, readed bytes: %v, err: %v", name, r.GetReadedBytes(), err)
@@ -286,6 +299,18 @@ func (fs *AzureBlobFs) Rename(source, target string) error {
 			return fmt.Errorf("Cannot rename non empty directory: %#v", source)
 		}
 	}
+	if err := fs.copyBlob(source, target); err != nil {
+		return err
+	}
+	return fs.Remove(source, fi.IsDir())
+}
+
+// CopyFile implements the Copier interface using the Azure server side copy
+func (fs *AzureBlobFs) CopyFile(source, target string) error {
+	return fs.copyBlob(source, target)
+}
+
+func (fs *AzureBlobFs) copyBlob(source, target string) error {
 	dstBlobURL := fs.containerURL.NewBlobURL(target)
 	srcURL := fs.containerURL.NewBlobURL(source).URL()
 
@@ -324,7 +349,7 @@ func (fs *AzureBlobFs) Rename(source, target string) error {
 		return err
 	}
 	metrics.AZCopyObjectCompleted(nil)
-	return fs.Remove(source, fi.IsDir())
+	return nil
 }
 
 // Remove removes the named file or (empty) directory.
@@ -344,6 +369,12 @@ func (fs *AzureBlobFs) Remove(name string, isDir bool) error {
 
 	_, err := blobBlockURL.Delete(ctx, azblob.DeleteSnapshotsOptionNone, azblob.BlobAccessConditions{})
 	metrics.AZDeleteObjectCompleted(err)
+	if !isDir && (err == nil || fs.IsNotExist(err)) {
+		// an interrupted upload is visible as a file and so it can be removed
+		if fs.abortPendingUpload(name) {
+			err = nil
+		}
+	}
 	return err
 }
 
@@ -407,6 +438,15 @@ func (fs *AzureBlobFs) ReadDir(dirname string) ([]os.FileInfo, error) {
 
 	prefixes := make(map[string]bool)
 
+	preloadCtx, preloadCancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxTimeout))
+	defer preloadCancelFn()
+
+	provider, err := fs.preloadFSMetaData(preloadCtx, prefix)
+	if err != nil {
+		metrics.AZListObjectsCompleted(err)
+		return nil, err
+	}
+
 	for marker := (azblob.Marker{}); marker.NotDone(); {
 		ctx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxTimeout))
 		defer cancelFn()
@@ -457,7 +497,18 @@ func (fs *AzureBlobFs) ReadDir(dirname string) ([]os.FileInfo, error) {
 					prefixes[name] = true
 				}
 			}
-			result = append(result, NewFileInfo(name, isDir, size, blobInfo.Properties.LastModified, false))
+			modTime := blobInfo.Properties.LastModified
+			if !isDir {
+				if Meta, err := provider.Get(ctx, fsmeta.Key{
+					Path:      blobInfo.Name,
+					ETag:      string(blobInfo.Properties.Etag),
+					StoreTime: blobInfo.Properties.LastModified,
+					Size:      size,
+				}); err == nil && !Meta.LastModified.IsZero() {
+					modTime = Meta.LastModified
+				}
+			}
+			result = append(result, NewFileInfo(name, isDir, size, modTime, false))
 		}
 	}
 
@@ -465,10 +516,32 @@ func (fs *AzureBlobFs) ReadDir(dirname string) ([]os.FileInfo, error) {
 	return result, nil
 }
 
+func (fs *AzureBlobFs) preloadFSMetaData(ctx context.Context, Prefix string) (fsmeta.Provider, error) {
+	if fsmeta.EnabledFor(fsmeta.SchemeAzureBlob, fs.config.Container) {
+		Provider := fsmeta.DefaultFactory.New(fsmeta.NewAzureBlobProvider(fs.containerURL, fs.config.Container))
+		err := Provider.Preload(ctx, Prefix)
+		return Provider, err
+	}
+	return fsmeta.EmptyProvider, nil
+}
+
+// getModTime returns the fsmeta modification time stored in the blob
+// metadata, if fsmeta is enabled for this container, or the blob last modified time
+func (fs *AzureBlobFs) getModTime(metadata azblob.Metadata, lastModified time.Time) time.Time {
+	if fsmeta.EnabledFor(fsmeta.SchemeAzureBlob, fs.config.Container) {
+		if MetaLastModified, metaErr := fsmeta.StringMetaHelper(metadata).GetTime(fsmeta.AzureBlobMetaKey); metaErr == nil {
+			if !MetaLastModified.IsZero() {
+				return MetaLastModified
+			}
+		}
+	}
+	return lastModified
+}
+
 // IsUploadResumeSupported returns true if upload resume is supported.
-// Upload Resume is not supported on Azure Blob
-func (*AzureBlobFs) IsUploadResumeSupported() bool {
-	return false
+// Resume is supported if a store for the interrupted uploads is set
+func (fs *AzureBlobFs) IsUploadResumeSupported() bool {
+	return fs.multipartStore != nil
 }
 
 // IsAtomicUploadSupported returns true if atomic upload is supported.
@@ -781,7 +854,7 @@ func (fs *AzureBlobFs) hasContents(name string) (bool, error) {
 }
 
 func (fs *AzureBlobFs) handleMultipartUpload(ctx context.Context, reader io.Reader, blockBlobURL *azblob.BlockBlobURL,
-	httpHeaders *azblob.BlobHTTPHeaders) error {
+	httpHeaders *azblob.BlobHTTPHeaders, metadata azblob.Metadata) error {
 	partSize := fs.config.UploadPartSize
 	guard := make(chan struct{}, fs.config.UploadConcurrency)
 	blockCtxTimeout := time.Duration(fs.config.UploadPartSize/(1024*1024)) * time.Minute
@@ -856,7 +929,7 @@ func (fs *AzureBlobFs) handleMultipartUpload(ctx context.Context, reader io.Read
 		return poolError
 	}
 
-	_, err := blockBlobURL.CommitBlockList(ctx, blocks, *httpHeaders, azblob.Metadata{}, azblob.BlobAccessConditions{},
+	_, err := blockBlobURL.CommitBlockList(ctx, blocks, *httpHeaders, metadata, azblob.BlobAccessConditions{},
 		azblob.AccessTierType(fs.config.AccessTier), nil, azblob.ClientProvidedKeyOptions{})
 	return err
 }
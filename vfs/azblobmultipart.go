@@ -0,0 +1,283 @@
+//go:build !noazblob
+// +build !noazblob
+
+package vfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/eikenb/pipeat"
+	"github.com/rs/xid"
+
+	"github.com/drakkan/sftpgo/fsmeta"
+	"github.com/drakkan/sftpgo/logger"
+	"github.com/drakkan/sftpgo/metrics"
+)
+
+// azureBlockIDSize is the size of the binary block IDs, all the blocks within
+// a blob must have IDs with the same length
+const azureBlockIDSize = 8
+
+// SetMultipartUploadStore sets the store for the state of the in-progress
+// uploads. Upload resume is supported after setting a store
+func (fs *AzureBlobFs) SetMultipartUploadStore(store MultipartUploadStore) {
+	fs.multipartStore = store
+}
+
+// ResumeUpload continues the interrupted upload for the named file if the size
+// of its staged blocks matches the given offset, otherwise the uploaded data
+// will be appended to the committed blocks of the existing blob
+func (fs *AzureBlobFs) ResumeUpload(name string, offset int64) (File, *PipeWriter, func(), error) {
+	if !fs.IsUploadResumeSupported() {
+		return nil, nil, nil, ErrVfsUnsupported
+	}
+	upload, err := fs.multipartStore.GetMultipartUpload(name)
+	if err == nil {
+		if upload.GetSize() == offset {
+			fsLog(fs, logger.LevelDebug, "resuming upload for %#v, upload id: %#v, blocks: %v, offset: %v",
+				name, upload.UploadID, len(upload.Parts), offset)
+			return fs.createResumable(name, offset, upload)
+		}
+		fs.abortPendingUpload(name)
+	} else if !errors.Is(err, ErrMultipartUploadNotFound) {
+		return nil, nil, nil, err
+	}
+	parts, err := fs.getCommittedBlocks(name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	upload = MultipartUpload{
+		Name:  name,
+		Parts: parts,
+	}
+	if upload.GetSize() != offset {
+		return nil, nil, nil, fmt.Errorf("unable to resume the upload for %#v, invalid offset %v, blob size: %v",
+			name, offset, upload.GetSize())
+	}
+	return fs.createResumable(name, offset, upload)
+}
+
+// AbortMultipartUpload implements the ResumableUploader interface.
+// There is no API to remove the uncommitted blocks, Azure discards
+// them a week after the last change
+func (*AzureBlobFs) AbortMultipartUpload(upload MultipartUpload) error {
+	return nil
+}
+
+// abortPendingUpload removes the state of the interrupted upload for the named file.
+// It returns true if an interrupted upload was found
+func (fs *AzureBlobFs) abortPendingUpload(name string) bool {
+	if fs.multipartStore == nil {
+		return false
+	}
+	if _, err := fs.multipartStore.GetMultipartUpload(name); err != nil {
+		return false
+	}
+	if err := fs.multipartStore.DeleteMultipartUpload(name); err != nil {
+		fsLog(fs, logger.LevelWarn, "unable to delete upload state for %#v: %v", name, err)
+	}
+	return true
+}
+
+// getCommittedBlocks returns the committed blocks for the named blob as upload parts.
+// Appending is supported only for blobs uploaded using sequential block IDs
+func (fs *AzureBlobFs) getCommittedBlocks(name string) ([]MultipartUploadPart, error) {
+	ctx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxTimeout))
+	defer cancelFn()
+
+	blockBlobURL := fs.containerURL.NewBlockBlobURL(name)
+	blockList, err := blockBlobURL.GetBlockList(ctx, azblob.BlockListCommitted, azblob.LeaseAccessConditions{})
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]MultipartUploadPart, 0, len(blockList.CommittedBlocks))
+	for idx, block := range blockList.CommittedBlocks {
+		number := int64(idx + 1)
+		if block.Name != getAzureBlockID(number) {
+			fsLog(fs, logger.LevelDebug, "unable to append to %#v, unexpected block id %#v", name, block.Name)
+			return nil, ErrVfsUnsupported
+		}
+		parts = append(parts, MultipartUploadPart{
+			Number: number,
+			ETag:   block.Name,
+			Size:   block.Size,
+		})
+	}
+	if len(parts) == 0 {
+		fsLog(fs, logger.LevelDebug, "unable to append to %#v, no committed blocks", name)
+		return nil, ErrVfsUnsupported
+	}
+	return parts, nil
+}
+
+func (fs *AzureBlobFs) createResumable(name string, offset int64, upload MultipartUpload) (File, *PipeWriter, func(), error) {
+	r, w, err := pipeat.PipeInDir(fs.localTempDir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	p := newResumedPipeWriter(w, offset)
+	blockBlobURL := fs.containerURL.NewBlockBlobURL(name)
+	ctx, cancelFn := context.WithCancel(context.Background())
+	tracker := newMultipartUploadTracker(fs.multipartStore, upload)
+
+	go func() {
+		defer cancelFn()
+
+		err := fs.handleResumableUpload(ctx, r, &blockBlobURL, tracker)
+		r.CloseWithError(err) //nolint:errcheck
+		p.Done(err)
+		fsLog(fs, logger.LevelDebug, "resumable upload completed, path: %#v, upload id: %#v, offset: %v, readed bytes: %v, err: %v",
+			name, tracker.getUploadID(), offset, r.GetReadedBytes(), err)
+		metrics.AZTransferCompleted(r.GetReadedBytes(), 0, err)
+	}()
+
+	return nil, p, cancelFn, nil
+}
+
+// handleResumableUpload stages the data read from reader as blocks persisting
+// the completed ones. Small files are uploaded using a single request
+func (fs *AzureBlobFs) handleResumableUpload(ctx context.Context, reader io.Reader, blockBlobURL *azblob.BlockBlobURL,
+	tracker *multipartUploadTracker,
+) error {
+	headers := azblob.BlobHTTPHeaders{
+		ContentType: mime.TypeByExtension(path.Ext(tracker.getName())),
+	}
+	metadata := azblob.Metadata{}
+	if fsmeta.EnabledFor(fsmeta.SchemeAzureBlob, fs.config.Container) {
+		metadata = fsmeta.NewAzureBlobMetadata(time.Now())
+	}
+	data, eof, err := readUploadPart(reader, nil, fs.config.UploadPartSize)
+	if err != nil {
+		return err
+	}
+	if eof && !tracker.isStarted() && !tracker.hasParts() {
+		uploadCtx, cancelFn := context.WithDeadline(ctx, time.Now().Add(fs.ctxLongTimeout))
+		defer cancelFn()
+
+		_, err = blockBlobURL.Upload(uploadCtx, bytes.NewReader(data), headers, metadata, azblob.BlobAccessConditions{},
+			azblob.AccessTierType(fs.config.AccessTier), nil, azblob.ClientProvidedKeyOptions{})
+		return err
+	}
+	if !tracker.isStarted() {
+		if err := tracker.start(xid.New().String()); err != nil {
+			return err
+		}
+	}
+	err = fs.stageBlocks(ctx, reader, blockBlobURL, tracker, data, eof)
+	if err == nil {
+		// the transfer could be cancelled after the last block was read
+		err = ctx.Err()
+	}
+	if err == nil {
+		parts := tracker.getParts()
+		blocks := make([]string, 0, len(parts))
+		for _, part := range parts {
+			blocks = append(blocks, part.ETag)
+		}
+		commitCtx, cancelFn := context.WithDeadline(ctx, time.Now().Add(fs.ctxLongTimeout))
+		defer cancelFn()
+
+		_, err = blockBlobURL.CommitBlockList(commitCtx, blocks, headers, metadata, azblob.BlobAccessConditions{},
+			azblob.AccessTierType(fs.config.AccessTier), nil, azblob.ClientProvidedKeyOptions{})
+		if err == nil {
+			if errDelete := tracker.delete(); errDelete != nil {
+				fsLog(fs, logger.LevelWarn, "unable to delete upload state for %#v: %v", tracker.getName(), errDelete)
+			}
+			return nil
+		}
+	}
+	if !tracker.hasParts() || isAzureInvalidBlockList(err) {
+		// nothing to resume
+		if errDelete := tracker.delete(); errDelete != nil {
+			fsLog(fs, logger.LevelWarn, "unable to delete upload state for %#v: %v", tracker.getName(), errDelete)
+		}
+	}
+	return err
+}
+
+// stageBlocks stages data and then the contents read from reader using
+// UploadConcurrency concurrent requests
+func (fs *AzureBlobFs) stageBlocks(ctx context.Context, reader io.Reader, blockBlobURL *azblob.BlockBlobURL,
+	tracker *multipartUploadTracker, data []byte, eof bool,
+) error {
+	blockCtxTimeout := time.Duration(fs.config.UploadPartSize/(1024*1024)) * time.Minute
+	poolCtx, poolCancel := context.WithCancel(ctx)
+	defer poolCancel()
+
+	var wg sync.WaitGroup
+	guard := make(chan struct{}, fs.config.UploadConcurrency)
+	partNumber := tracker.nextPartNumber()
+
+	for {
+		if len(data) > 0 {
+			guard <- struct{}{}
+			if tracker.getError() != nil {
+				<-guard
+				break
+			}
+			wg.Add(1)
+			go func(number int64, buf []byte) {
+				defer func() {
+					<-guard
+					wg.Done()
+				}()
+
+				innerCtx, cancelFn := context.WithDeadline(poolCtx, time.Now().Add(blockCtxTimeout))
+				defer cancelFn()
+
+				blockID := getAzureBlockID(number)
+				_, err := blockBlobURL.StageBlock(innerCtx, blockID, bytes.NewReader(buf), azblob.LeaseAccessConditions{},
+					nil, azblob.ClientProvidedKeyOptions{})
+				if err == nil {
+					err = tracker.addPart(MultipartUploadPart{Number: number, ETag: blockID, Size: int64(len(buf))})
+				}
+				if err != nil && tracker.setError(err) {
+					fsLog(fs, logger.LevelDebug, "resumable upload error: %v", err)
+					poolCancel()
+				}
+			}(partNumber, data)
+			partNumber++
+		}
+		if eof {
+			break
+		}
+		var err error
+		data, eof, err = readUploadPart(reader, nil, fs.config.UploadPartSize)
+		if err != nil {
+			if tracker.setError(err) {
+				poolCancel()
+			}
+			break
+		}
+	}
+
+	wg.Wait()
+	return tracker.getError()
+}
+
+// getAzureBlockID returns the block ID for the given part number, the IDs are
+// the same generated by incrementBlockID for non resumable uploads
+func getAzureBlockID(partNumber int64) string {
+	binaryBlockID := make([]byte, azureBlockIDSize)
+	binary.LittleEndian.PutUint64(binaryBlockID, uint64(partNumber))
+	return base64.StdEncoding.EncodeToString(binaryBlockID)
+}
+
+func isAzureInvalidBlockList(err error) bool {
+	var storageErr azblob.StorageError
+	if errors.As(err, &storageErr) {
+		return storageErr.ServiceCode() == azblob.ServiceCodeInvalidBlockList
+	}
+	return false
+}
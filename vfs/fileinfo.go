@@ -4,6 +4,8 @@ import (
 	"os"
 	"path"
 	"time"
+
+	"github.com/drakkan/sftpgo/fsmeta"
 )
 
 // FileInfo implements os.FileInfo for a Cloud Storage file.
@@ -12,6 +14,8 @@ type FileInfo struct {
 	sizeInBytes int64
 	modTime     time.Time
 	mode        os.FileMode
+	uid         *int
+	gid         *int
 }
 
 // NewFileInfo creates file info.
@@ -63,6 +67,28 @@ func (fi *FileInfo) SetMode(mode os.FileMode) {
 	fi.mode = mode
 }
 
+// SetOwner sets the numeric uid and gid reported by Sys, nil values are not changed
+func (fi *FileInfo) SetOwner(uid, gid *int) {
+	if uid != nil {
+		fi.uid = uid
+	}
+	if gid != nil {
+		fi.gid = gid
+	}
+}
+
+// setFSMetaAttributes applies the modification time and the extended attributes
+// stored using fsmeta, attributes not set are not changed
+func (fi *FileInfo) setFSMetaAttributes(meta fsmeta.Meta) {
+	if !meta.LastModified.IsZero() {
+		fi.modTime = meta.LastModified
+	}
+	if meta.Mode != 0 {
+		fi.mode = fi.mode&os.ModeType | meta.Mode.Perm()
+	}
+	fi.SetOwner(meta.UID, meta.GID)
+}
+
 // Sys provides the underlying data source (can return nil)
 func (fi *FileInfo) Sys() interface{} {
 	return fi.getFileInfoSys()
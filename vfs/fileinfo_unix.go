@@ -24,7 +24,14 @@ func init() {
 }
 
 func (fi FileInfo) getFileInfoSys() interface{} {
+	uid, gid := defaultUID, defaultGID
+	if fi.uid != nil {
+		uid = *fi.uid
+	}
+	if fi.gid != nil {
+		gid = *fi.gid
+	}
 	return &syscall.Stat_t{
-		Uid: uint32(defaultUID),
-		Gid: uint32(defaultGID)}
+		Uid: uint32(uid),
+		Gid: uint32(gid)}
 }
@@ -24,6 +24,7 @@ import (
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 
+	"github.com/drakkan/sftpgo/fsmeta"
 	"github.com/drakkan/sftpgo/kms"
 	"github.com/drakkan/sftpgo/logger"
 	"github.com/drakkan/sftpgo/metrics"
@@ -31,7 +32,7 @@ import (
 )
 
 var (
-	gcsDefaultFieldsSelection = []string{"Name", "Size", "Deleted", "Updated", "ContentType", "CustomTime"}
+	gcsDefaultFieldsSelection = []string{"Name", "Size", "Deleted", "Updated", "ContentType", "CustomTime", "Etag"}
 )
 
 // GCSFs is a Fs implementation for Google Cloud Storage.
@@ -43,6 +44,19 @@ type GCSFs struct {
 	ctxTimeout     time.Duration
 	ctxLongTimeout time.Duration
 	nowFunc        func() time.Time // defaults to time.Now
+	// service account used to sign URLs, nil if not available
+	signer         *gcsSigner
+	multipartStore MultipartUploadStore
+	// resumableClient is the authenticated client for the resumable upload
+	// sessions, they are not exposed by the storage client
+	resumableClient   *http.Client
+	resumableEndpoint string
+}
+
+// gcsSigner defines the service account fields required to sign URLs
+type gcsSigner struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
 }
 
 func init() {
@@ -64,6 +78,7 @@ func NewGCSFs(connectionID, localTempDir string, config GCSFsConfig) (Fs, error)
 		return fs, err
 	}
 	ctx := context.Background()
+	var opts []option.ClientOption
 	if fs.config.AutomaticCredentials > 0 {
 		fs.svc, err = storage.NewClient(ctx)
 	} else if !fs.config.Credentials.IsEmpty() {
@@ -73,7 +88,9 @@ func NewGCSFs(connectionID, localTempDir string, config GCSFsConfig) (Fs, error)
 				return fs, err
 			}
 		}
-		fs.svc, err = storage.NewClient(ctx, option.WithCredentialsJSON([]byte(fs.config.Credentials.GetPayload())))
+		opts = append(opts, option.WithCredentialsJSON([]byte(fs.config.Credentials.GetPayload())))
+		fs.svc, err = storage.NewClient(ctx, opts...)
+		fs.setSigner([]byte(fs.config.Credentials.GetPayload()))
 	} else {
 		var creds []byte
 		creds, err = ioutil.ReadFile(fs.config.CredentialFile)
@@ -89,11 +106,29 @@ func NewGCSFs(connectionID, localTempDir string, config GCSFsConfig) (Fs, error)
 		if err != nil {
 			return fs, err
 		}
-		fs.svc, err = storage.NewClient(ctx, option.WithCredentialsJSON([]byte(secret.GetPayload())))
+		opts = append(opts, option.WithCredentialsJSON([]byte(secret.GetPayload())))
+		fs.svc, err = storage.NewClient(ctx, opts...)
+		fs.setSigner([]byte(secret.GetPayload()))
+	}
+	if err != nil {
+		return fs, err
 	}
+	err = fs.setResumableClient(ctx, opts)
 	return fs, err
 }
 
+// setSigner stores the service account from the given credentials, if any.
+// Other credential types cannot be used to sign URLs
+func (fs *GCSFs) setSigner(credentials []byte) {
+	var signer gcsSigner
+	if err := json.Unmarshal(credentials, &signer); err != nil {
+		return
+	}
+	if signer.ClientEmail != "" && signer.PrivateKey != "" {
+		fs.signer = &signer
+	}
+}
+
 // Name returns the name for the Fs implementation
 func (fs *GCSFs) Name() string {
 	return fmt.Sprintf("GCSFs bucket %#v", fs.config.Bucket)
@@ -121,13 +156,16 @@ func (fs *GCSFs) Stat(name string) (os.FileInfo, error) {
 	attrs, err := fs.headObject(name)
 	if err == nil {
 		objSize := attrs.Size
-		objectModTime := customTimeOrDefault(attrs)
+		objectModTime := fs.getModTime(attrs)
 		isDir := attrs.ContentType == dirMimeType || strings.HasSuffix(attrs.Name, "/")
 		return NewFileInfo(name, isDir, objSize, objectModTime, false), nil
 	}
 	if !fs.IsNotExist(err) {
 		return result, err
 	}
+	if info, ok := getPendingUploadInfo(fs.multipartStore, name); ok {
+		return info, nil
+	}
 	// now check if this is a prefix (virtual directory)
 	hasContents, err := fs.hasContents(name)
 	if err == nil && hasContents {
@@ -189,28 +227,17 @@ func (fs *GCSFs) Open(name string, offset int64) (File, *pipeat.PipeReaderAt, fu
 
 // Create creates or opens the named file for writing
 func (fs *GCSFs) Create(name string, flag int) (File, *PipeWriter, func(), error) {
+	if fs.IsUploadResumeSupported() && flag != -1 {
+		fs.abortPendingUpload(name)
+		return fs.createResumable(name, 0, MultipartUpload{Name: name})
+	}
 	r, w, err := pipeat.PipeInDir(fs.localTempDir)
 	if err != nil {
 		return nil, nil, nil, err
 	}
 	p := NewPipeWriter(w)
-	bkt := fs.svc.Bucket(fs.config.Bucket)
-	obj := bkt.Object(name)
 	ctx, cancelFn := context.WithCancel(context.Background())
-	objectWriter := obj.NewWriter(ctx)
-	objectWriter.ObjectAttrs.CustomTime = fs.nowFunc()
-	var contentType string
-	if flag == -1 {
-		contentType = dirMimeType
-	} else {
-		contentType = mime.TypeByExtension(path.Ext(name))
-	}
-	if contentType != "" {
-		objectWriter.ObjectAttrs.ContentType = contentType
-	}
-	if fs.config.StorageClass != "" {
-		objectWriter.ObjectAttrs.StorageClass = fs.config.StorageClass
-	}
+	objectWriter := fs.newObjectWriter(ctx, name, flag)
 	go func() {
 		defer cancelFn()
 
@@ -227,6 +254,32 @@ func (fs *GCSFs) Create(name string, flag int) (File, *PipeWriter, func(), error
 	return nil, p, cancelFn, nil
 }
 
+// newObjectWriter returns a writer for the named object with the attributes set
+// for every upload. A flag of -1 means a directory
+func (fs *GCSFs) newObjectWriter(ctx context.Context, name string, flag int) *storage.Writer {
+	objectWriter := fs.svc.Bucket(fs.config.Bucket).Object(name).NewWriter(ctx)
+	objectWriter.ObjectAttrs = fs.getUploadAttrs(name, flag)
+	return objectWriter
+}
+
+// getUploadAttrs returns the attributes to set for an uploaded object
+func (fs *GCSFs) getUploadAttrs(name string, flag int) storage.ObjectAttrs {
+	attrs := storage.ObjectAttrs{
+		Name:         name,
+		CustomTime:   fs.nowFunc(),
+		StorageClass: fs.config.StorageClass,
+	}
+	if fsmeta.EnabledFor(fsmeta.SchemeGCS, fs.config.Bucket) {
+		attrs.Metadata = fsmeta.NewGCSMetadata(attrs.CustomTime)
+	}
+	if flag == -1 {
+		attrs.ContentType = dirMimeType
+	} else {
+		attrs.ContentType = mime.TypeByExtension(path.Ext(name))
+	}
+	return attrs
+}
+
 // Rename renames (moves) source to target.
 // We don't support renaming non empty directories since we should
 // rename all the contents too and this could take long time: think
@@ -249,6 +302,24 @@ func (fs *GCSFs) Rename(source, target string) error {
 			return fmt.Errorf("Cannot rename non empty directory: %#v", source)
 		}
 	}
+	var contentType string
+	if fi.IsDir() {
+		contentType = dirMimeType
+	} else {
+		contentType = mime.TypeByExtension(path.Ext(source))
+	}
+	if err := fs.copyObject(source, target, contentType); err != nil {
+		return err
+	}
+	return fs.Remove(source, fi.IsDir())
+}
+
+// CopyFile implements the Copier interface using the GCS server side rewrite
+func (fs *GCSFs) CopyFile(source, target string) error {
+	return fs.copyObject(source, target, mime.TypeByExtension(path.Ext(target)))
+}
+
+func (fs *GCSFs) copyObject(source, target, contentType string) error {
 	src := fs.svc.Bucket(fs.config.Bucket).Object(source)
 	dst := fs.svc.Bucket(fs.config.Bucket).Object(target)
 	ctx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxTimeout))
@@ -257,21 +328,12 @@ func (fs *GCSFs) Rename(source, target string) error {
 	if fs.config.StorageClass != "" {
 		copier.StorageClass = fs.config.StorageClass
 	}
-	var contentType string
-	if fi.IsDir() {
-		contentType = dirMimeType
-	} else {
-		contentType = mime.TypeByExtension(path.Ext(source))
-	}
 	if contentType != "" {
 		copier.ContentType = contentType
 	}
-	_, err = copier.Run(ctx)
+	_, err := copier.Run(ctx)
 	metrics.GCSCopyObjectCompleted(err)
-	if err != nil {
-		return err
-	}
-	return fs.Remove(source, fi.IsDir())
+	return err
 }
 
 // Remove removes the named file or (empty) directory.
@@ -295,6 +357,12 @@ func (fs *GCSFs) Remove(name string, isDir bool) error {
 		err = fs.svc.Bucket(fs.config.Bucket).Object(name).Delete(ctx)
 		metrics.GCSDeleteObjectCompleted(err)
 	}
+	if !isDir && (err == nil || fs.IsNotExist(err)) {
+		// an interrupted upload is visible as a file and so it can be removed
+		if fs.abortPendingUpload(name) {
+			err = nil
+		}
+	}
 	return err
 }
 
@@ -349,7 +417,7 @@ func (fs *GCSFs) ReadDir(dirname string) ([]os.FileInfo, error) {
 	if !strings.HasSuffix(dirname, `/`) {
 		if attrs, err := fs.headObject(dirname); err == nil {
 			objSize := attrs.Size
-			objectModTime := customTimeOrDefault(attrs)
+			objectModTime := fs.getModTime(attrs)
 			return []os.FileInfo{NewFileInfo(dirname, false, objSize, objectModTime, false)}, nil
 		}
 	}
@@ -368,6 +436,12 @@ func (fs *GCSFs) ReadDir(dirname string) ([]os.FileInfo, error) {
 	ctx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxTimeout))
 	defer cancelFn()
 
+	provider, err := fs.preloadFSMetaData(ctx, prefix)
+	if err != nil {
+		metrics.GCSListObjectsCompleted(err)
+		return result, err
+	}
+
 	bkt := fs.svc.Bucket(fs.config.Bucket)
 	it := bkt.Objects(ctx, query)
 	for {
@@ -408,6 +482,16 @@ func (fs *GCSFs) ReadDir(dirname string) ([]os.FileInfo, error) {
 				prefixes[name] = true
 			}
 			objectModTime := customTimeOrDefault(attrs)
+			if !isDir {
+				if Meta, err := provider.Get(ctx, fsmeta.Key{
+					Path:      attrs.Name,
+					ETag:      attrs.Etag,
+					StoreTime: attrs.Updated,
+					Size:      attrs.Size,
+				}); err == nil && !Meta.LastModified.IsZero() {
+					objectModTime = Meta.LastModified
+				}
+			}
 			fi := NewFileInfo(name, isDir, attrs.Size, objectModTime, false)
 			result = append(result, fi)
 		}
@@ -416,14 +500,23 @@ func (fs *GCSFs) ReadDir(dirname string) ([]os.FileInfo, error) {
 	return result, nil
 }
 
+func (fs *GCSFs) preloadFSMetaData(ctx context.Context, Prefix string) (fsmeta.Provider, error) {
+	if fsmeta.EnabledFor(fsmeta.SchemeGCS, fs.config.Bucket) {
+		Provider := fsmeta.DefaultFactory.New(fsmeta.NewGCSProvider(fs.svc, fs.config.Bucket))
+		err := Provider.Preload(ctx, Prefix)
+		return Provider, err
+	}
+	return fsmeta.EmptyProvider, nil
+}
+
 // IsUploadResumeSupported returns true if upload resume is supported.
-// SFTP Resume is not supported on S3
-func (*GCSFs) IsUploadResumeSupported() bool {
-	return false
+// Resume is supported if a store for the interrupted upload sessions is set
+func (fs *GCSFs) IsUploadResumeSupported() bool {
+	return fs.multipartStore != nil
 }
 
 // IsAtomicUploadSupported returns true if atomic upload is supported.
-// S3 uploads are already atomic, we don't need to upload to a temporary
+// GCS uploads are already atomic, we don't need to upload to a temporary
 // file
 func (*GCSFs) IsAtomicUploadSupported() bool {
 	return false
@@ -705,6 +798,25 @@ func (fs *GCSFs) GetMimeType(name string) (string, error) {
 	return attrs.ContentType, nil
 }
 
+// PresignURL returns a V4 signed URL to download, GET method, or upload, PUT
+// method, the named object. The URL is valid for the given duration.
+// Signing requires service account credentials
+func (fs *GCSFs) PresignURL(name, method string, expiration time.Duration) (string, error) {
+	if fs.signer == nil {
+		return "", fmt.Errorf("%w: signed URLs require service account credentials", ErrVfsUnsupported)
+	}
+	if method != http.MethodGet && method != http.MethodPut {
+		return "", fmt.Errorf("unable to sign %#v: unsupported method %#v", name, method)
+	}
+	return storage.SignedURL(fs.config.Bucket, name, &storage.SignedURLOptions{
+		GoogleAccessID: fs.signer.ClientEmail,
+		PrivateKey:     []byte(fs.signer.PrivateKey),
+		Method:         method,
+		Expires:        time.Now().Add(expiration),
+		Scheme:         storage.SigningSchemeV4,
+	})
+}
+
 // Close closes the fs
 func (fs *GCSFs) Close() error {
 	return nil
@@ -715,6 +827,19 @@ func (*GCSFs) GetAvailableDiskSize(dirName string) (*sftp.StatVFS, error) {
 	return nil, ErrStorageSizeUnavailable
 }
 
+// getModTime returns the fsmeta modification time stored in the object
+// metadata, if fsmeta is enabled for this bucket, or the object custom time
+func (fs *GCSFs) getModTime(attrs *storage.ObjectAttrs) time.Time {
+	if fsmeta.EnabledFor(fsmeta.SchemeGCS, fs.config.Bucket) {
+		if MetaLastModified, metaErr := fsmeta.StringMetaHelper(attrs.Metadata).GetTime(fsmeta.GCSMetaKey); metaErr == nil {
+			if !MetaLastModified.IsZero() {
+				return MetaLastModified
+			}
+		}
+	}
+	return customTimeOrDefault(attrs)
+}
+
 func customTimeOrDefault(attrs *storage.ObjectAttrs) time.Time {
 	if !attrs.CustomTime.IsZero() {
 		return attrs.CustomTime
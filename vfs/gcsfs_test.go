@@ -3,6 +3,12 @@ package vfs
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -15,6 +21,8 @@ import (
 	"github.com/h2non/gock"
 	"github.com/stretchr/testify/suite"
 	"google.golang.org/api/option"
+
+	"github.com/drakkan/sftpgo/fsmeta"
 )
 
 const (
@@ -128,6 +136,46 @@ func (Suite *GCSFsSuite) TestStat_ValidCustomTime() {
 	Suite.True(gock.IsDone(), "pending mocks: %s", printPendingMocks())
 }
 
+func (Suite *GCSFsSuite) TestStat_FSMetaMetadata() {
+	EnabledRestore := fsmeta.Enabled
+	CurrentBuckets := fsmeta.Buckets
+	defer func() {
+		gock.Off()
+		fsmeta.Enabled = EnabledRestore
+		fsmeta.Buckets = CurrentBuckets
+	}()
+
+	for i := 0; i < 2; i++ {
+		gock.New(testBaseURL).
+			Get("/b/bucket1/o/users/test1/test.txt").
+			Reply(200).
+			JSON(map[string]any{
+				"bucket":      "bucket1",
+				"name":        "test.txt",
+				"contentType": "text/plain",
+				"size":        "8",
+				"updated":     apr28.Format(time.RFC3339),
+				"customTime":  apr28.Format(time.RFC3339),
+				"metadata": map[string]string{
+					fsmeta.GCSMetaKey: jan1.Format(time.RFC3339),
+				},
+			})
+	}
+
+	fsmeta.Enabled = true
+	fsmeta.Buckets = []string{`gs://bucket1`}
+	info, err := Suite.Fs.Stat("users/test1/test.txt")
+	Suite.NoError(err)
+	Suite.Equal(jan1, info.ModTime())
+
+	fsmeta.Buckets = []string{`s3://bucket1`}
+	info, err = Suite.Fs.Stat("users/test1/test.txt")
+	Suite.NoError(err)
+	Suite.Equal(apr28, info.ModTime())
+
+	Suite.True(gock.IsDone(), "pending mocks: %s", printPendingMocks())
+}
+
 func (Suite *GCSFsSuite) TestReadDir_IsObject_NoCustomTime() {
 	defer gock.Off()
 
@@ -260,6 +308,217 @@ func (Suite *GCSFsSuite) TestCreate_CustomTimeAttribute() {
 	Suite.True(gock.IsDone(), "pending mocks: %s", printPendingMocks())
 }
 
+func (Suite *GCSFsSuite) setResumableUploads() {
+	Suite.Fs.multipartStore = newMemoryMultipartStore()
+	Suite.Fs.resumableClient = &http.Client{}
+	Suite.Fs.resumableEndpoint = testBaseURL + "/upload/storage/v1/"
+	gcsResumableChunkSize = 4
+}
+
+func (Suite *GCSFsSuite) resetResumableUploads() {
+	gock.Off()
+	Suite.Fs.multipartStore = nil
+	Suite.Fs.resumableClient = nil
+	Suite.Fs.resumableEndpoint = ""
+	gcsResumableChunkSize = 16 * 1024 * 1024
+}
+
+func (Suite *GCSFsSuite) writeAndWait(writer *PipeWriter, data []byte) error {
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := writer.Write(data)
+		if err == nil {
+			err = writer.Close()
+		}
+		errCh <- err
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-time.After(time.Second * 5):
+		Suite.FailNow("timeout for writer close")
+	}
+	return nil
+}
+
+func (Suite *GCSFsSuite) TestCreate_ResumableUpload() {
+	Suite.setResumableUploads()
+	defer Suite.resetResumableUploads()
+
+	sessionURI := testBaseURL + "/upload/session/1"
+	gock.New(testBaseURL).
+		Post("/upload/storage/v1/b/bucket1/o").
+		MatchParam("uploadType", "resumable").
+		MatchParam("name", "new.txt").
+		Reply(200).
+		SetHeader("Location", sessionURI)
+	gock.New(testBaseURL).
+		Put("/upload/session/1").
+		MatchHeader("Content-Range", `^bytes 0-3/\*$`).
+		Reply(308).
+		SetHeader("Range", "bytes=0-3")
+	// only part of the chunk is persisted, the remaining bytes are sent again
+	gock.New(testBaseURL).
+		Put("/upload/session/1").
+		MatchHeader("Content-Range", `^bytes 4-7/\*$`).
+		Reply(308).
+		SetHeader("Range", "bytes=0-5")
+	gock.New(testBaseURL).
+		Put("/upload/session/1").
+		MatchHeader("Content-Range", `^bytes 6-9/\*$`).
+		Reply(308).
+		SetHeader("Range", "bytes=0-9")
+	gock.New(testBaseURL).
+		Put("/upload/session/1").
+		MatchHeader("Content-Range", `^bytes \*/10$`).
+		Reply(200)
+
+	_, writer, _, err := Suite.Fs.Create("new.txt", 0)
+	Suite.Require().NoError(err)
+	Suite.NoError(Suite.writeAndWait(writer, []byte("0123456789")))
+
+	_, err = Suite.Fs.multipartStore.GetMultipartUpload("new.txt")
+	Suite.ErrorIs(err, ErrMultipartUploadNotFound)
+	Suite.True(gock.IsDone(), "pending mocks: %s", printPendingMocks())
+}
+
+func (Suite *GCSFsSuite) TestCreate_ResumableUploadInterrupted() {
+	Suite.setResumableUploads()
+	defer Suite.resetResumableUploads()
+
+	sessionURI := testBaseURL + "/upload/session/2"
+	gock.New(testBaseURL).
+		Post("/upload/storage/v1/b/bucket1/o").
+		Reply(200).
+		SetHeader("Location", sessionURI)
+	gock.New(testBaseURL).
+		Put("/upload/session/2").
+		MatchHeader("Content-Range", `^bytes 0-3/\*$`).
+		Reply(308).
+		SetHeader("Range", "bytes=0-3")
+	gock.New(testBaseURL).
+		Put("/upload/session/2").
+		MatchHeader("Content-Range", `^bytes 4-7/\*$`).
+		Reply(503)
+
+	_, writer, _, err := Suite.Fs.Create("interrupted.txt", 0)
+	Suite.Require().NoError(err)
+	Suite.Error(Suite.writeAndWait(writer, []byte("0123456789")))
+
+	upload, err := Suite.Fs.multipartStore.GetMultipartUpload("interrupted.txt")
+	Suite.Require().NoError(err)
+	Suite.Equal(sessionURI, upload.UploadID)
+	Suite.Equal(int64(4), upload.GetSize())
+	Suite.True(gock.IsDone(), "pending mocks: %s", printPendingMocks())
+
+	info, ok := getPendingUploadInfo(Suite.Fs.multipartStore, "interrupted.txt")
+	Suite.Require().True(ok)
+	Suite.Equal(int64(4), info.Size())
+
+	// the session persisted size matches the offset, the upload continues
+	gock.New(testBaseURL).
+		Put("/upload/session/2").
+		MatchHeader("Content-Range", `^bytes \*/\*$`).
+		Reply(308).
+		SetHeader("Range", "bytes=0-3")
+	gock.New(testBaseURL).
+		Put("/upload/session/2").
+		MatchHeader("Content-Range", `^bytes 4-7/\*$`).
+		Reply(308).
+		SetHeader("Range", "bytes=0-7")
+	gock.New(testBaseURL).
+		Put("/upload/session/2").
+		MatchHeader("Content-Range", `^bytes 8-9/10$`).
+		Reply(200)
+
+	_, writer, _, err = Suite.Fs.ResumeUpload("interrupted.txt", 4)
+	Suite.Require().NoError(err)
+	Suite.NoError(Suite.writeAndWait(writer, []byte("456789")))
+
+	_, err = Suite.Fs.multipartStore.GetMultipartUpload("interrupted.txt")
+	Suite.ErrorIs(err, ErrMultipartUploadNotFound)
+	Suite.True(gock.IsDone(), "pending mocks: %s", printPendingMocks())
+}
+
+func (Suite *GCSFsSuite) TestAbortMultipartUpload() {
+	Suite.setResumableUploads()
+	defer Suite.resetResumableUploads()
+
+	Suite.NoError(Suite.Fs.AbortMultipartUpload(MultipartUpload{Name: "file.txt"}))
+
+	gock.New(testBaseURL).
+		Delete("/upload/session/3").
+		Reply(gcsStatusClientClosedRequest)
+	gock.New(testBaseURL).
+		Delete("/upload/session/4").
+		Reply(404)
+	gock.New(testBaseURL).
+		Delete("/upload/session/5").
+		Reply(500)
+
+	Suite.NoError(Suite.Fs.AbortMultipartUpload(MultipartUpload{
+		Name:     "file.txt",
+		UploadID: testBaseURL + "/upload/session/3",
+	}))
+	Suite.NoError(Suite.Fs.AbortMultipartUpload(MultipartUpload{
+		Name:     "file.txt",
+		UploadID: testBaseURL + "/upload/session/4",
+	}))
+	Suite.Error(Suite.Fs.AbortMultipartUpload(MultipartUpload{
+		Name:     "file.txt",
+		UploadID: testBaseURL + "/upload/session/5",
+	}))
+	Suite.True(gock.IsDone(), "pending mocks: %s", printPendingMocks())
+}
+
+func (Suite *GCSFsSuite) TestParseGCSPersistedRange() {
+	size, err := parseGCSPersistedRange("")
+	Suite.NoError(err)
+	Suite.Equal(int64(0), size)
+	size, err = parseGCSPersistedRange("bytes=0-262143")
+	Suite.NoError(err)
+	Suite.Equal(int64(262144), size)
+	_, err = parseGCSPersistedRange("bytes=10-20")
+	Suite.Error(err)
+	_, err = parseGCSPersistedRange("bytes=0-a")
+	Suite.Error(err)
+}
+
+func (Suite *GCSFsSuite) TestPresignURL() {
+	defer func() {
+		Suite.Fs.signer = nil
+	}()
+
+	_, err := Suite.Fs.PresignURL(`users/test1/test.txt`, http.MethodGet, time.Minute)
+	Suite.True(errors.Is(err, ErrVfsUnsupported))
+
+	Key, err := rsa.GenerateKey(rand.Reader, 2048)
+	Suite.Require().NoError(err)
+	Credentials, err := json.Marshal(map[string]string{
+		`type`:         `service_account`,
+		`client_email`: `sftpgo@example.iam.gserviceaccount.com`,
+		`private_key`: string(pem.EncodeToMemory(&pem.Block{
+			Type:  `RSA PRIVATE KEY`,
+			Bytes: x509.MarshalPKCS1PrivateKey(Key),
+		})),
+	})
+	Suite.Require().NoError(err)
+	Suite.Fs.setSigner([]byte(`{"type": "authorized_user"}`))
+	Suite.Nil(Suite.Fs.signer)
+	Suite.Fs.setSigner(Credentials)
+	Suite.Require().NotNil(Suite.Fs.signer)
+
+	URL, err := Suite.Fs.PresignURL(`users/test1/test.txt`, http.MethodPut, 10*time.Minute)
+	Suite.NoError(err)
+	Suite.Contains(URL, `storage.googleapis.com/bucket1/users/test1/test.txt`)
+	Suite.Regexp(`X-Goog-Expires=(599|600)&`, URL)
+	Suite.Contains(URL, `X-Goog-Signature=`)
+
+	_, err = Suite.Fs.PresignURL(`users/test1/test.txt`, http.MethodDelete, time.Minute)
+	Suite.Error(err)
+}
+
 func TestGCSFsSuite(t *testing.T) {
 	suite.Run(t, new(GCSFsSuite))
 }
@@ -0,0 +1,438 @@
+//go:build !nogcs
+// +build !nogcs
+
+package vfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/eikenb/pipeat"
+	"github.com/rs/xid"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+
+	"github.com/drakkan/sftpgo/logger"
+	"github.com/drakkan/sftpgo/metrics"
+)
+
+const (
+	gcsResumableEndpoint = "https://storage.googleapis.com/upload/storage/v1/"
+	// gcsStatusResumeIncomplete is returned while a resumable upload is not completed
+	gcsStatusResumeIncomplete = 308
+	// gcsStatusClientClosedRequest is returned for cancelled resumable uploads
+	gcsStatusClientClosedRequest = 499
+	gcsAppendPrefix              = ".sftpgo-append-"
+)
+
+// gcsResumableChunkSize is the size of the chunks uploaded within a resumable
+// upload session, it must be a multiple of 256 KiB
+var gcsResumableChunkSize int64 = 16 * 1024 * 1024
+
+var errGCSUploadSessionNotFound = errors.New("resumable upload session not found")
+
+// gcsObjectResource defines the object fields set starting a resumable upload session
+type gcsObjectResource struct {
+	Name         string            `json:"name"`
+	ContentType  string            `json:"contentType,omitempty"`
+	StorageClass string            `json:"storageClass,omitempty"`
+	CustomTime   string            `json:"customTime,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+}
+
+// setResumableClient sets the HTTP client for the JSON API resumable upload
+// sessions, the same storage client options are used
+func (fs *GCSFs) setResumableClient(ctx context.Context, opts []option.ClientOption) error {
+	fs.resumableEndpoint = gcsResumableEndpoint
+	opts = append([]option.ClientOption{option.WithScopes(storage.ScopeFullControl)}, opts...)
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		fs.resumableEndpoint = fmt.Sprintf("http://%v/upload/storage/v1/", host)
+		opts = append([]option.ClientOption{option.WithoutAuthentication()}, opts...)
+	}
+	client, _, err := htransport.NewClient(ctx, opts...)
+	if err != nil {
+		return err
+	}
+	fs.resumableClient = client
+	return nil
+}
+
+// SetMultipartUploadStore sets the store for the state of the in-progress
+// resumable upload sessions. Upload resume is supported after setting a store
+func (fs *GCSFs) SetMultipartUploadStore(store MultipartUploadStore) {
+	fs.multipartStore = store
+}
+
+// ResumeUpload continues the interrupted upload session for the named file if
+// the size of its persisted chunks matches the given offset, otherwise the
+// uploaded data will be appended to the existing object
+func (fs *GCSFs) ResumeUpload(name string, offset int64) (File, *PipeWriter, func(), error) {
+	if !fs.IsUploadResumeSupported() {
+		return nil, nil, nil, ErrVfsUnsupported
+	}
+	upload, err := fs.multipartStore.GetMultipartUpload(name)
+	if err == nil {
+		if upload.GetSize() == offset {
+			persisted, completed, err := fs.getUploadSessionStatus(upload.UploadID)
+			if err == nil && !completed && persisted == offset {
+				fsLog(fs, logger.LevelDebug, "resuming upload session for %#v, chunks: %v, offset: %v",
+					name, len(upload.Parts), offset)
+				return fs.createResumable(name, offset, upload)
+			}
+			fsLog(fs, logger.LevelDebug, "unable to resume upload session for %#v, persisted size: %v, completed: %v, err: %v",
+				name, persisted, completed, err)
+		}
+		fs.abortPendingUpload(name)
+	} else if !errors.Is(err, ErrMultipartUploadNotFound) {
+		return nil, nil, nil, err
+	}
+	attrs, err := fs.headObject(name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if attrs.Size != offset {
+		return nil, nil, nil, fmt.Errorf("unable to resume the upload for %#v, invalid offset %v, object size: %v",
+			name, offset, attrs.Size)
+	}
+	return fs.createAppend(name, offset, attrs.Generation)
+}
+
+// AbortMultipartUpload cancels the given resumable upload session releasing the
+// storage used by the uploaded chunks. Sessions already completed, cancelled or
+// expired are ignored
+func (fs *GCSFs) AbortMultipartUpload(upload MultipartUpload) error {
+	if upload.UploadID == "" {
+		return nil
+	}
+	ctx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxTimeout))
+	defer cancelFn()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, upload.UploadID, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := fs.resumableClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case gcsStatusClientClosedRequest, http.StatusNotFound, http.StatusGone:
+		return nil
+	}
+	return googleapi.CheckResponse(resp)
+}
+
+// abortPendingUpload cancels the interrupted upload session for the named file, if any.
+// It returns true if an interrupted upload was found
+func (fs *GCSFs) abortPendingUpload(name string) bool {
+	if fs.multipartStore == nil {
+		return false
+	}
+	upload, err := fs.multipartStore.GetMultipartUpload(name)
+	if err != nil {
+		return false
+	}
+	if err := fs.AbortMultipartUpload(upload); err != nil {
+		fsLog(fs, logger.LevelWarn, "unable to cancel upload session for %#v: %v", name, err)
+	}
+	if err := fs.multipartStore.DeleteMultipartUpload(name); err != nil {
+		fsLog(fs, logger.LevelWarn, "unable to delete upload session state for %#v: %v", name, err)
+	}
+	return true
+}
+
+func (fs *GCSFs) createResumable(name string, offset int64, upload MultipartUpload) (File, *PipeWriter, func(), error) {
+	r, w, err := pipeat.PipeInDir(fs.localTempDir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	p := newResumedPipeWriter(w, offset)
+	ctx, cancelFn := context.WithCancel(context.Background())
+	tracker := newMultipartUploadTracker(fs.multipartStore, upload)
+
+	go func() {
+		defer cancelFn()
+
+		err := fs.handleResumableUpload(ctx, r, tracker)
+		r.CloseWithError(err) //nolint:errcheck
+		p.Done(err)
+		fsLog(fs, logger.LevelDebug, "resumable upload completed, path: %#v, offset: %v, readed bytes: %v, err: %v",
+			name, offset, r.GetReadedBytes(), err)
+		metrics.GCSTransferCompleted(r.GetReadedBytes(), 0, err)
+	}()
+
+	return nil, p, cancelFn, nil
+}
+
+// handleResumableUpload uploads the data read from reader within a resumable
+// upload session persisting the uploaded chunks. Small files are uploaded using
+// a single request
+func (fs *GCSFs) handleResumableUpload(ctx context.Context, reader io.Reader, tracker *multipartUploadTracker) error {
+	data, eof, err := readUploadPart(reader, nil, gcsResumableChunkSize)
+	if err != nil {
+		return err
+	}
+	if eof && !tracker.isStarted() {
+		return fs.putObject(ctx, tracker.getName(), data)
+	}
+	if !tracker.isStarted() {
+		sessionURI, err := fs.startUploadSession(ctx, tracker.getName())
+		if err != nil {
+			return err
+		}
+		if err := tracker.start(sessionURI); err != nil {
+			return err
+		}
+	}
+	err = fs.uploadChunks(ctx, reader, tracker, data, eof)
+	if err == nil {
+		if errDelete := tracker.delete(); errDelete != nil {
+			fsLog(fs, logger.LevelWarn, "unable to delete upload session state for %#v: %v", tracker.getName(), errDelete)
+		}
+		return nil
+	}
+	if !tracker.hasParts() || errors.Is(err, errGCSUploadSessionNotFound) {
+		// nothing to resume
+		if errAbort := fs.AbortMultipartUpload(MultipartUpload{
+			Name:     tracker.getName(),
+			UploadID: tracker.getUploadID(),
+		}); errAbort != nil {
+			fsLog(fs, logger.LevelWarn, "unable to cancel upload session for %#v: %v", tracker.getName(), errAbort)
+		}
+		if errDelete := tracker.delete(); errDelete != nil {
+			fsLog(fs, logger.LevelWarn, "unable to delete upload session state for %#v: %v", tracker.getName(), errDelete)
+		}
+	}
+	return err
+}
+
+func (fs *GCSFs) putObject(ctx context.Context, name string, data []byte) error {
+	ctx, cancelFn := context.WithDeadline(ctx, time.Now().Add(fs.ctxLongTimeout))
+	defer cancelFn()
+
+	objectWriter := fs.newObjectWriter(ctx, name, 0)
+	_, err := objectWriter.Write(data)
+	closeErr := objectWriter.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// startUploadSession starts a resumable upload session and returns its URI
+func (fs *GCSFs) startUploadSession(ctx context.Context, name string) (string, error) {
+	ctx, cancelFn := context.WithDeadline(ctx, time.Now().Add(fs.ctxTimeout))
+	defer cancelFn()
+
+	attrs := fs.getUploadAttrs(name, 0)
+	body, err := json.Marshal(gcsObjectResource{
+		Name:         attrs.Name,
+		ContentType:  attrs.ContentType,
+		StorageClass: attrs.StorageClass,
+		CustomTime:   attrs.CustomTime.Format(time.RFC3339),
+		Metadata:     attrs.Metadata,
+	})
+	if err != nil {
+		return "", err
+	}
+	sessionURL := fmt.Sprintf("%vb/%v/o?uploadType=resumable&name=%v", fs.resumableEndpoint,
+		url.PathEscape(fs.config.Bucket), url.QueryEscape(name))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sessionURL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	if attrs.ContentType != "" {
+		req.Header.Set("X-Upload-Content-Type", attrs.ContentType)
+	}
+	resp, err := fs.resumableClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := googleapi.CheckResponse(resp); err != nil {
+		return "", err
+	}
+	sessionURI := resp.Header.Get("Location")
+	if sessionURI == "" {
+		return "", fmt.Errorf("no resumable upload session returned for %#v", name)
+	}
+	return sessionURI, nil
+}
+
+// uploadChunks uploads data and then the contents read from reader. The last
+// chunk completes the upload, only the chunks persisted by GCS are tracked and
+// the data not persisted are sent again with the next chunk
+func (fs *GCSFs) uploadChunks(ctx context.Context, reader io.Reader, tracker *multipartUploadTracker, data []byte,
+	eof bool,
+) error {
+	start := tracker.getSize()
+	for {
+		if eof {
+			// the transfer could be cancelled after the last chunk was read
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		persisted, completed, err := fs.uploadChunk(ctx, tracker.getUploadID(), data, start, eof)
+		if err != nil {
+			return err
+		}
+		if completed {
+			return nil
+		}
+		if persisted <= start || persisted > start+int64(len(data)) {
+			return fmt.Errorf("unexpected persisted size %v for the upload session of %#v, chunk start: %v, size: %v",
+				persisted, tracker.getName(), start, len(data))
+		}
+		err = tracker.addPart(MultipartUploadPart{Number: tracker.nextPartNumber(), Size: persisted - start})
+		if err != nil {
+			return err
+		}
+		data = data[persisted-start:]
+		start = persisted
+		if !eof {
+			data, eof, err = readUploadPart(reader, data, gcsResumableChunkSize)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// uploadChunk uploads the given data, starting from the given offset, within
+// the upload session. If last is true the upload is completed. Uploading no
+// data and last set to false returns the session status. It returns the
+// size persisted by GCS and true if the upload is completed
+func (fs *GCSFs) uploadChunk(ctx context.Context, sessionURI string, data []byte, start int64, last bool) (int64, bool, error) {
+	ctx, cancelFn := context.WithDeadline(ctx, time.Now().Add(fs.ctxLongTimeout))
+	defer cancelFn()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, sessionURI, bytes.NewReader(data))
+	if err != nil {
+		return 0, false, err
+	}
+	total := "*"
+	if last {
+		total = strconv.FormatInt(start+int64(len(data)), 10)
+	}
+	if len(data) == 0 {
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes */%v", total))
+	} else {
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %v-%v/%v", start, start+int64(len(data))-1, total))
+	}
+	resp, err := fs.resumableClient.Do(req)
+	if err != nil {
+		return 0, false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return start + int64(len(data)), true, nil
+	case gcsStatusResumeIncomplete:
+		persisted, err := parseGCSPersistedRange(resp.Header.Get("Range"))
+		return persisted, false, err
+	case http.StatusNotFound, http.StatusGone:
+		return 0, false, errGCSUploadSessionNotFound
+	}
+	return 0, false, googleapi.CheckResponse(resp)
+}
+
+// getUploadSessionStatus returns the size persisted within the given upload
+// session and true if the upload is completed
+func (fs *GCSFs) getUploadSessionStatus(sessionURI string) (int64, bool, error) {
+	return fs.uploadChunk(context.Background(), sessionURI, nil, 0, false)
+}
+
+// createAppend uploads the data to a temporary object and then appends it to the
+// named object using compose. The object must still have the given generation
+func (fs *GCSFs) createAppend(name string, offset, generation int64) (File, *PipeWriter, func(), error) {
+	r, w, err := pipeat.PipeInDir(fs.localTempDir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	p := newResumedPipeWriter(w, offset)
+	ctx, cancelFn := context.WithCancel(context.Background())
+	tempName := path.Join(path.Dir(name), gcsAppendPrefix+xid.New().String())
+
+	go func() {
+		defer cancelFn()
+
+		err := fs.handleAppend(ctx, r, name, tempName, generation)
+		r.CloseWithError(err) //nolint:errcheck
+		p.Done(err)
+		fsLog(fs, logger.LevelDebug, "append completed, path: %#v, offset: %v, readed bytes: %v, err: %v",
+			name, offset, r.GetReadedBytes(), err)
+		metrics.GCSTransferCompleted(r.GetReadedBytes(), 0, err)
+	}()
+
+	return nil, p, cancelFn, nil
+}
+
+func (fs *GCSFs) handleAppend(ctx context.Context, reader io.Reader, name, tempName string, generation int64) error {
+	bkt := fs.svc.Bucket(fs.config.Bucket)
+	tempObj := bkt.Object(tempName)
+	objectWriter := fs.newObjectWriter(ctx, tempName, 0)
+	_, err := io.Copy(objectWriter, reader)
+	closeErr := objectWriter.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// the transfer could be cancelled after the last byte was read
+		err = ctx.Err()
+	}
+	if err == nil {
+		composeCtx, cancelFn := context.WithDeadline(ctx, time.Now().Add(fs.ctxLongTimeout))
+		composer := bkt.Object(name).If(storage.Conditions{GenerationMatch: generation}).
+			ComposerFrom(bkt.Object(name), tempObj)
+		composer.ObjectAttrs = fs.getUploadAttrs(name, 0)
+		_, err = composer.Run(composeCtx)
+		cancelFn()
+		metrics.GCSCopyObjectCompleted(err)
+	}
+	deleteCtx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxTimeout))
+	defer cancelFn()
+
+	errDelete := tempObj.Delete(deleteCtx)
+	metrics.GCSDeleteObjectCompleted(errDelete)
+	if errDelete != nil && !errors.Is(errDelete, storage.ErrObjectNotExist) {
+		fsLog(fs, logger.LevelWarn, "unable to delete temporary object %#v: %v", tempName, errDelete)
+	}
+	return err
+}
+
+// parseGCSPersistedRange returns the persisted size from the Range header of an
+// incomplete resumable upload, for example "bytes=0-1023". No header means nothing
+// was persisted
+func parseGCSPersistedRange(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	end := strings.TrimPrefix(value, "bytes=0-")
+	if end == value {
+		return 0, fmt.Errorf("invalid resumable upload range %#v", value)
+	}
+	lastByte, err := strconv.ParseInt(end, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid resumable upload range %#v: %w", value, err)
+	}
+	return lastByte + 1, nil
+}
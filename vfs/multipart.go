@@ -0,0 +1,243 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/drakkan/sftpgo/utils"
+)
+
+// ErrMultipartUploadNotFound is returned by a MultipartUploadStore if there is
+// no in-progress multipart upload for the requested path
+var ErrMultipartUploadNotFound = errors.New("multipart upload not found")
+
+// MultipartUploadPart defines a completed part of a multipart upload
+type MultipartUploadPart struct {
+	Number int64  `json:"number"`
+	ETag   string `json:"etag"`
+	Size   int64  `json:"size"`
+}
+
+// MultipartUpload defines the state of an in-progress multipart upload.
+// The state is persisted each time a part is completed, so an interrupted
+// upload can be resumed from the last contiguous completed part
+type MultipartUpload struct {
+	// Name is the filesystem path, the object key for cloud filesystems
+	Name string `json:"name"`
+	// UploadID is the storage backend identifier for the multipart upload
+	UploadID  string                `json:"upload_id"`
+	Parts     []MultipartUploadPart `json:"parts"`
+	CreatedAt int64                 `json:"created_at"`
+	UpdatedAt int64                 `json:"updated_at"`
+}
+
+// GetSize returns the size of the completed parts
+func (u *MultipartUpload) GetSize() int64 {
+	var size int64
+	for _, part := range u.Parts {
+		size += part.Size
+	}
+	return size
+}
+
+// MultipartUploadStore persists the state of the in-progress multipart uploads
+type MultipartUploadStore interface {
+	GetMultipartUpload(name string) (MultipartUpload, error)
+	SaveMultipartUpload(upload *MultipartUpload) error
+	DeleteMultipartUpload(name string) error
+}
+
+// ResumableUploader is implemented by the filesystems able to resume an interrupted
+// upload continuing the multipart upload persisted using a MultipartUploadStore.
+// Upload resume is supported only after setting a store
+type ResumableUploader interface {
+	SetMultipartUploadStore(store MultipartUploadStore)
+	ResumeUpload(name string, offset int64) (File, *PipeWriter, func(), error)
+	AbortMultipartUpload(upload MultipartUpload) error
+}
+
+// CreateForResume opens the named file to resume an upload from the given offset.
+// The filesystems implementing ResumableUploader continue the interrupted multipart
+// upload, if any, or append to the existing file, the other filesystems are opened
+// using Create and the given flag
+func CreateForResume(fs Fs, name string, flag int, offset int64) (File, *PipeWriter, func(), error) {
+	if uploader, ok := fs.(ResumableUploader); ok && offset > 0 {
+		return uploader.ResumeUpload(name, offset)
+	}
+	return fs.Create(name, flag)
+}
+
+// getPendingUploadInfo returns a FileInfo for the interrupted upload to the given path,
+// if any, this way clients can get the size to resume the upload from
+func getPendingUploadInfo(store MultipartUploadStore, name string) (os.FileInfo, bool) {
+	if store == nil {
+		return nil, false
+	}
+	upload, err := store.GetMultipartUpload(name)
+	if err != nil {
+		return nil, false
+	}
+	return NewFileInfo(path.Base(name), false, upload.GetSize(), utils.GetTimeFromMsecSinceEpoch(upload.UpdatedAt),
+		false), true
+}
+
+// readUploadPart reads up to size bytes from reader, the returned part starts with the given prefix.
+// The returned boolean is true if the reader is at EOF
+func readUploadPart(reader io.Reader, prefix []byte, size int64) ([]byte, bool, error) {
+	if int64(len(prefix)) > size {
+		size = int64(len(prefix))
+	}
+	buf := make([]byte, size)
+	n := copy(buf, prefix)
+	for n < len(buf) {
+		nn, err := reader.Read(buf[n:])
+		n += nn
+		if err == io.EOF {
+			return buf[:n], true, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return buf, false, nil
+}
+
+// multipartUploadTracker keeps track of the completed parts of a resumable upload.
+// Parts can complete out of order, only the contiguous parts starting from the
+// first one are persisted since an interrupted upload can be resumed only from there
+type multipartUploadTracker struct {
+	sync.Mutex
+	store     MultipartUploadStore
+	upload    MultipartUpload
+	completed map[int64]MultipartUploadPart
+	err       error
+}
+
+func newMultipartUploadTracker(store MultipartUploadStore, upload MultipartUpload) *multipartUploadTracker {
+	t := &multipartUploadTracker{
+		store:     store,
+		upload:    upload,
+		completed: make(map[int64]MultipartUploadPart),
+	}
+	for _, part := range upload.Parts {
+		t.completed[part.Number] = part
+	}
+	return t
+}
+
+func (t *multipartUploadTracker) getName() string {
+	return t.upload.Name
+}
+
+func (t *multipartUploadTracker) getUploadID() string {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.upload.UploadID
+}
+
+func (t *multipartUploadTracker) isStarted() bool {
+	return t.getUploadID() != ""
+}
+
+// hasParts returns true if at least a part can be resumed
+func (t *multipartUploadTracker) hasParts() bool {
+	t.Lock()
+	defer t.Unlock()
+
+	return len(t.upload.Parts) > 0
+}
+
+// getSize returns the size of the contiguous completed parts
+func (t *multipartUploadTracker) getSize() int64 {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.upload.GetSize()
+}
+
+// nextPartNumber returns the number for the first part not yet persisted
+func (t *multipartUploadTracker) nextPartNumber() int64 {
+	t.Lock()
+	defer t.Unlock()
+
+	return int64(len(t.upload.Parts)) + 1
+}
+
+// start sets the upload ID and persists the upload state. The parts
+// already set, if any, are kept
+func (t *multipartUploadTracker) start(uploadID string) error {
+	t.Lock()
+	defer t.Unlock()
+
+	now := utils.GetTimeAsMsSinceEpoch(time.Now())
+	t.upload.UploadID = uploadID
+	t.upload.CreatedAt = now
+	t.upload.UpdatedAt = now
+	return t.store.SaveMultipartUpload(&t.upload)
+}
+
+// addPart marks the given part as completed and persists the upload state
+// if the contiguous completed parts changed
+func (t *multipartUploadTracker) addPart(part MultipartUploadPart) error {
+	t.Lock()
+	defer t.Unlock()
+
+	t.completed[part.Number] = part
+	numParts := len(t.upload.Parts)
+	for {
+		next, ok := t.completed[int64(len(t.upload.Parts))+1]
+		if !ok {
+			break
+		}
+		t.upload.Parts = append(t.upload.Parts, next)
+	}
+	if len(t.upload.Parts) == numParts {
+		return nil
+	}
+	t.upload.UpdatedAt = utils.GetTimeAsMsSinceEpoch(time.Now())
+	return t.store.SaveMultipartUpload(&t.upload)
+}
+
+// getParts returns all the completed parts ordered by part number
+func (t *multipartUploadTracker) getParts() []MultipartUploadPart {
+	t.Lock()
+	defer t.Unlock()
+
+	parts := make([]MultipartUploadPart, 0, len(t.completed))
+	for _, part := range t.completed {
+		parts = append(parts, part)
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].Number < parts[j].Number
+	})
+	return parts
+}
+
+// setError stores the first error for the concurrent part uploads
+func (t *multipartUploadTracker) setError(err error) bool {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.err != nil {
+		return false
+	}
+	t.err = err
+	return true
+}
+
+func (t *multipartUploadTracker) getError() error {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.err
+}
+
+func (t *multipartUploadTracker) delete() error {
+	return t.store.DeleteMultipartUpload(t.getName())
+}
@@ -0,0 +1,152 @@
+package vfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryMultipartStore struct {
+	sync.Mutex
+	uploads map[string]MultipartUpload
+}
+
+func newMemoryMultipartStore() *memoryMultipartStore {
+	return &memoryMultipartStore{
+		uploads: make(map[string]MultipartUpload),
+	}
+}
+
+func (s *memoryMultipartStore) GetMultipartUpload(name string) (MultipartUpload, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	upload, ok := s.uploads[name]
+	if !ok {
+		return upload, ErrMultipartUploadNotFound
+	}
+	return upload, nil
+}
+
+func (s *memoryMultipartStore) SaveMultipartUpload(upload *MultipartUpload) error {
+	s.Lock()
+	defer s.Unlock()
+
+	u := *upload
+	u.Parts = append([]MultipartUploadPart(nil), upload.Parts...)
+	s.uploads[upload.Name] = u
+	return nil
+}
+
+func (s *memoryMultipartStore) DeleteMultipartUpload(name string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.uploads, name)
+	return nil
+}
+
+func TestReadUploadPart(t *testing.T) {
+	data, eof, err := readUploadPart(bytes.NewReader([]byte("0123456789")), nil, 4)
+	require.NoError(t, err)
+	assert.False(t, eof)
+	assert.Equal(t, []byte("0123"), data)
+
+	data, eof, err = readUploadPart(bytes.NewReader([]byte("456")), []byte("0123"), 10)
+	require.NoError(t, err)
+	assert.True(t, eof)
+	assert.Equal(t, []byte("0123456"), data)
+
+	data, eof, err = readUploadPart(bytes.NewReader(nil), nil, 4)
+	require.NoError(t, err)
+	assert.True(t, eof)
+	assert.Len(t, data, 0)
+
+	errRead := errors.New("read error")
+	_, _, err = readUploadPart(io.MultiReader(bytes.NewReader([]byte("01")), &errorReader{err: errRead}), nil, 4)
+	assert.ErrorIs(t, err, errRead)
+}
+
+func TestMultipartUploadTracker(t *testing.T) {
+	store := newMemoryMultipartStore()
+	tracker := newMultipartUploadTracker(store, MultipartUpload{Name: "file.dat"})
+	assert.False(t, tracker.isStarted())
+	assert.False(t, tracker.hasParts())
+	assert.Equal(t, int64(1), tracker.nextPartNumber())
+
+	require.NoError(t, tracker.start("upload_id"))
+	assert.True(t, tracker.isStarted())
+	upload, err := store.GetMultipartUpload("file.dat")
+	require.NoError(t, err)
+	assert.Equal(t, "upload_id", upload.UploadID)
+	assert.Greater(t, upload.CreatedAt, int64(0))
+
+	// part 2 completes before part 1, it is not persisted
+	require.NoError(t, tracker.addPart(MultipartUploadPart{Number: 2, ETag: "etag2", Size: 10}))
+	assert.False(t, tracker.hasParts())
+	upload, err = store.GetMultipartUpload("file.dat")
+	require.NoError(t, err)
+	assert.Len(t, upload.Parts, 0)
+
+	require.NoError(t, tracker.addPart(MultipartUploadPart{Number: 1, ETag: "etag1", Size: 10}))
+	require.NoError(t, tracker.addPart(MultipartUploadPart{Number: 4, ETag: "etag4", Size: 5}))
+	assert.True(t, tracker.hasParts())
+	assert.Equal(t, int64(3), tracker.nextPartNumber())
+	upload, err = store.GetMultipartUpload("file.dat")
+	require.NoError(t, err)
+	assert.Len(t, upload.Parts, 2)
+	assert.Equal(t, int64(20), upload.GetSize())
+
+	parts := tracker.getParts()
+	require.Len(t, parts, 3)
+	assert.Equal(t, int64(1), parts[0].Number)
+	assert.Equal(t, int64(2), parts[1].Number)
+	assert.Equal(t, int64(4), parts[2].Number)
+
+	// resumed uploads start from the persisted parts
+	resumed := newMultipartUploadTracker(store, upload)
+	assert.True(t, resumed.isStarted())
+	assert.Equal(t, int64(3), resumed.nextPartNumber())
+
+	errUpload := errors.New("upload error")
+	assert.True(t, tracker.setError(errUpload))
+	assert.False(t, tracker.setError(errors.New("another error")))
+	assert.Equal(t, errUpload, tracker.getError())
+
+	require.NoError(t, tracker.delete())
+	_, err = store.GetMultipartUpload("file.dat")
+	assert.ErrorIs(t, err, ErrMultipartUploadNotFound)
+}
+
+func TestGetPendingUploadInfo(t *testing.T) {
+	_, ok := getPendingUploadInfo(nil, "dir/file.dat")
+	assert.False(t, ok)
+
+	store := newMemoryMultipartStore()
+	_, ok = getPendingUploadInfo(store, "dir/file.dat")
+	assert.False(t, ok)
+
+	require.NoError(t, store.SaveMultipartUpload(&MultipartUpload{
+		Name:     "dir/file.dat",
+		UploadID: "id",
+		Parts:    []MultipartUploadPart{{Number: 1, Size: 100}, {Number: 2, Size: 50}},
+	}))
+	info, ok := getPendingUploadInfo(store, "dir/file.dat")
+	require.True(t, ok)
+	assert.Equal(t, "file.dat", info.Name())
+	assert.Equal(t, int64(150), info.Size())
+	assert.False(t, info.IsDir())
+}
+
+type errorReader struct {
+	err error
+}
+
+func (r *errorReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
@@ -104,6 +104,29 @@ func (*OsFs) Rename(source, target string) error {
 	return os.Rename(source, target)
 }
 
+// CopyFile implements the Copier interface, the file mode is preserved
+func (*OsFs) CopyFile(source, target string) error {
+	src, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
 // Remove removes the named file or (empty) directory.
 func (*OsFs) Remove(name string, isDir bool) error {
 	return os.Remove(name)
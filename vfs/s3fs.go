@@ -7,6 +7,7 @@ import (
 	"context"
 	"fmt"
 	"mime"
+	"net/http"
 	"net/url"
 	"os"
 	"path"
@@ -18,6 +19,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
@@ -32,6 +34,13 @@ import (
 	"github.com/drakkan/sftpgo/version"
 )
 
+const (
+	// s3MaxCopyObjectSize is the maximum object size supported by a single CopyObject request
+	s3MaxCopyObjectSize = 5 * 1024 * 1024 * 1024
+	// s3MinPartSize is the minimum size for a multipart upload part, except the last one
+	s3MinPartSize = 5 * 1024 * 1024
+)
+
 // S3Fs is a Fs implementation for AWS S3 compatible object storages
 type S3Fs struct {
 	connectionID   string
@@ -40,6 +49,7 @@ type S3Fs struct {
 	svc            s3iface.S3API
 	ctxTimeout     time.Duration
 	ctxLongTimeout time.Duration
+	multipartStore MultipartUploadStore
 }
 
 func init() {
@@ -151,11 +161,16 @@ func (fs *S3Fs) Stat(name string) (os.FileInfo, error) {
 				}
 			}
 		}
-		return NewFileInfo(name, false, objSize, objectModTime, false), nil
+		info := NewFileInfo(name, false, objSize, objectModTime, false)
+		fs.setStoredFSMetaAttributes(info, name, obj)
+		return info, nil
 	}
 	if !fs.IsNotExist(err) {
 		return result, err
 	}
+	if info, ok := getPendingUploadInfo(fs.multipartStore, name); ok {
+		return info, nil
+	}
 	// now check if this is a prefix (virtual directory)
 	hasContents, err := fs.hasContents(name)
 	if err == nil && hasContents {
@@ -170,6 +185,26 @@ func (fs *S3Fs) Stat(name string) (os.FileInfo, error) {
 	return fs.getStatForDir(name)
 }
 
+// setStoredFSMetaAttributes applies the attributes stored using chmod, chown and chtimes, if any
+func (fs *S3Fs) setStoredFSMetaAttributes(info *FileInfo, name string, obj *s3.HeadObjectOutput) {
+	folder := path.Dir(name) + "/"
+	if !fs.StoresFSMetaAttributes() || folder == "./" {
+		return
+	}
+	ctx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxTimeout))
+	defer cancelFn()
+
+	meta, err := fs.getFSMetaProvider().Lookup(ctx, fsmeta.Key{
+		Path:      name,
+		ETag:      aws.StringValue(obj.ETag),
+		StoreTime: aws.TimeValue(obj.LastModified),
+		Size:      aws.Int64Value(obj.ContentLength),
+	})
+	if err == nil {
+		info.setFSMetaAttributes(meta)
+	}
+}
+
 func (fs *S3Fs) getStatForDir(name string) (os.FileInfo, error) {
 	var result *FileInfo
 	obj, err := fs.headObject(name + "/")
@@ -218,6 +253,10 @@ func (fs *S3Fs) Open(name string, offset int64) (File, *pipeat.PipeReaderAt, fun
 
 // Create creates or opens the named file for writing
 func (fs *S3Fs) Create(name string, flag int) (File, *PipeWriter, func(), error) {
+	if fs.IsUploadResumeSupported() && flag != -1 {
+		fs.abortPendingUpload(name)
+		return fs.createResumable(name, 0, MultipartUpload{Name: name}, 0)
+	}
 	r, w, err := pipeat.PipeInDir(fs.localTempDir)
 	if err != nil {
 		return nil, nil, nil, err
@@ -299,7 +338,24 @@ func (fs *S3Fs) Rename(source, target string) error {
 	}
 	ctx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxTimeout))
 	defer cancelFn()
-	_, err = fs.svc.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+	copyOutput, err := fs.copyObject(ctx, copySource, target, contentType)
+	if err != nil {
+		return err
+	}
+	fs.renameFSMetaData(ctx, source, target, fi, copyOutput)
+	return fs.Remove(source, fi.IsDir())
+}
+
+// CopyFile implements the Copier interface using the S3 server side copy
+func (fs *S3Fs) CopyFile(source, target string) error {
+	ctx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxTimeout))
+	defer cancelFn()
+	_, err := fs.copyObject(ctx, fs.Join(fs.config.Bucket, source), target, mime.TypeByExtension(path.Ext(target)))
+	return err
+}
+
+func (fs *S3Fs) copyObject(ctx context.Context, copySource, target, contentType string) (*s3.CopyObjectOutput, error) {
+	copyOutput, err := fs.svc.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
 		Bucket:       aws.String(fs.config.Bucket),
 		CopySource:   aws.String(pathEscape(copySource)),
 		Key:          aws.String(target),
@@ -307,10 +363,26 @@ func (fs *S3Fs) Rename(source, target string) error {
 		ContentType:  utils.NilIfEmpty(contentType),
 	})
 	metrics.S3CopyObjectCompleted(err)
-	if err != nil {
-		return err
+	return copyOutput, err
+}
+
+// renameFSMetaData moves the preserved modification time to the copied object,
+// errors are only logged, the metadata will self heal on the next listing
+func (fs *S3Fs) renameFSMetaData(ctx context.Context, source, target string, fi os.FileInfo, copyOutput *s3.CopyObjectOutput) {
+	if fi.IsDir() && !strings.HasSuffix(source, "/") {
+		source += "/"
+	}
+	targetKey := fsmeta.Key{
+		Path: target,
+		Size: fi.Size(),
+	}
+	if copyOutput != nil && copyOutput.CopyObjectResult != nil && !fi.IsDir() {
+		targetKey.ETag = aws.StringValue(copyOutput.CopyObjectResult.ETag)
+		targetKey.StoreTime = aws.TimeValue(copyOutput.CopyObjectResult.LastModified)
+	}
+	if err := fs.getFSMetaProvider().Rename(ctx, source, targetKey); err != nil {
+		fsLog(fs, logger.LevelWarn, "unable to rename fsmeta data from %#v to %#v: %v", source, target, err)
 	}
-	return fs.Remove(source, fi.IsDir())
 }
 
 // Remove removes the named file or (empty) directory.
@@ -334,6 +406,14 @@ func (fs *S3Fs) Remove(name string, isDir bool) error {
 		Key:    aws.String(name),
 	})
 	metrics.S3DeleteObjectCompleted(err)
+	if err == nil {
+		if metaErr := fs.getFSMetaProvider().Delete(ctx, name); metaErr != nil {
+			fsLog(fs, logger.LevelWarn, "unable to delete fsmeta data for %#v: %v", name, metaErr)
+		}
+		if !isDir {
+			fs.abortPendingUpload(name)
+		}
+	}
 	return err
 }
 
@@ -364,18 +444,135 @@ func (*S3Fs) Readlink(name string) (string, error) {
 }
 
 // Chown changes the numeric uid and gid of the named file.
-func (*S3Fs) Chown(name string, uid int, gid int) error {
-	return ErrVfsUnsupported
+// The ownership is stored using fsmeta, if enabled for the bucket
+func (fs *S3Fs) Chown(name string, uid int, gid int) error {
+	_, _, err := fs.updateFSMetaAttributes(name, func(meta *fsmeta.Meta) {
+		if uid != -1 {
+			meta.UID = &uid
+		}
+		if gid != -1 {
+			meta.GID = &gid
+		}
+	})
+	return err
 }
 
 // Chmod changes the mode of the named file to mode.
-func (*S3Fs) Chmod(name string, mode os.FileMode) error {
-	return ErrVfsUnsupported
+// The mode is stored using fsmeta, if enabled for the bucket
+func (fs *S3Fs) Chmod(name string, mode os.FileMode) error {
+	_, _, err := fs.updateFSMetaAttributes(name, func(meta *fsmeta.Meta) {
+		meta.Mode = mode.Perm()
+	})
+	return err
 }
 
 // Chtimes changes the access and modification times of the named file.
-func (*S3Fs) Chtimes(name string, atime, mtime time.Time) error {
-	return ErrVfsUnsupported
+// The times are stored using fsmeta, if enabled for the bucket, and
+// optionally in the object metadata too
+func (fs *S3Fs) Chtimes(name string, atime, mtime time.Time) error {
+	meta, obj, err := fs.updateFSMetaAttributes(name, func(meta *fsmeta.Meta) {
+		meta.AccessTime = atime
+		meta.LastModified = mtime
+	})
+	if err != nil || !fsmeta.ChtimesCopyInPlace {
+		return err
+	}
+	return fs.copyInPlaceFSMetaTime(meta, obj)
+}
+
+// StoresFSMetaAttributes returns true if chmod, chown and chtimes are persisted using fsmeta
+func (fs *S3Fs) StoresFSMetaAttributes() bool {
+	return fsmeta.EnabledForBucket(fs.config.Bucket)
+}
+
+func (fs *S3Fs) updateFSMetaAttributes(name string, fn func(*fsmeta.Meta)) (fsmeta.Meta, *s3.HeadObjectOutput, error) {
+	if !fs.StoresFSMetaAttributes() {
+		return fsmeta.Meta{}, nil, ErrVfsUnsupported
+	}
+	obj, err := fs.headObject(name)
+	if err != nil {
+		if fs.IsNotExist(err) {
+			// directories have no object to attach the attributes to
+			if info, statErr := fs.Stat(name); statErr == nil && info.IsDir() {
+				return fsmeta.Meta{}, nil, ErrVfsUnsupported
+			}
+		}
+		return fsmeta.Meta{}, nil, err
+	}
+	ctx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxTimeout))
+	defer cancelFn()
+
+	meta, err := fsmeta.Update(ctx, fs.getFSMetaProvider(), fsmeta.Key{
+		Path:      name,
+		ETag:      aws.StringValue(obj.ETag),
+		StoreTime: aws.TimeValue(obj.LastModified),
+		Size:      aws.Int64Value(obj.ContentLength),
+	}, fn)
+	if err == fsmeta.ErrNotTracked {
+		return meta, obj, ErrVfsUnsupported
+	}
+	return meta, obj, err
+}
+
+// copyInPlaceFSMetaTime copies the object onto itself replacing the Fs-Mtime metadata,
+// the other metadata are preserved. The fsmeta row is then updated with the new object
+// ETag and store time, so the stored attributes are still valid
+func (fs *S3Fs) copyInPlaceFSMetaTime(meta fsmeta.Meta, obj *s3.HeadObjectOutput) error {
+	if aws.Int64Value(obj.ContentLength) > s3MaxCopyObjectSize {
+		fsLog(fs, logger.LevelDebug, "object %#v is too big for a copy in place, the mtime is only stored in fsmeta",
+			meta.Key.Path)
+		return nil
+	}
+	metadata := make(map[string]*string)
+	for k, v := range obj.Metadata {
+		if !strings.EqualFold(k, fsmeta.S3MetaKey) {
+			metadata[k] = v
+		}
+	}
+	for k, v := range fsmeta.NewS3Metadata(meta.LastModified) {
+		metadata[k] = v
+	}
+	ctx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxTimeout))
+	defer cancelFn()
+
+	// the REPLACE directive resets the headers and the encryption settings not
+	// included in the request, they are copied from the current object
+	input := &s3.CopyObjectInput{
+		Bucket:                  aws.String(fs.config.Bucket),
+		CopySource:              aws.String(pathEscape(fs.Join(fs.config.Bucket, meta.Key.Path))),
+		Key:                     aws.String(meta.Key.Path),
+		Metadata:                metadata,
+		MetadataDirective:       aws.String(s3.MetadataDirectiveReplace),
+		ContentType:             obj.ContentType,
+		ContentEncoding:         obj.ContentEncoding,
+		ContentDisposition:      obj.ContentDisposition,
+		ContentLanguage:         obj.ContentLanguage,
+		CacheControl:            obj.CacheControl,
+		WebsiteRedirectLocation: obj.WebsiteRedirectLocation,
+		StorageClass:            obj.StorageClass,
+		ServerSideEncryption:    obj.ServerSideEncryption,
+		SSEKMSKeyId:             obj.SSEKMSKeyId,
+		BucketKeyEnabled:        obj.BucketKeyEnabled,
+	}
+	if obj.Expires != nil {
+		if expires, err := http.ParseTime(aws.StringValue(obj.Expires)); err == nil {
+			input.Expires = aws.Time(expires)
+		}
+	}
+	copyOutput, err := fs.svc.CopyObjectWithContext(ctx, input)
+	metrics.S3CopyObjectCompleted(err)
+	if err != nil {
+		return err
+	}
+	if copyOutput == nil || copyOutput.CopyObjectResult == nil {
+		return nil
+	}
+	meta.Key.ETag = aws.StringValue(copyOutput.CopyObjectResult.ETag)
+	meta.Key.StoreTime = aws.TimeValue(copyOutput.CopyObjectResult.LastModified)
+	if err := fs.getFSMetaProvider().Put(ctx, meta); err != nil {
+		fsLog(fs, logger.LevelWarn, "unable to update fsmeta data for %#v after the copy in place: %v", meta.Key.Path, err)
+	}
+	return nil
 }
 
 // Truncate changes the size of the named file.
@@ -458,16 +655,17 @@ func (fs *S3Fs) ReadDir(dirname string) ([]os.FileInfo, error) {
 				prefixes[name] = true
 			}
 
+			info := NewFileInfo(name, (isDir && objectSize == 0), objectSize, objectModTime, false)
 			if Meta, err := provider.Get(ctx, fsmeta.Key{
 				Path:      *fileObject.Key,
 				ETag:      *fileObject.ETag,
 				StoreTime: *fileObject.LastModified,
 				Size:      *fileObject.Size,
-			}); err == nil && !Meta.LastModified.IsZero() {
-				objectModTime = Meta.LastModified
+			}); err == nil {
+				info.setFSMetaAttributes(Meta)
 			}
 
-			result = append(result, NewFileInfo(name, (isDir && objectSize == 0), objectSize, objectModTime, false))
+			result = append(result, info)
 		}
 		return true
 	})
@@ -477,18 +675,50 @@ func (fs *S3Fs) ReadDir(dirname string) ([]os.FileInfo, error) {
 }
 
 func (fs *S3Fs) preloadFSMetaData(ctx context.Context, Prefix string) (fsmeta.Provider, error) {
+	Provider := fs.getFSMetaProvider()
+	err := Provider.Preload(ctx, Prefix)
+	return Provider, err
+}
+
+// ReconcileFSMeta compares the objects under the given key prefix with the
+// fsmeta stored metadata, stale rows are removed and missing ones backfilled
+func (fs *S3Fs) ReconcileFSMeta(ctx context.Context, prefix string, dryRun bool) (fsmeta.ReconcileReport, error) {
+	return fsmeta.ReconcileS3(ctx, fs.svc, fs.config.Bucket, strings.TrimPrefix(prefix, "/"), dryRun)
+}
+
+// BackfillFSMeta stores the fsmeta metadata for the objects starting with the given prefix
+func (fs *S3Fs) BackfillFSMeta(ctx context.Context, options fsmeta.BackfillOptions) (fsmeta.BackfillReport, error) {
+	options.Prefix = strings.TrimPrefix(options.Prefix, "/")
+	return fsmeta.BackfillS3(ctx, fs.svc, fs.config.Bucket, options)
+}
+
+// InspectFSMeta returns the fsmeta stored metadata for the given object key next to the live ones
+func (fs *S3Fs) InspectFSMeta(ctx context.Context, key string) (fsmeta.Inspection, error) {
+	return fsmeta.InspectS3(ctx, fs.svc, fs.config.Bucket, key)
+}
+
+// RefreshFSMeta replaces the fsmeta stored metadata for the given object key with the live ones
+func (fs *S3Fs) RefreshFSMeta(ctx context.Context, key string) (fsmeta.Inspection, error) {
+	return fsmeta.RefreshS3(ctx, fs.svc, fs.config.Bucket, key)
+}
+
+// DeleteFSMeta removes the fsmeta stored metadata for the given object key
+func (fs *S3Fs) DeleteFSMeta(ctx context.Context, key string) error {
+	return fsmeta.DeleteS3(ctx, fs.svc, fs.config.Bucket, key)
+}
+
+func (fs *S3Fs) getFSMetaProvider() fsmeta.Provider {
 	if fsmeta.EnabledForBucket(fs.config.Bucket) {
-		Provider := fsmeta.DefaultFactory.New(fs.svc, fs.config.Bucket)
-		err := Provider.Preload(ctx, Prefix)
-		return Provider, err
+		return fsmeta.DefaultFactory.New(fsmeta.NewS3Provider(fs.svc, fs.config.Bucket))
 	}
-	return fsmeta.EmptyProvider, nil
+	return fsmeta.EmptyProvider
 }
 
 // IsUploadResumeSupported returns true if upload resume is supported.
-// SFTP Resume is not supported on S3
-func (*S3Fs) IsUploadResumeSupported() bool {
-	return false
+// Resume is supported if a store for the interrupted multipart uploads is
+// set and no sequence is appended to the uploaded keys
+func (fs *S3Fs) IsUploadResumeSupported() bool {
+	return fs.multipartStore != nil && fs.config.AppendSequence == ""
 }
 
 // IsAtomicUploadSupported returns true if atomic upload is supported.
@@ -734,6 +964,27 @@ func (fs *S3Fs) GetMimeType(name string) (string, error) {
 	return *obj.ContentType, err
 }
 
+// PresignURL returns a presigned URL to download, GET method, or upload, PUT
+// method, the named object. The URL is valid for the given duration
+func (fs *S3Fs) PresignURL(name, method string, expiration time.Duration) (string, error) {
+	var req *request.Request
+	switch method {
+	case http.MethodGet:
+		req, _ = fs.svc.GetObjectRequest(&s3.GetObjectInput{
+			Bucket: aws.String(fs.config.Bucket),
+			Key:    aws.String(name),
+		})
+	case http.MethodPut:
+		req, _ = fs.svc.PutObjectRequest(&s3.PutObjectInput{
+			Bucket: aws.String(fs.config.Bucket),
+			Key:    aws.String(name),
+		})
+	default:
+		return "", fmt.Errorf("unable to presign %#v: unsupported method %#v", name, method)
+	}
+	return req.Presign(expiration)
+}
+
 // Close closes the fs
 func (*S3Fs) Close() error {
 	return nil
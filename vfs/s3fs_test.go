@@ -2,12 +2,21 @@ package vfs
 
 import (
 	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/suite"
@@ -42,7 +51,7 @@ func (Suite *S3FsSuite) BeforeTest(_, _ string) {
 	Suite.SQLMock = Mock
 	Suite.DB = DB
 
-	fsmeta.DefaultFactory = fsmeta.NewPostgresS3Factory(Suite.DB)
+	fsmeta.DefaultFactory = fsmeta.NewPostgresFactory(Suite.DB)
 
 	Suite.Fs = &S3Fs{
 		svc: Suite.S3,
@@ -114,10 +123,12 @@ func (Suite *S3FsSuite) TestDirectoryListingWithFSMetaPreload() {
 		WithArgs(`s3://sftpgo/files/`).
 		WillReturnRows(sqlmock.NewRows([]string{`id`}).AddRow(int64(12345)))
 
-	Suite.SQLMock.ExpectQuery(regexp.QuoteMeta(`SELECT filename, filesize, uploaded, etag, last_modified FROM fsmeta_files WHERE folder_id = $1`)).
+	Suite.SQLMock.ExpectQuery(regexp.QuoteMeta(`SELECT filename, filesize, uploaded, etag, last_modified, ` +
+		`mode, atime, uid, gid, attributes FROM fsmeta_files WHERE folder_id = $1`)).
 		WithArgs(int64(12345)).
-		WillReturnRows(sqlmock.NewRows([]string{`filename`, `filesize`, `uploaded`, `etag`, `last_modified`}).
-			AddRow(`file.txt`, 1234, time.Now(), `etag1`, time.Now()))
+		WillReturnRows(sqlmock.NewRows([]string{`filename`, `filesize`, `uploaded`, `etag`, `last_modified`,
+			`mode`, `atime`, `uid`, `gid`, `attributes`}).
+			AddRow(`file.txt`, 1234, time.Now(), `etag1`, time.Now(), 0, nil, nil, nil, nil))
 
 	Suite.S3.EXPECT().ListObjectsV2PagesWithContext(gomock.Any(), &s3.ListObjectsV2Input{
 		Bucket:    aws.String(`sftpgo`),
@@ -219,6 +230,389 @@ func (Suite *S3FsSuite) TestRenameWithColonCharacter() {
 	Suite.Nil(err)
 }
 
+func (Suite *S3FsSuite) TestCopyFile() {
+	Suite.S3.EXPECT().CopyObjectWithContext(gomock.Any(), &s3.CopyObjectInput{
+		CopySource:  aws.String(`sftpgo/in/source.txt`),
+		ContentType: aws.String(`text/plain; charset=utf-8`),
+		Bucket:      aws.String(`sftpgo`),
+		Key:         aws.String(`out/target.txt`),
+	}).Return(&s3.CopyObjectOutput{}, nil).MinTimes(1).MaxTimes(1)
+
+	err := Suite.Fs.CopyFile(`in/source.txt`, `out/target.txt`)
+	Suite.Nil(err)
+}
+
+func (Suite *S3FsSuite) TestRenameWithFSMeta() {
+	fsmeta.Enabled = true
+	fsmeta.Buckets = []string{`sftpgo`}
+	CopyTime := time.Date(2021, time.March, 1, 10, 0, 0, 0, time.UTC)
+	StoreTime := CopyTime.Add(-time.Hour)
+
+	Suite.S3.EXPECT().HeadObjectWithContext(gomock.Any(), &s3.HeadObjectInput{
+		Bucket: aws.String(`sftpgo`),
+		Key:    aws.String(`users/test1/old.csv`),
+	}).Return(&s3.HeadObjectOutput{
+		ContentLength: aws.Int64(145),
+		ETag:          aws.String(`"etag1"`),
+		LastModified:  aws.Time(StoreTime),
+	}, nil).Times(1)
+	// stat reads only the stored row
+	Suite.SQLMock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM fsmeta_folders WHERE path=$1`)).
+		WithArgs(`s3://sftpgo/users/test1/`).
+		WillReturnRows(sqlmock.NewRows([]string{`id`}).AddRow(int64(15)))
+	Suite.SQLMock.ExpectQuery(regexp.QuoteMeta(`SELECT filesize, uploaded, etag, last_modified, `+
+		`mode, atime, uid, gid, attributes FROM fsmeta_files WHERE folder_id = $1 AND filename = $2`)).
+		WithArgs(int64(15), `old.csv`).
+		WillReturnRows(sqlmock.NewRows([]string{`filesize`, `uploaded`, `etag`, `last_modified`,
+			`mode`, `atime`, `uid`, `gid`, `attributes`}).
+			AddRow(145, StoreTime, `etag1`, StoreTime, 0, nil, nil, nil, nil))
+
+	Suite.S3.EXPECT().CopyObjectWithContext(gomock.Any(), gomock.Any()).Return(&s3.CopyObjectOutput{
+		CopyObjectResult: &s3.CopyObjectResult{
+			ETag:         aws.String(`"etag2"`),
+			LastModified: aws.Time(CopyTime),
+		},
+	}, nil).Times(1)
+
+	Suite.S3.EXPECT().DeleteObjectWithContext(gomock.Any(), &s3.DeleteObjectInput{
+		Bucket: aws.String(`sftpgo`),
+		Key:    aws.String(`users/test1/old.csv`),
+	}).Return(nil, nil).Times(1)
+
+	Suite.SQLMock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM fsmeta_folders WHERE path=$1`)).
+		WithArgs(`s3://sftpgo/users/test1/`).
+		WillReturnRows(sqlmock.NewRows([]string{`id`}).AddRow(int64(15)))
+	Suite.SQLMock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM fsmeta_folders WHERE path=$1`)).
+		WithArgs(`s3://sftpgo/users/test1/archive/`).
+		WillReturnRows(sqlmock.NewRows([]string{`id`}).AddRow(int64(16)))
+	Suite.SQLMock.ExpectBegin()
+	Suite.SQLMock.ExpectExec(regexp.QuoteMeta(`DELETE FROM fsmeta_files WHERE folder_id=$1 AND filename=$2`)).
+		WithArgs(int64(16), `new.csv`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	Suite.SQLMock.ExpectExec(regexp.QuoteMeta(`UPDATE fsmeta_files SET folder_id=$1, filename=$2, uploaded=$3, filesize=$4, etag=$5 `+
+		`WHERE folder_id=$6 AND filename=$7`)).
+		WithArgs(int64(16), `new.csv`, CopyTime, int64(145), `etag2`, int64(15), `old.csv`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	Suite.SQLMock.ExpectCommit()
+	// the source row was already moved, the delete is a no-op
+	Suite.SQLMock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM fsmeta_folders WHERE path=$1`)).
+		WithArgs(`s3://sftpgo/users/test1/`).
+		WillReturnRows(sqlmock.NewRows([]string{`id`}).AddRow(int64(15)))
+	Suite.SQLMock.ExpectExec(regexp.QuoteMeta(`DELETE FROM fsmeta_files WHERE folder_id=$1 AND filename=$2`)).
+		WithArgs(int64(15), `old.csv`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := Suite.Fs.Rename(`users/test1/old.csv`, `users/test1/archive/new.csv`)
+	Suite.Nil(err)
+}
+
+func (Suite *S3FsSuite) TestSetStatWithFSMeta() {
+	fsmeta.Enabled = true
+	fsmeta.Buckets = []string{`sftpgo`}
+	StoreTime := time.Date(2021, time.March, 1, 10, 0, 0, 0, time.UTC)
+	Columns := []string{`filename`, `filesize`, `uploaded`, `etag`, `last_modified`, `mode`, `atime`, `uid`, `gid`, `attributes`}
+
+	Suite.S3.EXPECT().HeadObjectWithContext(gomock.Any(), &s3.HeadObjectInput{
+		Bucket: aws.String(`sftpgo`),
+		Key:    aws.String(`users/test1/test.txt`),
+	}).Return(&s3.HeadObjectOutput{
+		ContentLength: aws.Int64(145),
+		ETag:          aws.String(`"etag1"`),
+		LastModified:  aws.Time(StoreTime),
+	}, nil).Times(2)
+
+	// chmod updates the stored row
+	Suite.SQLMock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM fsmeta_folders WHERE path=$1`)).
+		WithArgs(`s3://sftpgo/users/test1/`).
+		WillReturnRows(sqlmock.NewRows([]string{`id`}).AddRow(int64(15)))
+	Suite.SQLMock.ExpectQuery(regexp.QuoteMeta(`SELECT filename, filesize, uploaded, etag, last_modified, `)).
+		WithArgs(int64(15)).
+		WillReturnRows(sqlmock.NewRows(Columns).AddRow(`test.txt`, 145, StoreTime, `etag1`, StoreTime, 0, nil, nil, nil, nil))
+	Suite.SQLMock.ExpectExec(regexp.QuoteMeta(`INSERT INTO fsmeta_files `)).
+		WithArgs(int64(15), `test.txt`, StoreTime, int64(145), `etag1`, StoreTime, int64(0600), nil, nil, nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	Suite.Nil(Suite.Fs.Chmod(`users/test1/test.txt`, 0600))
+
+	// stat reports the stored attributes reading only the stored row
+	Suite.SQLMock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM fsmeta_folders WHERE path=$1`)).
+		WithArgs(`s3://sftpgo/users/test1/`).
+		WillReturnRows(sqlmock.NewRows([]string{`id`}).AddRow(int64(15)))
+	Suite.SQLMock.ExpectQuery(regexp.QuoteMeta(`SELECT filesize, uploaded, etag, last_modified, `+
+		`mode, atime, uid, gid, attributes FROM fsmeta_files WHERE folder_id = $1 AND filename = $2`)).
+		WithArgs(int64(15), `test.txt`).
+		WillReturnRows(sqlmock.NewRows(Columns[1:]).AddRow(145, StoreTime, `etag1`, StoreTime, 0600, nil, 1000, 1000, nil))
+	Info, err := Suite.Fs.Stat(`users/test1/test.txt`)
+	Suite.Nil(err)
+	Suite.Equal(os.FileMode(0600), Info.Mode())
+	Suite.True(Suite.Fs.StoresFSMetaAttributes())
+
+	fsmeta.Buckets = []string{`bucket`}
+	Suite.False(Suite.Fs.StoresFSMetaAttributes())
+	Suite.Equal(ErrVfsUnsupported, Suite.Fs.Chmod(`users/test1/test.txt`, 0600))
+	Suite.Equal(ErrVfsUnsupported, Suite.Fs.Chown(`users/test1/test.txt`, 1000, 1000))
+	Suite.Equal(ErrVfsUnsupported, Suite.Fs.Chtimes(`users/test1/test.txt`, StoreTime, StoreTime))
+}
+
+func (Suite *S3FsSuite) TestChtimesCopyInPlace() {
+	fsmeta.Enabled = true
+	fsmeta.Buckets = []string{`sftpgo`}
+	fsmeta.ChtimesCopyInPlace = true
+	defer func() {
+		fsmeta.ChtimesCopyInPlace = false
+	}()
+	StoreTime := time.Date(2021, time.March, 1, 10, 0, 0, 0, time.UTC)
+	CopyTime := StoreTime.Add(time.Hour)
+	Atime := time.Date(2021, time.February, 2, 8, 0, 0, 0, time.UTC)
+	Mtime := time.Date(2021, time.February, 1, 8, 0, 0, 0, time.UTC)
+
+	Suite.S3.EXPECT().HeadObjectWithContext(gomock.Any(), &s3.HeadObjectInput{
+		Bucket: aws.String(`sftpgo`),
+		Key:    aws.String(`users/test1/test.txt`),
+	}).Return(&s3.HeadObjectOutput{
+		ContentLength:        aws.Int64(145),
+		ContentType:          aws.String(`text/plain`),
+		ContentEncoding:      aws.String(`gzip`),
+		ContentDisposition:   aws.String(`attachment; filename="test.txt"`),
+		ContentLanguage:      aws.String(`en`),
+		CacheControl:         aws.String(`no-cache`),
+		Expires:              aws.String(`Wed, 03 Mar 2021 10:00:00 GMT`),
+		ServerSideEncryption: aws.String(s3.ServerSideEncryptionAwsKms),
+		SSEKMSKeyId:          aws.String(`arn:aws:kms:us-east-1:123456789012:key/sftpgo`),
+		BucketKeyEnabled:     aws.Bool(true),
+		ETag:                 aws.String(`"etag1"`),
+		LastModified:         aws.Time(StoreTime),
+		Metadata: map[string]*string{
+			`Fs-Mtime`: aws.String(StoreTime.Format(time.RFC3339)),
+			`Custom`:   aws.String(`value`),
+		},
+	}, nil).Times(1)
+	// the headers, the encryption settings and the user metadata are preserved
+	Suite.S3.EXPECT().CopyObjectWithContext(gomock.Any(), &s3.CopyObjectInput{
+		Bucket:     aws.String(`sftpgo`),
+		CopySource: aws.String(`sftpgo/users/test1/test.txt`),
+		Key:        aws.String(`users/test1/test.txt`),
+		Metadata: map[string]*string{
+			`Fs-Mtime`: aws.String(Mtime.Format(time.RFC3339)),
+			`Custom`:   aws.String(`value`),
+		},
+		MetadataDirective:    aws.String(s3.MetadataDirectiveReplace),
+		ContentType:          aws.String(`text/plain`),
+		ContentEncoding:      aws.String(`gzip`),
+		ContentDisposition:   aws.String(`attachment; filename="test.txt"`),
+		ContentLanguage:      aws.String(`en`),
+		CacheControl:         aws.String(`no-cache`),
+		Expires:              aws.Time(time.Date(2021, time.March, 3, 10, 0, 0, 0, time.UTC)),
+		ServerSideEncryption: aws.String(s3.ServerSideEncryptionAwsKms),
+		SSEKMSKeyId:          aws.String(`arn:aws:kms:us-east-1:123456789012:key/sftpgo`),
+		BucketKeyEnabled:     aws.Bool(true),
+	}).Return(&s3.CopyObjectOutput{
+		CopyObjectResult: &s3.CopyObjectResult{
+			ETag:         aws.String(`"etag2"`),
+			LastModified: aws.Time(CopyTime),
+		},
+	}, nil).Times(1)
+
+	// the row is updated first and then moved to the copied object key, the mode is preserved
+	Suite.SQLMock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM fsmeta_folders WHERE path=$1`)).
+		WithArgs(`s3://sftpgo/users/test1/`).
+		WillReturnRows(sqlmock.NewRows([]string{`id`}).AddRow(int64(15)))
+	Suite.SQLMock.ExpectQuery(regexp.QuoteMeta(`SELECT filename, filesize, uploaded, etag, last_modified, `)).
+		WithArgs(int64(15)).
+		WillReturnRows(sqlmock.NewRows([]string{`filename`, `filesize`, `uploaded`, `etag`, `last_modified`,
+			`mode`, `atime`, `uid`, `gid`, `attributes`}).
+			AddRow(`test.txt`, 145, StoreTime, `etag1`, StoreTime, 0600, nil, nil, nil, nil))
+	Suite.SQLMock.ExpectExec(regexp.QuoteMeta(`INSERT INTO fsmeta_files `)).
+		WithArgs(int64(15), `test.txt`, StoreTime, int64(145), `etag1`, Mtime, int64(0600), Atime, nil, nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	Suite.SQLMock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM fsmeta_folders WHERE path=$1`)).
+		WithArgs(`s3://sftpgo/users/test1/`).
+		WillReturnRows(sqlmock.NewRows([]string{`id`}).AddRow(int64(15)))
+	Suite.SQLMock.ExpectExec(regexp.QuoteMeta(`INSERT INTO fsmeta_files `)).
+		WithArgs(int64(15), `test.txt`, CopyTime, int64(145), `etag2`, Mtime, int64(0600), Atime, nil, nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	Suite.Nil(Suite.Fs.Chtimes(`users/test1/test.txt`, Atime, Mtime))
+}
+
+func (Suite *S3FsSuite) TestPresignURL() {
+	Sess, err := session.NewSession(aws.NewConfig().
+		WithRegion(`us-east-1`).
+		WithCredentials(credentials.NewStaticCredentials(`access`, `secret`, ``)))
+	Suite.Require().NoError(err)
+	Client := s3.New(Sess)
+
+	Suite.S3.EXPECT().GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(`sftpgo`),
+		Key:    aws.String(`users/test1/test.txt`),
+	}).DoAndReturn(Client.GetObjectRequest).Times(1)
+	Suite.S3.EXPECT().PutObjectRequest(&s3.PutObjectInput{
+		Bucket: aws.String(`sftpgo`),
+		Key:    aws.String(`users/test1/test.txt`),
+	}).DoAndReturn(Client.PutObjectRequest).Times(1)
+
+	URL, err := Suite.Fs.PresignURL(`users/test1/test.txt`, http.MethodGet, 10*time.Minute)
+	Suite.NoError(err)
+	Suite.Contains(URL, `sftpgo.s3.amazonaws.com/users/test1/test.txt`)
+	Suite.Contains(URL, `X-Amz-Expires=600`)
+	Suite.Contains(URL, `X-Amz-Signature=`)
+	URL, err = Suite.Fs.PresignURL(`users/test1/test.txt`, http.MethodPut, time.Minute)
+	Suite.NoError(err)
+	Suite.Contains(URL, `X-Amz-Expires=60`)
+
+	_, err = Suite.Fs.PresignURL(`users/test1/test.txt`, http.MethodDelete, time.Minute)
+	Suite.Error(err)
+}
+
+func (Suite *S3FsSuite) setupResumableUploads() *memoryMultipartStore {
+	Store := newMemoryMultipartStore()
+	Suite.Fs.config.UploadPartSize = 10
+	Suite.Fs.config.UploadConcurrency = 1
+	Suite.Fs.SetMultipartUploadStore(Store)
+	Suite.True(Suite.Fs.IsUploadResumeSupported())
+	return Store
+}
+
+func (Suite *S3FsSuite) TestResumableUploadSmallFile() {
+	Store := Suite.setupResumableUploads()
+
+	Suite.S3.EXPECT().PutObjectWithContext(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ aws.Context, Input *s3.PutObjectInput, _ ...request.Option) (*s3.PutObjectOutput, error) {
+			Suite.Equal(`users/test1/small.txt`, aws.StringValue(Input.Key))
+			Body, err := io.ReadAll(Input.Body)
+			Suite.NoError(err)
+			Suite.Equal(`small`, string(Body))
+			return &s3.PutObjectOutput{}, nil
+		}).Times(1)
+
+	_, Writer, _, err := Suite.Fs.Create(`users/test1/small.txt`, 0)
+	Suite.Require().NoError(err)
+	_, err = Writer.Write([]byte(`small`))
+	Suite.NoError(err)
+	Suite.NoError(Writer.Close())
+	Suite.Len(Store.uploads, 0)
+}
+
+func (Suite *S3FsSuite) TestResumableUploadInterrupted() {
+	Store := Suite.setupResumableUploads()
+	Key := `users/test1/file.dat`
+	PartUploaded := make(chan bool, 1)
+
+	Suite.S3.EXPECT().CreateMultipartUploadWithContext(gomock.Any(), gomock.Any()).
+		Return(&s3.CreateMultipartUploadOutput{UploadId: aws.String(`upload1`)}, nil).Times(1)
+	Suite.S3.EXPECT().UploadPartWithContext(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(Ctx aws.Context, Input *s3.UploadPartInput, _ ...request.Option) (*s3.UploadPartOutput, error) {
+			Suite.Equal(`upload1`, aws.StringValue(Input.UploadId))
+			Number := aws.Int64Value(Input.PartNumber)
+			if Number > 2 {
+				return nil, Ctx.Err()
+			}
+			if Number == 2 {
+				PartUploaded <- true
+			}
+			return &s3.UploadPartOutput{ETag: aws.String(fmt.Sprintf(`etag%v`, Number))}, nil
+		}).Times(3)
+
+	_, Writer, CancelFn, err := Suite.Fs.Create(Key, 0)
+	Suite.Require().NoError(err)
+	_, err = Writer.Write([]byte(`0123456789abcdefghij01234`))
+	Suite.NoError(err)
+	<-PartUploaded
+	// the transfer is interrupted, the completed parts are kept
+	CancelFn()
+	Suite.Error(Writer.Close())
+
+	Upload, err := Store.GetMultipartUpload(Key)
+	Suite.Require().NoError(err)
+	Suite.Equal(`upload1`, Upload.UploadID)
+	Suite.Len(Upload.Parts, 2)
+	Suite.Equal(int64(20), Upload.GetSize())
+
+	// the interrupted upload is visible with the size of the completed parts
+	Suite.S3.EXPECT().HeadObjectWithContext(gomock.Any(), gomock.Any()).
+		Return(nil, awserr.New(s3.ErrCodeNoSuchKey, `not found`, nil)).Times(1)
+	Info, err := Suite.Fs.Stat(Key)
+	Suite.Require().NoError(err)
+	Suite.Equal(int64(20), Info.Size())
+
+	Suite.S3.EXPECT().UploadPartWithContext(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ aws.Context, Input *s3.UploadPartInput, _ ...request.Option) (*s3.UploadPartOutput, error) {
+			Suite.Equal(int64(3), aws.Int64Value(Input.PartNumber))
+			Body, err := io.ReadAll(Input.Body)
+			Suite.NoError(err)
+			Suite.Equal(`klmno`, string(Body))
+			return &s3.UploadPartOutput{ETag: aws.String(`etag3`)}, nil
+		}).Times(1)
+	Suite.S3.EXPECT().CompleteMultipartUploadWithContext(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ aws.Context, Input *s3.CompleteMultipartUploadInput, _ ...request.Option) (*s3.CompleteMultipartUploadOutput, error) {
+			Suite.Equal(`upload1`, aws.StringValue(Input.UploadId))
+			Suite.Require().Len(Input.MultipartUpload.Parts, 3)
+			for Idx, Part := range Input.MultipartUpload.Parts {
+				Suite.Equal(int64(Idx+1), aws.Int64Value(Part.PartNumber))
+				Suite.Equal(fmt.Sprintf(`etag%v`, Idx+1), aws.StringValue(Part.ETag))
+			}
+			return &s3.CompleteMultipartUploadOutput{}, nil
+		}).Times(1)
+
+	_, Writer, _, err = CreateForResume(Suite.Fs, Key, 0, 20)
+	Suite.Require().NoError(err)
+	_, err = Writer.WriteAt([]byte(`klmno`), 20)
+	Suite.NoError(err)
+	Suite.NoError(Writer.Close())
+	Suite.Len(Store.uploads, 0)
+}
+
+func (Suite *S3FsSuite) TestResumableUploadAppend() {
+	Store := Suite.setupResumableUploads()
+	Key := `users/test1/append.txt`
+
+	Suite.S3.EXPECT().HeadObjectWithContext(gomock.Any(), gomock.Any()).
+		Return(&s3.HeadObjectOutput{ContentLength: aws.Int64(4)}, nil).Times(2)
+	Suite.S3.EXPECT().GetObjectWithContext(gomock.Any(), gomock.Any()).
+		Return(&s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(`abcd`))}, nil).Times(1)
+	Suite.S3.EXPECT().PutObjectWithContext(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ aws.Context, Input *s3.PutObjectInput, _ ...request.Option) (*s3.PutObjectOutput, error) {
+			Body, err := io.ReadAll(Input.Body)
+			Suite.NoError(err)
+			Suite.Equal(`abcdef`, string(Body))
+			return &s3.PutObjectOutput{}, nil
+		}).Times(1)
+
+	// the offset must match the object size
+	_, _, _, err := Suite.Fs.ResumeUpload(Key, 3)
+	Suite.Error(err)
+
+	_, Writer, _, err := Suite.Fs.ResumeUpload(Key, 4)
+	Suite.Require().NoError(err)
+	_, err = Writer.WriteAt([]byte(`ef`), 4)
+	Suite.NoError(err)
+	Suite.NoError(Writer.Close())
+	Suite.Len(Store.uploads, 0)
+}
+
+func (Suite *S3FsSuite) TestAbortMultipartUpload() {
+	Store := Suite.setupResumableUploads()
+	Upload := MultipartUpload{
+		Name:     `users/test1/file.dat`,
+		UploadID: `upload1`,
+		Parts:    []MultipartUploadPart{{Number: 1, ETag: `etag1`, Size: 10}},
+	}
+	Suite.NoError(Store.SaveMultipartUpload(&Upload))
+
+	Suite.S3.EXPECT().AbortMultipartUploadWithContext(gomock.Any(), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(`sftpgo`),
+		Key:      aws.String(`users/test1/file.dat`),
+		UploadId: aws.String(`upload1`),
+	}).Return(nil, awserr.New(s3.ErrCodeNoSuchUpload, `not found`, nil)).Times(1)
+	Suite.NoError(Suite.Fs.AbortMultipartUpload(Upload))
+
+	// removing the file aborts the interrupted upload
+	Suite.S3.EXPECT().DeleteObjectWithContext(gomock.Any(), gomock.Any()).Return(&s3.DeleteObjectOutput{}, nil).Times(1)
+	Suite.S3.EXPECT().AbortMultipartUploadWithContext(gomock.Any(), gomock.Any()).
+		Return(&s3.AbortMultipartUploadOutput{}, nil).Times(1)
+	Suite.NoError(Suite.Fs.Remove(`users/test1/file.dat`, false))
+	Suite.Len(Store.uploads, 0)
+}
+
 func TestFSMetaSuite(t *testing.T) {
 	suite.Run(t, new(S3FsSuite))
 }
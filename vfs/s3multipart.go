@@ -0,0 +1,372 @@
+//go:build !nos3
+// +build !nos3
+
+package vfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/eikenb/pipeat"
+
+	"github.com/drakkan/sftpgo/fsmeta"
+	"github.com/drakkan/sftpgo/logger"
+	"github.com/drakkan/sftpgo/metrics"
+	"github.com/drakkan/sftpgo/utils"
+)
+
+// SetMultipartUploadStore sets the store for the state of the in-progress
+// multipart uploads. Upload resume is supported after setting a store
+func (fs *S3Fs) SetMultipartUploadStore(store MultipartUploadStore) {
+	fs.multipartStore = store
+}
+
+// ResumeUpload continues the interrupted multipart upload for the named file
+// if the size of its completed parts matches the given offset, otherwise the
+// uploaded data will be appended to the existing object
+func (fs *S3Fs) ResumeUpload(name string, offset int64) (File, *PipeWriter, func(), error) {
+	if !fs.IsUploadResumeSupported() {
+		return nil, nil, nil, ErrVfsUnsupported
+	}
+	upload, err := fs.multipartStore.GetMultipartUpload(name)
+	if err == nil {
+		if upload.GetSize() == offset {
+			fsLog(fs, logger.LevelDebug, "resuming multipart upload for %#v, upload id: %#v, parts: %v, offset: %v",
+				name, upload.UploadID, len(upload.Parts), offset)
+			return fs.createResumable(name, offset, upload, 0)
+		}
+		fs.abortPendingUpload(name)
+	} else if !errors.Is(err, ErrMultipartUploadNotFound) {
+		return nil, nil, nil, err
+	}
+	obj, err := fs.headObject(name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	size := aws.Int64Value(obj.ContentLength)
+	if size != offset {
+		return nil, nil, nil, fmt.Errorf("unable to resume the upload for %#v, invalid offset %v, object size: %v",
+			name, offset, size)
+	}
+	return fs.createResumable(name, offset, MultipartUpload{Name: name}, size)
+}
+
+// AbortMultipartUpload aborts the given multipart upload releasing the storage
+// used by the uploaded parts. Uploads already completed or aborted are ignored
+func (fs *S3Fs) AbortMultipartUpload(upload MultipartUpload) error {
+	if upload.UploadID == "" {
+		return nil
+	}
+	ctx, cancelFn := context.WithDeadline(context.Background(), time.Now().Add(fs.ctxTimeout))
+	defer cancelFn()
+
+	_, err := fs.svc.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(fs.config.Bucket),
+		Key:      aws.String(upload.Name),
+		UploadId: aws.String(upload.UploadID),
+	})
+	if isS3NoSuchUpload(err) {
+		return nil
+	}
+	return err
+}
+
+// abortPendingUpload aborts the interrupted multipart upload for the named file, if any
+func (fs *S3Fs) abortPendingUpload(name string) {
+	if fs.multipartStore == nil {
+		return
+	}
+	upload, err := fs.multipartStore.GetMultipartUpload(name)
+	if err != nil {
+		return
+	}
+	if err := fs.AbortMultipartUpload(upload); err != nil {
+		fsLog(fs, logger.LevelWarn, "unable to abort multipart upload for %#v, upload id: %#v, err: %v",
+			name, upload.UploadID, err)
+	}
+	if err := fs.multipartStore.DeleteMultipartUpload(name); err != nil {
+		fsLog(fs, logger.LevelWarn, "unable to delete multipart upload state for %#v: %v", name, err)
+	}
+}
+
+func (fs *S3Fs) createResumable(name string, offset int64, upload MultipartUpload, existingSize int64) (File, *PipeWriter, func(), error) {
+	r, w, err := pipeat.PipeInDir(fs.localTempDir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	p := newResumedPipeWriter(w, offset)
+	ctx, cancelFn := context.WithCancel(context.Background())
+	tracker := newMultipartUploadTracker(fs.multipartStore, upload)
+
+	go func() {
+		defer cancelFn()
+
+		err := fs.handleResumableUpload(ctx, r, tracker, existingSize)
+		r.CloseWithError(err) //nolint:errcheck
+		p.Done(err)
+		fsLog(fs, logger.LevelDebug, "resumable upload completed, path: %#v, upload id: %#v, offset: %v, readed bytes: %v, err: %+v",
+			name, tracker.getUploadID(), offset, r.GetReadedBytes(), err)
+		metrics.S3TransferCompleted(r.GetReadedBytes(), 0, err)
+	}()
+
+	return nil, p, cancelFn, nil
+}
+
+// handleResumableUpload uploads the data read from reader as a multipart upload
+// persisting the completed parts. Small files are uploaded using a single request.
+// If existingSize is greater than 0 the data are appended to the existing object
+func (fs *S3Fs) handleResumableUpload(ctx context.Context, reader io.Reader, tracker *multipartUploadTracker,
+	existingSize int64,
+) error {
+	var prefix []byte
+	copySize := int64(0)
+	if existingSize >= s3MinPartSize {
+		copySize = existingSize
+	} else if existingSize > 0 {
+		contents, err := fs.getObjectContents(ctx, tracker.getName())
+		if err != nil {
+			return err
+		}
+		prefix = contents
+	}
+	data, eof, err := readUploadPart(reader, prefix, fs.config.UploadPartSize)
+	if err != nil {
+		return err
+	}
+	if eof && copySize == 0 && !tracker.isStarted() {
+		return fs.putObject(ctx, tracker.getName(), data)
+	}
+	if !tracker.isStarted() {
+		if err := fs.createMultipartUpload(ctx, tracker); err != nil {
+			return err
+		}
+	}
+	if copySize > 0 {
+		err = fs.copyExistingObjectParts(ctx, tracker, copySize)
+	}
+	if err == nil {
+		err = fs.uploadParts(ctx, reader, tracker, data, eof)
+	}
+	if err == nil {
+		// the transfer could be cancelled after the last part was read
+		err = ctx.Err()
+	}
+	if err == nil {
+		err = fs.completeMultipartUpload(ctx, tracker)
+		if err == nil {
+			if errDelete := tracker.delete(); errDelete != nil {
+				fsLog(fs, logger.LevelWarn, "unable to delete multipart upload state for %#v: %v", tracker.getName(), errDelete)
+			}
+			return nil
+		}
+	}
+	if !tracker.hasParts() || isS3NoSuchUpload(err) {
+		// nothing to resume
+		if errAbort := fs.AbortMultipartUpload(tracker.upload); errAbort != nil {
+			fsLog(fs, logger.LevelWarn, "unable to abort multipart upload for %#v: %v", tracker.getName(), errAbort)
+		}
+		if errDelete := tracker.delete(); errDelete != nil {
+			fsLog(fs, logger.LevelWarn, "unable to delete multipart upload state for %#v: %v", tracker.getName(), errDelete)
+		}
+	}
+	return err
+}
+
+func (fs *S3Fs) getObjectContents(ctx context.Context, name string) ([]byte, error) {
+	ctx, cancelFn := context.WithDeadline(ctx, time.Now().Add(fs.ctxLongTimeout))
+	defer cancelFn()
+
+	resp, err := fs.svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(fs.config.Bucket),
+		Key:    aws.String(name),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return io.ReadAll(resp.Body)
+}
+
+func (fs *S3Fs) putObject(ctx context.Context, name string, data []byte) error {
+	ctx, cancelFn := context.WithDeadline(ctx, time.Now().Add(fs.ctxLongTimeout))
+	defer cancelFn()
+
+	_, err := fs.svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:       aws.String(fs.config.Bucket),
+		Key:          aws.String(name),
+		Body:         bytes.NewReader(data),
+		Metadata:     fsmeta.NewS3Metadata(time.Now()),
+		StorageClass: utils.NilIfEmpty(fs.config.StorageClass),
+		ContentType:  utils.NilIfEmpty(mime.TypeByExtension(path.Ext(name))),
+	})
+	return err
+}
+
+func (fs *S3Fs) createMultipartUpload(ctx context.Context, tracker *multipartUploadTracker) error {
+	ctx, cancelFn := context.WithDeadline(ctx, time.Now().Add(fs.ctxTimeout))
+	defer cancelFn()
+
+	name := tracker.getName()
+	resp, err := fs.svc.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:       aws.String(fs.config.Bucket),
+		Key:          aws.String(name),
+		Metadata:     fsmeta.NewS3Metadata(time.Now()),
+		StorageClass: utils.NilIfEmpty(fs.config.StorageClass),
+		ContentType:  utils.NilIfEmpty(mime.TypeByExtension(path.Ext(name))),
+	})
+	if err != nil {
+		return err
+	}
+	return tracker.start(aws.StringValue(resp.UploadId))
+}
+
+// copyExistingObjectParts adds the existing object to the multipart upload using
+// server side copies. Each copied part is at most s3MaxCopyObjectSize bytes
+func (fs *S3Fs) copyExistingObjectParts(ctx context.Context, tracker *multipartUploadTracker, size int64) error {
+	numParts := (size + s3MaxCopyObjectSize - 1) / s3MaxCopyObjectSize
+	partSize := (size + numParts - 1) / numParts
+	copySource := pathEscape(fs.Join(fs.config.Bucket, tracker.getName()))
+
+	for start := int64(0); start < size; start += partSize {
+		end := start + partSize - 1
+		if end >= size {
+			end = size - 1
+		}
+		partNumber := tracker.nextPartNumber()
+		partCtx, cancelFn := context.WithDeadline(ctx, time.Now().Add(fs.ctxLongTimeout))
+		resp, err := fs.svc.UploadPartCopyWithContext(partCtx, &s3.UploadPartCopyInput{
+			Bucket:          aws.String(fs.config.Bucket),
+			Key:             aws.String(tracker.getName()),
+			CopySource:      aws.String(copySource),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%v-%v", start, end)),
+			PartNumber:      aws.Int64(partNumber),
+			UploadId:        aws.String(tracker.getUploadID()),
+		})
+		cancelFn()
+		metrics.S3CopyObjectCompleted(err)
+		if err != nil {
+			return err
+		}
+		var etag string
+		if resp.CopyPartResult != nil {
+			etag = aws.StringValue(resp.CopyPartResult.ETag)
+		}
+		if err := tracker.addPart(MultipartUploadPart{Number: partNumber, ETag: etag, Size: end - start + 1}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// uploadParts uploads data and then the contents read from reader using
+// UploadConcurrency concurrent requests
+func (fs *S3Fs) uploadParts(ctx context.Context, reader io.Reader, tracker *multipartUploadTracker, data []byte,
+	eof bool,
+) error {
+	poolCtx, poolCancel := context.WithCancel(ctx)
+	defer poolCancel()
+
+	var wg sync.WaitGroup
+	guard := make(chan struct{}, fs.config.UploadConcurrency)
+	partNumber := tracker.nextPartNumber()
+
+	for {
+		if len(data) > 0 {
+			guard <- struct{}{}
+			if tracker.getError() != nil {
+				<-guard
+				break
+			}
+			wg.Add(1)
+			go func(number int64, buf []byte) {
+				defer func() {
+					<-guard
+					wg.Done()
+				}()
+
+				err := fs.uploadPart(poolCtx, tracker, number, buf)
+				if err != nil && tracker.setError(err) {
+					poolCancel()
+				}
+			}(partNumber, data)
+			partNumber++
+		}
+		if eof {
+			break
+		}
+		var err error
+		data, eof, err = readUploadPart(reader, nil, fs.config.UploadPartSize)
+		if err != nil {
+			if tracker.setError(err) {
+				poolCancel()
+			}
+			break
+		}
+	}
+
+	wg.Wait()
+	return tracker.getError()
+}
+
+func (fs *S3Fs) uploadPart(ctx context.Context, tracker *multipartUploadTracker, partNumber int64, data []byte) error {
+	ctx, cancelFn := context.WithDeadline(ctx, time.Now().Add(fs.ctxLongTimeout))
+	defer cancelFn()
+
+	resp, err := fs.svc.UploadPartWithContext(ctx, &s3.UploadPartInput{
+		Bucket:     aws.String(fs.config.Bucket),
+		Key:        aws.String(tracker.getName()),
+		Body:       bytes.NewReader(data),
+		PartNumber: aws.Int64(partNumber),
+		UploadId:   aws.String(tracker.getUploadID()),
+	})
+	if err != nil {
+		return err
+	}
+	return tracker.addPart(MultipartUploadPart{
+		Number: partNumber,
+		ETag:   aws.StringValue(resp.ETag),
+		Size:   int64(len(data)),
+	})
+}
+
+func (fs *S3Fs) completeMultipartUpload(ctx context.Context, tracker *multipartUploadTracker) error {
+	ctx, cancelFn := context.WithDeadline(ctx, time.Now().Add(fs.ctxLongTimeout))
+	defer cancelFn()
+
+	parts := tracker.getParts()
+	completedParts := make([]*s3.CompletedPart, 0, len(parts))
+	for _, part := range parts {
+		completedParts = append(completedParts, &s3.CompletedPart{
+			ETag:       aws.String(part.ETag),
+			PartNumber: aws.Int64(part.Number),
+		})
+	}
+	_, err := fs.svc.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String(fs.config.Bucket),
+		Key:      aws.String(tracker.getName()),
+		UploadId: aws.String(tracker.getUploadID()),
+		MultipartUpload: &s3.CompletedMultipartUpload{
+			Parts: completedParts,
+		},
+	})
+	return err
+}
+
+func isS3NoSuchUpload(err error) bool {
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		return aerr.Code() == s3.ErrCodeNoSuchUpload
+	}
+	return false
+}
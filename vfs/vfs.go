@@ -2,6 +2,7 @@
 package vfs
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -16,6 +17,7 @@ import (
 	"github.com/eikenb/pipeat"
 	"github.com/pkg/sftp"
 
+	"github.com/drakkan/sftpgo/fsmeta"
 	"github.com/drakkan/sftpgo/kms"
 	"github.com/drakkan/sftpgo/logger"
 	"github.com/drakkan/sftpgo/utils"
@@ -79,6 +81,46 @@ type File interface {
 	Truncate(size int64) error
 }
 
+// FSMetaReconciler is implemented by the filesystems able to reconcile the
+// fsmeta stored metadata with the object store listing
+type FSMetaReconciler interface {
+	ReconcileFSMeta(ctx context.Context, prefix string, dryRun bool) (fsmeta.ReconcileReport, error)
+}
+
+// FSMetaBackfiller is implemented by the filesystems able to bulk import
+// the fsmeta metadata from the object store
+type FSMetaBackfiller interface {
+	BackfillFSMeta(ctx context.Context, options fsmeta.BackfillOptions) (fsmeta.BackfillReport, error)
+}
+
+// FSMetaInspector is implemented by the filesystems able to inspect, refresh
+// and delete the fsmeta stored metadata for a single object key
+type FSMetaInspector interface {
+	InspectFSMeta(ctx context.Context, key string) (fsmeta.Inspection, error)
+	RefreshFSMeta(ctx context.Context, key string) (fsmeta.Inspection, error)
+	DeleteFSMeta(ctx context.Context, key string) error
+}
+
+// FSMetaAttributesStorer is implemented by the filesystems able to persist chmod,
+// chown and chtimes using fsmeta even if the underlying storage does not support them
+type FSMetaAttributesStorer interface {
+	StoresFSMetaAttributes() bool
+}
+
+// Presigner is implemented by the filesystems able to generate time-limited URLs
+// to download or upload an object without credentials. The supported methods are
+// GET and PUT
+type Presigner interface {
+	PresignURL(name, method string, expiration time.Duration) (string, error)
+}
+
+// Copier is implemented by the filesystems able to copy a file without
+// transferring its contents through SFTPGo, for example using the storage
+// backend server side copy. The target is overwritten if it exists
+type Copier interface {
+	CopyFile(source, target string) error
+}
+
 // ErrVfsUnsupported defines the error for an unsupported VFS operation
 var ErrVfsUnsupported = errors.New("Not supported")
 
@@ -391,6 +433,7 @@ type PipeWriter struct {
 	writer *pipeat.PipeWriterAt
 	err    error
 	done   chan bool
+	offset int64
 }
 
 // NewPipeWriter initializes a new PipeWriter
@@ -402,6 +445,14 @@ func NewPipeWriter(w *pipeat.PipeWriterAt) *PipeWriter {
 	}
 }
 
+// newResumedPipeWriter returns a PipeWriter for an upload resumed from the given offset.
+// The pipe contains the data received after the offset, WriteAt offsets are translated
+func newResumedPipeWriter(w *pipeat.PipeWriterAt, offset int64) *PipeWriter {
+	p := NewPipeWriter(w)
+	p.offset = offset
+	return p
+}
+
 // Close waits for the upload to end, closes the pipeat.PipeWriterAt and returns an error if any.
 func (p *PipeWriter) Close() error {
 	p.writer.Close() //nolint:errcheck // the returned error is always null
@@ -418,7 +469,7 @@ func (p *PipeWriter) Done(err error) {
 
 // WriteAt is a wrapper for pipeat WriteAt
 func (p *PipeWriter) WriteAt(data []byte, off int64) (int, error) {
-	return p.writer.WriteAt(data, off)
+	return p.writer.WriteAt(data, off-p.offset)
 }
 
 // Write is a wrapper for pipeat Write
@@ -455,6 +506,14 @@ func IsLocalOrSFTPFs(fs Fs) bool {
 	return IsLocalOsFs(fs) || IsSFTPFs(fs)
 }
 
+// StoresFSMetaAttributes returns true if fs persists chmod, chown and chtimes using fsmeta
+func StoresFSMetaAttributes(fs Fs) bool {
+	if storer, ok := fs.(FSMetaAttributesStorer); ok {
+		return storer.StoresFSMetaAttributes()
+	}
+	return false
+}
+
 // SetPathPermissions calls fs.Chown.
 // It does nothing for local filesystem on windows
 func SetPathPermissions(fs Fs, path string, uid int, gid int) {
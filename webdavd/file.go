@@ -143,10 +143,14 @@ func (f *webDavFile) Read(p []byte) (n int, err error) {
 			return 0, f.Connection.GetPermissionDeniedError()
 		}
 
-		if !f.Connection.User.IsFileAllowed(f.GetVirtualPath()) {
+		if !f.Connection.IsFileAllowed(f.GetVirtualPath()) {
 			f.Connection.Log(logger.LevelWarn, "reading file %#v is not allowed", f.GetVirtualPath())
 			return 0, f.Connection.GetPermissionDeniedError()
 		}
+		if err := f.Connection.ExecutePreTransferAction(common.TransferDownload, f.GetFsPath(), f.GetVirtualPath(),
+			-1); err != nil {
+			return 0, err
+		}
 		atomic.StoreInt32(&f.readTryed, 1)
 	}
 
@@ -193,7 +197,8 @@ func (f *webDavFile) Write(p []byte) (n int, err error) {
 	f.Connection.UpdateLastActivity()
 
 	n, err = f.writer.Write(p)
-	atomic.AddInt64(&f.BytesReceived, int64(n))
+	received := atomic.AddInt64(&f.BytesReceived, int64(n))
+	f.UpdateChecksum(p[:n], received-int64(n))
 
 	if f.MaxWriteSize > 0 && err == nil && atomic.LoadInt64(&f.BytesReceived) > f.MaxWriteSize {
 		err = common.ErrQuotaExceeded
@@ -336,3 +341,40 @@ func (f *webDavFile) isTransfer() bool {
 	}
 	return true
 }
+
+// webDavPrefixDir is a synthetic directory for the folder prefix parents,
+// it can only be listed
+type webDavPrefixDir struct {
+	connection *Connection
+	name       string
+}
+
+// Readdir returns the next directory in the prefix hierarchy
+func (d *webDavPrefixDir) Readdir(count int) ([]os.FileInfo, error) {
+	return d.connection.ListPrefixParent(d.name), nil
+}
+
+// Stat returns the synthetic directory info
+func (d *webDavPrefixDir) Stat() (os.FileInfo, error) {
+	return d.connection.StatPrefixParent(d.name), nil
+}
+
+// Read is not supported for directories
+func (d *webDavPrefixDir) Read(p []byte) (int, error) {
+	return 0, d.connection.GetOpUnsupportedError()
+}
+
+// Write is not supported for directories
+func (d *webDavPrefixDir) Write(p []byte) (int, error) {
+	return 0, d.connection.GetPermissionDeniedError()
+}
+
+// Seek is not supported for directories
+func (d *webDavPrefixDir) Seek(offset int64, whence int) (int64, error) {
+	return 0, d.connection.GetOpUnsupportedError()
+}
+
+// Close implements io.Closer interface
+func (d *webDavPrefixDir) Close() error {
+	return nil
+}
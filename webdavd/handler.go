@@ -56,7 +56,10 @@ func (c *Connection) GetCommand() string {
 func (c *Connection) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
 	c.UpdateLastActivity()
 
-	name = utils.CleanPath(name)
+	name, err := c.RemoveFolderPrefix(utils.CleanPath(name))
+	if err != nil {
+		return err
+	}
 	p, err := c.Fs.ResolvePath(name)
 	if err != nil {
 		return c.GetFsError(err)
@@ -68,8 +71,10 @@ func (c *Connection) Mkdir(ctx context.Context, name string, perm os.FileMode) e
 func (c *Connection) Rename(ctx context.Context, oldName, newName string) error {
 	c.UpdateLastActivity()
 
-	oldName = utils.CleanPath(oldName)
-	newName = utils.CleanPath(newName)
+	oldName, newName, err := c.RemoveFolderPrefixes(utils.CleanPath(oldName), utils.CleanPath(newName))
+	if err != nil {
+		return err
+	}
 
 	p, err := c.Fs.ResolvePath(oldName)
 	if err != nil {
@@ -93,10 +98,19 @@ func (c *Connection) Rename(ctx context.Context, oldName, newName string) error
 func (c *Connection) Stat(ctx context.Context, name string) (os.FileInfo, error) {
 	c.UpdateLastActivity()
 
-	name = utils.CleanPath(name)
+	name, match := c.ResolvePrefixPath(utils.CleanPath(name))
+	switch match {
+	case common.PathIsPrefixParent:
+		return c.StatPrefixParent(name), nil
+	case common.PathDiverged:
+		return nil, c.GetPermissionDeniedError()
+	}
 	if !c.User.HasPerm(dataprovider.PermListItems, path.Dir(name)) {
 		return nil, c.GetPermissionDeniedError()
 	}
+	if c.IsReservedPath(name) {
+		return nil, c.GetNotExistError()
+	}
 
 	p, err := c.Fs.ResolvePath(name)
 	if err != nil {
@@ -115,7 +129,10 @@ func (c *Connection) Stat(ctx context.Context, name string) (os.FileInfo, error)
 func (c *Connection) RemoveAll(ctx context.Context, name string) error {
 	c.UpdateLastActivity()
 
-	name = utils.CleanPath(name)
+	name, err := c.RemoveFolderPrefix(utils.CleanPath(name))
+	if err != nil {
+		return err
+	}
 	p, err := c.Fs.ResolvePath(name)
 	if err != nil {
 		return c.GetFsError(err)
@@ -138,7 +155,16 @@ func (c *Connection) RemoveAll(ctx context.Context, name string) error {
 func (c *Connection) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
 	c.UpdateLastActivity()
 
-	name = utils.CleanPath(name)
+	name, match := c.ResolvePrefixPath(utils.CleanPath(name))
+	switch match {
+	case common.PathIsPrefixParent:
+		if flag != os.O_RDONLY {
+			return nil, c.GetPermissionDeniedError()
+		}
+		return &webDavPrefixDir{connection: c, name: name}, nil
+	case common.PathDiverged:
+		return nil, c.GetPermissionDeniedError()
+	}
 	p, err := c.Fs.ResolvePath(name)
 	if err != nil {
 		return nil, c.GetFsError(err)
@@ -174,21 +200,21 @@ func (c *Connection) getFile(fsPath, virtualPath string) (webdav.File, error) {
 }
 
 func (c *Connection) putFile(fsPath, virtualPath string) (webdav.File, error) {
-	if !c.User.IsFileAllowed(virtualPath) {
+	if !c.IsFileAllowed(virtualPath) {
 		c.Log(logger.LevelWarn, "writing file %#v is not allowed", virtualPath)
 		return nil, c.GetPermissionDeniedError()
 	}
 
-	filePath := fsPath
-	if common.Config.IsAtomicUploadEnabled() && c.Fs.IsAtomicUploadSupported() {
-		filePath = c.Fs.GetAtomicUploadPath(fsPath)
-	}
+	filePath := c.GetUploadPath(fsPath)
 
 	stat, statErr := c.Fs.Lstat(fsPath)
 	if (statErr == nil && stat.Mode()&os.ModeSymlink != 0) || c.Fs.IsNotExist(statErr) {
 		if !c.User.HasPerm(dataprovider.PermUpload, path.Dir(virtualPath)) {
 			return nil, c.GetPermissionDeniedError()
 		}
+		if err := c.ExecutePreTransferAction(common.TransferUpload, fsPath, virtualPath, 0); err != nil {
+			return nil, err
+		}
 		return c.handleUploadToNewFile(fsPath, filePath, virtualPath)
 	}
 
@@ -206,6 +232,9 @@ func (c *Connection) putFile(fsPath, virtualPath string) (webdav.File, error) {
 	if !c.User.HasPerm(dataprovider.PermOverwrite, path.Dir(virtualPath)) {
 		return nil, c.GetPermissionDeniedError()
 	}
+	if err := c.ExecutePreTransferAction(common.TransferUpload, fsPath, virtualPath, stat.Size()); err != nil {
+		return nil, err
+	}
 
 	return c.handleUploadToExistingFile(fsPath, filePath, stat.Size(), virtualPath)
 }
@@ -246,10 +275,10 @@ func (c *Connection) handleUploadToExistingFile(resolvedPath, filePath string, f
 	// will return false in this case and we deny the upload before
 	maxWriteSize, _ := c.GetMaxWriteSize(quotaResult, false, fileSize)
 
-	if common.Config.IsAtomicUploadEnabled() && c.Fs.IsAtomicUploadSupported() {
+	if c.IsExistingFileMovedForUpload(resolvedPath, filePath) {
 		err = c.Fs.Rename(resolvedPath, filePath)
 		if err != nil {
-			c.Log(logger.LevelWarn, "error renaming existing file for atomic upload, source: %#v, dest: %#v, err: %+v",
+			c.Log(logger.LevelWarn, "error renaming existing file for upload, source: %#v, dest: %#v, err: %+v",
 				resolvedPath, filePath, err)
 			return nil, c.GetFsError(err)
 		}
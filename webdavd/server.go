@@ -182,6 +182,7 @@ func (s *webDavServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		BaseConnection: common.NewBaseConnection(connectionID, common.ProtocolWebDAV, user, fs),
 		request:        r,
 	}
+	connection.SetRemoteAddress(r.RemoteAddr)
 	common.Connections.Add(connection)
 	defer common.Connections.Remove(connection.GetID())
 
@@ -374,6 +374,62 @@ func TestBasicHandling(t *testing.T) {
 	assert.True(t, status.IsActive)
 }
 
+func TestPreActionsHook(t *testing.T) {
+	if runtime.GOOS == osWindows {
+		t.Skip("this test is not available on Windows")
+	}
+	user, _, err := httpdtest.AddUser(getTestUser(), http.StatusCreated)
+	assert.NoError(t, err)
+	hookPath := filepath.Join(homeBasePath, "pre_action_hook.sh")
+	hookContent := "#!/bin/sh\n\ncase \"$SFTPGO_ACTION_VIRTUAL_PATH $SFTPGO_ACTION_VIRTUAL_TARGET\" in\n" +
+		"*denied*)\necho \"$SFTPGO_ACTION is not allowed\"\nexit 1\n;;\nesac\n"
+	err = ioutil.WriteFile(hookPath, []byte(hookContent), os.ModePerm)
+	assert.NoError(t, err)
+	oldExecuteOn := common.Config.Actions.ExecuteOn
+	oldHook := common.Config.Actions.Hook
+	common.Config.Actions.ExecuteOn = []string{"pre-upload", "pre-download", "pre-rename", "pre-mkdir"}
+	common.Config.Actions.Hook = hookPath
+	defer func() {
+		common.Config.Actions.ExecuteOn = oldExecuteOn
+		common.Config.Actions.Hook = oldHook
+	}()
+
+	client := getWebDavClient(user)
+	testFilePath := filepath.Join(homeBasePath, testFileName)
+	testFileSize := int64(65535)
+	err = createTestFile(testFilePath, testFileSize)
+	assert.NoError(t, err)
+	err = uploadFile(testFilePath, testFileName, testFileSize, client)
+	assert.NoError(t, err)
+	err = uploadFile(testFilePath, "denied.dat", testFileSize, client)
+	assert.Error(t, err)
+	assert.NoFileExists(t, filepath.Join(user.GetHomeDir(), "denied.dat"))
+	err = client.Rename(testFileName, "denied.dat", false)
+	assert.Error(t, err)
+	assert.FileExists(t, filepath.Join(user.GetHomeDir(), testFileName))
+	// the client does not return an error for the 405 status code
+	_ = client.Mkdir("denied_dir", os.ModePerm)
+	assert.NoDirExists(t, filepath.Join(user.GetHomeDir(), "denied_dir"))
+	err = ioutil.WriteFile(filepath.Join(user.GetHomeDir(), "denied_dl.dat"), []byte("data"), os.ModePerm)
+	assert.NoError(t, err)
+	localDownloadPath := filepath.Join(homeBasePath, testDLFileName)
+	err = downloadFile("denied_dl.dat", localDownloadPath, 4, client)
+	assert.Error(t, err)
+	err = downloadFile(testFileName, localDownloadPath, testFileSize, client)
+	assert.NoError(t, err)
+
+	err = os.Remove(testFilePath)
+	assert.NoError(t, err)
+	err = os.Remove(localDownloadPath)
+	assert.NoError(t, err)
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.RemoveAll(user.GetHomeDir())
+	assert.NoError(t, err)
+	err = os.Remove(hookPath)
+	assert.NoError(t, err)
+}
+
 func TestBasicHandlingCryptFs(t *testing.T) {
 	u := getTestUserWithCryptFs()
 	u.QuotaSize = 6553600
@@ -1370,6 +1426,76 @@ func TestStat(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestFolderPrefix(t *testing.T) {
+	u := getTestUser()
+	u.Filters.FolderPrefix = "/inbound/acme"
+	user, _, err := httpdtest.AddUser(u, http.StatusCreated)
+	assert.NoError(t, err)
+	client := getWebDavClient(user)
+	assert.NoError(t, checkBasicFunc(client))
+	// the prefix parents only contain the next prefix directory
+	files, err := client.ReadDir("/")
+	if assert.NoError(t, err) && assert.Len(t, files, 1) {
+		assert.Equal(t, "inbound", files[0].Name())
+		assert.True(t, files[0].IsDir())
+	}
+	files, err = client.ReadDir("/inbound")
+	if assert.NoError(t, err) && assert.Len(t, files, 1) {
+		assert.Equal(t, "acme", files[0].Name())
+	}
+	_, err = client.ReadDir("/other")
+	assert.Error(t, err)
+	info, err := client.Stat("/inbound")
+	if assert.NoError(t, err) {
+		assert.True(t, info.IsDir())
+	}
+
+	testFilePath := filepath.Join(homeBasePath, testFileName)
+	testFileSize := int64(65535)
+	err = createTestFile(testFilePath, testFileSize)
+	assert.NoError(t, err)
+	err = uploadFile(testFilePath, path.Join("/inbound/acme", testFileName), testFileSize, client)
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(user.GetHomeDir(), testFileName))
+	err = uploadFile(testFilePath, path.Join("/inbound", testFileName), testFileSize, client)
+	assert.Error(t, err)
+	// the webdav client hides the error, we check that the prefix parent is unchanged
+	err = client.Mkdir("/inbound/dir", os.ModePerm)
+	assert.NoError(t, err)
+	files, err = client.ReadDir("/inbound")
+	if assert.NoError(t, err) {
+		assert.Len(t, files, 1)
+	}
+	err = client.Mkdir("/inbound/acme/dir", os.ModePerm)
+	assert.NoError(t, err)
+	assert.DirExists(t, filepath.Join(user.GetHomeDir(), "dir"))
+	files, err = client.ReadDir("/inbound/acme")
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+	localDownloadPath := filepath.Join(homeBasePath, testDLFileName)
+	err = downloadFile(path.Join("/inbound/acme", testFileName), localDownloadPath, testFileSize, client)
+	assert.NoError(t, err)
+	err = client.Rename(path.Join("/inbound/acme", testFileName), path.Join("/inbound", testFileName), false)
+	assert.Error(t, err)
+	err = client.Rename(path.Join("/inbound/acme", testFileName), path.Join("/inbound/acme/dir", testFileName), false)
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(user.GetHomeDir(), "dir", testFileName))
+	err = client.RemoveAll("/inbound")
+	assert.Error(t, err)
+	err = client.RemoveAll("/inbound/acme/dir")
+	assert.NoError(t, err)
+	assert.NoDirExists(t, filepath.Join(user.GetHomeDir(), "dir"))
+
+	err = os.Remove(testFilePath)
+	assert.NoError(t, err)
+	err = os.Remove(localDownloadPath)
+	assert.NoError(t, err)
+	_, err = httpdtest.RemoveUser(user, http.StatusOK)
+	assert.NoError(t, err)
+	err = os.RemoveAll(user.GetHomeDir())
+	assert.NoError(t, err)
+}
+
 func TestUploadOverwriteVfolder(t *testing.T) {
 	u := getTestUser()
 	vdir := "/vdir"